@@ -0,0 +1,183 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backendpool
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const model = "llama3.2:1b"
+
+func startPool(t *testing.T, backends ...WeightedBackend) *Pool {
+	t.Helper()
+	cfg := &Config{
+		Socket: filepath.Join(t.TempDir(), "backend_pool.sock"),
+		Models: map[string][]WeightedBackend{model: backends},
+	}
+	p := New(cfg, http.DefaultClient)
+	require.NoError(t, p.Start())
+	t.Cleanup(func() {
+		require.NoError(t, p.Close())
+	})
+	return p
+}
+
+func host(t *testing.T, baseURL string) string {
+	t.Helper()
+	u, err := url.Parse(baseURL)
+	require.NoError(t, err)
+	return u.Host
+}
+
+func TestConfigValidate(t *testing.T) {
+	backends := []WeightedBackend{{BaseURL: "http://localhost:8001", Weight: 2}, {BaseURL: "http://localhost:8002"}}
+	tests := map[string]struct {
+		cfg     Config
+		wantErr bool
+	}{
+		"ok, empty":               {cfg: Config{}},
+		"ok, backends":            {cfg: Config{Socket: "pool.sock", Models: map[string][]WeightedBackend{model: backends}}},
+		"ok, health path":         {cfg: Config{Socket: "pool.sock", Models: map[string][]WeightedBackend{model: backends}, HealthPath: "/health"}},
+		"fail, missing socket":    {cfg: Config{Models: map[string][]WeightedBackend{model: backends}}, wantErr: true},
+		"fail, invalid model":     {cfg: Config{Socket: "pool.sock", Models: map[string][]WeightedBackend{"llama 3": backends}}, wantErr: true},
+		"fail, no backends":       {cfg: Config{Socket: "pool.sock", Models: map[string][]WeightedBackend{model: {}}}, wantErr: true},
+		"fail, relative url":      {cfg: Config{Socket: "pool.sock", Models: map[string][]WeightedBackend{model: {{BaseURL: "localhost:8001"}}}}, wantErr: true},
+		"fail, negative weight":   {cfg: Config{Socket: "pool.sock", Models: map[string][]WeightedBackend{model: {{BaseURL: "http://localhost:8001", Weight: -1}}}}, wantErr: true},
+		"fail, health path":       {cfg: Config{HealthPath: "health"}, wantErr: true},
+		"fail, negative cooldown": {cfg: Config{Cooldown: -time.Second}, wantErr: true},
+		"fail, negative interval": {cfg: Config{HealthInterval: -time.Second}, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestPool(t *testing.T) {
+	picks := func(t *testing.T, p *Pool, n int) map[string]int {
+		counts := map[string]int{}
+		for range n {
+			counts[host(t, p.Pick(model, nil))]++
+		}
+		return counts
+	}
+
+	t.Run("ok, picks are spread by weight", func(t *testing.T) {
+		p := startPool(t, WeightedBackend{BaseURL: "http://gpu0:8000", Weight: 3}, WeightedBackend{BaseURL: "http://gpu1:8000"})
+		require.Equal(t, map[string]int{"gpu0:8000": 30, "gpu1:8000": 10}, picks(t, p, 40))
+		require.Empty(t, p.Pick("other", nil))
+	})
+
+	t.Run("ok, failed backend is skipped for the cooldown", func(t *testing.T) {
+		p := startPool(t, WeightedBackend{BaseURL: "http://gpu0:8000"}, WeightedBackend{BaseURL: "http://gpu1:8000"})
+		now := time.Now()
+		p.now = func() time.Time { return now }
+
+		require.Equal(t, "http://gpu1:8000", p.Pick(model, []string{"http://gpu0:8000"}))
+		require.Equal(t, map[string]int{"gpu1:8000": 4}, picks(t, p, 4))
+
+		now = now.Add(DefaultCooldown)
+		require.Equal(t, map[string]int{"gpu0:8000": 2, "gpu1:8000": 2}, picks(t, p, 4))
+	})
+
+	t.Run("ok, unhealthy backends are tried once when every backend is unhealthy", func(t *testing.T) {
+		p := startPool(t, WeightedBackend{BaseURL: "http://gpu0:8000"}, WeightedBackend{BaseURL: "http://gpu1:8000"})
+		for _, b := range p.models[model] {
+			p.setHealth(b, false)
+		}
+		first := p.Pick(model, nil)
+		require.NotEmpty(t, first)
+		require.Empty(t, p.Pick(model, []string{first}))
+	})
+
+	t.Run("ok, health probes mark backends", func(t *testing.T) {
+		healthy := true
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "/prefix/health", r.URL.Path)
+			if !healthy {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer srv.Close()
+
+		p := New(&Config{
+			Models:     map[string][]WeightedBackend{model: {{BaseURL: srv.URL + "/prefix"}}},
+			HealthPath: "/health",
+		}, srv.Client())
+		b := p.models[model][0]
+
+		healthy = false
+		p.probe(context.Background())
+		require.False(t, b.healthy(time.Now()))
+
+		healthy = true
+		p.probe(context.Background())
+		require.True(t, b.healthy(time.Now()))
+	})
+}
+
+func TestPick(t *testing.T) {
+	t.Run("ok, workers fail over to the next backend", func(t *testing.T) {
+		p := startPool(t, WeightedBackend{BaseURL: "http://gpu0:8000", Weight: 100}, WeightedBackend{BaseURL: "http://gpu1:8000"})
+
+		first, err := Pick(t.Context(), p.cfg.Socket, model, nil)
+		require.NoError(t, err)
+		require.Equal(t, "http://gpu0:8000", first)
+
+		next, err := Pick(t.Context(), p.cfg.Socket, model, []string{first})
+		require.NoError(t, err)
+		require.Equal(t, "http://gpu1:8000", next)
+
+		none, err := Pick(t.Context(), p.cfg.Socket, model, []string{first, next})
+		require.NoError(t, err)
+		require.Empty(t, none)
+	})
+
+	t.Run("ok, models without backends", func(t *testing.T) {
+		p := startPool(t, WeightedBackend{BaseURL: "http://gpu0:8000"})
+		backend, err := Pick(t.Context(), p.cfg.Socket, "gemma3:1b", nil)
+		require.NoError(t, err)
+		require.Empty(t, backend)
+	})
+
+	t.Run("fail, invalid model", func(t *testing.T) {
+		p := startPool(t, WeightedBackend{BaseURL: "http://gpu0:8000"})
+		_, err := Pick(t.Context(), p.cfg.Socket, "llama 3", nil)
+		require.Error(t, err)
+	})
+
+	t.Run("fail, pool not running", func(t *testing.T) {
+		_, err := Pick(t.Context(), filepath.Join(t.TempDir(), "missing.sock"), model, nil)
+		require.Error(t, err)
+	})
+}
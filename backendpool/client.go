@@ -0,0 +1,66 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backendpool
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Pick asks the pool listening on socket for the base url of the backend of a request to model.
+// failed are the backends that already failed for the request, the pool skips them. Pick returns
+// "" when the pool has no backends for model, or none left to try.
+func Pick(ctx context.Context, socket string, model string, failed []string) (string, error) {
+	if !validModel(model) {
+		return "", errors.New("invalid model name")
+	}
+	line := formatRequest(model, failed)
+	if len(line) > maxRequestLine {
+		return "", errors.New("backend request exceeds max length")
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to backend pool: %w", err)
+	}
+	defer conn.Close()
+
+	// unblock the write and read below when ctx is done.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	if _, err := io.WriteString(conn, line); err != nil {
+		return "", fmt.Errorf("failed to send backend request: %w", err)
+	}
+
+	r := bufio.NewReaderSize(io.LimitReader(conn, maxRequestLine), maxRequestLine)
+	backend, err := r.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("failed to read backend: %w", err)
+	}
+	return strings.TrimSuffix(backend, "\n"), nil
+}
@@ -0,0 +1,398 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backendpool serves models from pools of local backend replicas, e.g. vLLM instances pinned
+// to different GPUs. Only compute_worker sees the model of a request, so router_com runs a Pool on a
+// unix socket that keeps the rotation and the health of the backends across requests, and workers
+// ask it for the backend of every request.
+//
+// Like modelwake the protocol is minimal: a worker connects and sends a single line with the model
+// and the backends that already failed for the request, the pool answers with a line with the next
+// backend to try, or an empty line when there is none.
+package backendpool
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/confidentsecurity/confidentcompute/listen"
+)
+
+const (
+	// DefaultCooldown is the default time a backend is skipped after a request to it failed.
+	DefaultCooldown = 10 * time.Second
+	// DefaultHealthInterval is the default time between health probes.
+	DefaultHealthInterval = 5 * time.Second
+	// maxModelLen bounds the model name a worker sends.
+	maxModelLen = 256
+	// maxRequestLine bounds the line a worker sends, the model and the backends that failed.
+	maxRequestLine = 8192
+	// requestTimeout bounds how long a worker may take to send its line.
+	requestTimeout = 5 * time.Second
+)
+
+// Config is config for the backend pools of models.
+type Config struct {
+	// Socket is the unix socket the pool listens on for compute_worker.
+	Socket string `yaml:"socket"`
+	// Models maps a model to the backends that serve it. Models without backends use the llm base url,
+	// or the backend router_com picked.
+	Models map[string][]WeightedBackend `yaml:"models"`
+	// HealthPath is probed on every backend, e.g. /health for vLLM. Leave blank to only skip backends
+	// when requests to them fail.
+	HealthPath string `yaml:"health_path"`
+	// HealthInterval is the time between health probes. Leave 0 for DefaultHealthInterval.
+	HealthInterval time.Duration `yaml:"health_interval"`
+	// Cooldown is how long a backend is skipped after a request to it failed. Leave 0 for
+	// DefaultCooldown.
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+// WeightedBackend is a backend replica of a model.
+type WeightedBackend struct {
+	// BaseURL is the url of the backend, request paths are appended to its path.
+	BaseURL string `yaml:"base_url"`
+	// Weight is the share of the requests of the model the backend gets, relative to the other
+	// backends of the model. Leave 0 for 1.
+	Weight int `yaml:"weight"`
+}
+
+func (c *Config) Validate() error {
+	if len(c.Models) > 0 && c.Socket == "" {
+		return errors.New("missing backend pool socket")
+	}
+	for model, backends := range c.Models {
+		if !validModel(model) {
+			return fmt.Errorf("invalid model name %q", model)
+		}
+		if len(backends) == 0 {
+			return fmt.Errorf("model %q has no backends", model)
+		}
+		for _, backend := range backends {
+			u, err := url.Parse(backend.BaseURL)
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				return fmt.Errorf("invalid backend url %q of model %q", backend.BaseURL, model)
+			}
+			if backend.Weight < 0 {
+				return fmt.Errorf("invalid weight %d of backend %q", backend.Weight, backend.BaseURL)
+			}
+		}
+	}
+	if c.HealthPath != "" && !strings.HasPrefix(c.HealthPath, "/") {
+		return fmt.Errorf("health path %q must start with a /", c.HealthPath)
+	}
+	if c.HealthInterval < 0 {
+		return errors.New("health interval can't be negative")
+	}
+	if c.Cooldown < 0 {
+		return errors.New("cooldown can't be negative")
+	}
+	return nil
+}
+
+func (c *Config) cooldown() time.Duration {
+	if c.Cooldown == 0 {
+		return DefaultCooldown
+	}
+	return c.Cooldown
+}
+
+func (c *Config) healthInterval() time.Duration {
+	if c.HealthInterval == 0 {
+		return DefaultHealthInterval
+	}
+	return c.HealthInterval
+}
+
+// backend is a backend of a model and its health.
+type backend struct {
+	baseURL *url.URL
+	// url is the base url as it is sent to workers.
+	url    string
+	weight int
+	// current is the smooth weighted round-robin state of the backend.
+	current int
+	// failedUntil is when a backend whose request failed is used again.
+	failedUntil time.Time
+	// unhealthy is set by the health probes.
+	unhealthy bool
+}
+
+func (b *backend) healthy(now time.Time) bool {
+	return !b.unhealthy && !now.Before(b.failedUntil)
+}
+
+// Pool picks the backends of the requests of workers for the models with backend replicas.
+type Pool struct {
+	cfg      *Config
+	client   *http.Client
+	listener net.Listener
+	wg       sync.WaitGroup
+	now      func() time.Time
+	// ctx is cancelled when the pool closes, it ends the health probes.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	models map[string][]*backend
+}
+
+// New creates a pool for the backends in cfg, client probes their health.
+func New(cfg *Config, client *http.Client) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		cfg:    cfg,
+		client: client,
+		now:    time.Now,
+		ctx:    ctx,
+		cancel: cancel,
+		models: make(map[string][]*backend, len(cfg.Models)),
+	}
+	for model, backends := range cfg.Models {
+		for _, b := range backends {
+			// validated by Config.Validate.
+			u, err := url.Parse(b.BaseURL)
+			if err != nil {
+				continue
+			}
+			p.models[model] = append(p.models[model], &backend{baseURL: u, url: u.String(), weight: max(b.Weight, 1)})
+		}
+	}
+	return p
+}
+
+// Start starts listening on the configured socket, picks backends and probes their health in the
+// background.
+func (p *Pool) Start() error {
+	if err := p.cfg.Validate(); err != nil {
+		return err
+	}
+
+	// compute_worker runs as the same user as router_com.
+	listener, err := listen.UnixSocket(p.cfg.Socket, 0o600).Listen()
+	if err != nil {
+		return fmt.Errorf("failed to listen on backend pool socket: %w", err)
+	}
+
+	p.listener = listener
+	slog.Info("Serving backend pool", "socket", p.cfg.Socket)
+
+	p.wg.Add(2)
+	go func() {
+		defer p.wg.Done()
+		p.serve(listener)
+	}()
+	go func() {
+		defer p.wg.Done()
+		p.checkHealth(p.ctx)
+	}()
+
+	return nil
+}
+
+func (p *Pool) serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("backend pool stopped unexpectedly", "error", err)
+			}
+			return
+		}
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.handle(conn)
+		}()
+	}
+}
+
+// handle answers the backend conn asks for.
+func (p *Pool) handle(conn net.Conn) {
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(requestTimeout))
+	r := bufio.NewReaderSize(io.LimitReader(conn, maxRequestLine), maxRequestLine)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		slog.Warn("failed to read backend request", "error", err)
+		return
+	}
+	model, failed, err := parseRequest(line)
+	if err != nil {
+		slog.Warn("invalid backend request", "error", err)
+		return
+	}
+
+	_, _ = io.WriteString(conn, p.Pick(model, failed)+"\n")
+}
+
+// Pick returns the base url of the backend for the next request to model, skipping the backends in
+// failed. The backends in failed failed for the request, they are skipped by other requests for the
+// cooldown. Returns "" when model has no backends, or none left to try.
+func (p *Pool) Pick(model string, failed []string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	for _, b := range p.models[model] {
+		if slices.Contains(failed, b.url) {
+			b.failedUntil = now.Add(p.cfg.cooldown())
+		}
+	}
+	if b := p.next(model, failed, now); b != nil {
+		return b.url
+	}
+	return ""
+}
+
+// next picks the backend for the next request to model with smooth weighted round-robin, skipping
+// the backends in tried and unhealthy backends. When every backend of the model is unhealthy, the
+// first pick is still made among all of them rather than failing the request. Returns nil when
+// there is no backend left to try.
+func (p *Pool) next(model string, tried []string, now time.Time) *backend {
+	var candidates, healthy []*backend
+	for _, b := range p.models[model] {
+		if slices.Contains(tried, b.url) {
+			continue
+		}
+		candidates = append(candidates, b)
+		if b.healthy(now) {
+			healthy = append(healthy, b)
+		}
+	}
+	if len(healthy) == 0 {
+		if len(tried) > 0 {
+			return nil
+		}
+		healthy = candidates
+	}
+
+	var (
+		best  *backend
+		total int
+	)
+	for _, b := range healthy {
+		b.current += b.weight
+		total += b.weight
+		if best == nil || b.current > best.current {
+			best = b
+		}
+	}
+	if best != nil {
+		best.current -= total
+	}
+	return best
+}
+
+// setHealth records the result of a health probe of b.
+func (p *Pool) setHealth(b *backend, healthy bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b.unhealthy = !healthy
+	if healthy {
+		b.failedUntil = time.Time{}
+	}
+}
+
+// checkHealth probes the backends every health interval until ctx is done.
+func (p *Pool) checkHealth(ctx context.Context) {
+	if p.cfg.HealthPath == "" {
+		return
+	}
+	ticker := time.NewTicker(p.cfg.healthInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.probe(ctx)
+		}
+	}
+}
+
+// probe probes every backend once.
+func (p *Pool) probe(ctx context.Context) {
+	for _, backends := range p.models {
+		for _, b := range backends {
+			p.setHealth(b, p.probeBackend(ctx, b))
+		}
+	}
+}
+
+func (p *Pool) probeBackend(ctx context.Context, b *backend) bool {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.healthInterval())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.baseURL.JoinPath(p.cfg.HealthPath).String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		// backend urls come from our config, not the client, so they are safe to log.
+		slog.DebugContext(ctx, "LLM backend health probe failed", "backend", b.url, "error", err)
+		return false
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// Close stops accepting requests and probing the backends.
+func (p *Pool) Close() error {
+	p.cancel()
+	if p.listener == nil {
+		return nil
+	}
+	err := p.listener.Close()
+	p.wg.Wait()
+	return err
+}
+
+func formatRequest(model string, failed []string) string {
+	return strings.Join(append([]string{model}, failed...), " ") + "\n"
+}
+
+func parseRequest(line string) (string, []string, error) {
+	fields := strings.Split(strings.TrimSuffix(line, "\n"), " ")
+	if !validModel(fields[0]) {
+		return "", nil, errors.New("invalid model name")
+	}
+	return fields[0], fields[1:], nil
+}
+
+// validModel reports whether model can be sent in a request line.
+func validModel(model string) bool {
+	return model != "" && len(model) <= maxModelLen && !strings.ContainsFunc(model, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	})
+}
@@ -0,0 +1,142 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package badgelimit
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func startLimiter(t *testing.T, cfg *Config) *Limiter {
+	t.Helper()
+	cfg.Socket = filepath.Join(t.TempDir(), "badge_limit.sock")
+	l := New(cfg)
+	require.NoError(t, l.Start())
+	t.Cleanup(func() {
+		require.NoError(t, l.Close())
+	})
+	return l
+}
+
+func badgeHash(b byte) []byte {
+	return bytes.Repeat([]byte{b}, badgeHashLen)
+}
+
+func TestLimiter(t *testing.T) {
+	t.Run("ok, slots are bounded per badge", func(t *testing.T) {
+		l := startLimiter(t, &Config{})
+
+		release1, err := Acquire(context.Background(), l.cfg.Socket, badgeHash(1), 2)
+		require.NoError(t, err)
+		release2, err := Acquire(context.Background(), l.cfg.Socket, badgeHash(1), 2)
+		require.NoError(t, err)
+
+		_, err = Acquire(context.Background(), l.cfg.Socket, badgeHash(1), 2)
+		require.ErrorIs(t, err, ErrLimitReached)
+
+		// other badges have their own slots.
+		release3, err := Acquire(context.Background(), l.cfg.Socket, badgeHash(2), 1)
+		require.NoError(t, err)
+
+		require.Equal(t, Stats{Badges: 2, Active: 3, Granted: 3, Rejected: 1}, l.Stats())
+
+		require.NoError(t, release1())
+		require.Eventually(t, func() bool {
+			return l.Stats().Active == 2
+		}, time.Second, 5*time.Millisecond)
+
+		release4, err := Acquire(context.Background(), l.cfg.Socket, badgeHash(1), 2)
+		require.NoError(t, err)
+
+		for _, release := range []func() error{release2, release3, release4} {
+			require.NoError(t, release())
+		}
+		require.Eventually(t, func() bool {
+			stats := l.Stats()
+			return stats.Active == 0 && stats.Badges == 0
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("ok, default max parallel applies without a claim", func(t *testing.T) {
+		l := startLimiter(t, &Config{DefaultMaxParallel: 1})
+
+		release, err := Acquire(context.Background(), l.cfg.Socket, badgeHash(1), 0)
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, release())
+		}()
+
+		_, err = Acquire(context.Background(), l.cfg.Socket, badgeHash(1), 0)
+		require.ErrorIs(t, err, ErrLimitReached)
+	})
+
+	t.Run("ok, no default doesn't bound badges", func(t *testing.T) {
+		l := startLimiter(t, &Config{})
+
+		for range 16 {
+			release, err := Acquire(context.Background(), l.cfg.Socket, badgeHash(1), 0)
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, release())
+			}()
+		}
+		require.Equal(t, 16, l.Stats().Active)
+	})
+
+	t.Run("ok, close releases held slots", func(t *testing.T) {
+		cfg := &Config{Socket: filepath.Join(t.TempDir(), "badge_limit.sock")}
+		l := New(cfg)
+		require.NoError(t, l.Start())
+
+		release, err := Acquire(context.Background(), cfg.Socket, badgeHash(1), 1)
+		require.NoError(t, err)
+
+		require.NoError(t, l.Close())
+		require.Equal(t, 0, l.Stats().Active)
+		_ = release()
+	})
+
+	t.Run("fail, invalid badge hash", func(t *testing.T) {
+		l := startLimiter(t, &Config{})
+
+		_, err := Acquire(context.Background(), l.cfg.Socket, []byte("short"), 1)
+		require.Error(t, err)
+	})
+
+	t.Run("fail, limiter not running", func(t *testing.T) {
+		_, err := Acquire(context.Background(), filepath.Join(t.TempDir(), "missing.sock"), badgeHash(1), 1)
+		require.Error(t, err)
+	})
+}
+
+func TestParseRequest(t *testing.T) {
+	hash, maxParallel, err := parseRequest(formatRequest(badgeHash(0xab), 3))
+	require.NoError(t, err)
+	require.Equal(t, "ab", hash[:2])
+	require.Equal(t, 3, maxParallel)
+
+	for _, line := range []string{"", "abcd 1\n", formatRequest(badgeHash(1), 1)[:65] + "-1\n", "zz 1\n"} {
+		_, _, err := parseRequest(line)
+		require.Error(t, err, line)
+	}
+}
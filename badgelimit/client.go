@@ -0,0 +1,69 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package badgelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Acquire takes a request slot of the badge with badgeHash from the limiter listening on socket,
+// a maxParallel of 0 applies the default of the limiter. The returned release func must be called
+// once the request is done, the slot is also released when the process exits.
+func Acquire(ctx context.Context, socket string, badgeHash []byte, maxParallel int) (func() error, error) {
+	if len(badgeHash) != badgeHashLen {
+		return nil, fmt.Errorf("badge hash must be %d bytes", badgeHashLen)
+	}
+	if maxParallel < 0 {
+		return nil, errors.New("max parallel requests can't be negative")
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to badge limiter: %w", err)
+	}
+
+	// unblock the write and read below when ctx is done.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	if _, err := io.WriteString(conn, formatRequest(badgeHash, maxParallel)); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to send badge limit request: %w", err), conn.Close())
+	}
+
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(conn, status); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to read badge limit status: %w", err), conn.Close())
+	}
+
+	switch status[0] {
+	case statusGranted:
+		return conn.Close, nil
+	case statusLimitReached:
+		return nil, errors.Join(ErrLimitReached, conn.Close())
+	default:
+		return nil, errors.Join(fmt.Errorf("unexpected badge limit status %d", status[0]), conn.Close())
+	}
+}
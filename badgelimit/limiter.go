@@ -0,0 +1,273 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package badgelimit bounds the requests a single badge runs in parallel on a node, so one tenant
+// can't saturate it. Only compute_worker sees the badge, so router_com runs a Limiter on a unix
+// socket that keeps the shared counters and workers hold a slot from it while they run a request.
+//
+// Like the TPM broker the protocol is minimal: a worker connects and sends a single line with the
+// hex encoded badge hash and the max parallel requests of the badge, the limiter answers with a
+// single status byte, and the slot is released when the worker closes the connection.
+package badgelimit
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// status bytes sent by the limiter.
+const (
+	statusGranted      byte = 1
+	statusLimitReached byte = 2
+)
+
+const (
+	// badgeHashLen is the length of a badge hash, a SHA-256 digest.
+	badgeHashLen = 32
+	// maxRequestLine bounds the line a worker sends.
+	maxRequestLine = 128
+	// requestTimeout bounds how long a worker may take to send its line.
+	requestTimeout = 5 * time.Second
+)
+
+// ErrLimitReached is returned when the badge already runs its max parallel requests. It is
+// retryable, the request can be sent again once one of the other requests finished.
+var ErrLimitReached = errors.New("badge reached its max parallel requests")
+
+// Config is config for the badge concurrency limiter.
+type Config struct {
+	// Socket is the unix socket the limiter listens on. Leave blank to disable the limiter.
+	Socket string `yaml:"socket"`
+	// DefaultMaxParallel bounds the parallel requests of badges without a max parallel requests
+	// claim. 0 doesn't bound them.
+	DefaultMaxParallel int `yaml:"default_max_parallel"`
+}
+
+func (c *Config) Validate() error {
+	if c.DefaultMaxParallel < 0 {
+		return errors.New("default max parallel can't be negative")
+	}
+	return nil
+}
+
+// Stats describes the load on the limiter.
+type Stats struct {
+	// Badges is the number of badges with requests in flight.
+	Badges int `json:"badges"`
+	// Active is the number of slots currently held.
+	Active int `json:"active"`
+	// Granted is the number of slots granted since the limiter started.
+	Granted uint64 `json:"granted"`
+	// Rejected is the number of requests rejected because their badge reached its limit.
+	Rejected uint64 `json:"rejected"`
+}
+
+// Limiter grants request slots to workers, at most the max parallel requests per badge.
+type Limiter struct {
+	cfg      *Config
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu sync.Mutex
+	// active counts the held slots by badge hash.
+	active map[string]int
+	// conns are the connections of the workers, closed when the limiter closes.
+	conns map[net.Conn]struct{}
+	stats Stats
+}
+
+func New(cfg *Config) *Limiter {
+	return &Limiter{
+		cfg:    cfg,
+		active: map[string]int{},
+		conns:  map[net.Conn]struct{}{},
+	}
+}
+
+// Start starts listening on the configured socket and grants slots in the background.
+func (l *Limiter) Start() error {
+	if l.cfg.Socket == "" {
+		return errors.New("missing badge limit socket")
+	}
+
+	if err := os.RemoveAll(l.cfg.Socket); err != nil {
+		return fmt.Errorf("failed to remove existing badge limit socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", l.cfg.Socket)
+	if err != nil {
+		return fmt.Errorf("failed to listen on badge limit socket: %w", err)
+	}
+
+	// compute_worker runs as the same user as router_com.
+	if err := os.Chmod(l.cfg.Socket, 0o600); err != nil {
+		return errors.Join(fmt.Errorf("failed to set badge limit socket permissions: %w", err), listener.Close())
+	}
+
+	l.listener = listener
+	slog.Info("Serving badge limiter", "socket", l.cfg.Socket, "default_max_parallel", l.cfg.DefaultMaxParallel)
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		l.serve(listener)
+	}()
+
+	return nil
+}
+
+func (l *Limiter) serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("badge limiter stopped unexpectedly", "error", err)
+			}
+			return
+		}
+
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			l.handle(conn)
+		}()
+	}
+}
+
+// handle grants conn a slot of its badge and holds it until the worker closes conn.
+func (l *Limiter) handle(conn net.Conn) {
+	l.mu.Lock()
+	l.conns[conn] = struct{}{}
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	_ = conn.SetReadDeadline(time.Now().Add(requestTimeout))
+	r := bufio.NewReaderSize(io.LimitReader(conn, maxRequestLine), maxRequestLine)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		slog.Warn("failed to read badge limit request", "error", err)
+		return
+	}
+	badgeHash, maxParallel, err := parseRequest(line)
+	if err != nil {
+		slog.Warn("invalid badge limit request", "error", err)
+		return
+	}
+	if maxParallel == 0 {
+		maxParallel = l.cfg.DefaultMaxParallel
+	}
+
+	if !l.acquire(badgeHash, maxParallel) {
+		_, _ = conn.Write([]byte{statusLimitReached})
+		return
+	}
+	defer l.release(badgeHash)
+
+	if _, err := conn.Write([]byte{statusGranted}); err != nil {
+		// the worker is gone, release the slot right away.
+		return
+	}
+
+	// workers don't send anything else, the read returns when the worker releases the slot.
+	_ = conn.SetReadDeadline(time.Time{})
+	_, _ = io.Copy(io.Discard, conn)
+}
+
+// acquire takes a slot of badgeHash, a maxParallel of 0 doesn't bound the badge.
+func (l *Limiter) acquire(badgeHash string, maxParallel int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if maxParallel > 0 && l.active[badgeHash] >= maxParallel {
+		l.stats.Rejected++
+		return false
+	}
+	l.active[badgeHash]++
+	l.stats.Active++
+	l.stats.Granted++
+	return true
+}
+
+func (l *Limiter) release(badgeHash string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active[badgeHash]--
+	if l.active[badgeHash] <= 0 {
+		delete(l.active, badgeHash)
+	}
+	l.stats.Active--
+}
+
+// Stats returns a snapshot of the limiter stats.
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := l.stats
+	stats.Badges = len(l.active)
+	return stats
+}
+
+// Close stops accepting workers and releases the held slots.
+func (l *Limiter) Close() error {
+	if l.listener == nil {
+		return nil
+	}
+	err := l.listener.Close()
+	l.mu.Lock()
+	for conn := range l.conns {
+		_ = conn.Close()
+	}
+	l.mu.Unlock()
+	l.wg.Wait()
+	return err
+}
+
+func formatRequest(badgeHash []byte, maxParallel int) string {
+	return hex.EncodeToString(badgeHash) + " " + strconv.Itoa(maxParallel) + "\n"
+}
+
+func parseRequest(line string) (string, int, error) {
+	hash, maxText, ok := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+	if !ok {
+		return "", 0, errors.New("malformed request line")
+	}
+	b, err := hex.DecodeString(hash)
+	if err != nil || len(b) != badgeHashLen {
+		return "", 0, errors.New("invalid badge hash")
+	}
+	maxParallel, err := strconv.Atoi(maxText)
+	if err != nil || maxParallel < 0 {
+		return "", 0, errors.New("invalid max parallel requests")
+	}
+	return hash, maxParallel, nil
+}
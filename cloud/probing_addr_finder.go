@@ -0,0 +1,239 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AddrFinder finds the addresses of routers.
+type AddrFinder interface {
+	FindAddrs(ctx context.Context) ([]string, error)
+}
+
+// ProbeMethod is how a ProbingAddrFinder checks discovered addresses.
+type ProbeMethod string
+
+const (
+	// ProbeTCP dials the address.
+	ProbeTCP ProbeMethod = "tcp"
+	// ProbeHTTP sends a GET request to the address and requires a 2xx response.
+	ProbeHTTP ProbeMethod = "http"
+)
+
+type AddrProbeConfig struct {
+	// Method is how addresses are probed, tcp or http. Defaults to tcp.
+	Method ProbeMethod `yaml:"method"`
+	// Port is the port probed on every address.
+	Port int `yaml:"port"`
+	// Path is the path of http probes, e.g. a health endpoint. Defaults to /.
+	Path string `yaml:"path"`
+	// Timeout bounds a single probe, slower addresses are unhealthy. Defaults to 2s.
+	Timeout time.Duration `yaml:"timeout"`
+	// Interval is how often addresses are discovered and probed again. Defaults to 30s.
+	Interval time.Duration `yaml:"interval"`
+}
+
+func (c *AddrProbeConfig) validate() error {
+	switch c.Method {
+	case "", ProbeTCP, ProbeHTTP:
+	default:
+		return fmt.Errorf("invalid probe method: %q", c.Method)
+	}
+	if c.Port <= 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid probe port: %d", c.Port)
+	}
+	if c.Timeout < 0 || c.Interval < 0 {
+		return errors.New("probe timeout and interval can't be negative")
+	}
+	return nil
+}
+
+// ProbingAddrFinder probes the addresses of another finder and orders them by latency, so the lowest
+// latency healthy router is preferred. Addresses are probed again every interval, so the order fails
+// over when a router becomes unhealthy or slow.
+type ProbingAddrFinder struct {
+	finder   AddrFinder
+	method   ProbeMethod
+	port     string
+	path     string
+	timeout  time.Duration
+	interval time.Duration
+	client   *http.Client
+
+	mu        sync.Mutex
+	addrs     []string
+	preferred string
+	probedAt  time.Time
+}
+
+func NewProbingAddrFinder(cfg *AddrProbeConfig, finder AddrFinder) (*ProbingAddrFinder, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	f := &ProbingAddrFinder{
+		finder:   finder,
+		method:   cmp.Or(cfg.Method, ProbeTCP),
+		port:     strconv.Itoa(cfg.Port),
+		path:     cmp.Or(cfg.Path, "/"),
+		timeout:  cmp.Or(cfg.Timeout, 2*time.Second),
+		interval: cmp.Or(cfg.Interval, 30*time.Second),
+	}
+	f.client = &http.Client{
+		Timeout: f.timeout,
+		// a redirect is an answer, the probe doesn't follow it.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return f, nil
+}
+
+// FindAddrs returns the healthy addresses, lowest latency first. Addresses are probed again when the
+// last probes are older than the interval. When no address is healthy all discovered addresses are
+// returned, so the caller can still try them.
+func (f *ProbingAddrFinder) FindAddrs(ctx context.Context) ([]string, error) {
+	f.mu.Lock()
+	if !f.probedAt.IsZero() && time.Since(f.probedAt) < f.interval {
+		addrs := slices.Clone(f.addrs)
+		f.mu.Unlock()
+		return addrs, nil
+	}
+	f.mu.Unlock()
+
+	return f.refresh(ctx)
+}
+
+// Run probes the addresses every interval until ctx is done, so FindAddrs doesn't have to wait for the probes.
+func (f *ProbingAddrFinder) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := f.refresh(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("failed to probe router addresses", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type probeResult struct {
+	addr    string
+	latency time.Duration
+	err     error
+}
+
+func (f *ProbingAddrFinder) refresh(ctx context.Context) ([]string, error) {
+	discovered, err := f.finder.FindAddrs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]probeResult, len(discovered))
+	var wg sync.WaitGroup
+	for i, addr := range discovered {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := f.probe(ctx, addr)
+			results[i] = probeResult{addr: addr, latency: time.Since(start), err: err}
+		}()
+	}
+	wg.Wait()
+
+	addrs := rank(results)
+	if len(addrs) == 0 {
+		slog.Warn("No healthy router addresses, using all discovered addresses", "count", len(discovered))
+		addrs = discovered
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(addrs) > 0 && addrs[0] != f.preferred {
+		slog.Info("Preferred router changed", "previous", f.preferred, "current", addrs[0])
+		f.preferred = addrs[0]
+	}
+	f.addrs = addrs
+	f.probedAt = time.Now()
+	return slices.Clone(addrs), nil
+}
+
+// rank returns the addresses of the successful probes, lowest latency first.
+func rank(results []probeResult) []string {
+	healthy := make([]probeResult, 0, len(results))
+	for _, result := range results {
+		if result.err != nil {
+			slog.Debug("Router address failed probe", "addr", result.addr, "error", result.err)
+			continue
+		}
+		healthy = append(healthy, result)
+	}
+	slices.SortStableFunc(healthy, func(a, b probeResult) int {
+		return cmp.Compare(a.latency, b.latency)
+	})
+
+	addrs := make([]string, 0, len(healthy))
+	for _, result := range healthy {
+		addrs = append(addrs, result.addr)
+	}
+	return addrs
+}
+
+func (f *ProbingAddrFinder) probe(ctx context.Context, addr string) error {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	hostport := net.JoinHostPort(addr, f.port)
+	if f.method == ProbeTCP {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", hostport)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+hostport+f.path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
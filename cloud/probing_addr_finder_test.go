@@ -0,0 +1,142 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type staticFinder struct {
+	addrs []string
+	calls int
+}
+
+func (f *staticFinder) FindAddrs(context.Context) ([]string, error) {
+	f.calls++
+	return f.addrs, nil
+}
+
+// serveRouters serves a handler per loopback address on a shared port, like routers in a MIG.
+func serveRouters(t *testing.T, handlers map[string]http.HandlerFunc) int {
+	t.Helper()
+
+	port := 0
+	for addr, handler := range handlers {
+		ln, err := net.Listen("tcp", net.JoinHostPort(addr, strconv.Itoa(port)))
+		require.NoError(t, err)
+		port = ln.Addr().(*net.TCPAddr).Port
+
+		srv := &http.Server{Handler: handler, ReadHeaderTimeout: time.Second}
+		go func() {
+			_ = srv.Serve(ln)
+		}()
+		t.Cleanup(func() {
+			require.NoError(t, srv.Close())
+		})
+	}
+	return port
+}
+
+func TestProbingAddrFinder(t *testing.T) {
+	ok := func(http.ResponseWriter, *http.Request) {}
+	slow := func(http.ResponseWriter, *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	unhealthy := func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	t.Run("ok, lowest latency healthy router first", func(t *testing.T) {
+		port := serveRouters(t, map[string]http.HandlerFunc{
+			"127.0.0.1": slow,
+			"127.0.0.2": ok,
+			"127.0.0.3": unhealthy,
+		})
+		finder, err := NewProbingAddrFinder(&AddrProbeConfig{Method: ProbeHTTP, Port: port}, &staticFinder{
+			addrs: []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"},
+		})
+		require.NoError(t, err)
+
+		addrs, err := finder.FindAddrs(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, []string{"127.0.0.2", "127.0.0.1"}, addrs)
+	})
+
+	t.Run("ok, tcp probe drops closed ports", func(t *testing.T) {
+		port := serveRouters(t, map[string]http.HandlerFunc{
+			"127.0.0.1": ok,
+		})
+		finder, err := NewProbingAddrFinder(&AddrProbeConfig{Port: port}, &staticFinder{
+			addrs: []string{"127.0.0.4", "127.0.0.1"},
+		})
+		require.NoError(t, err)
+
+		addrs, err := finder.FindAddrs(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, []string{"127.0.0.1"}, addrs)
+	})
+
+	t.Run("ok, all discovered addresses without a healthy router", func(t *testing.T) {
+		port := serveRouters(t, map[string]http.HandlerFunc{
+			"127.0.0.1": unhealthy,
+			"127.0.0.2": unhealthy,
+		})
+		finder, err := NewProbingAddrFinder(&AddrProbeConfig{Method: ProbeHTTP, Port: port}, &staticFinder{
+			addrs: []string{"127.0.0.1", "127.0.0.2"},
+		})
+		require.NoError(t, err)
+
+		addrs, err := finder.FindAddrs(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, []string{"127.0.0.1", "127.0.0.2"}, addrs)
+	})
+
+	t.Run("ok, probed again after the interval", func(t *testing.T) {
+		port := serveRouters(t, map[string]http.HandlerFunc{
+			"127.0.0.1": ok,
+		})
+		inner := &staticFinder{addrs: []string{"127.0.0.1"}}
+		finder, err := NewProbingAddrFinder(&AddrProbeConfig{Port: port, Interval: 50 * time.Millisecond}, inner)
+		require.NoError(t, err)
+
+		for range 2 {
+			_, err = finder.FindAddrs(t.Context())
+			require.NoError(t, err)
+		}
+		require.Equal(t, 1, inner.calls)
+
+		time.Sleep(50 * time.Millisecond)
+		_, err = finder.FindAddrs(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, 2, inner.calls)
+	})
+
+	t.Run("fail, invalid config", func(t *testing.T) {
+		_, err := NewProbingAddrFinder(&AddrProbeConfig{Method: "icmp", Port: 443}, &staticFinder{})
+		require.Error(t, err)
+		_, err = NewProbingAddrFinder(&AddrProbeConfig{}, &staticFinder{})
+		require.Error(t, err)
+	})
+}
@@ -19,14 +19,20 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
+	"slices"
 
 	"github.com/confidentsecurity/confidentcompute/computeboot"
 	"github.com/confidentsecurity/confidentcompute/debug"
 	"github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/confidentsecurity/confidentcompute/routercom/modelstate"
+	"github.com/confidentsecurity/confidentcompute/sealedconfig"
 	"github.com/openpcc/openpcc/app/config"
 	ev "github.com/openpcc/openpcc/attestation/evidence"
 	"github.com/openpcc/openpcc/otel/otelutil"
@@ -52,10 +58,15 @@ type Config struct {
 	GPU *computeboot.GPUConfig `yaml:"gpu"`
 	// TransparencyConfig is config for the transparency service
 	TransparencyConfig *computeboot.TransparencyConfig `yaml:"transparency"`
+	// Checkpoint is config for resuming an interrupted boot after a restart
+	Checkpoint *computeboot.CheckpointConfig `yaml:"checkpoint"`
+	// Status is config for the endpoint that reports the boot progress
+	Status *computeboot.StatusConfig `yaml:"status"`
 }
 
 func run(ctx context.Context) int {
 	debug.SetupLog(serviceName)
+	debug.HandleLevelSignal(ctx)
 
 	shutdown, err := otelutil.Init(context.Background(), serviceName)
 	if err != nil {
@@ -80,68 +91,170 @@ func run(ctx context.Context) int {
 		Evidence:           evidence.DefaultSenderConfig(),
 		GPU:                &computeboot.GPUConfig{},
 		TransparencyConfig: &computeboot.TransparencyConfig{},
+		Checkpoint: &computeboot.CheckpointConfig{
+			File:           computeboot.DefaultCheckpointFile,
+			EvidenceMaxAge: computeboot.DefaultEvidenceMaxAge,
+		},
+		Status: &computeboot.StatusConfig{},
 	}
-	err = config.Load(cfg, configFile, nil)
+	// sealed configs are unsealed with the TPM, plaintext configs are used as-is.
+	configFile, cleanupConfig, err := sealedconfig.Resolve(configFile, sealedconfig.DefaultTPMDevice)
 	if err != nil {
-		slog.Error("failed to load config", "error", err)
+		slog.Error("failed to unseal config", "error", err)
 		return 1
 	}
 
-	gpuManager, err := computeboot.NewGPUManager(cfg.GPU)
+	// a checkpoint is only resumed with the config it was created with.
+	configData, err := os.ReadFile(configFile)
 	if err != nil {
-		slog.Error("failed to create GPU manager", "error", err)
+		slog.Error("failed to read config", "error", errors.Join(err, cleanupConfig()))
 		return 1
 	}
+	configDigest := sha256.Sum256(configData)
 
-	ctx, verifyGPUStateSpan := otelutil.Tracer.Start(ctx, "compute_boot.verifyGPUState")
-	if err := gpuManager.VerifyGPUState(ctx); err != nil {
-		slog.Error("GPU configuration failed", "error", err)
-		verifyGPUStateSpan.RecordError(err)
+	err = errors.Join(config.Load(cfg, configFile, nil), cleanupConfig())
+	if err != nil {
+		slog.Error("failed to load config", "error", err)
 		return 1
 	}
-	verifyGPUStateSpan.End()
 
-	tpmOperator, err := computeboot.NewTPMOperatorWithConfig(cfg.TPM)
-	if err != nil {
-		slog.Error("failed to create TPM operator", "error", err)
+	if err := cfg.TPM.ApplyPreset(); err != nil {
+		slog.Error("invalid tpm config", "error", err)
 		return 1
 	}
 
-	if err := setupTPM(ctx, tpmOperator); err != nil {
-		slog.Error("TPM setup failed", "error", err)
+	if err := validateMeasurementPCRs(cfg); err != nil {
+		slog.Error("invalid measurement config", "error", err)
 		return 1
 	}
-	defer func() {
-		err = errors.Join(err, tpmOperator.Close())
-	}()
 
-	slog.InfoContext(ctx, "Preparing attestation evidence")
+	progress := computeboot.NewBootProgress()
+	if cfg.Status.Addr != "" {
+		statusServer := computeboot.NewStatusServer(cfg.Status, progress)
+		if err := statusServer.Start(); err != nil {
+			slog.Error("failed to start boot status endpoint", "error", err)
+			return 1
+		}
+		defer func() {
+			if err := statusServer.Close(); err != nil {
+				slog.Warn("failed to close boot status endpoint", "error", err)
+			}
+		}()
+	}
 
-	evidenceList, err := attestNode(tpmOperator, gpuManager, cfg)
+	gpuManager, err := computeboot.NewGPUManager(cfg.GPU)
 	if err != nil {
-		slog.Error("failed to attest", "error", err)
+		slog.Error("failed to create GPU manager", "error", err)
 		return 1
 	}
-	slog.InfoContext(ctx, "Attestation evidence prepared successfully", "evidence", evidenceList)
 
-	// if gpu is present, mark it as ready for computing, after successful attestation
-	if err := gpuManager.EnableConfidentialCompute(); err != nil {
-		slog.Error("failed to enable confidential compute", "error", err)
+	tpmOperator, err := computeboot.NewTPMOperatorWithConfig(cfg.TPM)
+	if err != nil {
+		slog.Error("failed to create TPM operator", "error", err)
+		return 1
+	}
+	defer func() {
+		err = errors.Join(err, tpmOperator.Close())
+	}()
+
+	machine := computeboot.NewBootMachine(cfg.Checkpoint, hex.EncodeToString(configDigest[:]))
+	machine.ReportProgress(progress)
+	// each phase is checkpointed, a restarted compute_boot resumes after the last completed phase.
+	checkpoint, err := machine.Run(ctx, []computeboot.BootStep{
+		{
+			Phase: computeboot.PhaseGPUVerified,
+			Run: func(ctx context.Context, _ *computeboot.Checkpoint) error {
+				if err := gpuManager.VerifyGPUState(ctx); err != nil {
+					return fmt.Errorf("GPU configuration failed: %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			Phase: computeboot.PhaseMeasurementsCollected,
+			Run: func(ctx context.Context, cp *computeboot.Checkpoint) error {
+				measurements, err := collectMeasurements(ctx, gpuManager, cfg)
+				if err != nil {
+					return err
+				}
+				cp.Measurements = measurements
+				return nil
+			},
+		},
+		{
+			Phase:    computeboot.PhaseMeasured,
+			Measures: true,
+			Run: func(ctx context.Context, cp *computeboot.Checkpoint) error {
+				// everything that can fail and be retried was done while collecting, this phase only
+				// extends the pcrs.
+				if err := computeboot.ExtendMeasurements(tpmOperator.GetDevice(), cp.Measurements); err != nil {
+					return fmt.Errorf("measurement failed: %w", err)
+				}
+				return nil
+			},
+		},
+		{
+			Phase: computeboot.PhaseTPMKeysReady,
+			Run: func(ctx context.Context, _ *computeboot.Checkpoint) error {
+				return setupTPM(ctx, tpmOperator)
+			},
+		},
+		{
+			Phase:  computeboot.PhaseEvidenceCollected,
+			MaxAge: cfg.Checkpoint.EvidenceTTL(),
+			Run: func(ctx context.Context, cp *computeboot.Checkpoint) error {
+				// gpus that fail to become ready are reset and attested again, when recovery is configured.
+				return computeboot.RecoverGPUs(ctx, cfg.GPU.Recovery, gpuManager, func(ctx context.Context) error {
+					slog.InfoContext(ctx, "Preparing attestation evidence")
+					evidenceList, err := attestNode(ctx, tpmOperator, gpuManager, cfg)
+					if err != nil {
+						return fmt.Errorf("failed to attest: %w", err)
+					}
+
+					cp.Evidence, err = evidenceList.MarshalBinary()
+					if err != nil {
+						return fmt.Errorf("failed to marshal evidence: %w", err)
+					}
+
+					// if gpu is present, mark it as ready for computing, after successful attestation
+					if err := gpuManager.EnableConfidentialCompute(); err != nil {
+						return fmt.Errorf("failed to enable confidential compute: %w", err)
+					}
+					return nil
+				})
+			},
+		},
+		{
+			Phase: computeboot.PhaseEngineWarm,
+			Run: func(ctx context.Context, _ *computeboot.Checkpoint) error {
+				// initialize inference engine after GPU is ready
+				slog.InfoContext(ctx, "Initializing inference engine", "engine", cfg.InferenceEngine.Type)
+				if err := initializeInferenceEngine(ctx, cfg.InferenceEngine); err != nil {
+					return fmt.Errorf("inference engine initialization failed: %w", err)
+				}
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		slog.Error("boot failed", "error", err)
 		return 1
 	}
 
-	// initialize inference engine after GPU is ready
-	slog.InfoContext(ctx, "Initializing inference engine", "engine", cfg.InferenceEngine.Type)
-	if err := initializeInferenceEngine(ctx, cfg.InferenceEngine); err != nil {
-		slog.Error("inference engine initialization failed", "error", err)
+	var evidenceList ev.SignedEvidenceList
+	if err := evidenceList.UnmarshalBinary(checkpoint.Evidence); err != nil {
+		slog.Error("failed to unmarshal attestation evidence", "error", err)
 		return 1
 	}
+	slog.InfoContext(ctx, "Attestation evidence prepared successfully", "evidence", evidenceList)
 
 	if err := evidence.Send(ctx, cfg.Evidence, evidenceList); err != nil {
 		slog.Error("failed to send attestation evidence to routercom", "error", err)
+		progress.Failed(err)
 		return 1
 	}
 
+	progress.Finished()
 	return 0
 }
 
@@ -168,6 +281,278 @@ func setupTPM(ctx context.Context, tpmOperator *computeboot.TPMOperator) error {
 	return nil
 }
 
+// collectMeasurements fetches the model artifacts, verifies the GPU topology and collects the digests
+// PhaseMeasured extends into the PCRs, in the order they are extended.
+// validateMeasurementPCRs checks the PCR of every configured measurement, so a misconfigured PCR fails
+// the boot before anything is measured.
+func validateMeasurementPCRs(cfg *Config) error {
+	pcrs := map[string]uint32{}
+	if cfg.InferenceEngine != nil {
+		pcrs["inference_engine.artifact_pcr"] = cfg.InferenceEngine.ArtifactPCR
+	}
+	if cfg.GPU != nil {
+		pcrs["gpu.topology_pcr"] = cfg.GPU.TopologyPCR
+	}
+	if attestation := cfg.Attestation; attestation != nil {
+		if attestation.Binaries != nil {
+			pcrs["attestation.binaries.pcr"] = attestation.Binaries.PCR
+		}
+		if attestation.HostEnvironment != nil {
+			pcrs["attestation.host_environment.pcr"] = attestation.HostEnvironment.PCR
+		}
+		if attestation.Maintenance != nil {
+			pcrs["attestation.maintenance.pcr"] = attestation.Maintenance.PCR
+		}
+		if attestation.OutputFilter != nil {
+			pcrs["attestation.output_filter.pcr"] = attestation.OutputFilter.PCR
+		}
+		if attestation.EngineConfig != nil {
+			pcrs["attestation.engine_config.pcr"] = attestation.EngineConfig.PCR
+		}
+		if attestation.ExperimentalRoutes != nil {
+			pcrs["attestation.experimental_routes.pcr"] = attestation.ExperimentalRoutes.PCR
+		}
+		if attestation.Mirror != nil {
+			pcrs["attestation.mirror.pcr"] = attestation.Mirror.PCR
+		}
+	}
+
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(pcrs)) {
+		if err := computeboot.ValidateMeasurementPCR(pcrs[name]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func collectMeasurements(ctx context.Context, gpuManager computeboot.GPUManager, cfg *Config) ([]computeboot.Measurement, error) {
+	var measurements []computeboot.Measurement
+
+	// fetch models before the TPM is set up, so the measured artifact digests are part of the
+	// PCR values the request encryption key is bound to.
+	artifacts, err := fetchModels(ctx, cfg.InferenceEngine)
+	if err != nil {
+		return nil, fmt.Errorf("model fetch failed: %w", err)
+	}
+	measurements = append(measurements, artifacts...)
+
+	topology, err := measureGPUTopology(ctx, gpuManager, cfg.GPU)
+	if err != nil {
+		return nil, fmt.Errorf("gpu topology verification failed: %w", err)
+	}
+	measurements = append(measurements, topology...)
+
+	binaries, err := measureBinaries(ctx, cfg.Attestation.Binaries)
+	if err != nil {
+		return nil, fmt.Errorf("binary measurement failed: %w", err)
+	}
+	measurements = append(measurements, binaries...)
+
+	hostEnv, err := measureHostEnvironment(ctx, cfg.Attestation.HostEnvironment)
+	if err != nil {
+		return nil, fmt.Errorf("host environment measurement failed: %w", err)
+	}
+	measurements = append(measurements, hostEnv...)
+
+	maintenance, err := measureMaintenance(ctx, cfg.Attestation.Maintenance)
+	if err != nil {
+		return nil, fmt.Errorf("maintenance measurement failed: %w", err)
+	}
+	measurements = append(measurements, maintenance...)
+
+	outputFilter, err := measureOutputFilter(ctx, cfg.Attestation.OutputFilter)
+	if err != nil {
+		return nil, fmt.Errorf("output filter measurement failed: %w", err)
+	}
+	measurements = append(measurements, outputFilter...)
+
+	engineConfig, err := measureEngineConfig(ctx, cfg.InferenceEngine, cfg.Attestation.EngineConfig)
+	if err != nil {
+		return nil, fmt.Errorf("engine config measurement failed: %w", err)
+	}
+	measurements = append(measurements, engineConfig...)
+
+	experimentalRoutes, err := measureExperimentalRoutes(ctx, cfg.Attestation.ExperimentalRoutes)
+	if err != nil {
+		return nil, fmt.Errorf("experimental routes measurement failed: %w", err)
+	}
+	measurements = append(measurements, experimentalRoutes...)
+
+	mirror, err := measureMirror(ctx, cfg.Attestation.Mirror)
+	if err != nil {
+		return nil, fmt.Errorf("mirror measurement failed: %w", err)
+	}
+	measurements = append(measurements, mirror...)
+
+	return measurements, nil
+}
+
+func fetchModels(ctx context.Context, engineConfig *computeboot.InferenceEngineConfig) ([]computeboot.Measurement, error) {
+	ctx, span := otelutil.Tracer.Start(ctx, "compute_boot.fetchModels")
+	defer span.End()
+
+	if len(engineConfig.Artifacts) == 0 {
+		return nil, nil
+	}
+
+	fetcher := computeboot.NewModelFetcherWithConfig(engineConfig)
+	artifacts, err := fetcher.Fetch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch model artifacts: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Model artifacts fetched", "count", len(artifacts))
+	return computeboot.ModelArtifactMeasurements(engineConfig.ArtifactPCR, artifacts), nil
+}
+
+// measureGPUTopology verifies the NVLink/NVSwitch fabric and returns its measurement.
+func measureGPUTopology(ctx context.Context, gpuManager computeboot.GPUManager, gpuConfig *computeboot.GPUConfig) ([]computeboot.Measurement, error) {
+	ctx, span := otelutil.Tracer.Start(ctx, "compute_boot.measureGPUTopology")
+	defer span.End()
+
+	topology, err := gpuManager.Topology(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gpu topology: %w", err)
+	}
+
+	m, err := computeboot.GPUTopologyMeasurement(gpuConfig.TopologyPCR, topology)
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure gpu topology: %w", err)
+	}
+
+	return []computeboot.Measurement{m}, nil
+}
+
+// measureBinaries returns the measurements of the digests of the binaries that handle plaintext
+// requests, when configured. The digests themselves are included in the evidence by attestNode.
+func measureBinaries(ctx context.Context, binariesConfig *computeboot.BinaryMeasurementConfig) ([]computeboot.Measurement, error) {
+	_, span := otelutil.Tracer.Start(ctx, "compute_boot.measureBinaries")
+	defer span.End()
+
+	if binariesConfig == nil || len(binariesConfig.Paths) == 0 {
+		return nil, nil
+	}
+
+	digests, err := computeboot.DigestBinaries(binariesConfig.Paths)
+	if err != nil {
+		return nil, err
+	}
+
+	return computeboot.BinaryMeasurements(binariesConfig.PCR, digests)
+}
+
+// measureHostEnvironment returns the measurement of the digest of the host environment, when
+// configured. The host environment itself is included in the evidence by attestNode.
+func measureHostEnvironment(ctx context.Context, hostEnvConfig *computeboot.HostEnvironmentConfig) ([]computeboot.Measurement, error) {
+	_, span := otelutil.Tracer.Start(ctx, "compute_boot.measureHostEnvironment")
+	defer span.End()
+
+	if hostEnvConfig == nil {
+		return nil, nil
+	}
+
+	env, err := computeboot.ReadHostEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	return single(computeboot.HostEnvironmentMeasurement(hostEnvConfig.PCR, env))
+}
+
+// measureMaintenance returns the measurement of the digest of the maintenance claim, when the node
+// boots in maintenance mode. The claim itself is included in the evidence by attestNode.
+func measureMaintenance(ctx context.Context, maintenanceConfig *computeboot.MaintenanceConfig) ([]computeboot.Measurement, error) {
+	_, span := otelutil.Tracer.Start(ctx, "compute_boot.measureMaintenance")
+	defer span.End()
+
+	if !maintenanceConfig.Active() {
+		return nil, nil
+	}
+
+	return single(computeboot.MaintenanceMeasurement(maintenanceConfig.PCR, maintenanceConfig.Claim()))
+}
+
+// measureOutputFilter returns the measurement of the digest of the output filter module, when
+// configured. The digest itself is included in the evidence by attestNode.
+func measureOutputFilter(ctx context.Context, outputFilterConfig *computeboot.OutputFilterConfig) ([]computeboot.Measurement, error) {
+	_, span := otelutil.Tracer.Start(ctx, "compute_boot.measureOutputFilter")
+	defer span.End()
+
+	if outputFilterConfig == nil {
+		return nil, nil
+	}
+
+	f, err := computeboot.ReadOutputFilter(outputFilterConfig.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return single(computeboot.OutputFilterMeasurement(outputFilterConfig.PCR, f))
+}
+
+// measureExperimentalRoutes returns the measurement of the digest of the experimental routes
+// disclosure, when configured. The disclosure itself is included in the evidence by attestNode.
+func measureExperimentalRoutes(ctx context.Context, experimentalRoutesConfig *computeboot.ExperimentalRoutesConfig) ([]computeboot.Measurement, error) {
+	_, span := otelutil.Tracer.Start(ctx, "compute_boot.measureExperimentalRoutes")
+	defer span.End()
+
+	if !experimentalRoutesConfig.Active() {
+		return nil, nil
+	}
+
+	claim, err := experimentalRoutesConfig.Claim()
+	if err != nil {
+		return nil, err
+	}
+
+	return single(computeboot.ExperimentalRoutesMeasurement(experimentalRoutesConfig.PCR, claim))
+}
+
+// measureMirror returns the measurement of the digest of the mirror claim, when requests are
+// mirrored. The claim itself is included in the evidence by attestNode.
+func measureMirror(ctx context.Context, mirrorConfig *computeboot.MirrorConfig) ([]computeboot.Measurement, error) {
+	_, span := otelutil.Tracer.Start(ctx, "compute_boot.measureMirror")
+	defer span.End()
+
+	if !mirrorConfig.Active() {
+		return nil, nil
+	}
+
+	claim, err := mirrorConfig.Claim()
+	if err != nil {
+		return nil, err
+	}
+
+	return single(computeboot.MirrorMeasurement(mirrorConfig.PCR, claim))
+}
+
+// measureEngineConfig returns the measurement of the digest of the inference engine config, when
+// configured. The engine config itself is included in the evidence by attestNode.
+func measureEngineConfig(ctx context.Context, engineConfig *computeboot.InferenceEngineConfig, engineConfigConfig *computeboot.EngineConfigConfig) ([]computeboot.Measurement, error) {
+	ctx, span := otelutil.Tracer.Start(ctx, "compute_boot.measureEngineConfig")
+	defer span.End()
+
+	if engineConfigConfig == nil {
+		return nil, nil
+	}
+
+	c, err := computeboot.ReadEngineConfig(ctx, engineConfig, engineConfigConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return single(computeboot.EngineConfigMeasurement(engineConfigConfig.PCR, c))
+}
+
+// single returns the measurement m as a list.
+func single(m computeboot.Measurement, err error) ([]computeboot.Measurement, error) {
+	if err != nil {
+		return nil, err
+	}
+	return []computeboot.Measurement{m}, nil
+}
+
 func initializeInferenceEngine(ctx context.Context, engineConfig *computeboot.InferenceEngineConfig) error {
 	ctx, span := otelutil.Tracer.Start(ctx, "compute_boot.initializeInferenceEngine")
 	defer span.End()
@@ -192,20 +577,53 @@ func initializeInferenceEngine(ctx context.Context, engineConfig *computeboot.In
 		}
 	}
 
-	// Prewarm models to load them into memory and warm any disk caches.
-	if err := engine.Prewarm(ctx); err != nil {
+	// Prewarm models to load them into memory and warm any disk caches. Models that fail to
+	// prewarm stay cold and are not advertised, boot only fails when no model is warm.
+	states, err := engine.Prewarm(ctx)
+	if err != nil {
 		return fmt.Errorf("failed to prewarm models: %w", err)
 	}
 
+	// the benchmark is best effort, a failed run only means the model isn't advertised with a tier.
+	states = engine.Benchmark(ctx, states)
+
+	// sleeping models free their GPU memory until router_com wakes them up for a request.
+	states, err = engine.SleepModels(ctx, states)
+	if err != nil {
+		return fmt.Errorf("failed to put models to sleep: %w", err)
+	}
+
+	// let router_com know which models are warm, so cold models are not advertised to the router.
+	stateFile := engineConfig.ModelStateFile
+	if stateFile == "" {
+		stateFile = modelstate.DefaultFile
+	}
+	if err := modelstate.Write(stateFile, states); err != nil {
+		return fmt.Errorf("failed to write model states: %w", err)
+	}
+
 	slog.InfoContext(ctx, "inference engine initialized successfully")
 	return nil
 }
 
-func attestNode(tpmOperator *computeboot.TPMOperator, gpuManager computeboot.GPUManager, cfg *Config) (ev.SignedEvidenceList, error) {
+func attestNode(ctx context.Context, tpmOperator *computeboot.TPMOperator, gpuManager computeboot.GPUManager, cfg *Config) (ev.SignedEvidenceList, error) {
 	evidenceList, err := computeboot.PrepareAttestationPackage(tpmOperator.GetDevice(), gpuManager, cfg.TPM, cfg.Attestation, cfg.TransparencyConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to prepare attestation package: %w", err)
 	}
 
+	// the engine config is read from the unit of the inference engine, which is only known here.
+	if cfg.Attestation != nil && cfg.Attestation.EngineConfig != nil {
+		engineConfig, err := computeboot.ReadEngineConfig(ctx, cfg.InferenceEngine, cfg.Attestation.EngineConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read engine config: %w", err)
+		}
+		piece, err := evidence.EngineConfigPiece(engineConfig)
+		if err != nil {
+			return nil, err
+		}
+		evidenceList = append(evidenceList, piece)
+	}
+
 	return evidenceList, nil
 }
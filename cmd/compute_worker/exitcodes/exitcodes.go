@@ -21,13 +21,30 @@ import (
 	"errors"
 
 	"github.com/confidentsecurity/confidentcompute/computeworker"
+	"github.com/confidentsecurity/confidentcompute/tpmerr"
 )
 
-// RequestDecapsulationCode indicates request decapsulation failed.
-const RequestDecapsulationCode = 10
+const (
+	// RequestDecapsulationCode indicates request decapsulation failed.
+	RequestDecapsulationCode = 10
+	// TPMUnavailableCode indicates the TPM was busy or kept asking for the command to be retried.
+	TPMUnavailableCode = 11
+	// PanicCode indicates the worker panicked, the crash report is written to stderr.
+	PanicCode = 12
+)
 
 // MapErrorToExitCode maps errors to exit codes.
 func MapErrorToExitCode(err error) int {
+	// checked first, decapsulation errors caused by a busy TPM are not the client's fault.
+	if errors.Is(err, tpmerr.ErrBusy) || errors.Is(err, tpmerr.ErrRetryable) {
+		return TPMUnavailableCode
+	}
+
+	panicErr := &computeworker.PanicError{}
+	if errors.As(err, &panicErr) {
+		return PanicCode
+	}
+
 	inputErr := &computeworker.RequestDecapsulationError{}
 	if errors.As(err, &inputErr) {
 		return RequestDecapsulationCode
@@ -28,6 +28,7 @@ import (
 	"github.com/confidentsecurity/confidentcompute/cmd/compute_worker/exitcodes"
 	"github.com/confidentsecurity/confidentcompute/computeworker"
 	"github.com/confidentsecurity/confidentcompute/debug"
+	"github.com/confidentsecurity/confidentcompute/faultinject"
 	"github.com/confidentsecurity/confidentcompute/profiling"
 	"github.com/openpcc/openpcc/otel/otelutil"
 	"go.opentelemetry.io/otel"
@@ -41,6 +42,13 @@ func main() {
 }
 
 func run() int {
+	// router_com asks the worker to migrate its request when the node has to shut down. It can do so
+	// as soon as the process started and the default action of the signal kills the process, so the
+	// signal is caught before anything else. A signal that arrives early waits in the channel.
+	migrate := make(chan os.Signal, 1)
+	signal.Notify(migrate, computeworker.MigrationSignal)
+	defer signal.Stop(migrate)
+
 	profiling.ComputeWorker.InitProfilerIfEnabled()
 
 	debug.SetupLog(serviceName)
@@ -68,6 +76,11 @@ func run() int {
 		return 1
 	}
 
+	if err := faultinject.Enable(config.FaultInjection); err != nil {
+		slog.Error("invalid fault injection config", "error", err)
+		return 1
+	}
+
 	// Create a new context with our trace information.
 	ctx := context.Background()
 	if v := config.Traceparent; v != "" {
@@ -75,14 +88,21 @@ func run() int {
 		ctx = otel.GetTextMapPropagator().Extract(ctx, carrier)
 	}
 
+	ctx = debug.WithRequestID(ctx, config.RequestParams.NodeRequestID)
 	ctx, _ = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
 
+	if config.Session {
+		return runSession(ctx, config, migrate)
+	}
+
 	worker, err := computeworker.New(ctx, config, os.Stdin, os.Stdout)
 	if err != nil {
 		slog.Error("failed to create worker", "error", err)
 		return exitcodes.MapErrorToExitCode(err)
 	}
 
+	go forwardMigration(migrate, worker)
+
 	err = worker.Run()
 	if err != nil {
 		slog.Error("failed to run worker", "error", err)
@@ -91,3 +111,30 @@ func run() int {
 
 	return 0
 }
+
+// runSession handles the requests router_com frames on stdin until it closes stdin. The exit
+// code of each request is reported in its response, the process exit code only reports the session.
+func runSession(ctx context.Context, config *computeworker.Config, migrate <-chan os.Signal) int {
+	session, err := computeworker.NewSession(ctx, config, os.Stdin, os.Stdout, exitcodes.MapErrorToExitCode)
+	if err != nil {
+		slog.Error("failed to create session", "error", err)
+		return exitcodes.MapErrorToExitCode(err)
+	}
+
+	go forwardMigration(migrate, session)
+
+	err = session.Run()
+	if err != nil {
+		slog.Error("failed to run session", "error", err)
+		return 1
+	}
+
+	return 0
+}
+
+// forwardMigration migrates m once the migration signal is received.
+func forwardMigration(migrate <-chan os.Signal, m interface{ Migrate() }) {
+	<-migrate
+	slog.Info("Migration requested")
+	m.Migrate()
+}
@@ -0,0 +1,107 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// conformance runs the conformance cases against a running compute node and prints a pass/fail
+// report. It exits with a non-zero status when a case fails, so it can gate a deploy.
+//
+// Usage:
+//
+//	conformance -node_url http://node:8080/ -node_public_key <base64> \
+//	  -badge_private_key_file badge.pem -model llama3.2:1b
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/conformance"
+)
+
+var (
+	nodeURLPtr             = flag.String("node_url", "", "URL of the router_com of the node")
+	nodePublicKeyPtr       = flag.String("node_public_key", "", "base64 encoded request encryption public key of the node, as passed to compute_worker with -tpm_base64_public_key")
+	badgePrivateKeyFilePtr = flag.String("badge_private_key_file", "", "path to the PEM encoded ed25519 private key that badges are signed with")
+	modelPtr               = flag.String("model", "", "chat model of the node")
+	rerankModelPtr         = flag.String("rerank_model", "", "rerank model of the node, leave blank to skip the rerank case")
+	creditAmountPtr        = flag.Int64("credit_amount", 10000, "credits sent with each request")
+	timeoutPtr             = flag.Duration("timeout", 2*time.Minute, "timeout of each request")
+	refundTrailerPtr       = flag.Bool("refund_trailer", true, "expect refunds in trailers, disable for nodes that only report refunds with callbacks")
+)
+
+func main() {
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	passed, err := run(ctx)
+	stop()
+	if err != nil {
+		slog.Error("conformance failed", "error", err)
+		os.Exit(1)
+	}
+	if !passed {
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context) (bool, error) {
+	if *nodeURLPtr == "" || *nodePublicKeyPtr == "" || *badgePrivateKeyFilePtr == "" || *modelPtr == "" {
+		return false, errors.New("-node_url, -node_public_key, -badge_private_key_file and -model are required")
+	}
+
+	publicKey, err := base64.StdEncoding.DecodeString(*nodePublicKeyPtr)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode node public key: %w", err)
+	}
+	client, err := conformance.NewNodeClient(*nodeURLPtr, publicKey, http.DefaultClient)
+	if err != nil {
+		return false, err
+	}
+
+	// #nosec G304 -- key file is provided by the operator.
+	b, err := os.ReadFile(*badgePrivateKeyFilePtr)
+	if err != nil {
+		return false, fmt.Errorf("failed to read badge private key: %w", err)
+	}
+	privateKey, err := conformance.ParseBadgePrivateKey(b)
+	if err != nil {
+		return false, err
+	}
+	models := []string{*modelPtr}
+	if *rerankModelPtr != "" {
+		models = append(models, *rerankModelPtr)
+	}
+	badge, err := conformance.NewBadge(privateKey, models...)
+	if err != nil {
+		return false, err
+	}
+
+	cases := conformance.Cases(conformance.Config{
+		Model:         *modelPtr,
+		RerankModel:   *rerankModelPtr,
+		Badge:         badge,
+		RefundTrailer: *refundTrailerPtr,
+	})
+	results := conformance.Run(ctx, client, cases, *creditAmountPtr, *timeoutPtr)
+	return conformance.WriteReport(os.Stdout, results)
+}
@@ -0,0 +1,240 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// gputool inspects and changes the confidential compute state of the local NVIDIA GPUs through
+// NVML, so operators can debug a node without crafting a compute_boot config.
+//
+// Usage:
+//
+//	gputool status
+//	gputool set-ready
+//	gputool reset
+//	gputool evidence -out evidence.json [-nonce <hex>]
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/confidentsecurity/confidentcompute/computeboot"
+	"github.com/confidentsecurity/go-nvtrust/pkg/gonvtrust/gpu"
+)
+
+const usage = `usage: gputool <command> [flags]
+
+commands:
+  status     show the persistence mode, confidential compute and ready state
+  set-ready  enable the confidential compute ready state
+  reset      reset the GPUs, compute_boot has to attest them again before they are ready
+  evidence   collect a one-off evidence blob to a file
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	admin, err := gpu.NewNvmlGPUAdmin(nil)
+	if err != nil {
+		slog.Error("failed to initialize nvml", "error", err)
+		os.Exit(1)
+	}
+
+	err = run(admin, os.Args[1], os.Args[2:])
+	if shutdownErr := admin.Shutdown(); shutdownErr != nil {
+		slog.Error("failed to shutdown nvml", "error", shutdownErr)
+	}
+	if err != nil {
+		slog.Error("gputool failed", "command", os.Args[1], "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(admin computeboot.GPUAdmin, command string, args []string) error {
+	switch command {
+	case "status":
+		return status(admin)
+	case "set-ready":
+		return setReady(admin)
+	case "reset":
+		return reset(admin, computeboot.NewNVMLGPUResetter())
+	case "evidence":
+		return evidence(admin, args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// gpuStatus is the confidential compute state of the GPUs, compute_boot expects persistence mode
+// and confidential compute enabled, and the ready state disabled until it attested the GPUs.
+type gpuStatus struct {
+	PersistenceMode     bool `json:"persistence_mode"`
+	ConfidentialCompute bool `json:"confidential_compute"`
+	ReadyState          bool `json:"ready_state"`
+}
+
+func readStatus(admin computeboot.GPUAdmin) (gpuStatus, error) {
+	persistenceMode, err := admin.AllGPUInPersistenceMode()
+	if err != nil {
+		return gpuStatus{}, fmt.Errorf("failed to check persistence mode: %w", err)
+	}
+	confidentialCompute, err := admin.IsConfidentialComputeEnabled()
+	if err != nil {
+		return gpuStatus{}, fmt.Errorf("failed to check confidential compute state: %w", err)
+	}
+	readyState, err := admin.IsGPUReadyStateEnabled()
+	if err != nil {
+		return gpuStatus{}, fmt.Errorf("failed to check ready state: %w", err)
+	}
+
+	return gpuStatus{
+		PersistenceMode:     persistenceMode,
+		ConfidentialCompute: confidentialCompute,
+		ReadyState:          readyState,
+	}, nil
+}
+
+func status(admin computeboot.GPUAdmin) error {
+	s, err := readStatus(admin)
+	if err != nil {
+		return err
+	}
+	return writeJSON(os.Stdout, s)
+}
+
+func setReady(admin computeboot.GPUAdmin) error {
+	if err := admin.EnableGPUReadyState(); err != nil {
+		return fmt.Errorf("failed to enable ready state: %w", err)
+	}
+
+	s, err := readStatus(admin)
+	if err != nil {
+		return err
+	}
+	if !s.ReadyState {
+		return errors.New("ready state is still disabled")
+	}
+
+	slog.Info("Enabled GPU ready state")
+	return writeJSON(os.Stdout, s)
+}
+
+// reset resets the GPUs like compute_boot does when they fail to become ready, e.g. after they fell
+// out of the ready state at runtime.
+func reset(admin computeboot.GPUAdmin, resetter computeboot.GPUResetter) error {
+	if err := resetter.ResetGPUs(); err != nil {
+		return fmt.Errorf("failed to reset gpus: %w", err)
+	}
+
+	s, err := readStatus(admin)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Reset GPUs")
+	return writeJSON(os.Stdout, s)
+}
+
+// evidenceBlob is the raw evidence of the GPUs. It is not verified, use it to debug attestation
+// failures, e.g. by submitting it to NRAS by hand.
+type evidenceBlob struct {
+	Nonce string        `json:"nonce"`
+	GPUs  []gpuEvidence `json:"gpus"`
+}
+
+type gpuEvidence struct {
+	Arch              string `json:"arch"`
+	AttestationReport []byte `json:"attestation_report"`
+	// CertificateChain is the base64 encoded PEM certificate chain of the GPU.
+	CertificateChain string `json:"certificate_chain"`
+}
+
+func evidence(admin computeboot.GPUAdmin, args []string) error {
+	fs := flag.NewFlagSet("evidence", flag.ContinueOnError)
+	out := fs.String("out", "", "path to write the evidence blob to")
+	nonceHex := fs.String("nonce", "", "hex encoded 32 byte nonce, leave blank for a random nonce")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *out == "" {
+		return errors.New("-out is required")
+	}
+
+	nonce := make([]byte, 32)
+	if *nonceHex != "" {
+		var err error
+		nonce, err = hex.DecodeString(*nonceHex)
+		if err != nil || len(nonce) != 32 {
+			return fmt.Errorf("invalid nonce %q", *nonceHex)
+		}
+	} else if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	devices, err := admin.CollectEvidence(nonce)
+	if err != nil {
+		return fmt.Errorf("failed to collect evidence: %w", err)
+	}
+
+	blob := evidenceBlob{
+		Nonce: hex.EncodeToString(nonce),
+		GPUs:  make([]gpuEvidence, 0, len(devices)),
+	}
+	for _, device := range devices {
+		chain, err := device.Certificate().EncodeBase64()
+		if err != nil {
+			return fmt.Errorf("failed to encode certificate chain: %w", err)
+		}
+		blob.GPUs = append(blob.GPUs, gpuEvidence{
+			Arch:              device.Arch(),
+			AttestationReport: device.AttestationReport(),
+			CertificateChain:  chain,
+		})
+	}
+
+	// #nosec G304 -- evidence file is provided by the operator.
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create evidence file: %w", err)
+	}
+	if err := writeJSON(f, blob); err != nil {
+		return errors.Join(err, f.Close())
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close evidence file: %w", err)
+	}
+
+	slog.Info("Collected GPU evidence", "gpus", len(blob.GPUs), "out", *out)
+	return nil
+}
+
+func writeJSON(f *os.File, v any) error {
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write json: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// mock_llm serves an inference backend with Ollama and OpenAI compatible endpoints that generates
+// responses without a model. It's intended for integration and load tests of the router_com and
+// compute_worker path, point the worker's llm_base_url at it. Not intended for production use.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/mockllm"
+)
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+var (
+	addrPtr          = flag.String("addr", "127.0.0.1:11434", "address to listen on")
+	latencyPtr       = flag.String("latency", "0s", `latency before the first token, e.g. "100ms", "uniform:50ms-200ms" or "normal:100ms,20ms"`)
+	tokenRatePtr     = flag.Float64("token_rate", 0, "output tokens per second, 0 to stream without delay")
+	minTokensPtr     = flag.Int("min_tokens", 1, "minimum number of output tokens")
+	maxTokensPtr     = flag.Int("max_tokens", 64, "maximum number of output tokens")
+	failureRatePtr   = flag.Float64("failure_rate", 0, "fraction of requests that fail with a 500")
+	abortRatePtr     = flag.Float64("abort_rate", 0, "fraction of responses that are cut off mid-stream")
+	malformedRatePtr = flag.Float64("malformed_rate", 0, "fraction of responses with malformed output")
+	seedPtr          = flag.Uint64("seed", 0, "seed for reproducible behavior, 0 for a random seed")
+	modelsList       stringList
+	malformedList    stringList
+)
+
+func init() {
+	flag.Var(&modelsList, "model", "model to serve, can be repeated. Leave empty to serve any model")
+	flag.Var(&malformedList, "malformed", "malformed output mode: invalid_json, content_type or missing_usage, can be repeated")
+}
+
+func main() {
+	flag.Parse()
+	if err := run(); err != nil {
+		slog.Error("mock_llm failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	latency, err := mockllm.ParseDistribution(*latencyPtr)
+	if err != nil {
+		return fmt.Errorf("invalid -latency: %w", err)
+	}
+
+	cfg := mockllm.Config{
+		Models:        modelsList,
+		Latency:       latency,
+		TokenRate:     *tokenRatePtr,
+		MinTokens:     *minTokensPtr,
+		MaxTokens:     *maxTokensPtr,
+		FailureRate:   *failureRatePtr,
+		AbortRate:     *abortRatePtr,
+		MalformedRate: *malformedRatePtr,
+		Seed:          *seedPtr,
+	}
+	for _, m := range malformedList {
+		mode, err := mockllm.ParseMalformedMode(m)
+		if err != nil {
+			return fmt.Errorf("invalid -malformed: %w", err)
+		}
+		cfg.Malformed = append(cfg.Malformed, mode)
+	}
+
+	srv, err := mockllm.New(cfg)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Addr:              *addrPtr,
+		Handler:           srv,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	slog.Info("Serving mock LLM", "addr", *addrPtr, "latency", latency, "token_rate", cfg.TokenRate,
+		"failure_rate", cfg.FailureRate, "abort_rate", cfg.AbortRate, "malformed_rate", cfg.MalformedRate)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -24,13 +24,16 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	gcpcompute "cloud.google.com/go/compute/apiv1"
 	"github.com/confidentsecurity/confidentcompute/cloud"
 	"github.com/confidentsecurity/confidentcompute/debug"
+	"github.com/confidentsecurity/confidentcompute/faultinject"
 	"github.com/confidentsecurity/confidentcompute/profiling"
 	"github.com/confidentsecurity/confidentcompute/routercom"
 	"github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/confidentsecurity/confidentcompute/sealedconfig"
 	"github.com/openpcc/openpcc/app"
 	"github.com/openpcc/openpcc/app/config"
 	"github.com/openpcc/openpcc/app/httpapp"
@@ -50,10 +53,16 @@ type Config struct {
 	RouterAgent *agent.Config `yaml:"router_agent"`
 	// RouterRIGMDiscovery is config for discovering routers directly from the MIG. (Deprecated, we use the LB by default)
 	RouterRIGMDiscovery *cloud.GCPRIGMAddrFinderConfig `yaml:"router_rigm_discovery"`
+	// RouterProbe probes the routers discovered in the MIG, so the agent prefers the lowest latency healthy
+	// router and fails over when it becomes unhealthy. Leave blank to use the routers in discovery order.
+	RouterProbe *cloud.AddrProbeConfig `yaml:"router_probe"`
 	// Models is the list of LLMs installed on the system
 	Models []string `yaml:"models"`
 }
 
+// deregisterTimeout bounds the deregister request sent to the router before shutting down.
+const deregisterTimeout = 10 * time.Second
+
 const serviceName = "router_com"
 
 func main() {
@@ -65,6 +74,7 @@ func run() int {
 	profiling.RouterCom.InitProfilerIfEnabled()
 
 	debug.SetupLog(serviceName)
+	debug.HandleLevelSignal(context.Background())
 
 	shutdown, err := otelutil.Init(context.Background(), serviceName)
 	if err != nil {
@@ -91,7 +101,14 @@ func run() int {
 		Models:              []string{},
 	}
 
-	err = config.Load(cfg, configFile, nil)
+	// sealed configs are unsealed with the TPM, plaintext configs are used as-is.
+	configFile, cleanupConfig, err := sealedconfig.Resolve(configFile, sealedconfig.DefaultTPMDevice)
+	if err != nil {
+		slog.Error("Failed to unseal config", "error", err)
+		return 1
+	}
+
+	err = errors.Join(config.Load(cfg, configFile, nil), cleanupConfig())
 	if err != nil {
 		slog.Error("Failed to load config", "error", err)
 		return 1
@@ -100,9 +117,11 @@ func run() int {
 	if len(cfg.Models) == 0 {
 		slog.Error("Invalid config: no models provided")
 	}
-	for _, model := range cfg.Models {
-		cfg.RouterAgent.Tags = append(cfg.RouterAgent.Tags, "model="+model)
-		cfg.RouterCom.Worker.Models = append(cfg.RouterCom.Worker.Models, model)
+	cfg.RouterCom.Worker.Models = append(cfg.RouterCom.Worker.Models, cfg.Models...)
+
+	if err := faultinject.Enable(cfg.RouterCom.FaultInjection); err != nil {
+		slog.Error("Invalid fault injection config", "error", err)
+		return 1
 	}
 
 	// wait until we receive the evidence from compute boot.
@@ -133,6 +152,31 @@ func run() int {
 		err = errors.Join(err, rtrcom.Close())
 	}()
 
+	// only advertise warm models, so the router sends requests for cold models elsewhere.
+	warmModels := rtrcom.WarmModels(cfg.Models)
+	for _, model := range warmModels {
+		cfg.RouterAgent.Tags = append(cfg.RouterAgent.Tags, "model="+model)
+	}
+
+	// the model tags are kept for routers that don't understand the capability advertisement.
+	capabilitiesTag, err := rtrcom.AdvertiseCapabilities(warmModels).Tag()
+	if err != nil {
+		slog.Error("failed to create capabilities tag", "error", err)
+		return 1
+	}
+	cfg.RouterAgent.Tags = append(cfg.RouterAgent.Tags, capabilitiesTag)
+
+	if cfg.RouterCom.Admin != nil && cfg.RouterCom.Admin.Enabled() {
+		admin := routercom.NewAdminServer(cfg.RouterCom.Admin, rtrcom)
+		if err := admin.Start(); err != nil {
+			slog.Error("failed to start admin API", "error", err)
+			return 1
+		}
+		defer func() {
+			err = errors.Join(err, admin.Close())
+		}()
+	}
+
 	// setup the router agent
 	id, err := uuidv7.New()
 	if err != nil {
@@ -154,7 +198,21 @@ func run() int {
 		}
 		defer rigmclient.Close()
 
-		rtragent.RouterFinder(cloud.NewGCPAddrFinder(cfg.RouterRIGMDiscovery, rigmclient))
+		var finder cloud.AddrFinder = cloud.NewGCPAddrFinder(cfg.RouterRIGMDiscovery, rigmclient)
+		if cfg.RouterProbe != nil {
+			prober, err := cloud.NewProbingAddrFinder(cfg.RouterProbe, finder)
+			if err != nil {
+				slog.Error("invalid router probe config", "error", err)
+				return 1
+			}
+
+			probeCtx, cancelProbes := context.WithCancel(context.Background())
+			defer cancelProbes()
+			go prober.Run(probeCtx)
+			finder = prober
+		}
+
+		rtragent.RouterFinder(finder)
 	}
 
 	a := app.NewMulti(
@@ -163,7 +221,33 @@ func run() int {
 	)
 
 	// run the app until it exits or signals received
-	ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	signalCtx, _ := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	// tell the router why the node goes away before the app shuts down, the agent sends the
+	// deregistration along with its deregister request. routercom also shuts the app down by itself,
+	// e.g. before its evidence expires.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-signalCtx.Done():
+		case <-rtrcom.ShutdownRequested():
+		}
+		defer cancel()
+
+		dereg := rtrcom.Deregistration()
+		tag, err := dereg.Tag()
+		if err != nil {
+			slog.Error("failed to create deregistration tag", "error", err)
+			return
+		}
+		slog.Info("Deregistering from the router", "reason", dereg.Reason, "expected_downtime_seconds", dereg.ExpectedDowntimeSeconds)
+
+		deregCtx, cancelDereg := context.WithTimeout(context.Background(), deregisterTimeout)
+		defer cancelDereg()
+		if err := rtragent.Deregister(deregCtx, tag); err != nil {
+			slog.Error("failed to deregister from the router", "error", err)
+		}
+	}()
 
 	code := app.Run(ctx, a, func() (context.Context, context.CancelFunc) {
 		// signals received during graceful shutdown cause immediate exit
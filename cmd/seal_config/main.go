@@ -0,0 +1,82 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// seal_config encrypts a config file with a key that is sealed to the local TPM. The sealed
+// config can then be loaded by compute_boot and router_com on the same machine.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/confidentsecurity/confidentcompute/sealedconfig"
+	"github.com/confidentsecurity/confidentcompute/tpmerr"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpmutil"
+)
+
+var (
+	inPtr        = flag.String("in", "", "path to the plaintext config")
+	outPtr       = flag.String("out", "", "path to write the sealed config to")
+	tpmDevicePtr = flag.String("tpm_device", sealedconfig.DefaultTPMDevice, "TPM device to seal the config with")
+)
+
+func main() {
+	flag.Parse()
+	if err := run(*inPtr, *outPtr, *tpmDevicePtr); err != nil {
+		slog.Error("failed to seal config", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(in, out, tpmDevice string) error {
+	if in == "" || out == "" {
+		return errors.New("both -in and -out are required")
+	}
+
+	// #nosec G304 -- config file is provided by the operator.
+	plaintext, err := os.ReadFile(in)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if sealedconfig.IsSealed(plaintext) {
+		return fmt.Errorf("config %s is already sealed", in)
+	}
+
+	rwc, err := tpmutil.OpenTPM(tpmDevice)
+	if err != nil {
+		return fmt.Errorf("failed to open tpm: %w", err)
+	}
+	thetpm := tpmerr.NewRetryingTPM(transport.FromReadWriteCloser(rwc), tpmerr.DefaultPolicy)
+	defer thetpm.Close()
+
+	sealed, err := sealedconfig.Seal(thetpm, plaintext)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(out, sealed, 0o600); err != nil {
+		return fmt.Errorf("failed to write sealed config: %w", err)
+	}
+
+	slog.Info("Sealed config", "in", in, "out", out)
+	return nil
+}
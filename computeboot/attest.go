@@ -18,8 +18,10 @@
 package computeboot
 
 import (
+	"errors"
 	"fmt"
 
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
 	ev "github.com/openpcc/openpcc/attestation/evidence"
 )
 
@@ -29,6 +31,40 @@ type AttestationConfig struct {
 	FakeSecret string `yaml:"fake_secret"`
 	// AttestGPU indicates whether to attest the GPU
 	AttestGPU bool `yaml:"attest_gpu"`
+	// CollateralCache caches collateral fetched during attestation on disk.
+	CollateralCache *CollateralCacheConfig `yaml:"collateral_cache"`
+	// Binaries are the binaries handling plaintext requests whose digests are included in the evidence.
+	Binaries *BinaryMeasurementConfig `yaml:"binaries"`
+	// HostEnvironment includes the kernel lockdown, IOMMU and memory encryption state in the evidence.
+	// Leave blank to skip the host environment.
+	HostEnvironment *HostEnvironmentConfig `yaml:"host_environment"`
+	// Maintenance boots the node in maintenance mode, disclosed in the evidence. Leave blank for normal operation.
+	Maintenance *MaintenanceConfig `yaml:"maintenance"`
+	// OutputFilter includes the digest of the compute_worker output filter in the evidence. Leave blank
+	// when the output is not filtered.
+	OutputFilter *OutputFilterConfig `yaml:"output_filter"`
+	// SecureBoot includes the UEFI Secure Boot state and the enrolled keys in the evidence. Leave blank
+	// to skip the Secure Boot state.
+	SecureBoot *SecureBootConfig `yaml:"secure_boot"`
+	// EngineConfig includes the arguments and key environment variables of the inference engine unit
+	// in the evidence. Leave blank to skip the engine config.
+	EngineConfig *EngineConfigConfig `yaml:"engine_config"`
+	// QuoteChain keeps a local chain of the TPM quotes of successive attestations and includes it in the
+	// evidence, as continuity evidence that the same TPM attested the node over time. Leave blank to
+	// not keep a chain.
+	QuoteChain *QuoteChainConfig `yaml:"quote_chain"`
+	// TimeSync includes the clock synchronization state in the evidence. Leave blank to skip the
+	// clock state.
+	TimeSync *TimeSyncConfig `yaml:"time_sync"`
+	// ExperimentalRoutes enables experimental compute_worker routes and discloses them in the evidence.
+	// Leave blank for a stable node.
+	ExperimentalRoutes *ExperimentalRoutesConfig `yaml:"experimental_routes"`
+	// Mirror discloses the shadow backend compute_worker mirrors validated requests to in the evidence.
+	// Leave blank when requests are not mirrored.
+	Mirror *MirrorConfig `yaml:"mirror"`
+	// EvidencePCR is the PCR the labelled evidence pieces are extended into, see BindLabelledPieces.
+	// Leave 0 for DefaultEvidencePCR.
+	EvidencePCR uint32 `yaml:"evidence_pcr"`
 }
 
 func PrepareAttestationPackage(tpmDevice TPMDevice, gpuManager GPUManager, tpmCfg *TPMConfig, attestationCfg *AttestationConfig, tlogCfg *TransparencyConfig) (ev.SignedEvidenceList, error) {
@@ -38,5 +74,134 @@ func PrepareAttestationPackage(tpmDevice TPMDevice, gpuManager GPUManager, tpmCf
 		return nil, fmt.Errorf("failed to create evidence handler: %w", err)
 	}
 
+	if attestationCfg != nil && attestationCfg.Binaries != nil && len(attestationCfg.Binaries.Paths) > 0 {
+		digests, err := DigestBinaries(attestationCfg.Binaries.Paths)
+		if err != nil {
+			return nil, err
+		}
+		piece, err := rcevidence.BinaryDigestsPiece(digests)
+		if err != nil {
+			return nil, err
+		}
+		evidence = append(evidence, piece)
+	}
+
+	if attestationCfg != nil && attestationCfg.HostEnvironment != nil {
+		env, err := ReadHostEnvironment()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read host environment: %w", err)
+		}
+		piece, err := rcevidence.HostEnvironmentPiece(env)
+		if err != nil {
+			return nil, err
+		}
+		evidence = append(evidence, piece)
+	}
+
+	if attestationCfg != nil && attestationCfg.Maintenance.Active() {
+		piece, err := rcevidence.MaintenancePiece(attestationCfg.Maintenance.Claim())
+		if err != nil {
+			return nil, err
+		}
+		evidence = append(evidence, piece)
+	}
+
+	if attestationCfg != nil && attestationCfg.OutputFilter != nil {
+		f, err := ReadOutputFilter(attestationCfg.OutputFilter.Path)
+		if err != nil {
+			return nil, err
+		}
+		piece, err := rcevidence.OutputFilterPiece(f)
+		if err != nil {
+			return nil, err
+		}
+		evidence = append(evidence, piece)
+	}
+
+	if attestationCfg != nil && attestationCfg.SecureBoot != nil {
+		state, err := ReadSecureBoot()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secure boot state: %w", err)
+		}
+		if attestationCfg.SecureBoot.Require && !state.Enforcing() {
+			return nil, errors.New("secure boot is not enforcing")
+		}
+		piece, err := rcevidence.SecureBootPiece(state)
+		if err != nil {
+			return nil, err
+		}
+		evidence = append(evidence, piece)
+	}
+
+	if attestationCfg != nil && attestationCfg.QuoteChain != nil {
+		chain, err := ExtendQuoteChain(tpmDevice, tpmCfg.AttestationKeyHandle, attestationCfg.QuoteChain)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extend quote chain: %w", err)
+		}
+		piece, err := rcevidence.QuoteChainPiece(chain)
+		if err != nil {
+			return nil, err
+		}
+		evidence = append(evidence, piece)
+	}
+
+	if attestationCfg != nil && attestationCfg.TimeSync != nil {
+		state, err := ReadTimeSync()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read time sync state: %w", err)
+		}
+		if err := attestationCfg.TimeSync.check(state); err != nil {
+			return nil, err
+		}
+		piece, err := rcevidence.TimeSyncPiece(state)
+		if err != nil {
+			return nil, err
+		}
+		evidence = append(evidence, piece)
+	}
+
+	if attestationCfg != nil && attestationCfg.ExperimentalRoutes.Active() {
+		claim, err := attestationCfg.ExperimentalRoutes.Claim()
+		if err != nil {
+			return nil, err
+		}
+		piece, err := rcevidence.ExperimentalRoutesPiece(claim)
+		if err != nil {
+			return nil, err
+		}
+		evidence = append(evidence, piece)
+	}
+
+	if attestationCfg != nil && attestationCfg.Mirror.Active() {
+		claim, err := attestationCfg.Mirror.Claim()
+		if err != nil {
+			return nil, err
+		}
+		piece, err := rcevidence.MirrorPiece(claim)
+		if err != nil {
+			return nil, err
+		}
+		evidence = append(evidence, piece)
+	}
+
+	if tpmCfg.RefundKeyHandle != 0 {
+		piece, err := refundKeyPiece(tpmDevice, tpmCfg.RefundKeyHandle)
+		if err != nil {
+			return nil, err
+		}
+		evidence = append(evidence, piece)
+	}
+
+	// the labelled pieces are only evidence once they are bound to the tpm.
+	var evidencePCR uint32
+	if attestationCfg != nil {
+		evidencePCR = attestationCfg.EvidencePCR
+	}
+	binding, err := BindLabelledPieces(tpmDevice, tpmCfg.AttestationKeyHandle, evidencePCR, evidence)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind labelled evidence pieces: %w", err)
+	}
+	evidence = append(evidence, binding)
+
 	return evidence, nil
 }
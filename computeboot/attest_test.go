@@ -25,6 +25,7 @@ import (
 	"testing"
 
 	"github.com/confidentsecurity/confidentcompute/computeboot"
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
 	"github.com/google/go-tpm/tpm2/transport"
 	ev "github.com/openpcc/openpcc/attestation/evidence"
 	"github.com/openpcc/openpcc/attestation/verify"
@@ -56,6 +57,7 @@ type MockGPUManager struct {
 	VerifyGPUStateFunc             func(ctx context.Context) error
 	EnableConfidentialComputeFunc  func() error
 	GetAttestationEvidenceListFunc func(ctx context.Context) (ev.SignedEvidenceList, error)
+	TopologyFunc                   func(ctx context.Context) (*computeboot.GPUTopology, error)
 }
 
 func (m *MockGPUManager) VerifyGPUState(ctx context.Context) error {
@@ -79,6 +81,13 @@ func (m *MockGPUManager) GetAttestationEvidenceList(ctx context.Context) (ev.Sig
 	return ev.SignedEvidenceList{}, nil
 }
 
+func (m *MockGPUManager) Topology(ctx context.Context) (*computeboot.GPUTopology, error) {
+	if m.TopologyFunc != nil {
+		return m.TopologyFunc(ctx)
+	}
+	return &computeboot.GPUTopology{}, nil
+}
+
 func TestPrepareAttestationPackage_FailedToOpenDevice(t *testing.T) {
 	tpmConfig := &computeboot.TPMConfig{
 		ChildKeyHandle:          0x81000000,
@@ -134,12 +143,57 @@ func TestPrepareAttestationPackage_Success(t *testing.T) {
 	}
 	transparencyCfg := &computeboot.TransparencyConfig{}
 
-	evidence, err := computeboot.PrepareAttestationPackage(operator.GetDevice(), &MockGPUManager{}, tpmCfg, attestationCfg, transparencyCfg)
+	gpuManager := &MockGPUManager{
+		GetAttestationEvidenceListFunc: func(context.Context) (ev.SignedEvidenceList, error) {
+			return ev.SignedEvidenceList{rcevidence.CPUOnlyPiece()}, nil
+		},
+	}
+
+	evidence, err := computeboot.PrepareAttestationPackage(operator.GetDevice(), gpuManager, tpmCfg, attestationCfg, transparencyCfg)
 	require.NoError(t, err)
 	require.NotNil(t, evidence)
-	require.Len(t, evidence, 5)
+	// the fake evidence has the structure of production evidence: tpm pieces, the fake piece in place
+	// of the tee evidence, gpu evidence, the image sigstore bundle and the binding of the labelled pieces.
+	require.Len(t, evidence, 8)
+	require.True(t, rcevidence.IsCPUOnly(evidence))
+	require.Equal(t, ev.ImageSigstoreBundle, evidence[6].Type)
+	pcrValues, err := rcevidence.QuotePCRValues(evidence[2])
+	require.NoError(t, err)
+	require.NoError(t, rcevidence.VerifyEvidenceBinding(evidence, evidence[3], evidence[2], pcrValues))
 
 	v := verify.NewFakeVerifier([]byte(attestationCfg.FakeSecret))
 	_, err = v.VerifyComputeNode(t.Context(), evidence)
 	require.NoError(t, err)
 }
+
+func TestPrepareAttestationPackage_FailedGPUEvidence(t *testing.T) {
+	tpmCfg := &computeboot.TPMConfig{
+		PrimaryKeyHandle:        0x81000001,
+		ChildKeyHandle:          0x81000002,
+		REKCreationTicketHandle: 0x01c0000A,
+		REKCreationHashHandle:   0x01c0000B,
+		AttestationKeyHandle:    0x81000003,
+		TPMType:                 computeboot.InMemorySimulator,
+	}
+	operator, err := computeboot.NewTPMOperatorWithConfig(tpmCfg)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		require.NoError(t, operator.Close())
+	})
+
+	require.NoError(t, operator.SetupAttestationKey())
+	require.NoError(t, operator.SetupEncryptionKeys())
+
+	gpuManager := &MockGPUManager{
+		GetAttestationEvidenceListFunc: func(context.Context) (ev.SignedEvidenceList, error) {
+			return nil, errors.New("gpu attestation failed")
+		},
+	}
+
+	attestationCfg := &computeboot.AttestationConfig{
+		FakeSecret: "fake",
+	}
+	_, err = computeboot.PrepareAttestationPackage(operator.GetDevice(), gpuManager, tpmCfg, attestationCfg, &computeboot.TransparencyConfig{})
+	require.ErrorContains(t, err, "gpu attestation failed")
+}
@@ -0,0 +1,256 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/go-tpm/tpmutil"
+	cstpm "github.com/openpcc/openpcc/tpm"
+)
+
+const (
+	// azureHCLReportNVIndex holds the HCL report of Azure confidential VMs, the SEV-SNP report
+	// followed by the runtime claims it binds.
+	azureHCLReportNVIndex uint32 = 0x01400001
+	// hclReportHeaderLen is the length of the HCL header in front of the SEV-SNP report.
+	hclReportHeaderLen = 32
+	// snpReportLen is the length of a SEV-SNP attestation report.
+	snpReportLen = 1184
+	// igvmRequestDataHeaderLen is the length of the header in front of the runtime claims, the
+	// length of the claims is its last field.
+	igvmRequestDataHeaderLen = 20
+
+	// azureVCEKURL serves the VCEK certificate chain of the host from the instance metadata service.
+	azureVCEKURL = "http://169.254.169.254/metadata/THIM/amd/certification"
+	// maaAPIVersion is the MAA API version of the SevSnpVm attest request.
+	maaAPIVersion = "2022-08-01"
+
+	defaultMAATimeout = 30 * time.Second
+	// maxMAAResponseSize bounds the responses of MAA and the instance metadata service.
+	maxMAAResponseSize = 1 << 20
+)
+
+// AzureGPUConfig is config for Azure confidential GPU VMs, e.g. NCCads H100 v5. Verifiers on Azure
+// expect a Microsoft Azure Attestation (MAA) token of the confidential VM next to the NRAS results
+// of the GPUs, see rcevidence.AzureGPUAttestation.
+type AzureGPUConfig struct {
+	// MAAEndpoint is the MAA provider the VM attests to, e.g. https://sharedeus2.eus2.attest.azure.net.
+	MAAEndpoint string `yaml:"maa_endpoint"`
+	// Timeout bounds the requests to MAA and the instance metadata service. 0 means 30 seconds.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c *AzureGPUConfig) validate() error {
+	u, err := url.Parse(c.MAAEndpoint)
+	if err != nil {
+		return fmt.Errorf("invalid maa endpoint: %w", err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return errors.New("maa endpoint must be an https url")
+	}
+	if c.Timeout < 0 {
+		return errors.New("timeout can't be negative")
+	}
+	return nil
+}
+
+// MAAClient gets MAA tokens for the confidential VM.
+type MAAClient interface {
+	// AttestVM returns an MAA token of the VM with nonce as its nonce claim.
+	AttestVM(ctx context.Context, nonce string) (string, error)
+}
+
+// HTTPMAAClient gets MAA tokens by attesting the SEV-SNP report from the HCL report in the vTPM.
+type HTTPMAAClient struct {
+	cfg        *AzureGPUConfig
+	httpClient *http.Client
+	// readHCLReport reads the HCL report, by default from the vTPM.
+	readHCLReport func() ([]byte, error)
+	// vcekURL serves the VCEK certificate chain, by default the instance metadata service.
+	vcekURL string
+}
+
+func NewHTTPMAAClient(cfg *AzureGPUConfig, tpmDevice TPMDevice) *HTTPMAAClient {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultMAATimeout
+	}
+	return &HTTPMAAClient{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: timeout},
+		readHCLReport: func() ([]byte, error) {
+			thetpm, err := tpmDevice.OpenDevice()
+			if err != nil {
+				return nil, fmt.Errorf("could not connect to TPM: %w", err)
+			}
+			defer tpmDevice.Close()
+			return cstpm.NVReadEXNoAuthorization(thetpm, tpmutil.Handle(azureHCLReportNVIndex))
+		},
+		vcekURL: azureVCEKURL,
+	}
+}
+
+// maaSevSnpVMRequest is the body of the MAA SevSnpVm attest request.
+type maaSevSnpVMRequest struct {
+	// Report is the base64url encoded JSON of maaSnpReport.
+	Report      string         `json:"report"`
+	RuntimeData maaRuntimeData `json:"runtimeData"`
+	Nonce       string         `json:"nonce"`
+}
+
+type maaSnpReport struct {
+	SnpReport     string `json:"SnpReport"`
+	VcekCertChain string `json:"VcekCertChain"`
+}
+
+type maaRuntimeData struct {
+	Data     string `json:"data"`
+	DataType string `json:"dataType"`
+}
+
+// vcekResponse is the VCEK certificate chain as served by the instance metadata service.
+type vcekResponse struct {
+	VcekCert         string `json:"vcekCert"`
+	CertificateChain string `json:"certificateChain"`
+}
+
+func (c *HTTPMAAClient) AttestVM(ctx context.Context, nonce string) (string, error) {
+	hclReport, err := c.readHCLReport()
+	if err != nil {
+		return "", fmt.Errorf("failed to read hcl report: %w", err)
+	}
+
+	snpReport, runtimeData, err := parseHCLReport(hclReport)
+	if err != nil {
+		return "", err
+	}
+
+	vcek, err := c.vcekChain(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	report, err := json.Marshal(maaSnpReport{
+		SnpReport:     base64.RawURLEncoding.EncodeToString(snpReport),
+		VcekCertChain: base64.RawURLEncoding.EncodeToString(vcek),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal snp report: %w", err)
+	}
+
+	body, err := json.Marshal(maaSevSnpVMRequest{
+		Report: base64.RawURLEncoding.EncodeToString(report),
+		RuntimeData: maaRuntimeData{
+			Data:     base64.RawURLEncoding.EncodeToString(runtimeData),
+			DataType: "JSON",
+		},
+		Nonce: nonce,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal maa request: %w", err)
+	}
+
+	u, err := url.JoinPath(c.cfg.MAAEndpoint, "attest", "SevSnpVm")
+	if err != nil {
+		return "", fmt.Errorf("invalid maa endpoint: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u+"?api-version="+maaAPIVersion, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create maa request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := c.doJSON(req, &resp); err != nil {
+		return "", fmt.Errorf("maa attestation failed: %w", err)
+	}
+	if resp.Token == "" {
+		return "", errors.New("maa response has no token")
+	}
+
+	slog.InfoContext(ctx, "Attested confidential VM to MAA", "endpoint", c.cfg.MAAEndpoint)
+	return resp.Token, nil
+}
+
+// vcekChain returns the PEM encoded VCEK certificate followed by its chain.
+func (c *HTTPMAAClient) vcekChain(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.vcekURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vcek request: %w", err)
+	}
+	req.Header.Set("Metadata", "true")
+
+	var resp vcekResponse
+	if err := c.doJSON(req, &resp); err != nil {
+		return nil, fmt.Errorf("failed to get vcek certificate chain: %w", err)
+	}
+	if resp.VcekCert == "" {
+		return nil, errors.New("missing vcek certificate")
+	}
+	return []byte(resp.VcekCert + resp.CertificateChain), nil
+}
+
+func (c *HTTPMAAClient) doJSON(req *http.Request, v any) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMAAResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
+
+// parseHCLReport splits an HCL report into the SEV-SNP report and the runtime claims.
+func parseHCLReport(report []byte) ([]byte, []byte, error) {
+	claimsOffset := hclReportHeaderLen + snpReportLen + igvmRequestDataHeaderLen
+	if len(report) < claimsOffset {
+		return nil, nil, fmt.Errorf("hcl report of %d bytes is too short", len(report))
+	}
+
+	snpReport := report[hclReportHeaderLen : hclReportHeaderLen+snpReportLen]
+	claimsLen := binary.LittleEndian.Uint32(report[claimsOffset-4 : claimsOffset])
+	if uint64(claimsLen) > uint64(len(report)-claimsOffset) {
+		return nil, nil, fmt.Errorf("hcl report runtime claims of %d bytes exceed the report", claimsLen)
+	}
+
+	return snpReport, report[claimsOffset : claimsOffset+int(claimsLen)], nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newHCLReport builds an HCL report with the given SEV-SNP report byte and runtime claims.
+func newHCLReport(snpByte byte, claims []byte) []byte {
+	report := make([]byte, hclReportHeaderLen)
+	report = append(report, bytes.Repeat([]byte{snpByte}, snpReportLen)...)
+	header := make([]byte, igvmRequestDataHeaderLen)
+	binary.LittleEndian.PutUint32(header[igvmRequestDataHeaderLen-4:], uint32(len(claims)))
+	report = append(report, header...)
+	return append(report, claims...)
+}
+
+func TestParseHCLReport(t *testing.T) {
+	t.Run("ok, report and claims", func(t *testing.T) {
+		claims := []byte(`{"keys":[]}`)
+		snp, got, err := parseHCLReport(append(newHCLReport(0xab, claims), 0x00, 0x00))
+		require.NoError(t, err)
+		require.Equal(t, bytes.Repeat([]byte{0xab}, snpReportLen), snp)
+		require.Equal(t, claims, got)
+	})
+
+	t.Run("fail, report too short", func(t *testing.T) {
+		_, _, err := parseHCLReport(make([]byte, hclReportHeaderLen+snpReportLen))
+		require.ErrorContains(t, err, "too short")
+	})
+
+	t.Run("fail, claims exceed report", func(t *testing.T) {
+		report := newHCLReport(0xab, []byte(`{}`))
+		_, _, err := parseHCLReport(report[:len(report)-1])
+		require.ErrorContains(t, err, "exceed the report")
+	})
+}
+
+func TestHTTPMAAClient(t *testing.T) {
+	claims := []byte(`{"keys":[]}`)
+
+	newClient := func(t *testing.T, maa http.HandlerFunc) *HTTPMAAClient {
+		vcek := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Metadata") != "true" {
+				http.Error(w, "missing metadata header", http.StatusBadRequest)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(vcekResponse{VcekCert: "vcek-pem\n", CertificateChain: "ask-pem\nark-pem\n"})
+		}))
+		t.Cleanup(vcek.Close)
+		srv := httptest.NewServer(maa)
+		t.Cleanup(srv.Close)
+
+		client := NewHTTPMAAClient(&AzureGPUConfig{MAAEndpoint: srv.URL}, nil)
+		client.readHCLReport = func() ([]byte, error) {
+			return newHCLReport(0xab, claims), nil
+		}
+		client.vcekURL = vcek.URL
+		return client
+	}
+
+	decode := func(t *testing.T, s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		require.NoError(t, err)
+		return b
+	}
+
+	t.Run("ok, attest vm", func(t *testing.T) {
+		client := newClient(t, func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "/attest/SevSnpVm", r.URL.Path)
+			require.Equal(t, maaAPIVersion, r.URL.Query().Get("api-version"))
+
+			var req maaSevSnpVMRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			require.Equal(t, "nras-nonce", req.Nonce)
+			require.Equal(t, "JSON", req.RuntimeData.DataType)
+			require.Equal(t, claims, decode(t, req.RuntimeData.Data))
+
+			var report maaSnpReport
+			require.NoError(t, json.Unmarshal(decode(t, req.Report), &report))
+			require.Equal(t, bytes.Repeat([]byte{0xab}, snpReportLen), decode(t, report.SnpReport))
+			require.Equal(t, "vcek-pem\nask-pem\nark-pem\n", string(decode(t, report.VcekCertChain)))
+
+			_, _ = w.Write([]byte(`{"token":"maa-token"}`))
+		})
+
+		token, err := client.AttestVM(t.Context(), "nras-nonce")
+		require.NoError(t, err)
+		require.Equal(t, "maa-token", token)
+	})
+
+	t.Run("fail, maa rejects the report", func(t *testing.T) {
+		client := newClient(t, func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "invalid report", http.StatusBadRequest)
+		})
+
+		_, err := client.AttestVM(t.Context(), "nras-nonce")
+		require.ErrorContains(t, err, "unexpected status code 400")
+	})
+
+	t.Run("fail, hcl report can't be read", func(t *testing.T) {
+		client := newClient(t, func(w http.ResponseWriter, _ *http.Request) {
+			t.Error("unexpected maa request")
+		})
+		client.readHCLReport = func() ([]byte, error) {
+			return nil, errors.New("nv index not defined")
+		}
+
+		_, err := client.AttestVM(t.Context(), "nras-nonce")
+		require.ErrorContains(t, err, "nv index not defined")
+	})
+}
+
+func TestAzureGPUConfigValidate(t *testing.T) {
+	require.NoError(t, (&AzureGPUConfig{MAAEndpoint: "https://sharedeus2.eus2.attest.azure.net"}).validate())
+	require.Error(t, (&AzureGPUConfig{}).validate())
+	require.Error(t, (&AzureGPUConfig{MAAEndpoint: "http://sharedeus2.eus2.attest.azure.net"}).validate())
+	require.Error(t, (&AzureGPUConfig{MAAEndpoint: "https://sharedeus2.eus2.attest.azure.net", Timeout: -1}).validate())
+}
@@ -0,0 +1,255 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/routercom/modelstate"
+	"github.com/openpcc/openpcc/otel/otelutil"
+)
+
+const (
+	defaultBenchmarkRuns      = 3
+	defaultBenchmarkMaxTokens = 128
+	// benchmarkPrompt is the same on every node, so the results of nodes can be compared.
+	benchmarkPrompt = "Write a short story about a lighthouse keeper who finds a message in a bottle."
+)
+
+// DefaultBenchmarkTiers are used when no tiers are configured.
+var DefaultBenchmarkTiers = []BenchmarkTier{
+	{Name: "high", MinTokensPerSecond: 80, MaxTTFT: 500 * time.Millisecond},
+	{Name: "standard", MinTokensPerSecond: 30, MaxTTFT: 2 * time.Second},
+	{Name: "low", MinTokensPerSecond: 5},
+}
+
+// BenchmarkConfig is the config of the startup benchmark.
+type BenchmarkConfig struct {
+	// Runs is the number of benchmark requests per model, the median results are reported. Defaults to 3.
+	Runs int `yaml:"runs"`
+	// MaxTokens is the number of tokens generated per request. Defaults to 128.
+	MaxTokens int `yaml:"max_tokens"`
+	// Tiers map the results to a performance tier, the first tier the results reach is reported.
+	// Leave empty for DefaultBenchmarkTiers.
+	Tiers []BenchmarkTier `yaml:"tiers"`
+}
+
+// BenchmarkTier is a performance tier a model reaches when it is at least as fast as the tier.
+type BenchmarkTier struct {
+	Name               string  `yaml:"name"`
+	MinTokensPerSecond float64 `yaml:"min_tokens_per_second"`
+	// MaxTTFT is the slowest time to first token of the tier. Leave 0 to not limit the time to first token.
+	MaxTTFT time.Duration `yaml:"max_ttft"`
+}
+
+// benchmarkTier returns the name of the first tier the results reach, empty if they reach no tier.
+func benchmarkTier(tiers []BenchmarkTier, tokensPerSecond float64, ttft time.Duration) string {
+	for _, tier := range tiers {
+		if tokensPerSecond < tier.MinTokensPerSecond {
+			continue
+		}
+		if tier.MaxTTFT != 0 && ttft > tier.MaxTTFT {
+			continue
+		}
+		return tier.Name
+	}
+	return ""
+}
+
+// Benchmark runs the startup benchmark against the warm models in states and returns the states
+// with the results. Failed benchmarks are logged and leave the state of the model unchanged.
+func (eng *InferenceEngineInitializer) Benchmark(ctx context.Context, states []modelstate.State) []modelstate.State {
+	if eng.benchmark == nil {
+		return states
+	}
+
+	ctx, span := otelutil.Tracer.Start(ctx, "computeboot.Benchmark")
+	defer span.End()
+
+	runs := eng.benchmark.Runs
+	if runs <= 0 {
+		runs = defaultBenchmarkRuns
+	}
+	tiers := eng.benchmark.Tiers
+	if len(tiers) == 0 {
+		tiers = DefaultBenchmarkTiers
+	}
+
+	result := slices.Clone(states)
+	// models are benchmarked one at a time, so they don't compete for the GPU.
+	for i, state := range result {
+		if !state.Warm {
+			continue
+		}
+
+		benchmark, err := eng.benchmarkModel(ctx, state.Model, runs)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to benchmark model", "model", state.Model, "error", err)
+			continue
+		}
+		benchmark.Tier = benchmarkTier(tiers, benchmark.TokensPerSecond, benchmark.TTFT)
+		result[i].Benchmark = benchmark
+
+		slog.InfoContext(ctx, "Benchmarked model",
+			"model", state.Model,
+			"tokens_per_second", benchmark.TokensPerSecond,
+			"ttft", benchmark.TTFT,
+			"tier", benchmark.Tier,
+		)
+		if benchmark.Tier == "" {
+			slog.WarnContext(ctx, "Model reaches no performance tier, the GPU may be misconfigured", "model", state.Model)
+		}
+	}
+
+	return result
+}
+
+// benchmarkModel runs the benchmark requests for model and returns the median results.
+func (eng *InferenceEngineInitializer) benchmarkModel(ctx context.Context, model string, runs int) (*modelstate.Benchmark, error) {
+	var (
+		throughputs = make([]float64, 0, runs)
+		ttfts       = make([]time.Duration, 0, runs)
+	)
+	for range runs {
+		tokensPerSecond, ttft, err := eng.benchmarkRun(ctx, model)
+		if err != nil {
+			return nil, err
+		}
+		throughputs = append(throughputs, tokensPerSecond)
+		ttfts = append(ttfts, ttft)
+	}
+
+	return &modelstate.Benchmark{
+		TokensPerSecond: median(throughputs),
+		TTFT:            median(ttfts),
+	}, nil
+}
+
+// benchmarkRun sends a single streaming completion request and measures the time to the first
+// token and the throughput of the tokens after it.
+func (eng *InferenceEngineInitializer) benchmarkRun(ctx context.Context, model string) (float64, time.Duration, error) {
+	maxTokens := eng.benchmark.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultBenchmarkMaxTokens
+	}
+
+	rawBody, err := json.Marshal(map[string]any{
+		"model":          model,
+		"prompt":         benchmarkPrompt,
+		"max_tokens":     maxTokens,
+		"temperature":    0,
+		"stream":         true,
+		"stream_options": map[string]any{"include_usage": true},
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, eng.modelURL(model)+"/v1/completions", bytes.NewReader(rawBody))
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	resp, err := eng.httpClient.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, fmt.Errorf("benchmark request failed: status %d", resp.StatusCode)
+	}
+
+	var (
+		firstToken time.Time
+		lastToken  time.Time
+		chunks     int
+		usage      int
+	)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Text string `json:"text"`
+			} `json:"choices"`
+			Usage *struct {
+				CompletionTokens int `json:"completion_tokens"`
+			} `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return 0, 0, fmt.Errorf("failed to decode benchmark chunk: %w", err)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage.CompletionTokens
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Text == "" {
+			continue
+		}
+
+		lastToken = time.Now()
+		if firstToken.IsZero() {
+			firstToken = lastToken
+		}
+		chunks++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to read benchmark response: %w", err)
+	}
+
+	if chunks == 0 {
+		return 0, 0, errors.New("benchmark response contains no tokens")
+	}
+
+	// engines that don't report usage stream a token per chunk.
+	tokens := chunks
+	if usage > 0 {
+		tokens = usage
+	}
+
+	ttft := firstToken.Sub(start)
+	generation := lastToken.Sub(firstToken)
+	if tokens < 2 || generation <= 0 {
+		return 0, ttft, errors.New("benchmark response is too short to measure throughput")
+	}
+
+	// the first token is the end of the prefill, it is not part of the generation.
+	return float64(tokens-1) / generation.Seconds(), ttft, nil
+}
+
+func median[T float64 | time.Duration](values []T) T {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2]
+}
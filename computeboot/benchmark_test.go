@@ -0,0 +1,111 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/routercom/modelstate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBenchmarkTier(t *testing.T) {
+	tests := map[string]struct {
+		tokensPerSecond float64
+		ttft            time.Duration
+		want            string
+	}{
+		"ok, fast model":                    {tokensPerSecond: 120, ttft: 100 * time.Millisecond, want: "high"},
+		"ok, slow first token drops a tier": {tokensPerSecond: 120, ttft: time.Second, want: "standard"},
+		"ok, low throughput":                {tokensPerSecond: 10, ttft: 10 * time.Second, want: "low"},
+		"ok, no tier":                       {tokensPerSecond: 1, ttft: 100 * time.Millisecond, want: ""},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.want, benchmarkTier(DefaultBenchmarkTiers, tc.tokensPerSecond, tc.ttft))
+		})
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model     string `json:"model"`
+			MaxTokens int    `json:"max_tokens"`
+			Stream    bool   `json:"stream"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !req.Stream {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if req.Model == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for range req.MaxTokens {
+			fmt.Fprint(w, `data: {"choices":[{"text":"a"}]}`+"\n\n")
+			w.(http.Flusher).Flush()
+			time.Sleep(time.Millisecond)
+		}
+		fmt.Fprintf(w, "data: {\"choices\":[],\"usage\":{\"completion_tokens\":%d}}\n\n", req.MaxTokens)
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	states := []modelstate.State{
+		{Model: "a", Warm: true},
+		{Model: "broken", Warm: true},
+		{Model: "cold"},
+	}
+
+	t.Run("ok, warm models are benchmarked", func(t *testing.T) {
+		eng := NewInferenceEngineInitializerWithConfig(&InferenceEngineConfig{
+			URL: srv.URL,
+			Benchmark: &BenchmarkConfig{
+				Runs:      2,
+				MaxTokens: 8,
+				Tiers:     []BenchmarkTier{{Name: "any"}},
+			},
+		})
+
+		got := eng.Benchmark(t.Context(), states)
+		require.Len(t, got, 3)
+		require.NotNil(t, got[0].Benchmark)
+		require.Positive(t, got[0].Benchmark.TokensPerSecond)
+		require.Positive(t, got[0].Benchmark.TTFT)
+		require.Equal(t, "any", got[0].Benchmark.Tier)
+		// failed and cold models are not benchmarked.
+		require.Nil(t, got[1].Benchmark)
+		require.Nil(t, got[2].Benchmark)
+		// the states of the caller are not modified.
+		require.Nil(t, states[0].Benchmark)
+	})
+
+	t.Run("ok, disabled benchmark", func(t *testing.T) {
+		eng := NewInferenceEngineInitializerWithConfig(&InferenceEngineConfig{URL: srv.URL})
+		require.Equal(t, states, eng.Benchmark(t.Context(), states))
+	})
+}
@@ -0,0 +1,66 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/confidentsecurity/confidentcompute/routercom/evidence"
+)
+
+// BinaryMeasurementConfig is config for measuring the binaries that handle plaintext requests,
+// so verifiers can confirm the exact builds running on the node.
+type BinaryMeasurementConfig struct {
+	// Paths are the binaries to measure, e.g. router_com and the compute_worker configured in
+	// router_com's worker.binary_path. Leave empty to skip binary measurement.
+	Paths []string `yaml:"paths"`
+	// PCR is extended with the digest of every binary, in the order of Paths. Leave 0 for
+	// ApplicationPCR.
+	PCR uint32 `yaml:"pcr"`
+}
+
+// DigestBinaries computes the SHA-256 digests of the binaries at paths.
+func DigestBinaries(paths []string) ([]evidence.BinaryDigest, error) {
+	digests := make([]evidence.BinaryDigest, 0, len(paths))
+	for _, path := range paths {
+		digest, err := digestFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to digest binary: %w", err)
+		}
+		digests = append(digests, evidence.BinaryDigest{
+			Path:   path,
+			SHA256: hex.EncodeToString(digest),
+		})
+	}
+	return digests, nil
+}
+
+// BinaryMeasurements returns the measurements of the digests of the binaries for pcr, so the
+// digests are covered by the TPM quote.
+func BinaryMeasurements(pcr uint32, digests []evidence.BinaryDigest) ([]Measurement, error) {
+	measurements := make([]Measurement, 0, len(digests))
+	for _, binary := range digests {
+		digest, err := hex.DecodeString(binary.SHA256)
+		if err != nil {
+			return nil, fmt.Errorf("invalid digest of %s: %w", binary.Path, err)
+		}
+		measurements = append(measurements, newMeasurement(pcr, "binary "+binary.Path, digest))
+	}
+	return measurements, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/google/go-tpm/tpm2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDigestBinaries(t *testing.T) {
+	dir := t.TempDir()
+	worker := filepath.Join(dir, "compute_worker")
+	routerCom := filepath.Join(dir, "router_com")
+	require.NoError(t, os.WriteFile(worker, []byte("worker build"), 0o700))
+	require.NoError(t, os.WriteFile(routerCom, []byte("router_com build"), 0o700))
+
+	t.Run("ok, digests in order of paths", func(t *testing.T) {
+		digests, err := DigestBinaries([]string{worker, routerCom})
+		require.NoError(t, err)
+
+		workerDigest := sha256.Sum256([]byte("worker build"))
+		routerComDigest := sha256.Sum256([]byte("router_com build"))
+		require.Equal(t, []evidence.BinaryDigest{
+			{Path: worker, SHA256: hex.EncodeToString(workerDigest[:])},
+			{Path: routerCom, SHA256: hex.EncodeToString(routerComDigest[:])},
+		}, digests)
+	})
+
+	t.Run("fail, missing binary", func(t *testing.T) {
+		_, err := DigestBinaries([]string{filepath.Join(dir, "missing")})
+		require.Error(t, err)
+	})
+}
+
+func TestMeasureBinaries(t *testing.T) {
+	device := NewTPMInMemorySimulator()
+	defer device.Close()
+
+	pcr := attestedPCR(t)
+	digest := sha256.Sum256([]byte("worker build"))
+	measurements, err := BinaryMeasurements(pcr, []evidence.BinaryDigest{{Path: "compute_worker", SHA256: hex.EncodeToString(digest[:])}})
+	require.NoError(t, err)
+	require.NoError(t, ExtendMeasurements(device, measurements))
+
+	thetpm, err := device.OpenDevice()
+	require.NoError(t, err)
+
+	rsp, err := tpm2.PCRRead{
+		PCRSelectionIn: tpm2.TPMLPCRSelection{
+			PCRSelections: []tpm2.TPMSPCRSelection{
+				{
+					Hash:      tpm2.TPMAlgSHA256,
+					PCRSelect: tpm2.PCClientCompatible.PCRs(uint(pcr)),
+				},
+			},
+		},
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	require.Len(t, rsp.PCRValues.Digests, 1)
+
+	want := sha256.Sum256(append(make([]byte, sha256.Size), digest[:]...))
+	require.Equal(t, want[:], rsp.PCRValues.Digests[0].Buffer)
+}
@@ -0,0 +1,317 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/openpcc/openpcc/otel/otelutil"
+)
+
+// Phase is a checkpointed phase of the compute_boot sequence.
+type Phase string
+
+const (
+	// PhaseGPUVerified is reached once the GPU state has been verified.
+	PhaseGPUVerified Phase = "gpu_verified"
+	// PhaseMeasurementsCollected is reached once the model artifacts have been fetched, the GPU
+	// topology has been verified and the digests to measure have been collected. It doesn't touch
+	// the PCRs, so it runs again after a failure within the same boot.
+	PhaseMeasurementsCollected Phase = "measurements_collected"
+	// PhaseMeasured is reached once the collected measurements have been extended into the TPM. It is
+	// its own phase because PCRs can't be extended twice for the same boot.
+	PhaseMeasured Phase = "measured"
+	// PhaseTPMKeysReady is reached once the attestation and encryption keys have been set up.
+	PhaseTPMKeysReady Phase = "tpm_keys_ready"
+	// PhaseEvidenceCollected is reached once the attestation evidence has been collected.
+	PhaseEvidenceCollected Phase = "evidence_collected"
+	// PhaseEngineWarm is reached once the inference engine is ready and the models are prewarmed.
+	PhaseEngineWarm Phase = "engine_warm"
+)
+
+const (
+	// DefaultCheckpointFile is on a tmpfs, so checkpoints don't survive a reboot.
+	DefaultCheckpointFile = "/run/compute_boot/checkpoint.json"
+	// DefaultEvidenceMaxAge is how long collected evidence is reused after a restart by default.
+	DefaultEvidenceMaxAge = time.Hour
+	// DefaultMeasuredFile records which measuring phases ran in this boot when checkpoints are
+	// disabled. Like the checkpoint, it is on a tmpfs.
+	DefaultMeasuredFile = "/run/compute_boot/measured.json"
+)
+
+// bootIDFile changes on every boot, checkpoints of earlier boots are discarded.
+var bootIDFile = "/proc/sys/kernel/random/boot_id"
+
+type CheckpointConfig struct {
+	// File is where the checkpoint is persisted. Leave blank to disable checkpoints, every start then
+	// runs all phases, so a restart within the same boot fails at the measuring phase.
+	File string `yaml:"file"`
+	// EvidenceMaxAge is how long collected evidence is reused after a restart. Zero uses DefaultEvidenceMaxAge.
+	EvidenceMaxAge time.Duration `yaml:"evidence_max_age"`
+}
+
+// EvidenceTTL returns how long collected evidence is reused after a restart.
+func (c *CheckpointConfig) EvidenceTTL() time.Duration {
+	if c == nil || c.EvidenceMaxAge == 0 {
+		return DefaultEvidenceMaxAge
+	}
+	return c.EvidenceMaxAge
+}
+
+// Checkpoint is the persisted progress of compute_boot. A checkpoint is only valid for the boot and
+// the config it was created with.
+type Checkpoint struct {
+	BootID       string `json:"boot_id"`
+	ConfigDigest string `json:"config_digest"`
+	// Completed holds when each completed phase completed.
+	Completed map[Phase]time.Time `json:"completed"`
+	// Measurements are the measurements to extend, set by PhaseMeasurementsCollected.
+	Measurements []Measurement `json:"measurements,omitempty"`
+	// Evidence is the marshaled evidence, set by PhaseEvidenceCollected.
+	Evidence []byte `json:"evidence,omitempty"`
+}
+
+// BootStep runs a single phase.
+type BootStep struct {
+	Phase Phase
+	// MaxAge is how long the result of the phase can be reused after a restart. Zero means forever.
+	MaxAge time.Duration
+	// Measures marks a phase that extends PCRs. PCRs are only reset by a reboot, so the phase runs
+	// at most once per boot, even when its checkpoint was lost or the config changed.
+	Measures bool
+	// Run runs the phase. Data that later phases need after a restart should be stored in the checkpoint.
+	Run func(ctx context.Context, cp *Checkpoint) error
+}
+
+// measured records the measuring phases that were started in a boot.
+type measured struct {
+	BootID string  `json:"boot_id"`
+	Phases []Phase `json:"phases"`
+}
+
+// BootMachine runs the compute_boot phases in order and persists a checkpoint after each phase, so
+// a restarted compute_boot resumes after the last completed phase instead of starting from scratch.
+type BootMachine struct {
+	file         string
+	measuredFile string
+	bootID       string
+	configDigest string
+	now          func() time.Time
+	progress     *BootProgress
+}
+
+// NewBootMachine creates a boot machine. configDigest identifies the config, checkpoints created with
+// another config are discarded.
+func NewBootMachine(cfg *CheckpointConfig, configDigest string) *BootMachine {
+	m := &BootMachine{
+		measuredFile: DefaultMeasuredFile,
+		configDigest: configDigest,
+		now:          time.Now,
+	}
+	if cfg != nil && cfg.File != "" {
+		m.measuredFile = cfg.File + ".measured"
+	}
+
+	// without a boot id, checkpoints of an earlier boot can't be told apart, so don't use any.
+	// measuring phases fail, as they can't tell whether they already ran in this boot.
+	bootID, err := os.ReadFile(bootIDFile)
+	if err != nil {
+		slog.Warn("Failed to read boot id, checkpoints are disabled", "error", err)
+		return m
+	}
+
+	m.bootID = strings.TrimSpace(string(bootID))
+	if cfg != nil {
+		m.file = cfg.File
+	}
+	return m
+}
+
+// ReportProgress makes the machine report the progress of each phase to p.
+func (m *BootMachine) ReportProgress(p *BootProgress) {
+	m.progress = p
+}
+
+// Run runs the steps that have not completed yet and returns the final checkpoint. When a step runs,
+// all steps after it run as well, as they depend on its result.
+func (m *BootMachine) Run(ctx context.Context, steps []BootStep) (*Checkpoint, error) {
+	ctx, span := otelutil.Tracer.Start(ctx, "computeboot.BootMachine.Run")
+	defer span.End()
+
+	cp := m.load(ctx)
+	for i, step := range steps {
+		if completedAt, ok := cp.Completed[step.Phase]; ok {
+			if step.MaxAge == 0 || m.now().Sub(completedAt) < step.MaxAge {
+				slog.InfoContext(ctx, "Resuming after completed phase", "phase", step.Phase, "completed_at", completedAt)
+				m.progress.phaseResumed(step.Phase, completedAt)
+				continue
+			}
+			slog.InfoContext(ctx, "Completed phase expired, running it again", "phase", step.Phase, "completed_at", completedAt)
+		}
+
+		for _, later := range steps[i:] {
+			delete(cp.Completed, later.Phase)
+		}
+
+		if step.Measures {
+			if err := m.startMeasuring(step.Phase); err != nil {
+				return nil, otelutil.Errorf(span, "phase %s can't run: %w", step.Phase, err)
+			}
+		}
+
+		m.progress.phaseStarted(step.Phase)
+		stepCtx, stepSpan := otelutil.Tracer.Start(ctx, "computeboot.BootMachine.Run."+string(step.Phase))
+		err := step.Run(stepCtx, cp)
+		stepSpan.End()
+		m.progress.phaseEnded(step.Phase, err)
+		if err != nil {
+			return nil, otelutil.Errorf(span, "phase %s failed: %w", step.Phase, err)
+		}
+
+		cp.Completed[step.Phase] = m.now()
+		// without the checkpoint a restart would run measuring phases again, which is refused.
+		if err := m.save(cp); err != nil {
+			return nil, otelutil.Errorf(span, "failed to save checkpoint after phase %s: %w", step.Phase, err)
+		}
+	}
+
+	return cp, nil
+}
+
+// load returns the persisted checkpoint, or an empty checkpoint if there is no valid one.
+func (m *BootMachine) load(ctx context.Context) *Checkpoint {
+	fresh := &Checkpoint{
+		BootID:       m.bootID,
+		ConfigDigest: m.configDigest,
+		Completed:    map[Phase]time.Time{},
+	}
+	if m.file == "" {
+		return fresh
+	}
+
+	data, err := os.ReadFile(m.file)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.WarnContext(ctx, "Failed to read checkpoint, starting from scratch", "error", err)
+		}
+		return fresh
+	}
+
+	cp := &Checkpoint{}
+	if err := json.Unmarshal(data, cp); err != nil {
+		slog.WarnContext(ctx, "Invalid checkpoint, starting from scratch", "error", err)
+		return fresh
+	}
+
+	switch {
+	case cp.BootID != m.bootID:
+		slog.InfoContext(ctx, "Checkpoint is from an earlier boot, starting from scratch")
+		return fresh
+	case cp.ConfigDigest != m.configDigest:
+		slog.InfoContext(ctx, "Config changed since the checkpoint, starting from scratch")
+		return fresh
+	}
+
+	if cp.Completed == nil {
+		cp.Completed = map[Phase]time.Time{}
+	}
+	return cp
+}
+
+// startMeasuring records that the measuring phase started in this boot. It fails when the phase
+// already started in this boot, running it again would extend the PCRs twice.
+func (m *BootMachine) startMeasuring(phase Phase) error {
+	if m.bootID == "" {
+		return errors.New("boot id is unknown, can't tell whether the pcrs were already extended in this boot")
+	}
+
+	rec := measured{BootID: m.bootID}
+	data, err := os.ReadFile(m.measuredFile)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("failed to read measured phases: %w", err)
+	default:
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return fmt.Errorf("invalid measured phases: %w", err)
+		}
+	}
+
+	if rec.BootID != m.bootID {
+		rec = measured{BootID: m.bootID}
+	}
+	if slices.Contains(rec.Phases, phase) {
+		return errors.New("pcrs were already extended in this boot, reboot to measure again")
+	}
+	rec.Phases = append(rec.Phases, phase)
+
+	data, err = json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal measured phases: %w", err)
+	}
+	if err := writeFileAtomic(m.measuredFile, data); err != nil {
+		return fmt.Errorf("failed to record measured phases: %w", err)
+	}
+	return nil
+}
+
+// save atomically replaces the persisted checkpoint.
+func (m *BootMachine) save(cp *Checkpoint) error {
+	if m.file == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	return writeFileAtomic(m.file, data)
+}
+
+// writeFileAtomic atomically replaces the file with data.
+func writeFileAtomic(file string, data []byte) error {
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(dir, "."+filepath.Base(file)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	_, err = f.Write(data)
+	err = errors.Join(err, f.Close())
+	if err == nil {
+		err = os.Rename(f.Name(), file)
+	}
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to write %s: %w", file, err), os.Remove(f.Name()))
+	}
+
+	return nil
+}
@@ -0,0 +1,230 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBootMachine(t *testing.T) {
+	setBootID := func(t *testing.T, id string) {
+		file := filepath.Join(t.TempDir(), "boot_id")
+		require.NoError(t, os.WriteFile(file, []byte(id+"\n"), 0o600))
+		orig := bootIDFile
+		bootIDFile = file
+		t.Cleanup(func() { bootIDFile = orig })
+	}
+
+	// newSteps returns steps that record which phases ran, the phase in failAt fails.
+	newSteps := func(ran *[]Phase, failAt Phase) []BootStep {
+		phases := []Phase{PhaseGPUVerified, PhaseMeasurementsCollected, PhaseMeasured, PhaseTPMKeysReady, PhaseEvidenceCollected, PhaseEngineWarm}
+		steps := make([]BootStep, 0, len(phases))
+		for _, phase := range phases {
+			step := BootStep{
+				Phase:    phase,
+				Measures: phase == PhaseMeasured,
+				Run: func(_ context.Context, cp *Checkpoint) error {
+					if phase == failAt {
+						return errors.New("boom")
+					}
+					*ran = append(*ran, phase)
+					if phase == PhaseEvidenceCollected {
+						cp.Evidence = []byte("evidence")
+					}
+					return nil
+				},
+			}
+			if phase == PhaseEvidenceCollected {
+				step.MaxAge = time.Hour
+			}
+			steps = append(steps, step)
+		}
+		return steps
+	}
+
+	newMachine := func(t *testing.T, file, digest string) *BootMachine {
+		m := NewBootMachine(&CheckpointConfig{File: file}, digest)
+		if file == "" {
+			m.measuredFile = filepath.Join(t.TempDir(), "measured.json")
+		}
+		return m
+	}
+
+	t.Run("ok, resume after failed phase", func(t *testing.T) {
+		setBootID(t, "boot-1")
+		file := filepath.Join(t.TempDir(), "checkpoint.json")
+
+		var ran []Phase
+		_, err := newMachine(t, file, "cfg").Run(t.Context(), newSteps(&ran, PhaseEvidenceCollected))
+		require.Error(t, err)
+		require.Equal(t, []Phase{PhaseGPUVerified, PhaseMeasurementsCollected, PhaseMeasured, PhaseTPMKeysReady}, ran)
+
+		ran = nil
+		cp, err := newMachine(t, file, "cfg").Run(t.Context(), newSteps(&ran, ""))
+		require.NoError(t, err)
+		require.Equal(t, []Phase{PhaseEvidenceCollected, PhaseEngineWarm}, ran)
+		require.Equal(t, []byte("evidence"), cp.Evidence)
+
+		// everything completed, evidence is restored from the checkpoint.
+		ran = nil
+		cp, err = newMachine(t, file, "cfg").Run(t.Context(), newSteps(&ran, ""))
+		require.NoError(t, err)
+		require.Empty(t, ran)
+		require.Equal(t, []byte("evidence"), cp.Evidence)
+	})
+
+	t.Run("ok, new boot starts from scratch", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "checkpoint.json")
+
+		setBootID(t, "boot-1")
+		var ran []Phase
+		_, err := newMachine(t, file, "cfg").Run(t.Context(), newSteps(&ran, ""))
+		require.NoError(t, err)
+
+		setBootID(t, "boot-2")
+		ran = nil
+		_, err = newMachine(t, file, "cfg").Run(t.Context(), newSteps(&ran, ""))
+		require.NoError(t, err)
+		require.Len(t, ran, 6)
+	})
+
+	t.Run("ok, config change starts from scratch after a reboot", func(t *testing.T) {
+		setBootID(t, "boot-1")
+		file := filepath.Join(t.TempDir(), "checkpoint.json")
+
+		var ran []Phase
+		_, err := newMachine(t, file, "cfg-1").Run(t.Context(), newSteps(&ran, ""))
+		require.NoError(t, err)
+
+		ran = nil
+		_, err = newMachine(t, file, "cfg-2").Run(t.Context(), newSteps(&ran, ""))
+		require.ErrorContains(t, err, "pcrs were already extended in this boot")
+		require.Equal(t, []Phase{PhaseGPUVerified, PhaseMeasurementsCollected}, ran)
+
+		setBootID(t, "boot-2")
+		ran = nil
+		_, err = newMachine(t, file, "cfg-2").Run(t.Context(), newSteps(&ran, ""))
+		require.NoError(t, err)
+		require.Len(t, ran, 6)
+	})
+
+	t.Run("fail, failed measuring phase is not run again in the same boot", func(t *testing.T) {
+		setBootID(t, "boot-1")
+		file := filepath.Join(t.TempDir(), "checkpoint.json")
+
+		var ran []Phase
+		_, err := newMachine(t, file, "cfg").Run(t.Context(), newSteps(&ran, PhaseMeasured))
+		require.Error(t, err)
+
+		ran = nil
+		_, err = newMachine(t, file, "cfg").Run(t.Context(), newSteps(&ran, ""))
+		require.ErrorContains(t, err, "pcrs were already extended in this boot")
+		require.Empty(t, ran)
+	})
+
+	t.Run("ok, failed collecting phase runs again in the same boot", func(t *testing.T) {
+		setBootID(t, "boot-1")
+		file := filepath.Join(t.TempDir(), "checkpoint.json")
+
+		var ran []Phase
+		_, err := newMachine(t, file, "cfg").Run(t.Context(), newSteps(&ran, PhaseMeasurementsCollected))
+		require.Error(t, err)
+		require.Equal(t, []Phase{PhaseGPUVerified}, ran)
+
+		ran = nil
+		_, err = newMachine(t, file, "cfg").Run(t.Context(), newSteps(&ran, ""))
+		require.NoError(t, err)
+		require.Equal(t, []Phase{PhaseMeasurementsCollected, PhaseMeasured, PhaseTPMKeysReady, PhaseEvidenceCollected, PhaseEngineWarm}, ran)
+	})
+
+	t.Run("fail, checkpoint can't be saved", func(t *testing.T) {
+		setBootID(t, "boot-1")
+		notADir := filepath.Join(t.TempDir(), "file")
+		require.NoError(t, os.WriteFile(notADir, nil, 0o600))
+
+		var ran []Phase
+		_, err := newMachine(t, filepath.Join(notADir, "checkpoint.json"), "cfg").Run(t.Context(), newSteps(&ran, ""))
+		require.ErrorContains(t, err, "failed to save checkpoint after phase gpu_verified")
+		require.Equal(t, []Phase{PhaseGPUVerified}, ran)
+	})
+
+	t.Run("ok, expired phase runs again with the phases after it", func(t *testing.T) {
+		setBootID(t, "boot-1")
+		file := filepath.Join(t.TempDir(), "checkpoint.json")
+
+		var ran []Phase
+		_, err := newMachine(t, file, "cfg").Run(t.Context(), newSteps(&ran, ""))
+		require.NoError(t, err)
+
+		m := newMachine(t, file, "cfg")
+		m.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		ran = nil
+		_, err = m.Run(t.Context(), newSteps(&ran, ""))
+		require.NoError(t, err)
+		require.Equal(t, []Phase{PhaseEvidenceCollected, PhaseEngineWarm}, ran)
+	})
+
+	t.Run("ok, corrupt checkpoint starts from scratch", func(t *testing.T) {
+		setBootID(t, "boot-1")
+		file := filepath.Join(t.TempDir(), "checkpoint.json")
+		require.NoError(t, os.WriteFile(file, []byte("{"), 0o600))
+
+		var ran []Phase
+		_, err := newMachine(t, file, "cfg").Run(t.Context(), newSteps(&ran, ""))
+		require.NoError(t, err)
+		require.Len(t, ran, 6)
+	})
+
+	t.Run("ok, no checkpoint file runs all phases", func(t *testing.T) {
+		setBootID(t, "boot-1")
+		var ran []Phase
+		_, err := newMachine(t, "", "cfg").Run(t.Context(), newSteps(&ran, ""))
+		require.NoError(t, err)
+		require.Len(t, ran, 6)
+	})
+
+	t.Run("fail, no checkpoint file measures once per boot", func(t *testing.T) {
+		setBootID(t, "boot-1")
+		m := newMachine(t, "", "cfg")
+		var ran []Phase
+		_, err := m.Run(t.Context(), newSteps(&ran, ""))
+		require.NoError(t, err)
+
+		ran = nil
+		_, err = m.Run(t.Context(), newSteps(&ran, ""))
+		require.ErrorContains(t, err, "pcrs were already extended in this boot")
+		require.Equal(t, []Phase{PhaseGPUVerified, PhaseMeasurementsCollected}, ran)
+	})
+
+	t.Run("fail, unknown boot id can't measure", func(t *testing.T) {
+		orig := bootIDFile
+		bootIDFile = filepath.Join(t.TempDir(), "missing")
+		t.Cleanup(func() { bootIDFile = orig })
+
+		var ran []Phase
+		_, err := newMachine(t, "", "cfg").Run(t.Context(), newSteps(&ran, ""))
+		require.ErrorContains(t, err, "boot id is unknown")
+	})
+}
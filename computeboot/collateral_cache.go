@@ -0,0 +1,271 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-tdx-guest/verify/trust"
+)
+
+const defaultCollateralTTL = 24 * time.Hour
+
+// thimHost is the Azure instance metadata service, which serves the VCEK certificates of SEV-SNP
+// VMs from the Trusted Hardware Identity Management (THIM) service.
+const thimHost = "169.254.169.254"
+
+// thimPathPrefix is the path of the THIM endpoints of the instance metadata service.
+const thimPathPrefix = "/metadata/THIM/"
+
+// maxCollateralSize bounds the size of a collateral response read by the caching transport.
+const maxCollateralSize = 4 * 1024 * 1024
+
+// CollateralCacheConfig is config for caching attestation collateral, such as TDX collateral
+// from the PCS, on disk.
+type CollateralCacheConfig struct {
+	// Dir is where cached collateral is stored. Leave blank to disable the cache.
+	Dir string `yaml:"dir"`
+	// DefaultTTL is how long collateral is cached when the response has no max-age. Defaults to 24h.
+	DefaultTTL time.Duration `yaml:"default_ttl"`
+}
+
+// collateralEntry is a cached response on disk.
+type collateralEntry struct {
+	URL       string              `json:"url"`
+	Header    map[string][]string `json:"header"`
+	Body      []byte              `json:"body"`
+	ExpiresAt time.Time           `json:"expires_at"`
+}
+
+// CollateralCache is a trust.HTTPSGetter that caches responses on disk until their TTL expires.
+// Expired entries are used as a fallback when the upstream service is unavailable, the verifier
+// is responsible for rejecting collateral that is no longer valid.
+type CollateralCache struct {
+	cfg    *CollateralCacheConfig
+	getter trust.HTTPSGetter
+	now    func() time.Time
+}
+
+// NewCollateralCache returns a cache in front of getter. When cfg is nil or has no directory,
+// requests are passed through to getter.
+func NewCollateralCache(cfg *CollateralCacheConfig, getter trust.HTTPSGetter) *CollateralCache {
+	return &CollateralCache{
+		cfg:    cfg,
+		getter: getter,
+		now:    time.Now,
+	}
+}
+
+func (c *CollateralCache) Get(url string) (map[string][]string, []byte, error) {
+	return c.GetContext(context.Background(), url)
+}
+
+func (c *CollateralCache) GetContext(ctx context.Context, url string) (map[string][]string, []byte, error) {
+	return c.get(url, func() (map[string][]string, []byte, error) {
+		return trust.GetWith(ctx, c.getter, url)
+	})
+}
+
+// get returns the cached response for url, calling fetch when there is no unexpired entry.
+func (c *CollateralCache) get(url string, fetch func() (map[string][]string, []byte, error)) (map[string][]string, []byte, error) {
+	if c.cfg == nil || c.cfg.Dir == "" {
+		return fetch()
+	}
+
+	entry, err := c.read(url)
+	if err != nil {
+		slog.Warn("failed to read cached collateral, ignoring cache", "url", url, "error", err)
+	}
+	if entry != nil && c.now().Before(entry.ExpiresAt) {
+		slog.Debug("Using cached collateral", "url", url, "expires_at", entry.ExpiresAt)
+		return entry.Header, entry.Body, nil
+	}
+
+	header, body, err := fetch()
+	if err != nil {
+		if entry != nil {
+			slog.Warn("failed to fetch collateral, using expired cache entry", "url", url, "expires_at", entry.ExpiresAt, "error", err)
+			return entry.Header, entry.Body, nil
+		}
+		return nil, nil, err
+	}
+
+	err = c.write(&collateralEntry{
+		URL:       url,
+		Header:    header,
+		Body:      body,
+		ExpiresAt: c.now().Add(c.ttl(header)),
+	})
+	if err != nil {
+		slog.Warn("failed to cache collateral", "url", url, "error", err)
+	}
+
+	return header, body, nil
+}
+
+// Transport returns a http.RoundTripper that caches the GET requests accepted by match and
+// passes all other requests to next. It is used for collateral fetched by attestors that don't
+// accept a trust.HTTPSGetter, such as the VCEK certificates from THIM.
+func (c *CollateralCache) Transport(next http.RoundTripper, match func(*http.Request) bool) http.RoundTripper {
+	return &collateralTransport{
+		cache: c,
+		next:  next,
+		match: match,
+	}
+}
+
+type collateralTransport struct {
+	cache *CollateralCache
+	next  http.RoundTripper
+	match func(*http.Request) bool
+}
+
+func (t *collateralTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || !t.match(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	header, body, err := t.cache.get(req.URL.String(), func() (map[string][]string, []byte, error) {
+		resp, err := t.next.RoundTrip(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+
+		// only successful responses are cached, anything else is an error so an expired entry can be used instead.
+		if resp.StatusCode != http.StatusOK {
+			return nil, nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxCollateralSize+1))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+		if len(body) > maxCollateralSize {
+			return nil, nil, fmt.Errorf("response body exceeds %d bytes", maxCollateralSize)
+		}
+
+		return resp.Header, body, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header(header).Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// isTHIMRequest reports whether req fetches collateral from THIM.
+func isTHIMRequest(req *http.Request) bool {
+	return req.URL.Hostname() == thimHost && strings.HasPrefix(req.URL.Path, thimPathPrefix)
+}
+
+// ttl returns the max-age of the response, or the default TTL.
+func (c *CollateralCache) ttl(header map[string][]string) time.Duration {
+	for _, value := range http.Header(header).Values("Cache-Control") {
+		for directive := range strings.SplitSeq(value, ",") {
+			maxAge, ok := strings.CutPrefix(strings.TrimSpace(directive), "max-age=")
+			if !ok {
+				continue
+			}
+			seconds, err := strconv.ParseInt(maxAge, 10, 64)
+			if err == nil && seconds >= 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+
+	if c.cfg.DefaultTTL > 0 {
+		return c.cfg.DefaultTTL
+	}
+	return defaultCollateralTTL
+}
+
+func (c *CollateralCache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.cfg.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// read returns the cache entry for url, or nil if there is none.
+func (c *CollateralCache) read(url string) (*collateralEntry, error) {
+	b, err := os.ReadFile(c.path(url))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+
+	var entry collateralEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cache entry: %w", err)
+	}
+
+	// guard against hash collisions and entries that were moved around.
+	if entry.URL != url {
+		return nil, fmt.Errorf("cache entry is for %s", entry.URL)
+	}
+
+	return &entry, nil
+}
+
+func (c *CollateralCache) write(entry *collateralEntry) error {
+	if err := os.MkdirAll(c.cfg.Dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+
+	// write to a temporary file first so a crash never leaves a partial entry behind.
+	path := c.path(entry.URL)
+	if err := os.WriteFile(path+".tmp", b, 0o600); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to rename cache entry: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeHTTPSGetter struct {
+	header map[string][]string
+	body   []byte
+	err    error
+	calls  int
+}
+
+func (g *fakeHTTPSGetter) Get(string) (map[string][]string, []byte, error) {
+	g.calls++
+	return g.header, g.body, g.err
+}
+
+func TestCollateralCache(t *testing.T) {
+	const url = "https://api.trustedservices.intel.com/tdx/certification/v4/tcb?fmspc=00806f050000"
+
+	newCache := func(t *testing.T, getter *fakeHTTPSGetter) (*CollateralCache, *time.Time) {
+		now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		cache := NewCollateralCache(&CollateralCacheConfig{
+			Dir:        t.TempDir(),
+			DefaultTTL: time.Hour,
+		}, getter)
+		cache.now = func() time.Time { return now }
+		return cache, &now
+	}
+
+	t.Run("ok, cached until default ttl expires", func(t *testing.T) {
+		getter := &fakeHTTPSGetter{body: []byte("collateral")}
+		cache, now := newCache(t, getter)
+
+		_, body, err := cache.Get(url)
+		require.NoError(t, err)
+		require.Equal(t, []byte("collateral"), body)
+
+		*now = now.Add(59 * time.Minute)
+		_, body, err = cache.Get(url)
+		require.NoError(t, err)
+		require.Equal(t, []byte("collateral"), body)
+		require.Equal(t, 1, getter.calls)
+
+		*now = now.Add(2 * time.Minute)
+		_, _, err = cache.Get(url)
+		require.NoError(t, err)
+		require.Equal(t, 2, getter.calls)
+	})
+
+	t.Run("ok, max-age takes precedence over default ttl", func(t *testing.T) {
+		getter := &fakeHTTPSGetter{
+			header: map[string][]string{"Cache-Control": {"public, max-age=60"}},
+			body:   []byte("collateral"),
+		}
+		cache, now := newCache(t, getter)
+
+		_, _, err := cache.Get(url)
+		require.NoError(t, err)
+
+		*now = now.Add(2 * time.Minute)
+		header, _, err := cache.Get(url)
+		require.NoError(t, err)
+		require.Equal(t, getter.header, header)
+		require.Equal(t, 2, getter.calls)
+	})
+
+	t.Run("ok, expired entry is used when fetching fails", func(t *testing.T) {
+		getter := &fakeHTTPSGetter{body: []byte("collateral")}
+		cache, now := newCache(t, getter)
+
+		_, _, err := cache.Get(url)
+		require.NoError(t, err)
+
+		*now = now.Add(2 * time.Hour)
+		getter.err = errors.New("service unavailable")
+		_, body, err := cache.Get(url)
+		require.NoError(t, err)
+		require.Equal(t, []byte("collateral"), body)
+	})
+
+	t.Run("ok, disabled cache passes requests through", func(t *testing.T) {
+		getter := &fakeHTTPSGetter{body: []byte("collateral")}
+		cache := NewCollateralCache(nil, getter)
+
+		for range 2 {
+			_, _, err := cache.Get(url)
+			require.NoError(t, err)
+		}
+		require.Equal(t, 2, getter.calls)
+	})
+
+	t.Run("fail, fetching fails without cache entry", func(t *testing.T) {
+		getter := &fakeHTTPSGetter{err: errors.New("service unavailable")}
+		cache, _ := newCache(t, getter)
+
+		_, _, err := cache.Get(url)
+		require.Error(t, err)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestCollateralCacheTransport(t *testing.T) {
+	const thimURL = "http://169.254.169.254/metadata/THIM/amd/certification"
+
+	newClient := func(t *testing.T, status *int, calls *int) *http.Client {
+		cache := NewCollateralCache(&CollateralCacheConfig{Dir: t.TempDir()}, &fakeHTTPSGetter{})
+		next := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			*calls++
+			return &http.Response{
+				StatusCode: *status,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"vcekCert":"cert"}`)),
+				Request:    req,
+			}, nil
+		})
+		return &http.Client{Transport: cache.Transport(next, isTHIMRequest)}
+	}
+
+	get := func(t *testing.T, client *http.Client, url string) (string, error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(b), nil
+	}
+
+	t.Run("ok, thim requests are cached", func(t *testing.T) {
+		status, calls := http.StatusOK, 0
+		client := newClient(t, &status, &calls)
+
+		for range 2 {
+			body, err := get(t, client, thimURL)
+			require.NoError(t, err)
+			require.JSONEq(t, `{"vcekCert":"cert"}`, body)
+		}
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("ok, other requests are passed through", func(t *testing.T) {
+		status, calls := http.StatusOK, 0
+		client := newClient(t, &status, &calls)
+
+		for range 2 {
+			_, err := get(t, client, "http://169.254.169.254/metadata/instance")
+			require.NoError(t, err)
+		}
+		require.Equal(t, 2, calls)
+	})
+
+	t.Run("fail, error responses are not cached", func(t *testing.T) {
+		status, calls := http.StatusServiceUnavailable, 0
+		client := newClient(t, &status, &calls)
+
+		_, err := get(t, client, thimURL)
+		require.Error(t, err)
+
+		status = http.StatusOK
+		_, err = get(t, client, thimURL)
+		require.NoError(t, err)
+		require.Equal(t, 2, calls)
+	})
+}
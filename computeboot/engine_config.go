@@ -0,0 +1,226 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+)
+
+// EngineConfigConfig is config for attesting to the effective configuration of the inference
+// engine, the arguments and environment of its systemd unit, so verifiers can pin how the engine
+// runs and not just its binary.
+type EngineConfigConfig struct {
+	// PCR is extended with the digest of the engine config. Leave 0 for ApplicationPCR.
+	PCR uint32 `yaml:"pcr"`
+	// Environment are the environment variables included in the evidence. Leave empty for the
+	// defaults of the engine type, see DefaultEngineEnvironment.
+	Environment []string `yaml:"environment"`
+	// RedactArgs are flags whose values are replaced by rcevidence.RedactedValue, e.g. API keys.
+	// --api-key is always redacted.
+	RedactArgs []string `yaml:"redact_args"`
+}
+
+// DefaultEngineEnvironment are the environment variables included in the evidence by engine type.
+// Other variables may hold secrets, like model registry tokens, and are left out.
+var DefaultEngineEnvironment = map[string][]string{
+	"ollama": {
+		"OLLAMA_NUM_PARALLEL",
+		"OLLAMA_MAX_LOADED_MODELS",
+		"OLLAMA_MAX_QUEUE",
+		"OLLAMA_CONTEXT_LENGTH",
+		"OLLAMA_FLASH_ATTENTION",
+		"OLLAMA_KV_CACHE_TYPE",
+		"OLLAMA_KEEP_ALIVE",
+		"OLLAMA_HOST",
+		"OLLAMA_MODELS",
+	},
+	"vllm": {
+		"VLLM_ATTENTION_BACKEND",
+		"VLLM_USE_V1",
+		"VLLM_WORKER_MULTIPROC_METHOD",
+		"CUDA_VISIBLE_DEVICES",
+	},
+}
+
+// alwaysRedactedArgs are flags whose values are redacted whatever the config.
+var alwaysRedactedArgs = []string{"--api-key"}
+
+// ReadEngineConfig reads the engine config from the systemd unit of the inference engine.
+func ReadEngineConfig(ctx context.Context, engineCfg *InferenceEngineConfig, cfg *EngineConfigConfig) (rcevidence.EngineConfig, error) {
+	if engineCfg == nil || engineCfg.SystemdServiceName == "" {
+		return rcevidence.EngineConfig{}, errors.New("missing inference engine systemd service name")
+	}
+
+	conn, err := dbus.NewSystemConnectionContext(ctx)
+	if err != nil {
+		return rcevidence.EngineConfig{}, fmt.Errorf("failed to connect to systemd: %w", err)
+	}
+	defer conn.Close()
+
+	props, err := conn.GetUnitTypePropertiesContext(ctx, engineCfg.SystemdServiceName, "Service")
+	if err != nil {
+		return rcevidence.EngineConfig{}, fmt.Errorf("failed to read %s properties: %w", engineCfg.SystemdServiceName, err)
+	}
+
+	args, err := unitExecStart(props["ExecStart"])
+	if err != nil {
+		return rcevidence.EngineConfig{}, fmt.Errorf("failed to read %s ExecStart: %w", engineCfg.SystemdServiceName, err)
+	}
+
+	// environment files are applied before Environment, later assignments win.
+	var env []string
+	for _, path := range unitEnvironmentFiles(props["EnvironmentFiles"]) {
+		vars, err := readEnvironmentFile(path)
+		if err != nil {
+			return rcevidence.EngineConfig{}, err
+		}
+		env = append(env, vars...)
+	}
+	unitEnv, _ := props["Environment"].([]string)
+	env = append(env, unitEnv...)
+
+	return newEngineConfig(engineCfg.Type, engineCfg.SystemdServiceName, args, env, cfg), nil
+}
+
+// newEngineConfig keeps the attested environment variables and redacts secret arguments.
+func newEngineConfig(engine, unit string, args, env []string, cfg *EngineConfigConfig) rcevidence.EngineConfig {
+	names := cfg.Environment
+	if len(names) == 0 {
+		names = DefaultEngineEnvironment[engine]
+	}
+	environment := map[string]string{}
+	for _, kv := range env {
+		name, value, ok := strings.Cut(kv, "=")
+		if ok && slices.Contains(names, name) {
+			environment[name] = value
+		}
+	}
+
+	redact := slices.Concat(alwaysRedactedArgs, cfg.RedactArgs)
+	redacted := slices.Clone(args)
+	for i, arg := range redacted {
+		for _, flag := range redact {
+			if strings.HasPrefix(arg, flag+"=") {
+				redacted[i] = flag + "=" + rcevidence.RedactedValue
+			} else if arg == flag && i+1 < len(redacted) {
+				redacted[i+1] = rcevidence.RedactedValue
+			}
+		}
+	}
+
+	return rcevidence.EngineConfig{
+		Engine:      engine,
+		Unit:        unit,
+		Args:        redacted,
+		Environment: environment,
+	}
+}
+
+// unitExecStart returns the argv of the first ExecStart command of a unit. systemd reports ExecStart
+// as an array of (path, argv, ignore failure, timestamps, pid, exit code, status) structs.
+func unitExecStart(prop any) ([]string, error) {
+	commands, ok := prop.([][]any)
+	if !ok || len(commands) == 0 {
+		return nil, errors.New("unit has no ExecStart command")
+	}
+	if len(commands) > 1 {
+		slog.Warn("Unit has several ExecStart commands, only attesting the first", "commands", len(commands))
+	}
+	if len(commands[0]) < 2 {
+		return nil, errors.New("malformed ExecStart command")
+	}
+	argv, ok := commands[0][1].([]string)
+	if !ok || len(argv) == 0 {
+		return nil, errors.New("malformed ExecStart arguments")
+	}
+	return argv, nil
+}
+
+// unitEnvironmentFiles returns the paths of the EnvironmentFiles of a unit, reported as an array of
+// (path, ignore missing) structs. Missing optional files are left out.
+func unitEnvironmentFiles(prop any) []string {
+	files, _ := prop.([][]any)
+	var paths []string
+	for _, file := range files {
+		if len(file) < 2 {
+			continue
+		}
+		path, _ := file[0].(string)
+		optional, _ := file[1].(bool)
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil && optional {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// readEnvironmentFile reads the KEY=VALUE assignments of a systemd environment file, ignoring
+// comments and blank lines. Quoted values are unquoted.
+func readEnvironmentFile(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read environment file: %w", err)
+	}
+
+	var env []string
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		env = append(env, strings.TrimSpace(name)+"="+value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read environment file: %w", err)
+	}
+	return env, nil
+}
+
+// EngineConfigMeasurement returns the measurement of the digest of the engine config for pcr.
+func EngineConfigMeasurement(pcr uint32, c rcevidence.EngineConfig) (Measurement, error) {
+	digest, err := c.Digest()
+	if err != nil {
+		return Measurement{}, err
+	}
+	return newMeasurement(pcr, "inference engine config", digest), nil
+}
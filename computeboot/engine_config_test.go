@@ -0,0 +1,98 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEngineConfig(t *testing.T) {
+	t.Run("ok, default environment of the engine", func(t *testing.T) {
+		c := newEngineConfig("ollama", "ollama.service", []string{"/usr/bin/ollama", "serve"}, []string{
+			"OLLAMA_NUM_PARALLEL=4",
+			"OLLAMA_HOST=127.0.0.1:11434",
+			"HF_TOKEN=secret",
+		}, &EngineConfigConfig{})
+
+		require.Equal(t, rcevidence.EngineConfig{
+			Engine: "ollama",
+			Unit:   "ollama.service",
+			Args:   []string{"/usr/bin/ollama", "serve"},
+			Environment: map[string]string{
+				"OLLAMA_NUM_PARALLEL": "4",
+				"OLLAMA_HOST":         "127.0.0.1:11434",
+			},
+		}, c)
+	})
+
+	t.Run("ok, configured environment and redacted args", func(t *testing.T) {
+		args := []string{"vllm", "serve", "llama", "--max-model-len", "8192", "--api-key", "secret", "--hf-token=secret"}
+		c := newEngineConfig("vllm", "vllm.service", args, []string{"VLLM_USE_V1=1", "MY_VAR=a=b"}, &EngineConfigConfig{
+			Environment: []string{"MY_VAR"},
+			RedactArgs:  []string{"--hf-token"},
+		})
+
+		require.Equal(t, []string{"vllm", "serve", "llama", "--max-model-len", "8192", "--api-key", rcevidence.RedactedValue, "--hf-token=" + rcevidence.RedactedValue}, c.Args)
+		require.Equal(t, map[string]string{"MY_VAR": "a=b"}, c.Environment)
+		// the args of the unit are left untouched.
+		require.Equal(t, "secret", args[6])
+
+		maxModelLen, ok := c.Arg("--max-model-len")
+		require.True(t, ok)
+		require.Equal(t, "8192", maxModelLen)
+	})
+}
+
+func TestUnitExecStart(t *testing.T) {
+	t.Run("ok, argv of the first command", func(t *testing.T) {
+		argv, err := unitExecStart([][]any{
+			{"/usr/bin/ollama", []string{"/usr/bin/ollama", "serve"}, false},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"/usr/bin/ollama", "serve"}, argv)
+	})
+
+	t.Run("fail, no command", func(t *testing.T) {
+		_, err := unitExecStart(nil)
+		require.Error(t, err)
+	})
+
+	t.Run("fail, malformed command", func(t *testing.T) {
+		_, err := unitExecStart([][]any{{"/usr/bin/ollama", "serve"}})
+		require.Error(t, err)
+	})
+}
+
+func TestReadEnvironmentFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "engine.env")
+	require.NoError(t, os.WriteFile(path, []byte("# comment\n\nOLLAMA_NUM_PARALLEL=4\nOLLAMA_HOST=\"127.0.0.1:11434\"\n; other comment\nnot an assignment\n"), 0o600))
+
+	env, err := readEnvironmentFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []string{"OLLAMA_NUM_PARALLEL=4", "OLLAMA_HOST=127.0.0.1:11434"}, env)
+
+	require.Equal(t, []string{path}, unitEnvironmentFiles([][]any{
+		{path, false},
+		{filepath.Join(t.TempDir(), "missing.env"), true},
+	}))
+}
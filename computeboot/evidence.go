@@ -22,10 +22,10 @@ package computeboot
 import (
 	"context"
 	"crypto/x509"
-	"encoding/base64"
 	"errors"
 	"fmt"
-	"os"
+	"log/slog"
+	"net/http"
 
 	pb "github.com/google/go-tdx-guest/proto/tdx"
 	"github.com/openpcc/openpcc/attestation/attest"
@@ -36,7 +36,7 @@ import (
 	"github.com/google/go-tpm/tpmutil"
 )
 
-func collectEvidence(_ *AttestationConfig, tpmCfg *TPMConfig, tpmDevice TPMDevice, gpuManager GPUManager, tlogCfg *TransparencyConfig) (ev.SignedEvidenceList, error) {
+func collectEvidence(cfg *AttestationConfig, tpmCfg *TPMConfig, tpmDevice TPMDevice, gpuManager GPUManager, tlogCfg *TransparencyConfig) (ev.SignedEvidenceList, error) {
 	result := ev.SignedEvidenceList{}
 	var teeType ev.TEEType
 
@@ -45,11 +45,27 @@ func collectEvidence(_ *AttestationConfig, tpmCfg *TPMConfig, tpmDevice TPMDevic
 		return nil, err
 	}
 
-	tpm, err := tpmDevice.OpenDevice()
+	device, err := tpmDevice.OpenDevice()
 	if err != nil {
 		return nil, err
 	}
 
+	// the attestors share a session that answers repeated NV reads from a cache, the NV indexes are
+	// read in the background while the TEE evidence is collected.
+	tpm := NewTPMSession(device)
+	waitPrefetch := tpm.PrefetchNV(evidenceNVIndexes(tpmCfg)...)
+	defer func() {
+		waitPrefetch()
+		stats := tpm.Stats()
+		slog.Info("Collected TPM evidence", "tpm_commands", stats.Sent, "tpm_cache_hits", stats.CacheHits)
+	}()
+
+	var cacheCfg *CollateralCacheConfig
+	if cfg != nil {
+		cacheCfg = cfg.CollateralCache
+	}
+	collateralGetter := NewCollateralCache(cacheCfg, &trust.SimpleHTTPSGetter{})
+
 	switch teeType {
 	case ev.Tdx:
 		switch tpmCfg.TPMType {
@@ -68,7 +84,7 @@ func collectEvidence(_ *AttestationConfig, tpmCfg *TPMConfig, tpmDevice TPMDevic
 			}
 			result = append(result, teeEvidencePiece)
 
-			collateralEvidence, err := getTDXCollateral(teeEvidencePiece)
+			collateralEvidence, err := getTDXCollateral(teeEvidencePiece, collateralGetter)
 
 			if err != nil {
 				return nil, fmt.Errorf("gce tdx collateral failed: %w", err)
@@ -90,7 +106,7 @@ func collectEvidence(_ *AttestationConfig, tpmCfg *TPMConfig, tpmDevice TPMDevic
 
 			result = append(result, teeEvidencePiece)
 
-			collateralEvidence, err := getTDXCollateral(teeEvidencePiece)
+			collateralEvidence, err := getTDXCollateral(teeEvidencePiece, collateralGetter)
 
 			if err != nil {
 				return nil, fmt.Errorf("azure tdx collateral failed: %w", err)
@@ -121,9 +137,12 @@ func collectEvidence(_ *AttestationConfig, tpmCfg *TPMConfig, tpmDevice TPMDevic
 			}
 			result = append(result, teeEvidencePiece)
 		case Azure:
-			teeAttestor := attest.NewAzureSEVSNPTEEAttestor(
+			// the attestor fetches the VCEK certificates from THIM, cache them with the other collateral.
+			thimClient := &http.Client{Transport: collateralGetter.Transport(http.DefaultTransport, isTHIMRequest)}
+			teeAttestor := attest.NewAzureSEVSNPTEEAttestorWithHTTPClient(
 				tpm,
 				make([]byte, 64),
+				thimClient,
 			)
 
 			teeEvidencePiece, err := teeAttestor.CreateSignedEvidence(context.Background())
@@ -236,20 +255,9 @@ func collectEvidence(_ *AttestationConfig, tpmCfg *TPMConfig, tpmDevice TPMDevic
 		result = append(result, nvidiaEvidence...)
 	}
 
-	if tlogCfg == nil || tlogCfg.ImageSigstoreBundle == "" {
-		return nil, errors.New("no image sigstore bundle provided")
-	}
-
-	decodedBundle, err := base64.StdEncoding.DecodeString(tlogCfg.ImageSigstoreBundle)
-
+	sigstoreBundle, err := sigstoreBundlePiece(tlogCfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to base64 decode image sigstore bundle: %w", err)
-	}
-
-	sigstoreBundle := &ev.SignedEvidencePiece{
-		Type:      ev.ImageSigstoreBundle,
-		Data:      decodedBundle,
-		Signature: []byte{},
+		return nil, err
 	}
 	result = append(result, sigstoreBundle)
 
@@ -260,28 +268,9 @@ func collectEvidence(_ *AttestationConfig, tpmCfg *TPMConfig, tpmDevice TPMDevic
 		return nil, fmt.Errorf("tpm quote failed: %w", err)
 	}
 
-	tpmQuoteProto := ev.TPMQuoteAttestation{}
-
-	err = tpmQuoteProto.UnmarshalBinary(tpmQuoteEvidence.Data)
-
-	if err != nil {
-		return nil, fmt.Errorf("unmarshalling tpm quote failed: %w", err)
-	}
-
-	file, err := os.Open(tpmCfg.EventLogPath)
-	if err != nil {
-		return nil, fmt.Errorf("error opening event log: %s", tpmCfg.EventLogPath)
-	}
-	defer file.Close()
-
-	eventLogAttestor, err := attest.NewEventLogAttestor(file, tpmQuoteProto.PCRValues.ToMRs())
+	eventLogEvidence, err := eventLogPiece(tpmCfg.EventLogPath, tpmQuoteEvidence)
 	if err != nil {
-		return nil, fmt.Errorf("event log attestator construction failed: %w", err)
-	}
-
-	eventLogEvidence, err := eventLogAttestor.CreateSignedEvidence(context.Background())
-	if err != nil {
-		return nil, fmt.Errorf("event log attestator create signed evidence failed: %w", err)
+		return nil, err
 	}
 	result = append(result, eventLogEvidence)
 
@@ -289,7 +278,7 @@ func collectEvidence(_ *AttestationConfig, tpmCfg *TPMConfig, tpmDevice TPMDevic
 	return result, nil
 }
 
-func getTDXCollateral(teeEvidencePiece *ev.SignedEvidencePiece) (*ev.SignedEvidencePiece, error) {
+func getTDXCollateral(teeEvidencePiece *ev.SignedEvidencePiece, getter trust.HTTPSGetter) (*ev.SignedEvidencePiece, error) {
 	quote, err := abi.QuoteToProto(teeEvidencePiece.Data)
 
 	if err != nil {
@@ -308,7 +297,7 @@ func getTDXCollateral(teeEvidencePiece *ev.SignedEvidencePiece) (*ev.SignedEvide
 	}
 
 	collateralAttestor, err := attest.NewTDXCollateralAttestor(
-		&trust.SimpleHTTPSGetter{},
+		getter,
 		chain.PCKCertificate,
 	)
 	if err != nil {
@@ -0,0 +1,120 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeboot
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/google/go-tpm/tpm2"
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// DefaultEvidencePCR is the PCR the labelled evidence pieces are extended into. It must not be one
+// of the PCRs the REK is bound to, it is extended after the REK was created.
+const DefaultEvidencePCR uint32 = 15
+
+// BindLabelledPieces extends pcr with the binding marker and the digests of the labelled pieces of
+// list, in evidence order, and returns the evidence binding piece with a quote of pcr and the PCRs
+// the REK is bound to by the attestation key. The quote commits to the REK and the TPM quote of
+// list. This runs on every attestation, so the pieces of a re-attestation are extended after the
+// ones of earlier attestations.
+func BindLabelledPieces(tpmDevice TPMDevice, akHandle uint32, pcr uint32, list ev.SignedEvidenceList) (*ev.SignedEvidencePiece, error) {
+	if pcr == 0 {
+		pcr = DefaultEvidencePCR
+	}
+	pcrs, err := rcevidence.BindingPCRs(pcr)
+	if err != nil {
+		return nil, err
+	}
+
+	var rek, quote *ev.SignedEvidencePiece
+	for _, piece := range list {
+		switch piece.Type { //nolint:exhaustive
+		case ev.TpmtPublic:
+			rek = piece
+		case ev.TpmQuote:
+			quote = piece
+		default:
+		}
+	}
+	if rek == nil || quote == nil {
+		return nil, errors.New("evidence has no rek or tpm quote to bind the labelled pieces to")
+	}
+
+	thetpm, err := tpmDevice.OpenDevice()
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to TPM: %w", err)
+	}
+
+	read, err := tpm2.PCRRead{PCRSelectionIn: rcevidence.PCRSelection([]uint32{pcr})}.Execute(thetpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pcr %d: %w", pcr, err)
+	}
+	if len(read.PCRValues.Digests) != 1 {
+		return nil, fmt.Errorf("failed to read pcr %d: got %d values", pcr, len(read.PCRValues.Digests))
+	}
+	initial := read.PCRValues.Digests[0].Buffer
+
+	if err := extendPCR(thetpm, pcr, rcevidence.BindingMarker()); err != nil {
+		return nil, fmt.Errorf("failed to extend pcr %d with the binding marker: %w", pcr, err)
+	}
+	count := 0
+	for _, piece := range list {
+		if !rcevidence.IsLabelledPiece(piece) {
+			continue
+		}
+		if err := extendPCR(thetpm, pcr, rcevidence.LabelledPieceDigest(piece)); err != nil {
+			return nil, fmt.Errorf("failed to extend pcr %d with a labelled piece: %w", pcr, err)
+		}
+		count++
+	}
+
+	pub, err := tpm2.ReadPublic{ObjectHandle: tpm2.TPMHandle(akHandle)}.Execute(thetpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attestation key: %w", err)
+	}
+	akPublic, err := pub.OutPublic.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attestation key public area: %w", err)
+	}
+
+	rsp, err := tpm2.Quote{
+		SignHandle: tpm2.AuthHandle{
+			Handle: tpm2.TPMHandle(akHandle),
+			Name:   pub.Name,
+			Auth:   tpm2.PasswordAuth(nil),
+		},
+		QualifyingData: tpm2.TPM2BData{Buffer: rcevidence.BindingExtraData(rek.Data, quote.Data)},
+		InScheme:       tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgNull},
+		PCRSelect:      rcevidence.PCRSelection(pcrs),
+	}.Execute(thetpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to quote pcr %d: %w", pcr, err)
+	}
+
+	slog.Info("Bound labelled evidence pieces", "pcr", pcr, "pieces", count)
+	return rcevidence.EvidenceBindingPiece(rcevidence.EvidenceBinding{
+		PCR:       pcr,
+		Initial:   initial,
+		AKPublic:  tpm2.Marshal(akPublic),
+		Quote:     rsp.Quoted.Bytes(),
+		Signature: tpm2.Marshal(rsp.Signature),
+	})
+}
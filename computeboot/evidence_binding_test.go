@@ -0,0 +1,109 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeboot
+
+import (
+	"testing"
+
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/google/go-tpm/tpm2"
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+// createTestAK creates a restricted signing key like an attestation key and returns its handle and
+// marshalled public area.
+func createTestAK(t *testing.T, device TPMDevice) (uint32, []byte) {
+	t.Helper()
+	thetpm, err := device.OpenDevice()
+	require.NoError(t, err)
+
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic: tpm2.New2B(tpm2.TPMTPublic{
+			Type:    tpm2.TPMAlgECC,
+			NameAlg: tpm2.TPMAlgSHA256,
+			ObjectAttributes: tpm2.TPMAObject{
+				SignEncrypt:         true,
+				Restricted:          true,
+				FixedTPM:            true,
+				FixedParent:         true,
+				SensitiveDataOrigin: true,
+				UserWithAuth:        true,
+				NoDA:                true,
+			},
+			Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &tpm2.TPMSECCParms{
+				Scheme: tpm2.TPMTECCScheme{
+					Scheme:  tpm2.TPMAlgECDSA,
+					Details: tpm2.NewTPMUAsymScheme(tpm2.TPMAlgECDSA, &tpm2.TPMSSigSchemeECDSA{HashAlg: tpm2.TPMAlgSHA256}),
+				},
+				CurveID: tpm2.TPMECCNistP256,
+			}),
+		}),
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	outPublic, err := rsp.OutPublic.Contents()
+	require.NoError(t, err)
+	return uint32(rsp.ObjectHandle), tpm2.Marshal(outPublic)
+}
+
+func TestBindLabelledPieces(t *testing.T) {
+	device := NewTPMInMemorySimulator()
+	defer device.Close()
+	akHandle, akPublic := createTestAK(t, device)
+
+	rek := &ev.SignedEvidencePiece{Type: ev.TpmtPublic, Data: []byte("rek")}
+	quote := &ev.SignedEvidencePiece{Type: ev.TpmQuote, Data: []byte("quote")}
+	maintenance, err := rcevidence.MaintenancePiece(rcevidence.Maintenance{Reason: "INC-1234"})
+	require.NoError(t, err)
+	list := ev.SignedEvidenceList{
+		{Type: ev.AkTPMTPublic, Data: akPublic},
+		rek,
+		quote,
+		rcevidence.CPUOnlyPiece(),
+		maintenance,
+	}
+
+	// the pcr values the tpm quote of the evidence would carry.
+	thetpm, err := device.OpenDevice()
+	require.NoError(t, err)
+	pcrValues := map[uint32][]byte{}
+	for _, pcr := range ev.AttestPCRSelection {
+		rsp, err := tpm2.PCRRead{PCRSelectionIn: rcevidence.PCRSelection([]uint32{uint32(pcr)})}.Execute(thetpm)
+		require.NoError(t, err)
+		require.Len(t, rsp.PCRValues.Digests, 1)
+		pcrValues[uint32(pcr)] = rsp.PCRValues.Digests[0].Buffer
+	}
+
+	t.Run("ok, every attestation binds its pieces", func(t *testing.T) {
+		for range 2 {
+			binding, err := BindLabelledPieces(device, akHandle, 0, list)
+			require.NoError(t, err)
+			require.NoError(t, rcevidence.VerifyEvidenceBinding(append(list, binding), rek, quote, pcrValues))
+		}
+	})
+
+	t.Run("fail, pcr is bound to the rek", func(t *testing.T) {
+		_, err := BindLabelledPieces(device, akHandle, uint32(ev.AttestPCRSelection[len(ev.AttestPCRSelection)-1]), list)
+		require.Error(t, err)
+	})
+
+	t.Run("fail, no tpm quote", func(t *testing.T) {
+		_, err := BindLabelledPieces(device, akHandle, 0, list[:2])
+		require.Error(t, err)
+	})
+}
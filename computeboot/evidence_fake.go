@@ -29,8 +29,10 @@ import (
 	ev "github.com/openpcc/openpcc/attestation/evidence"
 )
 
-// collectEvidence collects fake evidence. It only uses some of the TPM evidence.
-func collectEvidence(cfg *AttestationConfig, tpmCfg *TPMConfig, tpmDevice TPMDevice, _ GPUManager, _ *TransparencyConfig) (ev.SignedEvidenceList, error) {
+// collectEvidence collects fake evidence. The TEE evidence is replaced by a fake piece, the other
+// pieces are collected like production evidence, so the evidence has the same structure. Without an
+// image sigstore bundle a placeholder is used, the event log is only included when configured.
+func collectEvidence(cfg *AttestationConfig, tpmCfg *TPMConfig, tpmDevice TPMDevice, gpuManager GPUManager, tlogCfg *TransparencyConfig) (ev.SignedEvidenceList, error) {
 	// collect fake evidence if configured for it.
 	slog.Info("INSECURE WARNING: using fake attestation, not for production use!")
 
@@ -90,5 +92,31 @@ func collectEvidence(cfg *AttestationConfig, tpmCfg *TPMConfig, tpmDevice TPMDev
 	}
 	result = append(result, fakeEvidence)
 
+	// Piece 6: GPU evidence, from the same GPU manager as production.
+	gpuEvidence, err := gpuManager.GetAttestationEvidenceList(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attestation evidence: %w", err)
+	}
+	result = append(result, gpuEvidence...)
+
+	// Piece 7: Image sigstore bundle.
+	sigstoreBundle := &ev.SignedEvidencePiece{Type: ev.ImageSigstoreBundle, Data: []byte{}, Signature: []byte{}}
+	if tlogCfg != nil && tlogCfg.ImageSigstoreBundle != "" {
+		sigstoreBundle, err = sigstoreBundlePiece(tlogCfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	result = append(result, sigstoreBundle)
+
+	// Piece 8: Event log, simulated TPMs usually have none.
+	if tpmCfg.EventLogPath != "" {
+		eventLogEvidence, err := eventLogPiece(tpmCfg.EventLogPath, tpmQuoteEvidence)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, eventLogEvidence)
+	}
+
 	return result, nil
 }
@@ -0,0 +1,75 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/openpcc/openpcc/attestation/attest"
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// The pieces below are collected the same way with and without fake attestation, so fake evidence has
+// the structure of production evidence.
+
+// sigstoreBundlePiece returns the image sigstore bundle of the transparency config as an evidence piece.
+func sigstoreBundlePiece(tlogCfg *TransparencyConfig) (*ev.SignedEvidencePiece, error) {
+	if tlogCfg == nil || tlogCfg.ImageSigstoreBundle == "" {
+		return nil, errors.New("no image sigstore bundle provided")
+	}
+
+	decodedBundle, err := base64.StdEncoding.DecodeString(tlogCfg.ImageSigstoreBundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to base64 decode image sigstore bundle: %w", err)
+	}
+
+	return &ev.SignedEvidencePiece{
+		Type:      ev.ImageSigstoreBundle,
+		Data:      decodedBundle,
+		Signature: []byte{},
+	}, nil
+}
+
+// eventLogPiece attests the event log at path against the PCR values of the TPM quote evidence.
+func eventLogPiece(path string, tpmQuoteEvidence *ev.SignedEvidencePiece) (*ev.SignedEvidencePiece, error) {
+	tpmQuoteProto := ev.TPMQuoteAttestation{}
+	if err := tpmQuoteProto.UnmarshalBinary(tpmQuoteEvidence.Data); err != nil {
+		return nil, fmt.Errorf("unmarshalling tpm quote failed: %w", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening event log: %s", path)
+	}
+	defer file.Close()
+
+	eventLogAttestor, err := attest.NewEventLogAttestor(file, tpmQuoteProto.PCRValues.ToMRs())
+	if err != nil {
+		return nil, fmt.Errorf("event log attestator construction failed: %w", err)
+	}
+
+	eventLogEvidence, err := eventLogAttestor.CreateSignedEvidence(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("event log attestator create signed evidence failed: %w", err)
+	}
+	return eventLogEvidence, nil
+}
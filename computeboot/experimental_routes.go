@@ -0,0 +1,56 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeboot
+
+import (
+	"github.com/confidentsecurity/confidentcompute/experimental"
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+)
+
+// ExperimentalRoutesConfig is config for the experimental routes compute_worker serves. The routes
+// are disclosed in the evidence, and compute_boot refuses them unless it was built with the
+// experimental build tag, like compute_worker.
+type ExperimentalRoutesConfig struct {
+	// Routes are the experimental routes to enable, see experimental.Routes.
+	Routes []string `yaml:"routes"`
+	// PCR is extended with the digest of the disclosure, so it is covered by the TPM quote. Leave 0
+	// for ApplicationPCR.
+	PCR uint32 `yaml:"pcr"`
+}
+
+// Active reports whether experimental routes are enabled.
+func (c *ExperimentalRoutesConfig) Active() bool {
+	return c != nil && len(c.Routes) > 0
+}
+
+// Claim returns the disclosure of the experimental routes included in the evidence.
+func (c *ExperimentalRoutesConfig) Claim() (rcevidence.ExperimentalRoutes, error) {
+	if err := experimental.CheckBuild(c.Routes); err != nil {
+		return rcevidence.ExperimentalRoutes{}, err
+	}
+	return rcevidence.ExperimentalRoutes{Routes: c.Routes}, nil
+}
+
+// ExperimentalRoutesMeasurement returns the measurement of the digest of the experimental routes
+// disclosure for pcr.
+func ExperimentalRoutesMeasurement(pcr uint32, r rcevidence.ExperimentalRoutes) (Measurement, error) {
+	digest, err := r.Digest()
+	if err != nil {
+		return Measurement{}, err
+	}
+	return newMeasurement(pcr, "experimental routes", digest), nil
+}
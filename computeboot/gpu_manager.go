@@ -17,9 +17,63 @@
 
 package computeboot
 
+import (
+	"errors"
+	"fmt"
+)
+
 func NewGPUManager(cfg *GPUConfig) (GPUManager, error) {
+	if cfg.Azure != nil && !cfg.Required {
+		return nil, errors.New("azure gpu attestation requires a gpu")
+	}
+	if cfg.NVLinkDomain != nil && !cfg.Required {
+		return nil, errors.New("nvlink domain attestation requires a gpu")
+	}
+	if cfg.NRASOutage != nil && !cfg.Required {
+		return nil, errors.New("nras outage policy requires a gpu")
+	}
+	if cfg.Recovery != nil {
+		if !cfg.Required {
+			return nil, errors.New("gpu recovery requires a gpu")
+		}
+		if err := cfg.Recovery.validate(); err != nil {
+			return nil, fmt.Errorf("invalid gpu recovery config: %w", err)
+		}
+	}
+	if cfg.CPUOnly {
+		if cfg.Required {
+			return nil, errors.New("gpu can't be required on a cpu-only node")
+		}
+		return NewCPUOnlyGPUManager(), nil
+	}
 	if cfg.Required {
-		return NewNvidiaManager()
+		manager, err := NewNvidiaManager()
+		if err != nil {
+			return nil, err
+		}
+		manager.VersionPolicy = cfg.VersionPolicy
+		if cfg.NRASOutage != nil {
+			if err := cfg.NRASOutage.validate(); err != nil {
+				return nil, fmt.Errorf("invalid nras outage config: %w", err)
+			}
+			manager.NRASOutage = cfg.NRASOutage
+		}
+		if cfg.Azure != nil {
+			if err := cfg.Azure.validate(); err != nil {
+				return nil, fmt.Errorf("invalid azure gpu config: %w", err)
+			}
+			// azure confidential VMs always have a vTPM.
+			manager.MAAClient = NewHTTPMAAClient(cfg.Azure, NewTPMRealDevice())
+		}
+		if cfg.NVLinkDomain != nil {
+			if err := cfg.NVLinkDomain.validate(); err != nil {
+				return nil, fmt.Errorf("invalid nvlink domain config: %w", err)
+			}
+			// the switches of the domain are in other trays, out of reach of the local nscq library.
+			manager.NVLinkDomain = cfg.NVLinkDomain
+			manager.NVSwitchAdminProvider = NewNVLinkDomainSwitchAdminProvider(cfg.NVLinkDomain)
+		}
+		return manager, nil
 	}
 	return NewFakeGPUManager(), nil
 }
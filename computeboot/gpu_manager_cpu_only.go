@@ -0,0 +1,69 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// nvidiaDeviceGlob matches the device nodes of NVIDIA GPUs.
+const nvidiaDeviceGlob = "/dev/nvidia[0-9]*"
+
+// CPUOnlyGPUManager is the GPU manager of nodes that serve inference on confidential CPUs
+// without GPUs. Instead of omitting GPU evidence it yields an explicit CPU-only marker, so
+// routers can tell these nodes apart from misconfigured GPU nodes.
+type CPUOnlyGPUManager struct {
+	// DeviceGlob matches GPU device nodes, a CPU-only node must not have any.
+	DeviceGlob string
+}
+
+func NewCPUOnlyGPUManager() *CPUOnlyGPUManager {
+	return &CPUOnlyGPUManager{
+		DeviceGlob: nvidiaDeviceGlob,
+	}
+}
+
+// VerifyGPUState verifies the node has no GPUs. A GPU node configured as CPU-only would
+// otherwise serve requests without attesting its GPUs.
+func (m *CPUOnlyGPUManager) VerifyGPUState(_ context.Context) error {
+	devices, err := filepath.Glob(m.DeviceGlob)
+	if err != nil {
+		return fmt.Errorf("failed to look for gpu devices: %w", err)
+	}
+	if len(devices) > 0 {
+		return fmt.Errorf("node is configured as cpu-only but has %d gpu devices", len(devices))
+	}
+	return nil
+}
+
+func (*CPUOnlyGPUManager) EnableConfidentialCompute() error {
+	return nil
+}
+
+func (*CPUOnlyGPUManager) GetAttestationEvidenceList(_ context.Context) (ev.SignedEvidenceList, error) {
+	return ev.SignedEvidenceList{evidence.CPUOnlyPiece()}, nil
+}
+
+func (*CPUOnlyGPUManager) Topology(_ context.Context) (*GPUTopology, error) {
+	return &GPUTopology{MultiGPUMode: MultiGPUModeNone}, nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCPUOnlyGPUManager(t *testing.T) {
+	t.Run("ok, no gpu devices", func(t *testing.T) {
+		m := &CPUOnlyGPUManager{DeviceGlob: filepath.Join(t.TempDir(), "nvidia[0-9]*")}
+		require.NoError(t, m.VerifyGPUState(context.Background()))
+	})
+
+	t.Run("fail, gpu devices present", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "nvidia0"), nil, 0o600))
+		// control devices such as nvidiactl don't count as gpus.
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "nvidiactl"), nil, 0o600))
+
+		m := &CPUOnlyGPUManager{DeviceGlob: filepath.Join(dir, "nvidia[0-9]*")}
+		err := m.VerifyGPUState(context.Background())
+		require.ErrorContains(t, err, "has 1 gpu devices")
+	})
+
+	t.Run("ok, evidence contains the cpu-only marker", func(t *testing.T) {
+		list, err := NewCPUOnlyGPUManager().GetAttestationEvidenceList(context.Background())
+		require.NoError(t, err)
+		require.True(t, evidence.IsCPUOnly(list))
+	})
+}
+
+func TestNewGPUManager(t *testing.T) {
+	t.Run("ok, cpu-only", func(t *testing.T) {
+		m, err := NewGPUManager(&GPUConfig{CPUOnly: true})
+		require.NoError(t, err)
+		require.IsType(t, &CPUOnlyGPUManager{}, m)
+	})
+
+	t.Run("ok, fake when gpu is not required", func(t *testing.T) {
+		m, err := NewGPUManager(&GPUConfig{})
+		require.NoError(t, err)
+		require.IsType(t, &FakeGPUManager{}, m)
+	})
+
+	t.Run("fail, cpu-only and gpu required", func(t *testing.T) {
+		_, err := NewGPUManager(&GPUConfig{Required: true, CPUOnly: true})
+		require.Error(t, err)
+	})
+
+	t.Run("fail, azure gpu attestation without gpu", func(t *testing.T) {
+		_, err := NewGPUManager(&GPUConfig{CPUOnly: true, Azure: &AzureGPUConfig{MAAEndpoint: "https://maa.invalid"}})
+		require.Error(t, err)
+	})
+}
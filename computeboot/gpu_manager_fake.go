@@ -42,3 +42,7 @@ func (*FakeGPUManager) EnableConfidentialCompute() error {
 func (*FakeGPUManager) GetAttestationEvidenceList(_ context.Context) (ev.SignedEvidenceList, error) {
 	return ev.SignedEvidenceList{}, nil
 }
+
+func (*FakeGPUManager) Topology(_ context.Context) (*GPUTopology, error) {
+	return &GPUTopology{MultiGPUMode: MultiGPUModeNone}, nil
+}
@@ -0,0 +1,228 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeboot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// ErrGPUNotReady is returned when attested GPUs are not in the confidential compute ready state.
+var ErrGPUNotReady = errors.New("gpus are not ready for confidential computing")
+
+// DefaultGPURecoveryAttempts is how many times the GPUs are reset by default before the boot fails.
+const DefaultGPURecoveryAttempts = 1
+
+// GPURecoveryConfig allows compute_boot to reset GPUs that fail to become ready for confidential
+// computing, and to attest them again, instead of failing the boot and recreating the VM.
+type GPURecoveryConfig struct {
+	// MaxAttempts is how many times the GPUs are reset before the boot fails. Leave 0 for
+	// DefaultGPURecoveryAttempts.
+	MaxAttempts int `yaml:"max_attempts"`
+	// SettleTime is how long to wait after a reset before the GPU state is verified again.
+	SettleTime time.Duration `yaml:"settle_time"`
+}
+
+func (c *GPURecoveryConfig) validate() error {
+	if c.MaxAttempts < 0 {
+		return fmt.Errorf("invalid max attempts: %d", c.MaxAttempts)
+	}
+	if c.SettleTime < 0 {
+		return fmt.Errorf("invalid settle time: %s", c.SettleTime)
+	}
+	return nil
+}
+
+func (c *GPURecoveryConfig) maxAttempts() int {
+	if c.MaxAttempts == 0 {
+		return DefaultGPURecoveryAttempts
+	}
+	return c.MaxAttempts
+}
+
+// GPURecoverer is implemented by GPU managers that can reset their GPUs.
+type GPURecoverer interface {
+	// ResetGPUs resets the GPUs, they have to be verified and attested again afterwards.
+	ResetGPUs(ctx context.Context) error
+	// CheckReady returns an error wrapping ErrGPUNotReady when attested GPUs are not ready.
+	CheckReady() error
+}
+
+// GPUResetter resets all GPUs of the node.
+type GPUResetter interface {
+	ResetGPUs() error
+}
+
+// RecoverGPUs runs attest, which attests the GPUs and makes them ready for confidential computing,
+// and checks the GPUs are ready afterwards. When either fails and cfg allows it, the GPUs are reset,
+// their state and topology are verified again and attest is retried, so the evidence always
+// describes the GPUs after the last reset. A nil cfg disables recovery.
+func RecoverGPUs(ctx context.Context, cfg *GPURecoveryConfig, manager GPUManager, attest func(ctx context.Context) error) error {
+	recoverer, canRecover := manager.(GPURecoverer)
+	for attempt := 0; ; attempt++ {
+		err := attest(ctx)
+		if err == nil && canRecover {
+			err = recoverer.CheckReady()
+		}
+		if err == nil {
+			return nil
+		}
+		if cfg == nil || !canRecover || attempt >= cfg.maxAttempts() {
+			return err
+		}
+
+		slog.WarnContext(ctx, "GPUs failed to become ready, resetting them", "attempt", attempt+1, "error", err)
+		if err := resetGPUs(ctx, cfg, manager, recoverer); err != nil {
+			return err
+		}
+	}
+}
+
+// resetGPUs resets the GPUs and verifies them again. The topology was measured before the reset,
+// so it must not change.
+func resetGPUs(ctx context.Context, cfg *GPURecoveryConfig, manager GPUManager, recoverer GPURecoverer) error {
+	before, err := topologyDigest(ctx, manager)
+	if err != nil {
+		return err
+	}
+
+	if err := recoverer.ResetGPUs(ctx); err != nil {
+		return fmt.Errorf("failed to reset gpus: %w", err)
+	}
+
+	if cfg.SettleTime > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(cfg.SettleTime):
+		}
+	}
+
+	if err := manager.VerifyGPUState(ctx); err != nil {
+		return fmt.Errorf("gpus are not in a valid state after the reset: %w", err)
+	}
+
+	after, err := topologyDigest(ctx, manager)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(before, after) {
+		return errors.New("gpu topology changed during the reset")
+	}
+
+	slog.InfoContext(ctx, "GPUs were reset and verified")
+	return nil
+}
+
+func topologyDigest(ctx context.Context, manager GPUManager) ([]byte, error) {
+	topology, err := manager.Topology(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gpu topology: %w", err)
+	}
+	digest, err := topology.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("failed to digest gpu topology: %w", err)
+	}
+	return digest, nil
+}
+
+// ResetGPUs resets the GPUs with Resetter. The GPUs are attested again afterwards, so a node that
+// was degraded can attest them this time.
+func (n *NvidiaManager) ResetGPUs(ctx context.Context) error {
+	if n.Resetter == nil {
+		return errors.New("gpu reset is not supported")
+	}
+
+	slog.InfoContext(ctx, "Resetting GPUs")
+	if err := n.Resetter.ResetGPUs(); err != nil {
+		return err
+	}
+	n.degraded = false
+	return nil
+}
+
+// CheckReady returns an error wrapping ErrGPUNotReady when the GPUs are attested but not in the
+// ready state. The GPUs of a degraded node are never made ready.
+func (n *NvidiaManager) CheckReady() error {
+	if n.degraded {
+		return nil
+	}
+
+	ready, err := n.GPUAdmin.IsGPUReadyStateEnabled()
+	if err != nil {
+		return fmt.Errorf("failed to check if gpu ready state is enabled: %w", err)
+	}
+	if !ready {
+		return ErrGPUNotReady
+	}
+	return nil
+}
+
+// nvmlGPUResetter resets the GPUs like nvidia-smi --gpu-reset, by detaching them from the driver
+// and discovering them again, which resets their confidential compute ready state.
+type nvmlGPUResetter struct{}
+
+// NewNVMLGPUResetter returns a GPUResetter that resets the GPUs through NVML.
+func NewNVMLGPUResetter() GPUResetter {
+	return nvmlGPUResetter{}
+}
+
+func (nvmlGPUResetter) ResetGPUs() error {
+	if ret := nvml.Init(); ret != nvml.SUCCESS {
+		return fmt.Errorf("failed to initialize nvml: %w", ret)
+	}
+	defer nvml.Shutdown()
+
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return fmt.Errorf("failed to get gpu count: %w", ret)
+	}
+
+	pcis := make([]nvml.PciInfo, 0, count)
+	for i := range count {
+		device, ret := nvml.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			return fmt.Errorf("failed to get gpu %d: %w", i, ret)
+		}
+		pci, ret := device.GetPciInfo()
+		if ret != nvml.SUCCESS {
+			return fmt.Errorf("failed to get pci info of gpu %d: %w", i, ret)
+		}
+		pcis = append(pcis, pci)
+	}
+
+	for _, pci := range pcis {
+		// draining keeps the driver from handing the gpu out while it is detached.
+		if ret := nvml.DeviceModifyDrainState(&pci, nvml.FEATURE_ENABLED); ret != nvml.SUCCESS {
+			return fmt.Errorf("failed to drain gpu %s: %w", pciBusID(pci), ret)
+		}
+		if ret := nvml.DeviceRemoveGpu_v2(&pci, nvml.DETACH_GPU_REMOVE, nvml.PCIE_LINK_KEEP); ret != nvml.SUCCESS {
+			return fmt.Errorf("failed to detach gpu %s: %w", pciBusID(pci), ret)
+		}
+	}
+
+	if _, ret := nvml.DeviceDiscoverGpus(); ret != nvml.SUCCESS {
+		return fmt.Errorf("failed to discover gpus: %w", ret)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeboot
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type gpuResetterFunc func() error
+
+func (f gpuResetterFunc) ResetGPUs() error {
+	return f()
+}
+
+type topologyReaderFunc func() (*GPUTopology, error)
+
+func (f topologyReaderFunc) ReadTopology() (*GPUTopology, error) {
+	return f()
+}
+
+func TestRecoverGPUs(t *testing.T) {
+	// newManager returns a manager with a single gpu whose ready state can't be enabled until it was
+	// reset resetsNeeded times.
+	newManager := func(resetsNeeded int, topologies ...*GPUTopology) (*NvidiaManager, *int) {
+		resets := 0
+		readyState := false
+		return &NvidiaManager{
+			GPUAdmin: &MockGPUAdmin{
+				AllGPUInPersistenceModeFunc: func() (bool, error) {
+					return true, nil
+				},
+				IsGPUReadyStateEnabledFunc: func() (bool, error) {
+					return readyState, nil
+				},
+				EnableGPUReadyStateFunc: func() error {
+					readyState = resets >= resetsNeeded
+					return nil
+				},
+			},
+			TopologyReader: topologyReaderFunc(func() (*GPUTopology, error) {
+				topology := &GPUTopology{MultiGPUMode: MultiGPUModeNone, GPUs: []TopologyGPU{{PCIBusID: "00000000:01:00.0"}}}
+				if len(topologies) > 0 && resets > 0 {
+					topology = topologies[0]
+				}
+				return topology, nil
+			}),
+			Resetter: gpuResetterFunc(func() error {
+				resets++
+				readyState = false
+				return nil
+			}),
+			VerificationTimeout: 100 * time.Millisecond,
+		}, &resets
+	}
+
+	attestWith := func(manager *NvidiaManager, attests *int) func(ctx context.Context) error {
+		return func(context.Context) error {
+			*attests++
+			return manager.EnableConfidentialCompute()
+		}
+	}
+
+	t.Run("ok, ready without recovery", func(t *testing.T) {
+		manager, resets := newManager(0)
+		attests := 0
+		require.NoError(t, RecoverGPUs(t.Context(), nil, manager, attestWith(manager, &attests)))
+		require.Equal(t, 0, *resets)
+		require.Equal(t, 1, attests)
+	})
+
+	t.Run("ok, reset and attested again", func(t *testing.T) {
+		manager, resets := newManager(2)
+		attests := 0
+		err := RecoverGPUs(t.Context(), &GPURecoveryConfig{MaxAttempts: 2}, manager, attestWith(manager, &attests))
+		require.NoError(t, err)
+		require.Equal(t, 2, *resets)
+		require.Equal(t, 3, attests)
+	})
+
+	t.Run("ok, failed attestation is retried", func(t *testing.T) {
+		manager, resets := newManager(0)
+		attests := 0
+		err := RecoverGPUs(t.Context(), &GPURecoveryConfig{}, manager, func(context.Context) error {
+			attests++
+			if attests == 1 {
+				return errors.New("failed to enable confidential compute")
+			}
+			return manager.EnableConfidentialCompute()
+		})
+		require.NoError(t, err)
+		require.Equal(t, 1, *resets)
+		require.Equal(t, 2, attests)
+	})
+
+	t.Run("fail, recovery disabled", func(t *testing.T) {
+		manager, resets := newManager(1)
+		attests := 0
+		err := RecoverGPUs(t.Context(), nil, manager, attestWith(manager, &attests))
+		require.ErrorIs(t, err, ErrGPUNotReady)
+		require.Equal(t, 0, *resets)
+	})
+
+	t.Run("fail, out of attempts", func(t *testing.T) {
+		manager, resets := newManager(3)
+		attests := 0
+		err := RecoverGPUs(t.Context(), &GPURecoveryConfig{MaxAttempts: 2}, manager, attestWith(manager, &attests))
+		require.ErrorIs(t, err, ErrGPUNotReady)
+		require.Equal(t, 2, *resets)
+		require.Equal(t, 3, attests)
+	})
+
+	t.Run("fail, topology changed during reset", func(t *testing.T) {
+		changed := &GPUTopology{MultiGPUMode: MultiGPUModeNone, GPUs: []TopologyGPU{{PCIBusID: "00000000:02:00.0"}}}
+		manager, _ := newManager(1, changed)
+		attests := 0
+		err := RecoverGPUs(t.Context(), &GPURecoveryConfig{}, manager, attestWith(manager, &attests))
+		require.ErrorContains(t, err, "gpu topology changed")
+		require.Equal(t, 1, attests)
+	})
+
+	t.Run("fail, reset not supported", func(t *testing.T) {
+		manager, _ := newManager(1)
+		manager.Resetter = nil
+		attests := 0
+		err := RecoverGPUs(t.Context(), &GPURecoveryConfig{}, manager, attestWith(manager, &attests))
+		require.ErrorContains(t, err, "gpu reset is not supported")
+	})
+
+	t.Run("ok, degraded gpus are not made ready", func(t *testing.T) {
+		manager, resets := newManager(1)
+		manager.degraded = true
+		attests := 0
+		require.NoError(t, RecoverGPUs(t.Context(), &GPURecoveryConfig{}, manager, attestWith(manager, &attests)))
+		require.Equal(t, 0, *resets)
+	})
+}
@@ -0,0 +1,129 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"fmt"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+)
+
+// GPUVersionPolicy are the minimum GPU driver and firmware versions a node must run, so nodes
+// with stale drivers fail at boot instead of serving requests. Leave a version blank to not
+// enforce it. Versions are compared with rcevidence.CompareVersions.
+type GPUVersionPolicy struct {
+	// MinDriverVersion is the minimum NVIDIA driver version, e.g. 550.90.07.
+	MinDriverVersion string `yaml:"min_driver_version"`
+	// MinVBIOSVersion is the minimum VBIOS version of every GPU, e.g. 96.00.74.00.1C.
+	MinVBIOSVersion string `yaml:"min_vbios_version"`
+	// MinCCFirmwareVersion is the minimum GSP firmware version of every GPU.
+	MinCCFirmwareVersion string `yaml:"min_cc_firmware_version"`
+}
+
+// Check returns an error if versions don't meet the policy.
+func (p GPUVersionPolicy) Check(versions *rcevidence.GPUVersions) error {
+	if err := checkMinVersion("driver", versions.DriverVersion, p.MinDriverVersion); err != nil {
+		return err
+	}
+
+	for _, gpu := range versions.GPUs {
+		if err := checkMinVersion("vbios", gpu.VBIOSVersion, p.MinVBIOSVersion); err != nil {
+			return fmt.Errorf("gpu %s: %w", gpu.UUID, err)
+		}
+		if err := checkMinVersion("cc firmware", gpu.CCFirmwareVersion, p.MinCCFirmwareVersion); err != nil {
+			return fmt.Errorf("gpu %s: %w", gpu.UUID, err)
+		}
+	}
+
+	return nil
+}
+
+func checkMinVersion(name, version, minVersion string) error {
+	if minVersion == "" {
+		return nil
+	}
+
+	cmp, err := rcevidence.CompareVersions(version, minVersion)
+	if err != nil {
+		return fmt.Errorf("failed to compare %s version: %w", name, err)
+	}
+	if cmp < 0 {
+		return fmt.Errorf("%s version %s is older than the minimum version %s", name, version, minVersion)
+	}
+	return nil
+}
+
+// GPUVersionReader reads the GPU driver and firmware versions of the system.
+type GPUVersionReader interface {
+	ReadVersions() (*rcevidence.GPUVersions, error)
+}
+
+// nvmlVersionReader reads the versions using NVML.
+type nvmlVersionReader struct{}
+
+func (nvmlVersionReader) ReadVersions() (*rcevidence.GPUVersions, error) {
+	if ret := nvml.Init(); ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to initialize nvml: %w", ret)
+	}
+	defer nvml.Shutdown()
+
+	driverVersion, ret := nvml.SystemGetDriverVersion()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get driver version: %w", ret)
+	}
+
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get gpu count: %w", ret)
+	}
+
+	versions := &rcevidence.GPUVersions{
+		DriverVersion: driverVersion,
+		GPUs:          make([]rcevidence.GPUFirmwareInfo, 0, count),
+	}
+	for i := range count {
+		device, ret := nvml.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("failed to get gpu %d: %w", i, ret)
+		}
+
+		uuid, ret := device.GetUUID()
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("failed to get uuid of gpu %d: %w", i, ret)
+		}
+
+		vbiosVersion, ret := device.GetVbiosVersion()
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("failed to get vbios version of gpu %d: %w", i, ret)
+		}
+
+		gspVersion, ret := device.GetGspFirmwareVersion()
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("failed to get gsp firmware version of gpu %d: %w", i, ret)
+		}
+
+		versions.GPUs = append(versions.GPUs, rcevidence.GPUFirmwareInfo{
+			UUID:              uuid,
+			VBIOSVersion:      vbiosVersion,
+			CCFirmwareVersion: gspVersion,
+		})
+	}
+
+	return versions, nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"testing"
+
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+type mockVersionReader struct {
+	versions *rcevidence.GPUVersions
+	err      error
+}
+
+func (m mockVersionReader) ReadVersions() (*rcevidence.GPUVersions, error) {
+	return m.versions, m.err
+}
+
+func TestGPUVersionPolicyCheck(t *testing.T) {
+	versions := &rcevidence.GPUVersions{
+		DriverVersion: "550.90.07",
+		GPUs: []rcevidence.GPUFirmwareInfo{
+			{UUID: "GPU-1", VBIOSVersion: "96.00.74.00.1C", CCFirmwareVersion: "550.90.07"},
+			{UUID: "GPU-2", VBIOSVersion: "96.00.74.00.0A", CCFirmwareVersion: "550.90.07"},
+		},
+	}
+
+	testCases := []struct {
+		name    string
+		policy  GPUVersionPolicy
+		wantErr string
+	}{
+		{
+			name:   "ok, empty policy",
+			policy: GPUVersionPolicy{},
+		},
+		{
+			name: "ok, versions meet the policy",
+			policy: GPUVersionPolicy{
+				MinDriverVersion:     "550.90.07",
+				MinVBIOSVersion:      "96.00.74.00.01",
+				MinCCFirmwareVersion: "550.54.15",
+			},
+		},
+		{
+			name:    "fail, stale driver",
+			policy:  GPUVersionPolicy{MinDriverVersion: "570.86.15"},
+			wantErr: "driver version 550.90.07 is older than the minimum version 570.86.15",
+		},
+		{
+			name:    "fail, stale vbios on one gpu",
+			policy:  GPUVersionPolicy{MinVBIOSVersion: "96.00.74.00.10"},
+			wantErr: "gpu GPU-2: vbios version 96.00.74.00.0A is older than the minimum version 96.00.74.00.10",
+		},
+		{
+			name:    "fail, stale cc firmware",
+			policy:  GPUVersionPolicy{MinCCFirmwareVersion: "550.90.12"},
+			wantErr: "gpu GPU-1: cc firmware version 550.90.07 is older than the minimum version 550.90.12",
+		},
+		{
+			name:    "fail, invalid minimum version",
+			policy:  GPUVersionPolicy{MinDriverVersion: "latest"},
+			wantErr: "failed to compare driver version",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.policy.Check(versions)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
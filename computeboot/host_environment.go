@@ -0,0 +1,154 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+)
+
+// HostEnvironmentConfig is config for attesting to the kernel lockdown, IOMMU and memory encryption
+// state of the node, so verifiers can reject nodes running with DMA protection disabled.
+type HostEnvironmentConfig struct {
+	// PCR is extended with the digest of the host environment. Leave 0 for ApplicationPCR.
+	PCR uint32 `yaml:"pcr"`
+}
+
+// memoryEncryptionFlags are the /proc/cpuinfo flags included in the host environment.
+var memoryEncryptionFlags = []string{"sme", "sev", "sev_es", "sev_snp"}
+
+var (
+	lockdownFile = "/sys/kernel/security/lockdown"
+	iommuDir     = "/sys/class/iommu"
+	cpuinfoFile  = "/proc/cpuinfo"
+	cmdlineFile  = "/proc/cmdline"
+)
+
+// ReadHostEnvironment reads the kernel lockdown mode, the active IOMMUs, the memory encryption
+// flags of the CPU and the kernel command line.
+func ReadHostEnvironment() (rcevidence.HostEnvironment, error) {
+	lockdown, err := readLockdown()
+	if err != nil {
+		return rcevidence.HostEnvironment{}, err
+	}
+
+	iommus, err := readIOMMUs()
+	if err != nil {
+		return rcevidence.HostEnvironment{}, err
+	}
+
+	flags, err := readMemoryEncryptionFlags()
+	if err != nil {
+		return rcevidence.HostEnvironment{}, err
+	}
+
+	cmdline, err := os.ReadFile(cmdlineFile)
+	if err != nil {
+		return rcevidence.HostEnvironment{}, fmt.Errorf("failed to read kernel command line: %w", err)
+	}
+
+	return rcevidence.HostEnvironment{
+		Lockdown:      lockdown,
+		IOMMUs:        iommus,
+		CPUFlags:      flags,
+		KernelCmdline: strings.TrimSpace(string(cmdline)),
+	}, nil
+}
+
+// readLockdown returns the active lockdown mode, the one in brackets, e.g. "none [integrity] confidentiality".
+func readLockdown() (string, error) {
+	data, err := os.ReadFile(lockdownFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read kernel lockdown mode: %w", err)
+	}
+
+	for _, mode := range strings.Fields(string(data)) {
+		if active, ok := strings.CutPrefix(mode, "["); ok {
+			return strings.TrimSuffix(active, "]"), nil
+		}
+	}
+	return "", fmt.Errorf("no active kernel lockdown mode in %q", strings.TrimSpace(string(data)))
+}
+
+func readIOMMUs() ([]string, error) {
+	entries, err := os.ReadDir(iommuDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read iommu devices: %w", err)
+	}
+
+	iommus := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		iommus = append(iommus, entry.Name())
+	}
+	return iommus, nil
+}
+
+// readMemoryEncryptionFlags returns the memory encryption flags of the first CPU, in the order of
+// memoryEncryptionFlags.
+func readMemoryEncryptionFlags() ([]string, error) {
+	data, err := os.ReadFile(cpuinfoFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cpuinfo: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(key) != "flags" {
+			continue
+		}
+
+		cpuFlags := strings.Fields(value)
+		flags := []string{}
+		for _, flag := range memoryEncryptionFlags {
+			if slices.Contains(cpuFlags, flag) {
+				flags = append(flags, flag)
+			}
+		}
+		return flags, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse cpuinfo: %w", err)
+	}
+	return nil, errors.New("no cpu flags in cpuinfo")
+}
+
+// HostEnvironmentMeasurement returns the measurement of the digest of the host environment for pcr,
+// so it is covered by the TPM quote.
+func HostEnvironmentMeasurement(pcr uint32, env rcevidence.HostEnvironment) (Measurement, error) {
+	digest, err := env.Digest()
+	if err != nil {
+		return Measurement{}, err
+	}
+	return newMeasurement(pcr, "host environment", digest), nil
+}
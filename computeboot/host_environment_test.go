@@ -0,0 +1,127 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/google/go-tpm/tpm2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadHostEnvironment(t *testing.T) {
+	// setFiles points the host environment files at a temp dir, empty contents leave a file out.
+	setFiles := func(t *testing.T, lockdown, cpuinfo, cmdline string, iommus ...string) {
+		dir := t.TempDir()
+		write := func(name, content string) string {
+			path := filepath.Join(dir, name)
+			if content != "" {
+				require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+			}
+			return path
+		}
+
+		origLockdown, origIOMMU, origCPUInfo, origCmdline := lockdownFile, iommuDir, cpuinfoFile, cmdlineFile
+		t.Cleanup(func() {
+			lockdownFile, iommuDir, cpuinfoFile, cmdlineFile = origLockdown, origIOMMU, origCPUInfo, origCmdline
+		})
+
+		lockdownFile = write("lockdown", lockdown)
+		cpuinfoFile = write("cpuinfo", cpuinfo)
+		cmdlineFile = write("cmdline", cmdline)
+		iommuDir = filepath.Join(dir, "iommu")
+		for _, iommu := range iommus {
+			require.NoError(t, os.MkdirAll(filepath.Join(iommuDir, iommu), 0o700))
+		}
+	}
+
+	const cpuinfo = "processor\t: 0\nflags\t\t: fpu vme sev_snp sme sev sev_es avx2\n\nprocessor\t: 1\nflags\t\t: fpu\n"
+
+	t.Run("ok, read host environment", func(t *testing.T) {
+		setFiles(t, "none [integrity] confidentiality\n", cpuinfo, "console=ttyS0 lockdown=integrity\n", "ivhd1", "ivhd0")
+
+		env, err := ReadHostEnvironment()
+		require.NoError(t, err)
+		require.Equal(t, rcevidence.HostEnvironment{
+			Lockdown:      "integrity",
+			IOMMUs:        []string{"ivhd0", "ivhd1"},
+			CPUFlags:      []string{"sme", "sev", "sev_es", "sev_snp"},
+			KernelCmdline: "console=ttyS0 lockdown=integrity",
+		}, env)
+		require.True(t, env.DMAProtected())
+	})
+
+	t.Run("ok, no lockdown support and no iommu", func(t *testing.T) {
+		setFiles(t, "", "flags\t: fpu\n", "console=ttyS0")
+
+		env, err := ReadHostEnvironment()
+		require.NoError(t, err)
+		require.Empty(t, env.Lockdown)
+		require.Empty(t, env.IOMMUs)
+		require.Empty(t, env.CPUFlags)
+		require.False(t, env.DMAProtected())
+	})
+
+	t.Run("fail, no cpu flags", func(t *testing.T) {
+		setFiles(t, "[none] integrity confidentiality", "processor\t: 0\n", "console=ttyS0")
+
+		_, err := ReadHostEnvironment()
+		require.Error(t, err)
+	})
+}
+
+func TestMeasureHostEnvironment(t *testing.T) {
+	device := NewTPMInMemorySimulator()
+	defer device.Close()
+
+	pcr := attestedPCR(t)
+	env := rcevidence.HostEnvironment{
+		Lockdown:      "integrity",
+		IOMMUs:        []string{"ivhd0"},
+		CPUFlags:      []string{"sev", "sev_es", "sev_snp"},
+		KernelCmdline: "console=ttyS0",
+	}
+	m, err := HostEnvironmentMeasurement(pcr, env)
+	require.NoError(t, err)
+	require.NoError(t, ExtendMeasurements(device, []Measurement{m}))
+
+	thetpm, err := device.OpenDevice()
+	require.NoError(t, err)
+
+	rsp, err := tpm2.PCRRead{
+		PCRSelectionIn: tpm2.TPMLPCRSelection{
+			PCRSelections: []tpm2.TPMSPCRSelection{
+				{
+					Hash:      tpm2.TPMAlgSHA256,
+					PCRSelect: tpm2.PCClientCompatible.PCRs(uint(pcr)),
+				},
+			},
+		},
+	}.Execute(thetpm)
+	require.NoError(t, err)
+	require.Len(t, rsp.PCRValues.Digests, 1)
+
+	digest, err := env.Digest()
+	require.NoError(t, err)
+	want := sha256.Sum256(append(make([]byte, sha256.Size), digest...))
+	require.Equal(t, want[:], rsp.PCRValues.Digests[0].Buffer)
+}
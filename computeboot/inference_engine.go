@@ -45,14 +45,44 @@ type InferenceEngineConfig struct {
 	LocalDev bool `yaml:"local_dev"`
 	// name of the systemd service that the inference engine is running in
 	SystemdServiceName string `yaml:"systemd_service_name"`
+	// PrewarmOrder is the order in which models are prewarmed, either "config" (default) or "largest_first".
+	PrewarmOrder PrewarmOrder `yaml:"prewarm_order"`
+	// PrewarmConcurrency is the number of models that are prewarmed in parallel. Defaults to 1.
+	PrewarmConcurrency int `yaml:"prewarm_concurrency"`
+	// ModelSizes is the estimated GPU memory in bytes each model requires once loaded.
+	ModelSizes map[string]uint64 `yaml:"model_sizes"`
+	// GPUMemoryBytes is the GPU memory available to models. Models that don't fit are not
+	// prewarmed and reported as cold. Leave 0 to prewarm all models.
+	GPUMemoryBytes uint64 `yaml:"gpu_memory_bytes"`
+	// ModelStateFile is where the warm/cold state of each model is written for router_com.
+	// Leave blank for the default.
+	ModelStateFile string `yaml:"model_state_file"`
+	// Artifacts are model files that are downloaded and verified before the inference engine is initialized.
+	Artifacts []ModelArtifact `yaml:"artifacts"`
+	// ArtifactPCR is the PCR that is extended with the digests of the artifacts. It must be part
+	// of the attested PCR selection so the digests are covered by the TPM quote, see
+	// ValidateMeasurementPCR. Leave 0 for ApplicationPCR.
+	ArtifactPCR uint32 `yaml:"artifact_pcr"`
+	// Benchmark runs a short benchmark against every warm model after prewarming, the results are
+	// advertised to the router. Leave blank to skip the benchmark.
+	Benchmark *BenchmarkConfig `yaml:"benchmark"`
+	// SleepMode puts vLLM models to sleep after the benchmark, they are woken up by the first request
+	// for them. Leave blank to keep all models awake.
+	SleepMode *SleepModeConfig `yaml:"sleep_mode"`
 }
 
 type InferenceEngineInitializer struct {
-	httpClient  *http.Client
-	engineType  string
-	models      []string
-	engineURL   string
-	serviceName string
+	httpClient         *http.Client
+	engineType         string
+	models             []string
+	engineURL          string
+	serviceName        string
+	prewarmOrder       PrewarmOrder
+	prewarmConcurrency int
+	modelSizes         map[string]uint64
+	gpuMemoryBytes     uint64
+	benchmark          *BenchmarkConfig
+	sleepMode          *SleepModeConfig
 }
 
 func NewInferenceEngineInitializerWithConfig(cfg *InferenceEngineConfig) *InferenceEngineInitializer {
@@ -61,10 +91,16 @@ func NewInferenceEngineInitializerWithConfig(cfg *InferenceEngineConfig) *Infere
 			Timeout:   10 * time.Minute, // have at least some timeout.
 			Transport: otelutil.NewTransport(http.DefaultTransport),
 		},
-		engineType:  cfg.Type,
-		models:      cfg.Models,
-		engineURL:   cfg.URL,
-		serviceName: cfg.SystemdServiceName,
+		engineType:         cfg.Type,
+		models:             cfg.Models,
+		engineURL:          cfg.URL,
+		serviceName:        cfg.SystemdServiceName,
+		prewarmOrder:       cfg.PrewarmOrder,
+		prewarmConcurrency: cfg.PrewarmConcurrency,
+		modelSizes:         cfg.ModelSizes,
+		gpuMemoryBytes:     cfg.GPUMemoryBytes,
+		benchmark:          cfg.Benchmark,
+		sleepMode:          cfg.SleepMode,
 	}
 }
 
@@ -140,7 +176,7 @@ func (eng *InferenceEngineInitializer) PrewarmModel(ctx context.Context, model s
 		return err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, eng.engineURL+"/v1/completions", bytes.NewBuffer(rawBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, eng.modelURL(model)+"/v1/completions", bytes.NewBuffer(rawBody))
 	if err != nil {
 		return err
 	}
@@ -160,13 +196,3 @@ func (eng *InferenceEngineInitializer) PrewarmModel(ctx context.Context, model s
 	slog.InfoContext(ctx, "Successfully prewarmed model", "model", model)
 	return nil
 }
-
-func (eng *InferenceEngineInitializer) Prewarm(ctx context.Context) error {
-	for _, model := range eng.models {
-		err := eng.PrewarmModel(ctx, model)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
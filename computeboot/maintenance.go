@@ -0,0 +1,54 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+)
+
+// MaintenanceConfig is config for booting a node in maintenance mode. The node discloses maintenance
+// mode in its evidence and router_com refuses all confidential requests, so operators can run
+// diagnostics without risking plaintext exposure.
+type MaintenanceConfig struct {
+	// Enabled boots the node in maintenance mode.
+	Enabled bool `yaml:"enabled"`
+	// Reason is included in the evidence, e.g. an incident ID. It must not contain client data.
+	Reason string `yaml:"reason"`
+	// PCR is extended with the digest of the maintenance claim, so the claim is covered by the TPM
+	// quote. Leave 0 for ApplicationPCR.
+	PCR uint32 `yaml:"pcr"`
+}
+
+// Active reports whether the node boots in maintenance mode.
+func (c *MaintenanceConfig) Active() bool {
+	return c != nil && c.Enabled
+}
+
+// Claim returns the maintenance claim included in the evidence.
+func (c *MaintenanceConfig) Claim() rcevidence.Maintenance {
+	return rcevidence.Maintenance{Reason: c.Reason}
+}
+
+// MaintenanceMeasurement returns the measurement of the digest of the maintenance claim for pcr.
+func MaintenanceMeasurement(pcr uint32, m rcevidence.Maintenance) (Measurement, error) {
+	digest, err := m.Digest()
+	if err != nil {
+		return Measurement{}, err
+	}
+	return newMeasurement(pcr, "maintenance mode", digest), nil
+}
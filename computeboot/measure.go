@@ -0,0 +1,99 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// resettablePCRs are the PCRs that can be reset without a reboot, a measurement in them proves nothing.
+var resettablePCRs = []uint32{16, 23}
+
+// MeasurementPCR returns the PCR a measurement configured with pcr goes into. Every measurement of
+// compute_boot that doesn't name a PCR goes into ApplicationPCR.
+func MeasurementPCR(pcr uint32) uint32 {
+	if pcr == 0 {
+		return ApplicationPCR
+	}
+	return pcr
+}
+
+// ValidateMeasurementPCR returns an error if measurements configured with pcr would not be covered
+// by the TPM quote. The PCR has to be attested, can't be measured by the boot chain and can't be
+// resettable.
+func ValidateMeasurementPCR(pcr uint32) error {
+	pcr = MeasurementPCR(pcr)
+	if pcr < bootChainPCRs {
+		return fmt.Errorf("pcr %d is measured by the boot chain", pcr)
+	}
+	if slices.Contains(resettablePCRs, pcr) {
+		return fmt.Errorf("pcr %d is resettable", pcr)
+	}
+	for _, attested := range ev.AttestPCRSelection {
+		if uint64(attested) == uint64(pcr) {
+			return nil
+		}
+	}
+	return fmt.Errorf("pcr %d is not in the attested pcr selection", pcr)
+}
+
+// Measurement is a digest to extend into a PCR. Measurements are collected without touching the TPM,
+// so fetching and verifying what is measured can be retried within a boot, only ExtendMeasurements
+// can't run twice.
+type Measurement struct {
+	// PCR is the PCR the digest goes into, see MeasurementPCR.
+	PCR uint32 `json:"pcr"`
+	// Name describes what was measured.
+	Name   string `json:"name"`
+	Digest []byte `json:"digest"`
+}
+
+func newMeasurement(pcr uint32, name string, digest []byte) Measurement {
+	return Measurement{
+		PCR:    MeasurementPCR(pcr),
+		Name:   name,
+		Digest: digest,
+	}
+}
+
+// ExtendMeasurements extends the PCR of every measurement with its digest. Measurements must be
+// extended before the encryption keys are created, as the request encryption key is bound to the
+// PCR values at creation time.
+func ExtendMeasurements(tpmDevice TPMDevice, measurements []Measurement) error {
+	if len(measurements) == 0 {
+		return nil
+	}
+
+	thetpm, err := tpmDevice.OpenDevice()
+	if err != nil {
+		return fmt.Errorf("could not connect to TPM: %w", err)
+	}
+
+	for _, m := range measurements {
+		if err := extendPCR(thetpm, m.PCR, m.Digest); err != nil {
+			return fmt.Errorf("failed to extend pcr %d with %s: %w", m.PCR, m.Name, err)
+		}
+		slog.Info("Measured "+m.Name, "pcr", m.PCR, "sha256", hex.EncodeToString(m.Digest))
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"testing"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+// attestedPCR returns an attested PCR other than ApplicationPCR that measurements can be configured with.
+func attestedPCR(t *testing.T) uint32 {
+	t.Helper()
+	for _, pcr := range ev.AttestPCRSelection {
+		if uint32(pcr) != ApplicationPCR && ValidateMeasurementPCR(uint32(pcr)) == nil {
+			return uint32(pcr)
+		}
+	}
+	t.Skip("no attested pcr besides the application pcr")
+	return 0
+}
+
+func TestValidateMeasurementPCR(t *testing.T) {
+	t.Run("ok, zero selects the application pcr", func(t *testing.T) {
+		require.NoError(t, ValidateMeasurementPCR(0))
+	})
+
+	t.Run("ok, attested pcr", func(t *testing.T) {
+		require.NoError(t, ValidateMeasurementPCR(attestedPCR(t)))
+	})
+
+	t.Run("fail, boot chain pcr", func(t *testing.T) {
+		require.ErrorContains(t, ValidateMeasurementPCR(7), "boot chain")
+	})
+
+	t.Run("fail, resettable pcr", func(t *testing.T) {
+		require.ErrorContains(t, ValidateMeasurementPCR(16), "resettable")
+		require.ErrorContains(t, ValidateMeasurementPCR(23), "resettable")
+	})
+}
@@ -0,0 +1,55 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeboot
+
+import (
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+)
+
+// MirrorConfig is config for the shadow backend compute_worker duplicates validated requests to. The
+// shadow backend receives plaintext requests, so it is disclosed in the evidence and must be a
+// loopback url, see rcevidence.Mirror.
+type MirrorConfig struct {
+	// BaseURL is the url of the shadow backend, the one router_com passes to compute_worker.
+	BaseURL string `yaml:"base_url"`
+	// PCR is extended with the digest of the mirror claim, so it is covered by the TPM quote. Leave 0
+	// for ApplicationPCR.
+	PCR uint32 `yaml:"pcr"`
+}
+
+// Active reports whether requests are mirrored.
+func (c *MirrorConfig) Active() bool {
+	return c != nil && c.BaseURL != ""
+}
+
+// Claim returns the mirror claim included in the evidence.
+func (c *MirrorConfig) Claim() (rcevidence.Mirror, error) {
+	m := rcevidence.Mirror{BaseURL: c.BaseURL}
+	if err := m.Validate(); err != nil {
+		return rcevidence.Mirror{}, err
+	}
+	return m, nil
+}
+
+// MirrorMeasurement returns the measurement of the digest of the mirror claim for pcr.
+func MirrorMeasurement(pcr uint32, m rcevidence.Mirror) (Measurement, error) {
+	digest, err := m.Digest()
+	if err != nil {
+		return Measurement{}, err
+	}
+	return newMeasurement(pcr, "mirror", digest), nil
+}
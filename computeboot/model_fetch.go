@@ -0,0 +1,308 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/openpcc/openpcc/otel/otelutil"
+)
+
+const defaultArtifactFetchAttempts = 5
+
+// ModelArtifact is a model file that is downloaded before the inference engine is initialized.
+type ModelArtifact struct {
+	// Model is the model this artifact belongs to
+	Model string `yaml:"model"`
+	// Source is where the artifact is downloaded from, either gs://bucket/object, s3://bucket/key or an https:// url
+	Source string `yaml:"source"`
+	// Destination is the path the artifact is written to
+	Destination string `yaml:"destination"`
+	// SHA256 is the hex encoded SHA-256 digest the artifact must match
+	SHA256 string `yaml:"sha256"`
+}
+
+// FetchedArtifact is an artifact that was downloaded, or already present, and matches its pinned digest.
+type FetchedArtifact struct {
+	Model       string
+	Destination string
+	Digest      []byte
+}
+
+// artifactSource opens an artifact for reading starting at offset. If the source does not
+// support resuming it returns resumed false and the reader starts at the beginning.
+type artifactSource interface {
+	Open(ctx context.Context, offset int64) (rc io.ReadCloser, resumed bool, err error)
+}
+
+type ModelFetcher struct {
+	httpClient   *http.Client
+	newGCSClient func(ctx context.Context) (*storage.Client, error)
+	artifacts    []ModelArtifact
+	maxAttempts  int
+}
+
+func NewModelFetcherWithConfig(cfg *InferenceEngineConfig) *ModelFetcher {
+	return &ModelFetcher{
+		httpClient: &http.Client{
+			Transport: otelutil.NewTransport(http.DefaultTransport),
+		},
+		newGCSClient: func(ctx context.Context) (*storage.Client, error) {
+			return storage.NewClient(ctx)
+		},
+		artifacts:   cfg.Artifacts,
+		maxAttempts: defaultArtifactFetchAttempts,
+	}
+}
+
+// Fetch downloads all artifacts that are not present yet and verifies every artifact against its pinned digest.
+// Interrupted downloads are resumed from where they left off.
+func (f *ModelFetcher) Fetch(ctx context.Context) ([]FetchedArtifact, error) {
+	ctx, span := otelutil.Tracer.Start(ctx, "computeboot.ModelFetcher.Fetch")
+	defer span.End()
+
+	result := make([]FetchedArtifact, 0, len(f.artifacts))
+	for _, artifact := range f.artifacts {
+		fetched, err := f.fetchArtifact(ctx, artifact)
+		if err != nil {
+			return nil, otelutil.Errorf(span, "failed to fetch artifact %s for model %s: %w", artifact.Source, artifact.Model, err)
+		}
+		result = append(result, fetched)
+	}
+
+	return result, nil
+}
+
+func (f *ModelFetcher) fetchArtifact(ctx context.Context, artifact ModelArtifact) (FetchedArtifact, error) {
+	want, err := hex.DecodeString(artifact.SHA256)
+	if err != nil || len(want) != sha256.Size {
+		return FetchedArtifact{}, errors.New("invalid sha256 digest")
+	}
+
+	if artifact.Destination == "" {
+		return FetchedArtifact{}, errors.New("missing destination")
+	}
+
+	fetched := FetchedArtifact{
+		Model:       artifact.Model,
+		Destination: artifact.Destination,
+		Digest:      want,
+	}
+
+	// artifacts that are already present only need to be verified.
+	got, err := digestFile(artifact.Destination)
+	if err == nil && bytes.Equal(got, want) {
+		slog.InfoContext(ctx, "Model artifact already present", "model", artifact.Model, "destination", artifact.Destination)
+		return fetched, nil
+	}
+
+	src, err := f.source(ctx, artifact.Source)
+	if err != nil {
+		return FetchedArtifact{}, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(artifact.Destination), 0o755); err != nil {
+		return FetchedArtifact{}, fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	partial := artifact.Destination + ".partial"
+	for attempt := 1; ; attempt++ {
+		err = download(ctx, src, partial)
+		if err == nil {
+			break
+		}
+		if attempt >= f.maxAttempts || ctx.Err() != nil {
+			return FetchedArtifact{}, err
+		}
+
+		slog.WarnContext(ctx, "Model artifact download interrupted, resuming", "model", artifact.Model, "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return FetchedArtifact{}, ctx.Err()
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+	}
+
+	got, err = digestFile(partial)
+	if err != nil {
+		return FetchedArtifact{}, err
+	}
+
+	if !bytes.Equal(got, want) {
+		// never resume from a corrupt download.
+		return FetchedArtifact{}, errors.Join(
+			fmt.Errorf("digest mismatch, want %x, got %x", want, got),
+			os.Remove(partial),
+		)
+	}
+
+	if err := os.Rename(partial, artifact.Destination); err != nil {
+		return FetchedArtifact{}, fmt.Errorf("failed to move artifact to destination: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Fetched model artifact", "model", artifact.Model, "destination", artifact.Destination, "sha256", artifact.SHA256)
+	return fetched, nil
+}
+
+func (f *ModelFetcher) source(ctx context.Context, rawURL string) (artifactSource, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "gs":
+		client, err := f.newGCSClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gcs client: %w", err)
+		}
+		return &gcsSource{
+			object: client.Bucket(u.Host).Object(strings.TrimPrefix(u.Path, "/")),
+		}, nil
+	case "s3":
+		// buckets are expected to allow reads from the node, so virtual-hosted style urls are sufficient.
+		return &httpSource{
+			client: f.httpClient,
+			url:    "https://" + u.Host + ".s3.amazonaws.com" + u.EscapedPath(),
+		}, nil
+	case "https", "http":
+		return &httpSource{
+			client: f.httpClient,
+			url:    u.String(),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported source scheme: %s", u.Scheme)
+	}
+}
+
+// download appends the remainder of the artifact to path.
+func download(ctx context.Context, src artifactSource, path string) error {
+	var offset int64
+	if info, err := os.Stat(path); err == nil {
+		offset = info.Size()
+	}
+
+	rc, resumed, err := src.Open(ctx, offset)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !resumed {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	}
+
+	// #nosec G304 -- path is provided by config.
+	out, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open partial artifact: %w", err)
+	}
+
+	_, err = io.Copy(out, rc)
+	err = errors.Join(err, out.Close())
+	if err != nil {
+		return fmt.Errorf("failed to download artifact: %w", err)
+	}
+
+	return nil
+}
+
+func digestFile(path string) ([]byte, error) {
+	// #nosec G304 -- path is provided by config.
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+
+	return h.Sum(nil), nil
+}
+
+type httpSource struct {
+	client *http.Client
+	url    string
+}
+
+func (s *httpSource) Open(ctx context.Context, offset int64) (io.ReadCloser, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to do request: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// server ignored the range, start over.
+		return resp.Body, false, nil
+	case http.StatusPartialContent:
+		return resp.Body, true, nil
+	default:
+		resp.Body.Close()
+		return nil, false, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+}
+
+type gcsSource struct {
+	object *storage.ObjectHandle
+}
+
+func (s *gcsSource) Open(ctx context.Context, offset int64) (io.ReadCloser, bool, error) {
+	reader, err := s.object.NewRangeReader(ctx, offset, -1)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create object reader: %w", err)
+	}
+	return reader, true, nil
+}
+
+// ModelArtifactMeasurements returns the measurements of the digests of the fetched artifacts for pcr,
+// so the digests are covered by the TPM quote.
+func ModelArtifactMeasurements(pcr uint32, artifacts []FetchedArtifact) []Measurement {
+	measurements := make([]Measurement, 0, len(artifacts))
+	for _, artifact := range artifacts {
+		measurements = append(measurements, newMeasurement(pcr, "model artifact "+artifact.Destination, artifact.Digest))
+	}
+	return measurements
+}
@@ -0,0 +1,184 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelFetcher(t *testing.T) {
+	content := []byte(strings.Repeat("model weights ", 1000))
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+
+	// newServer serves content, but cuts the first response short to force a resume.
+	newServer := func(t *testing.T, cutFirst bool) (*httptest.Server, *atomic.Int32) {
+		var requests atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := requests.Add(1)
+			body := content
+			status := http.StatusOK
+			if rng := r.Header.Get("Range"); rng != "" {
+				offset, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+				require.NoError(t, err)
+				body = content[offset:]
+				status = http.StatusPartialContent
+			}
+
+			if cutFirst && n == 1 {
+				w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				w.WriteHeader(status)
+				_, _ = w.Write(body[:len(body)/2])
+				// hijack and close the connection so the client sees an unexpected EOF.
+				conn, _, err := http.NewResponseController(w).Hijack()
+				require.NoError(t, err)
+				require.NoError(t, conn.Close())
+				return
+			}
+
+			w.WriteHeader(status)
+			_, _ = w.Write(body)
+		}))
+		t.Cleanup(srv.Close)
+		return srv, &requests
+	}
+
+	newFetcher := func(artifacts ...ModelArtifact) *ModelFetcher {
+		f := NewModelFetcherWithConfig(&InferenceEngineConfig{Artifacts: artifacts})
+		f.maxAttempts = 2
+		return f
+	}
+
+	t.Run("ok, resumes interrupted download", func(t *testing.T) {
+		srv, requests := newServer(t, true)
+		dst := filepath.Join(t.TempDir(), "models", "weights.bin")
+
+		fetched, err := newFetcher(ModelArtifact{
+			Model:       "llama3.2:1b",
+			Source:      srv.URL + "/weights.bin",
+			Destination: dst,
+			SHA256:      digest,
+		}).Fetch(t.Context())
+		require.NoError(t, err)
+		require.Len(t, fetched, 1)
+		require.Equal(t, sum[:], fetched[0].Digest)
+		require.Equal(t, int32(2), requests.Load())
+
+		got, err := os.ReadFile(dst)
+		require.NoError(t, err)
+		require.Equal(t, content, got)
+	})
+
+	t.Run("ok, present artifact is not downloaded again", func(t *testing.T) {
+		srv, requests := newServer(t, false)
+		dst := filepath.Join(t.TempDir(), "weights.bin")
+		require.NoError(t, os.WriteFile(dst, content, 0o600))
+
+		_, err := newFetcher(ModelArtifact{
+			Source:      srv.URL,
+			Destination: dst,
+			SHA256:      digest,
+		}).Fetch(t.Context())
+		require.NoError(t, err)
+		require.Equal(t, int32(0), requests.Load())
+	})
+
+	t.Run("fail, digest mismatch", func(t *testing.T) {
+		srv, _ := newServer(t, false)
+		dst := filepath.Join(t.TempDir(), "weights.bin")
+		other := sha256.Sum256([]byte("other"))
+
+		_, err := newFetcher(ModelArtifact{
+			Source:      srv.URL,
+			Destination: dst,
+			SHA256:      hex.EncodeToString(other[:]),
+		}).Fetch(t.Context())
+		require.ErrorContains(t, err, "digest mismatch")
+
+		_, err = os.Stat(dst)
+		require.ErrorIs(t, err, os.ErrNotExist)
+		_, err = os.Stat(dst + ".partial")
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("fail, unsupported source", func(t *testing.T) {
+		_, err := newFetcher(ModelArtifact{
+			Source:      "ftp://example.com/weights.bin",
+			Destination: filepath.Join(t.TempDir(), "weights.bin"),
+			SHA256:      digest,
+		}).Fetch(t.Context())
+		require.ErrorContains(t, err, "unsupported source scheme")
+	})
+}
+
+func TestMeasureModelArtifacts(t *testing.T) {
+	readPCR := func(t *testing.T, device TPMDevice, pcr uint32) []byte {
+		thetpm, err := device.OpenDevice()
+		require.NoError(t, err)
+
+		rsp, err := tpm2.PCRRead{
+			PCRSelectionIn: tpm2.TPMLPCRSelection{
+				PCRSelections: []tpm2.TPMSPCRSelection{
+					{
+						Hash:      tpm2.TPMAlgSHA256,
+						PCRSelect: tpm2.PCClientCompatible.PCRs(uint(pcr)),
+					},
+				},
+			},
+		}.Execute(thetpm)
+		require.NoError(t, err)
+		require.Len(t, rsp.PCRValues.Digests, 1)
+		return rsp.PCRValues.Digests[0].Buffer
+	}
+
+	digest := sha256.Sum256([]byte("model weights"))
+	// PCRs start out as zeros, extending computes sha256(old || digest).
+	want := sha256.Sum256(append(make([]byte, sha256.Size), digest[:]...))
+
+	t.Run("ok, configured pcr", func(t *testing.T) {
+		device := NewTPMInMemorySimulator()
+		defer device.Close()
+
+		pcr := attestedPCR(t)
+		err := ExtendMeasurements(device, ModelArtifactMeasurements(pcr, []FetchedArtifact{{Digest: digest[:]}}))
+		require.NoError(t, err)
+		require.Equal(t, want[:], readPCR(t, device, pcr))
+	})
+
+	t.Run("ok, zero pcr selects the application pcr", func(t *testing.T) {
+		device := NewTPMInMemorySimulator()
+		defer device.Close()
+
+		err := ExtendMeasurements(device, ModelArtifactMeasurements(0, []FetchedArtifact{{Digest: digest[:]}}))
+		require.NoError(t, err)
+		require.Equal(t, want[:], readPCR(t, device, ApplicationPCR))
+		require.Equal(t, make([]byte, sha256.Size), readPCR(t, device, 0))
+	})
+}
@@ -0,0 +1,132 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeboot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/confidentsecurity/confidentcompute/modelwake"
+	"github.com/confidentsecurity/confidentcompute/routercom/modelstate"
+	"github.com/openpcc/openpcc/otel/otelutil"
+)
+
+// SleepModeConfig puts vLLM models to sleep after they were prewarmed and benchmarked, so a node
+// can serve more models than fit in GPU memory at once. router_com wakes a model up when the first
+// request for it arrives, see modelwake.
+type SleepModeConfig struct {
+	// Models maps the models that sleep to the base url of their vLLM instance, blank uses the url
+	// of the inference engine. The instances must run with --enable-sleep-mode and
+	// VLLM_SERVER_DEV_MODE=1, which exposes the sleep endpoints.
+	Models map[string]string `yaml:"models"`
+	// Level is the vLLM sleep level, 1 offloads the weights to CPU memory and 2 discards them.
+	// Defaults to 1.
+	Level int `yaml:"level"`
+}
+
+func (c *SleepModeConfig) validate(models []string) error {
+	switch c.Level {
+	case 0, modelwake.SleepLevelOffload, modelwake.SleepLevelDiscard:
+	default:
+		return fmt.Errorf("unknown sleep level %d", c.Level)
+	}
+	for model := range c.Models {
+		if !slices.Contains(models, model) {
+			return fmt.Errorf("sleeping model %s is not a model of the inference engine", model)
+		}
+	}
+	return nil
+}
+
+func (c *SleepModeConfig) level() int {
+	if c.Level == 0 {
+		return modelwake.SleepLevelOffload
+	}
+	return c.Level
+}
+
+// modelURL returns the base url of the inference engine that serves model.
+func (eng *InferenceEngineInitializer) modelURL(model string) string {
+	if eng.sleepMode != nil && eng.sleepMode.Models[model] != "" {
+		return eng.sleepMode.Models[model]
+	}
+	return eng.engineURL
+}
+
+// SleepModel puts model to sleep, freeing its GPU memory.
+func (eng *InferenceEngineInitializer) SleepModel(ctx context.Context, model string) error {
+	level := modelwake.SleepLevelOffload
+	if eng.sleepMode != nil {
+		level = eng.sleepMode.level()
+	}
+	if err := modelwake.SleepModel(ctx, eng.httpClient, eng.modelURL(model), level); err != nil {
+		return fmt.Errorf("failed to put model %s to sleep: %w", model, err)
+	}
+	return nil
+}
+
+// WakeModel wakes model up, it serves requests again once it returns.
+func (eng *InferenceEngineInitializer) WakeModel(ctx context.Context, model string) error {
+	if err := modelwake.WakeModel(ctx, eng.httpClient, eng.modelURL(model)); err != nil {
+		return fmt.Errorf("failed to wake model %s up: %w", model, err)
+	}
+	return nil
+}
+
+// ModelSleeping reports whether model is sleeping.
+func (eng *InferenceEngineInitializer) ModelSleeping(ctx context.Context, model string) (bool, error) {
+	sleeping, err := modelwake.ModelSleeping(ctx, eng.httpClient, eng.modelURL(model))
+	if err != nil {
+		return false, fmt.Errorf("failed to get sleep state of model %s: %w", model, err)
+	}
+	return sleeping, nil
+}
+
+// SleepModels puts the warm models of states that are configured to sleep to sleep, and returns
+// the states with their sleep state. Like the benchmark it is best effort, a model that fails to
+// fall asleep stays awake. It only fails for an invalid sleep mode config.
+func (eng *InferenceEngineInitializer) SleepModels(ctx context.Context, states []modelstate.State) ([]modelstate.State, error) {
+	if eng.sleepMode == nil || len(eng.sleepMode.Models) == 0 {
+		return states, nil
+	}
+
+	ctx, span := otelutil.Tracer.Start(ctx, "computeboot.SleepModels")
+	defer span.End()
+
+	if err := eng.sleepMode.validate(eng.models); err != nil {
+		return states, otelutil.Errorf(span, "invalid sleep mode config: %w", err)
+	}
+
+	result := slices.Clone(states)
+	for i, state := range result {
+		if _, ok := eng.sleepMode.Models[state.Model]; !ok || !state.Warm {
+			continue
+		}
+
+		if err := eng.SleepModel(ctx, state.Model); err != nil {
+			slog.WarnContext(ctx, "Failed to put model to sleep, it stays awake", "model", state.Model, "error", err)
+			continue
+		}
+		result[i].Sleeping = true
+		result[i].EngineURL = eng.modelURL(state.Model)
+		slog.InfoContext(ctx, "Put model to sleep", "model", state.Model, "level", eng.sleepMode.level())
+	}
+
+	return result, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeboot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/confidentsecurity/confidentcompute/routercom/modelstate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSleepModels(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		levels []string
+	)
+	sleepServer := func(status int) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/sleep" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			mu.Lock()
+			levels = append(levels, r.URL.Query().Get("level"))
+			mu.Unlock()
+			w.WriteHeader(status)
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	engine := sleepServer(http.StatusOK)
+	other := sleepServer(http.StatusOK)
+	broken := sleepServer(http.StatusInternalServerError)
+
+	states := []modelstate.State{
+		{Model: "a", Warm: true},
+		{Model: "b", Warm: true},
+		{Model: "c", Warm: true},
+		{Model: "d", Warm: true},
+		{Model: "e", Reason: "prewarm failed"},
+	}
+
+	t.Run("ok, configured warm models are put to sleep", func(t *testing.T) {
+		levels = nil
+		eng := NewInferenceEngineInitializerWithConfig(&InferenceEngineConfig{
+			Models: []string{"a", "b", "c", "d", "e"},
+			URL:    engine.URL,
+			SleepMode: &SleepModeConfig{
+				Models: map[string]string{"b": "", "c": other.URL, "d": broken.URL, "e": ""},
+				Level:  2,
+			},
+		})
+
+		got, err := eng.SleepModels(t.Context(), states)
+		require.NoError(t, err)
+		require.Equal(t, []modelstate.State{
+			{Model: "a", Warm: true},
+			{Model: "b", Warm: true, Sleeping: true, EngineURL: engine.URL},
+			{Model: "c", Warm: true, Sleeping: true, EngineURL: other.URL},
+			// models that fail to fall asleep stay awake.
+			{Model: "d", Warm: true},
+			{Model: "e", Reason: "prewarm failed"},
+		}, got)
+		require.Equal(t, []string{"2", "2", "2"}, levels)
+	})
+
+	t.Run("ok, no sleep mode", func(t *testing.T) {
+		eng := NewInferenceEngineInitializerWithConfig(&InferenceEngineConfig{URL: engine.URL})
+		got, err := eng.SleepModels(t.Context(), states)
+		require.NoError(t, err)
+		require.Equal(t, states, got)
+	})
+
+	t.Run("fail, unknown model", func(t *testing.T) {
+		eng := NewInferenceEngineInitializerWithConfig(&InferenceEngineConfig{
+			Models:    []string{"a"},
+			URL:       engine.URL,
+			SleepMode: &SleepModeConfig{Models: map[string]string{"b": ""}},
+		})
+		_, err := eng.SleepModels(t.Context(), states)
+		require.Error(t, err)
+	})
+
+	t.Run("fail, unknown level", func(t *testing.T) {
+		eng := NewInferenceEngineInitializerWithConfig(&InferenceEngineConfig{
+			Models:    []string{"a"},
+			URL:       engine.URL,
+			SleepMode: &SleepModeConfig{Models: map[string]string{"a": ""}, Level: 3},
+		})
+		_, err := eng.SleepModels(t.Context(), states)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,148 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/confidentsecurity/go-nvtrust/pkg/gonvtrust/nras"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrNRASUnavailable is returned when NRAS can't be reached or fails to respond, as opposed to
+// NRAS rejecting the evidence of the GPUs.
+var ErrNRASUnavailable = errors.New("nras unavailable")
+
+// NRASOutagePolicy is what compute_boot does when NRAS is unavailable during GPU attestation.
+type NRASOutagePolicy string
+
+const (
+	// NRASOutageFail fails the boot, the node doesn't register with the router.
+	NRASOutageFail NRASOutagePolicy = "fail"
+	// NRASOutageDegrade registers the node without GPUs, it only serves the models that run on
+	// CPUs until it restarts to attest its GPUs again.
+	NRASOutageDegrade NRASOutagePolicy = "degrade"
+)
+
+// DefaultNRASRetryInterval is how long a degraded node serves before it retries the GPU attestation.
+const DefaultNRASRetryInterval = 30 * time.Minute
+
+// NRASOutageConfig is config for GPU attestation during NRAS outages.
+type NRASOutageConfig struct {
+	// Policy is what to do when NRAS is unavailable. Leave blank to fail the boot.
+	Policy NRASOutagePolicy `yaml:"policy"`
+	// RetryInterval is how long a degraded node serves before router_com restarts it to attest the
+	// GPUs again. Leave 0 for DefaultNRASRetryInterval.
+	RetryInterval time.Duration `yaml:"retry_interval"`
+}
+
+func (c *NRASOutageConfig) validate() error {
+	switch c.Policy {
+	case "", NRASOutageFail, NRASOutageDegrade:
+	default:
+		return fmt.Errorf("unknown nras outage policy: %q", c.Policy)
+	}
+	if c.RetryInterval < 0 {
+		return fmt.Errorf("invalid retry interval: %s", c.RetryInterval)
+	}
+	return nil
+}
+
+func (c *NRASOutageConfig) degrade() bool {
+	return c != nil && c.Policy == NRASOutageDegrade
+}
+
+func (c *NRASOutageConfig) retryInterval() time.Duration {
+	if c.RetryInterval == 0 {
+		return DefaultNRASRetryInterval
+	}
+	return c.RetryInterval
+}
+
+// nrasTransport turns failed round trips and server errors of NRAS into errors wrapping
+// ErrNRASUnavailable. Client errors are passed on, they mean NRAS rejected the request.
+type nrasTransport struct {
+	base http.RoundTripper
+}
+
+func (t nrasTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNRASUnavailable, err)
+	}
+	if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+		// the body is not needed, the status is all the error says.
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrNRASUnavailable, resp.Status)
+	}
+	return resp, nil
+}
+
+// newNRASClient creates the NRAS client, its errors wrap ErrNRASUnavailable when NRAS is unavailable.
+func newNRASClient() *nras.Client {
+	return nras.NewNRASClient(&http.Client{
+		Transport: nrasTransport{base: http.DefaultTransport},
+	})
+}
+
+// outageVerifier records whether NRAS was unavailable for any of the calls of an attestation.
+// The errors don't reliably survive the wrapping of the attestors, so they are checked here.
+type outageVerifier struct {
+	RemoteVerifier
+
+	mu     sync.Mutex
+	outage error
+}
+
+func (v *outageVerifier) AttestGPU(ctx context.Context, request *nras.AttestationRequest) (*nras.AttestationResponse, error) {
+	resp, err := v.RemoteVerifier.AttestGPU(ctx, request)
+	return resp, v.record(err)
+}
+
+func (v *outageVerifier) AttestSwitch(ctx context.Context, request *nras.AttestationRequest) (*nras.AttestationResponse, error) {
+	resp, err := v.RemoteVerifier.AttestSwitch(ctx, request)
+	return resp, v.record(err)
+}
+
+func (v *outageVerifier) VerifyJWT(ctx context.Context, signedToken string) (*jwt.Token, error) {
+	token, err := v.RemoteVerifier.VerifyJWT(ctx, signedToken)
+	return token, v.record(err)
+}
+
+func (v *outageVerifier) record(err error) error {
+	if errors.Is(err, ErrNRASUnavailable) {
+		v.mu.Lock()
+		if v.outage == nil {
+			v.outage = err
+		}
+		v.mu.Unlock()
+	}
+	return err
+}
+
+// firstOutage returns the first error that showed NRAS unavailable, nil when NRAS was available.
+func (v *outageVerifier) firstOutage() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.outage
+}
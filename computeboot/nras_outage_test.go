@@ -0,0 +1,161 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/confidentsecurity/go-nvtrust/pkg/gonvtrust/certs"
+	"github.com/confidentsecurity/go-nvtrust/pkg/gonvtrust/gpu"
+	"github.com/confidentsecurity/go-nvtrust/pkg/gonvtrust/nras"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAttestationEvidenceList_NRASOutage(t *testing.T) {
+	newManager := func(outage *NRASOutageConfig, attestErr error) (*NvidiaManager, *bool) {
+		readyStateEnabled := false
+		return &NvidiaManager{
+			GPUAdmin: &MockGPUAdmin{
+				CollectEvidenceFunc: func(nonce []byte) ([]gpu.GPUDevice, error) {
+					certChain := certs.NewCertChainFromData(ValidCertChainData)
+					device := gpu.NewGPUDevice(nvml.DEVICE_ARCH_HOPPER, []byte("mock-attestation-report"), certChain)
+					return []gpu.GPUDevice{device}, nil
+				},
+				EnableGPUReadyStateFunc: func() error {
+					readyStateEnabled = true
+					return nil
+				},
+			},
+			Verifier: &MockRemoteVerifier{
+				AttestGPUFunc: func(context.Context, *nras.AttestationRequest) (*nras.AttestationResponse, error) {
+					return nil, fmt.Errorf("failed to send request: %w", attestErr)
+				},
+			},
+			NVSwitchAdminProvider:           &MockSwitchAdminProvider{},
+			IntermediateCertificateProvider: &MockCertificateProvider{},
+			NonceGenerator: func() []byte {
+				return make([]byte, 32)
+			},
+			NRASOutage: outage,
+		}, &readyStateEnabled
+	}
+	unavailable := fmt.Errorf("%w: 503 Service Unavailable", ErrNRASUnavailable)
+
+	t.Run("ok, degrades when nras is unavailable", func(t *testing.T) {
+		manager, readyStateEnabled := newManager(&NRASOutageConfig{Policy: NRASOutageDegrade, RetryInterval: time.Hour}, unavailable)
+
+		evidenceList, err := manager.GetAttestationEvidenceList(t.Context())
+		require.NoError(t, err)
+		require.Len(t, evidenceList, 1)
+
+		degraded, ok, err := rcevidence.FindGPUDegraded(evidenceList)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, time.Hour, degraded.RetryAfter())
+		require.Contains(t, degraded.Reason, "503 Service Unavailable")
+
+		// unattested GPUs are not made ready.
+		require.NoError(t, manager.EnableConfidentialCompute())
+		require.False(t, *readyStateEnabled)
+	})
+
+	t.Run("ok, default retry interval", func(t *testing.T) {
+		manager, _ := newManager(&NRASOutageConfig{Policy: NRASOutageDegrade}, unavailable)
+
+		evidenceList, err := manager.GetAttestationEvidenceList(t.Context())
+		require.NoError(t, err)
+
+		degraded, ok, err := rcevidence.FindGPUDegraded(evidenceList)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, DefaultNRASRetryInterval, degraded.RetryAfter())
+	})
+
+	t.Run("fail, fail policy", func(t *testing.T) {
+		manager, _ := newManager(&NRASOutageConfig{Policy: NRASOutageFail}, unavailable)
+
+		_, err := manager.GetAttestationEvidenceList(t.Context())
+		require.Error(t, err)
+	})
+
+	t.Run("fail, no policy", func(t *testing.T) {
+		manager, _ := newManager(nil, unavailable)
+
+		_, err := manager.GetAttestationEvidenceList(t.Context())
+		require.Error(t, err)
+	})
+
+	t.Run("fail, nras rejects the evidence", func(t *testing.T) {
+		manager, readyStateEnabled := newManager(&NRASOutageConfig{Policy: NRASOutageDegrade}, errors.New("failed to attest: 400 Bad Request"))
+
+		_, err := manager.GetAttestationEvidenceList(t.Context())
+		require.Error(t, err)
+
+		require.NoError(t, manager.EnableConfidentialCompute())
+		require.True(t, *readyStateEnabled)
+	})
+}
+
+func TestNRASTransport(t *testing.T) {
+	tests := map[string]struct {
+		status      int
+		unavailable bool
+	}{
+		"ok":                    {status: http.StatusOK},
+		"bad request":           {status: http.StatusBadRequest},
+		"too many requests":     {status: http.StatusTooManyRequests, unavailable: true},
+		"service unavailable":   {status: http.StatusServiceUnavailable, unavailable: true},
+		"internal server error": {status: http.StatusInternalServerError, unavailable: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+
+			client := &http.Client{Transport: nrasTransport{base: http.DefaultTransport}}
+			resp, err := client.Get(srv.URL)
+			if tc.unavailable {
+				require.ErrorIs(t, err, ErrNRASUnavailable)
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, tc.status, resp.StatusCode)
+		})
+	}
+
+	t.Run("unreachable", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+
+		client := &http.Client{Transport: nrasTransport{base: http.DefaultTransport}}
+		_, err := client.Get(srv.URL)
+		require.ErrorIs(t, err, ErrNRASUnavailable)
+	})
+}
@@ -27,12 +27,34 @@ import (
 type GPUConfig struct {
 	// Required is a bool that indicates whether the GPU is going to be present or simulated. True means a real NVIDIA GPU
 	Required bool `yaml:"required"`
+	// CPUOnly is true for nodes that serve inference on confidential CPUs without GPUs. The
+	// evidence then contains an explicit CPU-only marker. Can't be combined with Required.
+	CPUOnly bool `yaml:"cpu_only"`
+	// TopologyPCR is the PCR that is extended with the digest of the NVLink topology, see GPUTopology.Digest.
+	// Leave 0 for ApplicationPCR.
+	TopologyPCR uint32 `yaml:"topology_pcr"`
+	// VersionPolicy are the minimum driver and firmware versions of the GPUs.
+	VersionPolicy GPUVersionPolicy `yaml:"version_policy"`
+	// Azure adds the attestation artifacts of Azure confidential GPU VMs to the evidence. Leave
+	// blank on other platforms.
+	Azure *AzureGPUConfig `yaml:"azure"`
+	// NVLinkDomain attests the NVSwitches of a multi-node NVLink domain, e.g. GB200 NVL72, over the
+	// out-of-band NSCQ endpoints of its switch trays. Leave blank outside of such a domain.
+	NVLinkDomain *NVLinkDomainConfig `yaml:"nvlink_domain"`
+	// NRASOutage is what to do when NRAS is unavailable during GPU attestation, e.g. registering
+	// the node without GPUs instead of failing the boot. Leave blank to fail the boot.
+	NRASOutage *NRASOutageConfig `yaml:"nras_outage"`
+	// Recovery resets GPUs that fail to become ready for confidential computing and attests them
+	// again, instead of failing the boot. Leave blank to fail the boot.
+	Recovery *GPURecoveryConfig `yaml:"recovery"`
 }
 
 type GPUManager interface {
 	VerifyGPUState(ctx context.Context) error
 	EnableConfidentialCompute() error
 	GetAttestationEvidenceList(ctx context.Context) (ev.SignedEvidenceList, error)
+	// Topology returns the verified NVLink/NVSwitch topology of the system.
+	Topology(ctx context.Context) (*GPUTopology, error)
 }
 
 type GPUAdmin interface {
@@ -23,9 +23,10 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"net/http"
+	"strings"
 	"time"
 
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
 	"github.com/confidentsecurity/go-nvtrust/pkg/gonscq"
 	"github.com/confidentsecurity/go-nvtrust/pkg/gonvtrust"
 	"github.com/confidentsecurity/go-nvtrust/pkg/gonvtrust/gpu"
@@ -57,9 +58,29 @@ type NvidiaManager struct {
 	NVSwitchAdminProvider           SwitchAdminProvider
 	NonceGenerator                  func() []byte
 	IntermediateCertificateProvider attest.CertificateProvider
+	TopologyReader                  TopologyReader
+	// VersionReader reads the driver and firmware versions, which are checked against
+	// VersionPolicy and included in the evidence. Leave nil to skip reading the versions.
+	VersionReader GPUVersionReader
+	VersionPolicy GPUVersionPolicy
+	// MAAClient gets the MAA token that Azure confidential GPU VMs include next to the NRAS
+	// results. Leave nil on other platforms.
+	MAAClient MAAClient
+	// NVLinkDomain is the multi-node NVLink domain of the node, its switches are attested through
+	// NVSwitchAdminProvider even when the node has a single GPU. Leave nil outside of such a domain.
+	NVLinkDomain *NVLinkDomainConfig
 	// VerificationTimeout is the maximum time to wait for GPU to be ready.
 	// If zero, defaults to 5 minutes.
 	VerificationTimeout time.Duration
+	// NRASOutage is the policy for attesting while NRAS is unavailable. Leave nil to fail.
+	NRASOutage *NRASOutageConfig
+	// Resetter resets the GPUs when they fail to become ready, see RecoverGPUs. Leave nil when the
+	// GPUs can't be reset.
+	Resetter GPUResetter
+
+	// degraded is true when the GPUs couldn't be attested and the evidence marks the node as
+	// degraded, the GPUs are then not made ready for confidential computing.
+	degraded bool
 }
 
 type ConfidentialComputeState struct {
@@ -111,16 +132,24 @@ func NewNvidiaManager() (*NvidiaManager, error) {
 	}
 	return &NvidiaManager{
 		GPUAdmin:                        gpuAdmin,
-		Verifier:                        nras.NewNRASClient(http.DefaultClient),
+		Verifier:                        newNRASClient(),
 		NVSwitchAdminProvider:           &nscqSwitchAdminProvider{},
 		NonceGenerator:                  defaultNonceGenerator,
 		IntermediateCertificateProvider: nil, // Will use default NRAS provider
+		TopologyReader:                  nvmlTopologyReader{},
+		VersionReader:                   nvmlVersionReader{},
+		Resetter:                        nvmlGPUResetter{},
 	}, nil
 }
 
 func (n *NvidiaManager) VerifyGPUState(ctx context.Context) error {
 	slog.InfoContext(ctx, "Verifying GPU for confidential computing")
 
+	// stale drivers or firmware won't be fixed by waiting, fail right away.
+	if err := n.verifyVersions(ctx); err != nil {
+		return err
+	}
+
 	verificationTimeout := n.VerificationTimeout
 	if verificationTimeout == 0 {
 		verificationTimeout = 5 * time.Minute
@@ -153,6 +182,23 @@ func (n *NvidiaManager) VerifyGPUState(ctx context.Context) error {
 	}
 }
 
+func (n *NvidiaManager) verifyVersions(ctx context.Context) error {
+	if n.VersionReader == nil {
+		return nil
+	}
+
+	versions, err := n.VersionReader.ReadVersions()
+	if err != nil {
+		return fmt.Errorf("failed to read gpu versions: %w", err)
+	}
+
+	slog.InfoContext(ctx, "GPU versions", "driver_version", versions.DriverVersion, "gpus", versions.GPUs)
+	if err := n.VersionPolicy.Check(versions); err != nil {
+		return fmt.Errorf("gpu versions don't meet the version policy: %w", err)
+	}
+	return nil
+}
+
 func (n *NvidiaManager) getConfidentialComputeState() (ConfidentialComputeState, error) {
 	persistenceModeEnabled, err := n.GPUAdmin.AllGPUInPersistenceMode()
 	if err != nil {
@@ -171,6 +217,11 @@ func (n *NvidiaManager) getConfidentialComputeState() (ConfidentialComputeState,
 }
 
 func (n *NvidiaManager) EnableConfidentialCompute() error {
+	if n.degraded {
+		slog.Warn("GPUs are not attested, not setting confidential compute mode")
+		return nil
+	}
+
 	slog.Info("setting confidential compute mode for GPU")
 
 	err := n.GPUAdmin.EnableGPUReadyState()
@@ -183,11 +234,41 @@ func (n *NvidiaManager) EnableConfidentialCompute() error {
 }
 
 func (n *NvidiaManager) GetAttestationEvidenceList(ctx context.Context) (ev.SignedEvidenceList, error) {
+	if !n.NRASOutage.degrade() {
+		return n.attestGPUs(ctx, n.Verifier)
+	}
+
+	verifier := &outageVerifier{RemoteVerifier: n.Verifier}
+	result, err := n.attestGPUs(ctx, verifier)
+	if err == nil {
+		return result, nil
+	}
+	// only an unavailable NRAS degrades the node, evidence NRAS rejects always fails the boot.
+	outage := verifier.firstOutage()
+	if outage == nil {
+		return nil, err
+	}
+
+	retryInterval := n.NRASOutage.retryInterval()
+	slog.WarnContext(ctx, "NRAS is unavailable, registering without GPUs", "error", err, "retry_interval", retryInterval)
+	piece, err := rcevidence.GPUDegradedPiece(rcevidence.GPUDegraded{
+		Reason:            outage.Error(),
+		RetryAfterSeconds: int64(retryInterval / time.Second),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gpu degraded evidence: %w", err)
+	}
+	n.degraded = true
+	return ev.SignedEvidenceList{piece}, nil
+}
+
+// attestGPUs attests the GPUs, and the NVSwitches when present, with verifier.
+func (n *NvidiaManager) attestGPUs(ctx context.Context, verifier RemoteVerifier) (ev.SignedEvidenceList, error) {
 	result := ev.SignedEvidenceList{}
 	nonce := n.NonceGenerator()
 
 	gpuAttester, err := attest.NewNVidiaAttestor(
-		gonvtrust.NewRemoteAttester(n.GPUAdmin, n.Verifier),
+		gonvtrust.NewRemoteAttester(n.GPUAdmin, verifier),
 		ev.NvidiaETA,
 		nonce,
 	)
@@ -200,6 +281,7 @@ func (n *NvidiaManager) GetAttestationEvidenceList(ctx context.Context) (ev.Sign
 		return nil, fmt.Errorf("failed to create Nvidia CC signed evidence: %w", err)
 	}
 	result = append(result, gpuSignedEvidence)
+	nrasTokens := []string{gpuSignedEvidence.ToJWT()}
 
 	nvidiaCCIntermediateCertificateSignedEvidence, err := n.createIntermediateCertificateEvidence(ctx, gpuSignedEvidence.ToJWT(), ev.NvidiaCCIntermediateCertificate)
 	if err != nil {
@@ -208,8 +290,9 @@ func (n *NvidiaManager) GetAttestationEvidenceList(ctx context.Context) (ev.Sign
 	result = append(result, nvidiaCCIntermediateCertificateSignedEvidence)
 
 	// If there are multiple GPUs, that means the system is in protected PCIE mode
-	// and we need to attest nvswitches as well.
-	if len(gpuAttester.AttestationResult.DevicesTokens) > 1 {
+	// and we need to attest nvswitches as well. The GPUs of a multi-node NVLink domain
+	// share the switches of the domain, however many of them are in this node.
+	if len(gpuAttester.AttestationResult.DevicesTokens) > 1 || n.NVLinkDomain != nil {
 		nvSwitchAdmin, err := n.NVSwitchAdminProvider.BuildSwitchAdmin()
 		if err != nil {
 			return nil, err
@@ -222,7 +305,7 @@ func (n *NvidiaManager) GetAttestationEvidenceList(ctx context.Context) (ev.Sign
 		}()
 
 		switchNonce := n.NonceGenerator()
-		nvSwitchAttester := gonvtrust.NewRemoteAttester(nvSwitchAdmin, n.Verifier)
+		nvSwitchAttester := gonvtrust.NewRemoteAttester(nvSwitchAdmin, verifier)
 
 		switchAttester, err := attest.NewNVidiaAttestor(nvSwitchAttester, ev.NvidiaSwitchETA, switchNonce)
 		if err != nil {
@@ -233,16 +316,127 @@ func (n *NvidiaManager) GetAttestationEvidenceList(ctx context.Context) (ev.Sign
 			return nil, fmt.Errorf("failed to create nvswitch signed evidence: %w", err)
 		}
 		result = append(result, switchSignedEvidence)
+		nrasTokens = append(nrasTokens, switchSignedEvidence.ToJWT())
 		nvidiaSwitchIntermediateCertificateSignedEvidence, err := n.createIntermediateCertificateEvidence(ctx, switchSignedEvidence.ToJWT(), ev.NvidiaSwitchIntermediateCertificate)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create Nvidia CC intermediate certificate signed evidence: %w", err)
 		}
 		result = append(result, nvidiaSwitchIntermediateCertificateSignedEvidence)
+
+		if domainAdmin, ok := nvSwitchAdmin.(*nvlinkDomainSwitchAdmin); ok {
+			domainPiece, err := n.createNVLinkDomainEvidence(domainAdmin)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create nvlink domain evidence: %w", err)
+			}
+			result = append(result, domainPiece)
+		}
+	}
+
+	if n.MAAClient != nil {
+		azurePiece, err := n.createAzureGPUEvidence(ctx, nrasTokens)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create azure gpu evidence: %w", err)
+		}
+		result = append(result, azurePiece)
+	}
+
+	// the versions let verifiers enforce their own version policy.
+	if n.VersionReader != nil {
+		versions, err := n.VersionReader.ReadVersions()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gpu versions: %w", err)
+		}
+		versionsPiece, err := rcevidence.GPUVersionsPiece(versions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gpu versions evidence: %w", err)
+		}
+		result = append(result, versionsPiece)
+	}
+
+	// the topology lets verifiers check the protected fabric, not just the individual devices.
+	if n.TopologyReader != nil {
+		topology, err := n.Topology(ctx)
+		if err != nil {
+			return nil, err
+		}
+		topologyPiece, err := rcevidence.GPUTopologyPiece(topology)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gpu topology evidence: %w", err)
+		}
+		result = append(result, topologyPiece)
 	}
 
 	return result, nil
 }
 
+func (n *NvidiaManager) Topology(ctx context.Context) (*GPUTopology, error) {
+	topology, err := n.TopologyReader.ReadTopology()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gpu topology: %w", err)
+	}
+
+	if err := topology.Verify(); err != nil {
+		return nil, fmt.Errorf("gpu topology is not protected: %w", err)
+	}
+
+	if n.NVLinkDomain != nil {
+		if err := n.verifyNVLinkDomain(topology); err != nil {
+			return nil, err
+		}
+	}
+
+	slog.InfoContext(ctx, "GPU topology verified",
+		"gpus", len(topology.GPUs),
+		"multi_gpu_mode", topology.MultiGPUMode,
+		"link_encryption", topology.LinkEncryption)
+	return topology, nil
+}
+
+// verifyNVLinkDomain checks that the GPUs are in the configured NVLink domain, so the switches that
+// are attested are the switches the GPUs talk to.
+func (n *NvidiaManager) verifyNVLinkDomain(topology *GPUTopology) error {
+	clusterUUID, _, err := topology.NVLinkDomain()
+	if err != nil {
+		return fmt.Errorf("invalid nvlink domain: %w", err)
+	}
+	if !strings.EqualFold(clusterUUID, n.NVLinkDomain.DomainID) {
+		return fmt.Errorf("gpus are in nvlink domain %s, not %s", clusterUUID, n.NVLinkDomain.DomainID)
+	}
+	return nil
+}
+
+// createNVLinkDomainEvidence describes the domain the switch evidence was collected in, including
+// the clique of the GPUs and the trays that could not be attested.
+func (n *NvidiaManager) createNVLinkDomainEvidence(admin *nvlinkDomainSwitchAdmin) (*ev.SignedEvidencePiece, error) {
+	topology, err := n.TopologyReader.ReadTopology()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gpu topology: %w", err)
+	}
+	if err := n.verifyNVLinkDomain(topology); err != nil {
+		return nil, err
+	}
+	_, cliqueID, err := topology.NVLinkDomain()
+	if err != nil {
+		return nil, err
+	}
+	return rcevidence.NVLinkDomainPiece(admin.domain(cliqueID))
+}
+
+// createAzureGPUEvidence gets an MAA token of the VM that is bound to the NRAS results through
+// its nonce, so verifiers know the GPUs are attached to the attested VM.
+func (n *NvidiaManager) createAzureGPUEvidence(ctx context.Context, nrasTokens []string) (*ev.SignedEvidencePiece, error) {
+	nonce := rcevidence.NRASNonce(nrasTokens)
+	token, err := n.MAAClient.AttestVM(ctx, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get maa token: %w", err)
+	}
+
+	return rcevidence.AzureGPUPiece(rcevidence.AzureGPUAttestation{
+		MAAToken:  token,
+		NRASNonce: nonce,
+	})
+}
+
 func (n *NvidiaManager) createIntermediateCertificateEvidence(ctx context.Context, jwtToken string, evidenceType ev.EvidenceType) (*ev.SignedEvidencePiece, error) {
 	if n.IntermediateCertificateProvider != nil {
 		// Use injected provider for testing
@@ -28,6 +28,7 @@ import (
 	"time"
 
 	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
 	"github.com/confidentsecurity/go-nvtrust/pkg/gonscq"
 	"github.com/confidentsecurity/go-nvtrust/pkg/gonvtrust/certs"
 	"github.com/confidentsecurity/go-nvtrust/pkg/gonvtrust/gpu"
@@ -239,6 +240,42 @@ func TestVerifyGPUState(t *testing.T) {
 	}
 }
 
+func TestVerifyGPUStateVersionPolicy(t *testing.T) {
+	newManager := func(reader GPUVersionReader, policy GPUVersionPolicy) *NvidiaManager {
+		return &NvidiaManager{
+			GPUAdmin: &MockGPUAdmin{
+				AllGPUInPersistenceModeFunc: func() (bool, error) { return true, nil },
+				IsGPUReadyStateEnabledFunc:  func() (bool, error) { return false, nil },
+			},
+			VersionReader:       reader,
+			VersionPolicy:       policy,
+			VerificationTimeout: time.Minute,
+		}
+	}
+	versions := &rcevidence.GPUVersions{
+		DriverVersion: "550.90.07",
+		GPUs:          []rcevidence.GPUFirmwareInfo{{UUID: "GPU-1", VBIOSVersion: "96.00.74.00.1C", CCFirmwareVersion: "550.90.07"}},
+	}
+
+	t.Run("ok, versions meet the policy", func(t *testing.T) {
+		manager := newManager(mockVersionReader{versions: versions}, GPUVersionPolicy{MinDriverVersion: "550.54.15"})
+		require.NoError(t, manager.VerifyGPUState(t.Context()))
+	})
+
+	t.Run("fail, stale driver fails without waiting", func(t *testing.T) {
+		manager := newManager(mockVersionReader{versions: versions}, GPUVersionPolicy{MinDriverVersion: "570.86.15"})
+		start := time.Now()
+		err := manager.VerifyGPUState(t.Context())
+		require.ErrorContains(t, err, "driver version 550.90.07 is older than the minimum version 570.86.15")
+		require.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("fail, versions can't be read", func(t *testing.T) {
+		manager := newManager(mockVersionReader{err: errors.New("nvml error")}, GPUVersionPolicy{})
+		require.ErrorContains(t, manager.VerifyGPUState(t.Context()), "failed to read gpu versions: nvml error")
+	})
+}
+
 func TestEnableConfidentialCompute(t *testing.T) {
 	testCases := []struct {
 		name             string
@@ -366,6 +403,39 @@ func TestGetAttestationEvidenceList_SingleGPU(t *testing.T) {
 	assert.Len(t, evidenceList, 2)
 }
 
+func TestGetAttestationEvidenceList_GPUVersions(t *testing.T) {
+	versions := &rcevidence.GPUVersions{
+		DriverVersion: "550.90.07",
+		GPUs:          []rcevidence.GPUFirmwareInfo{{UUID: "GPU-1", VBIOSVersion: "96.00.74.00.1C", CCFirmwareVersion: "550.90.07"}},
+	}
+
+	manager := &NvidiaManager{
+		GPUAdmin: &MockGPUAdmin{
+			CollectEvidenceFunc: func(nonce []byte) ([]gpu.GPUDevice, error) {
+				certChain := certs.NewCertChainFromData(ValidCertChainData)
+				device := gpu.NewGPUDevice(nvml.DEVICE_ARCH_HOPPER, []byte("mock-attestation-report"), certChain)
+				return []gpu.GPUDevice{device}, nil
+			},
+		},
+		Verifier:                        &MockRemoteVerifier{},
+		NVSwitchAdminProvider:           &MockSwitchAdminProvider{},
+		IntermediateCertificateProvider: &MockCertificateProvider{},
+		VersionReader:                   mockVersionReader{versions: versions},
+		NonceGenerator: func() []byte {
+			return make([]byte, 32)
+		},
+	}
+
+	evidenceList, err := manager.GetAttestationEvidenceList(t.Context())
+	require.NoError(t, err)
+	require.Len(t, evidenceList, 3)
+
+	got, ok, err := rcevidence.FindGPUVersions(evidenceList)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, versions, got)
+}
+
 func TestGetAttestationEvidenceList_MultiGPU(t *testing.T) {
 	ctx := context.Background()
 
@@ -431,3 +501,56 @@ func TestGetAttestationEvidenceList_MultiGPU(t *testing.T) {
 	assert.Len(t, evidenceList, 4)
 	assert.True(t, shutdownCalled, "NVSwitch admin should be shutdown")
 }
+
+type mockMAAClient struct {
+	nonce string
+	err   error
+}
+
+func (m *mockMAAClient) AttestVM(_ context.Context, nonce string) (string, error) {
+	m.nonce = nonce
+	if m.err != nil {
+		return "", m.err
+	}
+	return "maa-token", nil
+}
+
+func TestGetAttestationEvidenceList_AzureGPU(t *testing.T) {
+	newManager := func(maa MAAClient) *NvidiaManager {
+		return &NvidiaManager{
+			GPUAdmin: &MockGPUAdmin{
+				CollectEvidenceFunc: func(nonce []byte) ([]gpu.GPUDevice, error) {
+					certChain := certs.NewCertChainFromData(ValidCertChainData)
+					device := gpu.NewGPUDevice(nvml.DEVICE_ARCH_HOPPER, []byte("mock-attestation-report"), certChain)
+					return []gpu.GPUDevice{device}, nil
+				},
+			},
+			Verifier:                        &MockRemoteVerifier{},
+			NVSwitchAdminProvider:           &MockSwitchAdminProvider{},
+			IntermediateCertificateProvider: &MockCertificateProvider{},
+			MAAClient:                       maa,
+			NonceGenerator: func() []byte {
+				return make([]byte, 32)
+			},
+		}
+	}
+
+	t.Run("ok, maa token is bound to the nras token", func(t *testing.T) {
+		maa := &mockMAAClient{}
+		evidenceList, err := newManager(maa).GetAttestationEvidenceList(t.Context())
+		require.NoError(t, err)
+		require.Len(t, evidenceList, 3)
+
+		got, ok, err := rcevidence.FindAzureGPUAttestation(evidenceList)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, "maa-token", got.MAAToken)
+		require.Equal(t, rcevidence.NRASNonce([]string{evidenceList[0].ToJWT()}), got.NRASNonce)
+		require.Equal(t, got.NRASNonce, maa.nonce)
+	})
+
+	t.Run("fail, maa attestation fails", func(t *testing.T) {
+		_, err := newManager(&mockMAAClient{err: errors.New("maa unavailable")}).GetAttestationEvidenceList(t.Context())
+		require.ErrorContains(t, err, "maa unavailable")
+	})
+}
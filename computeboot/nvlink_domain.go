@@ -0,0 +1,367 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/confidentsecurity/go-nvtrust/pkg/gonscq"
+	"github.com/confidentsecurity/go-nvtrust/pkg/gonvtrust/nvswitch"
+)
+
+const (
+	defaultNSCQTimeout = 30 * time.Second
+	// maxNSCQResponseSize bounds the responses of the out-of-band NSCQ endpoints.
+	maxNSCQResponseSize = 1 << 20
+)
+
+// NVLinkDomainConfig is config for nodes in a multi-node NVLink domain, e.g. a compute tray of a
+// GB200 NVL72 rack. The NVSwitches of the domain live in separate switch trays, so they can't be
+// reached through the local NSCQ library and are attested over the out-of-band NSCQ endpoints of
+// the trays instead.
+type NVLinkDomainConfig struct {
+	// DomainID is the cluster UUID the fabric manager assigned to the domain. The GPUs of the node
+	// must report the same cluster UUID.
+	DomainID string `yaml:"domain_id"`
+	// SwitchTrays are the switch trays of the domain.
+	SwitchTrays []SwitchTrayConfig `yaml:"switch_trays"`
+	// MinSwitchTrays is how many switch trays must be attested for the domain to be usable, e.g.
+	// while a tray is serviced. The trays that could not be attested are listed in the evidence.
+	// 0 requires all trays.
+	MinSwitchTrays int `yaml:"min_switch_trays"`
+	// Timeout bounds the requests to a single NSCQ endpoint. 0 means 30 seconds.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// SwitchTrayConfig is a switch tray of an NVLink domain.
+type SwitchTrayConfig struct {
+	// ID identifies the tray in the evidence, e.g. its position in the rack.
+	ID string `yaml:"id"`
+	// NSCQEndpoint is the https url of the out-of-band NSCQ endpoint of the tray.
+	NSCQEndpoint string `yaml:"nscq_endpoint"`
+}
+
+func (c *NVLinkDomainConfig) validate() error {
+	if c.DomainID == "" {
+		return errors.New("missing domain id")
+	}
+	if len(c.SwitchTrays) == 0 {
+		return errors.New("missing switch trays")
+	}
+	ids := map[string]bool{}
+	for _, tray := range c.SwitchTrays {
+		if tray.ID == "" {
+			return errors.New("switch tray without id")
+		}
+		if ids[tray.ID] {
+			return fmt.Errorf("duplicate switch tray %s", tray.ID)
+		}
+		ids[tray.ID] = true
+
+		u, err := url.Parse(tray.NSCQEndpoint)
+		if err != nil {
+			return fmt.Errorf("invalid nscq endpoint of switch tray %s: %w", tray.ID, err)
+		}
+		if u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("nscq endpoint of switch tray %s must be an https url", tray.ID)
+		}
+	}
+	if c.MinSwitchTrays < 0 || c.MinSwitchTrays > len(c.SwitchTrays) {
+		return fmt.Errorf("min switch trays must be between 0 and %d", len(c.SwitchTrays))
+	}
+	if c.Timeout < 0 {
+		return errors.New("timeout can't be negative")
+	}
+	return nil
+}
+
+// requiredTrays returns how many switch trays must be attested.
+func (c *NVLinkDomainConfig) requiredTrays() int {
+	if c.MinSwitchTrays == 0 {
+		return len(c.SwitchTrays)
+	}
+	return c.MinSwitchTrays
+}
+
+// oobNSCQHandler queries the NVSwitches of a switch tray through its out-of-band NSCQ endpoint.
+// It implements the same queries as the local NSCQ library, so the switch evidence is collected
+// and checked by the same nvswitch admin.
+type oobNSCQHandler struct {
+	client   *http.Client
+	endpoint string
+	// switches are the switches of the tray, read by Open.
+	switches []oobSwitch
+	arch     gonscq.Arch
+}
+
+// oobSwitches is the response to GET {endpoint}/v1/switches.
+type oobSwitches struct {
+	Arch     gonscq.Arch `json:"arch"`
+	Switches []oobSwitch `json:"switches"`
+}
+
+type oobSwitch struct {
+	UUID       string            `json:"uuid"`
+	TnvlStatus gonscq.TnvlStatus `json:"tnvl_status"`
+}
+
+// oobAttestationRequest is the body of POST {endpoint}/v1/switches/{uuid}/attestation_report.
+type oobAttestationRequest struct {
+	Nonce []byte `json:"nonce"`
+}
+
+type oobAttestationReport struct {
+	Report []byte `json:"report"`
+}
+
+type oobCertificateChain struct {
+	CertificateChain []byte `json:"certificate_chain"`
+}
+
+func newOOBNSCQHandler(client *http.Client, endpoint string) *oobNSCQHandler {
+	return &oobNSCQHandler{
+		client:   client,
+		endpoint: endpoint,
+	}
+}
+
+func (h *oobNSCQHandler) Open() error {
+	var resp oobSwitches
+	if err := h.do(http.MethodGet, nil, &resp, "v1", "switches"); err != nil {
+		return fmt.Errorf("failed to list switches: %w", err)
+	}
+	h.switches = resp.Switches
+	h.arch = resp.Arch
+	return nil
+}
+
+func (h *oobNSCQHandler) Close() {}
+
+func (h *oobNSCQHandler) GetAllSwitchUUIDs() ([]string, error) {
+	uuids := make([]string, 0, len(h.switches))
+	for _, sw := range h.switches {
+		uuids = append(uuids, sw.UUID)
+	}
+	return uuids, nil
+}
+
+func (h *oobNSCQHandler) IsSwitchTnvlMode(device string) (bool, error) {
+	sw, err := h.lookup(device)
+	if err != nil {
+		return false, err
+	}
+	return sw.TnvlStatus.IsTnvlEnabled(), nil
+}
+
+func (h *oobNSCQHandler) IsSwitchLockMode(device string) (bool, error) {
+	sw, err := h.lookup(device)
+	if err != nil {
+		return false, err
+	}
+	return sw.TnvlStatus.IsLocked(), nil
+}
+
+func (h *oobNSCQHandler) GetSwitchArchitecture() (gonscq.Arch, error) {
+	return h.arch, nil
+}
+
+func (h *oobNSCQHandler) GetSwitchAttestationReport(device string, nonce []byte) ([]byte, error) {
+	if _, err := h.lookup(device); err != nil {
+		return nil, err
+	}
+	var resp oobAttestationReport
+	if err := h.do(http.MethodPost, oobAttestationRequest{Nonce: nonce}, &resp, "v1", "switches", device, "attestation_report"); err != nil {
+		return nil, err
+	}
+	if len(resp.Report) == 0 {
+		return nil, errors.New("empty attestation report")
+	}
+	return resp.Report, nil
+}
+
+func (h *oobNSCQHandler) GetSwitchAttestationCertificateChain(device string) ([]byte, error) {
+	if _, err := h.lookup(device); err != nil {
+		return nil, err
+	}
+	var resp oobCertificateChain
+	if err := h.do(http.MethodGet, nil, &resp, "v1", "switches", device, "certificate_chain"); err != nil {
+		return nil, err
+	}
+	if len(resp.CertificateChain) == 0 {
+		return nil, errors.New("empty certificate chain")
+	}
+	return resp.CertificateChain, nil
+}
+
+func (h *oobNSCQHandler) lookup(device string) (oobSwitch, error) {
+	for _, sw := range h.switches {
+		if sw.UUID == device {
+			return sw, nil
+		}
+	}
+	return oobSwitch{}, fmt.Errorf("unknown switch %s", device)
+}
+
+func (h *oobNSCQHandler) do(method string, in, out any, elem ...string) error {
+	u, err := url.JoinPath(h.endpoint, elem...)
+	if err != nil {
+		return fmt.Errorf("invalid nscq endpoint: %w", err)
+	}
+
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxNSCQResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
+
+// nvlinkDomainSwitchAdmin collects the evidence of the NVSwitches of all switch trays of an NVLink
+// domain. Trays that fail are left out as long as enough trays remain.
+type nvlinkDomainSwitchAdmin struct {
+	cfg    *NVLinkDomainConfig
+	client *http.Client
+	// newAdmin builds the nvswitch admin of a tray, by default over its NSCQ endpoint.
+	newAdmin func(tray SwitchTrayConfig) (SwitchAdmin, error)
+	// trays and missing are the trays of the last collection.
+	trays   []rcevidence.NVLinkDomainTray
+	missing []string
+}
+
+// NVLinkDomainSwitchAdminProvider builds switch admins that attest the switch trays of an NVLink domain.
+type NVLinkDomainSwitchAdminProvider struct {
+	cfg    *NVLinkDomainConfig
+	client *http.Client
+}
+
+func NewNVLinkDomainSwitchAdminProvider(cfg *NVLinkDomainConfig) *NVLinkDomainSwitchAdminProvider {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultNSCQTimeout
+	}
+	return &NVLinkDomainSwitchAdminProvider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *NVLinkDomainSwitchAdminProvider) BuildSwitchAdmin() (SwitchAdmin, error) {
+	admin := &nvlinkDomainSwitchAdmin{
+		cfg:    p.cfg,
+		client: p.client,
+	}
+	admin.newAdmin = func(tray SwitchTrayConfig) (SwitchAdmin, error) {
+		return nvswitch.NewNscqSwitchAdmin(newOOBNSCQHandler(admin.client, tray.NSCQEndpoint))
+	}
+	return admin, nil
+}
+
+func (a *nvlinkDomainSwitchAdmin) CollectEvidence(nonce []byte) ([]nvswitch.SwitchDevice, error) {
+	a.trays = nil
+	a.missing = nil
+
+	var devices []nvswitch.SwitchDevice
+	for _, tray := range a.cfg.SwitchTrays {
+		trayDevices, err := a.collectTray(tray, nonce)
+		if err != nil {
+			slog.Warn("Failed to attest switch tray", "tray", tray.ID, "error", err)
+			a.missing = append(a.missing, tray.ID)
+			continue
+		}
+
+		uuids := make([]string, 0, len(trayDevices))
+		for _, device := range trayDevices {
+			uuids = append(uuids, device.UUID())
+		}
+		a.trays = append(a.trays, rcevidence.NVLinkDomainTray{ID: tray.ID, SwitchUUIDs: uuids})
+		devices = append(devices, trayDevices...)
+	}
+
+	if len(a.trays) < a.cfg.requiredTrays() {
+		return nil, fmt.Errorf("attested %d of %d switch trays, %d are required (missing %s)",
+			len(a.trays), len(a.cfg.SwitchTrays), a.cfg.requiredTrays(), strings.Join(a.missing, ", "))
+	}
+	if len(a.missing) > 0 {
+		slog.Warn("NVLink domain is partial", "domain_id", a.cfg.DomainID, "missing_trays", a.missing)
+	}
+	return devices, nil
+}
+
+func (a *nvlinkDomainSwitchAdmin) collectTray(tray SwitchTrayConfig, nonce []byte) ([]nvswitch.SwitchDevice, error) {
+	admin, err := a.newAdmin(tray)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := admin.Shutdown(); err != nil {
+			slog.Error("failed to shutdown nvswitch admin", "tray", tray.ID, "error", err)
+		}
+	}()
+	return admin.CollectEvidence(nonce)
+}
+
+func (*nvlinkDomainSwitchAdmin) Shutdown() error {
+	return nil
+}
+
+// domain returns the NVLink domain as attested by the last collection.
+func (a *nvlinkDomainSwitchAdmin) domain(cliqueID uint32) rcevidence.NVLinkDomain {
+	return rcevidence.NVLinkDomain{
+		DomainID:     a.cfg.DomainID,
+		CliqueID:     cliqueID,
+		Trays:        a.trays,
+		MissingTrays: a.missing,
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/confidentsecurity/go-nvtrust/pkg/gonscq"
+	"github.com/confidentsecurity/go-nvtrust/pkg/gonvtrust/nvswitch"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNVLinkDomainConfigValidate(t *testing.T) {
+	valid := func() *NVLinkDomainConfig {
+		return &NVLinkDomainConfig{
+			DomainID: "8c1f5e2a-3b4d-4e6f-9a1b-2c3d4e5f6a7b",
+			SwitchTrays: []SwitchTrayConfig{
+				{ID: "tray-1", NSCQEndpoint: "https://tray-1.bmc.internal"},
+				{ID: "tray-2", NSCQEndpoint: "https://tray-2.bmc.internal"},
+			},
+		}
+	}
+
+	tests := map[string]func(c *NVLinkDomainConfig){
+		"fail, missing domain id":      func(c *NVLinkDomainConfig) { c.DomainID = "" },
+		"fail, no switch trays":        func(c *NVLinkDomainConfig) { c.SwitchTrays = nil },
+		"fail, duplicate tray":         func(c *NVLinkDomainConfig) { c.SwitchTrays[1].ID = "tray-1" },
+		"fail, http endpoint":          func(c *NVLinkDomainConfig) { c.SwitchTrays[0].NSCQEndpoint = "http://tray-1.bmc.internal" },
+		"fail, too many required":      func(c *NVLinkDomainConfig) { c.MinSwitchTrays = 3 },
+		"fail, negative timeout":       func(c *NVLinkDomainConfig) { c.Timeout = -1 },
+		"fail, tray without id":        func(c *NVLinkDomainConfig) { c.SwitchTrays[0].ID = "" },
+		"fail, negative required tray": func(c *NVLinkDomainConfig) { c.MinSwitchTrays = -1 },
+	}
+
+	require.NoError(t, valid().validate())
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := valid()
+			mutate(c)
+			require.Error(t, c.validate())
+		})
+	}
+}
+
+func TestNVLinkDomainSwitchAdmin(t *testing.T) {
+	cfg := &NVLinkDomainConfig{
+		DomainID: "8c1f5e2a-3b4d-4e6f-9a1b-2c3d4e5f6a7b",
+		SwitchTrays: []SwitchTrayConfig{
+			{ID: "tray-1", NSCQEndpoint: "https://tray-1.bmc.internal"},
+			{ID: "tray-2", NSCQEndpoint: "https://tray-2.bmc.internal"},
+		},
+	}
+
+	newAdmin := func(cfg *NVLinkDomainConfig, failing string) *nvlinkDomainSwitchAdmin {
+		return &nvlinkDomainSwitchAdmin{
+			cfg: cfg,
+			newAdmin: func(tray SwitchTrayConfig) (SwitchAdmin, error) {
+				return &MockSwitchAdmin{
+					ShutdownFunc: func() error { return nil },
+					CollectEvidenceFunc: func(nonce []byte) ([]nvswitch.SwitchDevice, error) {
+						if tray.ID == failing {
+							return nil, errors.New("tray unreachable")
+						}
+						return []nvswitch.SwitchDevice{
+							nvswitch.NewSwitchDevice(tray.ID+"-sw-1", gonscq.ArchLS10, nonce, nil),
+							nvswitch.NewSwitchDevice(tray.ID+"-sw-2", gonscq.ArchLS10, nonce, nil),
+						}, nil
+					},
+				}, nil
+			},
+		}
+	}
+
+	t.Run("ok, all trays", func(t *testing.T) {
+		admin := newAdmin(cfg, "")
+		devices, err := admin.CollectEvidence([]byte("nonce"))
+		require.NoError(t, err)
+		require.Len(t, devices, 4)
+		require.Equal(t, rcevidence.NVLinkDomain{
+			DomainID: cfg.DomainID,
+			CliqueID: 3,
+			Trays: []rcevidence.NVLinkDomainTray{
+				{ID: "tray-1", SwitchUUIDs: []string{"tray-1-sw-1", "tray-1-sw-2"}},
+				{ID: "tray-2", SwitchUUIDs: []string{"tray-2-sw-1", "tray-2-sw-2"}},
+			},
+		}, admin.domain(3))
+	})
+
+	t.Run("fail, missing tray when all are required", func(t *testing.T) {
+		_, err := newAdmin(cfg, "tray-2").CollectEvidence([]byte("nonce"))
+		require.Error(t, err)
+	})
+
+	t.Run("ok, partial domain", func(t *testing.T) {
+		partial := *cfg
+		partial.MinSwitchTrays = 1
+		admin := newAdmin(&partial, "tray-2")
+		devices, err := admin.CollectEvidence([]byte("nonce"))
+		require.NoError(t, err)
+		require.Len(t, devices, 2)
+
+		domain := admin.domain(3)
+		require.True(t, domain.Partial())
+		require.Equal(t, []string{"tray-2"}, domain.MissingTrays)
+	})
+}
+
+func TestOOBNSCQHandler(t *testing.T) {
+	lockedTNVL := gonscq.TnvlStatus(1<<gonscq.TnvlBitPosition | 1<<gonscq.LockBitPosition)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/switches", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(oobSwitches{
+			Arch:     gonscq.ArchLS10,
+			Switches: []oobSwitch{{UUID: "sw-1", TnvlStatus: lockedTNVL}, {UUID: "sw-2"}},
+		})
+	})
+	mux.HandleFunc("POST /v1/switches/{uuid}/attestation_report", func(w http.ResponseWriter, r *http.Request) {
+		var req oobAttestationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(oobAttestationReport{Report: append([]byte(r.PathValue("uuid")+":"), req.Nonce...)})
+	})
+	mux.HandleFunc("GET /v1/switches/{uuid}/certificate_chain", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	h := newOOBNSCQHandler(srv.Client(), srv.URL)
+	require.NoError(t, h.Open())
+
+	uuids, err := h.GetAllSwitchUUIDs()
+	require.NoError(t, err)
+	require.Equal(t, []string{"sw-1", "sw-2"}, uuids)
+
+	arch, err := h.GetSwitchArchitecture()
+	require.NoError(t, err)
+	require.Equal(t, gonscq.Arch(gonscq.ArchLS10), arch)
+
+	tnvl, err := h.IsSwitchTnvlMode("sw-1")
+	require.NoError(t, err)
+	require.True(t, tnvl)
+	locked, err := h.IsSwitchLockMode("sw-2")
+	require.NoError(t, err)
+	require.False(t, locked)
+
+	report, err := h.GetSwitchAttestationReport("sw-1", []byte("nonce"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("sw-1:nonce"), report)
+
+	_, err = h.GetSwitchAttestationReport("sw-3", []byte("nonce"))
+	require.Error(t, err)
+
+	_, err = h.GetSwitchAttestationCertificateChain("sw-1")
+	require.Error(t, err)
+}
+
+func TestGPUTopologyNVLinkDomain(t *testing.T) {
+	topology := &GPUTopology{GPUs: []TopologyGPU{
+		{PCIBusID: "00000000:01:00.0", ClusterUUID: "8c1f5e2a-3b4d-4e6f-9a1b-2c3d4e5f6a7b", CliqueID: 3},
+		{PCIBusID: "00000000:02:00.0", ClusterUUID: "8c1f5e2a-3b4d-4e6f-9a1b-2c3d4e5f6a7b", CliqueID: 3},
+	}}
+
+	clusterUUID, cliqueID, err := topology.NVLinkDomain()
+	require.NoError(t, err)
+	require.Equal(t, "8c1f5e2a-3b4d-4e6f-9a1b-2c3d4e5f6a7b", clusterUUID)
+	require.Equal(t, uint32(3), cliqueID)
+
+	digest, err := topology.Digest()
+	require.NoError(t, err)
+
+	topology.GPUs[1].CliqueID = 4
+	_, _, err = topology.NVLinkDomain()
+	require.Error(t, err)
+
+	// the domain is not part of the digest, so identical systems in different domains match.
+	otherDigest, err := topology.Digest()
+	require.NoError(t, err)
+	require.Equal(t, digest, otherDigest)
+
+	topology.GPUs[1].ClusterUUID = ""
+	_, _, err = topology.NVLinkDomain()
+	require.Error(t, err)
+}
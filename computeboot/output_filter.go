@@ -0,0 +1,59 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+)
+
+// OutputFilterConfig is config for the output filter compute_worker passes the plaintext output
+// through. The digest of the filter module is disclosed in the evidence, so clients can tell which
+// operator policy applies to their responses.
+type OutputFilterConfig struct {
+	// Path is the path of the output filter module, the Go plugin router_com passes to compute_worker.
+	Path string `yaml:"path"`
+	// PCR is extended with the digest of the output filter module, so the module is covered by the
+	// TPM quote. Leave 0 for ApplicationPCR.
+	PCR uint32 `yaml:"pcr"`
+}
+
+// ReadOutputFilter returns the output filter disclosure for the module at path.
+func ReadOutputFilter(path string) (rcevidence.OutputFilter, error) {
+	module, err := os.ReadFile(path)
+	if err != nil {
+		return rcevidence.OutputFilter{}, fmt.Errorf("failed to read output filter: %w", err)
+	}
+
+	// same digest compute_worker checks before loading the module.
+	digest := sha256.Sum256(module)
+	return rcevidence.OutputFilter{Digest: hex.EncodeToString(digest[:])}, nil
+}
+
+// OutputFilterMeasurement returns the measurement of the digest of the output filter module for pcr.
+func OutputFilterMeasurement(pcr uint32, f rcevidence.OutputFilter) (Measurement, error) {
+	digest, err := hex.DecodeString(f.Digest)
+	if err != nil {
+		return Measurement{}, fmt.Errorf("invalid output filter digest: %w", err)
+	}
+	return newMeasurement(pcr, "output filter", digest), nil
+}
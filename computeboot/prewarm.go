@@ -0,0 +1,182 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/routercom/modelstate"
+	"github.com/openpcc/openpcc/otel/otelutil"
+	"gopkg.in/yaml.v3"
+)
+
+type PrewarmOrder int
+
+const (
+	// PrewarmConfigOrder prewarms models in the order they appear in the config.
+	PrewarmConfigOrder PrewarmOrder = iota
+	// PrewarmLargestFirst prewarms the largest models first, so they are most likely to fit in GPU memory.
+	PrewarmLargestFirst
+)
+
+func (o PrewarmOrder) String() string {
+	switch o {
+	case PrewarmConfigOrder:
+		return "config"
+	case PrewarmLargestFirst:
+		return "largest_first"
+	default:
+		return fmt.Sprintf("PrewarmOrder(%d)", int(o))
+	}
+}
+
+func (o PrewarmOrder) MarshalYAML() (any, error) {
+	return o.String(), nil
+}
+
+func (o *PrewarmOrder) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+
+	switch s {
+	case "", "config":
+		*o = PrewarmConfigOrder
+	case "largest_first":
+		*o = PrewarmLargestFirst
+	default:
+		return fmt.Errorf("unknown prewarm order: %s", s)
+	}
+
+	return nil
+}
+
+// prewarmPlan orders the models and splits them into models to prewarm and models that
+// won't fit in the GPU memory budget. Models remain loaded after prewarming, so the budget
+// is shared by all prewarmed models.
+func prewarmPlan(models []string, sizes map[string]uint64, order PrewarmOrder, budget uint64) ([]string, []string) {
+	ordered := slices.Clone(models)
+	if order == PrewarmLargestFirst {
+		slices.SortStableFunc(ordered, func(a, b string) int {
+			switch {
+			case sizes[a] > sizes[b]:
+				return -1
+			case sizes[a] < sizes[b]:
+				return 1
+			default:
+				return 0
+			}
+		})
+	}
+
+	if budget == 0 {
+		return ordered, nil
+	}
+
+	var (
+		warm []string
+		cold []string
+		used uint64
+	)
+	for _, model := range ordered {
+		if used+sizes[model] > budget {
+			cold = append(cold, model)
+			continue
+		}
+		used += sizes[model]
+		warm = append(warm, model)
+	}
+
+	return warm, cold
+}
+
+// Prewarm loads the configured models into memory and returns the warm/cold state of every model.
+// Models are prewarmed in parallel up to the configured concurrency. A model that fails to prewarm
+// is reported cold, so the node still serves its other models. Prewarm only fails when no model
+// could be prewarmed.
+func (eng *InferenceEngineInitializer) Prewarm(ctx context.Context) ([]modelstate.State, error) {
+	ctx, span := otelutil.Tracer.Start(ctx, "computeboot.Prewarm")
+	defer span.End()
+
+	warm, cold := prewarmPlan(eng.models, eng.modelSizes, eng.prewarmOrder, eng.gpuMemoryBytes)
+
+	states := make(map[string]modelstate.State, len(eng.models))
+	for _, model := range cold {
+		slog.WarnContext(ctx, "Model does not fit in GPU memory budget, skipping prewarm", "model", model, "size", eng.modelSizes[model])
+		states[model] = modelstate.State{
+			Model:  model,
+			Reason: "does not fit in gpu memory budget",
+		}
+	}
+
+	concurrency := max(eng.prewarmConcurrency, 1)
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+		sem  = make(chan struct{}, concurrency)
+	)
+	for _, model := range warm {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+
+			state := modelstate.State{Model: model}
+			err := eng.PrewarmModel(ctx, model)
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to prewarm model, model stays cold", "model", model, "error", err)
+				state.Reason = "prewarm failed"
+			} else {
+				state.Warm = true
+				state.PrewarmedAt = time.Now()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			states[model] = state
+			if err != nil {
+				errs = append(errs, err)
+			}
+		})
+	}
+	wg.Wait()
+
+	// report the states in config order.
+	result := make([]modelstate.State, 0, len(eng.models))
+	anyWarm := false
+	for _, model := range eng.models {
+		result = append(result, states[model])
+		anyWarm = anyWarm || states[model].Warm
+	}
+
+	if !anyWarm && len(eng.models) > 0 {
+		if err := errors.Join(errs...); err != nil {
+			return result, otelutil.Errorf(span, "failed to prewarm any model: %w", err)
+		}
+		return result, otelutil.Errorf(span, "no model fits in gpu memory budget")
+	}
+
+	return result, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrewarmOrderString(t *testing.T) {
+	require.Equal(t, "config", PrewarmConfigOrder.String())
+	require.Equal(t, "largest_first", PrewarmLargestFirst.String())
+	require.Equal(t, "PrewarmOrder(7)", PrewarmOrder(7).String())
+	require.Equal(t, "PrewarmOrder(-1)", PrewarmOrder(-1).String())
+}
+
+func TestPrewarmPlan(t *testing.T) {
+	sizes := map[string]uint64{
+		"small":  1,
+		"medium": 4,
+		"large":  8,
+	}
+	models := []string{"small", "medium", "large"}
+
+	tests := map[string]struct {
+		order    PrewarmOrder
+		budget   uint64
+		wantWarm []string
+		wantCold []string
+	}{
+		"ok, config order without budget": {
+			order:    PrewarmConfigOrder,
+			wantWarm: []string{"small", "medium", "large"},
+		},
+		"ok, largest first without budget": {
+			order:    PrewarmLargestFirst,
+			wantWarm: []string{"large", "medium", "small"},
+		},
+		"ok, config order skips models that don't fit": {
+			order:    PrewarmConfigOrder,
+			budget:   9,
+			wantWarm: []string{"small", "medium"},
+			wantCold: []string{"large"},
+		},
+		"ok, largest first prioritizes large models": {
+			order:    PrewarmLargestFirst,
+			budget:   9,
+			wantWarm: []string{"large", "small"},
+			wantCold: []string{"medium"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			warm, cold := prewarmPlan(models, sizes, tc.order, tc.budget)
+			require.Equal(t, tc.wantWarm, warm)
+			require.Equal(t, tc.wantCold, cold)
+		})
+	}
+}
+
+func TestPrewarm(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		prewarmed []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.CompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if req.Model == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		mu.Lock()
+		prewarmed = append(prewarmed, req.Model)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	t.Run("ok, parallel prewarm reports warm and cold models", func(t *testing.T) {
+		prewarmed = nil
+		eng := NewInferenceEngineInitializerWithConfig(&InferenceEngineConfig{
+			Models:             []string{"a", "b", "c"},
+			URL:                srv.URL,
+			PrewarmConcurrency: 2,
+			ModelSizes:         map[string]uint64{"a": 2, "b": 2, "c": 2},
+			GPUMemoryBytes:     4,
+		})
+
+		states, err := eng.Prewarm(t.Context())
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"a", "b"}, prewarmed)
+		require.Len(t, states, 3)
+		require.True(t, states[0].Warm)
+		require.True(t, states[1].Warm)
+		require.False(t, states[2].Warm)
+		require.Equal(t, "c", states[2].Model)
+	})
+
+	t.Run("ok, failed prewarm leaves model cold", func(t *testing.T) {
+		prewarmed = nil
+		eng := NewInferenceEngineInitializerWithConfig(&InferenceEngineConfig{
+			Models: []string{"a", "broken"},
+			URL:    srv.URL,
+		})
+
+		states, err := eng.Prewarm(t.Context())
+		require.NoError(t, err)
+		require.Len(t, states, 2)
+		require.True(t, states[0].Warm)
+		require.False(t, states[1].Warm)
+		require.Equal(t, "prewarm failed", states[1].Reason)
+	})
+
+	t.Run("fail, no model prewarmed", func(t *testing.T) {
+		prewarmed = nil
+		eng := NewInferenceEngineInitializerWithConfig(&InferenceEngineConfig{
+			Models: []string{"broken"},
+			URL:    srv.URL,
+		})
+
+		states, err := eng.Prewarm(t.Context())
+		require.Error(t, err)
+		require.Len(t, states, 1)
+		require.False(t, states[0].Warm)
+	})
+}
@@ -0,0 +1,148 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/google/go-tpm/tpm2"
+)
+
+// DefaultQuoteChainMaxLinks is the default number of quotes kept in the quote chain.
+const DefaultQuoteChainMaxLinks = 32
+
+// quoteChainPCRs are the PCRs of the chained quotes, the boot chain of the node.
+var quoteChainPCRs = []uint{0, 1, 2, 3, 4, 5, 6, 7}
+
+// QuoteChainConfig is config for the local audit trail of TPM quotes. Every attestation of the node
+// adds a quote that carries the digest of the previous one, the chain is included in the evidence.
+type QuoteChainConfig struct {
+	// Path is the file the chain is kept in. It must survive reboots, the chain is only continuous
+	// across the attestations that found it.
+	Path string `yaml:"path"`
+	// MaxLinks is the number of quotes kept, older quotes are dropped. Leave 0 for DefaultQuoteChainMaxLinks.
+	MaxLinks int `yaml:"max_links"`
+}
+
+// ExtendQuoteChain quotes the boot chain PCRs with the attestation key, with the digest of the last
+// quote of the chain at cfg.Path as extra data, and saves the extended chain. Re-attestations extend
+// the same chain, so verifiers can tell the same TPM attested the node over time.
+func ExtendQuoteChain(tpmDevice TPMDevice, akHandle uint32, cfg *QuoteChainConfig) (rcevidence.QuoteChain, error) {
+	if cfg.Path == "" {
+		return rcevidence.QuoteChain{}, errors.New("missing quote chain path")
+	}
+
+	chain, err := readQuoteChain(cfg.Path)
+	if err != nil {
+		// a chain that can't be read can't be extended, a new chain makes the break visible to verifiers.
+		slog.Warn("Starting a new quote chain", "path", cfg.Path, "error", err)
+		chain = rcevidence.QuoteChain{}
+	}
+
+	thetpm, err := tpmDevice.OpenDevice()
+	if err != nil {
+		return rcevidence.QuoteChain{}, fmt.Errorf("could not connect to TPM: %w", err)
+	}
+
+	pub, err := tpm2.ReadPublic{ObjectHandle: tpm2.TPMHandle(akHandle)}.Execute(thetpm)
+	if err != nil {
+		return rcevidence.QuoteChain{}, fmt.Errorf("failed to read attestation key: %w", err)
+	}
+
+	rsp, err := tpm2.Quote{
+		SignHandle: tpm2.AuthHandle{
+			Handle: tpm2.TPMHandle(akHandle),
+			Name:   pub.Name,
+			Auth:   tpm2.PasswordAuth(nil),
+		},
+		QualifyingData: tpm2.TPM2BData{Buffer: chain.NextExtraData()},
+		InScheme:       tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgNull},
+		PCRSelect: tpm2.TPMLPCRSelection{
+			PCRSelections: []tpm2.TPMSPCRSelection{
+				{
+					Hash:      tpm2.TPMAlgSHA256,
+					PCRSelect: tpm2.PCClientCompatible.PCRs(quoteChainPCRs...),
+				},
+			},
+		},
+	}.Execute(thetpm)
+	if err != nil {
+		return rcevidence.QuoteChain{}, fmt.Errorf("failed to quote: %w", err)
+	}
+
+	chain.Links = append(chain.Links, rcevidence.QuoteChainLink{
+		Quote:     rsp.Quoted.Bytes(),
+		Signature: tpm2.Marshal(rsp.Signature),
+	})
+	maxLinks := cfg.MaxLinks
+	if maxLinks <= 0 {
+		maxLinks = DefaultQuoteChainMaxLinks
+	}
+	if len(chain.Links) > maxLinks {
+		chain.Links = chain.Links[len(chain.Links)-maxLinks:]
+	}
+
+	if err := writeQuoteChain(cfg.Path, chain); err != nil {
+		return rcevidence.QuoteChain{}, err
+	}
+	return chain, nil
+}
+
+// readQuoteChain reads the chain at path, an empty chain when there is none yet.
+func readQuoteChain(path string) (rcevidence.QuoteChain, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return rcevidence.QuoteChain{}, nil
+	}
+	if err != nil {
+		return rcevidence.QuoteChain{}, fmt.Errorf("failed to read quote chain: %w", err)
+	}
+
+	var chain rcevidence.QuoteChain
+	if err := json.Unmarshal(b, &chain); err != nil {
+		return rcevidence.QuoteChain{}, fmt.Errorf("failed to unmarshal quote chain: %w", err)
+	}
+	return chain, nil
+}
+
+func writeQuoteChain(path string, chain rcevidence.QuoteChain) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create quote chain directory: %w", err)
+	}
+
+	b, err := json.Marshal(chain)
+	if err != nil {
+		return fmt.Errorf("failed to marshal quote chain: %w", err)
+	}
+
+	// write to a temporary file first so a crash never leaves a partial chain behind.
+	if err := os.WriteFile(path+".tmp", b, 0o600); err != nil {
+		return fmt.Errorf("failed to write quote chain: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to rename quote chain: %w", err)
+	}
+	return nil
+}
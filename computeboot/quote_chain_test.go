@@ -0,0 +1,71 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtendQuoteChain(t *testing.T) {
+	device := NewTPMInMemorySimulator()
+	defer device.Close()
+
+	akHandle, akPublic := createTestAK(t, device)
+
+	t.Run("ok, every attestation extends the chain", func(t *testing.T) {
+		cfg := &QuoteChainConfig{Path: filepath.Join(t.TempDir(), "state", "quote_chain.json"), MaxLinks: 2}
+
+		chain, err := ExtendQuoteChain(device, akHandle, cfg)
+		require.NoError(t, err)
+		require.Len(t, chain.Links, 1)
+		require.NoError(t, chain.Verify(akPublic))
+
+		first := chain.Links[0]
+		for range 2 {
+			chain, err = ExtendQuoteChain(device, akHandle, cfg)
+			require.NoError(t, err)
+		}
+		// the oldest quote was dropped, the rest of the chain still verifies.
+		require.Len(t, chain.Links, 2)
+		require.NotEqual(t, first, chain.Links[0])
+		require.NoError(t, chain.Verify(akPublic))
+
+		saved, err := readQuoteChain(cfg.Path)
+		require.NoError(t, err)
+		require.Equal(t, chain, saved)
+	})
+
+	t.Run("ok, unreadable chain starts a new chain", func(t *testing.T) {
+		cfg := &QuoteChainConfig{Path: filepath.Join(t.TempDir(), "quote_chain.json")}
+		require.NoError(t, os.WriteFile(cfg.Path, []byte("{"), 0o600))
+
+		chain, err := ExtendQuoteChain(device, akHandle, cfg)
+		require.NoError(t, err)
+		require.Len(t, chain.Links, 1)
+		require.NoError(t, chain.Verify(akPublic))
+	})
+
+	t.Run("fail, missing path", func(t *testing.T) {
+		_, err := ExtendQuoteChain(device, akHandle, &QuoteChainConfig{})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,87 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeboot
+
+import (
+	"fmt"
+	"log/slog"
+
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpmutil"
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	cstpm "github.com/openpcc/openpcc/tpm"
+)
+
+// createRefundKey creates the refund key under parent and persists it at handle. The key has the PCR
+// policy of the REK, so compute_worker can only sign refunds while the PCRs have their golden values.
+func createRefundKey(thetpm transport.TPM, parent tpm2.NamedHandle, policy []byte, handle tpmutil.Handle) error {
+	createRsp, err := tpm2.Create{
+		ParentHandle: tpm2.AuthHandle{Handle: parent.Handle, Name: parent.Name, Auth: tpm2.PasswordAuth(nil)},
+		InPublic:     tpm2.New2B(rcevidence.RefundKeyTemplate(policy)),
+	}.Execute(thetpm)
+	if err != nil {
+		return fmt.Errorf("could not create refund key: %w", err)
+	}
+
+	loadRsp, err := tpm2.Load{
+		ParentHandle: tpm2.AuthHandle{Handle: parent.Handle, Name: parent.Name, Auth: tpm2.PasswordAuth(nil)},
+		InPrivate:    createRsp.OutPrivate,
+		InPublic:     createRsp.OutPublic,
+	}.Execute(thetpm)
+	if err != nil {
+		return fmt.Errorf("could not load refund key: %w", err)
+	}
+
+	defer func() {
+		if _, err := (tpm2.FlushContext{FlushHandle: loadRsp.ObjectHandle}).Execute(thetpm); err != nil {
+			slog.Error("Failed to flush context", "err", err)
+		}
+	}()
+
+	err = cstpm.MaybeClearPersistentHandle(thetpm, handle)
+	if err != nil {
+		return fmt.Errorf("error clearing handle 0x%x: %w", handle, err)
+	}
+
+	err = cstpm.PersistObject(thetpm, tpmutil.Handle(loadRsp.ObjectHandle), handle)
+	if err != nil {
+		return fmt.Errorf("could not persist refund key to 0x%x: %w", handle, err)
+	}
+
+	slog.Info("Refund key handle:", "handle", fmt.Sprintf("0x%x", handle))
+	return nil
+}
+
+// refundKeyPiece returns the evidence piece disclosing the refund key persisted at handle.
+func refundKeyPiece(tpmDevice TPMDevice, handle uint32) (*ev.SignedEvidencePiece, error) {
+	thetpm, err := tpmDevice.OpenDevice()
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to TPM: %w", err)
+	}
+
+	pub, err := tpm2.ReadPublic{ObjectHandle: tpm2.TPMHandle(handle)}.Execute(thetpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read refund key: %w", err)
+	}
+	public, err := pub.OutPublic.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read refund key: %w", err)
+	}
+	return rcevidence.RefundKeyPiece(rcevidence.RefundKey{Public: tpm2.Marshal(public)})
+}
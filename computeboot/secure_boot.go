@@ -0,0 +1,228 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+)
+
+// SecureBootConfig is config for including the UEFI Secure Boot state in the evidence, so verifiers
+// can reject nodes with Secure Boot disabled or stale revocation data.
+type SecureBootConfig struct {
+	// Require fails the boot when Secure Boot is not enforcing, instead of leaving it to verifiers.
+	Require bool `yaml:"require"`
+}
+
+const (
+	efiGlobalVariableGUID  = "8be4df61-93ca-11d2-aa0d-00e098032b8c"
+	efiImageSecurityDBGUID = "d719b2cb-3d3a-4596-a3bc-dad00e67656f"
+	efiCertX509GUID        = "a5c059a1-94e4-4aa7-87b5-ab155c2bf072"
+)
+
+// efiSignatureListHeaderLen is the length of EFI_SIGNATURE_LIST without its signature header.
+const efiSignatureListHeaderLen = 28
+
+var efivarsDir = "/sys/firmware/efi/efivars"
+
+// secureBootVariable is a variable the firmware measures into PCR 7, in measurement order.
+type secureBootVariable struct {
+	name string
+	guid string
+}
+
+var secureBootVariables = []secureBootVariable{
+	{name: "SecureBoot", guid: efiGlobalVariableGUID},
+	{name: "PK", guid: efiGlobalVariableGUID},
+	{name: "KEK", guid: efiGlobalVariableGUID},
+	{name: "db", guid: efiImageSecurityDBGUID},
+	{name: "dbx", guid: efiImageSecurityDBGUID},
+}
+
+// ReadSecureBoot reads the Secure Boot state from efivarfs.
+func ReadSecureBoot() (rcevidence.SecureBoot, error) {
+	if _, err := os.Stat(efivarsDir); err != nil {
+		return rcevidence.SecureBoot{}, fmt.Errorf("failed to read efi variables, the node was not booted with UEFI: %w", err)
+	}
+
+	state := rcevidence.SecureBoot{
+		PK:        []rcevidence.SecureBootKey{},
+		KEK:       []rcevidence.SecureBootKey{},
+		Variables: make([]rcevidence.SecureBootVariable, 0, len(secureBootVariables)),
+	}
+
+	setupMode, err := readEFIVariable("SetupMode", efiGlobalVariableGUID)
+	if err != nil {
+		return rcevidence.SecureBoot{}, err
+	}
+	state.SetupMode = len(setupMode) > 0 && setupMode[0] == 1
+
+	for _, v := range secureBootVariables {
+		data, err := readEFIVariable(v.name, v.guid)
+		if err != nil {
+			return rcevidence.SecureBoot{}, err
+		}
+
+		digest, err := efiVariableEventDigest(v.name, v.guid, data)
+		if err != nil {
+			return rcevidence.SecureBoot{}, err
+		}
+		state.Variables = append(state.Variables, rcevidence.SecureBootVariable{
+			Name:        v.name,
+			EventDigest: hex.EncodeToString(digest),
+		})
+
+		switch v.name {
+		case "SecureBoot":
+			state.Enabled = len(data) > 0 && data[0] == 1
+		case "PK", "KEK", "dbx":
+			keys, err := parseEFISignatureLists(data)
+			if err != nil {
+				return rcevidence.SecureBoot{}, fmt.Errorf("failed to parse %s: %w", v.name, err)
+			}
+			switch v.name {
+			case "PK":
+				state.PK = keys
+			case "KEK":
+				state.KEK = keys
+			default:
+				state.DBXEntries = len(keys)
+			}
+		}
+	}
+
+	return state, nil
+}
+
+// readEFIVariable reads the data of an EFI variable without its attributes, nil when the variable
+// doesn't exist.
+func readEFIVariable(name, guid string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(efivarsDir, name+"-"+guid))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read efi variable %s: %w", name, err)
+	}
+	// efivarfs prefixes the data with the 4 byte variable attributes.
+	if len(data) < 4 {
+		return nil, fmt.Errorf("efi variable %s is too short", name)
+	}
+	return data[4:], nil
+}
+
+// efiVariableEventDigest returns the SHA-256 digest of the UEFI_VARIABLE_DATA of a variable, as
+// measured by the firmware in an EV_EFI_VARIABLE_DRIVER_CONFIG event.
+func efiVariableEventDigest(name, guid string, data []byte) ([]byte, error) {
+	guidBytes, err := encodeEFIGUID(guid)
+	if err != nil {
+		return nil, err
+	}
+	unicodeName := utf16.Encode([]rune(name))
+
+	var buf bytes.Buffer
+	buf.Write(guidBytes)
+	_ = binary.Write(&buf, binary.LittleEndian, uint64(len(unicodeName)))
+	_ = binary.Write(&buf, binary.LittleEndian, uint64(len(data)))
+	_ = binary.Write(&buf, binary.LittleEndian, unicodeName)
+	buf.Write(data)
+
+	digest := sha256.Sum256(buf.Bytes())
+	return digest[:], nil
+}
+
+// parseEFISignatureLists parses the EFI_SIGNATURE_LISTs of a signature database.
+func parseEFISignatureLists(b []byte) ([]rcevidence.SecureBootKey, error) {
+	keys := []rcevidence.SecureBootKey{}
+	for len(b) > 0 {
+		if len(b) < efiSignatureListHeaderLen {
+			return nil, errors.New("truncated signature list")
+		}
+		sigType := decodeEFIGUID(b[0:16])
+		listSize := int(binary.LittleEndian.Uint32(b[16:20]))
+		headerSize := int(binary.LittleEndian.Uint32(b[20:24]))
+		sigSize := int(binary.LittleEndian.Uint32(b[24:28]))
+		if listSize < efiSignatureListHeaderLen+headerSize || listSize > len(b) || sigSize <= 16 {
+			return nil, errors.New("invalid signature list size")
+		}
+
+		sigs := b[efiSignatureListHeaderLen+headerSize : listSize]
+		if len(sigs)%sigSize != 0 {
+			return nil, errors.New("signature list size is not a multiple of the signature size")
+		}
+		for ; len(sigs) > 0; sigs = sigs[sigSize:] {
+			keys = append(keys, newSecureBootKey(sigType, sigs[:16], sigs[16:sigSize]))
+		}
+
+		b = b[listSize:]
+	}
+	return keys, nil
+}
+
+func newSecureBootKey(sigType string, owner, data []byte) rcevidence.SecureBootKey {
+	digest := sha256.Sum256(data)
+	key := rcevidence.SecureBootKey{
+		Type:   sigType,
+		Owner:  decodeEFIGUID(owner),
+		Digest: hex.EncodeToString(digest[:]),
+	}
+	if sigType == efiCertX509GUID {
+		key.Type = "x509"
+		// firmware certificates don't always parse, the digest still identifies them.
+		if cert, err := x509.ParseCertificate(data); err == nil {
+			key.Subject = cert.Subject.String()
+		}
+	}
+	return key
+}
+
+// encodeEFIGUID encodes a GUID in the mixed endian EFI_GUID layout.
+func encodeEFIGUID(guid string) ([]byte, error) {
+	b, err := hex.DecodeString(strings.ReplaceAll(guid, "-", ""))
+	if err != nil || len(b) != 16 {
+		return nil, fmt.Errorf("invalid guid %q", guid)
+	}
+	// the first three groups are little endian.
+	b[0], b[1], b[2], b[3] = b[3], b[2], b[1], b[0]
+	b[4], b[5] = b[5], b[4]
+	b[6], b[7] = b[7], b[6]
+	return b, nil
+}
+
+// decodeEFIGUID formats a GUID in the EFI_GUID layout.
+func decodeEFIGUID(b []byte) string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(b[0:4]),
+		binary.LittleEndian.Uint16(b[4:6]),
+		binary.LittleEndian.Uint16(b[6:8]),
+		b[8:10],
+		b[10:16],
+	)
+}
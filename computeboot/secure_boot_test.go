@@ -0,0 +1,167 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const efiCertSHA256GUID = "c1c41626-504c-4092-aca9-41f936934328"
+
+// efiSignatureList encodes an EFI_SIGNATURE_LIST with the given signatures of equal size.
+func efiSignatureList(t *testing.T, sigType, owner string, sigs ...[]byte) []byte {
+	typeBytes, err := encodeEFIGUID(sigType)
+	require.NoError(t, err)
+	ownerBytes, err := encodeEFIGUID(owner)
+	require.NoError(t, err)
+
+	sigSize := 16 + len(sigs[0])
+	b := append([]byte{}, typeBytes...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(efiSignatureListHeaderLen+len(sigs)*sigSize)) // #nosec G115 -- test data.
+	b = binary.LittleEndian.AppendUint32(b, 0)
+	b = binary.LittleEndian.AppendUint32(b, uint32(sigSize)) // #nosec G115 -- test data.
+	for _, sig := range sigs {
+		b = append(b, ownerBytes...)
+		b = append(b, sig...)
+	}
+	return b
+}
+
+func testCertificate(t *testing.T, cn string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return der
+}
+
+func TestReadSecureBoot(t *testing.T) {
+	const owner = "77fa9abd-0359-4d32-bd60-28f4e78f784b"
+
+	setup := func(t *testing.T, vars map[string][]byte) {
+		orig := efivarsDir
+		t.Cleanup(func() { efivarsDir = orig })
+		efivarsDir = t.TempDir()
+		for name, data := range vars {
+			// efivarfs prefixes the data with the variable attributes.
+			attrs := []byte{0x06, 0x00, 0x00, 0x00}
+			require.NoError(t, os.WriteFile(filepath.Join(efivarsDir, name), append(attrs, data...), 0o600))
+		}
+	}
+
+	pk := testCertificate(t, "Test Platform Key")
+	kek := testCertificate(t, "Test KEK")
+	revoked1 := sha256.Sum256([]byte("revoked 1"))
+	revoked2 := sha256.Sum256([]byte("revoked 2"))
+
+	t.Run("ok, enforcing", func(t *testing.T) {
+		setup(t, map[string][]byte{
+			"SecureBoot-" + efiGlobalVariableGUID: {1},
+			"SetupMode-" + efiGlobalVariableGUID:  {0},
+			"PK-" + efiGlobalVariableGUID:         efiSignatureList(t, efiCertX509GUID, owner, pk),
+			"KEK-" + efiGlobalVariableGUID:        efiSignatureList(t, efiCertX509GUID, owner, kek),
+			"dbx-" + efiImageSecurityDBGUID:       efiSignatureList(t, efiCertSHA256GUID, owner, revoked1[:], revoked2[:]),
+		})
+
+		state, err := ReadSecureBoot()
+		require.NoError(t, err)
+		require.True(t, state.Enabled)
+		require.False(t, state.SetupMode)
+		require.True(t, state.Enforcing())
+
+		require.Len(t, state.PK, 1)
+		require.Equal(t, "x509", state.PK[0].Type)
+		require.Equal(t, owner, state.PK[0].Owner)
+		require.Equal(t, "CN=Test Platform Key", state.PK[0].Subject)
+		pkDigest := sha256.Sum256(pk)
+		require.Equal(t, hex.EncodeToString(pkDigest[:]), state.PK[0].Digest)
+		require.Len(t, state.KEK, 1)
+		require.Equal(t, "CN=Test KEK", state.KEK[0].Subject)
+		require.Equal(t, 2, state.DBXEntries)
+
+		require.Len(t, state.Variables, 5)
+		// the well known digest of the SecureBoot variable of an enabled node in PCR 7.
+		require.Equal(t, "SecureBoot", state.Variables[0].Name)
+		require.Equal(t, "ccfc4bb32888a345bc8aeadaba552b627d99348c767681ab3141f5b01e40a40e", state.Variables[0].EventDigest)
+		require.NoError(t, state.Validate())
+	})
+
+	t.Run("ok, disabled in setup mode", func(t *testing.T) {
+		setup(t, map[string][]byte{
+			"SecureBoot-" + efiGlobalVariableGUID: {0},
+			"SetupMode-" + efiGlobalVariableGUID:  {1},
+		})
+
+		state, err := ReadSecureBoot()
+		require.NoError(t, err)
+		require.False(t, state.Enabled)
+		require.True(t, state.SetupMode)
+		require.False(t, state.Enforcing())
+		require.Empty(t, state.PK)
+		require.Zero(t, state.DBXEntries)
+	})
+
+	t.Run("fail, invalid signature list", func(t *testing.T) {
+		list := efiSignatureList(t, efiCertX509GUID, owner, pk)
+		setup(t, map[string][]byte{
+			"PK-" + efiGlobalVariableGUID: list[:len(list)-1],
+		})
+
+		_, err := ReadSecureBoot()
+		require.Error(t, err)
+	})
+
+	t.Run("fail, no efivarfs", func(t *testing.T) {
+		orig := efivarsDir
+		t.Cleanup(func() { efivarsDir = orig })
+		efivarsDir = filepath.Join(t.TempDir(), "missing")
+
+		_, err := ReadSecureBoot()
+		require.Error(t, err)
+	})
+}
+
+func TestEFIGUID(t *testing.T) {
+	b, err := encodeEFIGUID(efiGlobalVariableGUID)
+	require.NoError(t, err)
+	require.Equal(t, "61dfe48bca93d211aa0d00e098032b8c", hex.EncodeToString(b))
+	require.Equal(t, efiGlobalVariableGUID, decodeEFIGUID(b))
+
+	_, err = encodeEFIGUID("not-a-guid")
+	require.Error(t, err)
+}
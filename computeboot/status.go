@@ -0,0 +1,261 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// PhaseState is the state of a single phase as reported by the status endpoint.
+type PhaseState string
+
+const (
+	PhaseStateRunning   PhaseState = "running"
+	PhaseStateCompleted PhaseState = "completed"
+	// PhaseStateResumed is a phase that completed before a restart and was not run again.
+	PhaseStateResumed PhaseState = "resumed"
+	PhaseStateFailed  PhaseState = "failed"
+)
+
+// StatusConfig is config for the boot progress endpoint.
+type StatusConfig struct {
+	// Addr is the loopback address the status endpoint listens on, e.g. 127.0.0.1:8089. Leave blank
+	// to disable the status endpoint.
+	Addr string `yaml:"addr"`
+}
+
+// PhaseStatus is the progress of a single phase.
+type PhaseStatus struct {
+	Phase     Phase      `json:"phase"`
+	State     PhaseState `json:"state"`
+	StartedAt time.Time  `json:"started_at"`
+	// DurationMS is how long the phase took, or has been running for.
+	DurationMS int64 `json:"duration_ms"`
+}
+
+// BootStatus is the progress of compute_boot as reported by the status endpoint.
+type BootStatus struct {
+	StartedAt time.Time `json:"started_at"`
+	// Phase is the phase that is currently running, empty when no phase is running.
+	Phase  Phase         `json:"phase"`
+	Phases []PhaseStatus `json:"phases"`
+	// Done is true once the boot has finished successfully.
+	Done bool `json:"done"`
+	// LastError is the last error of the boot, empty if there was none.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// BootProgress tracks the progress of compute_boot. All methods are safe to call on a nil BootProgress.
+type BootProgress struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	startedAt time.Time
+	current   Phase
+	phases    []PhaseStatus
+	done      bool
+	lastError string
+}
+
+func NewBootProgress() *BootProgress {
+	return &BootProgress{
+		now:       time.Now,
+		startedAt: time.Now(),
+	}
+}
+
+func (p *BootProgress) phaseStarted(phase Phase) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current = phase
+	p.setPhase(PhaseStatus{Phase: phase, State: PhaseStateRunning, StartedAt: p.now()})
+}
+
+func (p *BootProgress) phaseResumed(phase Phase, completedAt time.Time) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.setPhase(PhaseStatus{Phase: phase, State: PhaseStateResumed, StartedAt: completedAt})
+}
+
+func (p *BootProgress) phaseEnded(phase Phase, err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current = ""
+	for i := range p.phases {
+		if p.phases[i].Phase != phase {
+			continue
+		}
+		p.phases[i].State = PhaseStateCompleted
+		p.phases[i].DurationMS = p.now().Sub(p.phases[i].StartedAt).Milliseconds()
+		if err != nil {
+			p.phases[i].State = PhaseStateFailed
+			p.lastError = err.Error()
+		}
+	}
+}
+
+// setPhase replaces the status of a phase that ran before, phases run again when they expired.
+func (p *BootProgress) setPhase(status PhaseStatus) {
+	for i := range p.phases {
+		if p.phases[i].Phase == status.Phase {
+			p.phases[i] = status
+			return
+		}
+	}
+	p.phases = append(p.phases, status)
+}
+
+// Failed records an error that occurred outside of the boot phases.
+func (p *BootProgress) Failed(err error) {
+	if p == nil || err == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastError = err.Error()
+}
+
+// Finished marks the boot as finished successfully.
+func (p *BootProgress) Finished() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done = true
+}
+
+// Status returns a snapshot of the boot progress.
+func (p *BootProgress) Status() BootStatus {
+	if p == nil {
+		return BootStatus{}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := BootStatus{
+		StartedAt: p.startedAt,
+		Phase:     p.current,
+		Phases:    make([]PhaseStatus, 0, len(p.phases)),
+		Done:      p.done,
+		LastError: p.lastError,
+	}
+	for _, phase := range p.phases {
+		if phase.State == PhaseStateRunning {
+			phase.DurationMS = p.now().Sub(phase.StartedAt).Milliseconds()
+		}
+		status.Phases = append(status.Phases, phase)
+	}
+	return status
+}
+
+// StatusServer serves the boot progress on a loopback address, for operators and the VM health agent.
+type StatusServer struct {
+	cfg      *StatusConfig
+	progress *BootProgress
+	server   *http.Server
+}
+
+func NewStatusServer(cfg *StatusConfig, progress *BootProgress) *StatusServer {
+	s := &StatusServer{
+		cfg:      cfg,
+		progress: progress,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.statusHandler)
+
+	s.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	return s
+}
+
+// Start starts listening on the configured address and serves the boot progress in the background.
+func (s *StatusServer) Start() error {
+	if err := validateLoopbackAddr(s.cfg.Addr); err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on status address: %w", err)
+	}
+
+	slog.Info("Serving boot status", "addr", listener.Addr().String())
+	go func() {
+		err := s.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("boot status endpoint stopped unexpectedly", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+func (s *StatusServer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+func (s *StatusServer) statusHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.progress.Status()); err != nil {
+		slog.Error("failed to write boot status", "error", err)
+	}
+}
+
+// validateLoopbackAddr only allows addresses on the loopback interface, the status endpoint is not
+// meant to be reachable from outside the VM.
+func validateLoopbackAddr(addr string) error {
+	if addr == "" {
+		return errors.New("missing status address")
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid status address: %w", err)
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("status address %s is not a loopback address", addr)
+	}
+	return nil
+}
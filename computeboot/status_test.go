@@ -0,0 +1,135 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBootProgress(t *testing.T) {
+	newMachine := func(progress *BootProgress) *BootMachine {
+		m := NewBootMachine(nil, "cfg")
+		m.ReportProgress(progress)
+		return m
+	}
+
+	t.Run("ok, reports completed phases and timings", func(t *testing.T) {
+		progress := NewBootProgress()
+		now := time.Now()
+		progress.now = func() time.Time {
+			now = now.Add(time.Second)
+			return now
+		}
+
+		var during BootStatus
+		_, err := newMachine(progress).Run(t.Context(), []BootStep{
+			{Phase: PhaseGPUVerified, Run: func(context.Context, *Checkpoint) error { return nil }},
+			{Phase: PhaseMeasured, Run: func(context.Context, *Checkpoint) error {
+				during = progress.Status()
+				return nil
+			}},
+		})
+		require.NoError(t, err)
+
+		require.Equal(t, PhaseMeasured, during.Phase)
+		require.Equal(t, PhaseStateRunning, during.Phases[1].State)
+
+		progress.Finished()
+		status := progress.Status()
+		require.True(t, status.Done)
+		require.Empty(t, status.Phase)
+		require.Empty(t, status.LastError)
+		require.Len(t, status.Phases, 2)
+		for _, phase := range status.Phases {
+			require.Equal(t, PhaseStateCompleted, phase.State)
+			require.GreaterOrEqual(t, phase.DurationMS, int64(1000))
+		}
+	})
+
+	t.Run("ok, reports failed phase and last error", func(t *testing.T) {
+		progress := NewBootProgress()
+		_, err := newMachine(progress).Run(t.Context(), []BootStep{
+			{Phase: PhaseGPUVerified, Run: func(context.Context, *Checkpoint) error { return errors.New("boom") }},
+			{Phase: PhaseMeasured, Run: func(context.Context, *Checkpoint) error { return nil }},
+		})
+		require.Error(t, err)
+
+		status := progress.Status()
+		require.False(t, status.Done)
+		require.Equal(t, "boom", status.LastError)
+		require.Equal(t, []PhaseStatus{{
+			Phase:     PhaseGPUVerified,
+			State:     PhaseStateFailed,
+			StartedAt: status.Phases[0].StartedAt,
+		}}, status.Phases)
+	})
+
+	t.Run("ok, nil progress is a no-op", func(t *testing.T) {
+		_, err := newMachine(nil).Run(t.Context(), []BootStep{
+			{Phase: PhaseGPUVerified, Run: func(context.Context, *Checkpoint) error { return nil }},
+		})
+		require.NoError(t, err)
+	})
+}
+
+func TestStatusServer(t *testing.T) {
+	progress := NewBootProgress()
+	progress.phaseStarted(PhaseGPUVerified)
+
+	server := NewStatusServer(&StatusConfig{Addr: "127.0.0.1:0"}, progress)
+	rec := httptest.NewRecorder()
+	server.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var status BootStatus
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&status))
+	require.Equal(t, PhaseGPUVerified, status.Phase)
+	require.Len(t, status.Phases, 1)
+}
+
+func TestValidateLoopbackAddr(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:8089": true,
+		"[::1]:8089":     true,
+		"localhost:8089": true,
+		"0.0.0.0:8089":   false,
+		":8089":          false,
+		"10.0.0.1:8089":  false,
+		"127.0.0.1":      false,
+		"":               false,
+	}
+
+	for addr, ok := range tests {
+		t.Run(addr, func(t *testing.T) {
+			err := validateLoopbackAddr(addr)
+			if ok {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeboot
+
+import (
+	"fmt"
+	"time"
+
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+)
+
+// TimeSyncConfig is config for including the clock synchronization state in the evidence, as
+// attestation and certificate validity rely on the clock of the node.
+type TimeSyncConfig struct {
+	// Require fails the boot when the clock is not synchronized within MaxOffset, instead of leaving
+	// it to verifiers.
+	Require bool `yaml:"require"`
+	// MaxOffset is the largest offset and maximum error of a required clock. Leave 0 for DefaultMaxClockOffset.
+	MaxOffset time.Duration `yaml:"max_offset"`
+}
+
+// DefaultMaxClockOffset is the default largest offset and maximum error of a required clock.
+const DefaultMaxClockOffset = time.Second
+
+func (c *TimeSyncConfig) maxOffset() time.Duration {
+	if c.MaxOffset <= 0 {
+		return DefaultMaxClockOffset
+	}
+	return c.MaxOffset
+}
+
+// check fails when the clock is required to be synchronized and isn't within the max offset.
+func (c *TimeSyncConfig) check(state rcevidence.TimeSync) error {
+	if !c.Require || state.Within(c.maxOffset()) {
+		return nil
+	}
+	if !state.Synchronized {
+		return fmt.Errorf("clock is not synchronized, max error %s", state.MaxError())
+	}
+	return fmt.Errorf("clock is synchronized beyond %s: offset %s, max error %s", c.maxOffset(), state.Offset(), state.MaxError())
+}
+
+// kernel clock status bits and states, see adjtimex(2).
+const (
+	clockStatusUnsync = 0x40
+	clockStatusNano   = 0x2000
+	clockStateError   = 5
+)
+
+// kernelClock is the NTP state of the kernel clock, as kept by the time daemon.
+type kernelClock struct {
+	// state is the clock state adjtimex returns, clockStateError when the clock is not synchronized.
+	state  int
+	status int64
+	// offset is in microseconds, in nanoseconds when the status has clockStatusNano set.
+	offset int64
+	// maxError and estError are in microseconds.
+	maxError int64
+	estError int64
+}
+
+// readKernelClock reads the kernel clock, it is only implemented on linux.
+var readKernelClock = adjtimex
+
+// ReadTimeSync reads the clock synchronization state from the kernel. Time daemons like chrony and
+// ntpd keep the state in the kernel, so it is read the same way whichever daemon runs.
+func ReadTimeSync() (rcevidence.TimeSync, error) {
+	clock, err := readKernelClock()
+	if err != nil {
+		return rcevidence.TimeSync{}, fmt.Errorf("failed to read kernel clock: %w", err)
+	}
+	return clock.timeSync(time.Now().UTC()), nil
+}
+
+func (c kernelClock) timeSync(now time.Time) rcevidence.TimeSync {
+	offset := time.Duration(c.offset) * time.Microsecond
+	if c.status&clockStatusNano != 0 {
+		offset = time.Duration(c.offset)
+	}
+	return rcevidence.TimeSync{
+		Synchronized:        c.state != clockStateError && c.status&clockStatusUnsync == 0,
+		OffsetNanos:         offset.Nanoseconds(),
+		MaxErrorNanos:       (time.Duration(c.maxError) * time.Microsecond).Nanoseconds(),
+		EstimatedErrorNanos: (time.Duration(c.estError) * time.Microsecond).Nanoseconds(),
+		Time:                now,
+	}
+}
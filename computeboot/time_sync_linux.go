@@ -0,0 +1,38 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package computeboot
+
+import "golang.org/x/sys/unix"
+
+// adjtimex reads the kernel clock without adjusting it.
+func adjtimex() (kernelClock, error) {
+	var tx unix.Timex
+	state, err := unix.Adjtimex(&tx)
+	if err != nil {
+		return kernelClock{}, err
+	}
+	return kernelClock{
+		state:    state,
+		status:   int64(tx.Status),
+		offset:   int64(tx.Offset),
+		maxError: int64(tx.Maxerror),
+		estError: int64(tx.Esterror),
+	}, nil
+}
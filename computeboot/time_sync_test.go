@@ -0,0 +1,131 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeboot
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadTimeSync(t *testing.T) {
+	setClock := func(t *testing.T, clock kernelClock, err error) {
+		orig := readKernelClock
+		t.Cleanup(func() {
+			readKernelClock = orig
+		})
+		readKernelClock = func() (kernelClock, error) {
+			return clock, err
+		}
+	}
+
+	tests := map[string]struct {
+		clock kernelClock
+		want  rcevidence.TimeSync
+	}{
+		"ok, synchronized": {
+			clock: kernelClock{status: 0x1, offset: -250, maxError: 12000, estError: 1000},
+			want:  rcevidence.TimeSync{Synchronized: true, OffsetNanos: -250_000, MaxErrorNanos: 12_000_000, EstimatedErrorNanos: 1_000_000},
+		},
+		"ok, nanosecond offset": {
+			clock: kernelClock{status: clockStatusNano, offset: 1500, maxError: 500},
+			want:  rcevidence.TimeSync{Synchronized: true, OffsetNanos: 1500, MaxErrorNanos: 500_000},
+		},
+		"ok, unsynchronized status": {
+			clock: kernelClock{status: clockStatusUnsync, maxError: 16_000_000},
+			want:  rcevidence.TimeSync{MaxErrorNanos: 16_000_000_000},
+		},
+		"ok, clock error state": {
+			clock: kernelClock{state: clockStateError},
+			want:  rcevidence.TimeSync{},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			setClock(t, tc.clock, nil)
+
+			got, err := ReadTimeSync()
+			require.NoError(t, err)
+			require.False(t, got.Time.IsZero())
+			tc.want.Time = got.Time
+			require.Equal(t, tc.want, got)
+			require.NoError(t, got.Validate())
+		})
+	}
+
+	t.Run("fail, kernel clock", func(t *testing.T) {
+		setClock(t, kernelClock{}, errors.New("operation not permitted"))
+
+		_, err := ReadTimeSync()
+		require.Error(t, err)
+	})
+}
+
+func TestTimeSyncConfigCheck(t *testing.T) {
+	synchronized := rcevidence.TimeSync{Synchronized: true, OffsetNanos: int64(20 * time.Millisecond), MaxErrorNanos: int64(50 * time.Millisecond)}
+	drifted := rcevidence.TimeSync{Synchronized: true, OffsetNanos: -int64(3 * time.Second), MaxErrorNanos: int64(50 * time.Millisecond)}
+	unsynchronized := rcevidence.TimeSync{MaxErrorNanos: int64(16 * time.Second)}
+
+	tests := map[string]struct {
+		cfg     TimeSyncConfig
+		state   rcevidence.TimeSync
+		wantErr bool
+	}{
+		"ok, not required": {
+			cfg:   TimeSyncConfig{},
+			state: unsynchronized,
+		},
+		"ok, within default max offset": {
+			cfg:   TimeSyncConfig{Require: true},
+			state: synchronized,
+		},
+		"ok, within configured max offset": {
+			cfg:   TimeSyncConfig{Require: true, MaxOffset: 5 * time.Second},
+			state: drifted,
+		},
+		"fail, beyond default max offset": {
+			cfg:     TimeSyncConfig{Require: true},
+			state:   drifted,
+			wantErr: true,
+		},
+		"fail, max error beyond configured max offset": {
+			cfg:     TimeSyncConfig{Require: true, MaxOffset: 10 * time.Millisecond},
+			state:   synchronized,
+			wantErr: true,
+		},
+		"fail, unsynchronized": {
+			cfg:     TimeSyncConfig{Require: true, MaxOffset: time.Minute},
+			state:   unsynchronized,
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.cfg.check(tc.state)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+)
+
+// The topology types are part of the evidence, see rcevidence.GPUTopologyPiece.
+type (
+	MultiGPUMode     = rcevidence.MultiGPUMode
+	NVLinkRemoteType = rcevidence.NVLinkRemoteType
+	GPUTopology      = rcevidence.GPUTopology
+	TopologyGPU      = rcevidence.TopologyGPU
+	TopologyLink     = rcevidence.TopologyLink
+)
+
+const (
+	MultiGPUModeNone          = rcevidence.MultiGPUModeNone
+	MultiGPUModeProtectedPCIe = rcevidence.MultiGPUModeProtectedPCIe
+	MultiGPUModeNVLE          = rcevidence.MultiGPUModeNVLE
+
+	NVLinkRemoteGPU     = rcevidence.NVLinkRemoteGPU
+	NVLinkRemoteSwitch  = rcevidence.NVLinkRemoteSwitch
+	NVLinkRemoteUnknown = rcevidence.NVLinkRemoteUnknown
+)
+
+// TopologyReader reads the GPU topology of the system.
+type TopologyReader interface {
+	ReadTopology() (*GPUTopology, error)
+}
+
+// GPUTopologyMeasurement returns the measurement of the digest of the GPU topology for pcr, so
+// verifiers can compare the protected fabric against a reference value.
+func GPUTopologyMeasurement(pcr uint32, topology *GPUTopology) (Measurement, error) {
+	digest, err := topology.Digest()
+	if err != nil {
+		return Measurement{}, err
+	}
+	return newMeasurement(pcr, "gpu topology", digest), nil
+}
+
+// nvmlTopologyReader reads the topology using NVML.
+type nvmlTopologyReader struct{}
+
+func (nvmlTopologyReader) ReadTopology() (*GPUTopology, error) {
+	if ret := nvml.Init(); ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to initialize nvml: %w", ret)
+	}
+	defer nvml.Shutdown()
+
+	settings, ret := nvml.SystemGetConfComputeSettings()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get confidential compute settings: %w", ret)
+	}
+
+	topology := &GPUTopology{}
+	switch settings.MultiGpuMode {
+	case nvml.CC_SYSTEM_MULTIGPU_PROTECTED_PCIE:
+		topology.MultiGPUMode = MultiGPUModeProtectedPCIe
+	case nvml.CC_SYSTEM_MULTIGPU_NVLE:
+		topology.MultiGPUMode = MultiGPUModeNVLE
+	default:
+		topology.MultiGPUMode = MultiGPUModeNone
+	}
+
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get gpu count: %w", ret)
+	}
+
+	// links are only reported as encrypted when every gpu has NVLink encryption enabled.
+	topology.LinkEncryption = count > 0
+	for i := range count {
+		device, ret := nvml.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("failed to get gpu %d: %w", i, ret)
+		}
+
+		encrypted, err := readLinkEncryption(device)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read nvlink encryption of gpu %d: %w", i, err)
+		}
+		topology.LinkEncryption = topology.LinkEncryption && encrypted
+
+		uuid, ret := device.GetUUID()
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("failed to get uuid of gpu %d: %w", i, ret)
+		}
+
+		pci, ret := device.GetPciInfo()
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("failed to get pci info of gpu %d: %w", i, ret)
+		}
+
+		links, err := readNVLinks(device)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read nvlinks of gpu %d: %w", i, err)
+		}
+
+		gpu := TopologyGPU{
+			UUID:     uuid,
+			PCIBusID: pciBusID(pci),
+			Links:    links,
+		}
+
+		// only gpus in a multi-node nvlink domain have fabric info.
+		fabric, ret := device.GetGpuFabricInfo()
+		if ret != nvml.SUCCESS && ret != nvml.ERROR_NOT_SUPPORTED {
+			return nil, fmt.Errorf("failed to get fabric info of gpu %d: %w", i, ret)
+		}
+		if ret == nvml.SUCCESS && fabric.State == nvml.GPU_FABRIC_STATE_COMPLETED {
+			gpu.ClusterUUID = formatClusterUUID(fabric.ClusterUuid)
+			gpu.CliqueID = fabric.CliqueId
+		}
+
+		topology.GPUs = append(topology.GPUs, gpu)
+	}
+
+	return topology, nil
+}
+
+// readLinkEncryption reports whether NVLink encryption (NVLE) is enabled on the device. Devices and
+// drivers that don't support NVLE have it disabled.
+func readLinkEncryption(device nvml.Device) (bool, error) {
+	info, ret := device.GetNvLinkInfo().V1()
+	if ret == nvml.ERROR_NOT_SUPPORTED || ret == nvml.ERROR_FUNCTION_NOT_FOUND {
+		return false, nil
+	}
+	if ret != nvml.SUCCESS {
+		return false, ret
+	}
+	return info.IsNvleEnabled != 0, nil
+}
+
+func readNVLinks(device nvml.Device) ([]TopologyLink, error) {
+	links := []TopologyLink{}
+	for link := range nvml.NVLINK_MAX_LINKS {
+		state, ret := device.GetNvLinkState(link)
+		if ret == nvml.ERROR_NOT_SUPPORTED || ret == nvml.ERROR_INVALID_ARGUMENT {
+			// the gpu has no nvlink, or fewer links than the maximum.
+			break
+		}
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("failed to get state of link %d: %w", link, ret)
+		}
+
+		if state != nvml.FEATURE_ENABLED {
+			links = append(links, TopologyLink{Link: link})
+			continue
+		}
+
+		remoteType, ret := device.GetNvLinkRemoteDeviceType(link)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("failed to get remote device type of link %d: %w", link, ret)
+		}
+
+		remotePCI, ret := device.GetNvLinkRemotePciInfo(link)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("failed to get remote pci info of link %d: %w", link, ret)
+		}
+
+		links = append(links, TopologyLink{
+			Link:           link,
+			Active:         true,
+			RemoteType:     nvLinkRemoteType(remoteType),
+			RemotePCIBusID: pciBusID(remotePCI),
+		})
+	}
+	return links, nil
+}
+
+func nvLinkRemoteType(t nvml.IntNvLinkDeviceType) NVLinkRemoteType {
+	switch t { //nolint:exhaustive
+	case nvml.NVLINK_DEVICE_TYPE_GPU:
+		return NVLinkRemoteGPU
+	case nvml.NVLINK_DEVICE_TYPE_SWITCH:
+		return NVLinkRemoteSwitch
+	default:
+		return NVLinkRemoteUnknown
+	}
+}
+
+// formatClusterUUID formats a fabric cluster UUID in the canonical 8-4-4-4-12 form.
+func formatClusterUUID(b [16]uint8) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func pciBusID(pci nvml.PciInfo) string {
+	return strings.ToLower(strings.TrimRight(string(pci.BusId[:]), "\x00"))
+}
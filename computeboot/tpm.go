@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"log/slog"
 
+	"github.com/confidentsecurity/confidentcompute/tpmerr"
 	"github.com/google/go-tpm/tpm2"
 	"github.com/google/go-tpm/tpm2/transport"
 	"github.com/google/go-tpm/tpm2/transport/simulator"
@@ -82,6 +83,9 @@ func (t *TPMType) UnmarshalYAML(value *yaml.Node) error {
 }
 
 type TPMConfig struct {
+	// Preset fills the handles, NV indices, TPM type and event log path that are not set
+	// explicitly, see TPMPresets. Leave blank to set everything explicitly.
+	Preset string `yaml:"preset"`
 	// PrimaryKeyHandle is the handle in the TPM for the primary key
 	PrimaryKeyHandle uint32 `yaml:"primary_key_handle"`
 	// ChildKeyHandle is the handle in the TPM for the child key
@@ -95,6 +99,9 @@ type TPMConfig struct {
 	// AttestationKeyHandle is the handle where the OEM attestation key
 	// is persisted
 	AttestationKeyHandle uint32 `yaml:"attestation_key_handle"`
+	// RefundKeyHandle is the handle where the refund key is persisted, compute_worker signs refunds
+	// with it, see rcevidence.RefundKey. Leave 0 to not create a refund key.
+	RefundKeyHandle uint32 `yaml:"refund_key_handle"`
 	// TPMType is GCE, Azure, or Simulator. Unknown how this conflicts with the Simulate config
 	TPMType TPMType `yaml:"tpm_type"`
 	// Path to TCG Event log
@@ -112,6 +119,7 @@ func NewTPMOperatorWithConfig(cfg *TPMConfig) (*TPMOperator, error) {
 		rekCreationTicketHandle: tpmutil.Handle(cfg.REKCreationTicketHandle),
 		rekCreationHashHandle:   tpmutil.Handle(cfg.REKCreationHashHandle),
 		attestationKeyHandle:    tpmutil.Handle(cfg.AttestationKeyHandle),
+		refundKeyHandle:         tpmutil.Handle(cfg.RefundKeyHandle),
 		tpmType:                 cfg.TPMType,
 	}
 	switch o.tpmType {
@@ -135,6 +143,7 @@ type TPMOperator struct {
 	rekCreationTicketHandle tpmutil.Handle
 	rekCreationHashHandle   tpmutil.Handle
 	attestationKeyHandle    tpmutil.Handle
+	refundKeyHandle         tpmutil.Handle
 	tpmType                 TPMType
 }
 
@@ -339,6 +348,14 @@ func (t *TPMOperator) SetupEncryptionKeys() error {
 		return fmt.Errorf("could not write creation hash to NVRAM: %w", err)
 	}
 
+	if t.refundKeyHandle != 0 {
+		parent := tpm2.NamedHandle{Handle: createPrimaryKeyResponse.ObjectHandle, Name: createPrimaryKeyResponse.Name}
+		err = createRefundKey(thetpm, parent, authorizationPolicyDigest.Buffer, t.refundKeyHandle)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -377,7 +394,7 @@ func (t *TPMSimulator) OpenDevice() (transport.TPMCloser, error) {
 		return nil, err
 	}
 	slog.Info("Using simulated TPM")
-	tpm := transport.FromReadWriteCloser(tpmDevice)
+	tpm := tpmerr.NewRetryingTPM(transport.FromReadWriteCloser(tpmDevice), tpmerr.DefaultPolicy)
 
 	slog.Info("executing startup command TPM simulator")
 	_, err = tpm2.Startup{
@@ -450,7 +467,7 @@ func (t *TPMRealDevice) OpenDevice() (transport.TPMCloser, error) {
 		return nil, err
 	}
 	slog.Info("Using real TPM")
-	tpm := transport.FromReadWriteCloser(rwc)
+	tpm := tpmerr.NewRetryingTPM(transport.FromReadWriteCloser(rwc), tpmerr.DefaultPolicy)
 
 	t.tpmHandle = &tpm
 
@@ -468,3 +485,30 @@ type TPMDevice interface {
 	OpenDevice() (transport.TPMCloser, error)
 	Close() error
 }
+
+// ApplicationPCR is the PCR the node image extends with the digests of the models it serves.
+// Measurements of compute_boot that don't name a PCR go into it.
+const ApplicationPCR uint32 = 12
+
+// bootChainPCRs is the number of PCRs, starting at 0, measured by the firmware and the boot loader.
+const bootChainPCRs = 8
+
+// extendPCR extends pcr with a SHA-256 digest. Configured PCRs are checked with
+// ValidateMeasurementPCR when the config is loaded.
+func extendPCR(thetpm transport.TPM, pcr uint32, digest []byte) error {
+	_, err := tpm2.PCRExtend{
+		PCRHandle: tpm2.AuthHandle{
+			Handle: tpm2.TPMHandle(pcr),
+			Auth:   tpm2.PasswordAuth(nil),
+		},
+		Digests: tpm2.TPMLDigestValues{
+			Digests: []tpm2.TPMTHA{
+				{
+					HashAlg: tpm2.TPMAlgSHA256,
+					Digest:  digest,
+				},
+			},
+		},
+	}.Execute(thetpm)
+	return err
+}
@@ -0,0 +1,161 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+const (
+	// TPMPresetGCE is the preset of GCE confidential VMs.
+	TPMPresetGCE = "gce-default"
+	// TPMPresetAzure is the preset of Azure confidential VMs.
+	TPMPresetAzure = "azure-default"
+	// TPMPresetQEMUSNP is the preset of SEV-SNP guests on QEMU with a swtpm.
+	TPMPresetQEMUSNP = "qemu-snp-default"
+	// TPMPresetLocalSim is the preset of local dev against the TPM simulator.
+	TPMPresetLocalSim = "local-sim"
+)
+
+const defaultEventLogPath = "/sys/kernel/security/tpm0/binary_bios_measurements"
+
+// tpmPresets are the handles and NV indices a TPM type is known to work with. Owner NV indices
+// live in 0x01800000 on real and virtual TPMs, the simulator uses the platform range like our
+// local dev config always did.
+var tpmPresets = map[string]TPMConfig{
+	TPMPresetGCE: {
+		PrimaryKeyHandle:        0x81000001,
+		ChildKeyHandle:          0x81000002,
+		REKCreationTicketHandle: 0x0180000A,
+		REKCreationHashHandle:   0x0180000B,
+		AttestationKeyHandle:    0x81000003,
+		TPMType:                 GCE,
+		EventLogPath:            defaultEventLogPath,
+	},
+	TPMPresetAzure: {
+		PrimaryKeyHandle:        0x81000001,
+		ChildKeyHandle:          0x81000002,
+		REKCreationTicketHandle: 0x0180000A,
+		REKCreationHashHandle:   0x0180000B,
+		AttestationKeyHandle:    0x81000003,
+		TPMType:                 Azure,
+		EventLogPath:            defaultEventLogPath,
+	},
+	TPMPresetQEMUSNP: {
+		PrimaryKeyHandle:        0x81000001,
+		ChildKeyHandle:          0x81000002,
+		REKCreationTicketHandle: 0x0180000A,
+		REKCreationHashHandle:   0x0180000B,
+		AttestationKeyHandle:    0x81000003,
+		TPMType:                 QEMU,
+		EventLogPath:            defaultEventLogPath,
+	},
+	TPMPresetLocalSim: {
+		PrimaryKeyHandle:        0x81000001,
+		ChildKeyHandle:          0x81000002,
+		REKCreationTicketHandle: 0x01c0000A,
+		REKCreationHashHandle:   0x01c0000B,
+		AttestationKeyHandle:    0x81000003,
+		TPMType:                 Simulator,
+	},
+}
+
+// TPMPresets returns the names of the available presets.
+func TPMPresets() []string {
+	return slices.Sorted(maps.Keys(tpmPresets))
+}
+
+// ApplyPreset fills the handles, NV indices, TPM type and event log path that are not set
+// explicitly from the preset, then checks the handles don't conflict. Configs without a preset
+// are only checked.
+func (c *TPMConfig) ApplyPreset() error {
+	if c.Preset != "" {
+		preset, ok := tpmPresets[c.Preset]
+		if !ok {
+			return fmt.Errorf("unknown tpm preset %q, must be one of %s", c.Preset, strings.Join(TPMPresets(), ", "))
+		}
+
+		// GCE is the zero TPM type, so only other types can be told apart from an unset one.
+		if c.TPMType != GCE && c.TPMType != preset.TPMType {
+			return fmt.Errorf("tpm type %s conflicts with tpm preset %q", c.TPMType, c.Preset)
+		}
+		c.TPMType = preset.TPMType
+
+		fill := func(v *uint32, preset uint32) {
+			if *v == 0 {
+				*v = preset
+			}
+		}
+		fill(&c.PrimaryKeyHandle, preset.PrimaryKeyHandle)
+		fill(&c.ChildKeyHandle, preset.ChildKeyHandle)
+		fill(&c.REKCreationTicketHandle, preset.REKCreationTicketHandle)
+		fill(&c.REKCreationHashHandle, preset.REKCreationHashHandle)
+		fill(&c.AttestationKeyHandle, preset.AttestationKeyHandle)
+		if c.EventLogPath == "" {
+			c.EventLogPath = preset.EventLogPath
+		}
+	}
+
+	return c.validateHandles()
+}
+
+// validateHandles checks the keys are in the persistent range, the creation data in the NV
+// index range, and that no two of them share a handle.
+func (c *TPMConfig) validateHandles() error {
+	handles := []struct {
+		name   string
+		handle uint32
+		nv     bool
+		// optional handles may be 0.
+		optional bool
+	}{
+		{name: "primary_key_handle", handle: c.PrimaryKeyHandle},
+		{name: "child_key_handle", handle: c.ChildKeyHandle},
+		{name: "attestation_key_handle", handle: c.AttestationKeyHandle},
+		{name: "refund_key_handle", handle: c.RefundKeyHandle, optional: true},
+		{name: "rek_creation_ticket_handle", handle: c.REKCreationTicketHandle, nv: true},
+		{name: "rek_creation_hash_handle", handle: c.REKCreationHashHandle, nv: true},
+	}
+
+	seen := make(map[uint32]string, len(handles))
+	var errs []error
+	for _, h := range handles {
+		// the top byte of a handle is its type, 0x81 for persistent objects and 0x01 for NV indices.
+		switch {
+		case h.handle == 0 && h.optional:
+			continue
+		case h.handle == 0:
+			errs = append(errs, fmt.Errorf("missing %s", h.name))
+			continue
+		case h.nv && h.handle>>24 != 0x01:
+			errs = append(errs, fmt.Errorf("%s 0x%x is not an NV index", h.name, h.handle))
+		case !h.nv && h.handle>>24 != 0x81:
+			errs = append(errs, fmt.Errorf("%s 0x%x is not a persistent handle", h.name, h.handle))
+		}
+		if other, ok := seen[h.handle]; ok {
+			errs = append(errs, fmt.Errorf("%s 0x%x conflicts with %s", h.name, h.handle, other))
+			continue
+		}
+		seen[h.handle] = h.name
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,98 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot_test
+
+import (
+	"testing"
+
+	"github.com/confidentsecurity/confidentcompute/computeboot"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTPMConfigApplyPreset(t *testing.T) {
+	t.Run("ok, preset fills everything", func(t *testing.T) {
+		cfg := &computeboot.TPMConfig{Preset: computeboot.TPMPresetAzure}
+		require.NoError(t, cfg.ApplyPreset())
+		require.Equal(t, &computeboot.TPMConfig{
+			Preset:                  computeboot.TPMPresetAzure,
+			PrimaryKeyHandle:        0x81000001,
+			ChildKeyHandle:          0x81000002,
+			REKCreationTicketHandle: 0x0180000A,
+			REKCreationHashHandle:   0x0180000B,
+			AttestationKeyHandle:    0x81000003,
+			TPMType:                 computeboot.Azure,
+			EventLogPath:            "/sys/kernel/security/tpm0/binary_bios_measurements",
+		}, cfg)
+	})
+
+	t.Run("ok, explicit values override the preset", func(t *testing.T) {
+		cfg := &computeboot.TPMConfig{
+			Preset:               computeboot.TPMPresetLocalSim,
+			AttestationKeyHandle: 0x81000010,
+			TPMType:              computeboot.Simulator,
+		}
+		require.NoError(t, cfg.ApplyPreset())
+		require.Equal(t, uint32(0x81000010), cfg.AttestationKeyHandle)
+		require.Equal(t, uint32(0x01c0000A), cfg.REKCreationTicketHandle)
+		require.Empty(t, cfg.EventLogPath)
+	})
+
+	t.Run("ok, every preset is valid", func(t *testing.T) {
+		for _, name := range computeboot.TPMPresets() {
+			cfg := &computeboot.TPMConfig{Preset: name}
+			require.NoError(t, cfg.ApplyPreset(), name)
+		}
+	})
+
+	t.Run("ok, explicit config without a preset", func(t *testing.T) {
+		cfg := &computeboot.TPMConfig{
+			PrimaryKeyHandle:        0x81000001,
+			ChildKeyHandle:          0x81000002,
+			REKCreationTicketHandle: 0x01c0000A,
+			REKCreationHashHandle:   0x01c0000B,
+			AttestationKeyHandle:    0x81000003,
+			TPMType:                 computeboot.QEMU,
+		}
+		require.NoError(t, cfg.ApplyPreset())
+	})
+
+	t.Run("fail, unknown preset", func(t *testing.T) {
+		cfg := &computeboot.TPMConfig{Preset: "aws-default"}
+		require.ErrorContains(t, cfg.ApplyPreset(), "unknown tpm preset")
+	})
+
+	t.Run("fail, tpm type conflicts with preset", func(t *testing.T) {
+		cfg := &computeboot.TPMConfig{Preset: computeboot.TPMPresetGCE, TPMType: computeboot.Azure}
+		require.ErrorContains(t, cfg.ApplyPreset(), "conflicts with tpm preset")
+	})
+
+	t.Run("fail, handles conflict", func(t *testing.T) {
+		cfg := &computeboot.TPMConfig{Preset: computeboot.TPMPresetGCE, AttestationKeyHandle: 0x81000001}
+		require.ErrorContains(t, cfg.ApplyPreset(), "attestation_key_handle 0x81000001 conflicts with primary_key_handle")
+	})
+
+	t.Run("fail, key handle in the nv index range", func(t *testing.T) {
+		cfg := &computeboot.TPMConfig{Preset: computeboot.TPMPresetGCE, ChildKeyHandle: 0x0180000C}
+		require.ErrorContains(t, cfg.ApplyPreset(), "not a persistent handle")
+	})
+
+	t.Run("fail, missing handles without a preset", func(t *testing.T) {
+		cfg := &computeboot.TPMConfig{TPMType: computeboot.QEMU}
+		require.ErrorContains(t, cfg.ApplyPreset(), "missing primary_key_handle")
+	})
+}
@@ -0,0 +1,308 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// azureAKCertNVIndex holds the AK certificate of Azure confidential VMs.
+const azureAKCertNVIndex uint32 = 0x01c101d0
+
+// defaultNVChunkSize is the chunk size of NV reads when the TPM doesn't report TPM_PT_NV_BUFFER_MAX.
+const defaultNVChunkSize = 512
+
+// nvModifyingCommands change NV indexes or their public areas, a TPMSession drops its cache when
+// one of them is sent.
+var nvModifyingCommands = []tpm2.TPMCC{
+	tpm2.TPMCCNVDefineSpace,
+	tpm2.TPMCCNVUndefineSpace,
+	tpm2.TPMCCNVUndefineSpaceSpecial,
+	tpm2.TPMCCNVWrite,
+	tpm2.TPMCCNVIncrement,
+	tpm2.TPMCCNVExtend,
+	tpm2.TPMCCNVSetBits,
+	tpm2.TPMCCNVWriteLock,
+	tpm2.TPMCCNVGlobalWriteLock,
+	tpm2.TPMCCNVReadLock,
+	tpm2.TPMCCNVChangeAuth,
+	tpm2.TPMCCClear,
+}
+
+// TPMSessionStats counts the commands a TPMSession sent to the TPM and answered from its cache.
+type TPMSessionStats struct {
+	Sent      int
+	CacheHits int
+}
+
+// TPMSession shares a TPM connection between the attestors of an evidence collection. The
+// attestors read the same NV indexes and public areas several times, a TPMSession answers repeated
+// NV_ReadPublic commands and password authorized NV_Read commands from a cache instead of the TPM.
+// PrefetchNV reads NV indexes in the background while other evidence, like the TEE quote, is
+// collected. Commands that modify NV indexes drop the cache.
+//
+// Commands are serialized, so attestors may use a TPMSession concurrently.
+type TPMSession struct {
+	tpm transport.TPM
+	// sendMu serializes the commands sent to the TPM.
+	sendMu sync.Mutex
+
+	mu sync.Mutex
+	// generation is bumped when the cache is dropped, reads that started before aren't cached.
+	generation uint64
+	// nvPublic are the NV_ReadPublic responses by NV index.
+	nvPublic map[tpm2.TPMHandle][]byte
+	// nvData are the contents of the NV indexes read by PrefetchNV.
+	nvData map[tpm2.TPMHandle][]byte
+	stats  TPMSessionStats
+}
+
+func NewTPMSession(tpm transport.TPM) *TPMSession {
+	return &TPMSession{
+		tpm:      tpm,
+		nvPublic: map[tpm2.TPMHandle][]byte{},
+		nvData:   map[tpm2.TPMHandle][]byte{},
+	}
+}
+
+// Send implements transport.TPM.
+func (s *TPMSession) Send(cmd []byte) ([]byte, error) {
+	if len(cmd) < 10 {
+		return s.send(cmd)
+	}
+	tag := tpm2.TPMST(binary.BigEndian.Uint16(cmd[0:2]))
+	cc := tpm2.TPMCC(binary.BigEndian.Uint32(cmd[6:10]))
+
+	switch {
+	case cc == tpm2.TPMCCNVReadPublic && tag == tpm2.TPMSTNoSessions && len(cmd) == 14:
+		index := tpm2.TPMHandle(binary.BigEndian.Uint32(cmd[10:14]))
+		s.mu.Lock()
+		rsp, ok := s.nvPublic[index]
+		generation := s.generation
+		if ok {
+			s.stats.CacheHits++
+		}
+		s.mu.Unlock()
+		if ok {
+			return slices.Clone(rsp), nil
+		}
+
+		rsp, err := s.send(cmd)
+		if err == nil && responseOK(rsp) {
+			s.cache(generation, func() {
+				s.nvPublic[index] = slices.Clone(rsp)
+			})
+		}
+		return rsp, err
+	case cc == tpm2.TPMCCNVRead && tag == tpm2.TPMSTSessions:
+		if rsp, ok := s.cachedNVRead(cmd); ok {
+			return rsp, nil
+		}
+		return s.send(cmd)
+	case slices.Contains(nvModifyingCommands, cc):
+		s.mu.Lock()
+		s.generation++
+		clear(s.nvPublic)
+		clear(s.nvData)
+		s.mu.Unlock()
+		return s.send(cmd)
+	default:
+		return s.send(cmd)
+	}
+}
+
+func (s *TPMSession) send(cmd []byte) ([]byte, error) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	s.mu.Lock()
+	s.stats.Sent++
+	s.mu.Unlock()
+	return s.tpm.Send(cmd)
+}
+
+// cache runs store with the cache locked, unless the cache was dropped since generation.
+func (s *TPMSession) cache(generation uint64, store func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generation == generation {
+		store()
+	}
+}
+
+// cachedNVRead answers an NV_Read command from the prefetched NV contents. Only commands authorized
+// by the index itself with a single password session and an empty password are answered, other
+// commands go to the TPM.
+func (s *TPMSession) cachedNVRead(cmd []byte) ([]byte, bool) {
+	// header, auth handle, NV index and the size of the authorization area.
+	if len(cmd) < 22 {
+		return nil, false
+	}
+	authHandle := tpm2.TPMHandle(binary.BigEndian.Uint32(cmd[10:14]))
+	index := tpm2.TPMHandle(binary.BigEndian.Uint32(cmd[14:18]))
+	// prefetched indexes are read with their own authorization.
+	if authHandle != index {
+		return nil, false
+	}
+	authSize := int(binary.BigEndian.Uint32(cmd[18:22]))
+	// a password session is its handle, an empty nonce, the attributes and an empty password.
+	if authSize != 9 || len(cmd) != 22+authSize+4 {
+		return nil, false
+	}
+	auth := cmd[22 : 22+authSize]
+	if tpm2.TPMHandle(binary.BigEndian.Uint32(auth[0:4])) != tpm2.TPMRSPW ||
+		binary.BigEndian.Uint16(auth[4:6]) != 0 || binary.BigEndian.Uint16(auth[7:9]) != 0 {
+		return nil, false
+	}
+	params := cmd[22+authSize:]
+	size := int(binary.BigEndian.Uint16(params[0:2]))
+	offset := int(binary.BigEndian.Uint16(params[2:4]))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.nvData[index]
+	if !ok || offset+size > len(data) {
+		return nil, false
+	}
+	s.stats.CacheHits++
+	return nvReadResponse(data[offset : offset+size]), true
+}
+
+// nvReadResponse encodes a successful NV_Read response with a password session.
+func nvReadResponse(data []byte) []byte {
+	// header, parameter size, the TPM2B_MAX_NV_BUFFER and the password session response.
+	size := 10 + 4 + 2 + len(data) + 5
+	rsp := make([]byte, 0, size)
+	rsp = binary.BigEndian.AppendUint16(rsp, uint16(tpm2.TPMSTSessions))
+	rsp = binary.BigEndian.AppendUint32(rsp, uint32(size)) // #nosec G115 -- NV reads are at most a few KiB.
+	rsp = binary.BigEndian.AppendUint32(rsp, uint32(tpm2.TPMRCSuccess))
+	rsp = binary.BigEndian.AppendUint32(rsp, uint32(2+len(data))) // #nosec G115
+	rsp = binary.BigEndian.AppendUint16(rsp, uint16(len(data)))   // #nosec G115
+	rsp = append(rsp, data...)
+	// empty nonce, continueSession is always set for password sessions, empty hmac.
+	rsp = binary.BigEndian.AppendUint16(rsp, 0)
+	rsp = append(rsp, 0x01)
+	rsp = binary.BigEndian.AppendUint16(rsp, 0)
+	return rsp
+}
+
+func responseOK(rsp []byte) bool {
+	return len(rsp) >= 10 && tpm2.TPMRC(binary.BigEndian.Uint32(rsp[6:10])) == tpm2.TPMRCSuccess
+}
+
+// PrefetchNV reads the contents of the NV indexes in the background, so later NV reads of the
+// attestors are answered from the cache. Indexes that can't be read without a password are
+// skipped. The returned func waits for the reads to finish.
+func (s *TPMSession) PrefetchNV(indexes ...uint32) func() {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		chunkSize := s.nvChunkSize()
+		for _, index := range indexes {
+			if err := s.prefetchNV(tpm2.TPMHandle(index), chunkSize); err != nil {
+				slog.Debug("Skipped prefetching NV index", "index", fmt.Sprintf("%#x", index), "error", err)
+			}
+		}
+	}()
+	return func() {
+		<-done
+	}
+}
+
+func (s *TPMSession) prefetchNV(index tpm2.TPMHandle, chunkSize int) error {
+	s.mu.Lock()
+	generation := s.generation
+	s.mu.Unlock()
+
+	pub, err := tpm2.NVReadPublic{NVIndex: index}.Execute(s)
+	if err != nil {
+		return fmt.Errorf("failed to read public area: %w", err)
+	}
+	contents, err := pub.NVPublic.Contents()
+	if err != nil {
+		return fmt.Errorf("failed to parse public area: %w", err)
+	}
+	if !contents.Attributes.AuthRead {
+		return errors.New("index can't be read with its own authorization")
+	}
+
+	nvIndex := tpm2.NamedHandle{Handle: index, Name: pub.NVName}
+	data := make([]byte, 0, contents.DataSize)
+	for offset := 0; offset < int(contents.DataSize); offset += chunkSize {
+		size := min(chunkSize, int(contents.DataSize)-offset)
+		rsp, err := tpm2.NVRead{
+			AuthHandle: tpm2.AuthHandle{Handle: index, Name: pub.NVName, Auth: tpm2.PasswordAuth(nil)},
+			NVIndex:    nvIndex,
+			Size:       uint16(size),   // #nosec G115 -- bounded by the NV index size.
+			Offset:     uint16(offset), // #nosec G115
+		}.Execute(s)
+		if err != nil {
+			return fmt.Errorf("failed to read contents: %w", err)
+		}
+		data = append(data, rsp.Data.Buffer...)
+	}
+
+	s.cache(generation, func() {
+		s.nvData[index] = data
+	})
+	return nil
+}
+
+// nvChunkSize returns the max size of a single NV read of the TPM.
+func (s *TPMSession) nvChunkSize() int {
+	rsp, err := tpm2.GetCapability{
+		Capability:    tpm2.TPMCapTPMProperties,
+		Property:      uint32(tpm2.TPMPTNVBufferMax),
+		PropertyCount: 1,
+	}.Execute(s)
+	if err != nil {
+		return defaultNVChunkSize
+	}
+	props, err := rsp.CapabilityData.Data.TPMProperties()
+	if err != nil || len(props.TPMProperty) == 0 || props.TPMProperty[0].Property != tpm2.TPMPTNVBufferMax {
+		return defaultNVChunkSize
+	}
+	return int(props.TPMProperty[0].Value)
+}
+
+// Stats returns the commands sent and answered from the cache so far.
+func (s *TPMSession) Stats() TPMSessionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// evidenceNVIndexes are the NV indexes the attestors read for the TPM type.
+func evidenceNVIndexes(tpmCfg *TPMConfig) []uint32 {
+	indexes := []uint32{tpmCfg.REKCreationTicketHandle, tpmCfg.REKCreationHashHandle}
+	switch tpmCfg.TPMType {
+	case GCE:
+		indexes = append(indexes, GceAKCertNVIndexRSA)
+	case Azure:
+		indexes = append(indexes, azureAKCertNVIndex)
+	}
+	return indexes
+}
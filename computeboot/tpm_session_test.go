@@ -0,0 +1,156 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeboot_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/confidentsecurity/confidentcompute/computeboot"
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+	"github.com/stretchr/testify/require"
+)
+
+const testNVIndex tpm2.TPMHandle = 0x01c00100
+
+// recordingTPM keeps the last response of the TPM.
+type recordingTPM struct {
+	transport.TPM
+	last []byte
+}
+
+func (r *recordingTPM) Send(cmd []byte) ([]byte, error) {
+	rsp, err := r.TPM.Send(cmd)
+	r.last = bytes.Clone(rsp)
+	return rsp, err
+}
+
+func defineTestNVIndex(t *testing.T, thetpm transport.TPM, data []byte) tpm2.TPM2BName {
+	t.Helper()
+	_, err := tpm2.NVDefineSpace{
+		AuthHandle: tpm2.TPMRHOwner,
+		PublicInfo: tpm2.New2B(tpm2.TPMSNVPublic{
+			NVIndex: testNVIndex,
+			NameAlg: tpm2.TPMAlgSHA256,
+			Attributes: tpm2.TPMANV{
+				AuthRead:  true,
+				AuthWrite: true,
+				NT:        tpm2.TPMNTOrdinary,
+			},
+			DataSize: uint16(len(data)),
+		}),
+	}.Execute(thetpm)
+	require.NoError(t, err)
+
+	pub, err := tpm2.NVReadPublic{NVIndex: testNVIndex}.Execute(thetpm)
+	require.NoError(t, err)
+	writeTestNVIndex(t, thetpm, pub.NVName, data)
+	return pub.NVName
+}
+
+func writeTestNVIndex(t *testing.T, thetpm transport.TPM, name tpm2.TPM2BName, data []byte) {
+	t.Helper()
+	for offset := 0; offset < len(data); offset += 512 {
+		end := min(offset+512, len(data))
+		_, err := tpm2.NVWrite{
+			AuthHandle: tpm2.AuthHandle{Handle: testNVIndex, Name: name, Auth: tpm2.PasswordAuth(nil)},
+			NVIndex:    tpm2.NamedHandle{Handle: testNVIndex, Name: name},
+			Data:       tpm2.TPM2BMaxNVBuffer{Buffer: data[offset:end]},
+			Offset:     uint16(offset),
+		}.Execute(thetpm)
+		require.NoError(t, err)
+	}
+}
+
+func readTestNVIndex(thetpm transport.TPM, name tpm2.TPM2BName, size, offset uint16) ([]byte, error) {
+	rsp, err := tpm2.NVRead{
+		AuthHandle: tpm2.AuthHandle{Handle: testNVIndex, Name: name, Auth: tpm2.PasswordAuth(nil)},
+		NVIndex:    tpm2.NamedHandle{Handle: testNVIndex, Name: name},
+		Size:       size,
+		Offset:     offset,
+	}.Execute(thetpm)
+	if err != nil {
+		return nil, err
+	}
+	return rsp.Data.Buffer, nil
+}
+
+func TestTPMSession(t *testing.T) {
+	sim, err := simulator.OpenSimulator()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, sim.Close())
+	})
+
+	data := bytes.Repeat([]byte("confsec"), 200)
+	name := defineTestNVIndex(t, sim, data)
+
+	rec := &recordingTPM{TPM: sim}
+	session := computeboot.NewTPMSession(rec)
+	session.PrefetchNV(uint32(testNVIndex), 0x01c00200)()
+
+	t.Run("ok, nv reads are answered from the cache", func(t *testing.T) {
+		sent := session.Stats().Sent
+
+		got, err := readTestNVIndex(session, name, 100, 50)
+		require.NoError(t, err)
+		require.Equal(t, data[50:150], got)
+
+		_, err = tpm2.NVReadPublic{NVIndex: testNVIndex}.Execute(session)
+		require.NoError(t, err)
+
+		require.Equal(t, sent, session.Stats().Sent)
+		require.Equal(t, 2, session.Stats().CacheHits)
+	})
+
+	t.Run("ok, cached responses match the tpm", func(t *testing.T) {
+		_, err := readTestNVIndex(rec, name, 100, 50)
+		require.NoError(t, err)
+		want := rec.last
+
+		cmdRec := &commandRecorder{}
+		_, _ = readTestNVIndex(cmdRec, name, 100, 50)
+		got, err := session.Send(cmdRec.cmd)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	})
+
+	t.Run("ok, writes drop the cache", func(t *testing.T) {
+		updated := bytes.Repeat([]byte("updated"), 200)
+		writeTestNVIndex(t, session, name, updated)
+		hits := session.Stats().CacheHits
+
+		got, err := readTestNVIndex(session, name, 100, 50)
+		require.NoError(t, err)
+		require.Equal(t, updated[50:150], got)
+		require.Equal(t, hits, session.Stats().CacheHits)
+	})
+}
+
+// commandRecorder keeps the command without sending it to a TPM.
+type commandRecorder struct {
+	cmd []byte
+}
+
+func (r *commandRecorder) Send(cmd []byte) ([]byte, error) {
+	r.cmd = bytes.Clone(cmd)
+	return nil, errors.New("not sent")
+}
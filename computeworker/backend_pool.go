@@ -0,0 +1,92 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/confidentsecurity/confidentcompute/backendpool"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// doPooled sends req to the backends the backend pool of router_com picks for model, until one of
+// them responds. Only the worker sees the model, so the pool is asked for every request. Models the
+// pool has no backends for are sent to req as is. path is the path of the client request, it is
+// appended to the base url of every backend. The body is resent to every backend that is tried, the
+// pool skips the backends that failed for its cooldown.
+func (s *Worker) doPooled(ctx context.Context, model string, req *http.Request, path string, body []byte) (*http.Response, error) {
+	var (
+		failed []string
+		errs   []error
+	)
+	for {
+		baseURL, err := backendpool.Pick(ctx, s.config.BackendPoolSocket, model, failed)
+		if err != nil {
+			return nil, errors.Join(append(errs, fmt.Errorf("failed to pick backend: %w", err))...)
+		}
+		if baseURL == "" && len(failed) == 0 {
+			return s.httpClient.Do(req.WithContext(ctx))
+		}
+		if baseURL == "" {
+			return nil, fmt.Errorf("no backend of model %q responded: %w", model, errors.Join(errs...))
+		}
+
+		endpointURL, err := backendURL(baseURL, path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backend url: %w", err)
+		}
+		backendReq := req.Clone(ctx)
+		backendReq.URL, err = url.Parse(endpointURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backend url: %w", err)
+		}
+		backendReq.Host = ""
+		backendReq.Body = io.NopCloser(bytes.NewReader(body))
+		backendReq.ContentLength = int64(len(body))
+
+		resp, err := s.httpClient.Do(backendReq)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		// backend urls come from our config, not the client, so they are safe to log.
+		slog.WarnContext(ctx, "LLM backend failed, trying the next backend of the model", "backend", baseURL, "error", err)
+		trace.SpanFromContext(ctx).AddEvent("llm.backend_failed")
+		failed = append(failed, baseURL)
+		errs = append(errs, err)
+	}
+}
+
+// backendURL returns the url of the request path p on the backend at baseURL. p is appended to the
+// path of the base url, so backends can be served under a path prefix.
+func backendURL(baseURL string, p string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	return u.JoinPath(p).String(), nil
+}
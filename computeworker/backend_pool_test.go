@@ -0,0 +1,100 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/confidentsecurity/confidentcompute/backendpool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoPooled(t *testing.T) {
+	const model = "llama3.2:1b"
+
+	newWorker := func(t *testing.T, backends ...backendpool.WeightedBackend) *Worker {
+		t.Helper()
+		cfg := &backendpool.Config{
+			Socket: filepath.Join(t.TempDir(), "backend_pool.sock"),
+			Models: map[string][]backendpool.WeightedBackend{model: backends},
+		}
+		pool := backendpool.New(cfg, http.DefaultClient)
+		require.NoError(t, pool.Start())
+		t.Cleanup(func() {
+			require.NoError(t, pool.Close())
+		})
+		return &Worker{
+			config:     &Config{BackendPoolSocket: cfg.Socket},
+			httpClient: http.DefaultClient,
+		}
+	}
+	newRequest := func(t *testing.T, url string) *http.Request {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, url, nil)
+		require.NoError(t, err)
+		return req
+	}
+
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		got = r.URL.Path + " " + string(body)
+	}))
+	defer srv.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	t.Run("ok, request fails over to the next backend", func(t *testing.T) {
+		w := newWorker(t, backendpool.WeightedBackend{BaseURL: down.URL, Weight: 100}, backendpool.WeightedBackend{BaseURL: srv.URL + "/replica"})
+		for range 3 {
+			resp, err := w.doPooled(t.Context(), model, newRequest(t, "http://localhost:11434/v1/chat/completions"), "/v1/chat/completions", []byte(`{"model":"llama3.2:1b"}`))
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			// the path of the base url is kept.
+			require.Equal(t, `/replica/v1/chat/completions {"model":"llama3.2:1b"}`, got)
+		}
+	})
+
+	t.Run("ok, models without backends use the request url", func(t *testing.T) {
+		w := newWorker(t, backendpool.WeightedBackend{BaseURL: down.URL})
+		resp, err := w.doPooled(t.Context(), "gemma3:1b", newRequest(t, srv.URL+"/v1/chat/completions"), "/v1/chat/completions", nil)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, "/v1/chat/completions ", got)
+	})
+
+	t.Run("fail, no backend responds", func(t *testing.T) {
+		w := newWorker(t, backendpool.WeightedBackend{BaseURL: down.URL}, backendpool.WeightedBackend{BaseURL: down.URL + "/other"})
+		_, err := w.doPooled(t.Context(), model, newRequest(t, "http://localhost:11434/v1/chat/completions"), "/v1/chat/completions", nil)
+		require.ErrorContains(t, err, "no backend of model")
+	})
+}
+
+func TestBackendURL(t *testing.T) {
+	got, err := backendURL("http://localhost:8000", "/v1/chat/completions")
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:8000/v1/chat/completions", got)
+
+	got, err = backendURL("http://localhost:8000/gpu0/", "/v1/chat/completions")
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:8000/gpu0/v1/chat/completions", got)
+}
@@ -0,0 +1,118 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/confidentsecurity/confidentcompute/badgelimit"
+	"github.com/openpcc/openpcc/auth/credentialing"
+)
+
+// BadgeClaimsHeader carries the base64 encoded JSON BadgeClaims of the badge of a request.
+const BadgeClaimsHeader = "X-Confsec-Badge-Claims"
+
+// BadgeLimitRetryAfter is the Retry-After of requests rejected because their badge runs its max
+// parallel requests.
+const BadgeLimitRetryAfter = "1"
+
+// BadgeClaims are claims of the auth server about a badge that aren't part of its credentials. They
+// are bound to the badge by its signature and signed with the badge key.
+type BadgeClaims struct {
+	// MaxParallelRequests bounds the requests the badge runs in parallel on a node, 0 applies the
+	// default of the node.
+	MaxParallelRequests int `json:"max_parallel_requests"`
+	// Signature is the ed25519 signature of SignedMessage.
+	Signature []byte `json:"signature"`
+}
+
+// SignedMessage returns the message the claims signature covers for the badge with badgeSignature.
+func (c *BadgeClaims) SignedMessage(badgeSignature []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("confsec badge claims v1\n")
+	b.WriteString(base64.StdEncoding.EncodeToString(badgeSignature))
+	b.WriteByte('\n')
+	b.WriteString(strconv.Itoa(c.MaxParallelRequests))
+	return b.Bytes()
+}
+
+// ParseBadgeClaims parses and verifies the claims of the badge with badgeSignature in r. A request
+// without claims has the zero claims.
+func ParseBadgeClaims(r *http.Request, key ed25519.PublicKey, badgeSignature []byte) (BadgeClaims, error) {
+	header := r.Header.Get(BadgeClaimsHeader)
+	if header == "" {
+		return BadgeClaims{}, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return BadgeClaims{}, newValidationError(ErrBadgeInvalid, "failed to decode badge claims")
+	}
+	var claims BadgeClaims
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return BadgeClaims{}, newValidationError(ErrBadgeInvalid, "failed to parse badge claims")
+	}
+	if claims.MaxParallelRequests < 0 {
+		return BadgeClaims{}, newValidationError(ErrBadgeInvalid, "invalid badge claims: negative max parallel requests")
+	}
+	if !ed25519.Verify(key, claims.SignedMessage(badgeSignature), claims.Signature) {
+		return BadgeClaims{}, newValidationError(ErrBadgeInvalid, "invalid badge claims signature")
+	}
+	return claims, nil
+}
+
+// BadgeHash identifies a badge to the badge limiter without revealing it.
+func BadgeHash(badgeSignature []byte) []byte {
+	sum := sha256.Sum256(badgeSignature)
+	return sum[:]
+}
+
+// acquireBadgeSlot takes a request slot of the badge of the validated request r from the badge
+// limiter. The returned release func is a no-op when the badge limiter is disabled.
+func (s *Worker) acquireBadgeSlot(ctx context.Context, r *http.Request) (func() error, error) {
+	if s.config.BadgeLimitSocket == "" {
+		return func() error { return nil }, nil
+	}
+
+	// the badge was verified by the validator, only its signature is needed here.
+	var badge credentialing.Badge
+	if err := badge.Deserialize(r.Header.Get("X-Confsec-Badge")); err != nil {
+		return nil, newValidationError(ErrBadgeInvalid, "failed to parse badge")
+	}
+	claims, err := ParseBadgeClaims(r, s.config.BadgePublicKey, badge.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := badgelimit.Acquire(ctx, s.config.BadgeLimitSocket, BadgeHash(badge.Signature), claims.MaxParallelRequests)
+	if errors.Is(err, badgelimit.ErrLimitReached) {
+		return nil, newValidationError(ErrTooManyParallelRequests, fmt.Sprintf("badge runs its max parallel requests, retry after %ss", BadgeLimitRetryAfter))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire badge slot: %w", err)
+	}
+	return release, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func badgeClaimsRequest(t *testing.T, sk ed25519.PrivateKey, badgeSignature []byte, maxParallel int) *http.Request {
+	t.Helper()
+	claims := BadgeClaims{MaxParallelRequests: maxParallel}
+	claims.Signature = ed25519.Sign(sk, claims.SignedMessage(badgeSignature))
+	b, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	r.Header.Set(BadgeClaimsHeader, base64.StdEncoding.EncodeToString(b))
+	return r
+}
+
+func TestParseBadgeClaims(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherSK, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	badgeSignature := []byte("badge signature")
+
+	t.Run("ok, signed claims", func(t *testing.T) {
+		claims, err := ParseBadgeClaims(badgeClaimsRequest(t, sk, badgeSignature, 4), pk, badgeSignature)
+		require.NoError(t, err)
+		require.Equal(t, 4, claims.MaxParallelRequests)
+	})
+
+	t.Run("ok, no claims", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		claims, err := ParseBadgeClaims(r, pk, badgeSignature)
+		require.NoError(t, err)
+		require.Equal(t, 0, claims.MaxParallelRequests)
+	})
+
+	tests := map[string]*http.Request{
+		"fail, signed with another key":     badgeClaimsRequest(t, otherSK, badgeSignature, 4),
+		"fail, bound to another badge":      badgeClaimsRequest(t, sk, []byte("other badge signature"), 4),
+		"fail, negative max parallel":       badgeClaimsRequest(t, sk, badgeSignature, -1),
+		"fail, header is not base64 json":   httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil),
+		"fail, header is not base64 at all": httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil),
+	}
+	tests["fail, header is not base64 json"].Header.Set(BadgeClaimsHeader, base64.StdEncoding.EncodeToString([]byte("{")))
+	tests["fail, header is not base64 at all"].Header.Set(BadgeClaimsHeader, "!")
+
+	for name, r := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseBadgeClaims(r, pk, badgeSignature)
+			var validationErr ValidationError
+			require.True(t, errors.As(err, &validationErr))
+			require.Equal(t, ErrBadgeInvalid, validationErr.Code)
+		})
+	}
+}
+
+func TestValidationErrorMessageCodeTooManyParallelRequests(t *testing.T) {
+	err := newValidationError(ErrTooManyParallelRequests, "badge runs its max parallel requests")
+	require.Equal(t, http.StatusTooManyRequests, validationErrorMessageCode(err))
+}
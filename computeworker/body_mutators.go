@@ -0,0 +1,131 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"fmt"
+	"slices"
+)
+
+// BodyMutator changes validated request bodies before they are sent to the backend. Validators
+// only check bodies, so mutations like injecting usage flags don't have to be built into every
+// RequestBody.Validate.
+type BodyMutator interface {
+	// Mutate mutates body, returning whether it was changed. Bodies the mutator doesn't apply to
+	// are left unchanged.
+	Mutate(body RequestBody) (bool, error)
+}
+
+// BodyMutation scopes a BodyMutator to routes.
+type BodyMutation struct {
+	Mutator BodyMutator
+	// Routes are the paths the mutator applies to, empty applies it to all routes.
+	Routes []string
+}
+
+func (m BodyMutation) appliesTo(route string) bool {
+	return len(m.Routes) == 0 || slices.Contains(m.Routes, route)
+}
+
+// BodyMutations are run in order, every mutation sees the body as changed by the previous ones.
+type BodyMutations []BodyMutation
+
+// Mutate runs the mutations that apply to route on body, returning whether any changed it.
+func (ms BodyMutations) Mutate(route string, body RequestBody) (bool, error) {
+	dirty := false
+	for _, m := range ms {
+		if !m.appliesTo(route) {
+			continue
+		}
+		mutated, err := m.Mutator.Mutate(body)
+		if err != nil {
+			return false, err
+		}
+		dirty = dirty || mutated
+	}
+	return dirty, nil
+}
+
+// RequiredBodyMutations are always run before the configured mutations, the worker relies on them.
+func RequiredBodyMutations() BodyMutations {
+	return BodyMutations{
+		{
+			// refunds are based on the usage the backend reports.
+			Mutator: streamUsageMutator{},
+			Routes:  []string{OpenAICompletionsPath, OpenAIChatPath},
+		},
+	}
+}
+
+// BodyMutatorName identifies an optional body mutation that can be enabled in config.
+type BodyMutatorName string
+
+const (
+	// BodyMutatorStripUser removes the end-user identifier of openAI requests, the backend has no
+	// use for it and it would end up in its logs.
+	BodyMutatorStripUser BodyMutatorName = "strip_user"
+)
+
+// ParseBodyMutator parses the name of an optional body mutation.
+func ParseBodyMutator(s string) (BodyMutation, error) {
+	switch BodyMutatorName(s) {
+	case BodyMutatorStripUser:
+		return BodyMutation{
+			Mutator: stripUserMutator{},
+			Routes:  []string{OpenAICompletionsPath, OpenAIChatPath},
+		}, nil
+	default:
+		return BodyMutation{}, fmt.Errorf("unknown body mutator: %s", s)
+	}
+}
+
+// StreamUsageIncluder is implemented by request bodies whose streamed responses only report the
+// usage when the request asks for it.
+type StreamUsageIncluder interface {
+	// IncludeStreamUsage makes a streamed response report its usage, returning whether the body
+	// was mutated.
+	IncludeStreamUsage() bool
+}
+
+// streamUsageMutator makes streamed responses report their usage, even if the request has
+// explicitly disabled it.
+type streamUsageMutator struct{}
+
+func (streamUsageMutator) Mutate(body RequestBody) (bool, error) {
+	includer, ok := body.(StreamUsageIncluder)
+	if !ok {
+		return false, nil
+	}
+	return includer.IncludeStreamUsage(), nil
+}
+
+// UserStripper is implemented by request bodies that carry an end-user identifier.
+type UserStripper interface {
+	// StripUser removes the end-user identifier, returning whether the body was mutated.
+	StripUser() bool
+}
+
+type stripUserMutator struct{}
+
+func (stripUserMutator) Mutate(body RequestBody) (bool, error) {
+	stripper, ok := body.(UserStripper)
+	if !ok {
+		return false, nil
+	}
+	return stripper.StripUser(), nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openpcc/openpcc/auth/credentialing"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingMutator struct {
+	name  string
+	calls *[]string
+	err   error
+}
+
+func (m recordingMutator) Mutate(RequestBody) (bool, error) {
+	*m.calls = append(*m.calls, m.name)
+	return m.name == "dirty", m.err
+}
+
+func TestBodyMutations(t *testing.T) {
+	t.Run("ok, run in order on their routes", func(t *testing.T) {
+		var calls []string
+		mutations := BodyMutations{
+			{Mutator: recordingMutator{name: "all", calls: &calls}},
+			{Mutator: recordingMutator{name: "dirty", calls: &calls}, Routes: []string{OpenAIChatPath}},
+			{Mutator: recordingMutator{name: "other", calls: &calls}, Routes: []string{OllamaChatPath}},
+			{Mutator: recordingMutator{name: "last", calls: &calls}, Routes: []string{OllamaChatPath, OpenAIChatPath}},
+		}
+
+		dirty, err := mutations.Mutate(OpenAIChatPath, &OpenAIRequestBodyChat{})
+		require.NoError(t, err)
+		require.True(t, dirty)
+		require.Equal(t, []string{"all", "dirty", "last"}, calls)
+	})
+
+	t.Run("fail, mutator error stops the pipeline", func(t *testing.T) {
+		var calls []string
+		mutations := BodyMutations{
+			{Mutator: recordingMutator{name: "failing", calls: &calls, err: errors.New("boom")}},
+			{Mutator: recordingMutator{name: "dirty", calls: &calls}},
+		}
+
+		_, err := mutations.Mutate(OpenAIChatPath, &OpenAIRequestBodyChat{})
+		require.Error(t, err)
+		require.Equal(t, []string{"failing"}, calls)
+	})
+}
+
+func TestParseBodyMutator(t *testing.T) {
+	mutation, err := ParseBodyMutator(string(BodyMutatorStripUser))
+	require.NoError(t, err)
+	require.Equal(t, []string{OpenAICompletionsPath, OpenAIChatPath}, mutation.Routes)
+
+	_, err = ParseBodyMutator("unknown")
+	require.Error(t, err)
+}
+
+func TestBodyValidatorMutations(t *testing.T) {
+	badge := credentialing.Badge{
+		Credentials: credentialing.Credentials{Models: defaultTestModels},
+		Signature:   []byte("signature"),
+	}
+
+	stripUser, err := ParseBodyMutator(string(BodyMutatorStripUser))
+	require.NoError(t, err)
+
+	validate := func(t *testing.T, mutations BodyMutations, payload string) map[string]any {
+		validator := BodyValidator{
+			MaxSize: 1024,
+			RouteBodyTypes: map[string]func() RequestBody{
+				OpenAIChatPath: func() RequestBody { return &OpenAIRequestBodyChat{} },
+			},
+			SupportedModels: defaultTestModels,
+			Mutations:       mutations,
+		}
+
+		req := httptest.NewRequest(http.MethodPost, OpenAIChatPath, strings.NewReader(payload))
+		req.ContentLength = int64(len(payload))
+		require.NoError(t, validator.ValidateWithBadge(req, &badge))
+
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		var got map[string]any
+		require.NoError(t, json.Unmarshal(body, &got))
+		return got
+	}
+
+	t.Run("ok, required mutations always run", func(t *testing.T) {
+		body := validate(t, nil, `{"model":"llama3.2:1b","messages":[{"role":"user","content":"hi"}],"stream":true,"user":"alice"}`)
+		require.Equal(t, map[string]any{"include_usage": true, "continuous_usage_stats": true}, body["stream_options"])
+		require.Equal(t, "alice", body["user"])
+	})
+
+	t.Run("ok, configured mutations run after the required ones", func(t *testing.T) {
+		body := validate(t, BodyMutations{stripUser}, `{"model":"llama3.2:1b","messages":[{"role":"user","content":"hi"}],"stream":true,"user":"alice"}`)
+		require.Equal(t, map[string]any{"include_usage": true, "continuous_usage_stats": true}, body["stream_options"])
+		require.NotContains(t, body, "user")
+	})
+}
@@ -0,0 +1,68 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"math/bits"
+
+	"github.com/openpcc/openpcc/anonpay/currency"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Span attributes describing the execution budget of a request. The values are bucketed, see
+// BudgetBucket, so traces show the magnitude of credits and tokens without exact amounts that
+// could help link a trace to a client.
+const (
+	BudgetCreditsGrantedAttr        = "confsec.budget.credits_granted"
+	BudgetPromptTokensEstimatedAttr = "confsec.budget.prompt_tokens_estimated"
+	BudgetOutputTokensAttr          = "confsec.budget.output_tokens"
+	BudgetCreditsUsedAttr           = "confsec.budget.credits_used"
+	BudgetRefundAttr                = "confsec.budget.refund"
+)
+
+// promptBytesPerToken is the rough number of request body bytes per prompt token, used to estimate
+// the prompt tokens before the backend reports them.
+const promptBytesPerToken = 4
+
+// BudgetBucket rounds v up to the next power of two. Non-positive values are bucketed to 0.
+func BudgetBucket(v int64) int64 {
+	if v <= 0 {
+		return 0
+	}
+	if v > 1<<62 {
+		return 1 << 62
+	}
+	return 1 << bits.Len64(uint64(v-1))
+}
+
+// EstimatePromptTokens estimates the prompt tokens of a request body of n bytes.
+func EstimatePromptTokens(n int) int64 {
+	return int64((n + promptBytesPerToken - 1) / promptBytesPerToken)
+}
+
+// RefundAttributes returns the bucketed refund and credits used of a request granted creditAmount.
+func RefundAttributes(creditAmount int64, refund currency.Value) ([]attribute.KeyValue, error) {
+	amount, err := refund.Amount()
+	if err != nil {
+		return nil, err
+	}
+	return []attribute.KeyValue{
+		attribute.Int64(BudgetRefundAttr, BudgetBucket(amount)),
+		attribute.Int64(BudgetCreditsUsedAttr, BudgetBucket(creditAmount-amount)),
+	}, nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"testing"
+
+	"github.com/openpcc/openpcc/anonpay/currency"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestBudgetBucket(t *testing.T) {
+	tests := map[string]struct {
+		v    int64
+		want int64
+	}{
+		"negative":       {v: -5, want: 0},
+		"zero":           {v: 0, want: 0},
+		"one":            {v: 1, want: 1},
+		"power of two":   {v: 64, want: 64},
+		"rounded up":     {v: 65, want: 128},
+		"large":          {v: 1_000_000, want: 1 << 20},
+		"capped at 2^62": {v: 1<<62 + 1, want: 1 << 62},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.want, BudgetBucket(tc.v))
+		})
+	}
+}
+
+func TestEstimatePromptTokens(t *testing.T) {
+	require.Equal(t, int64(0), EstimatePromptTokens(0))
+	require.Equal(t, int64(1), EstimatePromptTokens(1))
+	require.Equal(t, int64(25), EstimatePromptTokens(100))
+}
+
+func TestRefundAttributes(t *testing.T) {
+	refund, err := currency.Exact(100)
+	require.NoError(t, err)
+
+	attrs, err := RefundAttributes(1000, refund)
+	require.NoError(t, err)
+	require.Equal(t, []attribute.KeyValue{
+		attribute.Int64(BudgetRefundAttr, 128),
+		attribute.Int64(BudgetCreditsUsedAttr, 1024),
+	}, attrs)
+}
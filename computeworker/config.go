@@ -21,13 +21,19 @@ import (
 	"crypto/ed25519"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net/netip"
+	"os"
 	"strings"
 	"time"
 
+	"github.com/confidentsecurity/confidentcompute/experimental"
+	"github.com/confidentsecurity/confidentcompute/faultinject"
 	"github.com/openpcc/openpcc/attestation/evidence"
 )
 
@@ -36,7 +42,16 @@ import (
 // should be determined based on the typical workload and the desired responsiveness of the system.
 const DefaultTimeout = 10 * time.Second
 
+// LLMAuthorizationEnv is the environment variable router_com uses to pass the Authorization
+// header for the LLM backend. It is not a flag because process arguments are world readable.
+const LLMAuthorizationEnv = "COMPUTE_WORKER_LLM_AUTHORIZATION"
+
+// NodeRequestIDHeader carries the confsec request ID minted by router_com. It's only set on the
+// encrypted response, so only the client can read it and quote it in support requests.
+const NodeRequestIDHeader = "X-Confsec-Node-Request-Id"
+
 var keyHandlePtr *uint
+var refundKeyHandlePtr *uint
 var tpmDevicePtr *string
 var base64PublicKeyPtr *string
 var base64PublicKeyNamePtr *string
@@ -44,17 +59,58 @@ var base64PCRValuesPtr *string
 var simulatePtr *bool
 var simulatorCmdAddressPtr *string
 var simulatorPlatformAddressPtr *string
+var tpmBrokerSocketPtr *string
+var tpmOpTimeoutPtr *time.Duration
 var llmBaseURLPtr *string
 var timeoutPtr *string
 var traceparentPtr *string
 var requestMediaType *string
 var requestEncapsulatedKeyPtr *string
 var requestCreditAmountPtr *int64
+var nodeRequestIDPtr *string
+var echoNodeRequestIDPtr *bool
 var badgePublicKeyPtr *string
 var modelsList FlagValueList
+var simulatedSeedPtr *uint64
+var maxHeaderSizePtr *int
+var maxBodySizePtr *int
+var maxAudioSizePtr *int
+var bannedBadgeKeyIDsList FlagValueList
+var auditBodyRulesList FlagValueList
+var bodyMutatorsList FlagValueList
+var allowedHostnamesList FlagValueList
+var egressDenyList FlagValueList
+var egressPrivateOnlyPtr *bool
+var backendResolveList FlagValueList
+var responseContentTypesList FlagValueList
+var pacingIntervalPtr *time.Duration
+var pacingJitterPtr *time.Duration
+var pacingMaxDelayPtr *time.Duration
+var paddingModePtr *string
+var paddingStepPtr *int64
+var paddingMaxPtr *int64
+var continuationTTLPtr *time.Duration
+var continuationInputDiscountPtr *float64
+var nonceSocketPtr *string
+var faultInjectionPtr *string
+var hardenedJSONPtr *bool
+var sessionPtr *bool
+var outputFilterPtr *string
+var outputFilterDigestPtr *string
+var pricingPtr *string
+var backendPoolSocketPtr *string
+var mirrorLLMBaseURLPtr *string
+var mirrorTimeoutPtr *time.Duration
+var routerRequestIDPtr *string
+var maxTopUpCreditsPtr *int64
+var badgeLimitSocketPtr *string
+var modelWakeSocketPtr *string
+var experimentalRoutesList FlagValueList
+var creditGrantFDPtr *uint
 
 func init() {
 	keyHandlePtr = flag.Uint("tpm_key_handle", 0, "key handle to use for encryption")
+	refundKeyHandlePtr = flag.Uint("tpm_refund_key_handle", 0, "refund key handle to sign refunds with, 0 means refunds are not signed")
 	tpmDevicePtr = flag.String("tpm_device", "", "path to the TPM device")
 	base64PublicKeyPtr = flag.String("tpm_base64_public_key", "", "base64 encoded public key")
 	base64PublicKeyNamePtr = flag.String("tpm_base64_public_key_name", "", "base64 encoded public key name")
@@ -62,27 +118,202 @@ func init() {
 	simulatePtr = flag.Bool("tpm_simulate", false, "simulate the TPM")
 	simulatorCmdAddressPtr = flag.String("tpm_simulator_cmd_addr", "", "Address for talking to the simulator cmd, leave blank for defaults")
 	simulatorPlatformAddressPtr = flag.String("tpm_simulator_platform_addr", "", "Address for talking to the simulator platform, leave blank for defaults")
+	tpmBrokerSocketPtr = flag.String("tpm_broker_socket", "", "unix socket of the tpm access broker, leave blank to use the tpm without a lease")
+	tpmOpTimeoutPtr = flag.Duration("tpm_op_timeout", 0, "max time spent in a tpm operation, 0 means no timeout")
 	llmBaseURLPtr = flag.String("llm_base_url", "http://localhost:11434", "url to send LLM requests to")
 	timeoutPtr = flag.String("service_timeout", DefaultTimeout.String(), "timeout of the worker process")
 	traceparentPtr = flag.String("traceparent", "", "trace context")
 	requestMediaType = flag.String("request_media_type", "", "the media type of the request as claimed by the client")
 	requestEncapsulatedKeyPtr = flag.String("request_encapsulated_key", "", "encapsulated key used to decrypt the request, should be base 64 encoded")
 	requestCreditAmountPtr = flag.Int64("request_credit_amount", 0, "the amount of credits that can be spent on this request")
+	nodeRequestIDPtr = flag.String("node_request_id", "", "the confsec request ID minted by router_com, used to correlate logs")
+	echoNodeRequestIDPtr = flag.Bool("echo_node_request_id", false, "include the confsec request ID in the encrypted response")
 	badgePublicKeyPtr = flag.String("badge_public_key", "", "the PEM-encoded public key counterpart to the ed25519 private key that the auth server uses to sign badges")
 	// Since modelsList is of type FlagValueList, the flag '--model <some-val>' can be specified multiple
 	// times in the invocation, which will cause <some-val> to be appended to modelsList
 	flag.Var(&modelsList, "model", "an LLM model that the node is running")
+	simulatedSeedPtr = flag.Uint64("simulated_seed", 0, "seed for deterministic simulated responses, 0 means non-deterministic")
+	maxHeaderSizePtr = flag.Int("max_header_size", DefaultValidationLimits().MaxHeaderSize, "max size of a single request header")
+	maxBodySizePtr = flag.Int("max_body_size", DefaultValidationLimits().MaxBodySize, "max size of the request body")
+	maxAudioSizePtr = flag.Int("max_audio_size", DefaultValidationLimits().MaxAudioSize, "max size of a multipart/form-data request body carrying audio")
+	flag.Var(&bannedBadgeKeyIDsList, "banned_badge_key_id", "the key id of a badge that is no longer accepted, see BadgeKeyID")
+	flag.Var(&auditBodyRulesList, "audit_body_rule", "a body validation rule to log instead of enforce, one of unknown_fields, multiple_json_objects, json_limits, ollama_format, tools, messages")
+	flag.Var(&bodyMutatorsList, "body_mutator", "an optional mutation of request bodies, run in the order given, one of strip_user")
+	flag.Var(&allowedHostnamesList, "allowed_hostname", "a hostname clients may address requests to, defaults to the unroutable hostname")
+	flag.Var(&egressDenyList, "egress_deny", "a prefix or address the worker may not connect to, cloud metadata addresses are always denied")
+	egressPrivateOnlyPtr = flag.Bool("egress_private_only", false, "only connect to loopback, RFC 1918 and unique local addresses")
+	flag.Var(&backendResolveList, "backend_resolve", "a host=address pin, the host is dialed at the address without name resolution")
+	flag.Var(&responseContentTypesList, "response_content_type", "a media type the llm may respond with, defaults to json, ndjson and event streams")
+	pacingIntervalPtr = flag.Duration("pacing_interval", 0, "target time between response chunks, 0 disables pacing")
+	pacingJitterPtr = flag.Duration("pacing_jitter", 0, "random duration added to the pacing interval, 0 means a constant cadence")
+	pacingMaxDelayPtr = flag.Duration("pacing_max_delay", DefaultPacingMaxDelay, "max latency pacing adds to a response")
+	paddingModePtr = flag.String("padding_mode", "", "pad responses to size buckets, power_of_two or step, leave blank to disable padding")
+	paddingStepPtr = flag.Int64("padding_step", 0, "bucket size in step mode, smallest bucket in power_of_two mode")
+	paddingMaxPtr = flag.Int64("padding_max", 0, "max filler bytes added to a response, larger responses are not padded")
+	continuationTTLPtr = flag.Duration("continuation_ttl", 0, "how long continuation tokens of tool calls are accepted, 0 disables continuations")
+	nonceSocketPtr = flag.String("nonce_socket", "", "unix socket of the nonce ledger that makes continuation tokens and credit grants single use")
+	continuationInputDiscountPtr = flag.Float64("continuation_input_discount", 0, "fraction of the input tokens covered by continuation tokens that is not charged")
+	hardenedJSONPtr = flag.Bool("hardened_json", false, "check request bodies against string, number and nesting limits before decoding them")
+	sessionPtr = flag.Bool("session", false, "handle sequential requests framed on stdin until it is closed, the request flags are ignored")
+	faultInjectionPtr = flag.String("fault_injection", "", "JSON fault injection config, only for resilience testing")
+	outputFilterPtr = flag.String("output_filter", "", "path to a Go plugin that filters the output before it is encrypted, leave blank to disable output filtering")
+	outputFilterDigestPtr = flag.String("output_filter_digest", "", "hex encoded sha-256 digest the output filter must match, as disclosed in the evidence")
+	pricingPtr = flag.String("pricing", "", "JSON credit pricing overrides per route, leave blank to price every route by its tokens")
+	backendPoolSocketPtr = flag.String("backend_pool_socket", "", "unix socket of the backend pool that picks the backend replicas of models, leave blank to send every request to the llm base url")
+	mirrorLLMBaseURLPtr = flag.String("mirror_llm_base_url", "", "url of a shadow LLM backend validated requests are duplicated to, leave blank to disable mirroring")
+	mirrorTimeoutPtr = flag.Duration("mirror_timeout", DefaultMirrorTimeout, "max time a mirrored request may take")
+	routerRequestIDPtr = flag.String("router_request_id", "", "the request ID set by the router, credit grants are bound to it")
+	maxTopUpCreditsPtr = flag.Int64("max_top_up_credits", 0, "max credits that can be granted to the request while it runs, 0 disables top-ups")
+	badgeLimitSocketPtr = flag.String("badge_limit_socket", "", "unix socket of the badge limiter, leave blank to not bound the parallel requests of badges")
+	modelWakeSocketPtr = flag.String("model_wake_socket", "", "unix socket of the model waker, leave blank to send requests for sleeping models as is")
+	flag.Var(&experimentalRoutesList, "experimental_route", "an experimental route to serve, as disclosed in the evidence, requires a build with the experimental build tag")
+	creditGrantFDPtr = flag.Uint("credit_grant_fd", 0, "file descriptor router_com writes signed credit grants to, 0 disables top-ups")
 }
 
 type Config struct {
-	TPM         TPMConfig
-	LLMBaseURL  string
-	Timeout     time.Duration
-	Traceparent string
+	TPM        TPMConfig
+	LLMBaseURL string
+	// LLMAuthorization is the Authorization header sent to the LLM backend. It is never taken from
+	// the client request. Leave blank to send no Authorization header.
+	LLMAuthorization string
+	Timeout          time.Duration
+	Traceparent      string
 	// RequestParams are the parameters used to handle the request.
 	RequestParams  RequestParams
 	BadgePublicKey []byte
 	Models         []string
+	// SimulatedSeed makes simulated responses deterministic when non-zero. Only intended for load testing.
+	SimulatedSeed uint64
+	// Limits are the request size limits, zero values use the defaults.
+	Limits ValidationLimits
+	// BannedBadgeKeyIDs are badge key IDs that are no longer accepted.
+	BannedBadgeKeyIDs []string
+	// AuditBodyRules are body rules in audit mode, violations are logged but the request is allowed.
+	AuditBodyRules []BodyRule
+	// BodyMutations are the optional mutations of request bodies, run in order after the required ones.
+	BodyMutations BodyMutations
+	// AllowedHostnames are the hostnames clients may address requests to besides the unroutable hostname.
+	AllowedHostnames []string
+	// ResponseContentTypes are the media types the LLM may respond with, empty uses DefaultResponseContentTypes.
+	ResponseContentTypes []string
+	// Pacing re-times the ciphertext chunks to mask token timing, a zero interval disables pacing.
+	Pacing PacingConfig
+	// Padding pads responses to size buckets to mask their length, a blank mode disables padding.
+	Padding PaddingConfig
+	// FaultInjection are the faults injected for resilience testing, nil disables fault injection.
+	FaultInjection *faultinject.Config
+	// EchoNodeRequestID includes the confsec request ID in the encrypted response, see NodeRequestIDHeader.
+	EchoNodeRequestID bool
+	// HardenedJSON checks request bodies against DefaultJSONLimits before they are decoded.
+	HardenedJSON bool
+	// Session handles sequential requests framed on stdin, see Session. RequestParams are set per request.
+	Session bool
+	// PromptCacheKey derives the vLLM prefix cache salts of requests, see PromptCacheHandle. Nil
+	// disables prefix cache salting.
+	PromptCacheKey []byte
+	// SessionHintKey derives the session hints of requests, see SessionHint. Nil disables session hints.
+	SessionHintKey []byte
+	// Continuation discounts the input of follow-ups of tool calls, a zero TTL disables continuations.
+	Continuation ContinuationConfig
+	// NonceSocket is the unix socket of the nonce ledger router_com runs, it makes continuation tokens
+	// and credit grants single use across the workers of the node.
+	NonceSocket string
+	// ContinuationKey signs the continuation tokens, see ContinuationConfig. Nil disables continuations.
+	ContinuationKey []byte
+	// OutputFilter filters the output before it is encrypted, see LoadOutputFilter. Nil disables
+	// output filtering.
+	OutputFilter OutputFilter
+	// Pricing overrides the credit pricing of routes, nil prices every route by its tokens.
+	Pricing *PricingConfig
+	// BackendPoolSocket is the unix socket of the backend pool router_com runs, see backendpool. It
+	// picks the backend of requests for models with backend replicas. Leave blank to send every
+	// request to LLMBaseURL.
+	BackendPoolSocket string
+	// EgressDeny are prefixes the worker may not connect to in addition to DefaultEgressDeny.
+	EgressDeny []netip.Prefix
+	// EgressPrivateOnly only allows connections to PrivateEgress.
+	EgressPrivateOnly bool
+	// BackendResolve pins hosts to addresses, they are dialed without name resolution.
+	BackendResolve map[string]netip.Addr
+	// Mirror duplicates validated requests to a shadow backend, a blank base url disables mirroring.
+	Mirror MirrorConfig
+	// MaxTopUpCredits bounds the credits granted to a running request, see CreditGrant. 0 disables top-ups.
+	MaxTopUpCredits int64
+	// CreditGrants carries the JSON lines credit grants of the request, nil disables top-ups.
+	CreditGrants io.Reader
+	// BadgeLimitSocket is the unix socket of the badge limiter, see badgelimit. Leave blank to not
+	// bound the parallel requests of badges.
+	BadgeLimitSocket string
+	// ModelWakeSocket is the unix socket of the model waker, see modelwake. Leave blank to send
+	// requests for sleeping models to the backend as is.
+	ModelWakeSocket string
+	// ExperimentalRoutes are the experimental routes the worker serves, see experimental.CheckBuild.
+	ExperimentalRoutes []string
+	// FlagParseDuration is how long parsing the flags took, it is reported in the StartupLatency.
+	FlagParseDuration time.Duration
+}
+
+// topUpEnabled reports whether the request can receive credit grants while it runs.
+func (c *Config) topUpEnabled() bool {
+	return c.MaxTopUpCredits > 0 && c.CreditGrants != nil && len(c.RequestParams.EncapsulatedKey) > 0
+}
+
+// responseContentTypes returns the allowed response media types, falling back to the defaults.
+func (c *Config) responseContentTypes() []string {
+	if len(c.ResponseContentTypes) == 0 {
+		return DefaultResponseContentTypes
+	}
+	return c.ResponseContentTypes
+}
+
+// creditCeiling returns the most credits the request can spend. With top-ups the backend may
+// generate up to the max top-up, the response is ended at the credits granted so far.
+func (c *Config) creditCeiling() int64 {
+	if c.topUpEnabled() {
+		return c.RequestParams.CreditAmount + c.MaxTopUpCredits
+	}
+	return c.RequestParams.CreditAmount
+}
+
+// validatorOptions returns the configured validator options, falling back to the default limits for zero values.
+func (c *Config) validatorOptions() ValidatorOptions {
+	limits := DefaultValidationLimits()
+	if c.Limits.MaxHeaderSize > 0 {
+		limits.MaxHeaderSize = c.Limits.MaxHeaderSize
+	}
+	if c.Limits.MaxBodySize > 0 {
+		limits.MaxBodySize = c.Limits.MaxBodySize
+	}
+	if c.Limits.MaxAudioSize > 0 {
+		limits.MaxAudioSize = c.Limits.MaxAudioSize
+	}
+	return ValidatorOptions{
+		Limits:                  limits,
+		BannedBadgeKeyIDs:       c.BannedBadgeKeyIDs,
+		AuditBodyRules:          c.AuditBodyRules,
+		BodyMutations:           c.BodyMutations,
+		AllowedHostnames:        c.AllowedHostnames,
+		CreditAmount:            c.creditCeiling(),
+		HardenedJSON:            c.HardenedJSON,
+		PromptCacheKey:          c.PromptCacheKey,
+		SessionHintKey:          c.SessionHintKey,
+		ContinuationKey:         c.continuationKey(),
+		ContinuationNonceSocket: c.NonceSocket,
+		ExperimentalRoutes:      c.ExperimentalRoutes,
+	}
+}
+
+// continuationsEnabled reports whether continuation tokens are issued and accepted.
+func (c *Config) continuationsEnabled() bool {
+	return c.Continuation.TTL > 0 && len(c.ContinuationKey) > 0
+}
+
+// continuationKey returns the key that verifies continuation tokens, nil when they are disabled.
+func (c *Config) continuationKey() []byte {
+	if !c.continuationsEnabled() {
+		return nil
+	}
+	return c.ContinuationKey
 }
 
 type TPMConfig struct {
@@ -94,12 +325,28 @@ type TPMConfig struct {
 	PublicKeyBytes           []byte
 	PublicKeyNameBytes       []byte
 	PCRValues                map[uint32][]byte
+	// BrokerSocket is the unix socket of the TPM access broker, see tpmbroker. Leave blank to use
+	// the TPM without a lease.
+	BrokerSocket string
+	// OpTimeout is the max time spent in a TPM operation, including opening the TPM. 0 means no timeout.
+	OpTimeout time.Duration
+	// RefundKeyHandle is the handle of the refund key the refund in the footer is signed with, see
+	// RefundStatement. It is bound to the PCR values like the REK. 0 means refunds are not signed.
+	RefundKeyHandle uint
 }
 
 type RequestParams struct {
-	MediaType       string
-	EncapsulatedKey []byte
-	CreditAmount    int64
+	MediaType       string `json:"media_type"`
+	EncapsulatedKey []byte `json:"encapsulated_key"`
+	CreditAmount    int64  `json:"credit_amount"`
+	// NodeRequestID is the confsec request ID minted by router_com, empty if there is none.
+	NodeRequestID string `json:"node_request_id,omitempty"`
+	// LLMBaseURL is the backend instance router_com picked for the request, session workers serve
+	// requests for several backends. Empty uses Config.LLMBaseURL.
+	LLMBaseURL string `json:"llm_base_url,omitempty"`
+	// RouterRequestID is the request ID set by the router, empty if there is none. Credit grants are
+	// bound to it, see CreditGrant.
+	RouterRequestID string `json:"router_request_id,omitempty"`
 }
 
 func DecodeBadgeKey(badgePK string) (ed25519.PublicKey, error) {
@@ -125,6 +372,7 @@ func DecodeBadgeKey(badgePK string) (ed25519.PublicKey, error) {
 }
 
 func ParseConfigFromFlags() (*Config, error) {
+	start := time.Now()
 	flag.Parse()
 
 	timeout, err := time.ParseDuration(*timeoutPtr)
@@ -132,7 +380,8 @@ func ParseConfigFromFlags() (*Config, error) {
 		return nil, fmt.Errorf("failed to parse timeout: %w", err)
 	}
 
-	if len(*requestMediaType) == 0 {
+	// in session mode every request brings its own params.
+	if !*sessionPtr && len(*requestMediaType) == 0 {
 		return nil, errors.New("missing request media type")
 	}
 
@@ -154,6 +403,109 @@ func ParseConfigFromFlags() (*Config, error) {
 		return nil, fmt.Errorf("invalid request credit amount: %d", *requestCreditAmountPtr)
 	}
 
+	auditBodyRules := make([]BodyRule, 0, len(auditBodyRulesList))
+	for _, name := range auditBodyRulesList {
+		rule, err := ParseBodyRule(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid audit body rule: %w", err)
+		}
+		auditBodyRules = append(auditBodyRules, rule)
+	}
+
+	bodyMutations := make(BodyMutations, 0, len(bodyMutatorsList))
+	for _, name := range bodyMutatorsList {
+		mutation, err := ParseBodyMutator(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body mutator: %w", err)
+		}
+		bodyMutations = append(bodyMutations, mutation)
+	}
+
+	responseContentTypes, err := ParseResponseContentTypes(responseContentTypesList)
+	if err != nil {
+		return nil, err
+	}
+
+	egressDeny, err := ParseEgressDeny(egressDenyList)
+	if err != nil {
+		return nil, err
+	}
+
+	backendResolve, err := ParseBackendResolve(backendResolveList)
+	if err != nil {
+		return nil, err
+	}
+
+	pacing := PacingConfig{
+		Interval: *pacingIntervalPtr,
+		Jitter:   *pacingJitterPtr,
+		MaxDelay: *pacingMaxDelayPtr,
+	}
+	if err := pacing.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid pacing: %w", err)
+	}
+
+	padding := PaddingConfig{
+		Mode:       *paddingModePtr,
+		Step:       *paddingStepPtr,
+		MaxPadding: *paddingMaxPtr,
+	}
+	if err := padding.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid padding: %w", err)
+	}
+
+	continuation := ContinuationConfig{
+		TTL:           *continuationTTLPtr,
+		InputDiscount: *continuationInputDiscountPtr,
+	}
+	if err := continuation.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid continuation: %w", err)
+	}
+	if continuation.TTL > 0 && *nonceSocketPtr == "" {
+		return nil, errors.New("invalid continuation: missing nonce socket")
+	}
+
+	var faultInjection *faultinject.Config
+	if *faultInjectionPtr != "" {
+		faultInjection = &faultinject.Config{}
+		if err := json.Unmarshal([]byte(*faultInjectionPtr), faultInjection); err != nil {
+			return nil, fmt.Errorf("failed to parse fault injection config: %w", err)
+		}
+		if err := faultInjection.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid fault injection config: %w", err)
+		}
+	}
+
+	var pricing *PricingConfig
+	if *pricingPtr != "" {
+		pricing = &PricingConfig{}
+		if err := json.Unmarshal([]byte(*pricingPtr), pricing); err != nil {
+			return nil, fmt.Errorf("failed to parse pricing config: %w", err)
+		}
+		if err := pricing.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid pricing config: %w", err)
+		}
+	}
+
+	mirror := MirrorConfig{
+		BaseURL: *mirrorLLMBaseURLPtr,
+		Timeout: *mirrorTimeoutPtr,
+	}
+	if err := mirror.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid mirror: %w", err)
+	}
+
+	if *maxTopUpCreditsPtr < 0 {
+		return nil, fmt.Errorf("invalid max top-up credits: %d", *maxTopUpCreditsPtr)
+	}
+	var creditGrants io.Reader
+	if *creditGrantFDPtr != 0 {
+		if *nonceSocketPtr == "" {
+			return nil, errors.New("invalid credit grants: missing nonce socket")
+		}
+		creditGrants = os.NewFile(uintptr(*creditGrantFDPtr), "credit_grants")
+	}
+
 	pubKeyB, err := base64.StdEncoding.DecodeString(*base64PublicKeyPtr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to base64 decode public key: %w", err)
@@ -175,9 +527,70 @@ func ParseConfigFromFlags() (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal pcr values: %w", err)
 	}
 
+	// the credential is only needed by this process, don't leak it into anything we start.
+	llmAuthorization := os.Getenv(LLMAuthorizationEnv)
+	if err := os.Unsetenv(LLMAuthorizationEnv); err != nil {
+		return nil, fmt.Errorf("failed to unset %s: %w", LLMAuthorizationEnv, err)
+	}
+
+	var promptCacheKey []byte
+	if v := os.Getenv(PromptCacheKeyEnv); v != "" {
+		promptCacheKey, err = base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse prompt cache key: %w", err)
+		}
+		if len(promptCacheKey) != PromptCacheKeyLen {
+			return nil, fmt.Errorf("invalid prompt cache key length: %d", len(promptCacheKey))
+		}
+	}
+	if err := os.Unsetenv(PromptCacheKeyEnv); err != nil {
+		return nil, fmt.Errorf("failed to unset %s: %w", PromptCacheKeyEnv, err)
+	}
+
+	var sessionHintKey []byte
+	if v := os.Getenv(SessionHintKeyEnv); v != "" {
+		sessionHintKey, err = base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse session hint key: %w", err)
+		}
+		if len(sessionHintKey) != SessionHintKeyLen {
+			return nil, fmt.Errorf("invalid session hint key length: %d", len(sessionHintKey))
+		}
+	}
+	if err := os.Unsetenv(SessionHintKeyEnv); err != nil {
+		return nil, fmt.Errorf("failed to unset %s: %w", SessionHintKeyEnv, err)
+	}
+
+	var continuationKey []byte
+	if v := os.Getenv(ContinuationKeyEnv); v != "" {
+		continuationKey, err = base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse continuation key: %w", err)
+		}
+		if len(continuationKey) != ContinuationKeyLen {
+			return nil, fmt.Errorf("invalid continuation key length: %d", len(continuationKey))
+		}
+	}
+	if err := os.Unsetenv(ContinuationKeyEnv); err != nil {
+		return nil, fmt.Errorf("failed to unset %s: %w", ContinuationKeyEnv, err)
+	}
+
+	if err := experimental.CheckBuild(experimentalRoutesList); err != nil {
+		return nil, err
+	}
+
+	var outputFilter OutputFilter
+	if *outputFilterPtr != "" {
+		outputFilter, err = LoadOutputFilter(*outputFilterPtr, *outputFilterDigestPtr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &Config{
 		TPM: TPMConfig{
 			KeyHandle:                *keyHandlePtr,
+			RefundKeyHandle:          *refundKeyHandlePtr,
 			Device:                   *tpmDevicePtr,
 			Simulate:                 *simulatePtr,
 			SimulatorCmdAddress:      *simulatorCmdAddressPtr,
@@ -185,17 +598,57 @@ func ParseConfigFromFlags() (*Config, error) {
 			PublicKeyBytes:           pubKeyB,
 			PublicKeyNameBytes:       pubKeyNameB,
 			PCRValues:                pcrVals.Values,
+			BrokerSocket:             *tpmBrokerSocketPtr,
+			OpTimeout:                *tpmOpTimeoutPtr,
 		},
-		LLMBaseURL:  *llmBaseURLPtr,
-		Timeout:     timeout,
-		Traceparent: *traceparentPtr,
+		LLMBaseURL:       *llmBaseURLPtr,
+		LLMAuthorization: llmAuthorization,
+		Timeout:          timeout,
+		Traceparent:      *traceparentPtr,
 		RequestParams: RequestParams{
 			MediaType:       *requestMediaType,
 			EncapsulatedKey: encapKeyB,
 			CreditAmount:    *requestCreditAmountPtr,
+			NodeRequestID:   *nodeRequestIDPtr,
+			RouterRequestID: *routerRequestIDPtr,
 		},
 		BadgePublicKey: badgeKey,
 		Models:         modelsList,
+		SimulatedSeed:  *simulatedSeedPtr,
+		Limits: ValidationLimits{
+			MaxHeaderSize: *maxHeaderSizePtr,
+			MaxBodySize:   *maxBodySizePtr,
+			MaxAudioSize:  *maxAudioSizePtr,
+		},
+		BannedBadgeKeyIDs:    bannedBadgeKeyIDsList,
+		AuditBodyRules:       auditBodyRules,
+		BodyMutations:        bodyMutations,
+		AllowedHostnames:     allowedHostnamesList,
+		ResponseContentTypes: responseContentTypes,
+		Pacing:               pacing,
+		Padding:              padding,
+		FaultInjection:       faultInjection,
+		EchoNodeRequestID:    *echoNodeRequestIDPtr,
+		HardenedJSON:         *hardenedJSONPtr,
+		Session:              *sessionPtr,
+		PromptCacheKey:       promptCacheKey,
+		SessionHintKey:       sessionHintKey,
+		Continuation:         continuation,
+		ContinuationKey:      continuationKey,
+		OutputFilter:         outputFilter,
+		Pricing:              pricing,
+		BackendPoolSocket:    *backendPoolSocketPtr,
+		EgressDeny:           egressDeny,
+		EgressPrivateOnly:    *egressPrivateOnlyPtr,
+		BackendResolve:       backendResolve,
+		Mirror:               mirror,
+		MaxTopUpCredits:      *maxTopUpCreditsPtr,
+		CreditGrants:         creditGrants,
+		NonceSocket:          *nonceSocketPtr,
+		BadgeLimitSocket:     *badgeLimitSocketPtr,
+		ModelWakeSocket:      *modelWakeSocketPtr,
+		ExperimentalRoutes:   experimentalRoutesList,
+		FlagParseDuration:    time.Since(start),
 	}, nil
 }
 
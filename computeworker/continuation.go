@@ -0,0 +1,367 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeworker
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/nonceledger"
+)
+
+// ContinuationHeader is the header clients send the continuation tokens of the footer of a previous
+// response back in, with the follow-up request that answers its tool calls. Tokens are separated by
+// commas. It is part of the inner request, the router never sees it.
+const ContinuationHeader = "X-Confsec-Continuation"
+
+// ContinuationKeyEnv is the environment variable router_com uses to pass the continuation key. It is
+// not a flag because process arguments are world readable.
+const ContinuationKeyEnv = "COMPUTE_WORKER_CONTINUATION_KEY"
+
+// ContinuationKeyLen is the length of the continuation key router_com generates at startup.
+const ContinuationKeyLen = 32
+
+// MaxContinuationTTL bounds ContinuationConfig.TTL, a tool call that takes longer is paid in full.
+// The nonce ledger forgets nonces after this long.
+const MaxContinuationTTL = nonceledger.MaxTTL
+
+// maxContinuations is the max number of tool calls of a response that get a continuation token, and
+// the max number of tokens a request can carry.
+const maxContinuations = 16
+
+// continuationVersion is the first byte of a continuation token.
+const continuationVersion = 2
+
+// continuationNonceLen is the length of the nonce that makes a continuation token single use.
+const continuationNonceLen = 16
+
+// continuationPayloadLen is the length of the version, expiry, covered input tokens, covered
+// messages and nonce of a token, continuationLen adds the HMAC-SHA256 tag.
+const (
+	continuationPayloadLen = 1 + 8 + 4 + 4 + continuationNonceLen
+	continuationLen        = continuationPayloadLen + sha256.Size
+)
+
+// maxContinuationHeaderSize fits maxContinuations base64 encoded tokens and their separators.
+const maxContinuationHeaderSize = maxContinuations * ((continuationLen*8+5)/6 + 2)
+
+// continuationRequestHeader carries the input tokens the continuation tokens of a request cover from
+// the body validator to the refund. Like sessionHintRequestHeader it is only set by the validator.
+const continuationRequestHeader = "X-Confsec-Internal-Continuation"
+
+// continuationPrefixRequestHeader carries the ConversationPrefix of a request from the body validator
+// to the continuation tokens of its response. Like continuationRequestHeader it is only set by the
+// validator.
+const continuationPrefixRequestHeader = "X-Confsec-Internal-Continuation-Prefix"
+
+var continuationInfo = []byte("confsec continuation v2")
+
+// ContinuationConfig discounts the input of follow-up requests of responses that end in tool calls.
+// The input of a follow-up repeats the conversation the node has just priced, so the node issues a
+// continuation token per tool call in the footer. The input tokens of a response are split over its
+// tokens, a follow-up that carries all of them is discounted on the whole conversation, parallel
+// follow-ups that each answer some of the calls on their share.
+//
+// Tokens are signed with a key router_com generates at startup, so they are only accepted by the
+// node that issued them. They are bound to the conversation they continue, a follow-up must start
+// with the messages of the request that issued them, and they are single use: router_com records
+// their nonces in its nonce ledger until they expire, see Config.NonceSocket.
+type ContinuationConfig struct {
+	// TTL is how long a token is accepted. Zero disables continuation tokens.
+	TTL time.Duration `yaml:"ttl"`
+	// InputDiscount is the fraction of the covered input tokens that is not charged, between 0 and 1.
+	InputDiscount float64 `yaml:"input_discount"`
+}
+
+func (c *ContinuationConfig) Validate() error {
+	if c.TTL == 0 {
+		return nil
+	}
+	if c.TTL < 0 || c.TTL > MaxContinuationTTL {
+		return fmt.Errorf("continuation ttl must be between 0 and %s", MaxContinuationTTL)
+	}
+	if !(c.InputDiscount > 0 && c.InputDiscount <= 1) {
+		return errors.New("continuation input discount must be above 0 and at most 1")
+	}
+	return nil
+}
+
+// ContinuationToken is what a continuation token vouches for.
+type ContinuationToken struct {
+	// Expiry is when the token is no longer accepted.
+	Expiry time.Time
+	// InputTokens are the input tokens of the follow-up the token covers.
+	InputTokens uint32
+	// Messages is the number of messages of the request that issued the token, the follow-up must
+	// start with them.
+	Messages uint32
+	// Nonce makes the token single use, see nonceledger.
+	Nonce []byte
+}
+
+// Conversation is implemented by request bodies that are a conversation that can call tools, e.g.
+// chat completions.
+type Conversation interface {
+	// MessageCount returns the number of messages of the conversation.
+	MessageCount() int
+	// ConversationDigest returns the digest of the first n messages, false when there are fewer.
+	ConversationDigest(n int) ([]byte, bool)
+	// AnsweredToolCalls returns the IDs of the tool calls the request has results for.
+	AnsweredToolCalls() []string
+}
+
+// ConversationPrefix is the conversation continuation tokens are bound to, the messages of the
+// request that issued them.
+type ConversationPrefix struct {
+	// Messages is the number of messages.
+	Messages uint32
+	// Digest is the ConversationDigest of the messages.
+	Digest []byte
+}
+
+// IssueContinuations returns a continuation token per tool call, that split the covered input tokens
+// between them. The tokens are bound to the requested model, to the conversation prefix and to
+// their tool call.
+func IssueContinuations(key []byte, model string, prefix ConversationPrefix, toolCallIDs []string, inputTokens uint32, expiry time.Time) []string {
+	if len(toolCallIDs) == 0 {
+		return nil
+	}
+	toolCallIDs = toolCallIDs[:min(len(toolCallIDs), maxContinuations)]
+
+	n := uint32(len(toolCallIDs)) // #nosec G115 -- bounded by maxContinuations
+	tokens := make([]string, 0, len(toolCallIDs))
+	for i, id := range toolCallIDs {
+		share := inputTokens / n
+		if i == 0 {
+			share += inputTokens % n
+		}
+		nonce := make([]byte, continuationNonceLen)
+		// crypto/rand.Read never returns an error.
+		_, _ = rand.Read(nonce)
+		c := ContinuationToken{Expiry: expiry, InputTokens: share, Messages: prefix.Messages, Nonce: nonce}
+		tokens = append(tokens, issueContinuation(key, model, id, prefix.Digest, c))
+	}
+	return tokens
+}
+
+func issueContinuation(key []byte, model string, toolCallID string, prefixDigest []byte, c ContinuationToken) string {
+	payload := make([]byte, 0, continuationLen)
+	payload = append(payload, continuationVersion)
+	payload = binary.BigEndian.AppendUint64(payload, uint64(c.Expiry.Unix())) // #nosec G115 -- expiries are after the epoch
+	payload = binary.BigEndian.AppendUint32(payload, c.InputTokens)
+	payload = binary.BigEndian.AppendUint32(payload, c.Messages)
+	payload = append(payload, c.Nonce...)
+	return base64.RawURLEncoding.EncodeToString(continuationMAC(key, model, toolCallID, prefixDigest, payload))
+}
+
+// continuationMAC appends the tag of payload to it. The model and tool call ID are hashed, so the
+// tag can't be forged by moving bytes between them.
+func continuationMAC(key []byte, model string, toolCallID string, prefixDigest []byte, payload []byte) []byte {
+	modelHash := sha256.Sum256([]byte(model))
+	toolCallHash := sha256.Sum256([]byte(toolCallID))
+	mac := hmac.New(sha256.New, key)
+	mac.Write(continuationInfo)
+	mac.Write([]byte{0})
+	mac.Write(modelHash[:])
+	mac.Write(toolCallHash[:])
+	mac.Write(prefixDigest)
+	mac.Write(payload)
+	return mac.Sum(payload)
+}
+
+// VerifyContinuation verifies a continuation token for the tool call of a follow-up request for
+// model. The follow-up must start with the conversation prefix the token was issued for. The nonce of
+// the token still has to be claimed, see nonceledger.Claim.
+func VerifyContinuation(key []byte, model string, toolCallID string, conversation Conversation, token string, now time.Time) (ContinuationToken, error) {
+	b, err := decodeContinuation(token)
+	if err != nil {
+		return ContinuationToken{}, err
+	}
+
+	messages := binary.BigEndian.Uint32(b[13:17])
+	if uint64(messages) > uint64(conversation.MessageCount()) {
+		return ContinuationToken{}, errors.New("continuation token doesn't verify")
+	}
+	prefixDigest, ok := conversation.ConversationDigest(int(messages))
+	if !ok {
+		return ContinuationToken{}, errors.New("continuation token doesn't verify")
+	}
+	want := continuationMAC(key, model, toolCallID, prefixDigest, slices.Clone(b[:continuationPayloadLen]))
+	if !hmac.Equal(b, want) {
+		return ContinuationToken{}, errors.New("continuation token doesn't verify")
+	}
+
+	expiry := binary.BigEndian.Uint64(b[1:9])
+	if expiry > math.MaxInt64 {
+		return ContinuationToken{}, errors.New("continuation token has an invalid expiry")
+	}
+	c := ContinuationToken{
+		Expiry:      time.Unix(int64(expiry), 0),
+		InputTokens: binary.BigEndian.Uint32(b[9:13]),
+		Messages:    messages,
+		Nonce:       slices.Clone(b[17:continuationPayloadLen]),
+	}
+	if !now.Before(c.Expiry) {
+		return ContinuationToken{}, errors.New("continuation token expired")
+	}
+	return c, nil
+}
+
+func decodeContinuation(token string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("malformed continuation token: %w", err)
+	}
+	if len(b) != continuationLen || b[0] != continuationVersion {
+		return nil, errors.New("malformed continuation token")
+	}
+	return b, nil
+}
+
+// parseContinuationHeader checks the shape of the tokens of ContinuationHeader, they are verified
+// by the body validator.
+func parseContinuationHeader(value string) error {
+	tokens := strings.Split(value, ",")
+	if len(tokens) > maxContinuations {
+		return fmt.Errorf("more than %d continuation tokens", maxContinuations)
+	}
+	for _, token := range tokens {
+		if _, err := decodeContinuation(strings.TrimSpace(token)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setContinuation sets the conversation prefix the continuation tokens of the response to r are
+// bound to, verifies the continuation tokens of r and sets the input tokens they cover. Each token
+// must answer a distinct tool call of the request and is claimed with the nonce ledger at
+// nonceSocket. Tokens that don't verify or were used before are ignored, the request is then priced
+// in full.
+func setContinuation(r *http.Request, key []byte, nonceSocket string, model string, requestBody any, now time.Time) {
+	conversation, ok := requestBody.(Conversation)
+	if len(key) == 0 || !ok {
+		return
+	}
+
+	messages := conversation.MessageCount()
+	if digest, ok := conversation.ConversationDigest(messages); ok {
+		r.Header.Set(continuationPrefixRequestHeader, strconv.Itoa(messages)+" "+hex.EncodeToString(digest))
+	}
+
+	value := r.Header.Get(ContinuationHeader)
+	if value == "" {
+		return
+	}
+
+	toolCallIDs := conversation.AnsweredToolCalls()
+	var covered uint64
+	for _, token := range strings.Split(value, ",") {
+		for i, id := range toolCallIDs {
+			c, err := VerifyContinuation(key, model, id, conversation, strings.TrimSpace(token), now)
+			if err != nil {
+				continue
+			}
+			if err := claimContinuation(r.Context(), nonceSocket, c); err != nil {
+				slog.WarnContext(r.Context(), "Continuation token refused", "error", err)
+				break
+			}
+			covered += uint64(c.InputTokens)
+			toolCallIDs = slices.Delete(toolCallIDs, i, i+1)
+			break
+		}
+	}
+	if covered > 0 {
+		r.Header.Set(continuationRequestHeader, strconv.FormatUint(covered, 10))
+	}
+}
+
+// claimContinuation claims the nonce of c, so c isn't accepted again.
+func claimContinuation(ctx context.Context, nonceSocket string, c ContinuationToken) error {
+	if nonceSocket == "" {
+		return errors.New("no continuation nonce ledger")
+	}
+	return nonceledger.Claim(ctx, nonceSocket, c.Nonce, c.Expiry)
+}
+
+// continuationPrefix returns the conversation prefix the validator set on req, false when it isn't a
+// conversation.
+func continuationPrefix(req *http.Request) (ConversationPrefix, bool) {
+	messagesText, digestText, ok := strings.Cut(req.Header.Get(continuationPrefixRequestHeader), " ")
+	if !ok {
+		return ConversationPrefix{}, false
+	}
+	messages, err := strconv.ParseUint(messagesText, 10, 32)
+	if err != nil {
+		return ConversationPrefix{}, false
+	}
+	digest, err := hex.DecodeString(digestText)
+	if err != nil {
+		return ConversationPrefix{}, false
+	}
+	return ConversationPrefix{Messages: uint32(messages), Digest: digest}, true
+}
+
+// continuedInputTokens returns the input tokens of req that are not charged, see
+// ContinuationConfig.InputDiscount.
+func continuedInputTokens(req *http.Request, config ContinuationConfig) float64 {
+	covered, err := strconv.ParseUint(req.Header.Get(continuationRequestHeader), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return float64(covered) * config.InputDiscount
+}
+
+// issueContinuations returns the continuation tokens of the tool calls of a completed response, they
+// cover its input and output tokens, the input of the follow-up repeats both.
+func (s *Worker) issueContinuations(req *http.Request, refundRecorder refundRecorder, requestedModel string) []string {
+	recorder, ok := refundRecorder.(toolCallRecorder)
+	if !ok || !s.config.continuationsEnabled() || refundRecorder.Aborted() != nil || refundRecorder.Migrated() ||
+		servedOtherModel(requestedModel, refundRecorder.Model()) {
+		return nil
+	}
+	prefix, ok := continuationPrefix(req)
+	if !ok {
+		return nil
+	}
+	toolCallIDs := recorder.ToolCalls()
+	if len(toolCallIDs) == 0 {
+		return nil
+	}
+	usage, err := refundRecorder.Usage()
+	if err != nil {
+		return nil
+	}
+
+	covered := uint32(min(max(usage.InputTokens+usage.OutputTokens, 0), math.MaxUint32))
+	expiry := time.Now().Add(s.config.Continuation.TTL)
+	return IssueContinuations(s.config.ContinuationKey, requestedModel, prefix, toolCallIDs, covered, expiry)
+}
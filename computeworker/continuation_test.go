@@ -0,0 +1,284 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeworker
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/nonceledger"
+	"github.com/openpcc/openpcc/auth/credentialing"
+	"github.com/stretchr/testify/require"
+)
+
+// conversationOf decodes a chat request body, the conversation of a follow-up.
+func conversationOf(t *testing.T, payload string) *OpenAIRequestBodyChat {
+	t.Helper()
+	body := &OpenAIRequestBodyChat{}
+	require.NoError(t, json.Unmarshal([]byte(payload), body))
+	return body
+}
+
+// prefixOf returns the conversation prefix of a chat request body, the request that issues tokens.
+func prefixOf(t *testing.T, payload string) ConversationPrefix {
+	t.Helper()
+	body := conversationOf(t, payload)
+	digest, ok := body.ConversationDigest(body.MessageCount())
+	require.True(t, ok)
+	return ConversationPrefix{Messages: uint32(body.MessageCount()), Digest: digest}
+}
+
+const (
+	continuationIssuer = `{"model":"llama3.2:1b","messages":[{"role":"user","content":"hi"}]}`
+	continuationBoth   = `{"model":"llama3.2:1b","messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"","tool_calls":[]},` +
+		`{"role":"tool","content":"1","tool_call_id":"call_1"},{"role":"tool","content":"2","tool_call_id":"call_2"}]}`
+	continuationFirst = `{"model":"llama3.2:1b","messages":[{"role":"user","content":"hi"},{"role":"tool","content":"1","tool_call_id":"call_1"}]}`
+	continuationOther = `{"model":"llama3.2:1b","messages":[{"role":"user","content":"bye"},{"role":"tool","content":"1","tool_call_id":"call_1"}]}`
+)
+
+func TestContinuationToken(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, ContinuationKeyLen)
+	now := time.Unix(1700000000, 0)
+	expiry := now.Add(time.Minute)
+	prefix := prefixOf(t, continuationIssuer)
+	both := conversationOf(t, continuationBoth)
+
+	t.Run("ok, input tokens are split over the tool calls", func(t *testing.T) {
+		tokens := IssueContinuations(key, "llama3.2:1b", prefix, []string{"call_1", "call_2", "call_3"}, 100, expiry)
+		require.Len(t, tokens, 3)
+
+		var total uint32
+		nonces := map[string]bool{}
+		for i, id := range []string{"call_1", "call_2", "call_3"} {
+			require.NoError(t, parseContinuationHeader(tokens[i]))
+			c, err := VerifyContinuation(key, "llama3.2:1b", id, both, tokens[i], now)
+			require.NoError(t, err)
+			require.Equal(t, expiry, c.Expiry)
+			require.Equal(t, uint32(1), c.Messages)
+			require.Len(t, c.Nonce, continuationNonceLen)
+			nonces[string(c.Nonce)] = true
+			total += c.InputTokens
+		}
+		require.Equal(t, uint32(100), total)
+		require.Len(t, nonces, 3)
+	})
+
+	t.Run("ok, no tokens without tool calls", func(t *testing.T) {
+		require.Nil(t, IssueContinuations(key, "llama3.2:1b", prefix, nil, 100, expiry))
+	})
+
+	t.Run("ok, tool calls beyond the max get no token", func(t *testing.T) {
+		ids := make([]string, maxContinuations+1)
+		for i := range ids {
+			ids[i] = "call_" + strings.Repeat("x", i)
+		}
+		require.Len(t, IssueContinuations(key, "llama3.2:1b", prefix, ids, 100, expiry), maxContinuations)
+	})
+
+	token := IssueContinuations(key, "llama3.2:1b", prefix, []string{"call_1"}, 100, expiry)[0]
+	failures := map[string]func() error{
+		"other key": func() error {
+			_, err := VerifyContinuation(bytes.Repeat([]byte{2}, ContinuationKeyLen), "llama3.2:1b", "call_1", both, token, now)
+			return err
+		},
+		"other model": func() error {
+			_, err := VerifyContinuation(key, "qwen3-8b", "call_1", both, token, now)
+			return err
+		},
+		"other tool call": func() error {
+			_, err := VerifyContinuation(key, "llama3.2:1b", "call_2", both, token, now)
+			return err
+		},
+		"other conversation": func() error {
+			_, err := VerifyContinuation(key, "llama3.2:1b", "call_1", conversationOf(t, continuationOther), token, now)
+			return err
+		},
+		"conversation shorter than the prefix": func() error {
+			_, err := VerifyContinuation(key, "llama3.2:1b", "call_1", &OpenAIRequestBodyChat{}, token, now)
+			return err
+		},
+		"expired": func() error {
+			_, err := VerifyContinuation(key, "llama3.2:1b", "call_1", both, token, expiry)
+			return err
+		},
+		"truncated": func() error {
+			_, err := VerifyContinuation(key, "llama3.2:1b", "call_1", both, token[:len(token)-2], now)
+			return err
+		},
+		"not base64": func() error {
+			_, err := VerifyContinuation(key, "llama3.2:1b", "call_1", both, "!"+token[1:], now)
+			return err
+		},
+	}
+	for name, verify := range failures {
+		t.Run("fail, "+name, func(t *testing.T) {
+			require.Error(t, verify())
+		})
+	}
+}
+
+func TestContinuationConfigValidate(t *testing.T) {
+	testCases := map[string]struct {
+		cfg     ContinuationConfig
+		wantErr bool
+	}{
+		"ok, disabled":              {cfg: ContinuationConfig{}},
+		"ok, full discount":         {cfg: ContinuationConfig{TTL: time.Minute, InputDiscount: 1}},
+		"ok, partial discount":      {cfg: ContinuationConfig{TTL: time.Minute, InputDiscount: 0.5}},
+		"fail, no discount":         {cfg: ContinuationConfig{TTL: time.Minute}, wantErr: true},
+		"fail, discount above one":  {cfg: ContinuationConfig{TTL: time.Minute, InputDiscount: 1.5}, wantErr: true},
+		"fail, negative ttl":        {cfg: ContinuationConfig{TTL: -time.Minute, InputDiscount: 1}, wantErr: true},
+		"fail, ttl above the limit": {cfg: ContinuationConfig{TTL: 2 * MaxContinuationTTL, InputDiscount: 1}, wantErr: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestBodyValidatorContinuation(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, ContinuationKeyLen)
+	badge := credentialing.Badge{Credentials: credentialing.Credentials{Models: defaultTestModels}}
+	prefix := prefixOf(t, continuationIssuer)
+	issue := func() []string {
+		return IssueContinuations(key, "llama3.2:1b", prefix, []string{"call_1", "call_2"}, 101, time.Now().Add(time.Minute))
+	}
+
+	nonceSocket := filepath.Join(t.TempDir(), "nonce_ledger.sock")
+	ledger := nonceledger.New(&nonceledger.Config{Socket: nonceSocket})
+	require.NoError(t, ledger.Start())
+	t.Cleanup(func() {
+		require.NoError(t, ledger.Close())
+	})
+
+	validate := func(t *testing.T, key []byte, header, payload string) *http.Request {
+		validator := BodyValidator{
+			MaxSize: 1024,
+			RouteBodyTypes: map[string]func() RequestBody{
+				OpenAIChatPath: func() RequestBody { return &OpenAIRequestBodyChat{} },
+			},
+			SupportedModels:         defaultTestModels,
+			ContinuationKey:         key,
+			ContinuationNonceSocket: nonceSocket,
+		}
+
+		req := httptest.NewRequest(http.MethodPost, OpenAIChatPath, strings.NewReader(payload))
+		req.ContentLength = int64(len(payload))
+		req.Header.Set(ContinuationHeader, header)
+		// a client can't pick the covered input tokens or the conversation prefix.
+		req.Header.Set(continuationRequestHeader, "1000")
+		req.Header.Set(continuationPrefixRequestHeader, "0 00")
+		require.NoError(t, validator.ValidateWithBadge(req, &badge))
+		return req
+	}
+	covered := func(t *testing.T, key []byte, header, payload string) string {
+		return validate(t, key, header, payload).Header.Get(continuationRequestHeader)
+	}
+
+	t.Run("ok, a follow-up that answers all tool calls is covered in full", func(t *testing.T) {
+		tokens := issue()
+		require.Equal(t, "101", covered(t, key, tokens[1]+", "+tokens[0], continuationBoth))
+	})
+
+	t.Run("ok, a follow-up that answers a tool call is covered by its share", func(t *testing.T) {
+		require.Equal(t, "51", covered(t, key, issue()[0], continuationFirst))
+	})
+
+	t.Run("ok, a token is not covered twice", func(t *testing.T) {
+		tokens := issue()
+		require.Equal(t, "51", covered(t, key, tokens[0]+","+tokens[0], continuationBoth))
+	})
+
+	t.Run("ok, a token is single use", func(t *testing.T) {
+		tokens := issue()
+		require.Equal(t, "51", covered(t, key, tokens[0], continuationFirst))
+		require.Empty(t, covered(t, key, tokens[0], continuationFirst))
+	})
+
+	t.Run("ok, tokens of other conversations are ignored", func(t *testing.T) {
+		require.Empty(t, covered(t, key, issue()[0], continuationOther))
+	})
+
+	t.Run("ok, tokens of unanswered tool calls are ignored", func(t *testing.T) {
+		require.Empty(t, covered(t, key, issue()[1], continuationFirst))
+	})
+
+	t.Run("ok, tokens are ignored without a key", func(t *testing.T) {
+		require.Empty(t, covered(t, nil, issue()[0], continuationFirst))
+	})
+
+	t.Run("ok, the conversation prefix is set for the tokens of the response", func(t *testing.T) {
+		req := validate(t, key, "", continuationIssuer)
+		got, ok := continuationPrefix(req)
+		require.True(t, ok)
+		require.Equal(t, prefix, got)
+	})
+}
+
+func TestRefundRecorderToolCalls(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name: "stream",
+			input: "data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"function\":{\"name\":\"a\"}}]}}]}\n\n" +
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"{}\"}}]}}]}\n\n" +
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":1,\"id\":\"call_2\",\"function\":{\"name\":\"b\"}}]}}]}\n\n" +
+				"data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"tool_calls\"}]}\n\n" +
+				"data: [DONE]\n\n",
+			want: []string{"call_1", "call_2"},
+		},
+		{
+			name:  "object",
+			input: `{"choices":[{"index":0,"message":{"role":"assistant","tool_calls":[{"id":"call_1","type":"function"}]},"finish_reason":"tool_calls"}]}`,
+			want:  []string{"call_1"},
+		},
+		{
+			name:  "other choices",
+			input: `{"choices":[{"index":1,"message":{"role":"assistant","tool_calls":[{"id":"call_1","type":"function"}]},"finish_reason":"tool_calls"}]}`,
+		},
+		{
+			name:  "not finished to call tools",
+			input: `{"choices":[{"index":0,"message":{"role":"assistant","tool_calls":[{"id":"call_1","type":"function"}]},"finish_reason":"length"}]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := newRefundRecorder(OpenAIChatPath, io.NopCloser(strings.NewReader(tc.input)), nil)
+			_, err := io.ReadAll(recorder)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, recorder.(toolCallRecorder).ToolCalls())
+		})
+	}
+}
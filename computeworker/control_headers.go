@@ -0,0 +1,210 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ControlHeaderVersionHeader is the version of the control header schema a client speaks. Requests
+// without it speak version 1, the schema before it was versioned.
+const ControlHeaderVersionHeader = "X-Confsec-Header-Version"
+
+// ControlExtensionsHeader negotiates optional control semantics. Clients list the extensions they
+// support, the worker responds with the ones it supports too. Unknown extensions are ignored, so
+// clients can offer extensions before every worker supports them.
+const ControlExtensionsHeader = "X-Confsec-Extensions"
+
+// controlHeaderPrefix is the prefix of control headers, request headers with this prefix must be in
+// the schema.
+const controlHeaderPrefix = "X-Confsec-"
+
+var (
+	extensionPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+	execPattern      = regexp.MustCompile(`^(noop|simulated|diagnostic-[a-z0-9-]+)$`)
+)
+
+// ControlHeader is the schema of a single control header.
+type ControlHeader struct {
+	// Since is the first schema version with the header.
+	Since int
+	// MaxSize bounds the length of the value, on top of the max header size of the validator.
+	MaxSize int
+	// Parse checks the value, nil accepts any value up to MaxSize.
+	Parse func(value string) error
+}
+
+// HeaderSchema is the registry of the X-Confsec-* control headers clients can send. Parsing is
+// strict: unknown control headers, repeated headers and values that don't parse are rejected.
+type HeaderSchema struct {
+	// Versions are the schema versions the worker speaks.
+	Versions []int
+	// Headers are the control headers by canonical name.
+	Headers map[string]ControlHeader
+	// Extensions are the extensions the worker supports, see ControlExtensionsHeader.
+	Extensions []string
+}
+
+// DefaultHeaderSchema returns the control header schema of this worker.
+func DefaultHeaderSchema() *HeaderSchema {
+	return &HeaderSchema{
+		Versions: []int{1},
+		Headers: map[string]ControlHeader{
+			ControlHeaderVersionHeader: {Since: 1, MaxSize: 8, Parse: parseHeaderVersion},
+			ControlExtensionsHeader:    {Since: 1, MaxSize: 256, Parse: parseExtensionsHeader},
+			"X-Confsec-Badge":          {Since: 1, MaxSize: 8192},
+			BadgeClaimsHeader:          {Since: 1, MaxSize: 1024, Parse: parseBase64Header},
+			"X-Confsec-Exec":           {Since: 1, MaxSize: 64, Parse: parseExecHeader},
+			SimulatedSeedHeader:        {Since: 1, MaxSize: 20, Parse: parseUintHeader},
+			SessionHintHeader:          {Since: 1, MaxSize: 2 * sessionHintLen, Parse: parseSessionHintHeader},
+			ContinuationHeader:         {Since: 1, MaxSize: maxContinuationHeaderSize, Parse: parseContinuationHeader},
+			PromptCacheSecretHeader:    {Since: 1, MaxSize: base64.StdEncoding.EncodedLen(promptCacheSecretMaxLen), Parse: parsePromptCacheSecretHeader},
+		},
+		Extensions: []string{
+			// error responses made up by the worker carry ErrorDetailHeader.
+			"error-detail",
+			// the output footer reports the model that served the response.
+			"footer-model",
+			// the output footer carries continuation tokens of tool calls, see ContinuationHeader.
+			"continuation",
+		},
+	}
+}
+
+// Validate checks the control headers of h against the schema.
+func (s *HeaderSchema) Validate(h http.Header) error {
+	version, err := s.version(h)
+	if err != nil {
+		return err
+	}
+
+	for name, values := range h {
+		if !strings.HasPrefix(name, controlHeaderPrefix) {
+			continue
+		}
+		schema, ok := s.Headers[name]
+		if !ok || schema.Since > version {
+			return newValidationError(ErrInvalidControlHeader, "unknown control header: "+name)
+		}
+		if len(values) != 1 {
+			return newValidationError(ErrInvalidControlHeader, "repeated control header: "+name)
+		}
+		if len(values[0]) > schema.MaxSize {
+			return newValidationError(ErrHeaderTooLarge, "control header exceeds max size: "+name)
+		}
+		if schema.Parse == nil {
+			continue
+		}
+		if err := schema.Parse(values[0]); err != nil {
+			return newValidationError(ErrInvalidControlHeader, "invalid control header "+name+": "+err.Error())
+		}
+	}
+	return nil
+}
+
+func (s *HeaderSchema) version(h http.Header) (int, error) {
+	value := h.Get(ControlHeaderVersionHeader)
+	if value == "" {
+		return 1, nil
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil || !slices.Contains(s.Versions, version) {
+		return 0, newValidationError(ErrUnsupportedHeaderVersion, "unsupported control header version: "+value)
+	}
+	return version, nil
+}
+
+// Negotiate sets the version and the accepted extensions on the response headers resp of a request
+// with the validated headers req. Responses to clients that don't negotiate are left as they are.
+func (s *HeaderSchema) Negotiate(req http.Header, resp http.Header) {
+	if req.Get(ControlHeaderVersionHeader) == "" && req.Get(ControlExtensionsHeader) == "" {
+		return
+	}
+
+	version, err := s.version(req)
+	if err != nil {
+		return
+	}
+	resp.Set(ControlHeaderVersionHeader, strconv.Itoa(version))
+
+	var accepted []string
+	for _, extension := range splitExtensions(req.Get(ControlExtensionsHeader)) {
+		if slices.Contains(s.Extensions, extension) && !slices.Contains(accepted, extension) {
+			accepted = append(accepted, extension)
+		}
+	}
+	if len(accepted) > 0 {
+		resp.Set(ControlExtensionsHeader, strings.Join(accepted, ","))
+	}
+}
+
+func splitExtensions(value string) []string {
+	if value == "" {
+		return nil
+	}
+	extensions := strings.Split(value, ",")
+	for i, extension := range extensions {
+		extensions[i] = strings.TrimSpace(extension)
+	}
+	return extensions
+}
+
+func parseHeaderVersion(value string) error {
+	// the supported versions are checked against the schema, this only checks the syntax.
+	_, err := strconv.ParseUint(value, 10, 16)
+	return err
+}
+
+func parseExtensionsHeader(value string) error {
+	for _, extension := range splitExtensions(value) {
+		if !extensionPattern.MatchString(extension) {
+			return errors.New("invalid extension")
+		}
+	}
+	return nil
+}
+
+func parseBase64Header(value string) error {
+	_, err := base64.StdEncoding.DecodeString(value)
+	return err
+}
+
+func parseExecHeader(value string) error {
+	if !execPattern.MatchString(value) {
+		return errors.New("unknown exec mode")
+	}
+	return nil
+}
+
+func parseUintHeader(value string) error {
+	_, err := strconv.ParseUint(value, 10, 64)
+	return err
+}
+
+func parseSessionHintHeader(value string) error {
+	if !ValidSessionHint(value) {
+		return errors.New("malformed session hint")
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderSchemaValidate(t *testing.T) {
+	hint := strings.Repeat("ab", sessionHintLen)
+
+	tests := map[string]struct {
+		header   http.Header
+		wantCode ValidationErrorCode
+	}{
+		"ok, unversioned": {
+			header: http.Header{"X-Confsec-Badge": {"badge"}, "X-Confsec-Exec": {"noop"}},
+		},
+		"ok, versioned with extensions": {
+			header: http.Header{
+				"X-Confsec-Badge":          {"badge"},
+				ControlHeaderVersionHeader: {"1"},
+				ControlExtensionsHeader:    {"error-detail, not-yet-supported"},
+				SessionHintHeader:          {hint},
+				SimulatedSeedHeader:        {"42"},
+				PromptCacheSecretHeader:    {base64.StdEncoding.EncodeToString(make([]byte, promptCacheSecretMinLen))},
+			},
+		},
+		"ok, diagnostic exec": {
+			header: http.Header{"X-Confsec-Exec": {"diagnostic-stream-extra-long"}},
+		},
+		"ok, other headers are not control headers": {
+			header: http.Header{"Content-Type": {"application/json"}, "X-Other": {"a", "b"}},
+		},
+		"fail, unsupported version": {
+			header:   http.Header{ControlHeaderVersionHeader: {"2"}},
+			wantCode: ErrUnsupportedHeaderVersion,
+		},
+		"fail, malformed version": {
+			header:   http.Header{ControlHeaderVersionHeader: {"v1"}},
+			wantCode: ErrUnsupportedHeaderVersion,
+		},
+		"fail, unknown control header": {
+			header:   http.Header{"X-Confsec-Internal-Session-Hint": {hint}},
+			wantCode: ErrInvalidControlHeader,
+		},
+		"fail, repeated control header": {
+			header:   http.Header{"X-Confsec-Badge": {"a", "b"}},
+			wantCode: ErrInvalidControlHeader,
+		},
+		"fail, control header too large": {
+			header:   http.Header{"X-Confsec-Exec": {"diagnostic-" + strings.Repeat("a", 64)}},
+			wantCode: ErrHeaderTooLarge,
+		},
+		"fail, unknown exec mode": {
+			header:   http.Header{"X-Confsec-Exec": {"shell"}},
+			wantCode: ErrInvalidControlHeader,
+		},
+		"fail, malformed seed": {
+			header:   http.Header{SimulatedSeedHeader: {"-1"}},
+			wantCode: ErrInvalidControlHeader,
+		},
+		"fail, malformed session hint": {
+			header:   http.Header{SessionHintHeader: {"hint"}},
+			wantCode: ErrInvalidControlHeader,
+		},
+		"fail, short prompt cache secret": {
+			header:   http.Header{PromptCacheSecretHeader: {base64.StdEncoding.EncodeToString([]byte("short"))}},
+			wantCode: ErrInvalidControlHeader,
+		},
+		"fail, malformed badge claims": {
+			header:   http.Header{BadgeClaimsHeader: {"!"}},
+			wantCode: ErrInvalidControlHeader,
+		},
+		"fail, malformed extension": {
+			header:   http.Header{ControlExtensionsHeader: {"error-detail,Bad Extension"}},
+			wantCode: ErrInvalidControlHeader,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := DefaultHeaderSchema().Validate(tc.header)
+			if tc.wantCode == ErrGeneric {
+				require.NoError(t, err)
+				return
+			}
+			var valErr ValidationError
+			require.True(t, errors.As(err, &valErr))
+			require.Equal(t, tc.wantCode, valErr.Code)
+		})
+	}
+}
+
+func TestHeaderSchemaNegotiate(t *testing.T) {
+	negotiate := func(req http.Header) http.Header {
+		resp := http.Header{}
+		DefaultHeaderSchema().Negotiate(req, resp)
+		return resp
+	}
+
+	t.Run("ok, clients that don't negotiate get no headers", func(t *testing.T) {
+		require.Empty(t, negotiate(http.Header{"X-Confsec-Badge": {"badge"}}))
+	})
+
+	t.Run("ok, supported extensions are accepted", func(t *testing.T) {
+		resp := negotiate(http.Header{ControlExtensionsHeader: {"not-yet-supported, footer-model,error-detail,footer-model"}})
+		require.Equal(t, "1", resp.Get(ControlHeaderVersionHeader))
+		require.Equal(t, "footer-model,error-detail", resp.Get(ControlExtensionsHeader))
+	})
+
+	t.Run("ok, version without supported extensions", func(t *testing.T) {
+		resp := negotiate(http.Header{ControlHeaderVersionHeader: {"1"}, ControlExtensionsHeader: {"not-yet-supported"}})
+		require.Equal(t, "1", resp.Get(ControlHeaderVersionHeader))
+		require.Empty(t, resp.Get(ControlExtensionsHeader))
+	})
+}
@@ -0,0 +1,173 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeworker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker/output"
+)
+
+// maxCrashFrames caps the frames of a crash report.
+const maxCrashFrames = 64
+
+// crashReportOutput is where crash reports are written to, routercom forwards the stderr of workers
+// like their logs.
+var crashReportOutput io.Writer = os.Stderr
+
+// PanicError is returned by Run when handling the request panicked. It doesn't carry the panic
+// value, which may contain request data.
+type PanicError struct {
+	// StackHash identifies where the worker panicked, see CrashReport.
+	StackHash string
+}
+
+func (e *PanicError) Error() string {
+	return "worker panicked at stack " + e.StackHash
+}
+
+// CrashReport is the redacted report of a worker panic. It tells where the worker panicked, but
+// not the panic value or the arguments of the frames, which may contain request data.
+type CrashReport struct {
+	// Time, Level and Msg make the report a JSON log record, so routercom forwards it like the
+	// worker logs instead of as truncated unstructured output.
+	Time  time.Time `json:"time"`
+	Level string    `json:"level"`
+	Msg   string    `json:"msg"`
+	// Crash is always "panic", it tells crash reports from other log records.
+	Crash string `json:"crash"`
+	// PanicType is the Go type of the panic value, e.g. runtime.boundsError.
+	PanicType string `json:"panic_type"`
+	// StackHash is the hex encoded SHA-256 digest of the frames, equal for panics at the same place.
+	StackHash string `json:"stack_hash"`
+	// Frames are the function and line of the frames of the panicking goroutine, innermost first.
+	Frames []string `json:"frames"`
+	// NodeRequestID is the ID routercom gave the request.
+	NodeRequestID string `json:"node_request_id,omitempty"`
+	// AbortFooter is true when the response was ended with an aborted footer.
+	AbortFooter bool `json:"abort_footer"`
+}
+
+// containPanic handles a panic recovered from Run. The response is ended with an aborted footer
+// when its output was started, so routercom can pass on the end of the response instead of
+// failing on a truncated one. The footer refunds the output that wasn't delivered, like the footer
+// of a response the backend aborted.
+func (s *Worker) containPanic(v any) error {
+	frames := panicFrames()
+	digest := sha256.Sum256([]byte(strings.Join(frames, "\n")))
+	report := CrashReport{
+		Time:          time.Now(),
+		Level:         slog.LevelError.String(),
+		Msg:           "Worker crash report",
+		Crash:         "panic",
+		PanicType:     fmt.Sprintf("%T", v),
+		StackHash:     hex.EncodeToString(digest[:]),
+		Frames:        frames,
+		NodeRequestID: s.config.RequestParams.NodeRequestID,
+	}
+
+	if s.encoder != nil {
+		err := closeAborted(s.encoder, s.abortFooter())
+		s.encoder, s.abortRefund = nil, nil
+		if err != nil {
+			slog.ErrorContext(s.ctx, "Failed to write aborted footer after panic", "error", err)
+		} else {
+			report.AbortFooter = true
+		}
+	}
+
+	if err := json.NewEncoder(crashReportOutput).Encode(report); err != nil {
+		slog.ErrorContext(s.ctx, "Failed to write crash report", "stack_hash", report.StackHash, "error", err)
+	}
+	return &PanicError{StackHash: report.StackHash}
+}
+
+// abortFooter returns the aborted footer of the output after a panic. The refund is left out when
+// it can't be determined, the state it's determined from may be why the worker panicked.
+func (s *Worker) abortFooter() (footer output.Footer) {
+	footer.Aborted = true
+	if s.abortRefund == nil {
+		return footer
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			slog.ErrorContext(s.ctx, "Refund panicked after panic, ending output without refund")
+			footer = output.Footer{Aborted: true}
+		}
+	}()
+
+	refund, creditAmount, err := s.abortRefund()
+	if errors.Is(err, errNoRefundAvailable) {
+		return footer
+	}
+	if err != nil {
+		slog.ErrorContext(s.ctx, "Failed to determine refund after panic", "error", err)
+		return footer
+	}
+	footer.Refund = &refund
+	footer.RefundSignature, err = s.refundSignature(s.ctx, creditAmount, refund, true)
+	if err != nil {
+		slog.ErrorContext(s.ctx, "Failed to sign refund after panic, sending it unsigned", "error", err)
+		footer.RefundUnsigned = true
+	}
+	return footer
+}
+
+// closeAborted ends the output with the aborted footer. The encoder may have been writing when the
+// worker panicked, so it may panic as well. The footer isn't written after a partial chunk, the
+// output is then truncated instead of corrupted.
+func closeAborted(encoder *output.Encoder, footer output.Footer) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = errors.New("output encoder panicked")
+		}
+	}()
+	return encoder.Close(footer)
+}
+
+// panicFrames returns the frames of the panicking goroutine as function and line, starting at
+// the frame that panicked. It must be called from the deferred function that recovered.
+func panicFrames() []string {
+	pcs := make([]uintptr, maxCrashFrames)
+	n := runtime.Callers(1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var all []string
+	start := 0
+	for {
+		frame, more := frames.Next()
+		if frame.Function == "runtime.gopanic" {
+			// the frames above are the recovery itself.
+			start = len(all) + 1
+		}
+		all = append(all, fmt.Sprintf("%s:%d", frame.Function, frame.Line))
+		if !more {
+			break
+		}
+	}
+	return all[start:]
+}
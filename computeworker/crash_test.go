@@ -0,0 +1,251 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeworker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker/output"
+	"github.com/openpcc/openpcc/anonpay/currency"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerContainPanic(t *testing.T) {
+	// run recovers a panic of fn like Run does.
+	run := func(w *Worker, fn func()) (err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				err = w.containPanic(v)
+			}
+		}()
+		fn()
+		return nil
+	}
+
+	// setReportOutput swaps the crash report output for the test, the report is written to the returned buffer.
+	setReportOutput := func(t *testing.T) *bytes.Buffer {
+		orig := crashReportOutput
+		t.Cleanup(func() {
+			crashReportOutput = orig
+		})
+		buf := &bytes.Buffer{}
+		crashReportOutput = buf
+		return buf
+	}
+
+	secret := "the prompt of the client"
+	newWorker := func() *Worker {
+		return &Worker{
+			ctx:    context.Background(),
+			config: &Config{RequestParams: RequestParams{NodeRequestID: "node-request"}},
+		}
+	}
+
+	t.Run("ok, output started", func(t *testing.T) {
+		reportBuf := setReportOutput(t)
+		out := &bytes.Buffer{}
+		w := newWorker()
+		var err error
+		w.encoder, err = output.NewEncoder(output.Header{MediaType: "message/ohttp-chunked-res"}, out)
+		require.NoError(t, err)
+		_, err = w.encoder.Write([]byte("partial"))
+		require.NoError(t, err)
+
+		err = run(w, func() {
+			panic(secret)
+		})
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+		require.Nil(t, w.encoder)
+
+		dec, err := output.NewDecoder(out)
+		require.NoError(t, err)
+		data := &bytes.Buffer{}
+		_, err = dec.WriteTo(data)
+		require.NoError(t, err)
+		require.Equal(t, "partial", data.String())
+		footer, ok := dec.Footer()
+		require.True(t, ok)
+		require.True(t, footer.Aborted)
+		require.Nil(t, footer.Refund)
+
+		require.NotContains(t, reportBuf.String(), secret)
+		var report CrashReport
+		require.NoError(t, json.Unmarshal(reportBuf.Bytes(), &report))
+		require.Equal(t, "ERROR", report.Level)
+		require.Equal(t, "panic", report.Crash)
+		require.Equal(t, "string", report.PanicType)
+		require.Equal(t, panicErr.StackHash, report.StackHash)
+		require.Equal(t, "node-request", report.NodeRequestID)
+		require.True(t, report.AbortFooter)
+		require.NotEmpty(t, report.Frames)
+		require.Contains(t, report.Frames[0], "TestWorkerContainPanic")
+	})
+
+	t.Run("ok, aborted footer refunds the undelivered output", func(t *testing.T) {
+		setReportOutput(t)
+		out := &bytes.Buffer{}
+		w := newWorker()
+		var err error
+		w.encoder, err = output.NewEncoder(output.Header{MediaType: "message/ohttp-chunked-res"}, out)
+		require.NoError(t, err)
+		refund, err := currency.Exact(40)
+		require.NoError(t, err)
+		w.abortRefund = func() (currency.Value, int64, error) {
+			return refund, 64, nil
+		}
+
+		err = run(w, func() {
+			panic(secret)
+		})
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+		require.Nil(t, w.abortRefund)
+
+		dec, err := output.NewDecoder(out)
+		require.NoError(t, err)
+		_, err = dec.WriteTo(io.Discard)
+		require.NoError(t, err)
+		footer, ok := dec.Footer()
+		require.True(t, ok)
+		require.True(t, footer.Aborted)
+		require.NotNil(t, footer.Refund)
+		amount, err := footer.Refund.Amount()
+		require.NoError(t, err)
+		require.Equal(t, int64(40), amount)
+	})
+
+	t.Run("ok, refund panics", func(t *testing.T) {
+		setReportOutput(t)
+		out := &bytes.Buffer{}
+		w := newWorker()
+		var err error
+		w.encoder, err = output.NewEncoder(output.Header{MediaType: "message/ohttp-chunked-res"}, out)
+		require.NoError(t, err)
+		w.abortRefund = func() (currency.Value, int64, error) {
+			panic(secret)
+		}
+
+		err = run(w, func() {
+			panic(secret)
+		})
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+
+		dec, err := output.NewDecoder(out)
+		require.NoError(t, err)
+		_, err = dec.WriteTo(io.Discard)
+		require.NoError(t, err)
+		footer, ok := dec.Footer()
+		require.True(t, ok)
+		require.True(t, footer.Aborted)
+		require.Nil(t, footer.Refund)
+	})
+
+	t.Run("ok, no footer after a partial chunk", func(t *testing.T) {
+		reportBuf := setReportOutput(t)
+		w := newWorker()
+		var err error
+		// the header chunk takes 3 writes, the data chunk panics after its prefix.
+		w.encoder, err = output.NewEncoder(output.Header{}, &panicWriter{n: 4})
+		require.NoError(t, err)
+
+		err = run(w, func() {
+			_, _ = w.encoder.Write([]byte("partial"))
+		})
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+
+		var report CrashReport
+		require.NoError(t, json.Unmarshal(reportBuf.Bytes(), &report))
+		require.False(t, report.AbortFooter)
+	})
+
+	t.Run("ok, output not started", func(t *testing.T) {
+		reportBuf := setReportOutput(t)
+		w := newWorker()
+
+		err := run(w, func() {
+			var values []string
+			_ = values[len(secret)]
+		})
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+
+		var report CrashReport
+		require.NoError(t, json.Unmarshal(reportBuf.Bytes(), &report))
+		require.Equal(t, "runtime.boundsError", report.PanicType)
+		require.False(t, report.AbortFooter)
+		// bounds checks panic from the runtime, on behalf of the function below.
+		require.True(t, strings.HasPrefix(report.Frames[0], "runtime."))
+	})
+
+	t.Run("ok, same stack hash for the same panic", func(t *testing.T) {
+		hashes := map[string]bool{}
+		for range 2 {
+			setReportOutput(t)
+			err := run(newWorker(), func() {
+				panic(secret)
+			})
+			var panicErr *PanicError
+			require.ErrorAs(t, err, &panicErr)
+			hashes[panicErr.StackHash] = true
+		}
+		require.Len(t, hashes, 1)
+	})
+
+	t.Run("ok, broken output", func(t *testing.T) {
+		reportBuf := setReportOutput(t)
+		pr, pw := io.Pipe()
+		go func() {
+			_, _ = io.Copy(io.Discard, pr)
+		}()
+		w := newWorker()
+		var err error
+		w.encoder, err = output.NewEncoder(output.Header{}, pw)
+		require.NoError(t, err)
+		require.NoError(t, pr.Close())
+
+		err = run(w, func() {
+			panic(secret)
+		})
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+
+		var report CrashReport
+		require.NoError(t, json.Unmarshal(reportBuf.Bytes(), &report))
+		require.False(t, report.AbortFooter)
+	})
+}
+
+// panicWriter panics on all writes after the first n.
+type panicWriter struct {
+	n int
+}
+
+func (w *panicWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		panic("write after the limit")
+	}
+	w.n--
+	return len(p), nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrEgressDenied is returned when the worker dials an address the egress policy denies.
+var ErrEgressDenied = errors.New("egress denied")
+
+// DefaultEgressDeny are the prefixes the worker never connects to, whatever the config. They cover
+// the instance metadata services of the clouds the node runs in, which hand out credentials and
+// identity tokens of the host.
+var DefaultEgressDeny = []netip.Prefix{
+	// link-local, includes the AWS, Azure IMDS and GCE metadata server at 169.254.169.254.
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("fe80::/10"),
+	// AWS IMDS over IPv6.
+	netip.MustParsePrefix("fd00:ec2::254/128"),
+	// Azure WireServer.
+	netip.MustParsePrefix("168.63.129.16/32"),
+	// Alibaba Cloud metadata service.
+	netip.MustParsePrefix("100.100.100.200/32"),
+}
+
+// ParseEgressDeny parses the prefixes of the egress_deny flags, single addresses deny just that address.
+func ParseEgressDeny(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(v)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid egress deny prefix %q: %w", v, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// PrivateEgress are the prefixes the worker may connect to when egress is private only: loopback, the
+// RFC 1918 ranges and IPv6 unique local addresses. DefaultEgressDeny still applies within them.
+var PrivateEgress = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("fc00::/7"),
+}
+
+// ParseBackendResolve parses the host=address pins of the backend_resolve flags. Pinned hosts are
+// dialed at their address without name resolution.
+func ParseBackendResolve(values []string) (map[string]netip.Addr, error) {
+	pins := make(map[string]netip.Addr, len(values))
+	for _, v := range values {
+		host, addr, ok := strings.Cut(v, "=")
+		if !ok || host == "" {
+			return nil, fmt.Errorf("invalid backend resolve %q, expected host=address", v)
+		}
+		ip, err := netip.ParseAddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backend resolve address %q: %w", addr, err)
+		}
+		pins[strings.ToLower(host)] = ip
+	}
+	return pins, nil
+}
+
+// egressPolicy denies the worker connections to DefaultEgressDeny and the configured prefixes. It
+// is enforced when the connection is made, after name resolution, so a hostname that resolves to
+// a metadata address is denied as well.
+type egressPolicy struct {
+	deny []netip.Prefix
+	// privateOnly only allows connections to PrivateEgress, so a misconfigured backend url can't send
+	// plaintext to the internet.
+	privateOnly bool
+	// pins are the addresses of hosts that are dialed without name resolution.
+	pins map[string]netip.Addr
+}
+
+func newEgressPolicy(deny []netip.Prefix) *egressPolicy {
+	return &egressPolicy{
+		deny: append(append([]netip.Prefix{}, DefaultEgressDeny...), deny...),
+	}
+}
+
+// allowed reports whether the worker may connect to addr.
+func (p *egressPolicy) allowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range p.deny {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	if !p.privateOnly {
+		return true
+	}
+	for _, prefix := range PrivateEgress {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// control is a net.Dialer Control func, it runs before every connect.
+func (p *egressPolicy) control(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: unexpected address %q", ErrEgressDenied, address)
+	}
+	if !p.allowed(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrEgressDenied, addrPort.Addr())
+	}
+	return nil
+}
+
+// dialContext dials like a net.Dialer with the given timeout, but denies the addresses of the policy.
+// Pinned hosts are dialed at their pinned address.
+func (p *egressPolicy) dialContext(timeout time.Duration) func(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: p.control,
+	}
+	if len(p.pins) == 0 {
+		return dialer.DialContext
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err == nil {
+			if pin, ok := p.pins[strings.ToLower(host)]; ok {
+				address = net.JoinHostPort(pin.String(), port)
+			}
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+}
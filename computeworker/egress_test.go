@@ -0,0 +1,166 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEgressPolicy(t *testing.T) {
+	extra, err := ParseEgressDeny([]string{"10.0.0.0/8", "192.168.1.10"})
+	require.NoError(t, err)
+	policy := newEgressPolicy(extra)
+
+	tests := map[string]struct {
+		addr string
+		want bool
+	}{
+		"ok, localhost":                   {addr: "127.0.0.1", want: true},
+		"ok, public address":              {addr: "203.0.113.7", want: true},
+		"ok, ipv6 localhost":              {addr: "::1", want: true},
+		"fail, imds":                      {addr: "169.254.169.254", want: false},
+		"fail, imds mapped to ipv6":       {addr: "::ffff:169.254.169.254", want: false},
+		"fail, aws imds over ipv6":        {addr: "fd00:ec2::254", want: false},
+		"fail, azure wireserver":          {addr: "168.63.129.16", want: false},
+		"fail, ipv6 link-local":           {addr: "fe80::1", want: false},
+		"fail, configured prefix":         {addr: "10.1.2.3", want: false},
+		"fail, configured single address": {addr: "192.168.1.10", want: false},
+		"ok, next to configured address":  {addr: "192.168.1.11", want: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.want, policy.allowed(netip.MustParseAddr(tc.addr)))
+		})
+	}
+}
+
+func TestEgressPolicyPrivateOnly(t *testing.T) {
+	policy := newEgressPolicy(nil)
+	policy.privateOnly = true
+
+	tests := map[string]struct {
+		addr string
+		want bool
+	}{
+		"ok, localhost":            {addr: "127.0.0.1", want: true},
+		"ok, ipv6 localhost":       {addr: "::1", want: true},
+		"ok, rfc 1918":             {addr: "10.1.2.3", want: true},
+		"ok, rfc 1918 172":         {addr: "172.31.0.5", want: true},
+		"ok, rfc 1918 192":         {addr: "192.168.1.10", want: true},
+		"ok, unique local":         {addr: "fd12:3456::1", want: true},
+		"ok, mapped rfc 1918":      {addr: "::ffff:10.1.2.3", want: true},
+		"fail, public address":     {addr: "203.0.113.7", want: false},
+		"fail, next to rfc 1918":   {addr: "172.32.0.1", want: false},
+		"fail, public ipv6":        {addr: "2001:db8::1", want: false},
+		"fail, aws imds over ipv6": {addr: "fd00:ec2::254", want: false},
+		"fail, imds":               {addr: "169.254.169.254", want: false},
+		"fail, cgnat alibaba imds": {addr: "100.100.100.200", want: false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.want, policy.allowed(netip.MustParseAddr(tc.addr)))
+		})
+	}
+}
+
+func TestParseBackendResolve(t *testing.T) {
+	pins, err := ParseBackendResolve([]string{"LLM.internal=10.0.0.5", "vllm=fd00::5"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]netip.Addr{
+		"llm.internal": netip.MustParseAddr("10.0.0.5"),
+		"vllm":         netip.MustParseAddr("fd00::5"),
+	}, pins)
+
+	for _, v := range []string{"llm.internal", "=10.0.0.5", "llm.internal=other.host"} {
+		_, err = ParseBackendResolve([]string{v})
+		require.Error(t, err, v)
+	}
+}
+
+func TestParseEgressDeny(t *testing.T) {
+	prefixes, err := ParseEgressDeny([]string{"10.1.2.3/8", "fd00::1"})
+	require.NoError(t, err)
+	require.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::1/128"),
+	}, prefixes)
+
+	_, err = ParseEgressDeny([]string{"metadata.google.internal"})
+	require.Error(t, err)
+}
+
+func TestEgressPolicyDial(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	newClient := func(deny []netip.Prefix) *http.Client {
+		return &http.Client{
+			Transport: &http.Transport{
+				DialContext: newEgressPolicy(deny).dialContext(time.Second),
+			},
+		}
+	}
+
+	t.Run("ok, allowed address", func(t *testing.T) {
+		resp, err := newClient(nil).Get(srv.URL)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	})
+
+	t.Run("fail, denied address is never connected to", func(t *testing.T) {
+		_, err := newClient([]netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}).Get(srv.URL)
+		require.ErrorIs(t, err, ErrEgressDenied)
+	})
+
+	t.Run("ok, pinned host is dialed at its address", func(t *testing.T) {
+		policy := newEgressPolicy(nil)
+		policy.privateOnly = true
+		policy.pins = map[string]netip.Addr{"llm.invalid": netip.MustParseAddr("127.0.0.1")}
+		client := &http.Client{Transport: &http.Transport{DialContext: policy.dialContext(time.Second)}}
+
+		_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+		require.NoError(t, err)
+		resp, err := client.Get("http://" + net.JoinHostPort("llm.invalid", port))
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	})
+
+	t.Run("fail, public address when private only", func(t *testing.T) {
+		policy := newEgressPolicy(nil)
+		policy.privateOnly = true
+		_, err := policy.dialContext(time.Second)(t.Context(), "tcp", net.JoinHostPort("203.0.113.7", "80"))
+		require.ErrorIs(t, err, ErrEgressDenied)
+	})
+
+	t.Run("fail, metadata address", func(t *testing.T) {
+		dial := newEgressPolicy(nil).dialContext(time.Second)
+		_, err := dial(t.Context(), "tcp", net.JoinHostPort("169.254.169.254", "80"))
+		require.ErrorIs(t, err, ErrEgressDenied)
+	})
+}
@@ -0,0 +1,100 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+)
+
+// ErrorDetailHeader marks a response the worker made up because it failed to handle the request.
+// The body is a ValidationErrorMessage that describes the failure, e.g. so client SDKs can tell a
+// timeout from an unavailable backend. Like any response it is encrypted to the client, router_com
+// only learns that a failure was reported from the output footer, see output.Footer.ErrorDetail.
+const ErrorDetailHeader = "X-Confsec-Error-Detail"
+
+// errorDetail describes a failure to the client. It classifies the failure but never includes
+// the error message, which may contain details of the node.
+type errorDetail struct {
+	statusCode int
+	code       string
+	message    string
+}
+
+func classifyError(err error) errorDetail {
+	var netErr net.Error
+	var valErr ValidationError
+	switch {
+	case errors.As(err, &valErr):
+		// validation errors describe the request of the client, not the node.
+		return errorDetail{
+			statusCode: validationErrorMessageCode(valErr),
+			code:       valErr.Code.String(),
+			message:    valErr.Message,
+		}
+	case errors.Is(err, context.DeadlineExceeded):
+		return errorDetail{
+			statusCode: http.StatusGatewayTimeout,
+			code:       "ErrBackendTimeout",
+			message:    "the llm did not respond in time",
+		}
+	case errors.Is(err, ErrEgressDenied), errors.As(err, &netErr):
+		return errorDetail{
+			statusCode: http.StatusBadGateway,
+			code:       "ErrBackendUnavailable",
+			message:    "the llm is unavailable",
+		}
+	default:
+		return errorDetail{
+			statusCode: http.StatusInternalServerError,
+			code:       "ErrServerError",
+			message:    "the node failed to handle the request",
+		}
+	}
+}
+
+// errorDetailResponse returns the response that reports the failure err to the client.
+func errorDetailResponse(err error) (*http.Response, error) {
+	detail := classifyError(err)
+	body, err := json.Marshal(ValidationErrorMessage{
+		Code:    detail.code,
+		Error:   http.StatusText(detail.statusCode),
+		Message: detail.message,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal error detail: %w", err)
+	}
+
+	resp := &http.Response{
+		StatusCode:    detail.statusCode,
+		Status:        http.StatusText(detail.statusCode),
+		Header:        http.Header{},
+		ContentLength: int64(len(body)),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+	}
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Set("X-Content-Type-Options", "nosniff")
+	resp.Header.Set(ErrorDetailHeader, detail.code)
+	return resp, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorDetailResponse(t *testing.T) {
+	tests := map[string]struct {
+		err        error
+		statusCode int
+		code       string
+	}{
+		"ok, backend timeout": {
+			err:        fmt.Errorf("request to the llm failed: %w", context.DeadlineExceeded),
+			statusCode: http.StatusGatewayTimeout,
+			code:       "ErrBackendTimeout",
+		},
+		"ok, backend unreachable": {
+			err:        fmt.Errorf("request to the llm failed: %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}),
+			statusCode: http.StatusBadGateway,
+			code:       "ErrBackendUnavailable",
+		},
+		"ok, egress denied": {
+			err:        fmt.Errorf("request to the llm failed: %w", ErrEgressDenied),
+			statusCode: http.StatusBadGateway,
+			code:       "ErrBackendUnavailable",
+		},
+		"ok, validation error": {
+			err:        fmt.Errorf("failed to handle request: %w", newValidationError(ErrInvalidControlHeader, "invalid control header")),
+			statusCode: http.StatusBadRequest,
+			code:       "ErrInvalidControlHeader",
+		},
+		"ok, other failure": {
+			err:        errors.New("failed to create LLM request: secret detail"),
+			statusCode: http.StatusInternalServerError,
+			code:       "ErrServerError",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			resp, err := errorDetailResponse(tc.err)
+			require.NoError(t, err)
+			require.Equal(t, tc.statusCode, resp.StatusCode)
+			require.Equal(t, tc.code, resp.Header.Get(ErrorDetailHeader))
+			require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.Equal(t, int64(len(body)), resp.ContentLength)
+
+			var msg ValidationErrorMessage
+			require.NoError(t, json.Unmarshal(body, &msg))
+			require.Equal(t, tc.code, msg.Code)
+			// the message of the error never reaches the client.
+			require.NotContains(t, string(body), "detail")
+		})
+	}
+}
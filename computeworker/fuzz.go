@@ -0,0 +1,312 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+var (
+	fuzzModels    = []string{"llama3.2:1b"}
+	fuzzValidator = DefaultValidator(make([]byte, ed25519.PublicKeySize), fuzzModels)
+)
+
+const (
+	// fuzzOutputTokenLimit is the output token limit applied to fuzzed request bodies.
+	fuzzOutputTokenLimit = 1024
+	// fuzzFormBoundary is the boundary of the multipart/form-data bodies fuzzed by
+	// FuzzOpenAITranscription.
+	fuzzFormBoundary = "fuzzboundary"
+)
+
+// FuzzNormalize is a go-fuzz target for the request normalization and validation that runs
+// on every decapsulated request. Build it with:
+//
+//	go-fuzz-build -func FuzzNormalize github.com/confidentsecurity/confidentcompute/computeworker
+//
+// data is a plain text HTTP request ("METHOD TARGET", header lines, an empty line and the
+// body). Unlike http.ReadRequest the header names are kept as is and lines starting with
+// a space or tab are kept as obs-fold continuations of the previous value, mirroring what
+// decapsulation can produce.
+//
+// FuzzNormalize panics when a normalized request breaks an invariant the validators rely on.
+func FuzzNormalize(data []byte) int {
+	req, ok := parseFuzzRequest(data)
+	if !ok {
+		return -1
+	}
+
+	if err := NormalizeRequest(req); err != nil {
+		return 0
+	}
+
+	for name, values := range req.Header {
+		if name != http.CanonicalHeaderKey(name) || !validHeaderName(name) {
+			panic(fmt.Sprintf("header name not normalized: %q", name))
+		}
+		for _, value := range values {
+			if strings.ContainsAny(value, "\r\n\x00") {
+				panic(fmt.Sprintf("header value not normalized: %q", value))
+			}
+		}
+	}
+	if len(req.Header.Values("Content-Length")) > 1 {
+		panic("duplicate content-length after normalization")
+	}
+
+	header := req.Header.Clone()
+	if err := NormalizeRequest(req); err != nil {
+		panic(fmt.Sprintf("normalization is not idempotent: %v", err))
+	}
+	if fmt.Sprint(header) != fmt.Sprint(req.Header) {
+		panic("normalization is not idempotent")
+	}
+
+	// the validators must never panic on a normalized request.
+	_ = fuzzValidator.Validate(req)
+
+	return 1
+}
+
+func parseFuzzRequest(data []byte) (*http.Request, bool) {
+	head, body, _ := bytes.Cut(data, []byte("\r\n\r\n"))
+	lines := strings.Split(string(head), "\r\n")
+
+	method, target, ok := strings.Cut(lines[0], " ")
+	if !ok {
+		return nil, false
+	}
+
+	req, err := http.NewRequest(method, "http://localhost"+target, bytes.NewReader(body))
+	if err != nil {
+		return nil, false
+	}
+	req.RequestURI = target
+	req.Header = http.Header{}
+
+	var last string
+	for _, line := range lines[1:] {
+		if last != "" && line != "" && (line[0] == ' ' || line[0] == '\t') {
+			values := req.Header[last]
+			values[len(values)-1] += "\r\n" + line
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, false
+		}
+		req.Header[name] = append(req.Header[name], strings.TrimLeft(value, " \t"))
+		last = name
+	}
+
+	return req, true
+}
+
+// FuzzOllamaGenerate is a go-fuzz target for the /api/generate request body, see fuzzRequestBody.
+func FuzzOllamaGenerate(data []byte) int {
+	return fuzzRequestBody(data, func() RequestBody { return &OllamaRequestBodyGenerate{} })
+}
+
+// FuzzOllamaChat is a go-fuzz target for the /api/chat request body, see fuzzRequestBody.
+func FuzzOllamaChat(data []byte) int {
+	return fuzzRequestBody(data, func() RequestBody { return &OllamaRequestBodyChat{} })
+}
+
+// FuzzOpenAICompletions is a go-fuzz target for the /v1/completions request body, see fuzzRequestBody.
+func FuzzOpenAICompletions(data []byte) int {
+	return fuzzRequestBody(data, func() RequestBody { return &OpenAIRequestBodyCompletions{} })
+}
+
+// FuzzOpenAIChat is a go-fuzz target for the /v1/chat/completions request body, see fuzzRequestBody.
+func FuzzOpenAIChat(data []byte) int {
+	return fuzzRequestBody(data, func() RequestBody { return &OpenAIRequestBodyChat{} })
+}
+
+// FuzzVLLMRerank is a go-fuzz target for the /v1/rerank request body, see fuzzRequestBody.
+func FuzzVLLMRerank(data []byte) int {
+	return fuzzRequestBody(data, func() RequestBody { return &VLLMRequestBodyRerank{} })
+}
+
+// FuzzOpenAIResponses is a go-fuzz target for the experimental responses request body, see
+// fuzzRequestBody.
+func FuzzOpenAIResponses(data []byte) int {
+	return fuzzRequestBody(data, func() RequestBody { return &OpenAIRequestBodyResponses{} })
+}
+
+// fuzzRequestBody decodes data into a request body the way BodyValidator does, validates it,
+// limits its output tokens and re-marshals it. It panics when the re-marshaled body no longer
+// validates, needs mutating again, changes the model or doesn't marshal to the same bytes.
+func fuzzRequestBody(data []byte, newBody func() RequestBody) int {
+	body, ok := decodeFuzzRequestBody(data, newBody)
+	if !ok {
+		return -1
+	}
+
+	model, _, err := body.Validate(fuzzModels)
+	if err != nil {
+		return 0
+	}
+	if limiter, ok := body.(OutputTokenLimiter); ok {
+		if _, err := limiter.LimitOutputTokens(fuzzOutputTokenLimit); err != nil {
+			return 0
+		}
+	}
+
+	out, err := json.Marshal(body)
+	if err != nil {
+		panic(fmt.Sprintf("validated body does not marshal: %v", err))
+	}
+
+	again, ok := decodeFuzzRequestBody(out, newBody)
+	if !ok {
+		panic(fmt.Sprintf("re-marshaled body does not decode: %s", out))
+	}
+	gotModel, dirty, err := again.Validate(fuzzModels)
+	if err != nil {
+		panic(fmt.Sprintf("re-marshaled body does not validate: %v", err))
+	}
+	if gotModel != model {
+		panic(fmt.Sprintf("model changed from %q to %q", model, gotModel))
+	}
+	if limiter, ok := again.(OutputTokenLimiter); ok {
+		clamped, err := limiter.LimitOutputTokens(fuzzOutputTokenLimit)
+		if err != nil {
+			panic(fmt.Sprintf("re-marshaled body fails output token limit: %v", err))
+		}
+		dirty = dirty || clamped
+	}
+	if dirty {
+		panic(fmt.Sprintf("re-marshaled body was mutated again: %s", out))
+	}
+
+	outAgain, err := json.Marshal(again)
+	if err != nil {
+		panic(fmt.Sprintf("re-marshaled body does not marshal: %v", err))
+	}
+	if !bytes.Equal(out, outAgain) {
+		panic(fmt.Sprintf("marshaling is not stable: %s != %s", out, outAgain))
+	}
+
+	return 1
+}
+
+func decodeFuzzRequestBody(data []byte, newBody func() RequestBody) (RequestBody, bool) {
+	body := newBody()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&body); err != nil || body == nil {
+		return nil, false
+	}
+	return body, true
+}
+
+// FuzzOpenAITranscription is a go-fuzz target for the /v1/audio/transcriptions request body. data is
+// a multipart/form-data body with the boundary fuzzFormBoundary.
+//
+// The body is decoded into parts the way BodyValidator does, validated and re-encoded. It panics
+// when the re-encoded body no longer decodes or validates, changes the model or doesn't encode to
+// the same bytes.
+func FuzzOpenAITranscription(data []byte) int {
+	body, ok := decodeFuzzForm(data, fuzzFormBoundary)
+	if !ok {
+		return -1
+	}
+
+	model, _, err := body.Validate(fuzzModels)
+	if err != nil {
+		return 0
+	}
+	// BodyValidator re-encodes with a random boundary, parts can't contain it like the fixed one.
+	for _, value := range []string{string(body.File), body.Model, body.Language, body.Prompt, body.ResponseFormat, body.Temperature} {
+		if strings.Contains(value, fuzzFormBoundary) {
+			return 0
+		}
+	}
+
+	out, err := encodeFuzzForm(body)
+	if err != nil {
+		panic(fmt.Sprintf("validated body does not encode: %v", err))
+	}
+
+	again, ok := decodeFuzzForm(out, fuzzFormBoundary)
+	if !ok {
+		panic(fmt.Sprintf("re-encoded body does not decode: %q", out))
+	}
+	gotModel, _, err := again.Validate(fuzzModels)
+	if err != nil {
+		panic(fmt.Sprintf("re-encoded body does not validate: %v", err))
+	}
+	if gotModel != model {
+		panic(fmt.Sprintf("model changed from %q to %q", model, gotModel))
+	}
+
+	outAgain, err := encodeFuzzForm(again)
+	if err != nil {
+		panic(fmt.Sprintf("re-encoded body does not encode: %v", err))
+	}
+	if !bytes.Equal(out, outAgain) {
+		panic(fmt.Sprintf("encoding is not stable: %q != %q", out, outAgain))
+	}
+
+	return 1
+}
+
+func decodeFuzzForm(data []byte, boundary string) (*OpenAIRequestBodyTranscription, bool) {
+	body := &OpenAIRequestBodyTranscription{}
+	reader := multipart.NewReader(bytes.NewReader(data), boundary)
+	for {
+		part, err := reader.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			return body, true
+		}
+		if err != nil {
+			return nil, false
+		}
+		partData, err := io.ReadAll(part)
+		if err != nil {
+			return nil, false
+		}
+		if err := body.SetFormPart(part.FormName(), part.FileName() != "", partData); err != nil {
+			return nil, false
+		}
+	}
+}
+
+func encodeFuzzForm(body FormRequestBody) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	if err := writer.SetBoundary(fuzzFormBoundary); err != nil {
+		return nil, err
+	}
+	if err := body.EncodeForm(writer); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -20,19 +20,28 @@ package computeworker
 import (
 	"bytes"
 	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
+	"mime/multipart"
 	"net/http"
-	"path"
-	"path/filepath"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/openpcc/openpcc/auth/credentialing"
 	"github.com/openpcc/openpcc/messages"
+	"github.com/openpcc/openpcc/models"
 	"github.com/openpcc/openpcc/otel/otelutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ValidationErrorCode int
@@ -64,6 +73,26 @@ const (
 	ErrContentTypeNotAllowed
 	ErrBadgeInvalid
 	ErrUnsupportedModel
+	// Normalization errors
+	ErrDuplicateContentLength
+	ErrMalformedHeader
+	// Structured output errors
+	ErrInvalidFormat
+	// Credit errors
+	ErrInsufficientCredits
+	// Hardened JSON decoding errors
+	ErrJSONLimitExceeded
+	// Multipart form errors
+	ErrInvalidForm
+	// Tool and function schema errors
+	ErrInvalidTools
+	// Badge limit errors
+	ErrTooManyParallelRequests
+	// Control header schema errors
+	ErrInvalidControlHeader
+	ErrUnsupportedHeaderVersion
+	// Chat message errors
+	ErrInvalidMessages
 )
 
 func (c ValidationErrorCode) String() string {
@@ -106,6 +135,28 @@ func (c ValidationErrorCode) String() string {
 		return "ErrBadgeInvalid"
 	case ErrUnsupportedModel:
 		return "ErrUnsupportedModel"
+	case ErrDuplicateContentLength:
+		return "ErrDuplicateContentLength"
+	case ErrMalformedHeader:
+		return "ErrMalformedHeader"
+	case ErrInvalidFormat:
+		return "ErrInvalidFormat"
+	case ErrInsufficientCredits:
+		return "ErrInsufficientCredits"
+	case ErrJSONLimitExceeded:
+		return "ErrJSONLimitExceeded"
+	case ErrInvalidForm:
+		return "ErrInvalidForm"
+	case ErrInvalidTools:
+		return "ErrInvalidTools"
+	case ErrTooManyParallelRequests:
+		return "ErrTooManyParallelRequests"
+	case ErrInvalidControlHeader:
+		return "ErrInvalidControlHeader"
+	case ErrUnsupportedHeaderVersion:
+		return "ErrUnsupportedHeaderVersion"
+	case ErrInvalidMessages:
+		return "ErrInvalidMessages"
 	default:
 		return "Unknown"
 	}
@@ -132,6 +183,11 @@ const (
 	OllamaChatPath        = "/api/chat"
 	OpenAICompletionsPath = "/v1/completions"
 	OpenAIChatPath        = "/v1/chat/completions"
+	VLLMRerankPath        = "/v1/rerank"
+	// VLLMRerankAliasPath is the unversioned alias of VLLMRerankPath served by vLLM.
+	VLLMRerankAliasPath = "/rerank"
+	// OpenAITranscriptionsPath takes a multipart/form-data body instead of JSON.
+	OpenAITranscriptionsPath = "/v1/audio/transcriptions"
 )
 
 type Validator interface {
@@ -147,21 +203,110 @@ type PostAuthValidator interface {
 // The RequestAuthorizer is responsible for validating the badge in the request header
 type RequestAuthorizer struct {
 	BadgePublicKey ed25519.PublicKey
+	// BannedKeyIDs are badge key IDs that are no longer accepted, see BadgeKeyID.
+	BannedKeyIDs []string
+}
+
+// ValidationLimits are the size limits enforced on requests.
+type ValidationLimits struct {
+	MaxHeaderSize int
+	MaxBodySize   int
+	// MaxAudioSize is the max size of multipart/form-data request bodies, which carry audio.
+	MaxAudioSize int
+}
+
+func DefaultValidationLimits() ValidationLimits {
+	return ValidationLimits{
+		MaxHeaderSize: 1024,
+		MaxBodySize:   1 * 1024 * 1024,
+		// same as the upload limit of the OpenAI audio API.
+		MaxAudioSize: 25 * 1024 * 1024,
+	}
+}
+
+// BadgeKeyID identifies a badge by the hex encoded SHA-256 digest of its signature, the digest the
+// badge limiter sees, see BadgeHash. Every badge the auth server issues has its own key ID, so a
+// single badge can be banned.
+func BadgeKeyID(badgeSignature []byte) string {
+	return hex.EncodeToString(BadgeHash(badgeSignature))
+}
+
+// ValidatorOptions configures the request validator.
+type ValidatorOptions struct {
+	Limits ValidationLimits
+	// BannedBadgeKeyIDs are badge key IDs that are no longer accepted, see BadgeKeyID.
+	BannedBadgeKeyIDs []string
+	// AuditBodyRules are body rules in audit mode, violations are logged but the request is allowed.
+	AuditBodyRules []BodyRule
+	// AllowedHostnames are the hostnames clients may address requests to besides the unroutable
+	// hostname, see HostnameValidator.
+	AllowedHostnames []string
+	// CreditAmount is the credit amount of the request, the output tokens of the request are
+	// clamped to what it can pay for. Zero disables clamping.
+	CreditAmount int64
+	// HardenedJSON checks request bodies against DefaultJSONLimits before they are decoded.
+	HardenedJSON bool
+	// PromptCacheKey derives the prefix cache salts of requests, see PromptCacheHandle. Nil disables
+	// prefix cache salting.
+	PromptCacheKey []byte
+	// SessionHintKey derives the session hints of requests, see SessionHint. Nil disables session hints.
+	SessionHintKey []byte
+	// ContinuationKey verifies the continuation tokens of requests, see ContinuationConfig. Nil
+	// disables continuations.
+	ContinuationKey []byte
+	// ContinuationNonceSocket is the nonce ledger the continuation tokens of requests are claimed
+	// with, see ContinuationConfig.
+	ContinuationNonceSocket string
+	// BodyMutations are the optional mutations of request bodies, see ParseBodyMutator.
+	BodyMutations BodyMutations
+	// ExperimentalRoutes are the experimental routes that are served, see experimental.CheckBuild.
+	ExperimentalRoutes []string
 }
 
 func DefaultValidator(badgePublicKey []byte, models []string) Validator {
+	return NewValidator(badgePublicKey, models, ValidatorOptions{Limits: DefaultValidationLimits()})
+}
+
+// NewValidator creates the request validator with the given options.
+func NewValidator(badgePublicKey []byte, models []string, opts ValidatorOptions) Validator {
+	var jsonLimits *JSONLimits
+	if opts.HardenedJSON {
+		jsonLimits = DefaultJSONLimits()
+	}
+
+	allowed := map[string][]string{
+		OllamaGeneratePath:    {"POST"}, // Used by the local demo.
+		OllamaChatPath:        {"POST"}, // Used by the WASM demo.
+		OpenAICompletionsPath: {"POST"}, // Used by the SDKs
+		OpenAIChatPath:        {"POST"}, // Used by the SDKs
+		VLLMRerankPath:        {"POST"}, // Used by RAG pipelines
+		VLLMRerankAliasPath:   {"POST"},
+		// Used for confidential speech-to-text.
+		OpenAITranscriptionsPath: {"POST"},
+	}
+	bodyTypes := map[string]func() RequestBody{
+		OllamaGeneratePath:    func() RequestBody { return &OllamaRequestBodyGenerate{} },
+		OllamaChatPath:        func() RequestBody { return &OllamaRequestBodyChat{} },
+		OpenAICompletionsPath: func() RequestBody { return &OpenAIRequestBodyCompletions{} },
+		OpenAIChatPath:        func() RequestBody { return &OpenAIRequestBodyChat{} },
+		VLLMRerankPath:        func() RequestBody { return &VLLMRequestBodyRerank{} },
+		VLLMRerankAliasPath:   func() RequestBody { return &VLLMRequestBodyRerank{} },
+	}
+	// experimental routes are only served when they are disclosed in the evidence.
+	for _, route := range opts.ExperimentalRoutes {
+		allowed[route] = []string{"POST"}
+		bodyTypes[route] = experimentalBodyTypes[route]
+	}
+
 	return RequestValidator{
 		preAuthValidators: []Validator{
 			EndpointValidator{
-				Allowed: map[string][]string{
-					OllamaGeneratePath:    {"POST"}, // Used by the local demo.
-					OllamaChatPath:        {"POST"}, // Used by the WASM demo.
-					OpenAICompletionsPath: {"POST"}, // Used by the SDKs
-					OpenAIChatPath:        {"POST"}, // Used by the SDKs
-				},
+				Allowed: allowed,
 			},
 			HeaderValidator{
-				MaxHeaderSize: 1024,
+				MaxHeaderSize: opts.Limits.MaxHeaderSize,
+				FormPaths:     []string{OpenAITranscriptionsPath},
+				Schema:        DefaultHeaderSchema(),
 				Blocked: []string{
 					// * "Transfer-Encoding=chunked" - not needed and not supported for client requests.
 					//   A hole for request smuggling and other exploits related to body size ambiguities.
@@ -173,21 +318,31 @@ func DefaultValidator(badgePublicKey []byte, models []string) Validator {
 					"Content-Encoding",
 				},
 			},
-			HostnameValidator{},
+			HostnameValidator{
+				Allowed: opts.AllowedHostnames,
+			},
 		},
 		requestAuthorizer: RequestAuthorizer{
 			BadgePublicKey: badgePublicKey,
+			BannedKeyIDs:   opts.BannedBadgeKeyIDs,
 		},
 		postAuthValidators: []PostAuthValidator{
 			BodyValidator{
-				MaxSize: 1 * 1024 * 1024,
-				RouteBodyTypes: map[string]func() RequestBody{
-					OllamaGeneratePath:    func() RequestBody { return &OllamaRequestBodyGenerate{} },
-					OllamaChatPath:        func() RequestBody { return &OllamaRequestBodyChat{} },
-					OpenAICompletionsPath: func() RequestBody { return &OpenAIRequestBodyCompletions{} },
-					OpenAIChatPath:        func() RequestBody { return &OpenAIRequestBodyChat{} },
+				MaxSize:        opts.Limits.MaxBodySize,
+				RouteBodyTypes: bodyTypes,
+				MaxFormSize:    opts.Limits.MaxAudioSize,
+				FormBodyTypes: map[string]func() FormRequestBody{
+					OpenAITranscriptionsPath: func() FormRequestBody { return &OpenAIRequestBodyTranscription{} },
 				},
-				SupportedModels: models,
+				SupportedModels:         models,
+				Audit:                   opts.AuditBodyRules,
+				CreditAmount:            opts.CreditAmount,
+				JSONLimits:              jsonLimits,
+				PromptCacheKey:          opts.PromptCacheKey,
+				SessionHintKey:          opts.SessionHintKey,
+				ContinuationKey:         opts.ContinuationKey,
+				ContinuationNonceSocket: opts.ContinuationNonceSocket,
+				Mutations:               opts.BodyMutations,
 			},
 		},
 	}
@@ -262,6 +417,11 @@ func (a *RequestAuthorizer) Authorize(r *http.Request) (credentialing.Badge, err
 		return credentialing.Badge{}, newValidationError(ErrBadgeInvalid, "invalid signature")
 	}
 
+	// the ban is checked once the signature verifies, so a badge can't be made to look banned.
+	if slices.Contains(a.BannedKeyIDs, BadgeKeyID(badge.Signature)) {
+		return credentialing.Badge{}, newValidationError(ErrBadgeInvalid, "badge is banned")
+	}
+
 	return badge, nil
 }
 
@@ -287,8 +447,10 @@ func (v EndpointValidator) Validate(r *http.Request) error {
 	// is aligned with the best SEO practices like content de-duplication.
 	//
 	// In our case, we don't care about SEO optimization but we want to be as conservative as possible, and
-	// leak the minimum of information, so any suspicious path is simply rejected.
-	if r.RequestURI != filepath.FromSlash(path.Clean("/"+strings.Trim(r.URL.Path, "/"))) {
+	// leak the minimum of information, so any suspicious path is simply rejected. The request URI must
+	// be canonical, see CanonicalURLPath, and equal to the decoded path, so no percent-encodings are left.
+	canonical, err := CanonicalURLPath(r.RequestURI)
+	if err != nil || r.RequestURI != canonical || r.URL.Path != canonical {
 		return newValidationError(ErrInvalidRequestURI, "suspicious path: "+r.RequestURI)
 	}
 
@@ -305,9 +467,13 @@ func (v EndpointValidator) Validate(r *http.Request) error {
 }
 
 type HeaderValidator struct {
-	MaxHeaderSize  int
-	Blocked        []string
+	MaxHeaderSize int
+	Blocked       []string
+	// FormPaths are the paths that take a multipart/form-data body instead of JSON.
+	FormPaths      []string
 	BadgePublicKey ed25519.PublicKey
+	// Schema checks the X-Confsec-* control headers. Nil only requires the badge.
+	Schema *HeaderSchema
 }
 
 func (v HeaderValidator) Validate(r *http.Request) error {
@@ -325,9 +491,8 @@ func (v HeaderValidator) Validate(r *http.Request) error {
 		return newValidationError(ErrTransferEncodingNotAllowed, "transfer-encoding=chunked not allowed")
 	}
 
-	contentType := r.Header.Get("Content-Type")
-	if contentType != "application/json" {
-		return newValidationError(ErrContentTypeNotAllowed, "Content-Type header must be set to application/json")
+	if err := v.validateContentType(r); err != nil {
+		return err
 	}
 
 	for header, values := range r.Header {
@@ -344,6 +509,12 @@ func (v HeaderValidator) Validate(r *http.Request) error {
 		}
 	}
 
+	if v.Schema != nil {
+		if err := v.Schema.Validate(r.Header); err != nil {
+			return err
+		}
+	}
+
 	serializedBadge := r.Header.Get("X-Confsec-Badge")
 	if serializedBadge == "" {
 		return newValidationError(ErrBadgeInvalid, "badge is not provided")
@@ -352,10 +523,132 @@ func (v HeaderValidator) Validate(r *http.Request) error {
 	return nil
 }
 
+// validateContentType requires JSON bodies, except for FormPaths which require a multipart/form-data
+// body with a boundary.
+func (v HeaderValidator) validateContentType(r *http.Request) error {
+	contentType := r.Header.Get("Content-Type")
+	if !slices.Contains(v.FormPaths, r.URL.Path) {
+		if contentType != "application/json" {
+			return newValidationError(ErrContentTypeNotAllowed, "Content-Type header must be set to application/json")
+		}
+		return nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return newValidationError(ErrContentTypeNotAllowed, "Content-Type header must be set to multipart/form-data with a boundary")
+	}
+	return nil
+}
+
 type BodyValidator struct {
 	MaxSize         int
 	RouteBodyTypes  map[string]func() RequestBody
 	SupportedModels []string
+	// Audit are the rules in audit mode. Violations of these rules are logged, without any request
+	// content, but the request is allowed. Used to safely roll out stricter rules.
+	Audit []BodyRule
+	// CreditAmount is the credit amount of the request. The output tokens of request bodies that
+	// implement OutputTokenLimiter are clamped to MaxOutputTokens(CreditAmount). Zero disables clamping.
+	CreditAmount int64
+	// JSONLimits are checked while the body is tokenized, before it is decoded. Nil only relies on
+	// the route-specific checks after decoding.
+	JSONLimits *JSONLimits
+	// PromptCacheKey derives the prefix cache salt of request bodies that implement PromptCacheSalter.
+	// Nil removes any salt set by the client.
+	PromptCacheKey []byte
+	// SessionHintKey derives the session hint of request bodies that are a turn of a conversation.
+	// Nil disables session hints.
+	SessionHintKey []byte
+	// ContinuationKey verifies the continuation tokens of requests that answer tool calls. Nil
+	// disables continuations.
+	ContinuationKey []byte
+	// ContinuationNonceSocket is the nonce ledger that makes continuation tokens single use.
+	ContinuationNonceSocket string
+	// FormBodyTypes are the routes that take a multipart/form-data body instead of JSON.
+	FormBodyTypes map[string]func() FormRequestBody
+	// MaxFormSize is the max size of multipart/form-data bodies, MaxSize applies to JSON bodies.
+	MaxFormSize int
+	// Mutations change the validated JSON bodies, they run after RequiredBodyMutations.
+	Mutations BodyMutations
+}
+
+// MaxOutputTokens returns the number of output tokens creditAmount pays for. Input tokens are
+// not known before inference, so the actual number of output tokens the credits pay for is lower.
+func MaxOutputTokens(creditAmount int64) int {
+	return int(creditAmount / models.OutputTokenCreditMultiplier)
+}
+
+// BodyRule identifies a BodyValidator rule that can be put in audit mode.
+type BodyRule string
+
+const (
+	// BodyRuleUnknownFields rejects request bodies with fields that are not part of the schema.
+	BodyRuleUnknownFields BodyRule = "unknown_fields"
+	// BodyRuleMultipleJSONObjects rejects request bodies with more than one JSON object.
+	BodyRuleMultipleJSONObjects BodyRule = "multiple_json_objects"
+	// BodyRuleJSONLimits rejects request bodies that exceed BodyValidator.JSONLimits.
+	BodyRuleJSONLimits BodyRule = "json_limits"
+	// BodyRuleOllamaFormat rejects Ollama chat requests with an invalid format schema.
+	BodyRuleOllamaFormat BodyRule = "ollama_format"
+	// BodyRuleTools rejects chat requests with invalid tool or function schemas.
+	BodyRuleTools BodyRule = "tools"
+	// BodyRuleMessages rejects chat requests with too many or too large messages, or unknown roles.
+	BodyRuleMessages BodyRule = "messages"
+)
+
+// bodyRules are the body rules that can be put in audit mode.
+var bodyRules = []BodyRule{
+	BodyRuleUnknownFields,
+	BodyRuleMultipleJSONObjects,
+	BodyRuleJSONLimits,
+	BodyRuleOllamaFormat,
+	BodyRuleTools,
+	BodyRuleMessages,
+}
+
+// ParseBodyRule parses the name of a body rule that can be put in audit mode.
+func ParseBodyRule(s string) (BodyRule, error) {
+	rule := BodyRule(s)
+	if !slices.Contains(bodyRules, rule) {
+		return "", fmt.Errorf("unknown body rule: %s", s)
+	}
+	return rule, nil
+}
+
+// BodyRuleChecker is implemented by request bodies with checks that can be put in audit mode. The
+// checks run after Validate.
+type BodyRuleChecker interface {
+	// BodyRuleChecks returns the checks of the body, in the order they run.
+	BodyRuleChecks() []BodyRuleCheck
+}
+
+// BodyRuleCheck is a check of a request body that is enforced unless its rule is in audit mode.
+type BodyRuleCheck struct {
+	Rule  BodyRule
+	Check func() error
+}
+
+// meterName is the instrumentation scope of the compute_worker metrics.
+const meterName = "github.com/confidentsecurity/confidentcompute/computeworker"
+
+// auditedBodyRules counts the requests that violated a body rule in audit mode, by rule.
+var auditedBodyRules, _ = otel.Meter(meterName).Int64Counter("computeworker.validation.audited",
+	metric.WithDescription("Requests that violated a body rule in audit mode and were allowed"),
+)
+
+// enforced reports whether rule is enforced. If the rule is in audit mode, the violation is logged,
+// counted and recorded on the span of the request.
+func (v BodyValidator) enforced(r *http.Request, rule BodyRule) bool {
+	if !slices.Contains(v.Audit, rule) {
+		return true
+	}
+
+	slog.WarnContext(r.Context(), "request violates a body rule in audit mode, allowing request", "rule", rule)
+	attrs := []attribute.KeyValue{attribute.String("rule", string(rule))}
+	auditedBodyRules.Add(r.Context(), 1, metric.WithAttributes(attrs...))
+	trace.SpanFromContext(r.Context()).AddEvent("validation.audit", trace.WithAttributes(attrs...))
+	return false
 }
 
 type RequestBody interface {
@@ -364,6 +657,57 @@ type RequestBody interface {
 	Validate(supportedModels []string) (string, bool, error)
 }
 
+// FormRequestBody is implemented by request bodies sent as multipart/form-data instead of JSON.
+type FormRequestBody interface {
+	RequestBody
+	// SetFormPart sets the part called name, isFile is true for file uploads. Parts that are not
+	// part of the schema are rejected.
+	SetFormPart(name string, isFile bool, data []byte) error
+	// EncodeForm writes the validated parts to w.
+	EncodeForm(w *multipart.Writer) error
+}
+
+// OutputTokenLimiter is implemented by request bodies that generate output tokens.
+type OutputTokenLimiter interface {
+	// LimitOutputTokens clamps the output tokens of the request to limit, returning whether
+	// the request body was mutated. Requests without an output token limit get limit.
+	LimitOutputTokens(limit int) (bool, error)
+}
+
+// clampOutputTokens clamps the requested number of output tokens to limit. A requested
+// number <= 0 means unlimited to the backends.
+func clampOutputTokens(requested, limit int) int {
+	if requested <= 0 || requested > limit {
+		return limit
+	}
+	return requested
+}
+
+// perChoiceOutputTokens splits limit over the choices generated for a request.
+func perChoiceOutputTokens(limit int, choices ...int) (int, error) {
+	n := max(1, slices.Max(choices))
+	perChoice := limit / n
+	if perChoice < 1 {
+		return 0, newValidationError(ErrInsufficientCredits, fmt.Sprintf("insufficient credits for %d choices", n))
+	}
+	return perChoice, nil
+}
+
+// limitOllamaNumPredict clamps the num_predict option of an Ollama request.
+func limitOllamaNumPredict(options map[string]any, limit int) (map[string]any, bool) {
+	// options are decoded as JSON, so numbers are float64. Anything else is replaced.
+	numPredict, ok := options["num_predict"].(float64)
+	if ok && numPredict > 0 && numPredict <= float64(limit) {
+		return options, false
+	}
+
+	if options == nil {
+		options = map[string]any{}
+	}
+	options["num_predict"] = limit
+	return options, true
+}
+
 // https://github.com/ollama/ollama/blob/main/docs/api.md#generate-a-completion
 type OllamaRequestBodyGenerate struct {
 	Model    string         `json:"model"`
@@ -396,12 +740,18 @@ func (b *OllamaRequestBodyGenerate) Validate(supportedModels []string) (string,
 	return b.Model, false, nil
 }
 
+func (b *OllamaRequestBodyGenerate) LimitOutputTokens(limit int) (bool, error) {
+	var dirty bool
+	b.Options, dirty = limitOllamaNumPredict(b.Options, limit)
+	return dirty, nil
+}
+
 // https://github.com/ollama/ollama/blob/main/docs/api.md#generate-a-chat-completion
 type OllamaRequestBodyChat struct {
 	Model     string           `json:"model"`
 	Messages  []map[string]any `json:"messages"`
 	Tools     []map[string]any `json:"tools,omitempty"`
-	Format    map[string]any   `json:"format,omitempty"`
+	Format    json.RawMessage  `json:"format,omitempty"` // "json" or a JSON schema object
 	Options   map[string]any   `json:"options,omitempty"`
 	Stream    bool             `json:"stream,omitempty"`
 	KeepAlive any              `json:"keep_alive,omitempty"`
@@ -422,9 +772,35 @@ func (b *OllamaRequestBodyChat) Validate(supportedModels []string) (string, bool
 	return b.Model, false, nil
 }
 
+func (b *OllamaRequestBodyChat) BodyRuleChecks() []BodyRuleCheck {
+	return []BodyRuleCheck{
+		{Rule: BodyRuleMessages, Check: func() error { return validateOllamaMessages(b.Messages) }},
+		{Rule: BodyRuleOllamaFormat, Check: func() error { return validateOllamaFormat(b.Format) }},
+		{Rule: BodyRuleTools, Check: func() error { return validateOllamaTools(b.Tools) }},
+	}
+}
+
+func (b *OllamaRequestBodyChat) LimitOutputTokens(limit int) (bool, error) {
+	var dirty bool
+	b.Options, dirty = limitOllamaNumPredict(b.Options, limit)
+	return dirty, nil
+}
+
 // https://platform.openai.com/docs/api-reference/completions/create
 type OpenAIRequestBodyStreamOptions struct {
 	IncludeUsage bool `json:"include_usage,omitempty"`
+	// ContinuousUsageStats is a vLLM extension that reports the usage so far in every chunk, so
+	// a response that fails mid-stream is charged for the tokens the backend counted.
+	ContinuousUsageStats bool `json:"continuous_usage_stats,omitempty"`
+}
+
+// includeStreamUsage returns stream options that make a streamed response report its usage with
+// every chunk, and whether they differ from opts.
+func includeStreamUsage(stream bool, opts *OpenAIRequestBodyStreamOptions) (*OpenAIRequestBodyStreamOptions, bool) {
+	if !stream || (opts != nil && opts.IncludeUsage && opts.ContinuousUsageStats) {
+		return opts, false
+	}
+	return &OpenAIRequestBodyStreamOptions{IncludeUsage: true, ContinuousUsageStats: true}, true
 }
 
 type OpenAIRequestBodyCompletions struct {
@@ -457,6 +833,8 @@ type OpenAIRequestBodyCompletions struct {
 	// Specifically "allow listed" additional VLLM params (to support vllm benchmarking):
 	RepetitionPenalty float64 `json:"repetition_penalty,omitempty"`
 	IgnoreEOS         bool    `json:"ignore_eos,omitempty"`
+	// CacheSalt isolates the vLLM prefix cache, it's always set by the worker, see PromptCacheSalter.
+	CacheSalt string `json:"cache_salt,omitempty"`
 }
 
 func (b *OpenAIRequestBodyCompletions) Validate(supportedModels []string) (string, bool, error) {
@@ -472,15 +850,32 @@ func (b *OpenAIRequestBodyCompletions) Validate(supportedModels []string) (strin
 		return "", false, newValidationError(ErrMissingRequiredField, "missing required field: prompt")
 	}
 
-	// In order to correctly process refunds we need to ensure that usage is always
-	// included in the response, even if the request has explicitly disabled it.
-	dirty := false
-	if b.Stream && (b.StreamOptions == nil || !b.StreamOptions.IncludeUsage) {
-		b.StreamOptions = &OpenAIRequestBodyStreamOptions{IncludeUsage: true}
-		dirty = true
+	return b.Model, false, nil
+}
+
+func (b *OpenAIRequestBodyCompletions) IncludeStreamUsage() bool {
+	var dirty bool
+	b.StreamOptions, dirty = includeStreamUsage(b.Stream, b.StreamOptions)
+	return dirty
+}
+
+func (b *OpenAIRequestBodyCompletions) StripUser() bool {
+	dirty := b.User != ""
+	b.User = ""
+	return dirty
+}
+
+func (b *OpenAIRequestBodyCompletions) LimitOutputTokens(limit int) (bool, error) {
+	// every generated sequence counts towards the output tokens.
+	limit, err := perChoiceOutputTokens(limit, b.N, b.BestOf)
+	if err != nil {
+		return false, err
 	}
 
-	return b.Model, dirty, nil
+	maxTokens := clampOutputTokens(b.MaxTokens, limit)
+	dirty := maxTokens != b.MaxTokens
+	b.MaxTokens = maxTokens
+	return dirty, nil
 }
 
 // https://platform.openai.com/docs/api-reference/chat/create
@@ -493,6 +888,8 @@ type OpenAIRequestBodyChatMessage struct {
 	Audio     any    `json:"audio,omitempty"`
 	Refusal   string `json:"refusal,omitempty"`
 	ToolCalls []any  `json:"tool_calls,omitempty"`
+	// ToolCallID is the tool call a message of the tool role answers.
+	ToolCallID string `json:"tool_call_id,omitempty"`
 }
 
 type OpenAIRequestBodyChat struct {
@@ -534,6 +931,8 @@ type OpenAIRequestBodyChat struct {
 	// Specifically "allow listed" additional VLLM params (to support vllm benchmarking):
 	RepetitionPenalty float64 `json:"repetition_penalty,omitempty"`
 	IgnoreEOS         bool    `json:"ignore_eos,omitempty"`
+	// CacheSalt isolates the vLLM prefix cache, it's always set by the worker, see PromptCacheSalter.
+	CacheSalt string `json:"cache_salt,omitempty"`
 }
 
 func (b *OpenAIRequestBodyChat) Validate(supportedModels []string) (string, bool, error) {
@@ -549,19 +948,119 @@ func (b *OpenAIRequestBodyChat) Validate(supportedModels []string) (string, bool
 		return "", false, newValidationError(ErrMissingRequiredField, "missing required field: messages")
 	}
 
-	// In order to correctly process refunds we need to ensure that usage is always
-	// included in the response, even if the request has explicitly disabled it.
-	dirty := false
-	if b.Stream && (b.StreamOptions == nil || !b.StreamOptions.IncludeUsage) {
-		b.StreamOptions = &OpenAIRequestBodyStreamOptions{IncludeUsage: true}
+	return b.Model, false, nil
+}
+
+func (b *OpenAIRequestBodyChat) BodyRuleChecks() []BodyRuleCheck {
+	return []BodyRuleCheck{
+		{Rule: BodyRuleMessages, Check: func() error { return validateMessages(b.Messages) }},
+		{Rule: BodyRuleTools, Check: func() error { return validateTools(b.Tools, b.Functions) }},
+	}
+}
+
+func (b *OpenAIRequestBodyChat) IncludeStreamUsage() bool {
+	var dirty bool
+	b.StreamOptions, dirty = includeStreamUsage(b.Stream, b.StreamOptions)
+	return dirty
+}
+
+func (b *OpenAIRequestBodyChat) StripUser() bool {
+	dirty := b.User != ""
+	b.User = ""
+	return dirty
+}
+
+func (b *OpenAIRequestBodyChat) AnsweredToolCalls() []string {
+	var ids []string
+	for _, message := range b.Messages {
+		if message.Role == "tool" && message.ToolCallID != "" {
+			ids = append(ids, message.ToolCallID)
+		}
+	}
+	return ids
+}
+
+// ConversationDigest is the SHA-256 of the JSON encoding of the first n messages.
+func (b *OpenAIRequestBodyChat) ConversationDigest(n int) ([]byte, bool) {
+	if n < 0 || n > len(b.Messages) {
+		return nil, false
+	}
+	encoded, err := json.Marshal(b.Messages[:n])
+	if err != nil {
+		return nil, false
+	}
+	digest := sha256.Sum256(encoded)
+	return digest[:], true
+}
+
+func (b *OpenAIRequestBodyChat) LimitOutputTokens(limit int) (bool, error) {
+	limit, err := perChoiceOutputTokens(limit, b.N)
+	if err != nil {
+		return false, err
+	}
+
+	// max_completion_tokens takes precedence over the deprecated max_tokens, both are clamped
+	// so that backends that only know max_tokens are limited too.
+	requested := b.MaxCompletionTokens
+	if requested <= 0 {
+		requested = b.MaxTokens
+	}
+	maxCompletionTokens := clampOutputTokens(requested, limit)
+	dirty := maxCompletionTokens != b.MaxCompletionTokens
+	b.MaxCompletionTokens = maxCompletionTokens
+	if b.MaxTokens > maxCompletionTokens {
+		b.MaxTokens = maxCompletionTokens
 		dirty = true
 	}
+	return dirty, nil
+}
 
-	return b.Model, dirty, nil
+// https://docs.vllm.ai/en/latest/serving/openai_compatible_server.html#re-rank-api
+type VLLMRequestBodyRerank struct {
+	Model string `json:"model"`
+	Query string `json:"query"`
+	// Documents are the texts ranked by relevance to the query. vLLM also accepts multimodal
+	// documents, only text documents are allowed.
+	Documents            []string `json:"documents"`
+	TopN                 int      `json:"top_n,omitempty"`
+	TruncatePromptTokens int      `json:"truncate_prompt_tokens,omitempty"`
+}
+
+func (b *VLLMRequestBodyRerank) Validate(supportedModels []string) (string, bool, error) {
+	if b.Model == "" {
+		return "", false, newValidationError(ErrMissingRequiredField, "missing required field: model")
+	}
+
+	if !slices.Contains(supportedModels, b.Model) {
+		return "", false, newValidationError(ErrUnsupportedModel, "unsupported model: "+b.Model)
+	}
+
+	if b.Query == "" {
+		return "", false, newValidationError(ErrMissingRequiredField, "missing required field: query")
+	}
+
+	if len(b.Documents) == 0 {
+		return "", false, newValidationError(ErrMissingRequiredField, "missing required field: documents")
+	}
+
+	return b.Model, false, nil
 }
 
 func (v BodyValidator) ValidateWithBadge(r *http.Request, b *credentialing.Badge) error {
-	if r.ContentLength > int64(v.MaxSize) {
+	// the session hint, continuation and the requested model are only ever set by the validator, never by the client.
+	r.Header.Del(sessionHintRequestHeader)
+	r.Header.Del(continuationRequestHeader)
+	r.Header.Del(continuationPrefixRequestHeader)
+	r.Header.Del(requestedModelHeader)
+	r.Header.Del(messageCountRequestHeader)
+
+	maxSize := v.MaxSize
+	formBuilder, isForm := v.FormBodyTypes[r.URL.Path]
+	if isForm {
+		maxSize = v.MaxFormSize
+	}
+
+	if r.ContentLength > int64(maxSize) {
 		return newValidationError(ErrBodyTooLarge, "content-length exceeds max size")
 	}
 
@@ -573,7 +1072,7 @@ func (v BodyValidator) ValidateWithBadge(r *http.Request, b *credentialing.Badge
 	// This is better than using `http.MaxBytesReader` because it gives us more control of what is
 	// written to a response (e.g., in addition to a `reader` instance, `MaxBytesReader` also requires
 	// `w http.ResponseWriter` as its argument, which it uses to set some internal flags).
-	limitedReader := &io.LimitedReader{R: r.Body, N: int64(v.MaxSize + 1)} // +1 to check if the body exceeds the limit.
+	limitedReader := &io.LimitedReader{R: r.Body, N: int64(maxSize + 1)} // +1 to check if the body exceeds the limit.
 	body, err := io.ReadAll(limitedReader)
 
 	if err != nil {
@@ -592,6 +1091,10 @@ func (v BodyValidator) ValidateWithBadge(r *http.Request, b *credentialing.Badge
 
 	r.Body = io.NopCloser(bytes.NewReader(body))
 
+	if isForm {
+		return v.validateForm(r, b, body, formBuilder())
+	}
+
 	route := r.URL.Path
 	bodyBuilder, found := v.RouteBodyTypes[route]
 	if !found {
@@ -599,11 +1102,26 @@ func (v BodyValidator) ValidateWithBadge(r *http.Request, b *credentialing.Badge
 	}
 	requestBody := bodyBuilder()
 
+	if v.JSONLimits != nil {
+		if err := v.JSONLimits.Check(body); err != nil && v.enforced(r, BodyRuleJSONLimits) {
+			return err
+		}
+	}
+
 	decoder := json.NewDecoder(bytes.NewReader(body))
 	decoder.DisallowUnknownFields()
 
-	if err := decoder.Decode(&requestBody); err != nil {
-		return newValidationError(ErrInvalidJSON, "failed to decode request body: "+err.Error())
+	if strictErr := decoder.Decode(&requestBody); strictErr != nil {
+		// decode again, allowing unknown fields. A body that only decodes like this has unknown
+		// fields, encoding/json has no typed error for them.
+		requestBody = bodyBuilder()
+		decoder = json.NewDecoder(bytes.NewReader(body))
+		if err := decoder.Decode(&requestBody); err != nil {
+			return newValidationError(ErrInvalidJSON, "failed to decode request body: "+err.Error())
+		}
+		if v.enforced(r, BodyRuleUnknownFields) {
+			return newValidationError(ErrInvalidJSON, "failed to decode request body: "+strictErr.Error())
+		}
 	}
 
 	if requestBody == nil {
@@ -611,7 +1129,7 @@ func (v BodyValidator) ValidateWithBadge(r *http.Request, b *credentialing.Badge
 	}
 
 	// Ensure there are no additional JSON objects appended.
-	if decoder.More() {
+	if decoder.More() && v.enforced(r, BodyRuleMultipleJSONObjects) {
 		return newValidationError(ErrMultipleJSONObjects, "multiple JSON objects in request body")
 	}
 
@@ -621,9 +1139,52 @@ func (v BodyValidator) ValidateWithBadge(r *http.Request, b *credentialing.Badge
 		return err
 	}
 
+	if checker, ok := requestBody.(BodyRuleChecker); ok {
+		for _, check := range checker.BodyRuleChecks() {
+			if err := check.Check(); err != nil && v.enforced(r, check.Rule) {
+				return err
+			}
+		}
+	}
+
 	if !slices.Contains(b.Credentials.Models, modelRequested) {
 		return newValidationError(ErrUnsupportedModel, "unsupported model: "+modelRequested)
 	}
+	r.Header.Set(requestedModelHeader, modelRequested)
+
+	mutated, err := slices.Concat(RequiredBodyMutations(), v.Mutations).Mutate(route, requestBody)
+	if err != nil {
+		return err
+	}
+	dirty = dirty || mutated
+
+	// Don't let the backend generate more output tokens than the request pays for.
+	if limiter, ok := requestBody.(OutputTokenLimiter); ok && v.CreditAmount > 0 {
+		limit := MaxOutputTokens(v.CreditAmount)
+		if limit < 1 {
+			return newValidationError(ErrInsufficientCredits, "insufficient credits for a single output token")
+		}
+		clamped, err := limiter.LimitOutputTokens(limit)
+		if err != nil {
+			return err
+		}
+		dirty = dirty || clamped
+	}
+
+	// The salt is always replaced, a client must not be able to share the cache of another client.
+	if salter, ok := requestBody.(PromptCacheSalter); ok {
+		salt, err := promptCacheSalt(v.PromptCacheKey, r.Header, modelRequested, salter)
+		if err != nil {
+			return newValidationError(ErrInvalidJSON, "failed to derive prompt cache salt: "+err.Error())
+		}
+		dirty = salter.SetPromptCacheSalt(salt) || dirty
+	}
+
+	if err := setSessionHint(r, v.SessionHintKey, b.Signature, requestBody); err != nil {
+		return newValidationError(ErrInvalidJSON, "failed to encode conversation prefix: "+err.Error())
+	}
+	setMessageCount(r, requestBody)
+	setContinuation(r, v.ContinuationKey, v.ContinuationNonceSocket, modelRequested, requestBody, time.Now())
 
 	// If the deserialized request body was mutated, we should re-serialize it and
 	// replace the original request body with the mutated one.
@@ -638,10 +1199,105 @@ func (v BodyValidator) ValidateWithBadge(r *http.Request, b *credentialing.Badge
 	return nil
 }
 
-type HostnameValidator struct{}
+// maxFormFieldSize caps the size of the parts of a multipart/form-data body that are not file uploads.
+const maxFormFieldSize = 4096
+
+// allowedFormPartHeaders are the only headers a part of a multipart/form-data body may have.
+var allowedFormPartHeaders = []string{"Content-Disposition", "Content-Type"}
 
-func (HostnameValidator) Validate(r *http.Request) error {
-	if r.Host != messages.UnroutableHostname {
+// validateForm validates a multipart/form-data body. Only the parts known to requestBody are allowed
+// and every part may only appear once. The body is re-encoded from the validated parts, so the
+// backend never parses the multipart framing of the client.
+func (v BodyValidator) validateForm(r *http.Request, b *credentialing.Badge, body []byte, requestBody FormRequestBody) error {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return newValidationError(ErrContentTypeNotAllowed, "Content-Type header must be set to multipart/form-data with a boundary")
+	}
+
+	seen := map[string]bool{}
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		// raw parts, a Content-Transfer-Encoding is rejected instead of decoded.
+		part, err := reader.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return newValidationError(ErrInvalidForm, "failed to read form part: "+err.Error())
+		}
+
+		for header := range part.Header {
+			if !slices.Contains(allowedFormPartHeaders, header) {
+				return newValidationError(ErrHeaderNotAllowed, "form part header not allowed: "+header)
+			}
+		}
+
+		name := part.FormName()
+		if name == "" {
+			return newValidationError(ErrInvalidForm, "form part without a name")
+		}
+		if seen[name] {
+			return newValidationError(ErrInvalidForm, "duplicate form part: "+name)
+		}
+		seen[name] = true
+
+		// file uploads are only limited by the size of the body.
+		isFile := part.FileName() != ""
+		limit := maxFormFieldSize
+		if isFile {
+			limit = len(body)
+		}
+		data, err := io.ReadAll(io.LimitReader(part, int64(limit+1)))
+		if err != nil {
+			return newValidationError(ErrInvalidForm, "failed to read form part: "+err.Error())
+		}
+		if len(data) > limit {
+			return newValidationError(ErrBodyTooLarge, "form part exceeds max size: "+name)
+		}
+
+		if err := requestBody.SetFormPart(name, isFile, data); err != nil {
+			return err
+		}
+	}
+
+	modelRequested, _, err := requestBody.Validate(v.SupportedModels)
+	if err != nil {
+		return err
+	}
+
+	if !slices.Contains(b.Credentials.Models, modelRequested) {
+		return newValidationError(ErrUnsupportedModel, "unsupported model: "+modelRequested)
+	}
+	r.Header.Set(requestedModelHeader, modelRequested)
+
+	var encoded bytes.Buffer
+	writer := multipart.NewWriter(&encoded)
+	if err := requestBody.EncodeForm(writer); err != nil {
+		return newValidationError(ErrInvalidForm, "failed to encode request body: "+err.Error())
+	}
+	if err := writer.Close(); err != nil {
+		return newValidationError(ErrInvalidForm, "failed to encode request body: "+err.Error())
+	}
+
+	r.Body = io.NopCloser(&encoded)
+	r.ContentLength = int64(encoded.Len())
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	return nil
+}
+
+// HostnameValidator only allows requests addressed to messages.UnroutableHostname or one of the
+// allowed hostnames. Hostnames are compared case-insensitively.
+type HostnameValidator struct {
+	// Allowed are the hostnames allowed besides messages.UnroutableHostname, e.g. vanity hostnames
+	// of a deployment.
+	Allowed []string
+}
+
+func (v HostnameValidator) Validate(r *http.Request) error {
+	allowed := func(hostname string) bool {
+		return strings.EqualFold(hostname, r.Host)
+	}
+	if !allowed(messages.UnroutableHostname) && !slices.ContainsFunc(v.Allowed, allowed) {
 		return newValidationError(ErrUnknownHostname, "unknown hostname")
 	}
 	return nil
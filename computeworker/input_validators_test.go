@@ -22,6 +22,7 @@ import (
 	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"sort"
@@ -30,6 +31,7 @@ import (
 
 	"github.com/openpcc/openpcc/auth/credentialing"
 	test "github.com/openpcc/openpcc/inttest"
+	"github.com/openpcc/openpcc/models"
 	"github.com/stretchr/testify/require"
 )
 
@@ -134,6 +136,46 @@ func TestEndpointValidator(t *testing.T) {
 				wantErr:    true,
 				wantCode:   ErrInvalidRequestURI,
 			},
+			{
+				name:       "dot_segments",
+				path:       "/v1/chat/completions",
+				requestURI: "/v1/chat/../chat/completions",
+				method:     "POST",
+				wantErr:    true,
+				wantCode:   ErrInvalidRequestURI,
+			},
+			{
+				name:       "percent_encoded_unreserved",
+				path:       "/v1/chat/completions",
+				requestURI: "/v1/chat/%63ompletions",
+				method:     "POST",
+				wantErr:    true,
+				wantCode:   ErrInvalidRequestURI,
+			},
+			{
+				name:       "percent_encoded_slash",
+				path:       "/v1/chat/completions",
+				requestURI: "/v1/chat%2Fcompletions",
+				method:     "POST",
+				wantErr:    true,
+				wantCode:   ErrInvalidRequestURI,
+			},
+			{
+				name:       "trailing_slash",
+				path:       "/v1/chat/completions",
+				requestURI: "/v1/chat/completions/",
+				method:     "POST",
+				wantErr:    true,
+				wantCode:   ErrInvalidRequestURI,
+			},
+			{
+				name:       "backslash",
+				path:       "/v1/chat/completions",
+				requestURI: `\v1\chat\completions`,
+				method:     "POST",
+				wantErr:    true,
+				wantCode:   ErrInvalidRequestURI,
+			},
 		}
 
 		for _, tc := range testCases {
@@ -309,10 +351,18 @@ func TestRequestAuthorizer(t *testing.T) {
 	invalidBadge := getTestBadgeInvalidSignature(t, badgeKeyProvider)
 	serializedInvalidBadge, err := invalidBadge.Serialize()
 	require.NoError(t, err)
+	// another badge of the same issuer, with its own key ID.
+	otherBadge := credentialing.Badge{Credentials: credentialing.Credentials{Models: []string{"llama3.2:1b"}}}
+	otherCredBytes, err := otherBadge.Credentials.MarshalBinary()
+	require.NoError(t, err)
+	otherBadge.Signature = ed25519.Sign(badgeSK, otherCredBytes)
+	serializedOtherBadge, err := otherBadge.Serialize()
+	require.NoError(t, err)
 
 	testCases := []struct {
 		name       string
 		headers    map[string]string
+		bannedKeys []string
 		wantErr    bool
 		wantCode   ValidationErrorCode
 		wantModels []string
@@ -335,12 +385,43 @@ func TestRequestAuthorizer(t *testing.T) {
 			wantErr:  true,
 			wantCode: ErrBadgeInvalid,
 		},
+		{
+			name: "banned_badge",
+			headers: map[string]string{
+				"Content-Type": "application/json",
+				badgeHeader:    serializedBadge,
+			},
+			bannedKeys: []string{BadgeKeyID(badge.Signature)},
+			wantErr:    true,
+			wantCode:   ErrBadgeInvalid,
+		},
+		{
+			name: "other_badge_of_the_issuer_banned",
+			headers: map[string]string{
+				"Content-Type": "application/json",
+				badgeHeader:    serializedOtherBadge,
+			},
+			bannedKeys: []string{BadgeKeyID(badge.Signature)},
+			wantErr:    false,
+			wantModels: []string{"llama3.2:1b"},
+		},
+		{
+			name: "issuer_key_id_does_not_ban_badges",
+			headers: map[string]string{
+				"Content-Type": "application/json",
+				badgeHeader:    serializedBadge,
+			},
+			bannedKeys: []string{BadgeKeyID(badgePK)},
+			wantErr:    false,
+			wantModels: defaultTestModels,
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			authorizer := RequestAuthorizer{
 				BadgePublicKey: badgePK,
+				BannedKeyIDs:   tc.bannedKeys,
 			}
 
 			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
@@ -368,6 +449,8 @@ func TestBodyValidator(t *testing.T) {
 			OllamaChatPath:        func() RequestBody { return &OllamaRequestBodyChat{} },
 			OpenAICompletionsPath: func() RequestBody { return &OpenAIRequestBodyCompletions{} },
 			OpenAIChatPath:        func() RequestBody { return &OpenAIRequestBodyChat{} },
+			VLLMRerankPath:        func() RequestBody { return &VLLMRequestBodyRerank{} },
+			VLLMRerankAliasPath:   func() RequestBody { return &VLLMRequestBodyRerank{} },
 		},
 		SupportedModels: []string{"llama3.2:1b", "qwen2:1.5b-instruct", "private-model1:5b", "gemma3:1b"},
 	}
@@ -576,7 +659,6 @@ func TestBodyValidator(t *testing.T) {
 			},
 			// TODO[Val]:
 			// - Unicode in payload
-			// - Fuzzy testing
 		}
 
 		for _, tc := range testCases {
@@ -711,6 +793,23 @@ func TestBodyValidator(t *testing.T) {
 				wantErr:  true,
 				wantCode: ErrMissingRequiredField,
 			},
+			{
+				name:    "valid_payload_with_json_format",
+				payload: `{"model":"llama3.2:1b","messages":[{"role":"user","content":"ping"}],"format":"json"}`,
+				wantErr: false,
+			},
+			{
+				name:     "unsupported_format_string",
+				payload:  `{"model":"llama3.2:1b","messages":[{"role":"user","content":"ping"}],"format":"xml"}`,
+				wantErr:  true,
+				wantCode: ErrInvalidFormat,
+			},
+			{
+				name:     "format_schema_too_deep",
+				payload:  `{"model":"llama3.2:1b","messages":[{"role":"user","content":"ping"}],"format":` + strings.Repeat(`{"a":`, 32) + `1` + strings.Repeat(`}`, 32) + `}`,
+				wantErr:  true,
+				wantCode: ErrInvalidFormat,
+			},
 		}
 
 		for _, tc := range testCases {
@@ -982,6 +1081,95 @@ func TestBodyValidator(t *testing.T) {
 		}
 	})
 
+	t.Run("payload validation, /v1/rerank", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			path     string
+			payload  string
+			wantErr  bool
+			wantCode ValidationErrorCode
+		}{
+			{
+				name:    "minimal_valid_payload",
+				path:    VLLMRerankPath,
+				payload: `{"model":"llama3.2:1b","query":"What is the capital of France?","documents":["Paris is the capital of France.","Berlin is in Germany."]}`,
+				wantErr: false,
+			},
+			{
+				name:    "valid_payload_with_options",
+				path:    VLLMRerankPath,
+				payload: `{"model":"llama3.2:1b","query":"capital","documents":["Paris"],"top_n":1,"truncate_prompt_tokens":512}`,
+				wantErr: false,
+			},
+			{
+				name:    "valid_payload_alias_path",
+				path:    VLLMRerankAliasPath,
+				payload: `{"model":"gemma3:1b","query":"capital","documents":["Paris"]}`,
+				wantErr: false,
+			},
+			{
+				name:     "unknown_field",
+				path:     VLLMRerankPath,
+				payload:  `{"model":"llama3.2:1b","query":"capital","documents":["Paris"],"return_documents":true}`,
+				wantErr:  true,
+				wantCode: ErrInvalidJSON,
+			},
+			{
+				name:     "multimodal_documents",
+				path:     VLLMRerankPath,
+				payload:  `{"model":"llama3.2:1b","query":"capital","documents":[{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}`,
+				wantErr:  true,
+				wantCode: ErrInvalidJSON,
+			},
+			{
+				name:     "missing_model",
+				path:     VLLMRerankPath,
+				payload:  `{"query":"capital","documents":["Paris"]}`,
+				wantErr:  true,
+				wantCode: ErrMissingRequiredField,
+			},
+			{
+				name:     "missing_query",
+				path:     VLLMRerankPath,
+				payload:  `{"model":"llama3.2:1b","documents":["Paris"]}`,
+				wantErr:  true,
+				wantCode: ErrMissingRequiredField,
+			},
+			{
+				name:     "empty_documents",
+				path:     VLLMRerankAliasPath,
+				payload:  `{"model":"llama3.2:1b","query":"capital","documents":[]}`,
+				wantErr:  true,
+				wantCode: ErrMissingRequiredField,
+			},
+			{
+				name:     "unsupported_model",
+				path:     VLLMRerankPath,
+				payload:  `{"model":"unsupported-model","query":"capital","documents":["Paris"]}`,
+				wantErr:  true,
+				wantCode: ErrUnsupportedModel,
+			},
+			{
+				name:     "model_not_in_badge_credentials",
+				path:     VLLMRerankPath,
+				payload:  `{"model":"private-model1:5b","query":"capital","documents":["Paris"]}`,
+				wantErr:  true,
+				wantCode: ErrUnsupportedModel,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.payload))
+				req.Header.Set("Content-Type", "application/json")
+				req.ContentLength = int64(len(tc.payload))
+
+				err := validator.ValidateWithBadge(req, &badge)
+				assertError(t, err, tc.wantErr, tc.wantCode)
+			})
+		}
+	})
+
 	t.Run("body mutation for stream options", func(t *testing.T) {
 		testCases := []struct {
 			name        string
@@ -1059,17 +1247,145 @@ func TestBodyValidator(t *testing.T) {
 				require.NoError(t, err, "Should be able to unmarshal test payload")
 
 				_, dirty, err := requestBody.Validate(validator.SupportedModels)
-
 				if tc.wantErr {
 					require.Error(t, err)
-				} else {
-					require.NoError(t, err)
-					require.Equal(t, tc.expectDirty, dirty, "Dirty flag should match expectation")
+					return
+				}
+				require.NoError(t, err)
+				require.False(t, dirty, "Validate should not mutate the body")
+
+				dirty, err = RequiredBodyMutations().Mutate(tc.path, requestBody)
+				require.NoError(t, err)
+				require.Equal(t, tc.expectDirty, dirty, "Dirty flag should match expectation")
+			})
+		}
+	})
+
+	t.Run("output tokens clamped to credit amount", func(t *testing.T) {
+		limited := validator
+		limited.CreditAmount = 100 * models.OutputTokenCreditMultiplier
+
+		testCases := []struct {
+			name     string
+			path     string
+			payload  string
+			want     string
+			wantErr  bool
+			wantCode ValidationErrorCode
+		}{
+			{
+				name:    "ollama_generate_without_num_predict",
+				path:    OllamaGeneratePath,
+				payload: `{"model":"llama3.2:1b","prompt":"Hello"}`,
+				want:    `{"model":"llama3.2:1b","options":{"num_predict":100},"prompt":"Hello"}`,
+			},
+			{
+				name:    "ollama_generate_unlimited_num_predict",
+				path:    OllamaGeneratePath,
+				payload: `{"model":"llama3.2:1b","prompt":"Hello","options":{"num_predict":-1,"temperature":0.5}}`,
+				want:    `{"model":"llama3.2:1b","options":{"num_predict":100,"temperature":0.5},"prompt":"Hello"}`,
+			},
+			{
+				name:    "ollama_chat_num_predict_too_large",
+				path:    OllamaChatPath,
+				payload: `{"model":"llama3.2:1b","messages":[{"role":"user","content":"Hello"}],"options":{"num_predict":5000}}`,
+				want:    `{"model":"llama3.2:1b","messages":[{"content":"Hello","role":"user"}],"options":{"num_predict":100}}`,
+			},
+			{
+				name:    "ollama_chat_num_predict_within_limit",
+				path:    OllamaChatPath,
+				payload: `{"model":"llama3.2:1b","messages":[{"role":"user","content":"Hello"}],"options":{"num_predict":50}}`,
+				want:    `{"model":"llama3.2:1b","messages":[{"role":"user","content":"Hello"}],"options":{"num_predict":50}}`,
+			},
+			{
+				name:    "openai_completions_without_max_tokens",
+				path:    OpenAICompletionsPath,
+				payload: `{"model":"llama3.2:1b","prompt":"Hello"}`,
+				want:    `{"model":"llama3.2:1b","prompt":"Hello","max_tokens":100}`,
+			},
+			{
+				name:    "openai_completions_max_tokens_split_over_choices",
+				path:    OpenAICompletionsPath,
+				payload: `{"model":"llama3.2:1b","prompt":"Hello","max_tokens":1000,"n":2,"best_of":4}`,
+				want:    `{"model":"llama3.2:1b","prompt":"Hello","best_of":4,"max_tokens":25,"n":2}`,
+			},
+			{
+				name:     "openai_completions_too_many_choices",
+				path:     OpenAICompletionsPath,
+				payload:  `{"model":"llama3.2:1b","prompt":"Hello","n":101}`,
+				wantErr:  true,
+				wantCode: ErrInsufficientCredits,
+			},
+			{
+				name:    "openai_chat_without_limits",
+				path:    OpenAIChatPath,
+				payload: `{"model":"llama3.2:1b","messages":[{"role":"user","content":"Hello"}]}`,
+				want:    `{"messages":[{"content":"Hello","role":"user"}],"model":"llama3.2:1b","max_completion_tokens":100}`,
+			},
+			{
+				name:    "openai_chat_deprecated_max_tokens_within_limit",
+				path:    OpenAIChatPath,
+				payload: `{"model":"llama3.2:1b","messages":[{"role":"user","content":"Hello"}],"max_tokens":10}`,
+				want:    `{"messages":[{"content":"Hello","role":"user"}],"model":"llama3.2:1b","max_completion_tokens":10,"max_tokens":10}`,
+			},
+			{
+				name:    "openai_chat_both_limits_too_large",
+				path:    OpenAIChatPath,
+				payload: `{"model":"llama3.2:1b","messages":[{"role":"user","content":"Hello"}],"max_completion_tokens":500,"max_tokens":500}`,
+				want:    `{"messages":[{"content":"Hello","role":"user"}],"model":"llama3.2:1b","max_completion_tokens":100,"max_tokens":100}`,
+			},
+			{
+				name:    "openai_chat_limit_split_over_choices",
+				path:    OpenAIChatPath,
+				payload: `{"model":"llama3.2:1b","messages":[{"role":"user","content":"Hello"}],"max_completion_tokens":40,"n":4}`,
+				want:    `{"messages":[{"content":"Hello","role":"user"}],"model":"llama3.2:1b","max_completion_tokens":25,"n":4}`,
+			},
+			{
+				name:    "rerank_is_not_limited",
+				path:    VLLMRerankPath,
+				payload: `{"model":"llama3.2:1b","query":"capital","documents":["Paris"]}`,
+				want:    `{"model":"llama3.2:1b","query":"capital","documents":["Paris"]}`,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.payload))
+				req.Header.Set("Content-Type", "application/json")
+				req.ContentLength = int64(len(tc.payload))
+
+				err := limited.ValidateWithBadge(req, &badge)
+				assertError(t, err, tc.wantErr, tc.wantCode)
+				if tc.wantErr {
+					return
 				}
+
+				body, err := io.ReadAll(req.Body)
+				require.NoError(t, err)
+				require.JSONEq(t, tc.want, string(body))
 			})
 		}
 	})
 
+	t.Run("hardened json limits checked before decoding", func(t *testing.T) {
+		hardened := validator
+		hardened.JSONLimits = DefaultJSONLimits()
+
+		validate := func(v BodyValidator, payload string) error {
+			req := httptest.NewRequest(http.MethodPost, OpenAIChatPath, strings.NewReader(payload))
+			req.Header.Set("Content-Type", "application/json")
+			req.ContentLength = int64(len(payload))
+			return v.ValidateWithBadge(req, &badge)
+		}
+
+		payload := `{"model":"llama3.2:1b","messages":[{"role":"user","content":"Hello"}],"temperature":3}`
+		require.NoError(t, validate(validator, payload))
+		assertError(t, validate(hardened, payload), true, ErrJSONLimitExceeded)
+
+		payload = `{"model":"llama3.2:1b","messages":[{"role":"user","content":"Hello"}],"temperature":0.7}`
+		require.NoError(t, validate(hardened, payload))
+	})
+
 	t.Run("vllm extra params", func(t *testing.T) {
 		testCases := []struct {
 			name    string
@@ -1112,12 +1428,144 @@ func TestBodyValidator(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("audit mode", func(t *testing.T) {
+		testCases := []struct {
+			name     string
+			audit    []BodyRule
+			path     string
+			hardened bool
+			payload  string
+			wantErr  bool
+			wantCode ValidationErrorCode
+		}{
+			{
+				name:    "unknown_field_audited",
+				audit:   []BodyRule{BodyRuleUnknownFields},
+				payload: `{"model":"llama3.2:1b","prompt":"Hello","unknown_field":"value"}`,
+				wantErr: false,
+			},
+			{
+				name:     "unknown_field_audited_invalid_property_type",
+				audit:    []BodyRule{BodyRuleUnknownFields},
+				payload:  `{"model":"llama3.2:1b","prompt":{"nested":"value"},"unknown_field":"value"}`,
+				wantErr:  true,
+				wantCode: ErrInvalidJSON,
+			},
+			{
+				name:     "unknown_field_audited_missing_prompt",
+				audit:    []BodyRule{BodyRuleUnknownFields},
+				payload:  `{"model":"llama3.2:1b","unknown_field":"value"}`,
+				wantErr:  true,
+				wantCode: ErrMissingRequiredField,
+			},
+			{
+				name:    "multiple_json_objects_audited",
+				audit:   []BodyRule{BodyRuleMultipleJSONObjects},
+				payload: `{"model":"llama3.2:1b","prompt":"Hello"}{"model":"llama3.2:1b","prompt":"Hello"}`,
+				wantErr: false,
+			},
+			{
+				name:     "other_rule_audited",
+				audit:    []BodyRule{BodyRuleMultipleJSONObjects},
+				payload:  `{"model":"llama3.2:1b","prompt":"Hello","unknown_field":"value"}`,
+				wantErr:  true,
+				wantCode: ErrInvalidJSON,
+			},
+			{
+				name:     "json_limits_audited",
+				audit:    []BodyRule{BodyRuleJSONLimits},
+				path:     OpenAIChatPath,
+				hardened: true,
+				payload:  `{"model":"llama3.2:1b","messages":[{"role":"user","content":"Hello"}],"temperature":3}`,
+				wantErr:  false,
+			},
+			{
+				name:    "ollama_format_audited",
+				audit:   []BodyRule{BodyRuleOllamaFormat},
+				path:    OllamaChatPath,
+				payload: `{"model":"llama3.2:1b","messages":[{"role":"user","content":"ping"}],"format":"xml"}`,
+				wantErr: false,
+			},
+			{
+				name:     "ollama_format_enforced",
+				audit:    []BodyRule{BodyRuleTools},
+				path:     OllamaChatPath,
+				payload:  `{"model":"llama3.2:1b","messages":[{"role":"user","content":"ping"}],"format":"xml"}`,
+				wantErr:  true,
+				wantCode: ErrInvalidFormat,
+			},
+			{
+				name:    "tools_audited",
+				audit:   []BodyRule{BodyRuleTools},
+				path:    OpenAIChatPath,
+				payload: `{"model":"llama3.2:1b","messages":[{"role":"user","content":"ping"}],"tools":[{"type":"retrieval"}]}`,
+				wantErr: false,
+			},
+			{
+				name:    "messages_audited",
+				audit:   []BodyRule{BodyRuleMessages},
+				path:    OpenAIChatPath,
+				payload: `{"model":"llama3.2:1b","messages":[{"role":"wizard","content":"ping"}]}`,
+				wantErr: false,
+			},
+			{
+				name:     "messages_audited_tools_enforced",
+				audit:    []BodyRule{BodyRuleMessages},
+				path:     OpenAIChatPath,
+				payload:  `{"model":"llama3.2:1b","messages":[{"role":"wizard","content":"ping"}],"tools":[{"type":"retrieval"}]}`,
+				wantErr:  true,
+				wantCode: ErrInvalidTools,
+			},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				auditValidator := validator
+				auditValidator.Audit = tc.audit
+				if tc.hardened {
+					auditValidator.JSONLimits = DefaultJSONLimits()
+				}
+
+				path := tc.path
+				if path == "" {
+					path = OllamaGeneratePath
+				}
+				req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(tc.payload))
+				req.Header.Set("Content-Type", "application/json")
+				req.ContentLength = int64(len(tc.payload))
+
+				err := auditValidator.ValidateWithBadge(req, &badge)
+				assertError(t, err, tc.wantErr, tc.wantCode)
+				if !tc.wantErr {
+					// the request is allowed as-is.
+					body, err := io.ReadAll(req.Body)
+					require.NoError(t, err)
+					require.Equal(t, tc.payload, string(body))
+				}
+			})
+		}
+	})
+}
+
+func TestParseBodyRule(t *testing.T) {
+	rule, err := ParseBodyRule("unknown_fields")
+	require.NoError(t, err)
+	require.Equal(t, BodyRuleUnknownFields, rule)
+
+	rule, err = ParseBodyRule("messages")
+	require.NoError(t, err)
+	require.Equal(t, BodyRuleMessages, rule)
+
+	_, err = ParseBodyRule("max_size")
+	require.Error(t, err)
 }
 
 func TestHostnameValidator(t *testing.T) {
 	testCases := []struct {
 		name     string
 		url      string
+		allowed  []string
 		wantErr  bool
 		wantCode ValidationErrorCode
 	}{
@@ -1138,12 +1586,48 @@ func TestHostnameValidator(t *testing.T) {
 			wantErr:  true,
 			wantCode: ErrUnknownHostname,
 		},
+		{
+			name:    "configured_vanity_hostname",
+			url:     "http://llm.staging.invalid/v1/chat/completions",
+			allowed: []string{"confsec.invalid", "llm.staging.invalid"},
+			wantErr: false,
+		},
+		{
+			name:    "configured_default_hostname",
+			url:     "http://confsec.invalid/v1/chat/completions",
+			allowed: []string{"confsec.invalid", "llm.staging.invalid"},
+			wantErr: false,
+		},
+		{
+			name:    "default_hostname_not_configured",
+			url:     "http://confsec.invalid/v1/chat/completions",
+			allowed: []string{"llm.staging.invalid"},
+			wantErr: false,
+		},
+		{
+			name:    "default_hostname_different_case",
+			url:     "http://CONFSEC.invalid/v1/chat/completions",
+			wantErr: false,
+		},
+		{
+			name:    "configured_hostname_different_case",
+			url:     "http://LLM.Staging.invalid/v1/chat/completions",
+			allowed: []string{"llm.staging.invalid"},
+			wantErr: false,
+		},
+		{
+			name:     "hostname_not_configured",
+			url:      "http://llm.prod.invalid/v1/chat/completions",
+			allowed:  []string{"llm.staging.invalid"},
+			wantErr:  true,
+			wantCode: ErrUnknownHostname,
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			req := httptest.NewRequest(http.MethodPost, tc.url, nil)
-			validator := &HostnameValidator{}
+			validator := &HostnameValidator{Allowed: tc.allowed}
 			err := validator.Validate(req)
 			assertError(t, err, tc.wantErr, tc.wantCode)
 		})
@@ -1229,3 +1713,63 @@ func TestRequestValidator(t *testing.T) {
 		})
 	}
 }
+
+func fuzzRequestBodySeeds(f *testing.F, seeds ...string) {
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+}
+
+func FuzzOllamaGenerateBody(f *testing.F) {
+	fuzzRequestBodySeeds(f,
+		`{"model":"llama3.2:1b","prompt":"Why is the sky blue?"}`,
+		`{"model":"llama3.2:1b","prompt":"hi","options":{"num_predict":4096,"temperature":0.2},"keep_alive":"5m"}`,
+		`{"model":"llama3.2:1b","prompt":"\u00e9\ud83d\ude00","stream":true}`,
+	)
+	f.Fuzz(func(_ *testing.T, data []byte) {
+		FuzzOllamaGenerate(data)
+	})
+}
+
+func FuzzOllamaChatBody(f *testing.F) {
+	fuzzRequestBodySeeds(f,
+		`{"model":"llama3.2:1b","messages":[{"role":"user","content":"hi"}]}`,
+		`{"model":"llama3.2:1b","messages":[],"format":"json","options":{"num_predict":-1}}`,
+		`{"model":"llama3.2:1b","messages":[],"format":{"type":"object","properties":{"a":{"type":"string"}}}}`,
+	)
+	f.Fuzz(func(_ *testing.T, data []byte) {
+		FuzzOllamaChat(data)
+	})
+}
+
+func FuzzOpenAICompletionsBody(f *testing.F) {
+	fuzzRequestBodySeeds(f,
+		`{"model":"llama3.2:1b","prompt":"hi"}`,
+		`{"model":"llama3.2:1b","prompt":"hi","stream":true,"n":2,"best_of":3,"max_tokens":100000}`,
+		`{"model":"llama3.2:1b","prompt":"hi","stream":true,"stream_options":{"include_usage":false},"stop":["a","b"]}`,
+	)
+	f.Fuzz(func(_ *testing.T, data []byte) {
+		FuzzOpenAICompletions(data)
+	})
+}
+
+func FuzzOpenAIChatBody(f *testing.F) {
+	fuzzRequestBodySeeds(f,
+		`{"model":"llama3.2:1b","messages":[{"role":"user","content":"hi"}]}`,
+		`{"model":"llama3.2:1b","messages":[],"stream":true,"max_tokens":5000,"max_completion_tokens":10}`,
+		`{"model":"llama3.2:1b","messages":[{"role":"assistant","content":null,"tool_calls":[{}]}],"n":4}`,
+	)
+	f.Fuzz(func(_ *testing.T, data []byte) {
+		FuzzOpenAIChat(data)
+	})
+}
+
+func FuzzVLLMRerankBody(f *testing.F) {
+	fuzzRequestBodySeeds(f,
+		`{"model":"llama3.2:1b","query":"sky","documents":["blue","green"]}`,
+		`{"model":"llama3.2:1b","query":"sky","documents":["a"],"top_n":1,"truncate_prompt_tokens":8}`,
+	)
+	f.Fuzz(func(_ *testing.T, data []byte) {
+		FuzzVLLMRerank(data)
+	})
+}
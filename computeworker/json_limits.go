@@ -0,0 +1,179 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+)
+
+// JSONLimits bounds the JSON of a request body while it is tokenized, before it is decoded into
+// its RequestBody type. encoding/json allocates every string and number of a body, whatever its
+// size, before the route-specific checks run.
+type JSONLimits struct {
+	// MaxDepth is the max nesting depth of objects and arrays.
+	MaxDepth int
+	// MaxKeyLen is the max length of an object key.
+	MaxKeyLen int
+	// MaxNumberLen is the max length of a number literal.
+	MaxNumberLen int
+	// Fields are the limits of top-level fields of the request body. A limit also applies to the
+	// elements of an array field, e.g. the stop sequences.
+	Fields map[string]FieldLimit
+}
+
+// FieldLimit bounds the value of a single field.
+type FieldLimit struct {
+	// MaxLen is the max length of a string value, 0 means no limit.
+	MaxLen int
+	// Min and Max bound a number value, both 0 means no bound.
+	Min, Max float64
+}
+
+// DefaultJSONLimits returns limits that allow any valid request of the supported routes.
+func DefaultJSONLimits() *JSONLimits {
+	const maxTokens = 1 << 24
+	return &JSONLimits{
+		MaxDepth:     64,
+		MaxKeyLen:    256,
+		MaxNumberLen: 64,
+		Fields: map[string]FieldLimit{
+			"model":                  {MaxLen: 256},
+			"user":                   {MaxLen: 256},
+			"stop":                   {MaxLen: 256},
+			"keep_alive":             {MaxLen: 32},
+			"temperature":            {Min: 0, Max: 2},
+			"top_p":                  {Min: 0, Max: 1},
+			"presence_penalty":       {Min: -2, Max: 2},
+			"frequency_penalty":      {Min: -2, Max: 2},
+			"n":                      {Min: 1, Max: 128},
+			"best_of":                {Min: 1, Max: 128},
+			"top_logprobs":           {Min: 0, Max: 20},
+			"max_tokens":             {Min: -1, Max: maxTokens},
+			"max_completion_tokens":  {Min: -1, Max: maxTokens},
+			"top_n":                  {Min: 0, Max: maxTokens},
+			"truncate_prompt_tokens": {Min: -1, Max: maxTokens},
+		},
+	}
+}
+
+// jsonFrame is an object or array that is being tokenized.
+type jsonFrame struct {
+	object    bool
+	expectKey bool
+}
+
+// Check tokenizes the first JSON value of body and returns a validation error when it exceeds
+// the limits. Syntax errors are left to the decoder.
+func (l *JSONLimits) Check(body []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var (
+		stack []jsonFrame
+		field string
+	)
+	for {
+		tok, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return newValidationError(ErrInvalidJSON, "failed to decode request body: "+err.Error())
+		}
+
+		top := len(stack) - 1
+		if top >= 0 && stack[top].object && stack[top].expectKey {
+			key, _ := tok.(string)
+			if len(key) > l.MaxKeyLen {
+				return newValidationError(ErrJSONLimitExceeded, "object key exceeds max length")
+			}
+			stack[top].expectKey = false
+			if top == 0 {
+				field = key
+			}
+			continue
+		}
+
+		switch t := tok.(type) {
+		case json.Delim:
+			if t == '{' || t == '[' {
+				if len(stack) >= l.MaxDepth {
+					return newValidationError(ErrJSONLimitExceeded, "request body exceeds max nesting depth")
+				}
+				stack = append(stack, jsonFrame{object: t == '{', expectKey: t == '{'})
+				continue
+			}
+			stack = stack[:top]
+		case string:
+			if limit, ok := l.fieldLimit(stack, field); ok && limit.MaxLen > 0 && len(t) > limit.MaxLen {
+				return newValidationError(ErrJSONLimitExceeded, "field exceeds max length: "+field)
+			}
+		case json.Number:
+			if err := l.checkNumber(t, stack, field); err != nil {
+				return err
+			}
+		}
+
+		if len(stack) == 0 {
+			return nil
+		}
+		if top := len(stack) - 1; stack[top].object {
+			stack[top].expectKey = true
+		}
+	}
+}
+
+func (l *JSONLimits) checkNumber(n json.Number, stack []jsonFrame, field string) error {
+	if len(n) > l.MaxNumberLen {
+		return newValidationError(ErrJSONLimitExceeded, "number exceeds max length")
+	}
+
+	v, err := strconv.ParseFloat(string(n), 64)
+	if err != nil || math.IsInf(v, 0) {
+		return newValidationError(ErrJSONLimitExceeded, "number out of range")
+	}
+
+	limit, ok := l.fieldLimit(stack, field)
+	if !ok || (limit.Min == 0 && limit.Max == 0) {
+		return nil
+	}
+	if v < limit.Min || v > limit.Max {
+		return newValidationError(ErrJSONLimitExceeded, "field out of range: "+field)
+	}
+	return nil
+}
+
+// fieldLimit returns the limit of the top-level field a value belongs to, values nested in
+// objects below the top-level are not covered by field limits.
+func (l *JSONLimits) fieldLimit(stack []jsonFrame, field string) (FieldLimit, bool) {
+	if len(stack) == 0 || !stack[0].object {
+		return FieldLimit{}, false
+	}
+	for _, frame := range stack[1:] {
+		if frame.object {
+			return FieldLimit{}, false
+		}
+	}
+	limit, ok := l.Fields[field]
+	return limit, ok
+}
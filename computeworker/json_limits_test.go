@@ -0,0 +1,96 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJSONLimitsCheck(t *testing.T) {
+	limits := DefaultJSONLimits()
+
+	tests := map[string]struct {
+		body     string
+		wantErr  bool
+		wantCode ValidationErrorCode
+	}{
+		"ok, chat request": {
+			body: `{"model":"llama3.2:1b","messages":[{"role":"user","content":"Hello"}],"temperature":0.7,"stop":["\n"],"n":2}`,
+		},
+		"ok, limits don't apply to nested objects": {
+			body: `{"model":"llama3.2:1b","prompt":"Hello","options":{"temperature":5,"model":"` + strings.Repeat("a", 300) + `"}}`,
+		},
+		"ok, unlimited long prompt": {
+			body: `{"model":"llama3.2:1b","prompt":"` + strings.Repeat("a", 64*1024) + `"}`,
+		},
+		"ok, only the first value is checked": {
+			body: `{"model":"llama3.2:1b"} {"model":"` + strings.Repeat("a", 300) + `"}`,
+		},
+		"ok, syntax errors are left to the decoder": {
+			body: `{"model":`,
+		},
+		"fail, model too long": {
+			body:     `{"model":"` + strings.Repeat("a", 257) + `","prompt":"Hello"}`,
+			wantErr:  true,
+			wantCode: ErrJSONLimitExceeded,
+		},
+		"fail, stop sequence too long": {
+			body:     `{"model":"llama3.2:1b","prompt":"Hello","stop":["ok","` + strings.Repeat("a", 257) + `"]}`,
+			wantErr:  true,
+			wantCode: ErrJSONLimitExceeded,
+		},
+		"fail, temperature out of range": {
+			body:     `{"model":"llama3.2:1b","prompt":"Hello","temperature":2.5}`,
+			wantErr:  true,
+			wantCode: ErrJSONLimitExceeded,
+		},
+		"fail, n out of range": {
+			body:     `{"model":"llama3.2:1b","prompt":"Hello","n":0}`,
+			wantErr:  true,
+			wantCode: ErrJSONLimitExceeded,
+		},
+		"fail, number literal too long": {
+			body:     `{"model":"llama3.2:1b","prompt":"Hello","seed":` + strings.Repeat("9", 65) + `}`,
+			wantErr:  true,
+			wantCode: ErrJSONLimitExceeded,
+		},
+		"fail, number overflows": {
+			body:     `{"model":"llama3.2:1b","prompt":"Hello","seed":1e999}`,
+			wantErr:  true,
+			wantCode: ErrJSONLimitExceeded,
+		},
+		"fail, key too long": {
+			body:     `{"model":"llama3.2:1b","` + strings.Repeat("k", 257) + `":1}`,
+			wantErr:  true,
+			wantCode: ErrJSONLimitExceeded,
+		},
+		"fail, nested too deep": {
+			body:     `{"model":"llama3.2:1b","options":` + strings.Repeat("[", 64) + strings.Repeat("]", 64) + `}`,
+			wantErr:  true,
+			wantCode: ErrJSONLimitExceeded,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := limits.Check([]byte(tc.body))
+			assertError(t, err, tc.wantErr, tc.wantCode)
+		})
+	}
+}
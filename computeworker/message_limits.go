@@ -0,0 +1,120 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeworker
+
+import (
+	"fmt"
+)
+
+const (
+	// maxMessages is the maximum number of messages of a chat request.
+	maxMessages = 1024
+	// maxMessageContentSize is the maximum size in bytes of the text content of a single message,
+	// the default body size, so raising the body size for images doesn't allow larger texts.
+	maxMessageContentSize = 1024 * 1024
+)
+
+// messageRoles are the roles a chat message can have.
+var messageRoles = map[string]bool{
+	"system":    true,
+	"user":      true,
+	"assistant": true,
+	"tool":      true,
+}
+
+// validateMessages validates the messages of an OpenAI chat request. The backend holds every
+// message in memory while it renders the prompt, so the number of messages and the size of their
+// text is bounded. Image and audio parts are only bounded by the body size.
+func validateMessages(messages []OpenAIRequestBodyChatMessage) error {
+	if len(messages) > maxMessages {
+		return newValidationError(ErrInvalidMessages, fmt.Sprintf("messages exceed max number of %d", maxMessages))
+	}
+
+	for i, message := range messages {
+		if err := validateMessageRole(i, message.Role); err != nil {
+			return err
+		}
+		size, ok := openAIContentSize(message.Content)
+		if !ok {
+			return newValidationError(ErrInvalidMessages, fmt.Sprintf("message %d must have a string or array content", i))
+		}
+		if size > maxMessageContentSize {
+			return newValidationError(ErrInvalidMessages, fmt.Sprintf("content of message %d exceeds max size of %d bytes", i, maxMessageContentSize))
+		}
+	}
+	return nil
+}
+
+// validateOllamaMessages validates the messages of an Ollama chat request, images are a separate
+// field of a message and are only bounded by the body size.
+func validateOllamaMessages(messages []map[string]any) error {
+	if len(messages) > maxMessages {
+		return newValidationError(ErrInvalidMessages, fmt.Sprintf("messages exceed max number of %d", maxMessages))
+	}
+
+	for i, message := range messages {
+		role, _ := message["role"].(string)
+		if err := validateMessageRole(i, role); err != nil {
+			return err
+		}
+		content, ok := message["content"]
+		if !ok || content == nil {
+			continue
+		}
+		text, ok := content.(string)
+		if !ok {
+			return newValidationError(ErrInvalidMessages, fmt.Sprintf("message %d must have a string content", i))
+		}
+		if len(text) > maxMessageContentSize {
+			return newValidationError(ErrInvalidMessages, fmt.Sprintf("content of message %d exceeds max size of %d bytes", i, maxMessageContentSize))
+		}
+	}
+	return nil
+}
+
+func validateMessageRole(i int, role string) error {
+	if !messageRoles[role] {
+		return newValidationError(ErrInvalidMessages, fmt.Sprintf("message %d must have a role of system, user, assistant or tool", i))
+	}
+	return nil
+}
+
+// openAIContentSize returns the size of the text of a message content, which is either a string
+// or an array of content parts. Only text and refusal parts are counted.
+func openAIContentSize(content any) (int, bool) {
+	switch content := content.(type) {
+	case nil:
+		// assistant messages with tool calls can omit the content.
+		return 0, true
+	case string:
+		return len(content), true
+	case []any:
+		size := 0
+		for _, part := range content {
+			obj, ok := part.(map[string]any)
+			if !ok {
+				return 0, false
+			}
+			text, _ := obj["text"].(string)
+			refusal, _ := obj["refusal"].(string)
+			size += len(text) + len(refusal)
+		}
+		return size, true
+	default:
+		return 0, false
+	}
+}
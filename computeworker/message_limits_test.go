@@ -0,0 +1,101 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeworker
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateMessages(t *testing.T) {
+	manyMessages := func(n int) string {
+		messages := make([]string, 0, n)
+		for range n {
+			messages = append(messages, `{"role":"user","content":"hi"}`)
+		}
+		return "[" + strings.Join(messages, ",") + "]"
+	}
+	largeText := strings.Repeat("a", maxMessageContentSize+1)
+
+	tests := []struct {
+		name     string
+		messages string
+		wantErr  bool
+	}{
+		{name: "ok, no messages", messages: `[]`},
+		{name: "ok, all roles", messages: `[{"role":"system","content":"s"},{"role":"user","content":"u"},{"role":"assistant","content":null,"tool_calls":[{"id":"call_1"}]},{"role":"tool","content":"t","tool_call_id":"call_1"}]`},
+		{name: "ok, content parts", messages: `[{"role":"user","content":[{"type":"text","text":"hi"},{"type":"image_url","image_url":{"url":"data:image/png;base64,` + largeText + `"}}]}]`},
+		{name: "ok, max messages", messages: manyMessages(maxMessages)},
+		{name: "fail, too many messages", messages: manyMessages(maxMessages + 1), wantErr: true},
+		{name: "fail, missing role", messages: `[{"content":"hi"}]`, wantErr: true},
+		{name: "fail, unknown role", messages: `[{"role":"root","content":"hi"}]`, wantErr: true},
+		{name: "fail, content too large", messages: `[{"role":"user","content":"` + largeText + `"}]`, wantErr: true},
+		{name: "fail, content parts too large", messages: `[{"role":"user","content":[{"type":"text","text":"` + largeText[1:] + `"},{"type":"text","text":"a"}]}]`, wantErr: true},
+		{name: "fail, content part not an object", messages: `[{"role":"user","content":["hi"]}]`, wantErr: true},
+		{name: "fail, content is a number", messages: `[{"role":"user","content":1}]`, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var messages []OpenAIRequestBodyChatMessage
+			require.NoError(t, json.Unmarshal([]byte(tc.messages), &messages))
+
+			err := validateMessages(messages)
+			if !tc.wantErr {
+				require.NoError(t, err)
+				return
+			}
+
+			var validationErr ValidationError
+			require.True(t, errors.As(err, &validationErr))
+			require.Equal(t, ErrInvalidMessages, validationErr.Code)
+		})
+	}
+}
+
+func TestValidateOllamaMessages(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages string
+		wantErr  bool
+	}{
+		{name: "ok, images", messages: `[{"role":"user","content":"describe","images":["` + strings.Repeat("a", maxMessageContentSize+1) + `"]}]`},
+		{name: "ok, tool call without content", messages: `[{"role":"assistant","tool_calls":[{"function":{"name":"f"}}]}]`},
+		{name: "fail, too many messages", messages: `[` + strings.Repeat(`{"role":"user","content":"hi"},`, maxMessages) + `{"role":"user","content":"hi"}]`, wantErr: true},
+		{name: "fail, unknown role", messages: `[{"role":"developer","content":"hi"}]`, wantErr: true},
+		{name: "fail, content not a string", messages: `[{"role":"user","content":{"text":"hi"}}]`, wantErr: true},
+		{name: "fail, content too large", messages: `[{"role":"user","content":"` + strings.Repeat("a", maxMessageContentSize+1) + `"}]`, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var messages []map[string]any
+			require.NoError(t, json.Unmarshal([]byte(tc.messages), &messages))
+
+			err := validateOllamaMessages(messages)
+			if !tc.wantErr {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"syscall"
+)
+
+const (
+	// MigrationSignal asks a running compute_worker to end its response at the next token
+	// boundary, so the client can resume the request on another node.
+	MigrationSignal = syscall.SIGUSR1
+	// ContinuationTrailer is the trailer of the encapsulated response that carries the encoded
+	// Continuation of a migrated response. It is encrypted to the client like the rest of the
+	// response, router_com and the router never see it.
+	ContinuationTrailer = "X-Confsec-Continuation"
+	// ContinuationVersion is the version of the continuation format.
+	ContinuationVersion = 1
+)
+
+// Continuation is everything a client needs to resume a migrated request on another node.
+type Continuation struct {
+	Version int `json:"version"`
+	// Path is the path of the original request.
+	Path string `json:"path"`
+	// Request is the body of the original request.
+	Request json.RawMessage `json:"request"`
+	// Output is the output that was delivered before the migration.
+	Output string `json:"output"`
+	// Tokens is the number of output tokens in Output, the response is resumable at this token.
+	Tokens int `json:"tokens"`
+}
+
+// Encode encodes the continuation for the continuation trailer.
+func (c *Continuation) Encode() (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal continuation: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DecodeContinuation decodes a continuation from the continuation trailer.
+func DecodeContinuation(s string) (*Continuation, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode continuation: %w", err)
+	}
+
+	var c Continuation
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal continuation: %w", err)
+	}
+
+	if c.Version != ContinuationVersion {
+		return nil, fmt.Errorf("unsupported continuation version %d", c.Version)
+	}
+
+	return &c, nil
+}
+
+// ResumeBody returns the request body that resumes the request on another node. The body is
+// replayed to c.Path. Chat requests get the delivered output as a final assistant message,
+// which the backend continues. Generate and completions requests get the output appended
+// to their prompt.
+func (c *Continuation) ResumeBody() ([]byte, error) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(c.Request, &body); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+
+	if c.Output == "" {
+		return c.Request, nil
+	}
+
+	switch c.Path {
+	case OllamaChatPath, OpenAIChatPath:
+		var messages []json.RawMessage
+		if err := json.Unmarshal(body["messages"], &messages); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal messages: %w", err)
+		}
+		msg, err := json.Marshal(map[string]string{
+			"role":    "assistant",
+			"content": c.Output,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal assistant message: %w", err)
+		}
+		body["messages"], err = json.Marshal(append(messages, msg))
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal messages: %w", err)
+		}
+	case OllamaGeneratePath, OpenAICompletionsPath:
+		var prompt string
+		if err := json.Unmarshal(body["prompt"], &prompt); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal prompt: %w", err)
+		}
+		var err error
+		body["prompt"], err = json.Marshal(prompt + c.Output)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal prompt: %w", err)
+		}
+	default:
+		return nil, errors.New("unsupported path: " + c.Path)
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return b, nil
+}
+
+// resumablePath reports whether responses to requests on path can be migrated, see ResumeBody.
+func resumablePath(p string) bool {
+	switch p {
+	case OllamaChatPath, OpenAIChatPath, OllamaGeneratePath, OpenAICompletionsPath:
+		return true
+	default:
+		return false
+	}
+}
+
+// Migrate asks the worker to end its response at the next token boundary and to hand the
+// client a continuation instead. It is safe to call more than once and from any goroutine.
+func (s *Worker) Migrate() {
+	if s.migrate == nil {
+		return
+	}
+	s.migrateOnce.Do(func() {
+		close(s.migrate)
+	})
+}
+
+// continuationBody adds the continuation trailer to resp once a migrated response body ends.
+type continuationBody struct {
+	refundRecorder
+	ctx         context.Context
+	resp        *http.Response
+	path        string
+	requestBody []byte
+}
+
+func newContinuationBody(ctx context.Context, resp *http.Response, path string, requestBody []byte, recorder refundRecorder) io.ReadCloser {
+	if resp.Trailer == nil {
+		resp.Trailer = http.Header{}
+	}
+	return &continuationBody{
+		refundRecorder: recorder,
+		ctx:            ctx,
+		resp:           resp,
+		path:           path,
+		requestBody:    requestBody,
+	}
+}
+
+func (b *continuationBody) Read(p []byte) (int, error) {
+	n, err := b.refundRecorder.Read(p)
+	if err == io.EOF && b.Migrated() && b.resp.Trailer.Get(ContinuationTrailer) == "" {
+		output, tokens := b.Output()
+		continuation := &Continuation{
+			Version: ContinuationVersion,
+			Path:    b.path,
+			Request: b.requestBody,
+			Output:  output,
+			Tokens:  tokens,
+		}
+		encoded, encErr := continuation.Encode()
+		if encErr != nil {
+			// the footer still reports the migration, the client can retry the request from scratch.
+			slog.ErrorContext(b.ctx, "Failed to encode continuation", "error", encErr)
+			return n, err
+		}
+		b.resp.Trailer.Set(ContinuationTrailer, encoded)
+	}
+	return n, err
+}
@@ -0,0 +1,149 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContinuation(t *testing.T) {
+	t.Run("ok, encode and decode", func(t *testing.T) {
+		c := &Continuation{
+			Version: ContinuationVersion,
+			Path:    OllamaChatPath,
+			Request: json.RawMessage(`{"model":"llama3.2:1b","messages":[]}`),
+			Output:  "Hello",
+			Tokens:  1,
+		}
+
+		encoded, err := c.Encode()
+		require.NoError(t, err)
+
+		got, err := DecodeContinuation(encoded)
+		require.NoError(t, err)
+		require.Equal(t, c, got)
+	})
+
+	t.Run("fail, unsupported version", func(t *testing.T) {
+		encoded, err := (&Continuation{Version: 2}).Encode()
+		require.NoError(t, err)
+
+		_, err = DecodeContinuation(encoded)
+		require.Error(t, err)
+	})
+
+	t.Run("fail, invalid encoding", func(t *testing.T) {
+		_, err := DecodeContinuation("not base64!")
+		require.Error(t, err)
+	})
+}
+
+func TestContinuationResumeBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		request  string
+		output   string
+		wantBody string
+		wantErr  bool
+	}{
+		{
+			name:     "ok, ollama chat",
+			path:     OllamaChatPath,
+			request:  `{"model":"llama3.2:1b","messages":[{"role":"user","content":"Hi"}]}`,
+			output:   "Hello",
+			wantBody: `{"model":"llama3.2:1b","messages":[{"role":"user","content":"Hi"},{"role":"assistant","content":"Hello"}]}`,
+		},
+		{
+			name:     "ok, openai chat",
+			path:     OpenAIChatPath,
+			request:  `{"model":"llama3.2:1b","stream":true,"messages":[{"role":"user","content":"Hi"}]}`,
+			output:   "Hello",
+			wantBody: `{"model":"llama3.2:1b","stream":true,"messages":[{"role":"user","content":"Hi"},{"role":"assistant","content":"Hello"}]}`,
+		},
+		{
+			name:     "ok, ollama generate",
+			path:     OllamaGeneratePath,
+			request:  `{"model":"llama3.2:1b","prompt":"Once upon"}`,
+			output:   " a time",
+			wantBody: `{"model":"llama3.2:1b","prompt":"Once upon a time"}`,
+		},
+		{
+			name:     "ok, openai completions",
+			path:     OpenAICompletionsPath,
+			request:  `{"model":"llama3.2:1b","prompt":"Once upon"}`,
+			output:   " a time",
+			wantBody: `{"model":"llama3.2:1b","prompt":"Once upon a time"}`,
+		},
+		{
+			name:     "ok, no output replays the original request",
+			path:     OllamaChatPath,
+			request:  `{"model":"llama3.2:1b","messages":[]}`,
+			wantBody: `{"model":"llama3.2:1b","messages":[]}`,
+		},
+		{
+			name:    "fail, prompt is not a string",
+			path:    OpenAICompletionsPath,
+			request: `{"model":"llama3.2:1b","prompt":["a","b"]}`,
+			output:  "c",
+			wantErr: true,
+		},
+		{
+			name:    "fail, unsupported path",
+			path:    "/api/embed",
+			request: `{"model":"llama3.2:1b"}`,
+			output:  "c",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Continuation{
+				Version: ContinuationVersion,
+				Path:    tc.path,
+				Request: json.RawMessage(tc.request),
+				Output:  tc.output,
+			}
+
+			body, err := c.ResumeBody()
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.JSONEq(t, tc.wantBody, string(body))
+		})
+	}
+}
+
+func TestWorkerMigrate(t *testing.T) {
+	t.Run("ok, migrate more than once", func(t *testing.T) {
+		w := &Worker{migrate: make(chan struct{})}
+		w.Migrate()
+		w.Migrate()
+		require.True(t, migrationRequested(w.migrate))
+	})
+
+	t.Run("ok, worker without migration support", func(*testing.T) {
+		(&Worker{}).Migrate()
+	})
+}
@@ -0,0 +1,138 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/openpcc/openpcc/otel/otelutil"
+)
+
+// DefaultMirrorTimeout is the default bound on the time a mirrored request may take.
+const DefaultMirrorTimeout = 30 * time.Second
+
+// MirrorConfig duplicates validated requests to a shadow LLM backend, so a new backend version can be
+// validated against the shape of production traffic. Mirrored requests never leave the node: the
+// shadow backend must be a loopback url disclosed in the evidence, its responses are read to the end
+// and discarded, and their usage is not billed.
+type MirrorConfig struct {
+	// BaseURL is the url of the shadow backend, see rcevidence.Mirror. Leave blank to disable mirroring.
+	BaseURL string `yaml:"base_url"`
+	// Timeout bounds a mirrored request, the worker waits for it after the client response is written.
+	// Leave 0 for DefaultMirrorTimeout.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c *MirrorConfig) Validate() error {
+	if c.BaseURL == "" {
+		return nil
+	}
+	if err := (rcevidence.Mirror{BaseURL: c.BaseURL}).Validate(); err != nil {
+		return err
+	}
+	if c.Timeout < 0 {
+		return errors.New("mirror timeout can't be negative")
+	}
+	return nil
+}
+
+// mirror sends copies of requests to the shadow backend in the background.
+type mirror struct {
+	client  *http.Client
+	baseURL *url.URL
+	timeout time.Duration
+	wg      sync.WaitGroup
+}
+
+// newMirror returns a mirror for cfg, or nil when mirroring is disabled.
+func newMirror(client *http.Client, cfg MirrorConfig) *mirror {
+	if cfg.BaseURL == "" {
+		return nil
+	}
+	// validated by MirrorConfig.Validate.
+	baseURL, err := url.Parse(cfg.BaseURL)
+	if err != nil {
+		return nil
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultMirrorTimeout
+	}
+	return &mirror{
+		client:  client,
+		baseURL: baseURL,
+		timeout: timeout,
+	}
+}
+
+// send mirrors a request with the given method, path, headers and body. Failures only affect the
+// mirrored request and are logged, they never fail the client request.
+func (m *mirror) send(ctx context.Context, method, path string, header http.Header, body []byte) {
+	endpointURL := *m.baseURL
+	endpointURL.Path = path
+
+	// the mirrored request outlives the client request, but not the worker.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), m.timeout)
+	req, err := http.NewRequestWithContext(ctx, method, endpointURL.String(), bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		slog.WarnContext(ctx, "Failed to create mirrored request", "error", err)
+		return
+	}
+	req.Header = header.Clone()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+
+		ctx, span := otelutil.Tracer.Start(ctx, "computeworker.mirror.send")
+		defer span.End()
+
+		resp, err := m.client.Do(req)
+		if err != nil {
+			slog.WarnContext(ctx, "Mirrored request failed", "error", err)
+			span.AddEvent("mirror.failed")
+			return
+		}
+		defer resp.Body.Close()
+
+		// read the response to the end, so the shadow backend does the same work as the production one.
+		n, err := io.Copy(io.Discard, resp.Body)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to read mirrored response", "error", err, "status", resp.StatusCode)
+			span.AddEvent("mirror.aborted")
+			return
+		}
+		slog.DebugContext(ctx, "Mirrored request done", "status", resp.StatusCode, "bytes", n)
+	}()
+}
+
+// wait blocks until the mirrored requests are done.
+func (m *mirror) wait() {
+	m.wg.Wait()
+}
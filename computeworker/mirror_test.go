@@ -0,0 +1,124 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirrorConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		cfg     MirrorConfig
+		wantErr bool
+	}{
+		"ok, disabled":             {cfg: MirrorConfig{}},
+		"ok, default timeout":      {cfg: MirrorConfig{BaseURL: "http://localhost:8001"}},
+		"ok, timeout":              {cfg: MirrorConfig{BaseURL: "http://localhost:8001", Timeout: time.Minute}},
+		"fail, relative url":       {cfg: MirrorConfig{BaseURL: "localhost:8001/v1"}, wantErr: true},
+		"fail, negative timeout":   {cfg: MirrorConfig{BaseURL: "http://localhost:8001", Timeout: -time.Second}, wantErr: true},
+		"fail, url without a host": {cfg: MirrorConfig{BaseURL: "http://"}, wantErr: true},
+		"fail, remote host":        {cfg: MirrorConfig{BaseURL: "https://shadow.example.com"}, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestMirror(t *testing.T) {
+	t.Run("ok, disabled", func(t *testing.T) {
+		require.Nil(t, newMirror(http.DefaultClient, MirrorConfig{}))
+	})
+
+	t.Run("ok, request is duplicated and response discarded", func(t *testing.T) {
+		var (
+			mu     sync.Mutex
+			path   string
+			header http.Header
+			body   []byte
+		)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			path = r.URL.Path
+			header = r.Header.Clone()
+			body, _ = io.ReadAll(r.Body)
+			_, _ = w.Write([]byte(`{"done":true}`))
+		}))
+		defer srv.Close()
+
+		m := newMirror(srv.Client(), MirrorConfig{BaseURL: srv.URL})
+		require.NotNil(t, m)
+
+		m.send(t.Context(), http.MethodPost, "/v1/chat/completions", http.Header{"Content-Type": []string{"application/json"}}, []byte(`{"model":"llama3.2:1b"}`))
+		m.wait()
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, "/v1/chat/completions", path)
+		require.Equal(t, "application/json", header.Get("Content-Type"))
+		require.JSONEq(t, `{"model":"llama3.2:1b"}`, string(body))
+	})
+
+	t.Run("ok, failing shadow backend is ignored", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		srv.Close()
+
+		m := newMirror(http.DefaultClient, MirrorConfig{BaseURL: srv.URL, Timeout: time.Second})
+		m.send(t.Context(), http.MethodPost, "/api/generate", http.Header{}, nil)
+		m.wait()
+	})
+
+	t.Run("ok, outlives the client request", func(t *testing.T) {
+		done := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			defer close(done)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer srv.Close()
+
+		ctx, cancel := context.WithCancel(t.Context())
+		m := newMirror(srv.Client(), MirrorConfig{BaseURL: srv.URL})
+		m.send(ctx, http.MethodPost, "/api/generate", http.Header{}, nil)
+		cancel()
+		m.wait()
+
+		select {
+		case <-done:
+		default:
+			t.Fatal("mirrored request was canceled with the client request")
+		}
+	})
+}
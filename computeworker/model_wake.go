@@ -0,0 +1,34 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeworker
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/confidentsecurity/confidentcompute/modelwake"
+)
+
+// wakeModel wakes the model of the validated request r up, in case compute_boot put it to sleep.
+// Only the worker sees the model, so the model waker of router_com is asked for every request.
+func (s *Worker) wakeModel(ctx context.Context, r *http.Request) error {
+	model := r.Header.Get(requestedModelHeader)
+	if s.config.ModelWakeSocket == "" || model == "" {
+		return nil
+	}
+	return modelwake.Wake(ctx, s.config.ModelWakeSocket, model)
+}
@@ -0,0 +1,111 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// NormalizeRequest canonicalizes the headers of a decapsulated request so that the
+// validators and the LLM backend see the same request.
+//
+// Decapsulated requests are not parsed by net/http, so header names can arrive in any
+// casing. A "transfer-encoding" header would otherwise slip past lookups for
+// "Transfer-Encoding" and reach the backend, which is exactly the kind of ambiguity
+// request smuggling relies on. NormalizeRequest:
+//   - rejects header names that are not valid tokens,
+//   - merges headers that only differ in casing under their canonical name,
+//   - replaces obs-fold line continuations in values with a single space and
+//     rejects any other control characters,
+//   - rejects duplicate or invalid Content-Length headers.
+//
+// Errors are ValidationErrors.
+func NormalizeRequest(r *http.Request) error {
+	header := make(http.Header, len(r.Header))
+	for name, values := range r.Header {
+		if !validHeaderName(name) {
+			return newValidationError(ErrMalformedHeader, "invalid header name")
+		}
+
+		key := http.CanonicalHeaderKey(name)
+		for _, value := range values {
+			value, ok := normalizeHeaderValue(value)
+			if !ok {
+				return newValidationError(ErrMalformedHeader, "invalid header value: "+key)
+			}
+			header[key] = append(header[key], value)
+		}
+	}
+
+	if values, ok := header["Content-Length"]; ok {
+		if len(values) != 1 {
+			return newValidationError(ErrDuplicateContentLength, "multiple content-length headers")
+		}
+		if _, err := strconv.ParseUint(values[0], 10, 63); err != nil {
+			return newValidationError(ErrMalformedHeader, "invalid content-length header")
+		}
+	}
+
+	r.Header = header
+	return nil
+}
+
+// validHeaderName reports whether name is a token as defined by RFC 9110.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := range len(name) {
+		c := name[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeHeaderValue unfolds obs-fold continuations (CRLF followed by spaces or tabs)
+// into a single space and trims surrounding whitespace. Values containing any other
+// control characters are rejected.
+func normalizeHeaderValue(value string) (string, bool) {
+	var b strings.Builder
+	b.Grow(len(value))
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\r' && i+2 < len(value) && value[i+1] == '\n' && (value[i+2] == ' ' || value[i+2] == '\t'):
+			i += 2
+			for i+1 < len(value) && (value[i+1] == ' ' || value[i+1] == '\t') {
+				i++
+			}
+			b.WriteByte(' ')
+		case c == '\t':
+			b.WriteByte(c)
+		case c < ' ' || c == 0x7f:
+			return "", false
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return strings.Trim(b.String(), " \t"), true
+}
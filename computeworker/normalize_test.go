@@ -0,0 +1,162 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     http.Header
+		wantHeader http.Header
+		wantErr    bool
+		wantCode   ValidationErrorCode
+	}{
+		{
+			name: "ok, canonical headers are unchanged",
+			header: http.Header{
+				"Content-Type":   {"application/json"},
+				"Content-Length": {"18"},
+			},
+			wantHeader: http.Header{
+				"Content-Type":   {"application/json"},
+				"Content-Length": {"18"},
+			},
+		},
+		{
+			name: "ok, header casing is canonicalized",
+			header: http.Header{
+				"transfer-encoding": {"chunked"},
+				"X-CONFSEC-BADGE":   {"badge"},
+			},
+			wantHeader: http.Header{
+				"Transfer-Encoding": {"chunked"},
+				"X-Confsec-Badge":   {"badge"},
+			},
+		},
+		{
+			name: "ok, headers differing in casing are merged",
+			header: http.Header{
+				"Accept": {"text/plain"},
+				"accept": {"application/json"},
+			},
+			wantHeader: http.Header{
+				"Accept": {"application/json", "text/plain"},
+			},
+		},
+		{
+			name: "ok, obs-fold is replaced by a single space",
+			header: http.Header{
+				"User-Agent": {"client/1.0\r\n \t (linux)"},
+			},
+			wantHeader: http.Header{
+				"User-Agent": {"client/1.0 (linux)"},
+			},
+		},
+		{
+			name: "fail, duplicate content-length",
+			header: http.Header{
+				"Content-Length": {"18", "18"},
+			},
+			wantErr:  true,
+			wantCode: ErrDuplicateContentLength,
+		},
+		{
+			name: "fail, duplicate content-length in different casing",
+			header: http.Header{
+				"Content-Length": {"18"},
+				"content-length": {"0"},
+			},
+			wantErr:  true,
+			wantCode: ErrDuplicateContentLength,
+		},
+		{
+			name: "fail, invalid content-length",
+			header: http.Header{
+				"Content-Length": {"18, 18"},
+			},
+			wantErr:  true,
+			wantCode: ErrMalformedHeader,
+		},
+		{
+			name: "fail, invalid header name",
+			header: http.Header{
+				"Content-Length ": {"18"},
+			},
+			wantErr:  true,
+			wantCode: ErrMalformedHeader,
+		},
+		{
+			name: "fail, bare line feed in value",
+			header: http.Header{
+				"X-Forwarded-For": {"1.2.3.4\nContent-Length: 0"},
+			},
+			wantErr:  true,
+			wantCode: ErrMalformedHeader,
+		},
+		{
+			name: "fail, crlf without continuation",
+			header: http.Header{
+				"X-Forwarded-For": {"1.2.3.4\r\nContent-Length: 0"},
+			},
+			wantErr:  true,
+			wantCode: ErrMalformedHeader,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "http://localhost/api/chat", nil)
+			require.NoError(t, err)
+			req.Header = tc.header
+
+			err = NormalizeRequest(req)
+			assertError(t, err, tc.wantErr, tc.wantCode)
+			if tc.wantErr {
+				return
+			}
+
+			for key := range tc.wantHeader {
+				require.ElementsMatch(t, tc.wantHeader[key], req.Header[key])
+			}
+			require.Len(t, req.Header, len(tc.wantHeader))
+		})
+	}
+}
+
+func FuzzNormalizeRequest(f *testing.F) {
+	seeds := []string{
+		"POST /api/chat\r\nContent-Type: application/json\r\nContent-Length: 2\r\n\r\n{}",
+		"POST /api/chat\r\ntransfer-encoding: chunked\r\nContent-Length: 2\r\n\r\n{}",
+		"POST /api/chat\r\nContent-Length: 2\r\ncontent-length: 40\r\n\r\n{}",
+		"POST /api/chat\r\nX-Folded: a\r\n b\r\n\tc\r\n\r\n{}",
+		"POST /v1/chat/completions\r\nContent-Type: application/json\r\nX-Confsec-Badge: x\r\n\r\n{\"model\":\"llama3.2:1b\"}",
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(_ *testing.T, data []byte) {
+		FuzzNormalize(data)
+	})
+}
@@ -0,0 +1,116 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// maxFormatSize is the maximum size in bytes of the "format" of a chat request.
+	maxFormatSize = 16 * 1024
+	// maxFormatDepth is the maximum nesting of objects and arrays in a "format" schema.
+	maxFormatDepth = 16
+	// maxFormatKeys is the maximum number of object keys in a "format" schema, counted across all objects.
+	maxFormatKeys = 512
+)
+
+// validateOllamaFormat validates the "format" of an Ollama chat request. It's either the string
+// "json" or a JSON schema object. Schemas are compiled into a grammar by the backend, so
+// pathological schemas are rejected before they can take up backend CPU.
+func validateOllamaFormat(format json.RawMessage) error {
+	format = bytes.TrimSpace(format)
+	if len(format) == 0 || bytes.Equal(format, []byte("null")) {
+		return nil
+	}
+
+	if len(format) > maxFormatSize {
+		return newValidationError(ErrInvalidFormat, fmt.Sprintf("format exceeds max size of %d bytes", maxFormatSize))
+	}
+
+	switch format[0] {
+	case '"':
+		var s string
+		if err := json.Unmarshal(format, &s); err != nil {
+			return newValidationError(ErrInvalidFormat, "invalid format: "+err.Error())
+		}
+		if s != "json" {
+			return newValidationError(ErrInvalidFormat, `format must be "json" or a JSON schema object`)
+		}
+		return nil
+	case '{':
+		return validateFormatSchema(format)
+	default:
+		return newValidationError(ErrInvalidFormat, `format must be "json" or a JSON schema object`)
+	}
+}
+
+// validateFormatSchema walks the tokens of the schema, checking the depth and number of keys
+// without decoding the schema into memory.
+func validateFormatSchema(schema json.RawMessage) error {
+	type container struct {
+		object bool
+		// key is true when the next token in an object is a key.
+		key bool
+	}
+
+	var (
+		stack []container
+		keys  int
+	)
+	dec := json.NewDecoder(bytes.NewReader(schema))
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return newValidationError(ErrInvalidFormat, "invalid format: "+err.Error())
+		}
+
+		if len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			if top.object && top.key {
+				if _, ok := tok.(json.Delim); !ok {
+					keys++
+					if keys > maxFormatKeys {
+						return newValidationError(ErrInvalidFormat, fmt.Sprintf("format schema exceeds max number of keys of %d", maxFormatKeys))
+					}
+					top.key = false
+					continue
+				}
+			}
+			// the next token after this value is a key again.
+			top.key = top.object
+		}
+
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			stack = append(stack, container{object: tok == json.Delim('{'), key: true})
+			if len(stack) > maxFormatDepth {
+				return newValidationError(ErrInvalidFormat, fmt.Sprintf("format schema exceeds max depth of %d", maxFormatDepth))
+			}
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateOllamaFormat(t *testing.T) {
+	manyKeys := func(n int) string {
+		props := make([]string, 0, n)
+		for i := range n {
+			props = append(props, fmt.Sprintf(`"p%d":{}`, i))
+		}
+		return `{"type":"object","properties":{` + strings.Join(props, ",") + `}}`
+	}
+
+	tests := []struct {
+		name    string
+		format  string
+		wantErr bool
+	}{
+		{name: "ok, empty", format: ""},
+		{name: "ok, null", format: "null"},
+		{name: "ok, json string", format: `"json"`},
+		{name: "ok, schema", format: `{"type":"object","properties":{"age":{"type":"integer"}},"required":["age"]}`},
+		{name: "ok, schema at max depth", format: strings.Repeat(`{"a":`, maxFormatDepth-1) + `{}` + strings.Repeat(`}`, maxFormatDepth-1)},
+		// two keys for the outer object plus one for each property.
+		{name: "ok, schema at max keys", format: manyKeys(maxFormatKeys - 2)},
+		{name: "ok, arrays of objects", format: `{"anyOf":[{"type":"string"},{"type":"integer"}]}`},
+		{name: "fail, other string", format: `"yaml"`, wantErr: true},
+		{name: "fail, array", format: `["json"]`, wantErr: true},
+		{name: "fail, number", format: `1`, wantErr: true},
+		{name: "fail, schema too deep", format: strings.Repeat(`{"a":`, maxFormatDepth) + `{}` + strings.Repeat(`}`, maxFormatDepth), wantErr: true},
+		{name: "fail, arrays too deep", format: `{"a":` + strings.Repeat(`[`, maxFormatDepth) + strings.Repeat(`]`, maxFormatDepth) + `}`, wantErr: true},
+		{name: "fail, too many keys", format: manyKeys(maxFormatKeys - 1), wantErr: true},
+		{name: "fail, too large", format: `{"description":"` + strings.Repeat("a", maxFormatSize) + `"}`, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateOllamaFormat(json.RawMessage(tc.format))
+			if !tc.wantErr {
+				require.NoError(t, err)
+				return
+			}
+
+			var validationErr ValidationError
+			require.True(t, errors.As(err, &validationErr))
+			require.Equal(t, ErrInvalidFormat, validationErr.Code)
+		})
+	}
+}
@@ -18,27 +18,64 @@
 package output
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
+	"time"
 
-	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/confidentsecurity/confidentcompute/computeworker/output/wire"
 )
 
-const maxBufferLen = 32 * 1024 // 32kb
+const maxBufferLen = wire.MaxChunkLen
+
+// ProgressFunc is called after every chunk WriteTo and WriteToContext wrote, with the number of
+// chunks and bytes written so far.
+type ProgressFunc func(chunks int, written int64)
+
+// deadlineReader is implemented by readers that support read deadlines, like pipes and connections.
+type deadlineReader interface {
+	SetReadDeadline(t time.Time) error
+}
 
 type Decoder struct {
-	r      quicvarint.Reader
-	buf    []byte
+	src    io.Reader
+	frames *wire.Reader
 	header Header
 	footer *Footer
+	// rawHeader and rawFooter are the data of the header and footer chunks, see Transcript.
+	rawHeader []byte
+	rawFooter []byte
+
+	progress    ProgressFunc
+	readTimeout time.Duration
 }
 
+// NewDecoder creates a decoder for output encoded without a MAC key.
 func NewDecoder(r io.Reader) (*Decoder, error) {
-	quicReader := quicvarint.NewReader(r)
+	return NewDecoderWithKey(r, nil)
+}
+
+// NewDecoderWithKey creates a decoder that verifies the transcript with key. Chunks that are
+// reordered, duplicated, dropped or modified result in an error.
+func NewDecoderWithKey(r io.Reader, key []byte) (*Decoder, error) {
+	return newDecoder(r, wire.NewReader(r, key))
+}
+
+// NewForwardingDecoder creates a decoder for output whose MAC key is exported from the HPKE context
+// of the request, which only the worker and the client have. Chunks that are reordered, duplicated
+// or dropped result in an error, the client verifies the tags with Transcript.
+func NewForwardingDecoder(r io.Reader) (*Decoder, error) {
+	return newDecoder(r, wire.NewForwardingReader(r))
+}
+
+func newDecoder(r io.Reader, frames *wire.Reader) (*Decoder, error) {
 	dec := &Decoder{
-		r:   quicReader,
-		buf: nil,
+		src:    r,
+		frames: frames,
 	}
 
 	err := dec.readHeader()
@@ -49,6 +86,17 @@ func NewDecoder(r io.Reader) (*Decoder, error) {
 	return dec, nil
 }
 
+// SetProgress sets the func that is called after every written chunk, nil disables progress reporting.
+func (d *Decoder) SetProgress(fn ProgressFunc) {
+	d.progress = fn
+}
+
+// SetReadTimeout limits how long WriteTo and WriteToContext wait for the next chunk. It only applies
+// when the underlying reader supports read deadlines, 0 waits indefinitely.
+func (d *Decoder) SetReadTimeout(timeout time.Duration) {
+	d.readTimeout = timeout
+}
+
 func (d *Decoder) Header() Header {
 	return d.header
 }
@@ -60,38 +108,27 @@ func (d *Decoder) Footer() (Footer, bool) {
 	return *d.footer, true
 }
 
-func (d *Decoder) readChunk() error {
-	chunkLen, err := quicvarint.Read(d.r)
-	if err != nil {
-		return fmt.Errorf("failed to decode length: %w", err)
-	}
-	// prevent excessive buffer allocations in case something goes wrong.
-	if chunkLen > maxBufferLen {
-		return fmt.Errorf("received length %d over max buffer len %d", chunkLen, maxBufferLen)
-	}
-
-	if uint64(cap(d.buf)) < chunkLen {
-		d.buf = make([]byte, chunkLen)
-	}
-
-	// resize buffer to fit header data.
-	d.buf = d.buf[:chunkLen]
-
-	_, err = io.ReadFull(d.r, d.buf)
-	if err != nil {
-		return fmt.Errorf("failed to read header chunk: %w", err)
+// Transcript returns what the client needs besides the response body to verify the output with
+// wire.VerifyTranscript: the data of the header and footer chunks and the tag of the footer. ok is
+// false until the footer was read.
+func (d *Decoder) Transcript() (header, footer, tag []byte, ok bool) {
+	if d.footer == nil {
+		return nil, nil, nil, false
 	}
-
-	return nil
+	return d.rawHeader, d.rawFooter, d.frames.Tag(), true
 }
 
 func (d *Decoder) readHeader() error {
-	err := d.readChunk()
+	frame, err := d.frames.Next()
 	if err != nil {
 		return err
 	}
+	if frame.Footer {
+		return errors.New("expected header, got footer")
+	}
 
-	err = d.header.UnmarshalBinary(d.buf)
+	d.rawHeader = bytes.Clone(frame.Data)
+	err = d.header.UnmarshalBinary(frame.Data)
 	if err != nil {
 		return fmt.Errorf("failed to unmarshal header: %w", err)
 	}
@@ -99,49 +136,105 @@ func (d *Decoder) readHeader() error {
 	return nil
 }
 
-func (d *Decoder) readFooter() error {
-	err := d.readChunk()
-	if err != nil {
-		return err
-	}
-
-	d.footer = &Footer{}
-	err = d.footer.UnmarshalBinary(d.buf)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal footer: %w", err)
-	}
-
-	return nil
+// WriteTo writes the chunks to w until the footer, see WriteToContext.
+func (d *Decoder) WriteTo(w io.Writer) (int64, error) {
+	return d.WriteToContext(context.Background(), w)
 }
 
-func (d *Decoder) WriteTo(w io.Writer) (int64, error) {
+// WriteToContext writes the chunks to w until the footer. It stops with the context error once ctx is
+// done. A read that is blocked on the next chunk is interrupted when the underlying reader supports
+// read deadlines, otherwise the context is only checked between chunks. An interrupted read can leave
+// a chunk partially read, the decoder can't be used after WriteToContext returned a context error.
+func (d *Decoder) WriteToContext(ctx context.Context, w io.Writer) (int64, error) {
 	flusher, isFlusher := w.(http.Flusher)
 
+	setDeadline, stop := d.watchDeadline(ctx)
+	defer stop()
+
 	written := int64(0)
+	chunks := 0
 	for {
-		err := d.readChunk()
-		if err != nil {
+		if err := ctx.Err(); err != nil {
 			return written, err
 		}
+		if d.readTimeout > 0 {
+			setDeadline(time.Now().Add(d.readTimeout))
+		}
 
-		// zero chunk length indicates the footer.
-		if len(d.buf) == 0 {
-			err = d.readFooter()
+		frame, err := d.frames.Next()
+		if err != nil {
+			return written, d.readErr(ctx, err)
+		}
+
+		if frame.Footer {
+			d.rawFooter = bytes.Clone(frame.Data)
+			d.footer = &Footer{}
+			err = d.footer.UnmarshalBinary(frame.Data)
 			if err != nil {
-				return written, fmt.Errorf("failed to decode footer: %w", err)
+				return written, fmt.Errorf("failed to decode footer: failed to unmarshal footer: %w", err)
 			}
 			return written, nil
 		}
 
-		// d.buf now contains the chunk data.
-		n, err := w.Write(d.buf)
+		// frame.Data is the verified chunk data.
+		n, err := w.Write(frame.Data)
 		if err != nil {
 			return written, fmt.Errorf("failed to write chunk: %w", err)
 		}
 		written += int64(n)
+		chunks++
 
 		if isFlusher {
 			flusher.Flush()
 		}
+		if d.progress != nil {
+			d.progress(chunks, written)
+		}
+	}
+}
+
+// watchDeadline interrupts blocked reads once ctx is done, when the underlying reader supports read
+// deadlines. setDeadline sets the read deadline unless ctx is done, stop clears the deadline.
+func (d *Decoder) watchDeadline(ctx context.Context) (func(time.Time), func()) {
+	dr, ok := d.src.(deadlineReader)
+	if !ok {
+		return func(time.Time) {}, func() {}
+	}
+
+	var (
+		mu   sync.Mutex
+		done bool
+	)
+	setDeadline := func(t time.Time) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !done {
+			_ = dr.SetReadDeadline(t)
+		}
+	}
+	stopWatch := context.AfterFunc(ctx, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		done = true
+		_ = dr.SetReadDeadline(time.Now())
+	})
+
+	stop := func() {
+		stopWatch()
+		mu.Lock()
+		defer mu.Unlock()
+		// later reads, like draining the rest of the output, must not hit a stale deadline.
+		if done || d.readTimeout > 0 {
+			_ = dr.SetReadDeadline(time.Time{})
+		}
+	}
+	return setDeadline, stop
+}
+
+// readErr returns the context error for reads that were interrupted because ctx is done.
+func (*Decoder) readErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
 	}
+	return err
 }
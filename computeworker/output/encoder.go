@@ -18,31 +18,49 @@
 package output
 
 import (
+	"errors"
 	"fmt"
 	"io"
 
-	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/confidentsecurity/confidentcompute/computeworker/output/wire"
 )
 
 // Encoder encodes chunks of data sandwiched between a header and a footer.
 // - Header and footer are unencrypted and intended to be used by routercom.
 // - The header chunk is the 0th chunk.
-// - Each non-footer chunk is prefixed with a quicencoded integer indicating it's length.
-// - The footer chunk is indicated with a zero length, followed by its actual length.
+// - Each non-footer chunk is prefixed with a quicencoded integer indicating it's length,
+// followed by a quicencoded sequence number.
+// - The footer chunk is indicated with a zero length, followed by its actual length and sequence number.
+// - Each chunk, including the header and footer, is followed by a tag of the running transcript MAC.
 type Encoder struct {
-	header Header
-	w      io.Writer
+	header     Header
+	w          io.Writer
+	transcript *wire.Transcript
+	// partial is true while a chunk is written, it stays true when the write failed or panicked.
+	partial bool
 }
 
+// ErrPartialChunk is returned by Close when the last chunk wasn't written completely, a footer
+// after it would corrupt the output.
+var ErrPartialChunk = errors.New("output ends in a partial chunk")
+
+// NewEncoder creates an encoder without a MAC key, the transcript is a plain hash chain.
 func NewEncoder(h Header, w io.Writer) (*Encoder, error) {
+	return NewEncoderWithKey(h, w, nil)
+}
+
+// NewEncoderWithKey creates an encoder that authenticates the transcript with key. The
+// decoder needs to use the same key.
+func NewEncoderWithKey(h Header, w io.Writer, key []byte) (*Encoder, error) {
 	b, err := h.MarshalBinary()
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal header to binary: %w", err)
 	}
 
 	enc := &Encoder{
-		header: h,
-		w:      w,
+		header:     h,
+		w:          w,
+		transcript: wire.NewTranscript(key),
 	}
 
 	// write the header as a length prefixed chunk.
@@ -59,17 +77,27 @@ func (e *Encoder) Write(b []byte) (int, error) {
 	for len(b) > 0 {
 		chunkLen := min(len(b), maxBufferLen)
 
-		lenBytes := quicvarint.Append(nil, uint64(chunkLen)) // #nosec G115 -- len and maxbuffer are always non-negative
-		_, err := e.w.Write(lenBytes)
-
+		e.partial = true
+		prefix := wire.AppendVarint(nil, uint64(chunkLen)) // #nosec G115 -- len and maxbuffer are always non-negative
+		prefix = wire.AppendVarint(prefix, e.transcript.Seq())
+		_, err := e.w.Write(prefix)
 		if err != nil {
 			return written, fmt.Errorf("failed to write chunk length: %w", err)
 		}
 
+		tag := e.transcript.Next(wire.ChunkKindData, b[:chunkLen])
+
 		n, err := e.w.Write(b[:chunkLen])
 		if err != nil {
 			return written, err
 		}
+
+		_, err = e.w.Write(tag)
+		if err != nil {
+			return written, fmt.Errorf("failed to write chunk tag: %w", err)
+		}
+		e.partial = false
+
 		written += n
 		b = b[n:]
 	}
@@ -78,30 +106,44 @@ func (e *Encoder) Write(b []byte) (int, error) {
 }
 
 func (e *Encoder) Close(f Footer) error {
+	if e.partial {
+		return ErrPartialChunk
+	}
+
 	b, err := f.MarshalBinary()
 	if err != nil {
 		return fmt.Errorf("failed to marshal footer to binary: %w", err)
 	}
 
+	e.partial = true
 	// write zero length to indicate this is a footer chunk.
-	footerBytes := quicvarint.Append(nil, 0)
+	footerBytes := wire.AppendVarint(nil, 0)
 	_, err = e.w.Write(footerBytes)
 	if err != nil {
 		return fmt.Errorf("failed to encode zero length indicating footer chunk: %w", err)
 	}
 
-	// write the actual footer chunk length.
-	lengthBytes := quicvarint.Append(nil, uint64(len(b)))
-	_, err = e.w.Write(lengthBytes)
+	// write the actual footer chunk length and sequence number.
+	prefix := wire.AppendVarint(nil, uint64(len(b)))
+	prefix = wire.AppendVarint(prefix, e.transcript.Seq())
+	_, err = e.w.Write(prefix)
 	if err != nil {
 		return fmt.Errorf("failed to write length of the footer chunk: %w", err)
 	}
 
+	tag := e.transcript.Next(wire.ChunkKindFooter, b)
+
 	// write the footer chunk data.
 	_, err = e.w.Write(b)
 	if err != nil {
 		return fmt.Errorf("failed to write footer payload: %w", err)
 	}
 
+	// the footer tag covers the entire stream, a missing or invalid tag means the stream was tampered with.
+	_, err = e.w.Write(tag)
+	if err != nil {
+		return fmt.Errorf("failed to write footer tag: %w", err)
+	}
+
 	return nil
 }
@@ -20,6 +20,7 @@ package output
 import (
 	"fmt"
 
+	"github.com/confidentsecurity/confidentcompute/computeworker/output/wire"
 	"github.com/openpcc/openpcc/anonpay/currency"
 	pb "github.com/openpcc/openpcc/gen/protos/computeworker"
 	"google.golang.org/protobuf/proto"
@@ -28,6 +29,33 @@ import (
 type Footer struct {
 	// Refund is the refund for this request. Note: a nil refund indicates no refund.
 	Refund *currency.Value
+	// Aborted indicates the LLM failed mid-stream and the response is incomplete. The refund
+	// then covers everything but the delivered output tokens.
+	Aborted bool
+	// Migrated indicates the response was ended early so the client can resume it on another
+	// node. Like for aborted responses, the refund covers everything but the delivered output tokens.
+	Migrated bool
+	// ResumableAt is the number of output tokens delivered before a migration.
+	ResumableAt uint64
+	// SessionHint is the opaque hint the client sends back with the next turn of the conversation,
+	// so it is routed to the same backend instance. Empty when session hints are disabled.
+	SessionHint string
+	// ErrorDetail indicates the worker failed to handle the request and the encrypted response
+	// describes the failure to the client instead. The detail itself never leaves the ciphertext.
+	ErrorDetail bool
+	// Model is the model the backend reported serving the response, so clients can check they got
+	// the model they paid for. Empty when the backend reported none.
+	Model string
+	// RefundSignature is the signature of the refund by the refund key of the node, see
+	// computeworker.RefundStatement. Empty when refunds are not signed.
+	RefundSignature []byte
+	// RefundUnsigned indicates the node signs refunds but failed to sign this one. The refund is sent
+	// without a signature instead of charging the request in full, the router decides whether to trust it.
+	RefundUnsigned bool
+	// Continuations are the continuation tokens of the tool calls of the response, see
+	// computeworker.ContinuationHeader. Empty when the response has no tool calls or continuations
+	// are disabled.
+	Continuations []string
 }
 
 func (f Footer) HasRefund() bool {
@@ -50,6 +78,10 @@ func (f Footer) MarshalBinary() ([]byte, error) {
 		return nil, fmt.Errorf("failed to marshal output footer to binary: %w", err)
 	}
 
+	// the fields that are not part of the OutputFooter message are appended by the wire package, so
+	// clients that decode with it read the same fields.
+	b = f.extensions().AppendExtensions(b)
+
 	return b, nil
 }
 
@@ -70,5 +102,34 @@ func (f *Footer) UnmarshalBinary(b []byte) error {
 		f.Refund = refund
 	}
 
+	ext, err := wire.ParseFooter(pbf.ProtoReflect().GetUnknown())
+	if err != nil {
+		return err
+	}
+	f.Aborted = ext.Aborted
+	f.Migrated = ext.Migrated
+	f.ResumableAt = ext.ResumableAt
+	f.SessionHint = ext.SessionHint
+	f.ErrorDetail = ext.ErrorDetail
+	f.Model = ext.Model
+	f.RefundSignature = ext.RefundSignature
+	f.RefundUnsigned = ext.RefundUnsigned
+	f.Continuations = ext.Continuations
+
 	return nil
 }
+
+// extensions returns the fields of the footer that are not part of the OutputFooter message.
+func (f Footer) extensions() wire.Footer {
+	return wire.Footer{
+		Aborted:         f.Aborted,
+		Migrated:        f.Migrated,
+		ResumableAt:     f.ResumableAt,
+		SessionHint:     f.SessionHint,
+		ErrorDetail:     f.ErrorDetail,
+		Model:           f.Model,
+		RefundSignature: f.RefundSignature,
+		RefundUnsigned:  f.RefundUnsigned,
+		Continuations:   f.Continuations,
+	}
+}
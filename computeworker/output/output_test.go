@@ -0,0 +1,349 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker/output"
+	"github.com/confidentsecurity/confidentcompute/computeworker/output/wire"
+	"github.com/openpcc/openpcc/anonpay/currency"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEncoderDecoderTranscript(t *testing.T) {
+	key := bytes.Repeat([]byte{0x01}, 32)
+	header := output.Header{MediaType: "application/octet-stream", MaxChunkLen: 8}
+
+	// encode writes a header, the chunks and a footer and returns the raw output.
+	encode := func(t *testing.T, key []byte, chunks ...string) []byte {
+		buf := &bytes.Buffer{}
+		enc, err := output.NewEncoderWithKey(header, buf, key)
+		require.NoError(t, err)
+		for _, chunk := range chunks {
+			_, err = enc.Write([]byte(chunk))
+			require.NoError(t, err)
+		}
+		require.NoError(t, enc.Close(output.Footer{}))
+		return buf.Bytes()
+	}
+
+	decode := func(key []byte, b []byte) (string, error) {
+		dec, err := output.NewDecoderWithKey(bytes.NewReader(b), key)
+		if err != nil {
+			return "", err
+		}
+		out := &bytes.Buffer{}
+		_, err = dec.WriteTo(out)
+		return out.String(), err
+	}
+
+	// chunkLen is the length of a single encoded data chunk of 5 bytes.
+	const chunkLen = 1 + 1 + 5 + output.TagLen
+
+	t.Run("ok, roundtrip with key", func(t *testing.T) {
+		got, err := decode(key, encode(t, key, "hello", "world"))
+		require.NoError(t, err)
+		require.Equal(t, "helloworld", got)
+	})
+
+	t.Run("ok, roundtrip without key", func(t *testing.T) {
+		got, err := decode(nil, encode(t, nil, "hello", "world"))
+		require.NoError(t, err)
+		require.Equal(t, "helloworld", got)
+	})
+
+	t.Run("fail, key mismatch", func(t *testing.T) {
+		_, err := decode(bytes.Repeat([]byte{0x02}, 32), encode(t, key, "hello"))
+		require.ErrorIs(t, err, output.ErrChunkTagMismatch)
+	})
+
+	t.Run("fail, modified chunk", func(t *testing.T) {
+		b := encode(t, key, "hello", "world")
+		i := bytes.Index(b, []byte("world"))
+		b[i] = 'W'
+		_, err := decode(key, b)
+		require.ErrorIs(t, err, output.ErrChunkTagMismatch)
+	})
+
+	// the tests below operate on encoded data chunks, which directly follow the header chunk.
+	splitChunks := func(t *testing.T, b []byte, n int) ([]byte, [][]byte, []byte) {
+		first := bytes.Index(b, []byte("aaaaa"))
+		require.Positive(t, first)
+		start := first - 2 // length and sequence number prefix.
+		chunks := make([][]byte, n)
+		for i := range n {
+			chunks[i] = b[start+i*chunkLen : start+(i+1)*chunkLen]
+		}
+		return b[:start], chunks, b[start+n*chunkLen:]
+	}
+
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+
+	t.Run("fail, reordered chunks", func(t *testing.T) {
+		head, chunks, tail := splitChunks(t, encode(t, key, "aaaaa", "bbbbb"), 2)
+		_, err := decode(key, join(head, chunks[1], chunks[0], tail))
+		require.ErrorIs(t, err, output.ErrChunkOutOfOrder)
+	})
+
+	t.Run("fail, duplicated chunk", func(t *testing.T) {
+		head, chunks, tail := splitChunks(t, encode(t, key, "aaaaa", "bbbbb"), 2)
+		_, err := decode(key, join(head, chunks[0], chunks[0], chunks[1], tail))
+		require.ErrorIs(t, err, output.ErrChunkOutOfOrder)
+	})
+
+	t.Run("fail, dropped chunk", func(t *testing.T) {
+		head, chunks, tail := splitChunks(t, encode(t, key, "aaaaa", "bbbbb"), 2)
+		_, err := decode(key, join(head, chunks[1], tail))
+		require.ErrorIs(t, err, output.ErrChunkOutOfOrder)
+	})
+
+	t.Run("fail, dropped footer tag", func(t *testing.T) {
+		b := encode(t, key, "hello")
+		_, err := decode(key, b[:len(b)-output.TagLen])
+		require.Error(t, err)
+	})
+
+	// forward decodes like router_com, without the key.
+	forward := func(b []byte) (*output.Decoder, string, error) {
+		dec, err := output.NewForwardingDecoder(bytes.NewReader(b))
+		if err != nil {
+			return nil, "", err
+		}
+		out := &bytes.Buffer{}
+		_, err = dec.WriteTo(out)
+		return dec, out.String(), err
+	}
+
+	t.Run("ok, client verifies the forwarded transcript", func(t *testing.T) {
+		dec, got, err := forward(encode(t, key, "hello", "world"))
+		require.NoError(t, err)
+		require.Equal(t, "helloworld", got)
+
+		rawHeader, rawFooter, tag, ok := dec.Transcript()
+		require.True(t, ok)
+		require.NoError(t, wire.VerifyTranscript(key, rawHeader, []byte(got), rawFooter, tag))
+		require.ErrorIs(t, wire.VerifyTranscript(bytes.Repeat([]byte{0x02}, 32), rawHeader, []byte(got), rawFooter, tag), wire.ErrChunkTagMismatch)
+		require.ErrorIs(t, wire.VerifyTranscript(key, rawHeader, []byte("world"), rawFooter, tag), wire.ErrChunkTagMismatch)
+	})
+
+	t.Run("fail, forwarding decoder detects reordered chunks", func(t *testing.T) {
+		head, chunks, tail := splitChunks(t, encode(t, key, "aaaaa", "bbbbb"), 2)
+		_, _, err := forward(join(head, chunks[1], chunks[0], tail))
+		require.ErrorIs(t, err, output.ErrChunkOutOfOrder)
+	})
+}
+
+func TestEncoderClosePartialChunk(t *testing.T) {
+	t.Run("ok, footer after complete chunks", func(t *testing.T) {
+		enc, err := output.NewEncoder(output.Header{}, io.Discard)
+		require.NoError(t, err)
+		_, err = enc.Write([]byte("data"))
+		require.NoError(t, err)
+		require.NoError(t, enc.Close(output.Footer{Aborted: true}))
+	})
+
+	t.Run("fail, footer after a partial chunk", func(t *testing.T) {
+		// the header chunk takes 3 writes, the data chunk fails after its prefix.
+		enc, err := output.NewEncoder(output.Header{}, &failingWriter{n: 4})
+		require.NoError(t, err)
+		_, err = enc.Write([]byte("data"))
+		require.Error(t, err)
+		require.ErrorIs(t, enc.Close(output.Footer{Aborted: true}), output.ErrPartialChunk)
+	})
+}
+
+// failingWriter fails all writes after the first n.
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, io.ErrClosedPipe
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestFooterAborted(t *testing.T) {
+	refund, err := currency.Exact(64)
+	require.NoError(t, err)
+
+	tests := map[string]output.Footer{
+		"ok, completed with refund":  {Refund: &refund},
+		"ok, aborted with refund":    {Refund: &refund, Aborted: true},
+		"ok, aborted without refund": {Aborted: true},
+		"ok, empty footer":           {},
+		"ok, migrated with refund":   {Refund: &refund, Migrated: true, ResumableAt: 42},
+		"ok, migrated before output": {Migrated: true},
+		"ok, completed with hint":    {Refund: &refund, SessionHint: "0123456789abcdef0123456789abcdef"},
+		"ok, migrated with hint":     {Migrated: true, ResumableAt: 7, SessionHint: "0123456789abcdef0123456789abcdef"},
+		"ok, error detail":           {Refund: &refund, ErrorDetail: true},
+		"ok, completed with model":   {Refund: &refund, Model: "llama3.2:1b", SessionHint: "0123456789abcdef0123456789abcdef"},
+		"ok, signed refund":          {Refund: &refund, RefundSignature: []byte{0x00, 0x14, 0x00, 0x0b}},
+		"ok, unsigned refund":        {Refund: &refund, Aborted: true, RefundUnsigned: true},
+		"ok, continuations":          {Refund: &refund, Continuations: []string{"first-token", "second-token"}},
+	}
+
+	for name, footer := range tests {
+		t.Run(name, func(t *testing.T) {
+			b, err := footer.MarshalBinary()
+			require.NoError(t, err)
+
+			got := output.Footer{}
+			require.NoError(t, got.UnmarshalBinary(b))
+			require.Equal(t, footer.Aborted, got.Aborted)
+			require.Equal(t, footer.Migrated, got.Migrated)
+			require.Equal(t, footer.ResumableAt, got.ResumableAt)
+			require.Equal(t, footer.SessionHint, got.SessionHint)
+			require.Equal(t, footer.ErrorDetail, got.ErrorDetail)
+			require.Equal(t, footer.Model, got.Model)
+			require.Equal(t, footer.RefundSignature, got.RefundSignature)
+			require.Equal(t, footer.RefundUnsigned, got.RefundUnsigned)
+			require.Equal(t, footer.Continuations, got.Continuations)
+			require.Equal(t, footer.HasRefund(), got.HasRefund())
+		})
+	}
+}
+
+func TestWireDecode(t *testing.T) {
+	key := bytes.Repeat([]byte{0x01}, 32)
+	header := output.Header{MediaType: "application/x-ndjson", MaxChunkLen: 8}
+	refund, err := currency.Exact(64)
+	require.NoError(t, err)
+	footer := output.Footer{Refund: &refund, Aborted: true, Model: "llama3.2:1b", RefundSignature: []byte{0x00, 0x14}}
+
+	buf := &bytes.Buffer{}
+	enc, err := output.NewEncoderWithKey(header, buf, key)
+	require.NoError(t, err)
+	_, err = enc.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, enc.Close(footer))
+
+	out := &bytes.Buffer{}
+	gotHeader, gotFooter, err := wire.Decode(buf, key, out)
+	require.NoError(t, err)
+	require.Equal(t, "hello", out.String())
+	require.Equal(t, wire.Header{MediaType: header.MediaType, MaxChunkLen: header.MaxChunkLen}, gotHeader)
+	require.True(t, gotFooter.Aborted)
+	require.Equal(t, footer.Model, gotFooter.Model)
+	require.Equal(t, footer.RefundSignature, gotFooter.RefundSignature)
+
+	// the refund is left encoded, it is the same refund the worker signs.
+	refundPB, err := refund.MarshalProto()
+	require.NoError(t, err)
+	want, err := proto.Marshal(refundPB)
+	require.NoError(t, err)
+	require.Equal(t, want, gotFooter.Refund)
+}
+
+func TestDecoderWriteToContext(t *testing.T) {
+	key := bytes.Repeat([]byte{0x01}, 32)
+	header := output.Header{MediaType: "application/octet-stream", MaxChunkLen: 8}
+
+	// newPipe writes the header and the chunks to a pipe without closing the output, so reading
+	// past the chunks blocks.
+	newPipe := func(t *testing.T, chunks ...string) *os.File {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = r.Close()
+			_ = w.Close()
+		})
+
+		enc, err := output.NewEncoderWithKey(header, w, key)
+		require.NoError(t, err)
+		for _, chunk := range chunks {
+			_, err = enc.Write([]byte(chunk))
+			require.NoError(t, err)
+		}
+		return r
+	}
+
+	t.Run("ok, progress is reported per chunk", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		enc, err := output.NewEncoderWithKey(header, buf, key)
+		require.NoError(t, err)
+		for _, chunk := range []string{"hello", "world"} {
+			_, err = enc.Write([]byte(chunk))
+			require.NoError(t, err)
+		}
+		require.NoError(t, enc.Close(output.Footer{}))
+
+		dec, err := output.NewDecoderWithKey(buf, key)
+		require.NoError(t, err)
+
+		var progress [][2]int64
+		dec.SetProgress(func(chunks int, written int64) {
+			progress = append(progress, [2]int64{int64(chunks), written})
+		})
+		n, err := dec.WriteToContext(context.Background(), io.Discard)
+		require.NoError(t, err)
+		require.Equal(t, int64(10), n)
+		require.Equal(t, [][2]int64{{1, 5}, {2, 10}}, progress)
+	})
+
+	t.Run("fail, cancelled while waiting for the next chunk", func(t *testing.T) {
+		dec, err := output.NewDecoderWithKey(newPipe(t, "hello"), key)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		// cancel once the first chunk was written, the next read blocks until it is interrupted.
+		dec.SetProgress(func(int, int64) {
+			cancel()
+		})
+
+		out := &bytes.Buffer{}
+		n, err := dec.WriteToContext(ctx, out)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Equal(t, int64(5), n)
+		require.Equal(t, "hello", out.String())
+	})
+
+	t.Run("fail, cancelled before the first chunk", func(t *testing.T) {
+		dec, err := output.NewDecoderWithKey(newPipe(t, "hello"), key)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		n, err := dec.WriteToContext(ctx, io.Discard)
+		require.ErrorIs(t, err, context.Canceled)
+		require.Zero(t, n)
+	})
+
+	t.Run("fail, read timeout", func(t *testing.T) {
+		dec, err := output.NewDecoderWithKey(newPipe(t, "hello"), key)
+		require.NoError(t, err)
+		dec.SetReadTimeout(10 * time.Millisecond)
+
+		n, err := dec.WriteToContext(context.Background(), io.Discard)
+		require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+		require.Equal(t, int64(5), n)
+	})
+}
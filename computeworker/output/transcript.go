@@ -0,0 +1,33 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"github.com/confidentsecurity/confidentcompute/computeworker/output/wire"
+)
+
+// TagLen is the length of the MAC tag that follows every chunk.
+const TagLen = wire.TagLen
+
+var (
+	// ErrChunkOutOfOrder is returned when a chunk does not have the expected sequence number,
+	// indicating chunks were reordered, duplicated or dropped.
+	ErrChunkOutOfOrder = wire.ErrChunkOutOfOrder
+	// ErrChunkTagMismatch is returned when a chunk tag does not match the transcript.
+	ErrChunkTagMismatch = wire.ErrChunkTagMismatch
+)
@@ -0,0 +1,374 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// mediaTypeFieldNumber and maxChunkLenFieldNumber are the fields of the OutputHeader message.
+const (
+	mediaTypeFieldNumber   protowire.Number = 1
+	maxChunkLenFieldNumber protowire.Number = 2
+)
+
+// refundFieldNumber is the field of the OutputFooter message that carries the refund.
+const refundFieldNumber protowire.Number = 1
+
+// abortedFieldNumber is the protobuf field that carries Footer.Aborted. The field is not part of the
+// OutputFooter message, decoders that don't know about it ignore it. The number is chosen well above
+// the fields of OutputFooter to leave it room to grow.
+const abortedFieldNumber protowire.Number = 1000
+
+// migratedFieldNumber and resumableAtFieldNumber carry Footer.Migrated and Footer.ResumableAt,
+// like abortedFieldNumber they are not part of the OutputFooter message.
+const (
+	migratedFieldNumber    protowire.Number = 1001
+	resumableAtFieldNumber protowire.Number = 1002
+)
+
+// sessionHintFieldNumber carries Footer.SessionHint, like abortedFieldNumber it is not part of the
+// OutputFooter message.
+const sessionHintFieldNumber protowire.Number = 1003
+
+// errorDetailFieldNumber carries Footer.ErrorDetail, like abortedFieldNumber it is not part of the
+// OutputFooter message.
+const errorDetailFieldNumber protowire.Number = 1004
+
+// modelFieldNumber carries Footer.Model, like abortedFieldNumber it is not part of the
+// OutputFooter message.
+const modelFieldNumber protowire.Number = 1005
+
+// refundSignatureFieldNumber carries Footer.RefundSignature, like abortedFieldNumber it is not part
+// of the OutputFooter message.
+const refundSignatureFieldNumber protowire.Number = 1006
+
+// continuationFieldNumber carries Footer.Continuations, like abortedFieldNumber it is not part of
+// the OutputFooter message. The field is repeated, one token per tool call.
+const continuationFieldNumber protowire.Number = 1008
+
+// refundUnsignedFieldNumber carries Footer.RefundUnsigned, like abortedFieldNumber it is not part
+// of the OutputFooter message.
+const refundUnsignedFieldNumber protowire.Number = 1009
+
+// Header is the first chunk of the output.
+type Header struct {
+	MediaType   string
+	MaxChunkLen int
+}
+
+// ParseHeader parses a binary OutputHeader.
+func ParseHeader(b []byte) (Header, error) {
+	mediaType, err := fieldBytes(b, mediaTypeFieldNumber)
+	if err != nil {
+		return Header{}, fmt.Errorf("failed to unmarshal media type from protobuf: %w", err)
+	}
+	maxChunkLen, err := fieldVarint(b, maxChunkLenFieldNumber)
+	if err != nil {
+		return Header{}, fmt.Errorf("failed to unmarshal max chunk len from protobuf: %w", err)
+	}
+	return Header{
+		MediaType:   string(mediaType),
+		MaxChunkLen: int(int32(maxChunkLen)), // #nosec G115 -- max chunk len is an int32 field
+	}, nil
+}
+
+// Footer is the last chunk of the output, without the currency types of openpcc. The refund is left
+// encoded, clients that need its amount unmarshal it with openpcc.
+type Footer struct {
+	// Refund is the binary protobuf encoded currency of the refund, nil when there is no refund. It is
+	// the refund a RefundStatement covers.
+	Refund []byte
+	// Aborted indicates the LLM failed mid-stream and the response is incomplete.
+	Aborted bool
+	// Migrated indicates the response was ended early so the client can resume it on another node.
+	Migrated bool
+	// ResumableAt is the number of output tokens delivered before a migration.
+	ResumableAt uint64
+	// SessionHint is the opaque hint the client sends back with the next turn of the conversation.
+	SessionHint string
+	// ErrorDetail indicates the encrypted response describes a failure of the worker.
+	ErrorDetail bool
+	// Model is the model the backend reported serving the response.
+	Model string
+	// RefundSignature is the signature of the refund by the refund key of the node, see
+	// VerifyRefundSignature. Empty when refunds are not signed.
+	RefundSignature []byte
+	// RefundUnsigned indicates the node signs refunds but failed to sign this one, the refund is
+	// sent without a signature rather than dropped.
+	RefundUnsigned bool
+	// Continuations are the continuation tokens of the tool calls of the response, the client sends
+	// one back with the follow-up request that answers the tool call for discounted input pricing.
+	Continuations []string
+}
+
+// HasRefund reports whether the footer carries a refund.
+func (f Footer) HasRefund() bool {
+	return f.Refund != nil
+}
+
+// RefundStatement returns the statement the refund signature covers, for a request with the given
+// IDs and credit amount.
+func (f Footer) RefundStatement(routerRequestID, nodeRequestID string, creditAmount int64) RefundStatement {
+	return RefundStatement{
+		RouterRequestID: routerRequestID,
+		NodeRequestID:   nodeRequestID,
+		CreditAmount:    creditAmount,
+		Refund:          f.Refund,
+		Aborted:         f.Aborted,
+	}
+}
+
+// AppendExtensions appends the footer fields that are not part of the OutputFooter message to b,
+// a binary OutputFooter.
+func (f Footer) AppendExtensions(b []byte) []byte {
+	if f.Aborted {
+		b = protowire.AppendTag(b, abortedFieldNumber, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(true))
+	}
+
+	if f.Migrated {
+		b = protowire.AppendTag(b, migratedFieldNumber, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(true))
+		b = protowire.AppendTag(b, resumableAtFieldNumber, protowire.VarintType)
+		b = protowire.AppendVarint(b, f.ResumableAt)
+	}
+
+	if f.SessionHint != "" {
+		b = protowire.AppendTag(b, sessionHintFieldNumber, protowire.BytesType)
+		b = protowire.AppendString(b, f.SessionHint)
+	}
+
+	if f.ErrorDetail {
+		b = protowire.AppendTag(b, errorDetailFieldNumber, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(true))
+	}
+
+	if f.Model != "" {
+		b = protowire.AppendTag(b, modelFieldNumber, protowire.BytesType)
+		b = protowire.AppendString(b, f.Model)
+	}
+
+	if len(f.RefundSignature) > 0 {
+		b = protowire.AppendTag(b, refundSignatureFieldNumber, protowire.BytesType)
+		b = protowire.AppendBytes(b, f.RefundSignature)
+	}
+
+	if f.RefundUnsigned {
+		b = protowire.AppendTag(b, refundUnsignedFieldNumber, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(true))
+	}
+
+	for _, token := range f.Continuations {
+		b = protowire.AppendTag(b, continuationFieldNumber, protowire.BytesType)
+		b = protowire.AppendString(b, token)
+	}
+
+	return b
+}
+
+// ParseFooter parses a binary OutputFooter, including the fields that are not part of the message.
+func ParseFooter(b []byte) (Footer, error) {
+	var (
+		f   Footer
+		err error
+	)
+
+	f.Refund, err = fieldBytes(b, refundFieldNumber)
+	if err != nil {
+		return Footer{}, fmt.Errorf("failed to unmarshal refund from protobuf: %w", err)
+	}
+
+	aborted, err := fieldVarint(b, abortedFieldNumber)
+	if err != nil {
+		return Footer{}, fmt.Errorf("failed to unmarshal aborted from protobuf: %w", err)
+	}
+	f.Aborted = protowire.DecodeBool(aborted)
+
+	migrated, err := fieldVarint(b, migratedFieldNumber)
+	if err != nil {
+		return Footer{}, fmt.Errorf("failed to unmarshal migrated from protobuf: %w", err)
+	}
+	f.Migrated = protowire.DecodeBool(migrated)
+
+	f.ResumableAt, err = fieldVarint(b, resumableAtFieldNumber)
+	if err != nil {
+		return Footer{}, fmt.Errorf("failed to unmarshal resumable at from protobuf: %w", err)
+	}
+
+	sessionHint, err := fieldBytes(b, sessionHintFieldNumber)
+	if err != nil {
+		return Footer{}, fmt.Errorf("failed to unmarshal session hint from protobuf: %w", err)
+	}
+	f.SessionHint = string(sessionHint)
+
+	errorDetail, err := fieldVarint(b, errorDetailFieldNumber)
+	if err != nil {
+		return Footer{}, fmt.Errorf("failed to unmarshal error detail from protobuf: %w", err)
+	}
+	f.ErrorDetail = protowire.DecodeBool(errorDetail)
+
+	model, err := fieldBytes(b, modelFieldNumber)
+	if err != nil {
+		return Footer{}, fmt.Errorf("failed to unmarshal model from protobuf: %w", err)
+	}
+	f.Model = string(model)
+
+	f.RefundSignature, err = fieldBytes(b, refundSignatureFieldNumber)
+	if err != nil {
+		return Footer{}, fmt.Errorf("failed to unmarshal refund signature from protobuf: %w", err)
+	}
+
+	refundUnsigned, err := fieldVarint(b, refundUnsignedFieldNumber)
+	if err != nil {
+		return Footer{}, fmt.Errorf("failed to unmarshal refund unsigned from protobuf: %w", err)
+	}
+	f.RefundUnsigned = protowire.DecodeBool(refundUnsigned)
+
+	continuations, err := fieldAllBytes(b, continuationFieldNumber)
+	if err != nil {
+		return Footer{}, fmt.Errorf("failed to unmarshal continuations from protobuf: %w", err)
+	}
+	for _, token := range continuations {
+		f.Continuations = append(f.Continuations, string(token))
+	}
+
+	return f, nil
+}
+
+// Decode reads an output stream that was encoded with key, nil for output encoded without a MAC key.
+// The data chunks are written to w once they are verified. Decode fails when the stream ends without
+// a footer, so a truncated response is never mistaken for a complete one.
+func Decode(r io.Reader, key []byte, w io.Writer) (Header, Footer, error) {
+	frames := NewReader(r, key)
+
+	frame, err := frames.Next()
+	if err != nil {
+		return Header{}, Footer{}, err
+	}
+	if frame.Footer {
+		return Header{}, Footer{}, errors.New("output has no header")
+	}
+	header, err := ParseHeader(frame.Data)
+	if err != nil {
+		return Header{}, Footer{}, fmt.Errorf("failed to unmarshal header: %w", err)
+	}
+
+	for {
+		frame, err := frames.Next()
+		if err != nil {
+			return header, Footer{}, err
+		}
+		if frame.Footer {
+			footer, err := ParseFooter(frame.Data)
+			if err != nil {
+				return header, Footer{}, fmt.Errorf("failed to unmarshal footer: %w", err)
+			}
+			return header, footer, nil
+		}
+		if _, err := w.Write(frame.Data); err != nil {
+			return header, Footer{}, fmt.Errorf("failed to write chunk: %w", err)
+		}
+	}
+}
+
+// fieldVarint finds a varint field in a protobuf message, 0 if the field is missing.
+func fieldVarint(b []byte, num protowire.Number) (uint64, error) {
+	for len(b) > 0 {
+		fieldNum, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if fieldNum == num && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return 0, protowire.ParseError(n)
+			}
+			return v, nil
+		}
+
+		n = protowire.ConsumeFieldValue(fieldNum, typ, b)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return 0, nil
+}
+
+// fieldBytes finds a bytes field in a protobuf message, nil if the field is missing.
+func fieldBytes(b []byte, num protowire.Number) ([]byte, error) {
+	for len(b) > 0 {
+		fieldNum, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if fieldNum == num && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			return v, nil
+		}
+
+		n = protowire.ConsumeFieldValue(fieldNum, typ, b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil, nil
+}
+
+// fieldAllBytes finds all values of a repeated bytes field in a protobuf message, nil if the field
+// is missing.
+func fieldAllBytes(b []byte, num protowire.Number) ([][]byte, error) {
+	var values [][]byte
+	for len(b) > 0 {
+		fieldNum, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if fieldNum == num && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			values = append(values, v)
+			b = b[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(fieldNum, typ, b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return values, nil
+}
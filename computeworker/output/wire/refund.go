@@ -0,0 +1,136 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/google/go-tpm/tpm2"
+)
+
+var (
+	// ErrInvalidSignature is returned when a signature doesn't verify against the message and the
+	// attestation key.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrInvalidRefundSignature is returned when a refund signature doesn't verify against the refund
+	// statement and the refund key.
+	ErrInvalidRefundSignature = errors.New("invalid refund signature")
+)
+
+// RefundStatement is what the refund signature in the footer covers: the refund and the request it
+// is for. The worker signs it with the refund key of the TPM, so router_com, or anything between the
+// node and the router, can't alter the refund without the router noticing.
+type RefundStatement struct {
+	// RouterRequestID is the request ID set by the router, empty if there is none.
+	RouterRequestID string
+	// NodeRequestID is the confsec request ID minted by router_com, empty if there is none.
+	NodeRequestID string
+	// CreditAmount is the credit amount of the request, including the top-ups granted to it.
+	CreditAmount int64
+	// Refund is the binary protobuf encoded currency, the same value as the refund trailer.
+	Refund []byte
+	// Aborted is true when the response failed mid-stream.
+	Aborted bool
+}
+
+// SignedMessage returns the message the refund signature covers. The signature is over the SHA-256
+// digest of the message.
+func (s RefundStatement) SignedMessage() []byte {
+	var b bytes.Buffer
+	b.WriteString("confsec refund v1\n")
+	b.WriteString(s.RouterRequestID)
+	b.WriteByte('\n')
+	b.WriteString(s.NodeRequestID)
+	b.WriteByte('\n')
+	b.WriteString(strconv.FormatInt(s.CreditAmount, 10))
+	b.WriteByte('\n')
+	b.WriteString(base64.StdEncoding.EncodeToString(s.Refund))
+	b.WriteByte('\n')
+	b.WriteString(strconv.FormatBool(s.Aborted))
+	return b.Bytes()
+}
+
+// VerifyRefundSignature verifies the refund signature of a footer against the statement and the
+// refund key of the node, a marshalled TPMT_PUBLIC as disclosed in its evidence, see
+// VerifyAKSignature.
+func VerifyRefundSignature(refundKeyPublic []byte, statement RefundStatement, signature []byte) error {
+	err := VerifyAKSignature(refundKeyPublic, statement.SignedMessage(), signature)
+	if errors.Is(err, ErrInvalidSignature) {
+		return fmt.Errorf("%w: %w", ErrInvalidRefundSignature, err)
+	}
+	return err
+}
+
+// VerifyAKSignature verifies a signature over the SHA-256 digest of msg by the attestation key of the
+// node, a marshalled TPMT_PUBLIC as included in its evidence. The signature is a marshalled
+// TPMT_SIGNATURE, both RSASSA and ECDSA signatures over SHA-256 are accepted.
+func VerifyAKSignature(akPublic []byte, msg []byte, signature []byte) error {
+	public, err := tpm2.Unmarshal[tpm2.TPMTPublic](akPublic)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal attestation key: %w", err)
+	}
+	pubKey, err := tpm2.Pub(*public)
+	if err != nil {
+		return fmt.Errorf("failed to parse attestation key: %w", err)
+	}
+	sig, err := tpm2.Unmarshal[tpm2.TPMTSignature](signature)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+	digest := sha256.Sum256(msg)
+
+	switch key := pubKey.(type) {
+	case *rsa.PublicKey:
+		rsassa, err := sig.Signature.RSASSA()
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+		}
+		if rsassa.Hash != tpm2.TPMAlgSHA256 {
+			return fmt.Errorf("%w: unsupported hash %v", ErrInvalidSignature, rsassa.Hash)
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], rsassa.Sig.Buffer); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		ecc, err := sig.Signature.ECDSA()
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+		}
+		if ecc.Hash != tpm2.TPMAlgSHA256 {
+			return fmt.Errorf("%w: unsupported hash %v", ErrInvalidSignature, ecc.Hash)
+		}
+		r := new(big.Int).SetBytes(ecc.SignatureR.Buffer)
+		s := new(big.Int).SetBytes(ecc.SignatureS.Buffer)
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported attestation key type %T", pubKey)
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wire decodes and verifies the output of compute_worker: the length prefixed chunks, the
+// transcript tags that authenticate them and the footer. It only depends on the standard library,
+// protowire and the go-tpm structures, so it builds to WASM for the browser demo and the SDKs.
+// The output package encodes and decodes with the same code on the node.
+package wire
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// TagLen is the length of the MAC tag that follows every chunk.
+const TagLen = sha256.Size
+
+// MaxChunkLen is the max length of the data of a chunk.
+const MaxChunkLen = 32 * 1024 // 32kb
+
+// MACKeyLen is the length of the MAC key of a transcript.
+const MACKeyLen = 32
+
+// MACKeyExportContext is the HPKE exporter context the MAC key of a transcript is exported with,
+// see RFC 9180 section 5.3. compute_worker exports it from the HPKE context of the request and the
+// client exports the same key, router_com never has it.
+var MACKeyExportContext = []byte("confsec output mac v1")
+
+var (
+	// ErrChunkOutOfOrder is returned when a chunk does not have the expected sequence number,
+	// indicating chunks were reordered, duplicated or dropped.
+	ErrChunkOutOfOrder = errors.New("output chunk out of order")
+	// ErrChunkTagMismatch is returned when a chunk tag does not match the transcript.
+	ErrChunkTagMismatch = errors.New("output chunk tag mismatch")
+)
+
+const (
+	ChunkKindData   byte = 0
+	ChunkKindFooter byte = 1
+)
+
+// Transcript is the running MAC over all chunks of an output stream. It covers the header, the
+// data chunks as a single byte stream and the footer, but not where the data was split into chunks.
+// The chunks of the worker output don't survive the way to the client, so the client verifies the
+// response body as it received it, see VerifyTranscript. Every tag authenticates the stream up to
+// and including its chunk, the chunk kind separates the tags of data chunks from the footer tag.
+// The sequence numbers are checked by the reader, the stream already fixes the order of the data.
+//
+// Without a key the transcript is a plain hash chain, which detects accidental corruption
+// but not deliberate tampering.
+type Transcript struct {
+	mac hash.Hash
+	// stream hashes the length prefixed header followed by the data.
+	stream hash.Hash
+	tag    []byte
+	seq    uint64
+}
+
+func NewTranscript(key []byte) *Transcript {
+	return &Transcript{
+		mac:    hmac.New(sha256.New, key),
+		stream: sha256.New(),
+		tag:    make([]byte, TagLen),
+	}
+}
+
+// Seq is the sequence number of the next chunk.
+func (t *Transcript) Seq() uint64 {
+	return t.seq
+}
+
+// Next computes the tag for the next chunk and advances the transcript. The first chunk is the header.
+func (t *Transcript) Next(kind byte, data []byte) []byte {
+	if t.seq == 0 {
+		// the length separates the header from the data that follows it.
+		var headerLen [8]byte
+		binary.BigEndian.PutUint64(headerLen[:], uint64(len(data)))
+		t.stream.Write(headerLen[:])
+	}
+	if kind == ChunkKindData {
+		t.stream.Write(data)
+	}
+
+	var digest [sha256.Size]byte
+	t.mac.Reset()
+	t.mac.Write([]byte{kind})
+	t.mac.Write(t.stream.Sum(digest[:0]))
+	if kind == ChunkKindFooter {
+		t.mac.Write(data)
+	}
+	t.tag = t.mac.Sum(t.tag[:0])
+	t.seq++
+
+	return t.tag
+}
+
+// Verify checks the sequence number and tag of the next chunk and advances the transcript.
+func (t *Transcript) Verify(seq uint64, kind byte, data []byte, tag []byte) error {
+	if seq != t.seq {
+		return ErrChunkOutOfOrder
+	}
+
+	if !hmac.Equal(t.Next(kind, data), tag) {
+		return ErrChunkTagMismatch
+	}
+
+	return nil
+}
+
+// AppendVarint appends v as a QUIC variable-length integer, see RFC 9000 section 16.
+func AppendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, 0x40|byte(v>>8), byte(v))
+	case v < 1<<30:
+		return append(b, 0x80|byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	default:
+		return append(b, 0xc0|byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+}
+
+// ReadVarint reads a QUIC variable-length integer, see RFC 9000 section 16.
+func ReadVarint(r io.ByteReader) (uint64, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	v := uint64(first & 0x3f)
+	for range 1<<(first>>6) - 1 {
+		b, err := r.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+// Frame is a verified chunk of the output.
+type Frame struct {
+	// Footer is true for the footer chunk, the last chunk of the output.
+	Footer bool
+	// Data is only valid until the next call to Reader.Next.
+	Data []byte
+}
+
+// Reader reads the chunks of an output stream and verifies them against the transcript. It reads
+// the stream byte by byte where needed, so it never reads past the footer.
+type Reader struct {
+	r   byteReader
+	buf []byte
+	tag [TagLen]byte
+	// transcript is nil for a forwarding reader, which only checks the sequence numbers.
+	transcript *Transcript
+	seq        uint64
+}
+
+// NewReader creates a reader that verifies the transcript with key, nil for output encoded without
+// a MAC key.
+func NewReader(r io.Reader, key []byte) *Reader {
+	return &Reader{
+		r:          newByteReader(r),
+		transcript: NewTranscript(key),
+	}
+}
+
+// NewForwardingReader creates a reader for output whose MAC key is exported from the HPKE context of
+// the request, like router_com reads it. It checks the sequence numbers, the client verifies the tags
+// with VerifyTranscript.
+func NewForwardingReader(r io.Reader) *Reader {
+	return &Reader{
+		r: newByteReader(r),
+	}
+}
+
+// Tag returns the tag of the last chunk read. After the footer it authenticates the whole output.
+func (r *Reader) Tag() []byte {
+	return bytes.Clone(r.tag[:])
+}
+
+// Next reads and verifies the next chunk. The first chunk is the header.
+func (r *Reader) Next() (Frame, error) {
+	chunkLen, err := r.readChunkLen()
+	if err != nil {
+		return Frame{}, err
+	}
+
+	// zero chunk length indicates the footer.
+	if chunkLen != 0 {
+		err = r.readChunkData(chunkLen, ChunkKindData)
+		if err != nil {
+			return Frame{}, err
+		}
+		return Frame{Data: r.buf}, nil
+	}
+
+	chunkLen, err = r.readChunkLen()
+	if err == nil {
+		err = r.readChunkData(chunkLen, ChunkKindFooter)
+	}
+	if err != nil {
+		return Frame{}, fmt.Errorf("failed to decode footer: %w", err)
+	}
+	return Frame{Footer: true, Data: r.buf}, nil
+}
+
+func (r *Reader) readChunkLen() (uint64, error) {
+	chunkLen, err := ReadVarint(r.r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode length: %w", err)
+	}
+	// prevent excessive buffer allocations in case something goes wrong.
+	if chunkLen > MaxChunkLen {
+		return 0, fmt.Errorf("received length %d over max buffer len %d", chunkLen, MaxChunkLen)
+	}
+	return chunkLen, nil
+}
+
+// readChunkData reads the sequence number, the chunk data and the tag that follow the chunk
+// length, and verifies them against the transcript.
+func (r *Reader) readChunkData(chunkLen uint64, kind byte) error {
+	seq, err := ReadVarint(r.r)
+	if err != nil {
+		return fmt.Errorf("failed to decode sequence number: %w", err)
+	}
+
+	if uint64(cap(r.buf)) < chunkLen {
+		r.buf = make([]byte, chunkLen)
+	}
+	r.buf = r.buf[:chunkLen]
+
+	_, err = io.ReadFull(r.r, r.buf)
+	if err != nil {
+		return fmt.Errorf("failed to read chunk: %w", err)
+	}
+
+	_, err = io.ReadFull(r.r, r.tag[:])
+	if err != nil {
+		return fmt.Errorf("failed to read chunk tag: %w", err)
+	}
+
+	if r.transcript == nil {
+		if seq != r.seq {
+			return fmt.Errorf("chunk %d: %w", seq, ErrChunkOutOfOrder)
+		}
+		r.seq++
+		return nil
+	}
+
+	err = r.transcript.Verify(seq, kind, r.buf, r.tag[:])
+	if err != nil {
+		return fmt.Errorf("chunk %d: %w", seq, err)
+	}
+
+	return nil
+}
+
+// VerifyTranscript verifies tag, the tag of the footer of an output, with the MAC key the client
+// exported from the HPKE context of the request. header and footer are the data of the header and
+// footer chunks, which router_com forwards in trailers, body is the encrypted response body between
+// them, as the client received it. The tag doesn't depend on how the body was chunked on its way.
+func VerifyTranscript(key, header, body, footer, tag []byte) error {
+	transcript := NewTranscript(key)
+	transcript.Next(ChunkKindData, header)
+	transcript.Next(ChunkKindData, body)
+	if !hmac.Equal(transcript.Next(ChunkKindFooter, footer), tag) {
+		return ErrChunkTagMismatch
+	}
+	return nil
+}
+
+// byteReader reads single bytes without reading ahead, so the underlying reader is left right
+// after the footer.
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+func newByteReader(r io.Reader) byteReader {
+	if br, ok := r.(byteReader); ok {
+		return br
+	}
+	return &singleByteReader{Reader: r}
+}
+
+type singleByteReader struct {
+	io.Reader
+	b [1]byte
+}
+
+func (r *singleByteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(r.Reader, r.b[:])
+	return r.b[0], err
+}
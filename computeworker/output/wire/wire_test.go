@@ -0,0 +1,243 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wire_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"testing"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker/output/wire"
+	"github.com/google/go-tpm/tpm2"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// encode writes output the way output.Encoder does, with a header of mediaType, the chunks and
+// the footer.
+func encode(t *testing.T, key []byte, mediaType string, footer wire.Footer, chunks ...string) []byte {
+	t.Helper()
+	transcript := wire.NewTranscript(key)
+	var b []byte
+	appendChunk := func(kind byte, data []byte) {
+		b = wire.AppendVarint(b, uint64(len(data)))
+		b = wire.AppendVarint(b, transcript.Seq())
+		tag := transcript.Next(kind, data)
+		b = append(b, data...)
+		b = append(b, tag...)
+	}
+
+	header := protowire.AppendTag(nil, 1, protowire.BytesType)
+	header = protowire.AppendString(header, mediaType)
+	header = protowire.AppendTag(header, 2, protowire.VarintType)
+	header = protowire.AppendVarint(header, 8)
+	appendChunk(wire.ChunkKindData, header)
+	for _, chunk := range chunks {
+		appendChunk(wire.ChunkKindData, []byte(chunk))
+	}
+
+	var f []byte
+	if footer.Refund != nil {
+		f = protowire.AppendTag(f, 1, protowire.BytesType)
+		f = protowire.AppendBytes(f, footer.Refund)
+	}
+	b = wire.AppendVarint(b, 0)
+	appendChunk(wire.ChunkKindFooter, footer.AppendExtensions(f))
+	return b
+}
+
+func TestDecode(t *testing.T) {
+	key := bytes.Repeat([]byte{0x01}, 32)
+	footer := wire.Footer{
+		Refund:          []byte{0x08, 0x2a},
+		Aborted:         true,
+		Migrated:        true,
+		ResumableAt:     12,
+		SessionHint:     "hint",
+		ErrorDetail:     true,
+		Model:           "llama3.2:1b",
+		RefundSignature: []byte("signature"),
+		RefundUnsigned:  true,
+		Continuations:   []string{"first", "second"},
+	}
+
+	t.Run("ok, roundtrip", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		header, got, err := wire.Decode(bytes.NewReader(encode(t, key, "application/x-ndjson", footer, "hello", "world")), key, out)
+		require.NoError(t, err)
+		require.Equal(t, wire.Header{MediaType: "application/x-ndjson", MaxChunkLen: 8}, header)
+		require.Equal(t, footer, got)
+		require.True(t, got.HasRefund())
+		require.Equal(t, "helloworld", out.String())
+	})
+
+	t.Run("ok, empty footer", func(t *testing.T) {
+		_, got, err := wire.Decode(bytes.NewReader(encode(t, nil, "application/json", wire.Footer{})), nil, io.Discard)
+		require.NoError(t, err)
+		require.Equal(t, wire.Footer{}, got)
+		require.False(t, got.HasRefund())
+	})
+
+	t.Run("ok, reader stops after the footer", func(t *testing.T) {
+		r := bytes.NewBuffer(append(encode(t, key, "application/json", footer, "hello"), "trailing"...))
+		_, _, err := wire.Decode(struct{ io.Reader }{r}, key, io.Discard)
+		require.NoError(t, err)
+		require.Equal(t, "trailing", r.String())
+	})
+
+	t.Run("ok, large varints", func(t *testing.T) {
+		for _, v := range []uint64{0, 63, 64, 16383, 16384, 1<<30 - 1, 1 << 30, 1<<62 - 1} {
+			got, err := wire.ReadVarint(bytes.NewReader(wire.AppendVarint(nil, v)))
+			require.NoError(t, err)
+			require.Equal(t, v, got)
+		}
+	})
+
+	t.Run("fail, key mismatch", func(t *testing.T) {
+		_, _, err := wire.Decode(bytes.NewReader(encode(t, key, "application/json", footer, "hello")), nil, io.Discard)
+		require.ErrorIs(t, err, wire.ErrChunkTagMismatch)
+	})
+
+	t.Run("fail, modified footer", func(t *testing.T) {
+		b := encode(t, key, "application/json", footer, "hello")
+		b[len(b)-wire.TagLen-1] ^= 0x01
+		_, _, err := wire.Decode(bytes.NewReader(b), key, io.Discard)
+		require.ErrorIs(t, err, wire.ErrChunkTagMismatch)
+	})
+
+	t.Run("fail, truncated", func(t *testing.T) {
+		b := encode(t, key, "application/json", footer, "hello")
+		out := &bytes.Buffer{}
+		_, _, err := wire.Decode(bytes.NewReader(b[:len(b)-1]), key, out)
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		require.Equal(t, "hello", out.String())
+	})
+}
+
+func TestForwardingReader(t *testing.T) {
+	key := bytes.Repeat([]byte{0x01}, 32)
+
+	// read returns the data of every chunk and the tag of the footer.
+	read := func(b []byte) ([][]byte, []byte, error) {
+		r := wire.NewForwardingReader(bytes.NewReader(b))
+		var frames [][]byte
+		for {
+			frame, err := r.Next()
+			if err != nil {
+				return nil, nil, err
+			}
+			frames = append(frames, bytes.Clone(frame.Data))
+			if frame.Footer {
+				return frames, r.Tag(), nil
+			}
+		}
+	}
+
+	t.Run("ok, client verifies the transcript", func(t *testing.T) {
+		frames, tag, err := read(encode(t, key, "application/json", wire.Footer{Model: "llama3.2:1b"}, "hello", "world"))
+		require.NoError(t, err)
+		require.Len(t, frames, 4)
+
+		header, footer := frames[0], frames[3]
+		require.NoError(t, wire.VerifyTranscript(key, header, []byte("helloworld"), footer, tag))
+		require.ErrorIs(t, wire.VerifyTranscript(bytes.Repeat([]byte{0x02}, 32), header, []byte("helloworld"), footer, tag), wire.ErrChunkTagMismatch)
+		require.ErrorIs(t, wire.VerifyTranscript(key, header, []byte("worldhello"), footer, tag), wire.ErrChunkTagMismatch)
+		require.ErrorIs(t, wire.VerifyTranscript(key, header, []byte("hello"), footer, tag), wire.ErrChunkTagMismatch)
+	})
+
+	t.Run("ok, tag does not depend on the chunking", func(t *testing.T) {
+		_, tag, err := read(encode(t, key, "application/json", wire.Footer{}, "hello", "world"))
+		require.NoError(t, err)
+		_, otherTag, err := read(encode(t, key, "application/json", wire.Footer{}, "hel", "lowor", "ld"))
+		require.NoError(t, err)
+		require.Equal(t, tag, otherTag)
+	})
+
+	t.Run("fail, data moved into the header", func(t *testing.T) {
+		frames, tag, err := read(encode(t, key, "application/json", wire.Footer{}, "hello"))
+		require.NoError(t, err)
+		header, footer := frames[0], frames[2]
+		require.ErrorIs(t, wire.VerifyTranscript(key, append(bytes.Clone(header), 'h'), []byte("ello"), footer, tag), wire.ErrChunkTagMismatch)
+	})
+
+	t.Run("fail, sequence number out of order", func(t *testing.T) {
+		b := encode(t, key, "application/json", wire.Footer{}, "hello")
+		// the sequence number of the first data chunk follows the header chunk and its length.
+		i := bytes.Index(b, []byte("hello")) - 1
+		b[i]++
+		_, _, err := read(b)
+		require.ErrorIs(t, err, wire.ErrChunkOutOfOrder)
+	})
+}
+
+func TestVerifyRefundSignature(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	akPublic := tpm2.Marshal(tpm2.TPMTPublic{
+		Type:    tpm2.TPMAlgECC,
+		NameAlg: tpm2.TPMAlgSHA256,
+		ObjectAttributes: tpm2.TPMAObject{
+			SignEncrypt: true,
+			Restricted:  true,
+		},
+		Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &tpm2.TPMSECCParms{
+			CurveID: tpm2.TPMECCNistP256,
+			Scheme: tpm2.TPMTECCScheme{
+				Scheme:  tpm2.TPMAlgECDSA,
+				Details: tpm2.NewTPMUAsymScheme(tpm2.TPMAlgECDSA, &tpm2.TPMSSigSchemeECDSA{HashAlg: tpm2.TPMAlgSHA256}),
+			},
+		}),
+		Unique: tpm2.NewTPMUPublicID(tpm2.TPMAlgECC, &tpm2.TPMSECCPoint{
+			X: tpm2.TPM2BECCParameter{Buffer: priv.X.FillBytes(make([]byte, 32))},
+			Y: tpm2.TPM2BECCParameter{Buffer: priv.Y.FillBytes(make([]byte, 32))},
+		}),
+	})
+
+	footer := wire.Footer{Refund: []byte{0x08, 0x2a}, Aborted: true}
+	statement := footer.RefundStatement("router-request", "node-request", 100)
+	digest := sha256.Sum256(statement.SignedMessage())
+	r, s, err := ecdsa.Sign(rand.Reader, priv, digest[:])
+	require.NoError(t, err)
+	sig := tpm2.Marshal(tpm2.TPMTSignature{
+		SigAlg: tpm2.TPMAlgECDSA,
+		Signature: tpm2.NewTPMUSignature(tpm2.TPMAlgECDSA, &tpm2.TPMSSignatureECC{
+			Hash:       tpm2.TPMAlgSHA256,
+			SignatureR: tpm2.TPM2BECCParameter{Buffer: r.Bytes()},
+			SignatureS: tpm2.TPM2BECCParameter{Buffer: s.Bytes()},
+		}),
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		require.NoError(t, wire.VerifyRefundSignature(akPublic, statement, sig))
+	})
+
+	t.Run("fail, other request", func(t *testing.T) {
+		other := footer.RefundStatement("router-request", "other-request", 100)
+		require.ErrorIs(t, wire.VerifyRefundSignature(akPublic, other, sig), wire.ErrInvalidRefundSignature)
+	})
+
+	t.Run("fail, altered refund", func(t *testing.T) {
+		altered := statement
+		altered.Refund = []byte{0x08, 0x2b}
+		require.ErrorIs(t, wire.VerifyRefundSignature(akPublic, altered, sig), wire.ErrInvalidRefundSignature)
+	})
+}
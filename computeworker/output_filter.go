@@ -0,0 +1,276 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"plugin"
+	"slices"
+)
+
+// ErrOutputTerminated ends a response that the output filter terminated. Like a backend failure
+// mid-stream, the response is completed with an aborted footer.
+var ErrOutputTerminated = errors.New("output terminated by the output filter")
+
+// OutputFilterAction is the decision of an OutputFilter on a chunk of output text.
+type OutputFilterAction int
+
+const (
+	// OutputAllow passes the chunk on unchanged.
+	OutputAllow OutputFilterAction = iota
+	// OutputRedact replaces the text of the chunk.
+	OutputRedact
+	// OutputTerminate ends the response before the chunk.
+	OutputTerminate
+)
+
+// OutputFilter inspects the plaintext output inside the confidential boundary, before it is encrypted,
+// so operators can enforce a local safety policy. A filter sees client data, it must not log or
+// export anything.
+type OutputFilter interface {
+	// FilterOutput is called for every chunk of output text in order, output is the text delivered
+	// so far. The replacement is only used for OutputRedact.
+	FilterOutput(output, chunk string) (OutputFilterAction, string)
+}
+
+// OutputFilterSymbol is the function an output filter plugin exports, it implements
+// OutputFilter.FilterOutput with plain types. The action is an OutputFilterAction.
+const OutputFilterSymbol = "FilterOutput"
+
+// OutputFilterDigest returns the hex encoded SHA-256 digest of an output filter module, the digest
+// compute_boot discloses in the evidence.
+func OutputFilterDigest(module []byte) string {
+	digest := sha256.Sum256(module)
+	return hex.EncodeToString(digest[:])
+}
+
+// pluginOutputFilter calls the function exported by an output filter plugin.
+type pluginOutputFilter func(output, chunk string) (int, string)
+
+func (f pluginOutputFilter) FilterOutput(output, chunk string) (OutputFilterAction, string) {
+	action, replacement := f(output, chunk)
+	return OutputFilterAction(action), replacement
+}
+
+// LoadOutputFilter loads the Go plugin at path as an output filter. The module must match digest,
+// so only the module disclosed in the evidence is ever loaded. The plugin is opened from a private
+// copy of the verified bytes, the module at path could be replaced after it was verified.
+func LoadOutputFilter(path, digest string) (OutputFilter, error) {
+	module, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output filter: %w", err)
+	}
+	if got := OutputFilterDigest(module); got != digest {
+		return nil, fmt.Errorf("output filter digest mismatch: got %s, want %s", got, digest)
+	}
+
+	dir, err := os.MkdirTemp("", "output-filter-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy output filter: %w", err)
+	}
+	// the module stays mapped once it is opened.
+	defer os.RemoveAll(dir)
+	private := filepath.Join(dir, filepath.Base(path))
+	if err := os.WriteFile(private, module, 0o500); err != nil {
+		return nil, fmt.Errorf("failed to copy output filter: %w", err)
+	}
+
+	p, err := plugin.Open(private)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output filter: %w", err)
+	}
+	sym, err := p.Lookup(OutputFilterSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find output filter: %w", err)
+	}
+	filter, ok := sym.(func(string, string) (int, string))
+	if !ok {
+		return nil, fmt.Errorf("output filter %s has type %T", OutputFilterSymbol, sym)
+	}
+	return pluginOutputFilter(filter), nil
+}
+
+// filteredBody passes the lines of a streaming response through an OutputFilter. Ollama responses
+// and OpenAI event streams both carry their output text in JSON lines, lines without output text
+// are passed on unchanged.
+type filteredBody struct {
+	r      *bufio.Reader
+	c      io.Closer
+	filter OutputFilter
+	line   []byte
+	output bytes.Buffer
+	err    error
+}
+
+func newFilteredBody(rc io.ReadCloser, filter OutputFilter) *filteredBody {
+	return &filteredBody{
+		r:      bufio.NewReader(rc),
+		c:      rc,
+		filter: filter,
+	}
+}
+
+func (b *filteredBody) Read(p []byte) (int, error) {
+	for len(b.line) == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+
+		line, err := b.r.ReadBytes('\n')
+		if err != nil {
+			b.err = err
+		}
+		if len(line) == 0 {
+			continue
+		}
+
+		line, terminated := b.filterLine(line)
+		if terminated {
+			b.err = ErrOutputTerminated
+			return 0, b.err
+		}
+		b.line = line
+	}
+
+	n := copy(p, b.line)
+	b.line = b.line[n:]
+	return n, nil
+}
+
+func (b *filteredBody) Close() error {
+	return b.c.Close()
+}
+
+// filterLine returns the line with its output text replaced according to the filter, true when
+// the filter terminated the response.
+func (b *filteredBody) filterLine(line []byte) ([]byte, bool) {
+	body := bytes.TrimRight(line, "\r\n")
+	ending := line[len(body):]
+	prefix := []byte{}
+	if rest, ok := bytes.CutPrefix(body, []byte("data: ")); ok {
+		prefix, body = []byte("data: "), rest
+	}
+
+	var chunk map[string]any
+	if !bytes.HasPrefix(body, []byte("{")) || json.Unmarshal(body, &chunk) != nil {
+		return line, false
+	}
+
+	text := outputTextFields(chunk, nil)
+	if text == "" {
+		return line, false
+	}
+
+	action, replacement := b.filter.FilterOutput(b.output.String(), text)
+	switch action {
+	case OutputTerminate:
+		return nil, true
+	case OutputRedact:
+		outputTextFields(chunk, &replacement)
+		redacted, err := json.Marshal(chunk)
+		if err != nil {
+			// never pass on text the filter redacted.
+			return nil, true
+		}
+		b.output.WriteString(replacement)
+		return append(append(prefix, redacted...), ending...), false
+	default:
+		b.output.WriteString(text)
+		return line, false
+	}
+}
+
+// outputTextKeys are the keys of the output text fields of response chunks: the Ollama response,
+// thinking and message content, the OpenAI choice text, content, reasoning, refusal and tool call
+// arguments, and the deltas and texts of Responses API events.
+var outputTextKeys = map[string]bool{
+	"response":          true,
+	"thinking":          true,
+	"content":           true,
+	"text":              true,
+	"reasoning_content": true,
+	"reasoning":         true,
+	"refusal":           true,
+	"arguments":         true,
+	"delta":             true,
+}
+
+// outputTextFields returns the output text of a response chunk, the string values of outputTextKeys
+// anywhere in the chunk, and the strings of tool call arguments that are objects, in key order. A
+// non-nil replacement replaces the text, only the first field with text keeps it, and removes the
+// logprobs, whose tokens repeat the text.
+func outputTextFields(chunk map[string]any, replacement *string) string {
+	var text string
+	replaced := false
+	replace := func(v string) string {
+		text += v
+		switch {
+		case replacement == nil:
+			return v
+		case !replaced:
+			replaced = true
+			return *replacement
+		default:
+			return ""
+		}
+	}
+
+	var walk func(v any, inArguments bool) any
+	walk = func(v any, inArguments bool) any {
+		switch v := v.(type) {
+		case map[string]any:
+			for _, key := range slices.Sorted(maps.Keys(v)) {
+				if key == "logprobs" && replacement != nil {
+					v[key] = nil
+					continue
+				}
+				if s, ok := v[key].(string); ok {
+					if s != "" && (inArguments || outputTextKeys[key]) {
+						v[key] = replace(s)
+					}
+					continue
+				}
+				v[key] = walk(v[key], inArguments || key == "arguments")
+			}
+		case []any:
+			for i, item := range v {
+				if s, ok := item.(string); ok {
+					if s != "" && inArguments {
+						v[i] = replace(s)
+					}
+					continue
+				}
+				v[i] = walk(item, inArguments)
+			}
+		}
+		return v
+	}
+
+	walk(chunk, false)
+	return text
+}
@@ -0,0 +1,138 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// wordFilter redacts and terminates on fixed words.
+type wordFilter struct {
+	outputs []string
+}
+
+func (f *wordFilter) FilterOutput(output, chunk string) (OutputFilterAction, string) {
+	f.outputs = append(f.outputs, output)
+	switch chunk {
+	case "secret":
+		return OutputRedact, "[redacted]"
+	case "forbidden":
+		return OutputTerminate, ""
+	default:
+		return OutputAllow, ""
+	}
+}
+
+func TestFilteredBody(t *testing.T) {
+	tests := map[string]struct {
+		body string
+		want string
+	}{
+		"ok, ollama lines without filtered text pass unchanged": {
+			body: `{"response":"hello"}` + "\n" + `{"response":"","done":true}` + "\n",
+			want: `{"response":"hello"}` + "\n" + `{"response":"","done":true}` + "\n",
+		},
+		"ok, ollama response is redacted": {
+			body: `{"response":"secret"}` + "\n",
+			want: `{"response":"[redacted]"}` + "\n",
+		},
+		"ok, ollama chat message is redacted": {
+			body: `{"message":{"content":"secret","role":"assistant"}}` + "\n",
+			want: `{"message":{"content":"[redacted]","role":"assistant"}}` + "\n",
+		},
+		"ok, openai event stream delta is redacted": {
+			body: `data: {"choices":[{"delta":{"content":"secret"}}]}` + "\n\n" + "data: [DONE]\n\n",
+			want: `data: {"choices":[{"delta":{"content":"[redacted]"}}]}` + "\n\n" + "data: [DONE]\n\n",
+		},
+		"ok, ollama thinking is redacted": {
+			body: `{"message":{"content":"","role":"assistant","thinking":"secret"}}` + "\n",
+			want: `{"message":{"content":"","role":"assistant","thinking":"[redacted]"}}` + "\n",
+		},
+		"ok, ollama tool call arguments are redacted": {
+			body: `{"message":{"tool_calls":[{"function":{"arguments":{"city":"secret"},"name":"weather"}}]}}` + "\n",
+			want: `{"message":{"tool_calls":[{"function":{"arguments":{"city":"[redacted]"},"name":"weather"}}]}}` + "\n",
+		},
+		"ok, openai reasoning content is redacted": {
+			body: `data: {"choices":[{"delta":{"reasoning_content":"secret"}}]}` + "\n\n",
+			want: `data: {"choices":[{"delta":{"reasoning_content":"[redacted]"}}]}` + "\n\n",
+		},
+		"ok, openai tool call arguments are redacted": {
+			body: `data: {"choices":[{"delta":{"tool_calls":[{"function":{"arguments":"secret"},"id":"call_1","index":0}]}}]}` + "\n\n",
+			want: `data: {"choices":[{"delta":{"tool_calls":[{"function":{"arguments":"[redacted]"},"id":"call_1","index":0}]}}]}` + "\n\n",
+		},
+		"ok, openai logprobs of redacted text are removed": {
+			body: `data: {"choices":[{"delta":{"content":"secret"},"logprobs":{"content":[{"token":"secret"}]}}]}` + "\n\n",
+			want: `data: {"choices":[{"delta":{"content":"[redacted]"},"logprobs":null}]}` + "\n\n",
+		},
+		"ok, responses api delta is redacted": {
+			body: `data: {"delta":"secret","item_id":"msg_1","type":"response.output_text.delta"}` + "\n\n",
+			want: `data: {"delta":"[redacted]","item_id":"msg_1","type":"response.output_text.delta"}` + "\n\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			body := newFilteredBody(io.NopCloser(strings.NewReader(tc.body)), &wordFilter{})
+			got, err := io.ReadAll(body)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, string(got))
+			require.NoError(t, body.Close())
+		})
+	}
+
+	t.Run("ok, filter sees the delivered output", func(t *testing.T) {
+		filter := &wordFilter{}
+		body := `{"response":"a"}` + "\n" + `{"response":"secret"}` + "\n" + `{"response":"b"}` + "\n"
+		_, err := io.ReadAll(newFilteredBody(io.NopCloser(strings.NewReader(body)), filter))
+		require.NoError(t, err)
+		require.Equal(t, []string{"", "a", "a[redacted]"}, filter.outputs)
+	})
+
+	t.Run("fail, terminated response aborts the refund recorder", func(t *testing.T) {
+		body := `{"response":"hello"}` + "\n" + `{"response":"forbidden"}` + "\n" + `{"response":"never"}` + "\n"
+		filtered := newFilteredBody(io.NopCloser(strings.NewReader(body)), &wordFilter{})
+		recorder := newRefundRecorder(OllamaGeneratePath, filtered, nil)
+
+		// like a backend failure, the response ends early so it can be completed with a footer.
+		got, err := io.ReadAll(recorder)
+		require.NoError(t, err)
+		require.Equal(t, `{"response":"hello"}`+"\n", string(got))
+		require.ErrorIs(t, recorder.Aborted(), ErrOutputTerminated)
+	})
+}
+
+func TestLoadOutputFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.so")
+	require.NoError(t, os.WriteFile(path, []byte("not a plugin"), 0o600))
+
+	t.Run("fail, digest mismatch", func(t *testing.T) {
+		_, err := LoadOutputFilter(path, OutputFilterDigest([]byte("other module")))
+		require.ErrorContains(t, err, "output filter digest mismatch")
+	})
+
+	t.Run("fail, missing module", func(t *testing.T) {
+		_, err := LoadOutputFilter(filepath.Join(t.TempDir(), "missing.so"), "")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,122 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"context"
+	"errors"
+	"io"
+	mrand "math/rand/v2"
+	"time"
+)
+
+// DefaultPacingMaxDelay is the default bound on the latency pacing adds to a response.
+const DefaultPacingMaxDelay = 2 * time.Second
+
+// PacingConfig re-times the emission of ciphertext chunks to a constant or randomized cadence,
+// so token inter-arrival times don't leak characteristics of the prompt or response.
+type PacingConfig struct {
+	// Interval is the target time between two chunks. Leave 0 to disable pacing.
+	Interval time.Duration `yaml:"interval"`
+	// Jitter randomizes the cadence, every gap is Interval plus a random duration below Jitter.
+	// Leave 0 for a constant cadence.
+	Jitter time.Duration `yaml:"jitter"`
+	// MaxDelay bounds the latency pacing adds to a response. Once chunks lag behind the LLM by
+	// more than MaxDelay they are emitted right away, until the LLM slows down again.
+	MaxDelay time.Duration `yaml:"max_delay"`
+}
+
+func (c *PacingConfig) Validate() error {
+	if c.Interval < 0 || c.Jitter < 0 || c.MaxDelay < 0 {
+		return errors.New("pacing durations can't be negative")
+	}
+	if c.Interval == 0 && c.Jitter > 0 {
+		return errors.New("pacing jitter requires an interval")
+	}
+	if c.Interval > 0 && c.MaxDelay == 0 {
+		return errors.New("pacing requires a max delay")
+	}
+	return nil
+}
+
+// pacedWriter holds back writes that arrive faster than the cadence. Writes that arrive
+// slower are passed on right away, pacing can't hide gaps longer than the cadence.
+type pacedWriter struct {
+	ctx   context.Context
+	w     io.Writer
+	cfg   PacingConfig
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+	// next is when the next write is due, zero before the first write.
+	next time.Time
+	// lag is the latency the writes held back so far have added.
+	lag time.Duration
+}
+
+func newPacedWriter(ctx context.Context, w io.Writer, cfg PacingConfig) *pacedWriter {
+	return &pacedWriter{
+		ctx:   ctx,
+		w:     w,
+		cfg:   cfg,
+		now:   time.Now,
+		sleep: sleepContext,
+	}
+}
+
+func (p *pacedWriter) Write(b []byte) (int, error) {
+	now := p.now()
+	if !p.next.IsZero() {
+		wait := p.next.Sub(now)
+		switch {
+		case wait <= 0:
+			// the LLM was slower than the cadence, which reduces the lag.
+			p.lag = max(0, p.lag+wait)
+		case p.lag < p.cfg.MaxDelay:
+			wait = min(wait, p.cfg.MaxDelay-p.lag)
+			if err := p.sleep(p.ctx, wait); err != nil {
+				return 0, err
+			}
+			p.lag += wait
+			now = p.now()
+		}
+	}
+
+	n, err := p.w.Write(b)
+	p.next = now.Add(p.gap())
+	return n, err
+}
+
+// gap returns the time until the next write is due.
+func (p *pacedWriter) gap() time.Duration {
+	if p.cfg.Jitter <= 0 {
+		return p.cfg.Interval
+	}
+	// #nosec G404 -- the global source is randomly seeded, jitter is not used for secrets.
+	return p.cfg.Interval + time.Duration(mrand.Int64N(int64(p.cfg.Jitter)))
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
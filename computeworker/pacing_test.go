@@ -0,0 +1,141 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacedWriter(t *testing.T) {
+	// newWriter returns a paced writer on a fake clock that records how long each write was held back.
+	newWriter := func(cfg PacingConfig) (*pacedWriter, *time.Time, *[]time.Duration, *bytes.Buffer) {
+		buf := &bytes.Buffer{}
+		now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		var sleeps []time.Duration
+		w := newPacedWriter(context.Background(), buf, cfg)
+		w.now = func() time.Time { return now }
+		w.sleep = func(_ context.Context, d time.Duration) error {
+			sleeps = append(sleeps, d)
+			now = now.Add(d)
+			return nil
+		}
+		return w, &now, &sleeps, buf
+	}
+
+	write := func(t *testing.T, w *pacedWriter, s string) {
+		n, err := w.Write([]byte(s))
+		require.NoError(t, err)
+		require.Equal(t, len(s), n)
+	}
+
+	t.Run("ok, burst is spread to the cadence", func(t *testing.T) {
+		w, _, sleeps, buf := newWriter(PacingConfig{Interval: 50 * time.Millisecond, MaxDelay: time.Second})
+		write(t, w, "a")
+		write(t, w, "b")
+		write(t, w, "c")
+
+		require.Equal(t, "abc", buf.String())
+		require.Equal(t, []time.Duration{50 * time.Millisecond, 50 * time.Millisecond}, *sleeps)
+	})
+
+	t.Run("ok, slow chunks are not held back", func(t *testing.T) {
+		w, now, sleeps, _ := newWriter(PacingConfig{Interval: 50 * time.Millisecond, MaxDelay: time.Second})
+		write(t, w, "a")
+		*now = now.Add(80 * time.Millisecond)
+		write(t, w, "b")
+		*now = now.Add(30 * time.Millisecond)
+		write(t, w, "c")
+
+		require.Equal(t, []time.Duration{20 * time.Millisecond}, *sleeps)
+	})
+
+	t.Run("ok, added latency is bounded by max delay", func(t *testing.T) {
+		w, now, sleeps, buf := newWriter(PacingConfig{Interval: 50 * time.Millisecond, MaxDelay: 120 * time.Millisecond})
+		for _, s := range []string{"a", "b", "c", "d", "e"} {
+			write(t, w, s)
+		}
+		require.Equal(t, "abcde", buf.String())
+		require.Equal(t, []time.Duration{50 * time.Millisecond, 50 * time.Millisecond, 20 * time.Millisecond}, *sleeps)
+
+		// once the llm slows down the lag is recovered and pacing resumes.
+		*now = now.Add(time.Second)
+		write(t, w, "f")
+		write(t, w, "g")
+		require.Equal(t, 50*time.Millisecond, (*sleeps)[len(*sleeps)-1])
+	})
+
+	t.Run("ok, jitter stays within bounds", func(t *testing.T) {
+		w, _, sleeps, _ := newWriter(PacingConfig{Interval: 50 * time.Millisecond, Jitter: 10 * time.Millisecond, MaxDelay: time.Hour})
+		for range 100 {
+			write(t, w, "a")
+		}
+		for _, d := range *sleeps {
+			require.GreaterOrEqual(t, d, 50*time.Millisecond)
+			require.Less(t, d, 60*time.Millisecond)
+		}
+	})
+
+	t.Run("fail, context canceled while held back", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		w := newPacedWriter(ctx, &bytes.Buffer{}, PacingConfig{Interval: time.Hour, MaxDelay: time.Hour})
+		write(t, w, "a")
+
+		_, err := w.Write([]byte("b"))
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestPacingConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		cfg     PacingConfig
+		wantErr bool
+	}{
+		"ok, disabled":           {cfg: PacingConfig{MaxDelay: DefaultPacingMaxDelay}},
+		"ok, constant cadence":   {cfg: PacingConfig{Interval: 20 * time.Millisecond, MaxDelay: time.Second}},
+		"ok, randomized cadence": {cfg: PacingConfig{Interval: 20 * time.Millisecond, Jitter: 10 * time.Millisecond, MaxDelay: time.Second}},
+		"fail, negative interval": {
+			cfg:     PacingConfig{Interval: -time.Millisecond, MaxDelay: time.Second},
+			wantErr: true,
+		},
+		"fail, jitter without interval": {
+			cfg:     PacingConfig{Jitter: time.Millisecond, MaxDelay: time.Second},
+			wantErr: true,
+		},
+		"fail, interval without max delay": {
+			cfg:     PacingConfig{Interval: time.Millisecond},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"net/http"
+	"strings"
+)
+
+// Padding modes, see PaddingConfig.
+const (
+	// PaddingModePowerOfTwo pads responses to the next power of two, at least Step bytes.
+	PaddingModePowerOfTwo = "power_of_two"
+	// PaddingModeStep pads responses to the next multiple of Step, at least Step bytes.
+	PaddingModeStep = "step"
+)
+
+// PaddingTrailer is the trailer of the encapsulated response that carries the filler. It is
+// encrypted with the rest of the response, so only the client sees it, and clients ignore it.
+const PaddingTrailer = "X-Confsec-Padding"
+
+// PaddingConfig pads responses to size buckets, so the length of the encrypted response seen by
+// the router reveals less about its content. Coarser buckets hide more but cost more bandwidth.
+type PaddingConfig struct {
+	// Mode is PaddingModePowerOfTwo or PaddingModeStep. Leave blank to disable padding.
+	Mode string `yaml:"mode"`
+	// Step is the bucket size in step mode and the smallest bucket in power of two mode.
+	Step int64 `yaml:"step"`
+	// MaxPadding bounds the filler added to a response. Responses that would need more are not
+	// padded, so the bound trades the cost of large responses against hiding their length.
+	MaxPadding int64 `yaml:"max_padding"`
+}
+
+func (c *PaddingConfig) Validate() error {
+	switch c.Mode {
+	case "":
+		return nil
+	case PaddingModePowerOfTwo, PaddingModeStep:
+	default:
+		return fmt.Errorf("unknown padding mode %q", c.Mode)
+	}
+	if c.Step <= 0 {
+		return errors.New("padding requires a positive step")
+	}
+	if c.MaxPadding <= 0 {
+		return errors.New("padding requires a positive max padding")
+	}
+	return nil
+}
+
+// paddedLen returns the length a response body of n bytes is padded to.
+func (c PaddingConfig) paddedLen(n int64) int64 {
+	var padded int64
+	switch c.Mode {
+	case PaddingModePowerOfTwo:
+		padded = c.Step
+		if n > padded {
+			shift := bits.Len64(uint64(n - 1)) // #nosec G115 -- n is positive
+			if shift > 62 {
+				return n
+			}
+			padded = 1 << shift
+		}
+	case PaddingModeStep:
+		padded = max(c.Step, (n+c.Step-1)/c.Step*c.Step)
+		if padded < n {
+			// overflow.
+			return n
+		}
+	default:
+		return n
+	}
+	if padded-n > c.MaxPadding {
+		return n
+	}
+	return padded
+}
+
+// padResponse pads the body of resp with filler in PaddingTrailer. The response is encapsulated
+// after the body was read, so the filler is sealed like the body and the ciphertext is padded.
+func padResponse(resp *http.Response, cfg PaddingConfig) {
+	if resp.Trailer == nil {
+		resp.Trailer = http.Header{}
+	}
+	// declared up front, the value is only known once the body was read.
+	resp.Trailer[PaddingTrailer] = nil
+	resp.Body = &paddedBody{ReadCloser: resp.Body, cfg: cfg, trailer: resp.Trailer}
+}
+
+// paddedBody sets the filler trailer when the body was read completely. Aborted bodies are not
+// padded, their length is already cut short.
+type paddedBody struct {
+	io.ReadCloser
+	cfg     PaddingConfig
+	trailer http.Header
+	n       int64
+}
+
+func (b *paddedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if errors.Is(err, io.EOF) {
+		if filler := b.cfg.paddedLen(b.n) - b.n; filler > 0 {
+			b.trailer.Set(PaddingTrailer, strings.Repeat("0", int(filler)))
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,103 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeworker
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaddingConfig(t *testing.T) {
+	t.Run("ok, padded lengths", func(t *testing.T) {
+		tests := map[string]struct {
+			cfg  PaddingConfig
+			n    int64
+			want int64
+		}{
+			"power of two, empty":           {cfg: PaddingConfig{Mode: PaddingModePowerOfTwo, Step: 256, MaxPadding: 4096}, n: 0, want: 256},
+			"power of two, below step":      {cfg: PaddingConfig{Mode: PaddingModePowerOfTwo, Step: 256, MaxPadding: 4096}, n: 100, want: 256},
+			"power of two, exact":           {cfg: PaddingConfig{Mode: PaddingModePowerOfTwo, Step: 256, MaxPadding: 4096}, n: 1024, want: 1024},
+			"power of two, rounded up":      {cfg: PaddingConfig{Mode: PaddingModePowerOfTwo, Step: 256, MaxPadding: 4096}, n: 1025, want: 2048},
+			"power of two, over max":        {cfg: PaddingConfig{Mode: PaddingModePowerOfTwo, Step: 256, MaxPadding: 4096}, n: 8193, want: 8193},
+			"step, empty":                   {cfg: PaddingConfig{Mode: PaddingModeStep, Step: 512, MaxPadding: 512}, n: 0, want: 512},
+			"step, exact":                   {cfg: PaddingConfig{Mode: PaddingModeStep, Step: 512, MaxPadding: 512}, n: 1024, want: 1024},
+			"step, rounded up":              {cfg: PaddingConfig{Mode: PaddingModeStep, Step: 512, MaxPadding: 512}, n: 1025, want: 1536},
+			"step, larger than max padding": {cfg: PaddingConfig{Mode: PaddingModeStep, Step: 512, MaxPadding: 100}, n: 1025, want: 1025},
+			"disabled":                      {cfg: PaddingConfig{}, n: 1025, want: 1025},
+		}
+		for name, tc := range tests {
+			t.Run(name, func(t *testing.T) {
+				require.NoError(t, tc.cfg.Validate())
+				require.Equal(t, tc.want, tc.cfg.paddedLen(tc.n))
+			})
+		}
+	})
+
+	t.Run("fail, invalid config", func(t *testing.T) {
+		tests := map[string]PaddingConfig{
+			"unknown mode":   {Mode: "exponential", Step: 256, MaxPadding: 4096},
+			"no step":        {Mode: PaddingModeStep, MaxPadding: 4096},
+			"no max padding": {Mode: PaddingModePowerOfTwo, Step: 256},
+		}
+		for name, cfg := range tests {
+			t.Run(name, func(t *testing.T) {
+				require.Error(t, cfg.Validate())
+			})
+		}
+	})
+}
+
+func TestPadResponse(t *testing.T) {
+	cfg := PaddingConfig{Mode: PaddingModeStep, Step: 16, MaxPadding: 16}
+
+	t.Run("ok, filler is set once the body was read", func(t *testing.T) {
+		resp := &http.Response{Body: io.NopCloser(strings.NewReader("hello world"))}
+		padResponse(resp, cfg)
+		require.Contains(t, resp.Trailer, PaddingTrailer)
+		require.Empty(t, resp.Trailer.Get(PaddingTrailer))
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, "hello world", string(body))
+		require.Equal(t, strings.Repeat("0", 16-len("hello world")), resp.Trailer.Get(PaddingTrailer))
+	})
+
+	t.Run("ok, other trailers are kept", func(t *testing.T) {
+		resp := &http.Response{
+			Body:    io.NopCloser(strings.NewReader("hello")),
+			Trailer: http.Header{"X-Other": []string{"value"}},
+		}
+		padResponse(resp, cfg)
+		_, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, "value", resp.Trailer.Get("X-Other"))
+		require.Len(t, resp.Trailer.Get(PaddingTrailer), 11)
+	})
+
+	t.Run("ok, aborted body is not padded", func(t *testing.T) {
+		resp := &http.Response{Body: io.NopCloser(io.MultiReader(strings.NewReader("hello"), iotest.ErrReader(io.ErrUnexpectedEOF)))}
+		padResponse(resp, cfg)
+		_, err := io.ReadAll(resp.Body)
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		require.Empty(t, resp.Trailer.Get(PaddingTrailer))
+	})
+}
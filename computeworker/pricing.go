@@ -0,0 +1,193 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+
+	"github.com/openpcc/openpcc/anonpay/currency"
+	"github.com/openpcc/openpcc/models"
+)
+
+// audioTokensPerSecond converts seconds of transcribed audio to input tokens. Whisper-style encoders
+// produce 50 frames per second of audio.
+const audioTokensPerSecond = 50
+
+// Usage is what a response consumed, as reported by the backend. The pricing of the route turns it
+// into credits.
+type Usage struct {
+	InputTokens  float64
+	OutputTokens float64
+	// AudioSeconds is the duration of the transcribed audio, for backends that don't report the
+	// input tokens of transcriptions.
+	AudioSeconds float64
+	// WaivedInputTokens are the input tokens that are not charged, e.g. those a continuation token
+	// covers. They are part of InputTokens.
+	WaivedInputTokens float64
+}
+
+// RoutePricing is the credit price of the usage of a route.
+type RoutePricing struct {
+	// InputTokenCredits is the price of an input token.
+	InputTokenCredits float64 `yaml:"input_token_credits" json:"input_token_credits"`
+	// OutputTokenCredits is the price of an output token.
+	OutputTokenCredits float64 `yaml:"output_token_credits" json:"output_token_credits"`
+	// AudioSecondCredits is the price of a second of transcribed audio.
+	AudioSecondCredits float64 `yaml:"audio_second_credits" json:"audio_second_credits"`
+	// RequestCredits is charged once for every completed request.
+	RequestCredits float64 `yaml:"request_credits" json:"request_credits"`
+}
+
+func (p RoutePricing) Validate() error {
+	for _, price := range []float64{p.InputTokenCredits, p.OutputTokenCredits, p.AudioSecondCredits, p.RequestCredits} {
+		if price < 0 || math.IsInf(price, 0) || math.IsNaN(price) {
+			return fmt.Errorf("invalid price %v", price)
+		}
+	}
+	return nil
+}
+
+// pricingFunc returns the credits used by a response.
+type pricingFunc func(u Usage) float64
+
+func (p RoutePricing) pricingFunc() pricingFunc {
+	return func(u Usage) float64 {
+		return p.RequestCredits +
+			max(u.InputTokens-u.WaivedInputTokens, 0)*p.InputTokenCredits +
+			u.OutputTokens*p.OutputTokenCredits +
+			u.AudioSeconds*p.AudioSecondCredits
+	}
+}
+
+// PricingConfig overrides the credit pricing of routes. Routes without an override are priced by
+// their tokens with the openpcc credit multipliers.
+type PricingConfig struct {
+	// Routes maps a route, e.g. /v1/rerank, to its pricing. Aliases share the pricing of their route.
+	Routes map[string]RoutePricing `yaml:"routes" json:"routes"`
+}
+
+func (c *PricingConfig) Validate() error {
+	for route, pricing := range c.Routes {
+		if !slices.Contains(pricedRoutes, route) {
+			return fmt.Errorf("unknown route %q", route)
+		}
+		if err := pricing.Validate(); err != nil {
+			return fmt.Errorf("invalid pricing for route %q: %w", route, err)
+		}
+	}
+	return nil
+}
+
+// pricedRoutes are the routes that can have their pricing overridden.
+var pricedRoutes = []string{
+	OllamaGeneratePath,
+	OllamaChatPath,
+	OpenAICompletionsPath,
+	OpenAIChatPath,
+	VLLMRerankPath,
+	OpenAITranscriptionsPath,
+}
+
+// pricingRoute returns the route whose pricing applies to path.
+func pricingRoute(path string) string {
+	if path == VLLMRerankAliasPath {
+		return VLLMRerankPath
+	}
+	return path
+}
+
+// defaultRoutePricing prices tokens with the openpcc credit multipliers, and transcribed audio like
+// the input tokens it is encoded to.
+func defaultRoutePricing(route string) RoutePricing {
+	pricing := RoutePricing{
+		InputTokenCredits:  models.InputTokenCreditMultiplier,
+		OutputTokenCredits: models.OutputTokenCreditMultiplier,
+	}
+	if route == OpenAITranscriptionsPath {
+		pricing.AudioSecondCredits = audioTokensPerSecond * models.InputTokenCreditMultiplier
+	}
+	return pricing
+}
+
+// pricingEngine prices the usage of responses per route, so refunds don't depend on how a route
+// reports its usage.
+type pricingEngine struct {
+	routes   map[string]pricingFunc
+	fallback pricingFunc
+}
+
+// newPricingEngine creates a pricing engine with the overrides in cfg, a nil cfg uses the default
+// pricing for every route.
+func newPricingEngine(cfg *PricingConfig) *pricingEngine {
+	e := &pricingEngine{
+		routes:   make(map[string]pricingFunc, len(pricedRoutes)),
+		fallback: defaultRoutePricing("").pricingFunc(),
+	}
+	for _, route := range pricedRoutes {
+		pricing := defaultRoutePricing(route)
+		if cfg != nil {
+			if override, ok := cfg.Routes[route]; ok {
+				pricing = override
+			}
+		}
+		e.routes[route] = pricing.pricingFunc()
+	}
+	return e
+}
+
+// creditsUsed returns the credits used by a response to a request on path.
+func (e *pricingEngine) creditsUsed(path string, u Usage) float64 {
+	price, ok := e.routes[pricingRoute(path)]
+	if !ok {
+		price = e.fallback
+	}
+	return price(u)
+}
+
+// refund returns the unused credits of a response to a request on path, errNoRefundAvailable when
+// the response used all of them.
+func (e *pricingEngine) refund(path string, u Usage, creditAmount int64) (currency.Value, error) {
+	creditUsed := e.creditsUsed(path, u)
+
+	refund := float64(creditAmount) - creditUsed
+
+	if refund > 0 {
+		roundingFactor, err := currency.RandFloat64()
+		if err != nil {
+			slog.Error("failed to generate random float for rounding", "error", err)
+			return currency.Zero, fmt.Errorf("failed to generate random float for rounding: %w", err)
+		}
+		refundAmount, err := currency.Rounded(refund, roundingFactor)
+		if err != nil {
+			slog.Error("failed to round refund amount", "error", err, "refund", refund)
+			return currency.Zero, fmt.Errorf("failed to round refund: %w", err)
+		}
+		debugAmount, err := refundAmount.Amount()
+		if err != nil {
+			slog.Error("failed to get refund amount", "error", err)
+			return currency.Zero, fmt.Errorf("failed to get refund amount: %w", err)
+		}
+		slog.Debug("refund calculations", "creditAmount", creditAmount, "creditUsed", creditUsed, "refund", refund, "roundedRefund", debugAmount)
+		return refundAmount, nil
+	}
+
+	return currency.Zero, errNoRefundAvailable
+}
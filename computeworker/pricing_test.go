@@ -0,0 +1,173 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"math"
+	"testing"
+
+	"github.com/openpcc/openpcc/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPricingEngine(t *testing.T) {
+	tokens := Usage{InputTokens: 10, OutputTokens: 5}
+	tokenCredits := 10*float64(models.InputTokenCreditMultiplier) + 5*float64(models.OutputTokenCreditMultiplier)
+
+	testCases := []struct {
+		name string
+		cfg  *PricingConfig
+		path string
+		u    Usage
+		want float64
+	}{
+		{
+			name: "default pricing prices tokens",
+			path: OpenAIChatPath,
+			u:    tokens,
+			want: tokenCredits,
+		},
+		{
+			name: "default pricing prices unknown routes by tokens",
+			path: "/api/unknown",
+			u:    tokens,
+			want: tokenCredits,
+		},
+		{
+			name: "default pricing prices audio like its input tokens",
+			path: OpenAITranscriptionsPath,
+			u:    Usage{AudioSeconds: 2},
+			want: 2 * audioTokensPerSecond * float64(models.InputTokenCreditMultiplier),
+		},
+		{
+			name: "waived input tokens are not charged",
+			path: OpenAIChatPath,
+			u:    Usage{InputTokens: 10, OutputTokens: 5, WaivedInputTokens: 4},
+			want: 6*float64(models.InputTokenCreditMultiplier) + 5*float64(models.OutputTokenCreditMultiplier),
+		},
+		{
+			name: "override replaces the pricing of the route",
+			cfg: &PricingConfig{Routes: map[string]RoutePricing{
+				VLLMRerankPath: {RequestCredits: 3, InputTokenCredits: 0.5},
+			}},
+			path: VLLMRerankPath,
+			u:    Usage{InputTokens: 10},
+			want: 8,
+		},
+		{
+			name: "override applies to aliases",
+			cfg: &PricingConfig{Routes: map[string]RoutePricing{
+				VLLMRerankPath: {RequestCredits: 3},
+			}},
+			path: VLLMRerankAliasPath,
+			u:    Usage{InputTokens: 10},
+			want: 3,
+		},
+		{
+			name: "override leaves other routes alone",
+			cfg: &PricingConfig{Routes: map[string]RoutePricing{
+				VLLMRerankPath: {RequestCredits: 3},
+			}},
+			path: OllamaGeneratePath,
+			u:    tokens,
+			want: tokenCredits,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newPricingEngine(tc.cfg)
+			require.InDelta(t, tc.want, e.creditsUsed(tc.path, tc.u), 1e-9)
+		})
+	}
+
+	t.Run("ok, refund of the unused credits", func(t *testing.T) {
+		e := newPricingEngine(&PricingConfig{Routes: map[string]RoutePricing{
+			OpenAITranscriptionsPath: {RequestCredits: 100},
+		}})
+		refund, err := e.refund(OpenAITranscriptionsPath, Usage{AudioSeconds: 1000}, 200)
+		require.NoError(t, err)
+		amount, err := refund.Amount()
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, amount, int64(90))
+		require.LessOrEqual(t, amount, int64(110))
+	})
+
+	t.Run("fail, usage exceeds credits", func(t *testing.T) {
+		e := newPricingEngine(&PricingConfig{Routes: map[string]RoutePricing{
+			VLLMRerankPath: {RequestCredits: 300},
+		}})
+		_, err := e.refund(VLLMRerankPath, Usage{}, 200)
+		require.ErrorIs(t, err, errNoRefundAvailable)
+	})
+}
+
+func TestPricingConfigValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cfg     PricingConfig
+		wantErr bool
+	}{
+		{
+			name: "ok, known routes",
+			cfg: PricingConfig{Routes: map[string]RoutePricing{
+				VLLMRerankPath:           {RequestCredits: 1},
+				OpenAITranscriptionsPath: {AudioSecondCredits: 2, OutputTokenCredits: 1},
+			}},
+		},
+		{
+			name: "fail, unknown route",
+			cfg: PricingConfig{Routes: map[string]RoutePricing{
+				"/v1/embeddings": {RequestCredits: 1},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "fail, alias instead of route",
+			cfg: PricingConfig{Routes: map[string]RoutePricing{
+				VLLMRerankAliasPath: {RequestCredits: 1},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "fail, negative price",
+			cfg: PricingConfig{Routes: map[string]RoutePricing{
+				OpenAIChatPath: {InputTokenCredits: -1},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "fail, infinite price",
+			cfg: PricingConfig{Routes: map[string]RoutePricing{
+				OpenAIChatPath: {OutputTokenCredits: math.Inf(1)},
+			}},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/cloudflare/circl/hpke"
+)
+
+// PromptCacheKeyEnv is the environment variable router_com uses to pass the prompt cache key.
+// It is not a flag because process arguments are world readable.
+const PromptCacheKeyEnv = "COMPUTE_WORKER_PROMPT_CACHE_KEY"
+
+// PromptCacheKeyLen is the length of the prompt cache key router_com generates at startup.
+const PromptCacheKeyLen = 32
+
+// PromptCacheSecretHeader is the base64 encoded secret a client picks for a conversation and sends
+// with every turn of it. It is part of the encrypted request, so only the client and the node know
+// it. Requests without it don't share cached blocks with any other request.
+const PromptCacheSecretHeader = "X-Confsec-Prompt-Cache-Secret"
+
+const (
+	// promptCacheSecretMinLen is the min length of a client prompt cache secret, before base64 encoding.
+	promptCacheSecretMinLen = 16
+	// promptCacheSecretMaxLen is the max length of a client prompt cache secret, before base64 encoding.
+	promptCacheSecretMaxLen = 64
+)
+
+// promptCacheHandleLen is the length of the derived cache handle in bytes, before hex encoding.
+const promptCacheHandleLen = 16
+
+// promptCacheKDF is the KDF of the request HPKE suite, reused to derive the prompt cache handles.
+const promptCacheKDF = hpke.KDF_HKDF_SHA256
+
+var promptCacheInfo = []byte("confsec prompt cache handle v2")
+
+// PromptCacheSalter is implemented by request bodies whose backend isolates its prefix cache by a
+// salt, requests only share cached blocks with requests that have the same salt. vLLM supports
+// this with cache_salt, Ollama has no way to isolate its cache so its bodies don't implement it.
+type PromptCacheSalter interface {
+	// PromptCachePrefix returns the encoded conversation prefix the salt is derived from.
+	PromptCachePrefix() ([]byte, error)
+	// SetPromptCacheSalt replaces the salt of the request, returning whether the body was mutated.
+	// An empty salt removes it.
+	SetPromptCacheSalt(salt string) bool
+}
+
+// PromptCacheHandle derives the cache salt of a conversation prefix from the prompt cache secret of
+// the client and the node prompt cache key. The secret is only known to the client, so other
+// clients can't derive the handle of its conversations and probe their cached blocks, even when
+// they send the same prefix. The key never leaves the node, so the router can't either.
+func PromptCacheHandle(key []byte, secret []byte, model string, prefix []byte) string {
+	// the secret is hashed to a fixed length, so it can't be confused with the start of the prefix.
+	secretHash := sha256.Sum256(secret)
+	prk := promptCacheKDF.Extract(slices.Concat(secretHash[:], prefix), key)
+	info := slices.Concat(promptCacheInfo, []byte{0}, []byte(model))
+	return hex.EncodeToString(promptCacheKDF.Expand(prk, info, promptCacheHandleLen))
+}
+
+// promptCacheSalt returns the salt of a request body. Without a key the salt is empty, so client
+// provided salts are removed. Without a client secret the salt is derived from a random secret, so
+// the request doesn't share cached blocks with other requests.
+func promptCacheSalt(key []byte, header http.Header, model string, salter PromptCacheSalter) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+	secret, err := promptCacheSecret(header)
+	if err != nil {
+		return "", err
+	}
+	prefix, err := salter.PromptCachePrefix()
+	if err != nil {
+		return "", err
+	}
+	return PromptCacheHandle(key, secret, model, prefix), nil
+}
+
+// promptCacheSecret returns the client prompt cache secret of a request, or a random one when the
+// client didn't send one.
+func promptCacheSecret(header http.Header) ([]byte, error) {
+	value := header.Get(PromptCacheSecretHeader)
+	if value == "" {
+		secret := make([]byte, promptCacheSecretMinLen)
+		_, err := rand.Read(secret)
+		return secret, err
+	}
+	return decodePromptCacheSecret(value)
+}
+
+func decodePromptCacheSecret(value string) ([]byte, error) {
+	secret, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) < promptCacheSecretMinLen || len(secret) > promptCacheSecretMaxLen {
+		return nil, errors.New("invalid prompt cache secret length")
+	}
+	return secret, nil
+}
+
+func parsePromptCacheSecretHeader(value string) error {
+	_, err := decodePromptCacheSecret(value)
+	return err
+}
+
+// PromptCachePrefix is the prompt, the whole prompt is reused by repeated requests.
+func (b *OpenAIRequestBodyCompletions) PromptCachePrefix() ([]byte, error) {
+	return json.Marshal(b.Prompt)
+}
+
+func (b *OpenAIRequestBodyCompletions) SetPromptCacheSalt(salt string) bool {
+	dirty := b.CacheSalt != salt
+	b.CacheSalt = salt
+	return dirty
+}
+
+// PromptCachePrefix is the messages up to and including the first user message, so every turn of
+// a conversation shares the salt of the first one.
+func (b *OpenAIRequestBodyChat) PromptCachePrefix() ([]byte, error) {
+	n := slices.IndexFunc(b.Messages, func(m OpenAIRequestBodyChatMessage) bool {
+		return m.Role == "user"
+	})
+	if n < 0 {
+		n = len(b.Messages) - 1
+	}
+	return json.Marshal(b.Messages[:n+1])
+}
+
+func (b *OpenAIRequestBodyChat) SetPromptCacheSalt(salt string) bool {
+	dirty := b.CacheSalt != salt
+	b.CacheSalt = salt
+	return dirty
+}
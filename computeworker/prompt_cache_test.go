@@ -0,0 +1,147 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openpcc/openpcc/auth/credentialing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromptCacheHandle(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, PromptCacheKeyLen)
+	otherKey := bytes.Repeat([]byte{2}, PromptCacheKeyLen)
+	secret := bytes.Repeat([]byte{3}, promptCacheSecretMinLen)
+	otherSecret := bytes.Repeat([]byte{4}, promptCacheSecretMinLen)
+
+	handle := PromptCacheHandle(key, secret, "llama3.2:1b", []byte("prefix"))
+	require.Len(t, handle, 2*promptCacheHandleLen)
+	require.Equal(t, handle, PromptCacheHandle(key, secret, "llama3.2:1b", []byte("prefix")))
+	require.NotEqual(t, handle, PromptCacheHandle(otherKey, secret, "llama3.2:1b", []byte("prefix")))
+	require.NotEqual(t, handle, PromptCacheHandle(key, otherSecret, "llama3.2:1b", []byte("prefix")))
+	require.NotEqual(t, handle, PromptCacheHandle(key, secret, "gemma3:1b", []byte("prefix")))
+	require.NotEqual(t, handle, PromptCacheHandle(key, secret, "llama3.2:1b", []byte("other prefix")))
+}
+
+func TestOpenAIRequestBodyChatPromptCachePrefix(t *testing.T) {
+	turn := func(messages ...OpenAIRequestBodyChatMessage) []byte {
+		b := &OpenAIRequestBodyChat{Messages: messages}
+		prefix, err := b.PromptCachePrefix()
+		require.NoError(t, err)
+		return prefix
+	}
+
+	system := OpenAIRequestBodyChatMessage{Role: "system", Content: "be brief"}
+	first := OpenAIRequestBodyChatMessage{Role: "user", Content: "why is the sky blue?"}
+	answer := OpenAIRequestBodyChatMessage{Role: "assistant", Content: "scattering"}
+	second := OpenAIRequestBodyChatMessage{Role: "user", Content: "and sunsets?"}
+
+	require.Equal(t, turn(system, first), turn(system, first, answer, second))
+	require.NotEqual(t, turn(system, first), turn(system, second))
+	// without a user message the whole conversation is the prefix.
+	require.JSONEq(t, `[{"role":"system","content":"be brief"}]`, string(turn(system)))
+}
+
+func TestBodyValidatorPromptCacheSalt(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, PromptCacheKeyLen)
+	badge := credentialing.Badge{Credentials: credentialing.Credentials{Models: defaultTestModels}}
+
+	secret := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{3}, promptCacheSecretMinLen))
+	otherSecret := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{4}, promptCacheSecretMinLen))
+
+	validate := func(t *testing.T, key []byte, secret, path, payload string) map[string]any {
+		validator := BodyValidator{
+			MaxSize: 1024,
+			RouteBodyTypes: map[string]func() RequestBody{
+				OllamaChatPath:        func() RequestBody { return &OllamaRequestBodyChat{} },
+				OpenAICompletionsPath: func() RequestBody { return &OpenAIRequestBodyCompletions{} },
+				OpenAIChatPath:        func() RequestBody { return &OpenAIRequestBodyChat{} },
+			},
+			SupportedModels: defaultTestModels,
+			PromptCacheKey:  key,
+		}
+
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(payload))
+		req.ContentLength = int64(len(payload))
+		if secret != "" {
+			req.Header.Set(PromptCacheSecretHeader, secret)
+		}
+		require.NoError(t, validator.ValidateWithBadge(req, &badge))
+
+		body, err := io.ReadAll(req.Body)
+		require.NoError(t, err)
+		var got map[string]any
+		require.NoError(t, json.Unmarshal(body, &got))
+		return got
+	}
+
+	t.Run("ok, turns of a conversation share the salt", func(t *testing.T) {
+		first := validate(t, key, secret, OpenAIChatPath, `{"model":"llama3.2:1b","messages":[{"role":"user","content":"hi"}]}`)
+		second := validate(t, key, secret, OpenAIChatPath, `{"model":"llama3.2:1b","messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"bye"}]}`)
+		other := validate(t, key, secret, OpenAIChatPath, `{"model":"llama3.2:1b","messages":[{"role":"user","content":"bye"}]}`)
+
+		require.NotEmpty(t, first["cache_salt"])
+		require.Equal(t, first["cache_salt"], second["cache_salt"])
+		require.NotEqual(t, first["cache_salt"], other["cache_salt"])
+	})
+
+	t.Run("ok, clients with the same prefix get different salts", func(t *testing.T) {
+		payload := `{"model":"llama3.2:1b","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}]}`
+		got := validate(t, key, secret, OpenAIChatPath, payload)
+		other := validate(t, key, otherSecret, OpenAIChatPath, payload)
+
+		require.NotEmpty(t, got["cache_salt"])
+		require.NotEmpty(t, other["cache_salt"])
+		require.NotEqual(t, got["cache_salt"], other["cache_salt"])
+	})
+
+	t.Run("ok, requests without a secret don't share a salt", func(t *testing.T) {
+		payload := `{"model":"llama3.2:1b","messages":[{"role":"user","content":"hi"}]}`
+		got := validate(t, key, "", OpenAIChatPath, payload)
+		other := validate(t, key, "", OpenAIChatPath, payload)
+
+		require.NotEmpty(t, got["cache_salt"])
+		require.NotEqual(t, got["cache_salt"], other["cache_salt"])
+	})
+
+	t.Run("ok, client salt is replaced", func(t *testing.T) {
+		got := validate(t, key, secret, OpenAICompletionsPath, `{"model":"llama3.2:1b","prompt":"hi","cache_salt":"guess"}`)
+		rawSecret, err := base64.StdEncoding.DecodeString(secret)
+		require.NoError(t, err)
+		want := PromptCacheHandle(key, rawSecret, "llama3.2:1b", []byte(`"hi"`))
+		require.Equal(t, want, got["cache_salt"])
+	})
+
+	t.Run("ok, client salt is removed without a key", func(t *testing.T) {
+		got := validate(t, nil, secret, OpenAICompletionsPath, `{"model":"llama3.2:1b","prompt":"hi","cache_salt":"guess"}`)
+		require.NotContains(t, got, "cache_salt")
+	})
+
+	t.Run("ok, ollama requests are not salted", func(t *testing.T) {
+		got := validate(t, key, secret, OllamaChatPath, `{"model":"llama3.2:1b","messages":[{"role":"user","content":"hi"}]}`)
+		require.NotContains(t, got, "cache_salt")
+	})
+}
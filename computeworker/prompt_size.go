@@ -0,0 +1,125 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeworker
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// PromptSizeMessage is the message of the log record with the size of a validated request body,
+	// router_com picks it out of the forwarded worker logs to aggregate it.
+	PromptSizeMessage = "Prompt size"
+	// PromptSizeKey is the key of the PromptSize attribute of the record.
+	PromptSizeKey = "prompt_size"
+)
+
+// messageCountRequestHeader carries the number of messages of the request from the body validator
+// to the prompt size record, like requestedModelHeader it is only set on the decapsulated request.
+const messageCountRequestHeader = "X-Confsec-Internal-Message-Count"
+
+// MessageCounter is implemented by request bodies that are a list of messages, e.g. chat completions.
+type MessageCounter interface {
+	MessageCount() int
+}
+
+// PromptSize is the size of a validated request body. Both sizes are bucketed with BudgetBucket,
+// so the distribution of inputs can be tracked without the exact size of any prompt.
+type PromptSize struct {
+	BodyBytes int64
+	// Messages is 0 for bodies that aren't a list of messages.
+	Messages int64
+}
+
+// NewPromptSize buckets the size of a request body of bodyBytes bytes with messages messages.
+func NewPromptSize(bodyBytes int, messages int) PromptSize {
+	return PromptSize{
+		BodyBytes: BudgetBucket(int64(bodyBytes)),
+		Messages:  BudgetBucket(int64(messages)),
+	}
+}
+
+// promptSizeOf returns the prompt size of a request that passed validation with body body.
+func promptSizeOf(r *http.Request, body []byte) PromptSize {
+	messages, err := strconv.Atoi(r.Header.Get(messageCountRequestHeader))
+	if err != nil {
+		messages = 0
+	}
+	return NewPromptSize(len(body), messages)
+}
+
+// setMessageCount sets the message count of r, for bodies that are a list of messages.
+func setMessageCount(r *http.Request, requestBody any) {
+	counter, ok := requestBody.(MessageCounter)
+	if !ok {
+		return
+	}
+	r.Header.Set(messageCountRequestHeader, strconv.Itoa(counter.MessageCount()))
+}
+
+// LogValue logs the buckets. The keys stay clear of the keys debug redacts, e.g. "messages".
+func (s PromptSize) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int64("body_bytes", s.BodyBytes),
+		slog.Int64("message_count", s.Messages),
+	)
+}
+
+// ParsePromptSize parses the PromptSizeKey attribute of a prompt size record, also after the record
+// went through JSON. The sizes are bucketed again, so a record can never carry an exact size. It
+// returns false for other attributes.
+func ParsePromptSize(a slog.Attr) (PromptSize, bool) {
+	v := a.Value.Resolve()
+	if a.Key != PromptSizeKey || v.Kind() != slog.KindGroup {
+		return PromptSize{}, false
+	}
+
+	var (
+		s     PromptSize
+		found bool
+	)
+	for _, attr := range v.Group() {
+		var dst *int64
+		switch attr.Key {
+		case "body_bytes":
+			dst = &s.BodyBytes
+		case "message_count":
+			dst = &s.Messages
+		default:
+			continue
+		}
+		n, ok := attrFloat64(attr.Value.Resolve())
+		if !ok || n < 0 {
+			return PromptSize{}, false
+		}
+		*dst = BudgetBucket(int64(n))
+		found = true
+	}
+	return s, found
+}
+
+// MessageCount is the number of messages of the conversation.
+func (b *OpenAIRequestBodyChat) MessageCount() int {
+	return len(b.Messages)
+}
+
+// MessageCount is the number of messages of the conversation.
+func (b *OllamaRequestBodyChat) MessageCount() int {
+	return len(b.Messages)
+}
@@ -0,0 +1,80 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeworker
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromptSize(t *testing.T) {
+	size := NewPromptSize(1500, 3)
+	require.Equal(t, PromptSize{BodyBytes: 2048, Messages: 4}, size)
+	require.Equal(t, PromptSize{}, NewPromptSize(0, 0))
+
+	t.Run("ok, round trip through a json record", func(t *testing.T) {
+		var buf bytes.Buffer
+		slog.New(slog.NewJSONHandler(&buf, nil)).Info(PromptSizeMessage, PromptSizeKey, size)
+
+		var fields map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &fields))
+
+		attrs := []slog.Attr{}
+		for k, v := range fields[PromptSizeKey].(map[string]any) {
+			attrs = append(attrs, slog.Any(k, v))
+		}
+		got, ok := ParsePromptSize(slog.Attr{Key: PromptSizeKey, Value: slog.GroupValue(attrs...)})
+		require.True(t, ok)
+		require.Equal(t, size, got)
+	})
+
+	t.Run("ok, exact sizes are bucketed again", func(t *testing.T) {
+		got, ok := ParsePromptSize(slog.Group(PromptSizeKey, slog.Int64("body_bytes", 1500), slog.Int64("message_count", 3)))
+		require.True(t, ok)
+		require.Equal(t, size, got)
+	})
+
+	t.Run("fail, other attribute", func(t *testing.T) {
+		_, ok := ParsePromptSize(slog.Any("size", size))
+		require.False(t, ok)
+		_, ok = ParsePromptSize(slog.String(PromptSizeKey, "large"))
+		require.False(t, ok)
+		_, ok = ParsePromptSize(slog.Group(PromptSizeKey, slog.Int64("message_count", -1)))
+		require.False(t, ok)
+	})
+}
+
+func TestPromptSizeOf(t *testing.T) {
+	t.Run("ok, chat body", func(t *testing.T) {
+		r, err := http.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		require.NoError(t, err)
+		setMessageCount(r, &OpenAIRequestBodyChat{Messages: make([]OpenAIRequestBodyChatMessage, 5)})
+		require.Equal(t, PromptSize{BodyBytes: 128, Messages: 8}, promptSizeOf(r, make([]byte, 100)))
+	})
+
+	t.Run("ok, body without messages", func(t *testing.T) {
+		r, err := http.NewRequest(http.MethodPost, "/v1/completions", nil)
+		require.NoError(t, err)
+		setMessageCount(r, &OpenAIRequestBodyCompletions{Prompt: "hello"})
+		require.Equal(t, PromptSize{BodyBytes: 32}, promptSizeOf(r, make([]byte, 20)))
+	})
+}
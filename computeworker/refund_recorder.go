@@ -23,47 +23,105 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-
-	"github.com/openpcc/openpcc/anonpay/currency"
+	"math"
+	"slices"
+	"strings"
 )
 
 type refundRecorder interface {
 	Read(p []byte) (int, error)
 	Close() error
-	Refund(creditAmount int64) (currency.Value, error)
+	// Usage returns the usage the backend reported for the completed response.
+	Usage() (Usage, error)
+	// DeliveredUsage returns the output tokens that were delivered before the response ended early.
+	// Input tokens are not charged for aborted responses.
+	DeliveredUsage() Usage
+	// Aborted returns the error that ended the backend response early, nil if the response completed.
+	Aborted() error
+	// Migrated reports whether the response was ended early because the request is migrated to another node.
+	Migrated() bool
+	// Output returns the output text and the number of output tokens delivered so far.
+	Output() (string, int)
+	// Model returns the model the backend reported serving the response, empty if it reported none.
+	Model() string
+}
+
+// toolCallRecorder is implemented by refund recorders of responses that can end in tool calls.
+type toolCallRecorder interface {
+	// ToolCalls returns the IDs of the tool calls of the first choice, nil unless the response
+	// ended to call them.
+	ToolCalls() []string
 }
 
-func newRefundRecorder(path string, rc io.ReadCloser) refundRecorder {
+// newRefundRecorder creates a refund recorder for the response to a request on path. When migrate
+// is closed, the response ends at the next token boundary.
+func newRefundRecorder(path string, rc io.ReadCloser, migrate <-chan struct{}) refundRecorder {
 	switch path {
+	case VLLMRerankPath, VLLMRerankAliasPath:
+		return &rerankRefundRecorder{
+			r: rc,
+			c: rc,
+		}
+	case OpenAITranscriptionsPath:
+		return &transcriptionRefundRecorder{
+			rerankRefundRecorder: rerankRefundRecorder{
+				r: rc,
+				c: rc,
+			},
+		}
+	case OpenAIResponsesPath:
+		return &responsesRefundRecorder{
+			rerankRefundRecorder: rerankRefundRecorder{
+				r: rc,
+				c: rc,
+			},
+		}
 	case OpenAICompletionsPath, OpenAIChatPath:
 		return &openAIRefundRecorder{
-			line:     nil,
-			i:        0,
-			lastJSON: nil,
-			eof:      false,
-			r:        bufio.NewReader(rc),
-			c:        rc,
+			r:       bufio.NewReader(rc),
+			c:       rc,
+			migrate: migrate,
 		}
 	default:
 		// Default to Ollama format for /api/generate, /api/chat, etc.
 		return &ollamaRefundRecorder{
-			line: nil,
-			i:    0,
-			eof:  false,
-			r:    bufio.NewReader(rc),
-			c:    rc,
+			line:    nil,
+			i:       0,
+			eof:     false,
+			r:       bufio.NewReader(rc),
+			c:       rc,
+			migrate: migrate,
 		}
 	}
 }
 
+// migrationRequested reports whether migrate is closed, a nil channel is never closed.
+func migrationRequested(migrate <-chan struct{}) bool {
+	select {
+	case <-migrate:
+		return true
+	default:
+		return false
+	}
+}
+
 // ollamaRefundRecorder tracks the last line of an ollama response to be able
 // to record a refund.
 type ollamaRefundRecorder struct {
-	line []byte
-	i    int
-	eof  bool
-	r    *bufio.Reader
-	c    io.Closer
+	line     []byte
+	i        int
+	eof      bool
+	r        *bufio.Reader
+	c        io.Closer
+	tokens   int             // Output tokens read so far
+	output   strings.Builder // Output text read so far
+	abortErr error           // Error that ended the response early
+	migrate  <-chan struct{}
+	migrated bool
+	model    string // Model reported by the backend
+	// truncatedTokens are the estimated output tokens of a line the backend cut off mid-way, e.g.
+	// a non-streamed response.
+	truncatedTokens float64
 }
 
 func (r *ollamaRefundRecorder) Read(p []byte) (int, error) {
@@ -72,11 +130,19 @@ func (r *ollamaRefundRecorder) Read(p []byte) (int, error) {
 			return 0, io.EOF
 		}
 
+		if migrationRequested(r.migrate) {
+			r.migrated = true
+			r.eof = true
+			return 0, io.EOF
+		}
+
 		// read the next line from the reader
 		line, err := r.r.ReadBytes('\n')
 		if err != nil {
 			if err != io.EOF {
-				return len(line), err
+				// the backend failed mid-stream. End the response here, so it can still be
+				// completed with a footer that refunds the undelivered tokens.
+				r.abortErr = err
 			}
 			r.eof = true
 			if len(line) == 0 {
@@ -85,6 +151,15 @@ func (r *ollamaRefundRecorder) Read(p []byte) (int, error) {
 		}
 		r.line = line
 		r.i = 0
+		if r.model == "" {
+			r.model = responseModel(line)
+		}
+		if text := ollamaLineOutput(line); text != "" {
+			r.tokens++
+			r.output.WriteString(text)
+		} else if r.abortErr != nil {
+			r.truncatedTokens = truncatedOutputTokens(line, "response", "content")
+		}
 	}
 
 	n := copy(p, r.line[r.i:])
@@ -92,35 +167,70 @@ func (r *ollamaRefundRecorder) Read(p []byte) (int, error) {
 	return n, nil
 }
 
+// ollamaLineOutput returns the output text in a line of an ollama response, ollama streams
+// a single token per line.
+func ollamaLineOutput(line []byte) string {
+	var chunk struct {
+		Response string `json:"response"`
+		Message  struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(line, &chunk); err != nil {
+		return ""
+	}
+	return chunk.Response + chunk.Message.Content
+}
+
+func (r *ollamaRefundRecorder) Aborted() error {
+	return r.abortErr
+}
+
+func (r *ollamaRefundRecorder) Migrated() bool {
+	return r.migrated
+}
+
+func (r *ollamaRefundRecorder) Output() (string, int) {
+	return r.output.String(), r.tokens
+}
+
+func (r *ollamaRefundRecorder) Model() string {
+	return r.model
+}
+
+// DeliveredUsage counts the delivered lines, ollama doesn't report usage before the response is done
+// and streams a single token per line.
+func (r *ollamaRefundRecorder) DeliveredUsage() Usage {
+	return Usage{OutputTokens: float64(r.tokens) + r.truncatedTokens}
+}
+
 func (r *ollamaRefundRecorder) Close() error {
 	return r.c.Close()
 }
 
-func (r *ollamaRefundRecorder) Refund(creditAmount int64) (currency.Value, error) {
+func (r *ollamaRefundRecorder) Usage() (Usage, error) {
 	var responseData map[string]any
 	if err := json.Unmarshal(r.line, &responseData); err != nil {
-		return currency.Zero, fmt.Errorf("failed to parse last line of JSON response: %w", err)
+		return Usage{}, fmt.Errorf("failed to parse last line of JSON response: %w", err)
 	}
 
 	numInputTokens, ok := responseData["prompt_eval_count"].(float64)
 	if !ok {
-		return currency.Zero, fmt.Errorf("failed to get prompt_eval_count from JSON response: %w", errNoRefundAvailable)
+		return Usage{}, fmt.Errorf("failed to get prompt_eval_count from JSON response: %w", errNoRefundAvailable)
 	}
 	numOutputTokens, ok := responseData["eval_count"].(float64)
 	if !ok {
-		return currency.Zero, fmt.Errorf("failed to get eval_count from JSON response: %w", errNoRefundAvailable)
+		return Usage{}, fmt.Errorf("failed to get eval_count from JSON response: %w", errNoRefundAvailable)
 	}
 
-	refund, err := calculateRefund(numInputTokens, numOutputTokens, creditAmount)
-	if err != nil {
-		return currency.Zero, err
-	}
-
-	return refund, nil
+	return Usage{InputTokens: numInputTokens, OutputTokens: numOutputTokens}, nil
 }
 
-// openAIRefundRecorder tracks the last line of an openAI response to be able
-// to record a refund.
+// maxOpenAIResponseSize caps how much of a non-streaming openAI response is buffered to find its usage.
+const maxOpenAIResponseSize = 4 * 1024 * 1024
+
+// openAIRefundRecorder parses an openAI response to be able to record a refund. Streaming
+// responses are parsed as server-sent events, other responses are a single JSON object.
 type openAIRefundRecorder struct {
 	line     []byte // Current line being read
 	i        int    // Position in current line
@@ -128,6 +238,28 @@ type openAIRefundRecorder struct {
 	eof      bool
 	r        *bufio.Reader
 	c        io.Closer
+	tokens   int             // Output tokens read so far
+	output   strings.Builder // Output text of the first choice read so far
+	abortErr error           // Error that ended the response early
+	migrate  <-chan struct{}
+	migrated bool
+	model    string // Model reported by the backend
+	// stream and object are set by the first non-blank line, which tells an event stream from a
+	// JSON object.
+	stream bool
+	object bool
+	sse    sseParser
+	// body is the buffered JSON object of a non-streaming response.
+	body     bytes.Buffer
+	overflow bool
+	// toolCallIDs are the tool calls of the first choice, toolCallsFinished is set when it ended to
+	// call them.
+	toolCallIDs       []string
+	toolCallsFinished bool
+	// reportedOutputTokens are the output tokens of the last chunk that reported usage, see
+	// OpenAIRequestBodyStreamOptions.
+	reportedOutputTokens float64
+	usageReported        bool
 }
 
 func (r *openAIRefundRecorder) Read(p []byte) (int, error) {
@@ -136,28 +268,28 @@ func (r *openAIRefundRecorder) Read(p []byte) (int, error) {
 			return 0, io.EOF
 		}
 
+		// events are delivered whole, so the tokens of a migrated response are the tokens of its events.
+		if !r.sse.pending() && migrationRequested(r.migrate) {
+			r.migrated = true
+			r.eof = true
+			return 0, io.EOF
+		}
+
 		// read the next line from the reader
-		line, err := r.r.ReadBytes('\n')
+		line, err := readSSELine(r.r)
 		if err != nil {
 			if err != io.EOF {
-				return len(line), err
+				// the backend failed mid-stream. End the response here, so it can still be
+				// completed with a footer that refunds the undelivered tokens.
+				r.abortErr = err
 			}
 			r.eof = true
-			if len(line) == 0 {
-				return 0, io.EOF
-			}
 		}
 		r.line = line
 		r.i = 0
-
-		// Extract JSON for refund calculation (like the original logic)
-		trimmedLine := bytes.TrimSpace(line)
-		trimmedLine = bytes.TrimPrefix(trimmedLine, []byte("data: "))
-		if len(trimmedLine) > 0 && !bytes.Equal(trimmedLine, []byte("[DONE]")) &&
-			bytes.HasPrefix(trimmedLine, []byte("{")) && bytes.HasSuffix(trimmedLine, []byte("}")) {
-			// Store the JSON part for later refund calculation
-			r.lastJSON = make([]byte, len(trimmedLine))
-			copy(r.lastJSON, trimmedLine)
+		r.record(line)
+		if len(line) == 0 {
+			return 0, io.EOF
 		}
 	}
 
@@ -166,33 +298,500 @@ func (r *openAIRefundRecorder) Read(p []byte) (int, error) {
 	return n, nil
 }
 
+// record parses a line of the response, the line is passed on unchanged.
+func (r *openAIRefundRecorder) record(line []byte) {
+	if !r.stream && !r.object {
+		trimmed := bytes.TrimLeft(line, " \t\r\n\xef\xbb\xbf")
+		r.object = len(trimmed) > 0 && trimmed[0] == '{'
+		r.stream = len(trimmed) > 0 && !r.object
+	}
+
+	if r.object {
+		if !r.overflow {
+			if r.body.Len()+len(line) > maxOpenAIResponseSize {
+				r.overflow = true
+				r.body.Reset()
+			} else {
+				r.body.Write(line)
+			}
+		}
+		if r.eof && !r.overflow {
+			r.recordChunk(bytes.TrimSpace(r.body.Bytes()))
+		}
+		return
+	}
+
+	event, ok := r.sse.parseLine(line)
+	if !ok || !event.isMessage() {
+		// named events, e.g. errors, don't carry completion chunks.
+		return
+	}
+	r.recordChunk(bytes.TrimSpace(event.Data))
+}
+
+// recordChunk records the usage, model and output of a JSON chunk, or of a whole non-streaming response.
+func (r *openAIRefundRecorder) recordChunk(chunk []byte) {
+	if !bytes.HasPrefix(chunk, []byte("{")) || !bytes.HasSuffix(chunk, []byte("}")) {
+		// e.g. the [DONE] sentinel.
+		return
+	}
+
+	// Store the JSON part for later refund calculation
+	r.lastJSON = bytes.Clone(chunk)
+	if r.model == "" {
+		r.model = responseModel(chunk)
+	}
+	tokens, text := openAIChunkOutput(chunk)
+	r.tokens += tokens
+	r.output.WriteString(text)
+	if bytes.Contains(chunk, []byte(`"usage"`)) {
+		r.recordUsage(chunk)
+	}
+	// most chunks don't mention tool calls, they are not decoded again.
+	if bytes.Contains(chunk, []byte("tool_calls")) {
+		r.recordToolCalls(chunk)
+	}
+}
+
+// recordUsage records the output tokens of a chunk that reports usage. With continuous usage stats,
+// every chunk reports the usage of the response so far.
+func (r *openAIRefundRecorder) recordUsage(chunk []byte) {
+	var data struct {
+		Usage *struct {
+			CompletionTokens *float64 `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(chunk, &data); err != nil || data.Usage == nil || data.Usage.CompletionTokens == nil {
+		return
+	}
+	r.reportedOutputTokens = *data.Usage.CompletionTokens
+	r.usageReported = true
+}
+
+// recordToolCalls records the tool calls of the first choice of a chunk. Streaming responses send
+// the ID of a tool call in its first delta only.
+func (r *openAIRefundRecorder) recordToolCalls(chunk []byte) {
+	type toolCall struct {
+		ID string `json:"id"`
+	}
+	var data struct {
+		Choices []struct {
+			Index        int    `json:"index"`
+			FinishReason string `json:"finish_reason"`
+			Delta        struct {
+				ToolCalls []toolCall `json:"tool_calls"`
+			} `json:"delta"`
+			Message struct {
+				ToolCalls []toolCall `json:"tool_calls"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(chunk, &data); err != nil {
+		return
+	}
+
+	for _, choice := range data.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		for _, call := range slices.Concat(choice.Delta.ToolCalls, choice.Message.ToolCalls) {
+			if call.ID != "" && len(r.toolCallIDs) < maxContinuations && !slices.Contains(r.toolCallIDs, call.ID) {
+				r.toolCallIDs = append(r.toolCallIDs, call.ID)
+			}
+		}
+		r.toolCallsFinished = r.toolCallsFinished || choice.FinishReason == "tool_calls"
+	}
+}
+
+// responseModel returns the model a JSON object of a backend response reports, both ollama and
+// openAI responses report it in the model field of every chunk.
+func responseModel(chunk []byte) string {
+	var data struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(chunk, &data); err != nil {
+		return ""
+	}
+	return data.Model
+}
+
+// openAIChunkOutput returns the number of output tokens and the output text of the first
+// choice in a chunk of a streaming openAI response, every choice in a chunk carries a single token.
+func openAIChunkOutput(chunk []byte) (int, string) {
+	var data struct {
+		Choices []struct {
+			Index int    `json:"index"`
+			Text  string `json:"text"`
+			Delta struct {
+				Content string `json:"content"`
+			} `json:"delta"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(chunk, &data); err != nil {
+		return 0, ""
+	}
+
+	tokens := 0
+	text := ""
+	for _, choice := range data.Choices {
+		if choice.Text != "" || choice.Delta.Content != "" {
+			tokens++
+		}
+		if choice.Index == 0 {
+			text += choice.Text + choice.Delta.Content
+		}
+	}
+	return tokens, text
+}
+
+func (r *openAIRefundRecorder) Aborted() error {
+	return r.abortErr
+}
+
+func (r *openAIRefundRecorder) Migrated() bool {
+	return r.migrated
+}
+
+func (r *openAIRefundRecorder) Output() (string, int) {
+	return r.output.String(), r.tokens
+}
+
+func (r *openAIRefundRecorder) Model() string {
+	return r.model
+}
+
+func (r *openAIRefundRecorder) ToolCalls() []string {
+	if !r.toolCallsFinished {
+		return nil
+	}
+	return r.toolCallIDs
+}
+
+// DeliveredUsage prefers the usage the backend reported with the last chunk. Without it, the tokens
+// of the delivered chunks are counted, or estimated from the text of a non-streamed response that was
+// cut off.
+func (r *openAIRefundRecorder) DeliveredUsage() Usage {
+	switch {
+	case r.usageReported:
+		return Usage{OutputTokens: r.reportedOutputTokens}
+	case r.object && r.abortErr != nil && !r.overflow:
+		return Usage{OutputTokens: truncatedOutputTokens(r.body.Bytes(), "content", "text")}
+	default:
+		return Usage{OutputTokens: float64(r.tokens)}
+	}
+}
+
 func (r *openAIRefundRecorder) Close() error {
 	return r.c.Close()
 }
 
-func (r *openAIRefundRecorder) Refund(creditAmount int64) (currency.Value, error) {
+func (r *openAIRefundRecorder) Usage() (Usage, error) {
 	var responseData map[string]any
 	if err := json.Unmarshal(r.lastJSON, &responseData); err != nil {
-		return currency.Zero, fmt.Errorf("failed to parse last line of JSON response: %w", err)
+		return Usage{}, fmt.Errorf("failed to parse last line of JSON response: %w", err)
 	}
 
 	usage, ok := responseData["usage"].(map[string]any)
 	if !ok {
-		return currency.Zero, fmt.Errorf("failed to get usage from JSON response: %w", errNoRefundAvailable)
+		return Usage{}, fmt.Errorf("failed to get usage from JSON response: %w", errNoRefundAvailable)
 	}
 	numInputTokens, ok := usage["prompt_tokens"].(float64)
 	if !ok {
-		return currency.Zero, fmt.Errorf("failed to get prompt_tokens from JSON response: %w", errNoRefundAvailable)
+		return Usage{}, fmt.Errorf("failed to get prompt_tokens from JSON response: %w", errNoRefundAvailable)
 	}
 	numOutputTokens, ok := usage["completion_tokens"].(float64)
 	if !ok {
-		return currency.Zero, fmt.Errorf("failed to get completion_tokens from JSON response: %w", errNoRefundAvailable)
+		return Usage{}, fmt.Errorf("failed to get completion_tokens from JSON response: %w", errNoRefundAvailable)
 	}
 
-	refund, err := calculateRefund(numInputTokens, numOutputTokens, creditAmount)
+	return Usage{InputTokens: numInputTokens, OutputTokens: numOutputTokens}, nil
+}
+
+// truncatedOutputTokens estimates the output tokens of a JSON response that was cut off, from the
+// string values of the given keys. A value that was cut off counts up to the cut.
+func truncatedOutputTokens(body []byte, keys ...string) float64 {
+	type frame struct {
+		object    bool
+		expectKey bool
+	}
+	var (
+		frames    []frame
+		outputKey bool // the last key is one of keys
+		output    int
+	)
+	// value ends a value of the innermost object, its next string is a key again.
+	value := func() {
+		if len(frames) > 0 && frames[len(frames)-1].object {
+			frames[len(frames)-1].expectKey = true
+		}
+		outputKey = false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			// the response was cut off in the value of an output key.
+			if outputKey {
+				output += len(body) - int(offset)
+			}
+			return float64(EstimatePromptTokens(output))
+		}
+
+		top := len(frames) - 1
+		switch tok := tok.(type) {
+		case json.Delim:
+			switch tok {
+			case '{', '[':
+				outputKey = false
+				frames = append(frames, frame{object: tok == '{', expectKey: tok == '{'})
+			default:
+				frames = frames[:top]
+				value()
+			}
+		case string:
+			if top >= 0 && frames[top].object && frames[top].expectKey {
+				frames[top].expectKey = false
+				outputKey = slices.Contains(keys, tok)
+				continue
+			}
+			if outputKey {
+				output += len(tok)
+			}
+			value()
+		default:
+			value()
+		}
+	}
+}
+
+// maxErrorBodySize caps the error body of a failed backend response that is passed on to the client.
+const maxErrorBodySize = 16 * 1024
+
+// errorRefundRecorder passes on the error body of a failed backend response. Failed responses are
+// refunded in full, so the body is not parsed for usage. The body is buffered up front, which also
+// gives error bodies that the backend streamed without a Content-Length a known length.
+type errorRefundRecorder struct {
+	r *bytes.Reader
+	// truncated is true when the error body exceeded maxErrorBodySize.
+	truncated bool
+	// readErr is the error that ended reading the error body early, nil if it was read completely.
+	readErr error
+}
+
+// newErrorRefundRecorder buffers up to maxErrorBodySize bytes of the error body in rc and closes rc.
+func newErrorRefundRecorder(rc io.ReadCloser) (*errorRefundRecorder, error) {
+	b, readErr := io.ReadAll(io.LimitReader(rc, maxErrorBodySize+1))
+	if err := rc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close error body: %w", err)
+	}
+
+	truncated := len(b) > maxErrorBodySize
+	if truncated {
+		b = b[:maxErrorBodySize]
+	}
+
+	return &errorRefundRecorder{
+		r:         bytes.NewReader(b),
+		truncated: truncated,
+		readErr:   readErr,
+	}, nil
+}
+
+func (r *errorRefundRecorder) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+// Len returns the size of the buffered error body.
+func (r *errorRefundRecorder) Len() int64 {
+	return r.r.Size()
+}
+
+func (*errorRefundRecorder) Close() error {
+	return nil
+}
+
+// Usage returns no usage, failed responses are refunded in full.
+func (*errorRefundRecorder) Usage() (Usage, error) {
+	return Usage{}, nil
+}
+
+func (*errorRefundRecorder) DeliveredUsage() Usage {
+	return Usage{}
+}
+
+// Aborted returns nil, an error body that ends early is still passed on as far as it was read.
+func (*errorRefundRecorder) Aborted() error {
+	return nil
+}
+
+func (*errorRefundRecorder) Migrated() bool {
+	return false
+}
+
+func (*errorRefundRecorder) Model() string {
+	return ""
+}
+
+func (*errorRefundRecorder) Output() (string, int) {
+	return "", 0
+}
+
+// maxRerankResponseSize caps how much of a rerank response is buffered to find its usage.
+const maxRerankResponseSize = 4 * 1024 * 1024
+
+// rerankRefundRecorder buffers a vLLM rerank response to find its usage. Rerank responses are
+// not streamed, the usage is part of the single JSON object. Reranking only consumes input
+// tokens and can't be migrated.
+type rerankRefundRecorder struct {
+	r    io.Reader
+	c    io.Closer
+	body bytes.Buffer
+	// overflow is true when the response exceeded maxRerankResponseSize.
+	overflow bool
+	eof      bool
+	abortErr error // Error that ended the response early
+}
+
+func (r *rerankRefundRecorder) Read(p []byte) (int, error) {
+	if r.eof {
+		return 0, io.EOF
+	}
+
+	n, err := r.r.Read(p)
+	if !r.overflow {
+		if r.body.Len()+n > maxRerankResponseSize {
+			r.overflow = true
+			r.body.Reset()
+		} else {
+			r.body.Write(p[:n])
+		}
+	}
 	if err != nil {
-		return currency.Zero, err
+		if err != io.EOF {
+			// the backend failed mid-response, end the response so it can still be completed
+			// with a footer.
+			r.abortErr = err
+		}
+		r.eof = true
+		if n > 0 {
+			return n, nil
+		}
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (r *rerankRefundRecorder) Aborted() error {
+	return r.abortErr
+}
+
+func (*rerankRefundRecorder) Migrated() bool {
+	return false
+}
+
+func (*rerankRefundRecorder) Output() (string, int) {
+	return "", 0
+}
+
+func (r *rerankRefundRecorder) Model() string {
+	if r.overflow {
+		return ""
+	}
+	return responseModel(r.body.Bytes())
+}
+
+func (*rerankRefundRecorder) DeliveredUsage() Usage {
+	return Usage{}
+}
+
+func (r *rerankRefundRecorder) Close() error {
+	return r.c.Close()
+}
+
+func (r *rerankRefundRecorder) Usage() (Usage, error) {
+	if r.overflow {
+		return Usage{}, fmt.Errorf("rerank response exceeds %d bytes: %w", maxRerankResponseSize, errNoRefundAvailable)
+	}
+
+	var responseData map[string]any
+	if err := json.Unmarshal(r.body.Bytes(), &responseData); err != nil {
+		return Usage{}, fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+
+	usage, ok := responseData["usage"].(map[string]any)
+	if !ok {
+		return Usage{}, fmt.Errorf("failed to get usage from JSON response: %w", errNoRefundAvailable)
+	}
+	// older vLLM versions only report total_tokens for rerank, all of them are input tokens.
+	numInputTokens, ok := usage["prompt_tokens"].(float64)
+	if !ok {
+		numInputTokens, ok = usage["total_tokens"].(float64)
+	}
+	if !ok {
+		return Usage{}, fmt.Errorf("failed to get total_tokens from JSON response: %w", errNoRefundAvailable)
+	}
+
+	return Usage{InputTokens: numInputTokens}, nil
+}
+
+// transcriptionRefundRecorder buffers a transcription response to find its usage, like
+// rerankRefundRecorder. Depending on the backend, the usage is reported in tokens or as the
+// duration of the audio.
+type transcriptionRefundRecorder struct {
+	rerankRefundRecorder
+}
+
+// DeliveredUsage estimates the output tokens from the text of a transcription that was cut off.
+func (r *transcriptionRefundRecorder) DeliveredUsage() Usage {
+	if r.overflow {
+		return Usage{}
+	}
+	return Usage{OutputTokens: truncatedOutputTokens(r.body.Bytes(), "text")}
+}
+
+func (r *transcriptionRefundRecorder) Usage() (Usage, error) {
+	if r.overflow {
+		return Usage{}, fmt.Errorf("transcription response exceeds %d bytes: %w", maxRerankResponseSize, errNoRefundAvailable)
+	}
+
+	var responseData map[string]any
+	if err := json.Unmarshal(r.body.Bytes(), &responseData); err != nil {
+		return Usage{}, fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+
+	return transcriptionUsage(responseData)
+}
+
+// transcriptionUsage returns the usage of a transcription response. When only the duration of the
+// audio is known, the output tokens are estimated from the transcribed text.
+func transcriptionUsage(responseData map[string]any) (Usage, error) {
+	usage, _ := responseData["usage"].(map[string]any)
+	if usage["type"] == "tokens" {
+		numInputTokens, ok := usage["input_tokens"].(float64)
+		if !ok {
+			return Usage{}, fmt.Errorf("failed to get input_tokens from JSON response: %w", errNoRefundAvailable)
+		}
+		numOutputTokens, ok := usage["output_tokens"].(float64)
+		if !ok {
+			return Usage{}, fmt.Errorf("failed to get output_tokens from JSON response: %w", errNoRefundAvailable)
+		}
+		return Usage{InputTokens: numInputTokens, OutputTokens: numOutputTokens}, nil
+	}
+
+	// verbose_json responses of backends without usage report the duration at the top level.
+	seconds, ok := usage["seconds"].(float64)
+	if !ok {
+		seconds, ok = responseData["duration"].(float64)
+	}
+	if !ok {
+		return Usage{}, fmt.Errorf("failed to get duration from JSON response: %w", errNoRefundAvailable)
 	}
 
-	return refund, nil
+	text, _ := responseData["text"].(string)
+	return Usage{
+		AudioSeconds: math.Ceil(seconds),
+		OutputTokens: float64(EstimatePromptTokens(len(text))),
+	}, nil
 }
@@ -23,11 +23,22 @@ import (
 	"io"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/openpcc/openpcc/anonpay/currency"
 	"github.com/stretchr/testify/require"
 )
 
+// recordedRefund prices the usage recorded for a completed response to a request on path with
+// the default pricing.
+func recordedRefund(recorder refundRecorder, path string, creditAmount int64) (currency.Value, error) {
+	usage, err := recorder.Usage()
+	if err != nil {
+		return currency.Zero, err
+	}
+	return newPricingEngine(nil).refund(path, usage, creditAmount)
+}
+
 func TestOllamaRefundRecorderRead(t *testing.T) {
 	testCases := []struct {
 		name           string
@@ -62,7 +73,7 @@ func TestOllamaRefundRecorderRead(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			rc := io.NopCloser(strings.NewReader(tc.input))
-			recorder := newRefundRecorder("/api/generate", rc).(*ollamaRefundRecorder)
+			recorder := newRefundRecorder("/api/generate", rc, nil).(*ollamaRefundRecorder)
 
 			output, err := io.ReadAll(recorder)
 			require.NoError(t, err)
@@ -151,13 +162,13 @@ invalid json line
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			rc := io.NopCloser(strings.NewReader(tc.input))
-			recorder := newRefundRecorder("/api/generate", rc).(*ollamaRefundRecorder)
+			recorder := newRefundRecorder("/api/generate", rc, nil).(*ollamaRefundRecorder)
 
 			// Read all data to populate the last line
 			_, err := io.ReadAll(recorder)
 			require.NoError(t, err)
 
-			refund, err := recorder.Refund(tc.creditAmount)
+			refund, err := recordedRefund(recorder, OllamaGeneratePath, tc.creditAmount)
 
 			if tc.wantErr {
 				require.Error(t, err)
@@ -166,7 +177,7 @@ invalid json line
 			} else {
 				require.NoError(t, err)
 				// Just verify that we got a valid refund (non-error), not checking exact amount
-				// since calculateRefund involves randomness
+				// since the refund is rounded randomly
 			}
 
 			err = recorder.Close()
@@ -357,7 +368,7 @@ data: [DONE]
 			_, err := io.ReadAll(recorder)
 			require.NoError(t, err)
 
-			refund, err := recorder.Refund(tc.creditAmount)
+			refund, err := recordedRefund(recorder, OpenAIChatPath, tc.creditAmount)
 
 			if tc.wantErr {
 				require.Error(t, err)
@@ -366,7 +377,7 @@ data: [DONE]
 			} else {
 				require.NoError(t, err)
 				// Just verify that we got a valid refund (non-error), not checking exact amount
-				// since calculateRefund involves randomness
+				// since the refund is rounded randomly
 			}
 
 			err = recorder.Close()
@@ -375,6 +386,240 @@ data: [DONE]
 	}
 }
 
+func TestOpenAIRefundRecorderFraming(t *testing.T) {
+	// chunks as vLLM streams them, the last chunk carries the usage when stream_options.include_usage is set.
+	hello := `{"id":"cmpl-1","object":"chat.completion.chunk","created":1737000000,"model":"llama3.2:1b","choices":[{"index":0,"delta":{"content":"Hello"}}]}`
+	world := `{"id":"cmpl-1","object":"chat.completion.chunk","created":1737000000,"model":"llama3.2:1b","choices":[{"index":0,"delta":{"content":" world"}}]}`
+	usage := `{"id":"cmpl-1","object":"chat.completion.chunk","created":1737000000,"model":"llama3.2:1b","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`
+
+	testCases := []struct {
+		name       string
+		input      string
+		wantOutput string
+		wantTokens int
+		wantUsage  Usage
+		wantErr    bool
+	}{
+		{
+			name:       "lf",
+			input:      "data: " + hello + "\n\ndata: " + world + "\n\ndata: " + usage + "\n\ndata: [DONE]\n\n",
+			wantOutput: "Hello world",
+			wantTokens: 2,
+			wantUsage:  Usage{InputTokens: 10, OutputTokens: 2},
+		},
+		{
+			name:       "crlf",
+			input:      "data: " + hello + "\r\n\r\ndata: " + world + "\r\n\r\ndata: " + usage + "\r\n\r\ndata: [DONE]\r\n\r\n",
+			wantOutput: "Hello world",
+			wantTokens: 2,
+			wantUsage:  Usage{InputTokens: 10, OutputTokens: 2},
+		},
+		{
+			name:       "multi_line_data",
+			input:      "data: " + hello + "\n\ndata: {\"id\":\"cmpl-1\",\ndata: \"choices\":[],\ndata: \"usage\":{\"prompt_tokens\":10,\"completion_tokens\":1}}\n\n",
+			wantOutput: "Hello",
+			wantTokens: 1,
+			wantUsage:  Usage{InputTokens: 10, OutputTokens: 1},
+		},
+		{
+			name:       "comments_and_named_events",
+			input:      ": ping\n\ndata: " + hello + "\n\nevent: error\ndata: {\"error\":{\"message\":\"overloaded\"},\"usage\":{\"prompt_tokens\":1,\"completion_tokens\":1}}\n\ndata: " + usage + "\n\n",
+			wantOutput: "Hello",
+			wantTokens: 1,
+			wantUsage:  Usage{InputTokens: 10, OutputTokens: 2},
+		},
+		{
+			name:       "unterminated_event",
+			input:      "data: " + hello + "\n\ndata: " + usage + "\n",
+			wantOutput: "Hello",
+			wantTokens: 1,
+			wantErr:    true,
+		},
+		{
+			name:      "non_streaming",
+			input:     `{"id":"cmpl-1","object":"chat.completion","model":"llama3.2:1b","choices":[{"index":0,"message":{"role":"assistant","content":"Hello world"}}],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`,
+			wantUsage: Usage{InputTokens: 10, OutputTokens: 2},
+		},
+		{
+			name: "non_streaming_pretty_printed",
+			input: `{
+  "id": "cmpl-1",
+  "object": "chat.completion",
+  "model": "llama3.2:1b",
+  "usage": {
+    "prompt_tokens": 10,
+    "completion_tokens": 2
+  }
+}
+`,
+			wantUsage: Usage{InputTokens: 10, OutputTokens: 2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rc := io.NopCloser(strings.NewReader(tc.input))
+			recorder := newRefundRecorder(OpenAIChatPath, rc, nil).(*openAIRefundRecorder)
+
+			output, err := io.ReadAll(recorder)
+			require.NoError(t, err)
+			require.Equal(t, tc.input, string(output))
+			require.Equal(t, "llama3.2:1b", recorder.Model())
+
+			text, tokens := recorder.Output()
+			require.Equal(t, tc.wantOutput, text)
+			require.Equal(t, tc.wantTokens, tokens)
+
+			usage, err := recorder.Usage()
+			if tc.wantErr {
+				require.ErrorIs(t, err, errNoRefundAvailable)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tc.wantUsage, usage)
+			}
+			require.NoError(t, recorder.Close())
+		})
+	}
+}
+
+func TestRerankRefundRecorderRefund(t *testing.T) {
+	testCases := []struct {
+		name        string
+		input       string
+		wantErr     bool
+		errContains string
+	}{
+		{
+			name:  "valid_response_with_usage",
+			input: `{"id":"rerank-123","model":"llama3.2:1b","usage":{"total_tokens":30},"results":[{"index":0,"document":{"text":"Paris"},"relevance_score":0.99}]}`,
+		},
+		{
+			name:  "valid_response_with_prompt_tokens",
+			input: `{"id":"rerank-123","model":"llama3.2:1b","usage":{"prompt_tokens":30,"total_tokens":30},"results":[]}`,
+		},
+		{
+			name:        "response_without_usage",
+			input:       `{"id":"rerank-123","model":"llama3.2:1b","results":[]}`,
+			wantErr:     true,
+			errContains: "no refund available",
+		},
+		{
+			name:        "total_tokens_wrong_type",
+			input:       `{"id":"rerank-123","usage":{"total_tokens":"not_a_number"}}`,
+			wantErr:     true,
+			errContains: "no refund available",
+		},
+		{
+			name:        "invalid_json",
+			input:       `{"id":"rerank-123","usage":`,
+			wantErr:     true,
+			errContains: "failed to parse JSON response",
+		},
+		{
+			name:        "oversized_response",
+			input:       `{"usage":{"total_tokens":30},"results":"` + strings.Repeat("a", maxRerankResponseSize) + `"}`,
+			wantErr:     true,
+			errContains: "no refund available",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rc := io.NopCloser(iotest.HalfReader(strings.NewReader(tc.input)))
+			recorder := newRefundRecorder(VLLMRerankPath, rc, nil)
+
+			// the response is passed on unchanged.
+			body, err := io.ReadAll(recorder)
+			require.NoError(t, err)
+			require.Equal(t, tc.input, string(body))
+
+			refund, err := recordedRefund(recorder, VLLMRerankPath, 1000)
+			if tc.wantErr {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.errContains)
+				require.Equal(t, currency.Zero, refund)
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, recorder.Aborted())
+			require.False(t, recorder.Migrated())
+			require.NoError(t, recorder.Close())
+		})
+	}
+}
+
+func TestTranscriptionRefundRecorderRefund(t *testing.T) {
+	testCases := []struct {
+		name        string
+		input       string
+		wantErr     bool
+		errContains string
+	}{
+		{
+			name:  "valid_response_with_duration_usage",
+			input: `{"text":"Hello world.","usage":{"type":"duration","seconds":3}}`,
+		},
+		{
+			name:  "valid_response_with_token_usage",
+			input: `{"text":"Hello world.","usage":{"type":"tokens","input_tokens":150,"output_tokens":4,"total_tokens":154}}`,
+		},
+		{
+			name:  "verbose_json_response_with_duration",
+			input: `{"task":"transcribe","language":"english","duration":2.5,"text":"Hello world.","segments":[]}`,
+		},
+		{
+			name:        "response_without_usage",
+			input:       `{"text":"Hello world."}`,
+			wantErr:     true,
+			errContains: "no refund available",
+		},
+		{
+			name:        "token_usage_without_output_tokens",
+			input:       `{"text":"Hello world.","usage":{"type":"tokens","input_tokens":150}}`,
+			wantErr:     true,
+			errContains: "no refund available",
+		},
+		{
+			name:        "usage_exceeds_credits",
+			input:       `{"text":"Hello world.","usage":{"type":"duration","seconds":1000000000}}`,
+			wantErr:     true,
+			errContains: "no refund available",
+		},
+		{
+			name:        "invalid_json",
+			input:       `{"text":"Hello`,
+			wantErr:     true,
+			errContains: "failed to parse JSON response",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rc := io.NopCloser(iotest.HalfReader(strings.NewReader(tc.input)))
+			recorder := newRefundRecorder(OpenAITranscriptionsPath, rc, nil)
+
+			// the response is passed on unchanged.
+			body, err := io.ReadAll(recorder)
+			require.NoError(t, err)
+			require.Equal(t, tc.input, string(body))
+
+			refund, err := recordedRefund(recorder, OpenAITranscriptionsPath, 1000)
+			if tc.wantErr {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.errContains)
+				require.Equal(t, currency.Zero, refund)
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, recorder.Aborted())
+			require.False(t, recorder.Migrated())
+			require.NoError(t, recorder.Close())
+		})
+	}
+}
+
 func TestNewRefundRecorder(t *testing.T) {
 	testCases := []struct {
 		name         string
@@ -401,12 +646,32 @@ func TestNewRefundRecorder(t *testing.T) {
 			path:         "/v1/chat/completions",
 			expectedType: "*computeworker.openAIRefundRecorder",
 		},
+		{
+			name:         "vllm_rerank_path",
+			path:         "/v1/rerank",
+			expectedType: "*computeworker.rerankRefundRecorder",
+		},
+		{
+			name:         "vllm_rerank_alias_path",
+			path:         "/rerank",
+			expectedType: "*computeworker.rerankRefundRecorder",
+		},
+		{
+			name:         "openai_transcriptions_path",
+			path:         "/v1/audio/transcriptions",
+			expectedType: "*computeworker.transcriptionRefundRecorder",
+		},
+		{
+			name:         "openai_responses_path",
+			path:         "/v1/responses",
+			expectedType: "*computeworker.responsesRefundRecorder",
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			rc := io.NopCloser(strings.NewReader("test"))
-			recorder := newRefundRecorder(tc.path, rc)
+			recorder := newRefundRecorder(tc.path, rc, nil)
 
 			require.NotNil(t, recorder)
 			require.Implements(t, (*refundRecorder)(nil), recorder)
@@ -419,6 +684,15 @@ func TestNewRefundRecorder(t *testing.T) {
 			case "*computeworker.openAIRefundRecorder":
 				_, ok := recorder.(*openAIRefundRecorder)
 				require.True(t, ok, "Expected openAIRefundRecorder but got %T", recorder)
+			case "*computeworker.rerankRefundRecorder":
+				_, ok := recorder.(*rerankRefundRecorder)
+				require.True(t, ok, "Expected rerankRefundRecorder but got %T", recorder)
+			case "*computeworker.transcriptionRefundRecorder":
+				_, ok := recorder.(*transcriptionRefundRecorder)
+				require.True(t, ok, "Expected transcriptionRefundRecorder but got %T", recorder)
+			case "*computeworker.responsesRefundRecorder":
+				_, ok := recorder.(*responsesRefundRecorder)
+				require.True(t, ok, "Expected responsesRefundRecorder but got %T", recorder)
 			}
 
 			err := recorder.Close()
@@ -432,7 +706,7 @@ func TestRefundRecorderReadInChunks(t *testing.T) {
 		input := `{"model":"llama3.2:1b","response":"Hello world","done":true,"prompt_eval_count":10,"eval_count":5}
 `
 		rc := io.NopCloser(strings.NewReader(input))
-		recorder := newRefundRecorder("/api/generate", rc)
+		recorder := newRefundRecorder("/api/generate", rc, nil)
 
 		// Read in small chunks to test buffer handling
 		var output []byte
@@ -484,3 +758,334 @@ data: [DONE]
 		require.NoError(t, err)
 	})
 }
+
+func TestRefundRecorderAborted(t *testing.T) {
+	testCases := []struct {
+		name       string
+		path       string
+		input      string
+		fail       bool
+		wantTokens int
+	}{
+		{
+			name: "ollama_completed",
+			path: "/api/generate",
+			input: `{"response":"Hello","done":false}
+{"response":"","done":true,"prompt_eval_count":10,"eval_count":1}
+`,
+			wantTokens: 1,
+		},
+		{
+			name: "ollama_aborted",
+			path: "/api/chat",
+			input: `{"message":{"role":"assistant","content":"Hello"},"done":false}
+{"message":{"role":"assistant","content":" world"},"done":false}
+{"message":{"role":"assis`,
+			fail:       true,
+			wantTokens: 2,
+		},
+		{
+			name: "openai_aborted",
+			path: OpenAIChatPath,
+			input: `data: {"id":"chatcmpl-123","choices":[{"delta":{"content":"Hello"}}]}
+
+data: {"id":"chatcmpl-123","choices":[{"delta":{"content":" world"}}]}
+
+data: {"id":"chatcmpl-123","choices":[{"delta":{"role":"assistant"}}]}
+
+`,
+			fail:       true,
+			wantTokens: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var r io.Reader = strings.NewReader(tc.input)
+			if tc.fail {
+				r = io.MultiReader(r, iotest.ErrReader(errors.New("connection reset by peer")))
+			}
+			recorder := newRefundRecorder(tc.path, io.NopCloser(r), nil)
+
+			// the aborted response ends cleanly, so it can still be sealed and get a footer.
+			output, err := io.ReadAll(recorder)
+			require.NoError(t, err)
+			require.Equal(t, tc.input, string(output))
+
+			if !tc.fail {
+				require.NoError(t, recorder.Aborted())
+				return
+			}
+
+			require.Error(t, recorder.Aborted())
+
+			switch rec := recorder.(type) {
+			case *ollamaRefundRecorder:
+				require.Equal(t, tc.wantTokens, rec.tokens)
+			case *openAIRefundRecorder:
+				require.Equal(t, tc.wantTokens, rec.tokens)
+			}
+
+			// only the delivered output tokens are charged: 200 - (2 * 2) = 196, subject to rounding.
+			refund, err := newPricingEngine(nil).refund(tc.path, recorder.DeliveredUsage(), 200)
+			require.NoError(t, err)
+			amount, err := refund.Amount()
+			require.NoError(t, err)
+			require.GreaterOrEqual(t, amount, int64(180))
+			require.LessOrEqual(t, amount, int64(200))
+		})
+	}
+}
+
+func TestRefundRecorderDeliveredUsage(t *testing.T) {
+	text := strings.Repeat("the quick brown fox ", 10)
+
+	testCases := []struct {
+		name  string
+		path  string
+		input string
+		// the output tokens are estimated from between minText and maxText bytes of text.
+		minText int
+		maxText int
+		// wantTokens is the exact number of output tokens when the backend reported them.
+		wantTokens float64
+	}{
+		{
+			name: "openai_continuous_usage_stats",
+			path: OpenAIChatPath,
+			input: `data: {"choices":[{"delta":{"content":"Hello world"}}],"usage":{"prompt_tokens":10,"completion_tokens":2}}
+
+data: {"choices":[{"delta":{"content":"!"}}],"usage":{"prompt_tokens":10,"completion_tokens":3}}
+
+`,
+			wantTokens: 3,
+		},
+		{
+			name:    "openai_not_streamed_cut_off_in_content",
+			path:    OpenAIChatPath,
+			input:   `{"id":"chatcmpl-123","choices":[{"index":0,"message":{"role":"assistant","content":"` + text,
+			minText: len(text),
+			maxText: len(text) + 2,
+		},
+		{
+			name:    "openai_not_streamed_cut_off_after_content",
+			path:    OpenAICompletionsPath,
+			input:   `{"id":"cmpl-123","choices":[{"index":0,"text":"` + text + `","finish_reason":"length"}],"usa`,
+			minText: len(text),
+			maxText: len(text),
+		},
+		{
+			name:    "ollama_not_streamed_cut_off",
+			path:    "/api/generate",
+			input:   `{"model":"llama3.2:1b","response":"` + text,
+			minText: len(text),
+			maxText: len(text) + 2,
+		},
+		{
+			name:    "transcription_cut_off",
+			path:    OpenAITranscriptionsPath,
+			input:   `{"text":"` + text,
+			minText: len(text),
+			maxText: len(text) + 2,
+		},
+		{
+			name:    "responses_cut_off",
+			path:    OpenAIResponsesPath,
+			input:   `{"id":"resp_123","output":[{"type":"message","content":[{"type":"output_text","text":"` + text,
+			minText: len(text),
+			maxText: len(text) + 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := io.MultiReader(strings.NewReader(tc.input), iotest.ErrReader(errors.New("connection reset by peer")))
+			recorder := newRefundRecorder(tc.path, io.NopCloser(r), nil)
+
+			_, err := io.ReadAll(recorder)
+			require.NoError(t, err)
+			require.Error(t, recorder.Aborted())
+
+			usage := recorder.DeliveredUsage()
+			require.Zero(t, usage.InputTokens)
+			if tc.wantTokens > 0 {
+				require.Equal(t, tc.wantTokens, usage.OutputTokens)
+				return
+			}
+			require.GreaterOrEqual(t, usage.OutputTokens, float64(EstimatePromptTokens(tc.minText)))
+			require.LessOrEqual(t, usage.OutputTokens, float64(EstimatePromptTokens(tc.maxText)))
+		})
+	}
+}
+
+func TestRefundRecorderMigrated(t *testing.T) {
+	testCases := []struct {
+		name       string
+		path       string
+		first      string
+		rest       string
+		wantOutput string
+		wantTokens int
+	}{
+		{
+			name:       "ollama",
+			path:       OllamaChatPath,
+			first:      "{\"message\":{\"role\":\"assistant\",\"content\":\"Hello\"},\"done\":false}\n",
+			rest:       "{\"message\":{\"role\":\"assistant\",\"content\":\" world\"},\"done\":false}\n",
+			wantOutput: "Hello",
+			wantTokens: 1,
+		},
+		{
+			name:       "openai",
+			path:       OpenAICompletionsPath,
+			first:      "data: {\"choices\":[{\"index\":0,\"text\":\"Hello\"},{\"index\":1,\"text\":\"Hi\"}]}\n\n",
+			rest:       "data: {\"choices\":[{\"index\":0,\"text\":\" world\"}]}\n\n",
+			wantOutput: "Hello",
+			wantTokens: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			migrate := make(chan struct{})
+			recorder := newRefundRecorder(tc.path, io.NopCloser(strings.NewReader(tc.first+tc.rest)), migrate)
+
+			buf := make([]byte, len(tc.first))
+			_, err := io.ReadFull(recorder, buf)
+			require.NoError(t, err)
+			require.False(t, recorder.Migrated())
+
+			// the response ends at the token boundary after the migration is requested.
+			close(migrate)
+			rest, err := io.ReadAll(recorder)
+			require.NoError(t, err)
+			require.Empty(t, rest)
+			require.True(t, recorder.Migrated())
+			require.NoError(t, recorder.Aborted())
+
+			output, tokens := recorder.Output()
+			require.Equal(t, tc.wantOutput, output)
+			require.Equal(t, tc.wantTokens, tokens)
+		})
+	}
+}
+
+func TestErrorRefundRecorder(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         io.Reader
+		wantBody      string
+		wantTruncated bool
+		wantReadErr   bool
+	}{
+		{
+			name:     "streamed_error_body",
+			input:    iotest.OneByteReader(strings.NewReader(`{"object":"error","message":"max_tokens is too large","code":400}`)),
+			wantBody: `{"object":"error","message":"max_tokens is too large","code":400}`,
+		},
+		{
+			name:     "empty_error_body",
+			input:    strings.NewReader(""),
+			wantBody: "",
+		},
+		{
+			name:          "oversized_error_body",
+			input:         strings.NewReader(strings.Repeat("a", maxErrorBodySize+10)),
+			wantBody:      strings.Repeat("a", maxErrorBodySize),
+			wantTruncated: true,
+		},
+		{
+			name:        "error_body_ends_early",
+			input:       io.MultiReader(strings.NewReader(`{"error":`), iotest.ErrReader(errors.New("connection reset by peer"))),
+			wantBody:    `{"error":`,
+			wantReadErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rc := &closeRecorder{Reader: tc.input}
+			recorder, err := newErrorRefundRecorder(rc)
+			require.NoError(t, err)
+			require.True(t, rc.closed)
+			require.Equal(t, tc.wantTruncated, recorder.truncated)
+			require.Equal(t, tc.wantReadErr, recorder.readErr != nil)
+			require.Equal(t, int64(len(tc.wantBody)), recorder.Len())
+
+			body, err := io.ReadAll(recorder)
+			require.NoError(t, err)
+			require.Equal(t, tc.wantBody, string(body))
+			require.NoError(t, recorder.Close())
+
+			// error responses are refunded in full without looking at the body.
+			want, err := currency.Exact(200)
+			require.NoError(t, err)
+			refund, err := recordedRefund(recorder, OpenAIChatPath, 200)
+			require.NoError(t, err)
+			require.Equal(t, want, refund)
+			require.NoError(t, recorder.Aborted())
+			require.False(t, recorder.Migrated())
+		})
+	}
+}
+
+func TestRefundRecorderModel(t *testing.T) {
+	testCases := []struct {
+		name      string
+		path      string
+		input     string
+		wantModel string
+	}{
+		{
+			name:      "ollama_stream",
+			path:      OllamaGeneratePath,
+			input:     "{\"model\":\"llama3.2:1b\",\"response\":\"Hi\",\"done\":false}\n{\"model\":\"llama3.2:1b\",\"response\":\"\",\"done\":true}\n",
+			wantModel: "llama3.2:1b",
+		},
+		{
+			name:      "openai_stream",
+			path:      OpenAIChatPath,
+			input:     "data: {\"model\":\"qwen3-8b\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\ndata: [DONE]\n\n",
+			wantModel: "qwen3-8b",
+		},
+		{
+			name:      "rerank",
+			path:      VLLMRerankPath,
+			input:     `{"model":"bge-reranker","results":[],"usage":{"total_tokens":5}}`,
+			wantModel: "bge-reranker",
+		},
+		{
+			name:      "no_model",
+			path:      OpenAIChatPath,
+			input:     "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\n",
+			wantModel: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := newRefundRecorder(tc.path, io.NopCloser(strings.NewReader(tc.input)), nil)
+			_, err := io.ReadAll(recorder)
+			require.NoError(t, err)
+			require.Equal(t, tc.wantModel, recorder.Model())
+		})
+	}
+}
+
+func TestServedOtherModel(t *testing.T) {
+	require.False(t, servedOtherModel("llama3.2:1b", "llama3.2:1b"))
+	require.True(t, servedOtherModel("llama3.2:1b", "llama3.2:3b"))
+	// without a reported model there is nothing to compare.
+	require.False(t, servedOtherModel("llama3.2:1b", ""))
+	require.False(t, servedOtherModel("", "llama3.2:1b"))
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeworker
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker/output/wire"
+	"github.com/confidentsecurity/confidentcompute/tpmbroker"
+	"github.com/confidentsecurity/confidentcompute/tpmerr"
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/openpcc/openpcc/anonpay/currency"
+	cstpm "github.com/openpcc/openpcc/tpm"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrInvalidRefundSignature is returned when a refund signature doesn't verify, see wire.VerifyRefundSignature.
+var ErrInvalidRefundSignature = wire.ErrInvalidRefundSignature
+
+// RefundStatement is what the refund signature in the footer covers, see wire.RefundStatement.
+type RefundStatement = wire.RefundStatement
+
+// refundSignature returns the signature of the refund of the request, nil when refunds are not
+// signed. A refund that can't be signed is an error, the footer then carries the refund flagged as
+// unsigned and the router decides whether to trust it.
+func (s *Worker) refundSignature(ctx context.Context, creditAmount int64, refund currency.Value, aborted bool) ([]byte, error) {
+	if s.config.TPM.RefundKeyHandle == 0 {
+		return nil, nil
+	}
+
+	refundPB, err := refund.MarshalProto()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal refund to sign: %w", err)
+	}
+	b, err := proto.Marshal(refundPB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal refund to sign: %w", err)
+	}
+
+	return signRefund(ctx, s.config.TPM, RefundStatement{
+		RouterRequestID: s.config.RequestParams.RouterRequestID,
+		NodeRequestID:   s.config.RequestParams.NodeRequestID,
+		CreditAmount:    creditAmount,
+		Refund:          b,
+		Aborted:         aborted,
+	})
+}
+
+// signRefund signs the refund statement with the refund key of the TPM, while holding a lease from
+// the TPM access broker, if configured. The refund key has the PCR policy of the REK, the signature
+// is authorized by a policy session over the golden PCR values.
+func signRefund(ctx context.Context, config TPMConfig, statement RefundStatement) ([]byte, error) {
+	// the router matches the signed refund to its request by the router request ID.
+	if statement.RouterRequestID == "" {
+		return nil, errors.New("refund statement has no router request ID")
+	}
+	if config.RefundKeyHandle > math.MaxUint32 {
+		return nil, fmt.Errorf("refund key handle value %d exceeds maximum value for TPM handle", config.RefundKeyHandle)
+	}
+	goldenPCRValues, err := goldenPCRValues(config)
+	if err != nil {
+		return nil, err
+	}
+	return tpmbroker.Do(ctx, config.BrokerSocket, config.OpTimeout, func() (b []byte, err error) {
+		tpm, err := openTPM(ctx, config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open tpm: %w", err)
+		}
+		defer func() {
+			err = errors.Join(err, tpm.Close())
+		}()
+
+		sess, cleanup, err := cstpm.PCRPolicySession(tpm, goldenPCRValues)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tpm session: %w", tpmerr.Wrap(err))
+		}
+		defer func() {
+			err = errors.Join(err, cleanup())
+		}()
+
+		return refundKeySign(tpm, tpm2.TPMHandle(config.RefundKeyHandle), sess, statement.SignedMessage())
+	})
+}
+
+// refundKeySign signs the SHA-256 digest of msg with the key at handle, authorized by sess. The
+// refund key is an unrestricted signing key, so the digest is computed here. The signature uses the
+// scheme of the key and is returned as a marshalled TPMT_SIGNATURE.
+func refundKeySign(tpm transport.TPM, handle tpm2.TPMHandle, sess tpm2.Session, msg []byte) ([]byte, error) {
+	pub, err := tpm2.ReadPublic{ObjectHandle: handle}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read refund key: %w", tpmerr.Wrap(err))
+	}
+
+	digest := sha256.Sum256(msg)
+	sig, err := tpm2.Sign{
+		KeyHandle: tpm2.AuthHandle{
+			Handle: handle,
+			Name:   pub.Name,
+			Auth:   sess,
+		},
+		Digest:   tpm2.TPM2BDigest{Buffer: digest[:]},
+		InScheme: tpm2.TPMTSigScheme{Scheme: tpm2.TPMAlgNull},
+		Validation: tpm2.TPMTTKHashCheck{
+			Tag:       tpm2.TPMSTHashCheck,
+			Hierarchy: tpm2.TPMRHNull,
+		},
+	}.Execute(tpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign refund statement: %w", tpmerr.Wrap(err))
+	}
+	return tpm2.Marshal(sig.Signature), nil
+}
+
+// VerifyRefundSignature verifies the refund signature of a footer against the refund key public area
+// of the evidence, see wire.VerifyRefundSignature.
+func VerifyRefundSignature(refundKeyPublic []byte, statement RefundStatement, signature []byte) error {
+	return wire.VerifyRefundSignature(refundKeyPublic, statement, signature)
+}
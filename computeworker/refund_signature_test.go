@@ -0,0 +1,127 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeworker
+
+import (
+	"testing"
+
+	rcevidence "github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+	"github.com/openpcc/openpcc/attestation/evidence"
+	cstpm "github.com/openpcc/openpcc/tpm"
+	"github.com/stretchr/testify/require"
+)
+
+// createTestRefundKey creates a refund key bound to the current PCR values and returns its handle,
+// marshalled public area and the golden PCR values.
+func createTestRefundKey(t *testing.T, tpm transport.TPM) (tpm2.TPMHandle, []byte, map[uint32][]byte) {
+	t.Helper()
+
+	pcrValues, err := cstpm.PCRRead(tpm, evidence.AttestPCRSelection)
+	require.NoError(t, err)
+	policy, err := rcevidence.PCRPolicyDigest(pcrValues)
+	require.NoError(t, err)
+
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(rcevidence.RefundKeyTemplate(policy)),
+	}.Execute(tpm)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := tpm2.FlushContext{FlushHandle: rsp.ObjectHandle}.Execute(tpm)
+		require.NoError(t, err)
+	})
+
+	outPublic, err := rsp.OutPublic.Contents()
+	require.NoError(t, err)
+	return rsp.ObjectHandle, tpm2.Marshal(outPublic), pcrValues
+}
+
+func signWithPolicy(t *testing.T, tpm transport.TPM, handle tpm2.TPMHandle, pcrValues map[uint32][]byte, msg []byte) ([]byte, error) {
+	t.Helper()
+
+	sess, cleanup, err := cstpm.PCRPolicySession(tpm, pcrValues)
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		_ = cleanup()
+	})
+	return refundKeySign(tpm, handle, sess, msg)
+}
+
+func TestRefundSignature(t *testing.T) {
+	tpm, err := simulator.OpenSimulator()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, tpm.Close())
+	})
+
+	statement := RefundStatement{
+		RouterRequestID: "router-request",
+		NodeRequestID:   "node-request",
+		CreditAmount:    1000,
+		Refund:          []byte{0x08, 0x80, 0x01},
+	}
+
+	handle, refundKeyPublic, pcrValues := createTestRefundKey(t, tpm)
+	require.NoError(t, rcevidence.RefundKey{Public: refundKeyPublic}.Validate())
+
+	t.Run("ok, signed with the pcr policy", func(t *testing.T) {
+		sig, err := signWithPolicy(t, tpm, handle, pcrValues, statement.SignedMessage())
+		require.NoError(t, err)
+		require.NoError(t, VerifyRefundSignature(refundKeyPublic, statement, sig))
+
+		tampered := statement
+		tampered.Refund = []byte{0x08, 0x80, 0x02}
+		require.ErrorIs(t, VerifyRefundSignature(refundKeyPublic, tampered, sig), ErrInvalidRefundSignature)
+
+		rebound := statement
+		rebound.RouterRequestID = "other-request"
+		require.ErrorIs(t, VerifyRefundSignature(refundKeyPublic, rebound, sig), ErrInvalidRefundSignature)
+
+		require.ErrorIs(t, VerifyRefundSignature(refundKeyPublic, statement, sig[:len(sig)-1]), ErrInvalidRefundSignature)
+	})
+
+	t.Run("fail, without router request id", func(t *testing.T) {
+		unbound := statement
+		unbound.RouterRequestID = ""
+		_, err := signRefund(t.Context(), TPMConfig{RefundKeyHandle: uint(handle)}, unbound)
+		require.Error(t, err)
+	})
+
+	t.Run("fail, without the pcr policy", func(t *testing.T) {
+		_, err := refundKeySign(tpm, handle, tpm2.PasswordAuth(nil), statement.SignedMessage())
+		require.Error(t, err)
+	})
+
+	t.Run("fail, pcrs moved on", func(t *testing.T) {
+		pcr := uint32(evidence.AttestPCRSelection[0])
+		_, err := tpm2.PCRExtend{
+			PCRHandle: tpm2.AuthHandle{Handle: tpm2.TPMHandle(pcr), Auth: tpm2.PasswordAuth(nil)},
+			Digests: tpm2.TPMLDigestValues{
+				Digests: []tpm2.TPMTHA{{HashAlg: tpm2.TPMAlgSHA256, Digest: make([]byte, 32)}},
+			},
+		}.Execute(tpm)
+		require.NoError(t, err)
+
+		_, err = signWithPolicy(t, tpm, handle, pcrValues, statement.SignedMessage())
+		require.Error(t, err)
+	})
+}
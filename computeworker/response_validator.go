@@ -0,0 +1,122 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// DefaultResponseContentTypes are the media types the LLM backend may respond with by default.
+var DefaultResponseContentTypes = []string{
+	"application/json",
+	"application/x-ndjson",
+	"text/event-stream",
+}
+
+var errUnexpectedContentType = errors.New("unexpected response content type")
+
+// ResponseContentTypeValidator checks the content type of LLM backend responses against an
+// allow-list, so a compromised backend can't hand clients content that their HTTP stack
+// would interpret in unexpected ways.
+type ResponseContentTypeValidator struct {
+	// Allowed are the allowed media types, without parameters.
+	Allowed []string
+}
+
+// Validate rewrites the Content-Type header of resp to its canonical form and disables
+// content sniffing. Media types that are not allowed, unparseable content types and charsets
+// other than UTF-8 are rejected. Only empty responses may omit the content type.
+func (v ResponseContentTypeValidator) Validate(resp *http.Response) error {
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		if resp.ContentLength == 0 {
+			resp.Header.Set("X-Content-Type-Options", "nosniff")
+			return nil
+		}
+		return fmt.Errorf("%w: missing content type", errUnexpectedContentType)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errUnexpectedContentType, err)
+	}
+
+	if !slices.Contains(v.Allowed, mediaType) {
+		return fmt.Errorf("%w: %s", errUnexpectedContentType, mediaType)
+	}
+
+	// other parameters are dropped, they are never needed to interpret the allowed media types.
+	canonical := mediaType
+	if charset, ok := params["charset"]; ok {
+		if !strings.EqualFold(charset, "utf-8") {
+			return fmt.Errorf("%w: charset %s", errUnexpectedContentType, charset)
+		}
+		canonical += "; charset=utf-8"
+	}
+
+	resp.Header.Set("Content-Type", canonical)
+	resp.Header.Set("X-Content-Type-Options", "nosniff")
+	return nil
+}
+
+// ParseResponseContentTypes parses the allowed response media types.
+func ParseResponseContentTypes(contentTypes []string) ([]string, error) {
+	mediaTypes := make([]string, 0, len(contentTypes))
+	for _, contentType := range contentTypes {
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid response content type %q: %w", contentType, err)
+		}
+		if len(params) > 0 {
+			return nil, fmt.Errorf("invalid response content type %q: parameters are not allowed", contentType)
+		}
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	return mediaTypes, nil
+}
+
+// unexpectedContentTypeResponse replaces a backend response with a disallowed content type.
+func unexpectedContentTypeResponse() (*http.Response, error) {
+	body, err := json.Marshal(ValidationErrorMessage{
+		Code:    "ErrUnexpectedResponseContentType",
+		Error:   http.StatusText(http.StatusBadGateway),
+		Message: "the llm responded with an unexpected content type",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal error message: %w", err)
+	}
+
+	resp := &http.Response{
+		StatusCode:    http.StatusBadGateway,
+		Status:        http.StatusText(http.StatusBadGateway),
+		Header:        http.Header{},
+		ContentLength: int64(len(body)),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+	}
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Set("X-Content-Type-Options", "nosniff")
+	return resp, nil
+}
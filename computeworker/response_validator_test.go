@@ -0,0 +1,127 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseContentTypeValidator(t *testing.T) {
+	tests := []struct {
+		name            string
+		contentType     string
+		contentLength   int64
+		wantContentType string
+		wantErr         bool
+	}{
+		{
+			name:            "ok, json",
+			contentType:     "application/json",
+			wantContentType: "application/json",
+		},
+		{
+			name:            "ok, ndjson with parameters",
+			contentType:     "Application/X-NDJSON; charset=UTF-8; foo=bar",
+			wantContentType: "application/x-ndjson; charset=utf-8",
+		},
+		{
+			name:            "ok, event stream",
+			contentType:     "text/event-stream",
+			wantContentType: "text/event-stream",
+		},
+		{
+			name:            "ok, empty response without content type",
+			contentLength:   0,
+			wantContentType: "",
+		},
+		{
+			name:          "fail, missing content type",
+			contentLength: -1,
+			wantErr:       true,
+		},
+		{
+			name:        "fail, html",
+			contentType: "text/html; charset=utf-8",
+			wantErr:     true,
+		},
+		{
+			name:        "fail, other charset",
+			contentType: "application/json; charset=utf-7",
+			wantErr:     true,
+		},
+		{
+			name:        "fail, unparseable",
+			contentType: "application/json; =",
+			wantErr:     true,
+		},
+	}
+
+	v := ResponseContentTypeValidator{Allowed: DefaultResponseContentTypes}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &http.Response{
+				Header:        http.Header{},
+				ContentLength: tc.contentLength,
+			}
+			if tc.contentType != "" {
+				resp.Header.Set("Content-Type", tc.contentType)
+			}
+
+			err := v.Validate(resp)
+			if tc.wantErr {
+				require.ErrorIs(t, err, errUnexpectedContentType)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.wantContentType, resp.Header.Get("Content-Type"))
+			require.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+		})
+	}
+}
+
+func TestParseResponseContentTypes(t *testing.T) {
+	got, err := ParseResponseContentTypes([]string{"Application/JSON", "text/event-stream"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"application/json", "text/event-stream"}, got)
+
+	_, err = ParseResponseContentTypes([]string{"application/json; charset=utf-8"})
+	require.Error(t, err)
+
+	_, err = ParseResponseContentTypes([]string{"not a media type"})
+	require.Error(t, err)
+}
+
+func TestUnexpectedContentTypeResponse(t *testing.T) {
+	resp, err := unexpectedContentTypeResponse()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Len(t, body, int(resp.ContentLength))
+
+	var msg ValidationErrorMessage
+	require.NoError(t, json.Unmarshal(body, &msg))
+	require.Equal(t, "ErrUnexpectedResponseContentType", msg.Code)
+}
@@ -0,0 +1,129 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeworker
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/confidentsecurity/confidentcompute/experimental"
+)
+
+// OpenAIResponsesPath is the experimental responses route, it is only served by nodes that
+// disclose it in their evidence, see experimental.CheckBuild.
+const OpenAIResponsesPath = experimental.ResponsesRoute
+
+// experimentalBodyTypes are the body types of the experimental routes, keyed by route.
+var experimentalBodyTypes = map[string]func() RequestBody{
+	OpenAIResponsesPath: func() RequestBody { return &OpenAIRequestBodyResponses{} },
+}
+
+// https://platform.openai.com/docs/api-reference/responses/create
+//
+// Only stateless, non-streamed responses are supported. Fields that refer to state kept by the
+// backend, like previous_response_id, are rejected when the body is decoded.
+type OpenAIRequestBodyResponses struct {
+	Model           string         `json:"model"`
+	Input           any            `json:"input"`
+	Instructions    string         `json:"instructions,omitempty"`
+	MaxOutputTokens int            `json:"max_output_tokens,omitempty"`
+	Temperature     *float64       `json:"temperature,omitempty"`
+	TopP            *float64       `json:"top_p,omitempty"`
+	Stream          bool           `json:"stream,omitempty"`
+	Store           *bool          `json:"store,omitempty"`
+	Text            map[string]any `json:"text,omitempty"`
+	Reasoning       map[string]any `json:"reasoning,omitempty"`
+	User            string         `json:"user,omitempty"`
+	Metadata        map[string]any `json:"metadata,omitempty"`
+}
+
+func (b *OpenAIRequestBodyResponses) Validate(supportedModels []string) (string, bool, error) {
+	if b.Model == "" {
+		return "", false, newValidationError(ErrMissingRequiredField, "missing required field: model")
+	}
+
+	if !slices.Contains(supportedModels, b.Model) {
+		return "", false, newValidationError(ErrUnsupportedModel, "unsupported model: "+b.Model)
+	}
+
+	if b.Input == nil {
+		return "", false, newValidationError(ErrMissingRequiredField, "missing required field: input")
+	}
+
+	// the usage of streamed responses is not recorded yet.
+	if b.Stream {
+		return "", false, newValidationError(ErrGeneric, "streamed responses are not supported")
+	}
+
+	// responses are never stored by the backend, the backend defaults to storing them.
+	dirty := false
+	if b.Store == nil || *b.Store {
+		store := false
+		b.Store = &store
+		dirty = true
+	}
+
+	return b.Model, dirty, nil
+}
+
+func (b *OpenAIRequestBodyResponses) LimitOutputTokens(limit int) (bool, error) {
+	maxOutputTokens := clampOutputTokens(b.MaxOutputTokens, limit)
+	dirty := maxOutputTokens != b.MaxOutputTokens
+	b.MaxOutputTokens = maxOutputTokens
+	return dirty, nil
+}
+
+// responsesRefundRecorder buffers a response of the responses route to find its usage, like
+// rerankRefundRecorder.
+type responsesRefundRecorder struct {
+	rerankRefundRecorder
+}
+
+// DeliveredUsage estimates the output tokens from the output text of a response that was cut off.
+func (r *responsesRefundRecorder) DeliveredUsage() Usage {
+	if r.overflow {
+		return Usage{}
+	}
+	return Usage{OutputTokens: truncatedOutputTokens(r.body.Bytes(), "text", "delta")}
+}
+
+func (r *responsesRefundRecorder) Usage() (Usage, error) {
+	if r.overflow {
+		return Usage{}, fmt.Errorf("response exceeds %d bytes: %w", maxRerankResponseSize, errNoRefundAvailable)
+	}
+
+	var responseData map[string]any
+	if err := json.Unmarshal(r.body.Bytes(), &responseData); err != nil {
+		return Usage{}, fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+
+	usage, ok := responseData["usage"].(map[string]any)
+	if !ok {
+		return Usage{}, fmt.Errorf("failed to get usage from JSON response: %w", errNoRefundAvailable)
+	}
+	numInputTokens, ok := usage["input_tokens"].(float64)
+	if !ok {
+		return Usage{}, fmt.Errorf("failed to get input_tokens from JSON response: %w", errNoRefundAvailable)
+	}
+	numOutputTokens, ok := usage["output_tokens"].(float64)
+	if !ok {
+		return Usage{}, fmt.Errorf("failed to get output_tokens from JSON response: %w", errNoRefundAvailable)
+	}
+
+	return Usage{InputTokens: numInputTokens, OutputTokens: numOutputTokens}, nil
+}
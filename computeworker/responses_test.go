@@ -0,0 +1,137 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeworker
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/confidentsecurity/confidentcompute/experimental"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExperimentalBodyTypes(t *testing.T) {
+	for _, route := range experimental.Routes {
+		require.Contains(t, experimentalBodyTypes, route)
+	}
+}
+
+func TestNewValidatorExperimentalRoutes(t *testing.T) {
+	allowed := func(opts ValidatorOptions) map[string][]string {
+		v, ok := NewValidator(nil, nil, opts).(RequestValidator)
+		require.True(t, ok)
+		ev, ok := v.preAuthValidators[0].(EndpointValidator)
+		require.True(t, ok)
+		return ev.Allowed
+	}
+
+	require.NotContains(t, allowed(ValidatorOptions{}), OpenAIResponsesPath)
+	require.Contains(t, allowed(ValidatorOptions{ExperimentalRoutes: []string{OpenAIResponsesPath}}), OpenAIResponsesPath)
+}
+
+func TestOpenAIRequestBodyResponses(t *testing.T) {
+	models := []string{"llama3.2:1b"}
+
+	tests := map[string]struct {
+		body      string
+		wantDirty bool
+		wantCode  ValidationErrorCode
+		wantErr   bool
+	}{
+		"ok, store is disabled": {
+			body:      `{"model":"llama3.2:1b","input":"hi"}`,
+			wantDirty: true,
+		},
+		"ok, store already disabled": {
+			body: `{"model":"llama3.2:1b","input":[{"role":"user","content":"hi"}],"store":false}`,
+		},
+		"fail, missing model": {
+			body:     `{"input":"hi"}`,
+			wantErr:  true,
+			wantCode: ErrMissingRequiredField,
+		},
+		"fail, unsupported model": {
+			body:     `{"model":"other","input":"hi"}`,
+			wantErr:  true,
+			wantCode: ErrUnsupportedModel,
+		},
+		"fail, missing input": {
+			body:     `{"model":"llama3.2:1b"}`,
+			wantErr:  true,
+			wantCode: ErrMissingRequiredField,
+		},
+		"fail, streamed": {
+			body:     `{"model":"llama3.2:1b","input":"hi","stream":true}`,
+			wantErr:  true,
+			wantCode: ErrGeneric,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var b OpenAIRequestBodyResponses
+			require.NoError(t, json.Unmarshal([]byte(tc.body), &b))
+
+			model, dirty, err := b.Validate(models)
+			assertError(t, err, tc.wantErr, tc.wantCode)
+			if tc.wantErr {
+				return
+			}
+			require.Equal(t, "llama3.2:1b", model)
+			require.Equal(t, tc.wantDirty, dirty)
+			require.NotNil(t, b.Store)
+			require.False(t, *b.Store)
+		})
+	}
+
+	t.Run("output tokens are clamped", func(t *testing.T) {
+		b := OpenAIRequestBodyResponses{MaxOutputTokens: 500}
+		dirty, err := b.LimitOutputTokens(100)
+		require.NoError(t, err)
+		require.True(t, dirty)
+		require.Equal(t, 100, b.MaxOutputTokens)
+	})
+}
+
+func TestResponsesRefundRecorderUsage(t *testing.T) {
+	read := func(body string) refundRecorder {
+		recorder := newRefundRecorder(OpenAIResponsesPath, io.NopCloser(strings.NewReader(body)), nil)
+		_, err := io.ReadAll(recorder)
+		require.NoError(t, err)
+		return recorder
+	}
+
+	usage, err := read(`{"model":"llama3.2:1b","output":[],"usage":{"input_tokens":12,"output_tokens":34,"total_tokens":46}}`).Usage()
+	require.NoError(t, err)
+	require.Equal(t, Usage{InputTokens: 12, OutputTokens: 34}, usage)
+
+	_, err = read(`{"model":"llama3.2:1b","output":[]}`).Usage()
+	require.ErrorIs(t, err, errNoRefundAvailable)
+}
+
+func FuzzOpenAIResponsesBody(f *testing.F) {
+	fuzzRequestBodySeeds(f,
+		`{"model":"llama3.2:1b","input":"Why is the sky blue?"}`,
+		`{"model":"llama3.2:1b","input":[{"role":"user","content":"hi"}],"store":true,"max_output_tokens":100000}`,
+		`{"model":"llama3.2:1b","input":"hi","text":{"format":{"type":"json_object"}},"reasoning":{"effort":"low"}}`,
+	)
+	f.Fuzz(func(_ *testing.T, data []byte) {
+		FuzzOpenAIResponses(data)
+	})
+}
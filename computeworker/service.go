@@ -26,22 +26,22 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"math/big"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cloudflare/circl/hpke"
 	"github.com/confidentsecurity/confidentcompute/computeworker/output"
-	ollama "github.com/ollama/ollama/api"
+	"github.com/confidentsecurity/confidentcompute/computeworker/output/wire"
+	"github.com/confidentsecurity/confidentcompute/faultinject"
 	"github.com/openpcc/openpcc/anonpay/currency"
 	"github.com/openpcc/openpcc/chunk"
 	"github.com/openpcc/openpcc/messages"
 	"github.com/openpcc/openpcc/models"
 	"github.com/openpcc/openpcc/otel/otelutil"
 	"github.com/openpcc/twoway"
-	"github.com/sashabaranov/go-openai"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
@@ -76,8 +76,13 @@ func validationErrorMessageBody(err error) ([]byte, error) {
 func validationErrorMessageCode(err error) int {
 	// if this is a validation error, use the string there
 	var valErr ValidationError
-	if errors.As(err, &valErr) && valErr.Code == ErrUnsupportedPath {
-		return http.StatusNotFound
+	if errors.As(err, &valErr) {
+		switch valErr.Code {
+		case ErrUnsupportedPath:
+			return http.StatusNotFound
+		case ErrTooManyParallelRequests:
+			return http.StatusTooManyRequests
+		}
 	}
 	return http.StatusBadRequest
 }
@@ -92,14 +97,30 @@ func (e *RequestDecapsulationError) Error() string {
 }
 
 type Worker struct {
-	config      *Config
-	ctx         context.Context
-	httpClient  *http.Client
-	receiver    *twoway.MultiRequestReceiver
-	validator   Validator
-	reader      io.Reader
-	writer      io.Writer
-	diagnostics map[string]string
+	config     *Config
+	ctx        context.Context
+	httpClient *http.Client
+	receiver   *twoway.MultiRequestReceiver
+	validator  Validator
+	// responseValidator checks the content type of LLM backend responses.
+	responseValidator ResponseContentTypeValidator
+	reader            io.Reader
+	writer            io.Writer
+	diagnostics       map[string]string
+	// migrate is closed to migrate the request to another node, see Migrate.
+	migrate     chan struct{}
+	migrateOnce sync.Once
+	// pricing prices the usage of responses for refunds.
+	pricing *pricingEngine
+	// mirror duplicates requests to the shadow backend, nil disables mirroring.
+	mirror *mirror
+	// startupLatency is filled in while the request starts, see StartupLatency.
+	startupLatency StartupLatency
+	// encoder encodes the output once it was started, nil again once the footer was written.
+	encoder *output.Encoder
+	// abortRefund determines the refund of the output of encoder when it's ended early, and the
+	// credits it refunds.
+	abortRefund func() (currency.Value, int64, error)
 }
 
 func NewWithDependencies(
@@ -116,14 +137,20 @@ func NewWithDependencies(
 	span.SetStatus(codes.Ok, "")
 
 	return &Worker{
-		ctx:         ctx,
-		config:      config,
-		httpClient:  httpClient,
-		receiver:    receiver,
-		validator:   DefaultValidator(config.BadgePublicKey, config.Models),
+		ctx:        ctx,
+		config:     config,
+		httpClient: httpClient,
+		receiver:   receiver,
+		validator:  NewValidator(config.BadgePublicKey, config.Models, config.validatorOptions()),
+		responseValidator: ResponseContentTypeValidator{
+			Allowed: config.responseContentTypes(),
+		},
 		reader:      reader,
 		writer:      writer,
 		diagnostics: diagnostics,
+		migrate:     make(chan struct{}),
+		pricing:     newPricingEngine(config.Pricing),
+		mirror:      newMirror(httpClient, config.Mirror),
 	}
 }
 
@@ -131,9 +158,24 @@ func New(ctx context.Context, config *Config, reader io.Reader, writer io.Writer
 	ctx, span := otelutil.Tracer.Start(ctx, "computeworker.New")
 	defer span.End()
 
+	start := time.Now()
+	httpClient, receiver, diagnostics, err := newDependencies(ctx, config)
+	if err != nil {
+		return nil, otelutil.RecordError(span, err)
+	}
+
+	span.SetStatus(codes.Ok, "")
+	worker := NewWithDependencies(ctx, config, httpClient, receiver, reader, writer, diagnostics)
+	worker.startupLatency.FlagParse = config.FlagParseDuration
+	worker.startupLatency.TPMReceiverInit = time.Since(start)
+	return worker, nil
+}
+
+// newDependencies sets up the dependencies of a worker that don't depend on the request.
+func newDependencies(ctx context.Context, config *Config) (*http.Client, *twoway.MultiRequestReceiver, map[string]string, error) {
 	_, err := url.Parse(config.LLMBaseURL)
 	if err != nil {
-		return nil, otelutil.Errorf(span, "invalid LLMBaseURL: %w", err)
+		return nil, nil, nil, fmt.Errorf("invalid LLMBaseURL: %w", err)
 	}
 
 	tpmSuite := &tpmSuiteAdapter{
@@ -146,21 +188,28 @@ func New(ctx context.Context, config *Config, reader io.Reader, writer io.Writer
 
 	receiver, err := twoway.NewMultiRequestReceiverWithCustomSuite(tpmSuite, 0, nil, rand.Reader)
 	if err != nil {
-		return nil, otelutil.Errorf(span, "failed to create multi request receiver: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to create multi request receiver: %w", err)
 	}
 
+	// the worker inherits the network access of the host, keep it away from the metadata services.
+	transport := chunk.NewHTTPTransport(chunk.DefaultDialTimeout)
+	egress := newEgressPolicy(config.EgressDeny)
+	egress.privateOnly = config.EgressPrivateOnly
+	egress.pins = config.BackendResolve
+	transport.DialContext = egress.dialContext(chunk.DefaultDialTimeout)
+	// plaintext requests never go through a proxy, whatever the environment says.
+	transport.Proxy = nil
 	httpClient := &http.Client{
 		Timeout:   config.Timeout,
-		Transport: otelutil.NewTransport(chunk.NewHTTPTransport(chunk.DefaultDialTimeout)),
+		Transport: otelutil.NewTransport(transport),
 	}
 
 	diagnostics, err := LoadDiagnosticResponseBodies()
 	if err != nil {
-		return nil, otelutil.Errorf(span, "failed to load diagnostics response bodies: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to load diagnostics response bodies: %w", err)
 	}
 
-	span.SetStatus(codes.Ok, "")
-	return NewWithDependencies(ctx, config, httpClient, receiver, reader, writer, diagnostics), nil
+	return httpClient, receiver, diagnostics, nil
 }
 
 type StatusRecorderWriter struct {
@@ -173,11 +222,40 @@ func (sr *StatusRecorderWriter) WriteHeader(code int) {
 	sr.ResponseWriter.WriteHeader(code)
 }
 
-func (s *Worker) Run() error {
+// Run handles the request. A panic while handling it ends the output with an aborted footer and is
+// reported with a redacted crash report, Run then returns a PanicError.
+func (s *Worker) Run() (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = s.containPanic(v)
+		}
+	}()
+	return s.run()
+}
+
+// hpkeExporter is implemented by HPKE contexts that export secrets, see RFC 9180 section 5.3.
+type hpkeExporter interface {
+	Export(exporterContext []byte, length uint) []byte
+}
+
+// outputMACKey exports the MAC key of the output transcript from the HPKE context of the request.
+// The client exports the same key to verify the transcript, router_com only forwards it. Without an
+// exporting context the transcript is an unkeyed hash chain, which the client fails to verify.
+func outputMACKey(ctx context.Context, opener any) []byte {
+	exporter, ok := opener.(hpkeExporter)
+	if !ok {
+		slog.WarnContext(ctx, "HPKE context of the request doesn't export secrets, output transcript is unkeyed")
+		return nil
+	}
+	return exporter.Export(wire.MACKeyExportContext, wire.MACKeyLen)
+}
+
+func (s *Worker) run() error {
 	ctx, span := otelutil.Tracer.Start(s.ctx, "computeworker.Run")
 	defer span.End()
 
 	decapCtx, decapSpan := otelutil.Tracer.Start(ctx, "computeworker.Run.Decapsulate")
+	phaseStart := time.Now()
 	req, opener, err := messages.DecapsulateRequest(decapCtx, s.receiver, s.config.RequestParams.EncapsulatedKey, s.config.RequestParams.MediaType, s.reader)
 	if err != nil {
 		decapSpan.End()
@@ -185,13 +263,48 @@ func (s *Worker) Run() error {
 		return otelutil.RecordError(span, err)
 	}
 	decapSpan.End()
+	s.startupLatency.Decapsulation = time.Since(phaseStart)
 
 	req = req.WithContext(ctx)
+	span.SetAttributes(attribute.Int64(BudgetCreditsGrantedAttr, BudgetBucket(s.config.RequestParams.CreditAmount)))
 
-	var resp *http.Response
+	credits := newCreditLedger(s.config.RequestParams.CreditAmount, s.config.MaxTopUpCredits, s.config.NonceSocket)
+	if s.config.topUpEnabled() {
+		go receiveCreditGrants(ctx, s.config.CreditGrants, credits, s.config.BadgePublicKey, s.config.RequestParams.EncapsulatedKey)
+	}
+
+	var (
+		resp        *http.Response
+		requestBody []byte
+		// failure is why the request couldn't be handled after it was decapsulated, the client then
+		// gets an encrypted error detail instead of the LLM response.
+		failure error
+	)
 
-	// Validate the request.
-	if err = s.validator.Validate(req); err != nil {
+	// Normalize and validate the request.
+	phaseStart = time.Now()
+	_, normSpan := otelutil.Tracer.Start(ctx, "computeworker.Run.Normalize")
+	err = NormalizeRequest(req)
+	normSpan.End()
+	if err == nil {
+		err = s.validator.Validate(req)
+	}
+	if err == nil {
+		var releaseBadgeSlot func() error
+		releaseBadgeSlot, err = s.acquireBadgeSlot(ctx, req)
+		var valErr ValidationError
+		if err != nil && !errors.As(err, &valErr) {
+			failure, err = err, nil
+		} else if err == nil {
+			defer func() {
+				if releaseErr := releaseBadgeSlot(); releaseErr != nil {
+					slog.WarnContext(ctx, "Failed to release badge slot", "error", releaseErr)
+				}
+			}()
+		}
+	}
+	s.startupLatency.Validation = time.Since(phaseStart)
+	if err != nil {
 		slog.InfoContext(s.ctx, "Request Validation Error", "err", err)
 
 		errorBytes, valErr := validationErrorMessageBody(err)
@@ -200,24 +313,94 @@ func (s *Worker) Run() error {
 			return valErr
 		}
 
+		statusCode := validationErrorMessageCode(err)
 		resp = &http.Response{
-			StatusCode: validationErrorMessageCode(err),
-			Status:     http.StatusText(http.StatusBadRequest),
+			StatusCode: statusCode,
+			Status:     http.StatusText(statusCode),
 			Header:     http.Header{},
 			Body:       io.NopCloser(bytes.NewReader(errorBytes)),
 		}
 		resp.Header.Add("Content-Type", "application/json")
-	} else {
+		if statusCode == http.StatusTooManyRequests {
+			resp.Header.Set("Retry-After", BadgeLimitRetryAfter)
+		}
+	} else if failure == nil {
 		slog.DebugContext(s.ctx, "Handling Confidential Request")
 
-		resp, err = s.handle(req)
+		// keep the request body around, a migrated response hands it back to the client.
+		// The body validator has already read it into memory.
+		requestBody, err = io.ReadAll(req.Body)
+		if err != nil {
+			return otelutil.Errorf(span, "failed to read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(requestBody))
+		span.SetAttributes(attribute.Int64(BudgetPromptTokensEstimatedAttr, BudgetBucket(EstimatePromptTokens(len(requestBody)))))
+		slog.InfoContext(ctx, PromptSizeMessage, PromptSizeKey, promptSizeOf(req, requestBody))
+
+		phaseStart = time.Now()
+		// a sleeping model is woken up first, the wake up counts towards the backend TTFB.
+		err = s.wakeModel(ctx, req)
+		if err != nil {
+			failure = fmt.Errorf("failed to wake model: %w", err)
+		} else if resp, err = s.handle(req, requestBody); err != nil {
+			failure = fmt.Errorf("failed to handle request: %w", err)
+		} else {
+			s.startupLatency.BackendTTFB = time.Since(phaseStart)
+		}
+	}
+	if failure != nil {
+		slog.ErrorContext(ctx, "Reporting failure to the client", "error", failure)
+		span.AddEvent("error_detail")
+		resp, err = errorDetailResponse(failure)
 		if err != nil {
-			return otelutil.Errorf(span, "failed to handle request: %w", err)
+			return otelutil.RecordError(span, errors.Join(failure, err))
 		}
 	}
+	slog.InfoContext(ctx, StartupLatencyMessage, StartupLatencyKey, s.startupLatency)
 
-	refundRecorder := newRefundRecorder(req.URL.Path, resp.Body)
-	resp.Body = refundRecorder
+	var refundRecorder refundRecorder
+	if resp.StatusCode >= 400 {
+		// failed responses are refunded in full, skip usage parsing and cap the error body.
+		errorRecorder, err := newErrorRefundRecorder(resp.Body)
+		if err != nil {
+			return otelutil.Errorf(span, "failed to read error response: %w", err)
+		}
+		if errorRecorder.readErr != nil {
+			slog.WarnContext(ctx, "Failed to read LLM error response completely", "error", errorRecorder.readErr)
+		}
+		if errorRecorder.truncated {
+			slog.WarnContext(ctx, "Truncated LLM error response", "max_size", maxErrorBodySize)
+		}
+		refundRecorder = errorRecorder
+		resp.Body = errorRecorder
+		resp.ContentLength = errorRecorder.Len()
+		resp.TransferEncoding = nil
+		resp.Header.Del("Content-Length")
+	} else {
+		// only successful responses can be migrated, there is nothing to resume otherwise.
+		var migrate <-chan struct{}
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 && resumablePath(req.URL.Path) {
+			migrate = s.migrate
+		}
+		// the ceiling sees the backend output before it is filtered, it ends the response like an abort.
+		if s.config.topUpEnabled() && resumablePath(req.URL.Path) {
+			resp.Body = newCreditCeilingBody(req.URL.Path, resp.Body, credits)
+		}
+		// the filter sits before the refund recorder, so terminated responses are refunded like aborted ones.
+		if s.config.OutputFilter != nil {
+			resp.Body = newFilteredBody(resp.Body, s.config.OutputFilter)
+		}
+		refundRecorder = newRefundRecorder(req.URL.Path, resp.Body, migrate)
+		resp.Body = refundRecorder
+		if migrate != nil {
+			resp.Body = newContinuationBody(ctx, resp, req.URL.Path, requestBody, refundRecorder)
+		}
+	}
+
+	// the filler is encapsulated with the response, so it pads the ciphertext and the client drops it.
+	if s.config.Padding.Mode != "" {
+		padResponse(resp, s.config.Padding)
+	}
 
 	defer func() {
 		closeErr := resp.Body.Close()
@@ -225,6 +408,11 @@ func (s *Worker) Run() error {
 		err = errors.Join(err, closeErr)
 	}()
 
+	if s.config.EchoNodeRequestID && s.config.RequestParams.NodeRequestID != "" {
+		resp.Header.Set(NodeRequestIDHeader, s.config.RequestParams.NodeRequestID)
+	}
+	DefaultHeaderSchema().Negotiate(req.Header, resp.Header)
+
 	_, encapSpan := otelutil.Tracer.Start(ctx, "computeworker.Run.Encapsulate")
 	sealer, respMediaType, err := messages.EncapsulateResponse(opener, resp)
 	if err != nil {
@@ -239,25 +427,37 @@ func (s *Worker) Run() error {
 	}
 
 	// encode the output
-	encoder, err := output.NewEncoder(output.Header{
+	encoder, err := output.NewEncoderWithKey(output.Header{
 		MediaType:   respMediaType,
 		MaxChunkLen: ctChunkLen,
-	}, s.writer)
+	}, s.writer, outputMACKey(ctx, opener))
 	if err != nil {
 		return otelutil.Errorf(span, "failed to create output encoder: %w", err)
 	}
+	s.encoder = encoder
+	s.abortRefund = func() (currency.Value, int64, error) {
+		creditAmount := credits.total()
+		refund, err := s.abortedRefund(req.URL.Path, resp.StatusCode, refundRecorder, creditAmount)
+		return refund, creditAmount, err
+	}
+
+	// pacing sits between the sealer and the encoder, so it re-times whole ciphertext chunks.
+	var ciphertextWriter io.Writer = encoder
+	if s.config.Pacing.Interval > 0 {
+		ciphertextWriter = newPacedWriter(ctx, encoder, s.config.Pacing)
+	}
 
 	// write the ciphertext
 	_, writeSpan := otelutil.Tracer.Start(ctx, "computeworker.Run.WriteCiphertext")
 	if chunked {
 		buf := make([]byte, ctChunkLen)
-		_, err = io.CopyBuffer(encoder, sealer, buf)
+		_, err = io.CopyBuffer(ciphertextWriter, sealer, buf)
 		if err != nil {
 			writeSpan.End()
 			return otelutil.Errorf(span, "failed to write chunked ciphertext: %w", err)
 		}
 	} else {
-		_, err = io.Copy(encoder, sealer)
+		_, err = io.Copy(ciphertextWriter, sealer)
 		if err != nil {
 			writeSpan.End()
 			return otelutil.Errorf(span, "failed to write ciphertext: %w", err)
@@ -266,7 +466,11 @@ func (s *Worker) Run() error {
 	writeSpan.End()
 
 	// note: nil refund indicates no refund.
-	refund, hasRefund, err := s.newRefund(resp.StatusCode, refundRecorder)
+	// grants that arrive after the output was written are still refunded.
+	creditAmount := credits.total()
+	requestedModel := req.Header.Get(requestedModelHeader)
+	waivedInputTokens := continuedInputTokens(req, s.config.Continuation)
+	refund, hasRefund, err := s.newRefund(req.URL.Path, resp.StatusCode, refundRecorder, creditAmount, requestedModel, waivedInputTokens)
 	if err != nil {
 		return otelutil.Errorf(span, "failed to determine refund: %w", err)
 	}
@@ -274,31 +478,115 @@ func (s *Worker) Run() error {
 	footer := output.Footer{}
 	if hasRefund {
 		footer.Refund = &refund
+		s.recordBudgetUsage(span, refundRecorder, refund, creditAmount)
+	}
+	if abortErr := refundRecorder.Aborted(); errors.Is(abortErr, ErrOutputTerminated) {
+		slog.InfoContext(ctx, "Output filter terminated the response")
+		span.AddEvent("output_filter.terminated")
+		footer.Aborted = true
+	} else if errors.Is(abortErr, ErrCreditCeiling) {
+		slog.InfoContext(ctx, "Response reached the credit ceiling", "credit_amount", creditAmount)
+		span.AddEvent("credits.ceiling")
+		footer.Aborted = true
+	} else if abortErr != nil {
+		slog.WarnContext(ctx, "LLM response aborted mid-stream", "error", abortErr)
+		span.AddEvent("llm.aborted")
+		footer.Aborted = true
+	}
+	if refundRecorder.Migrated() {
+		_, tokens := refundRecorder.Output()
+		slog.InfoContext(ctx, "LLM response migrated", "tokens", tokens)
+		span.AddEvent("llm.migrated")
+		footer.Migrated = true
+		footer.ResumableAt = uint64(tokens) // #nosec G115 -- token counts are never negative.
+	}
+	// the hint lets the client route the next turn to the same backend instance.
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		footer.SessionHint = req.Header.Get(sessionHintRequestHeader)
+		footer.Model = refundRecorder.Model()
+		footer.Continuations = s.issueContinuations(req, refundRecorder, requestedModel)
+	}
+	footer.ErrorDetail = failure != nil
+	if hasRefund {
+		footer.RefundSignature, err = s.refundSignature(ctx, creditAmount, refund, footer.Aborted)
+		if err != nil {
+			// dropping the refund would charge the request in full, the router decides whether to
+			// trust the unsigned refund instead.
+			slog.ErrorContext(ctx, "Failed to sign refund, sending it unsigned", "error", err)
+			span.AddEvent("refund.unsigned")
+			footer.RefundUnsigned = true
+		}
 	}
-	err = encoder.Close(footer)
+	err = faultinject.Inject(ctx, faultinject.FooterWrite)
+	if err == nil {
+		err = encoder.Close(footer)
+	}
+	s.encoder, s.abortRefund = nil, nil
 	if err != nil {
 		return otelutil.Errorf(span, "failed to close output encoder: %w", err)
 	}
 
+	// the client has its response, mirrored requests may still be running against the shadow backend.
+	if s.mirror != nil {
+		s.mirror.wait()
+	}
+
+	// the client knows about the failure, the worker still exits with an error.
+	if failure != nil {
+		return otelutil.RecordError(span, failure)
+	}
+
 	span.SetStatus(codes.Ok, "")
 	// Important we return err here instead of nil to catch any errors during deferred cleanup.
 	return err
 }
 
-func (s *Worker) newRefund(code int, refundRecorder refundRecorder) (currency.Value, bool, error) {
+// recordBudgetUsage records the bucketed output tokens, credits used and refund on the span.
+func (s *Worker) recordBudgetUsage(span trace.Span, refundRecorder refundRecorder, refund currency.Value, creditAmount int64) {
+	_, tokens := refundRecorder.Output()
+	span.SetAttributes(attribute.Int64(BudgetOutputTokensAttr, BudgetBucket(int64(tokens))))
+
+	attrs, err := RefundAttributes(creditAmount, refund)
+	if err != nil {
+		slog.WarnContext(s.ctx, "failed to record refund in trace", "error", err)
+		return
+	}
+	span.SetAttributes(attrs...)
+}
+
+// newRefund determines the refund of creditAmount, the credits of the request including its top-ups.
+// Up to waivedInputTokens input tokens of a completed response are not charged.
+func (s *Worker) newRefund(path string, code int, refundRecorder refundRecorder, creditAmount int64, requestedModel string, waivedInputTokens float64) (currency.Value, bool, error) {
 	// Refund credits:
-	// * For 2xx responses: Calculate a refund based on recorded usage.
+	// * For 2xx responses of another model than requested: Do a full refund, the client didn't get
+	//   what it paid for.
+	// * For 2xx responses that the backend aborted mid-stream or that were migrated to another node:
+	//   Refund everything but the delivered output tokens.
+	// * For 2xx responses: Price the recorded usage with the pricing of the route, minus the input
+	//   tokens covered by continuation tokens.
 	// * For 4xx responses: Do a full refund. This is our goodwill for now, see CS-607.
 	// * For 5xx responses: Do a full refund. This is likely our fault we shouldn't charge for it
+	//   Error bodies are not parsed for usage, see errorRefundRecorder.
 	var (
 		refund currency.Value
 		err    error
 	)
 	switch {
+	case code >= 200 && code < 300 && servedOtherModel(requestedModel, refundRecorder.Model()):
+		slog.WarnContext(s.ctx, "Backend served another model than requested",
+			"requested_model", requestedModel, "served_model", refundRecorder.Model())
+		refund, err = currency.Exact(creditAmount)
+	case code >= 200 && code < 300 && (refundRecorder.Aborted() != nil || refundRecorder.Migrated()):
+		refund, err = s.abortedRefund(path, code, refundRecorder, creditAmount)
 	case code >= 200 && code < 300:
-		refund, err = refundRecorder.Refund(s.config.RequestParams.CreditAmount)
+		var usage Usage
+		usage, err = refundRecorder.Usage()
+		if err == nil {
+			usage.WaivedInputTokens = min(usage.InputTokens, waivedInputTokens)
+			refund, err = s.pricing.refund(path, usage, creditAmount)
+		}
 	case code >= 400:
-		refund, err = currency.Exact(s.config.RequestParams.CreditAmount)
+		refund, err = currency.Exact(creditAmount)
 	default:
 		return currency.Zero, false, fmt.Errorf("unexpected status code: %d", code)
 	}
@@ -314,36 +602,62 @@ func (s *Worker) newRefund(code int, refundRecorder refundRecorder) (currency.Va
 	return refund, true, nil
 }
 
-func (s *Worker) handle(req *http.Request) (*http.Response, error) {
+// abortedRefund determines the refund of creditAmount for a response that ended before it was
+// complete. Successful responses are refunded everything but the delivered output, others in full.
+func (s *Worker) abortedRefund(path string, code int, refundRecorder refundRecorder, creditAmount int64) (currency.Value, error) {
+	if code < 200 || code >= 300 {
+		return currency.Exact(creditAmount)
+	}
+	return s.pricing.refund(path, refundRecorder.DeliveredUsage(), creditAmount)
+}
+
+func (s *Worker) handle(req *http.Request, body []byte) (*http.Response, error) {
 	ctx, span := otelutil.Tracer.Start(req.Context(), "computeworker.handle")
 	defer span.End()
 
 	origHeader := req.Header
-	// recreate the request but point it to the local LLM instance.
-	endpointURL, err := url.Parse(s.config.LLMBaseURL)
+	// the path of the client request, the backend url may add a prefix to it.
+	path := req.URL.Path
+	// recreate the request but point it to the local LLM instance, router_com may have picked one
+	// of several instances for a request in a session.
+	llmBaseURL := s.config.LLMBaseURL
+	if s.config.RequestParams.LLMBaseURL != "" {
+		llmBaseURL = s.config.RequestParams.LLMBaseURL
+	}
+	endpointURL, err := backendURL(llmBaseURL, path)
 	if err != nil {
 		return nil, otelutil.Errorf(span, "failed to create LLM request. URL parsing error: %w", err)
 	}
-	endpointURL.Path = req.URL.Path
 
-	req, err = http.NewRequestWithContext(ctx, req.Method, endpointURL.String(), req.Body)
+	req, err = http.NewRequestWithContext(ctx, req.Method, endpointURL, bytes.NewReader(body))
 	if err != nil {
 		return nil, otelutil.Errorf(span, "failed to create LLM request: %w", err)
 	}
 
 	// Headers we forward to the LLM. We set them from scratch and don't use the headers from req.
-	req.Header.Set("Content-Type", "application/json")
+	// Form bodies were re-encoded by the body validator, the Content-Type carries its boundary.
+	if formPath(path) {
+		req.Header.Set("Content-Type", origHeader.Get("Content-Type"))
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
 	req.Header.Add("Accept", "application/json")
 	req.Header.Add("Accept", "application/x-ndjson")
+	// the shadow backend gets the same request, minus the credentials of the production backend.
+	mirrorHeader := req.Header.Clone()
+	// backend credentials come from our config only, client Authorization headers are never forwarded.
+	if s.config.LLMAuthorization != "" {
+		req.Header.Set("Authorization", s.config.LLMAuthorization)
+	}
 
 	exec := origHeader.Get("X-Confsec-Exec")
 	switch {
 	case exec == "noop":
 		recordConfsecExecHeaderInTrace(ctx, exec)
-		return s.recordNoopResponse(req.URL.Path)
+		return s.recordNoopResponse(path)
 	case exec == "simulated":
 		recordConfsecExecHeaderInTrace(ctx, exec)
-		return s.recordSimulatedResponse()
+		return s.recordSimulatedResponse(path, origHeader)
 	case strings.HasPrefix(exec, "diagnostic-"):
 		recordConfsecExecHeaderInTrace(ctx, exec)
 		scenario, _ := strings.CutPrefix(exec, "diagnostic-")
@@ -351,10 +665,31 @@ func (s *Worker) handle(req *http.Request) (*http.Response, error) {
 	default:
 		ctx, span := otelutil.Tracer.Start(ctx, "computeworker.handle.Do")
 		defer span.End()
-		resp, err := s.httpClient.Do(req.WithContext(ctx))
+		if err := faultinject.Inject(ctx, faultinject.BackendDial); err != nil {
+			return nil, otelutil.Errorf(span, "request to the llm failed: %w", err)
+		}
+		if s.mirror != nil {
+			s.mirror.send(ctx, req.Method, path, mirrorHeader, body)
+		}
+		var resp *http.Response
+		// models with backend replicas are served by their pool instead of the llm base url.
+		if model := origHeader.Get(requestedModelHeader); s.config.BackendPoolSocket != "" && model != "" {
+			resp, err = s.doPooled(ctx, model, req, path, body)
+		} else {
+			resp, err = s.httpClient.Do(req.WithContext(ctx))
+		}
 		if err != nil {
 			return nil, otelutil.Errorf(span, "request to the llm failed: %w", err)
 		}
+		if err := s.responseValidator.Validate(resp); err != nil {
+			// the content type comes from the backend, not the client, so it is safe to log.
+			slog.WarnContext(ctx, "Rejecting LLM response", "error", err, "status", resp.StatusCode)
+			span.AddEvent("llm.unexpected_content_type")
+			if closeErr := resp.Body.Close(); closeErr != nil {
+				slog.WarnContext(ctx, "Failed to close rejected LLM response", "error", closeErr)
+			}
+			return unexpectedContentTypeResponse()
+		}
 		return resp, nil
 	}
 }
@@ -366,8 +701,8 @@ func recordConfsecExecHeaderInTrace(ctx context.Context, exec string) {
 
 // recordNoopResponse returns a minimal response without performing any inference.
 // The response format depends on the path parameter:
-// - If path = "/api/generate", returns an Ollama GenerateResponse
-// - If path = "/v1/chat/completions", returns an OpenAI ChatCompletionResponse
+// - If path = "/api/generate", returns an Ollama generate response
+// - If path = "/v1/chat/completions", returns an OpenAI chat completion response
 // Intended for load and e2e testing. Note that this response will include necessary fields for refunds to work.
 func (*Worker) recordNoopResponse(path string) (*http.Response, error) {
 	var buf bytes.Buffer
@@ -376,22 +711,22 @@ func (*Worker) recordNoopResponse(path string) (*http.Response, error) {
 	switch path {
 	case "/v1/chat/completions":
 		// Return OpenAI chat completion response
-		if err := enc.Encode(openai.ChatCompletionResponse{
+		if err := enc.Encode(openAIResponseChunk{
 			ID:      "chatcmpl-noop",
 			Object:  "chat.completion",
-			Created: int64(time.Now().Unix()),
+			Created: time.Now().Unix(),
 			Model:   "none",
-			Choices: []openai.ChatCompletionChoice{
+			Choices: []openAIChoice{
 				{
 					Index: 0,
-					Message: openai.ChatCompletionMessage{
-						Role:    openai.ChatMessageRoleAssistant,
+					Message: &openAIMessage{
+						Role:    "assistant",
 						Content: "noop",
 					},
-					FinishReason: openai.FinishReasonStop,
+					FinishReason: &finishReasonStop,
 				},
 			},
-			Usage: openai.Usage{
+			Usage: &openAIUsage{
 				PromptTokens:     1,
 				CompletionTokens: 4,
 				TotalTokens:      5,
@@ -415,22 +750,20 @@ func (*Worker) recordNoopResponse(path string) (*http.Response, error) {
 
 	default:
 		// Default to Ollama /api/generate response
-		if err := enc.Encode(ollama.GenerateResponse{
+		if err := enc.Encode(ollamaResponseChunk{
 			Model:     "none",
 			CreatedAt: time.Now(),
 			Response:  "noop",
 		}); err != nil {
 			return nil, fmt.Errorf("failed to encode response: %w", err)
 		}
-		if err := enc.Encode(ollama.GenerateResponse{
-			Model:      "none",
-			CreatedAt:  time.Now(),
-			Done:       true,
-			DoneReason: "stop",
-			Metrics: ollama.Metrics{
-				PromptEvalCount: 1, // Struct field has `omitempty` tag, so we need to set it to a non-zero value.
-				EvalCount:       4, // "noop" has 4 characters.
-			},
+		if err := enc.Encode(ollamaResponseChunk{
+			Model:           "none",
+			CreatedAt:       time.Now(),
+			Done:            true,
+			DoneReason:      finishReasonStop,
+			PromptEvalCount: 1, // Field has `omitempty` tag, so we need to set it to a non-zero value.
+			EvalCount:       4, // "noop" has 4 characters.
 		}); err != nil {
 			return nil, fmt.Errorf("failed to encode done response: %w", err)
 		}
@@ -451,28 +784,41 @@ func (*Worker) recordNoopResponse(path string) (*http.Response, error) {
 	}
 }
 
-// recordSimulatedResponse returns a representative Ollama-like streaming response without performing inference.
-// These responses are intended to mask traffic (which implies that they work with refunds).
-func (s *Worker) recordSimulatedResponse() (*http.Response, error) {
+// recordSimulatedResponse returns a representative streaming response without performing inference.
+// The response has the streaming format of path, see newSimulatedEncoder. These responses are intended
+// to mask traffic (which implies that they work with refunds).
+//
+// If a seed is provided via the SimulatedSeedHeader or the worker config, the token count, tokens and
+// delays are derived from the seed. This makes simulated responses reproducible across load test runs.
+func (s *Worker) recordSimulatedResponse(path string, header http.Header) (*http.Response, error) {
 	const avgTokenDelay = 4 * time.Microsecond
 	maxTokenN := s.config.RequestParams.CreditAmount / models.OutputTokenCreditMultiplier
 
-	bigTokenN, err := rand.Int(rand.Reader, big.NewInt(maxTokenN))
+	rnd, err := s.simulationRand(header)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate token count: %w", err)
+		return nil, err
 	}
 
-	tokenN := bigTokenN.Int64()
+	tokenN, err := rnd.Int64N(maxTokenN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token count: %w", err)
+	}
 
 	// Have 10% of requests hit the token limit and issue no refund.
-	if n, err := rand.Int(rand.Reader, big.NewInt(100)); err != nil {
+	if n, err := rnd.Int64N(100); err != nil {
 		return nil, fmt.Errorf("failed to generate random number: %w", err)
-	} else if n.Int64() <= 10 {
+	} else if n <= 10 {
 		tokenN = maxTokenN
 	}
 
+	id, err := rnd.Text(24)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate response id: %w", err)
+	}
+
 	r, w := io.Pipe()
-	go s.writeSimulatedStreamingBody(w, tokenN, avgTokenDelay)
+	enc := newSimulatedEncoder(path, w, "cmpl-"+strings.ToLower(id))
+	go s.writeSimulatedStreamingBody(w, enc, rnd, tokenN, avgTokenDelay)
 
 	return &http.Response{
 		Status:     http.StatusText(http.StatusOK),
@@ -481,7 +827,7 @@ func (s *Worker) recordSimulatedResponse() (*http.Response, error) {
 		ProtoMajor: 1,
 		ProtoMinor: 1,
 		Header: http.Header{
-			"Content-Type": []string{"application/x-ndjson"},
+			"Content-Type": []string{enc.ContentType()},
 			"Date":         []string{time.Now().Format(http.TimeFormat)},
 		},
 		TransferEncoding: []string{"chunked"},
@@ -489,7 +835,7 @@ func (s *Worker) recordSimulatedResponse() (*http.Response, error) {
 	}, nil
 }
 
-func (*Worker) writeSimulatedStreamingBody(w io.WriteCloser, tokenN int64, avgTokenDelay time.Duration) {
+func (*Worker) writeSimulatedStreamingBody(w io.WriteCloser, enc simulatedEncoder, rnd simulationRand, tokenN int64, avgTokenDelay time.Duration) {
 	defer func() {
 		err := w.Close()
 		if err != nil {
@@ -498,55 +844,37 @@ func (*Worker) writeSimulatedStreamingBody(w io.WriteCloser, tokenN int64, avgTo
 	}()
 
 	startTime := time.Now()
-	enc := json.NewEncoder(w)
 	for i := int64(0); i < tokenN; i++ {
 		// Generate a variable length between 0-2 and we'll add that to a base
 		// length below of 3 to have tokens between 3-5 characters.
-		tokenLen, err := rand.Int(rand.Reader, big.NewInt(int64(3)))
+		tokenLen, err := rnd.Int64N(3)
 		if err != nil {
 			slog.Error("failed to generate token len", "error", err)
 			return
 		}
 
-		// Write out a random tokens in the Ollama format.
-		token := randText(3 + int(tokenLen.Int64()))
-		if err := enc.Encode(ollama.GenerateResponse{Model: "simulated", CreatedAt: time.Now(), Response: token}); err != nil {
+		// Write out a random token in the format of the route.
+		token, err := rnd.Text(3 + int(tokenLen))
+		if err != nil {
+			slog.Error("failed to generate token", "error", err)
+			return
+		}
+		if err := enc.Token(token); err != nil {
 			slog.Error("failed to encode response", "error", err)
 			return
 		}
 
 		// Simulate delay in between tokens.
-		jitter, err := rand.Int(rand.Reader, big.NewInt(int64(avgTokenDelay)))
+		jitter, err := rnd.Int64N(int64(avgTokenDelay))
 		if err != nil {
 			slog.Error("failed to generate refund amount", "error", err)
 			return
 		}
-		time.Sleep(avgTokenDelay/2 + time.Duration(jitter.Int64()+1))
+		time.Sleep(avgTokenDelay/2 + time.Duration(jitter+1))
 	}
 
-	elapsed := time.Since(startTime)
-
 	// Mark the response as complete.
-	if err := enc.Encode(ollama.GenerateResponse{
-		Model:      "simulated",
-		CreatedAt:  time.Now(),
-		Done:       true,
-		DoneReason: "stop",
-		Context: []int{ // context simply pads to a typical size
-			12345, 12345, 12345, 12345, 12345, 12345, 12345, 12345, 12345, 12345,
-			12345, 12345, 12345, 12345, 12345, 12345, 12345, 12345, 12345, 12345,
-			12345, 12345, 12345, 12345, 12345, 12345, 12345, 12345, 12345, 12345,
-			12345, 12345, 12345, 12345, 12345, 12345, 12345, 12345, 12345, 12345,
-		},
-		Metrics: ollama.Metrics{ // these values are simply to pad; not necessarily accurate
-			TotalDuration:      elapsed,
-			LoadDuration:       elapsed,
-			PromptEvalCount:    int(tokenN),
-			PromptEvalDuration: elapsed,
-			EvalCount:          int(tokenN),
-			EvalDuration:       elapsed,
-		},
-	}); err != nil {
+	if err := enc.Done(tokenN, time.Since(startTime)); err != nil {
 		slog.Error("failed to encode done response", "error", err)
 		return
 	}
@@ -663,34 +991,6 @@ func newStreamingBody(ctx context.Context, body []byte, chunkPause time.Duration
 	return r
 }
 
-func calculateRefund(numInputTokens, numOutputTokens float64, creditAmount int64) (currency.Value, error) {
-	creditUsed := (numInputTokens * models.InputTokenCreditMultiplier) + (numOutputTokens * models.OutputTokenCreditMultiplier)
-
-	refund := float64(creditAmount) - creditUsed
-
-	if refund > 0 {
-		roundingFactor, err := currency.RandFloat64()
-		if err != nil {
-			slog.Error("failed to generate random float for rounding", "error", err)
-			return currency.Zero, fmt.Errorf("failed to generate random float for rounding: %w", err)
-		}
-		refundAmount, err := currency.Rounded(refund, roundingFactor)
-		if err != nil {
-			slog.Error("failed to round refund amount", "error", err, "refund", refund)
-			return currency.Zero, fmt.Errorf("failed to round refund: %w", err)
-		}
-		debugAmount, err := refundAmount.Amount()
-		if err != nil {
-			slog.Error("failed to get refund amount", "error", err)
-			return currency.Zero, fmt.Errorf("failed to get refund amount: %w", err)
-		}
-		slog.Debug("refund calculations", "creditAmount", creditAmount, "creditUsed", creditUsed, "refund", refund, "roundedRefund", debugAmount)
-		return refundAmount, nil
-	}
-
-	return currency.Zero, errNoRefundAvailable
-}
-
 // Mostly copied from crypto/rand. Not available until Go 1.24.
 func randText(n int) string {
 	b := make([]byte, 0, n)
@@ -119,6 +119,123 @@ func TestServiceRun(t *testing.T) {
 				require.GreaterOrEqual(t, amount, int64(180))
 			},
 		},
+		"ok, backend authorization from config is sent instead of client authorization": {
+			creditAmount: 200,
+			reqFunc: func(t *testing.T) *http.Request {
+				bdy := strings.NewReader(`{"model":"llama3.2:1b","messages":[{"role":"user","content":"Ping"}],"stream":false}`)
+				req := newJSONRequest(t, "https://confsec.invalid/v1/chat/completions", bdy)
+				req.Header.Set("Authorization", "Bearer client-key")
+				return req
+			},
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, []string{"Bearer backend-key"}, r.Header.Values("Authorization"))
+				data := readTestDataResponse(t, "openai-chat-completion-no-stream-empty.txt")
+				w.Write(data)
+			},
+			modConfig: func(t *testing.T, cfg *computeworker.Config) {
+				cfg.LLMAuthorization = "Bearer backend-key"
+			},
+			verifyRespFunc: func(t *testing.T, resp *http.Response) {
+				require.Equal(t, http.StatusOK, resp.StatusCode)
+				require.NoError(t, resp.Body.Close())
+			},
+			verifyFooter: func(t *testing.T, f output.Footer) {
+				require.NotNil(t, f.Refund)
+			},
+		},
+		"ok, refund that fails to sign is sent unsigned": {
+			creditAmount: 200,
+			reqFunc: func(t *testing.T) *http.Request {
+				bdy := strings.NewReader(`{"model":"llama3.2:1b","messages":[{"role":"user","content":"Ping"}],"stream":false}`)
+				return newJSONRequest(t, "https://confsec.invalid/v1/chat/completions", bdy)
+			},
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				data := readTestDataResponse(t, "openai-chat-completion-no-stream-empty.txt")
+				w.Write(data)
+			},
+			modConfig: func(t *testing.T, cfg *computeworker.Config) {
+				// without a router request ID the refund can't be signed.
+				cfg.TPM.RefundKeyHandle = 0x81000002
+			},
+			verifyRespFunc: func(t *testing.T, resp *http.Response) {
+				require.Equal(t, http.StatusOK, resp.StatusCode)
+				require.NoError(t, resp.Body.Close())
+			},
+			verifyFooter: func(t *testing.T, f output.Footer) {
+				require.NotNil(t, f.Refund)
+				require.Empty(t, f.RefundSignature)
+				require.True(t, f.RefundUnsigned)
+			},
+		},
+		"ok, node request id is echoed in the encrypted response": {
+			creditAmount: 200,
+			reqFunc: func(t *testing.T) *http.Request {
+				bdy := strings.NewReader(`{"model":"llama3.2:1b","messages":[{"role":"user","content":"Ping"}],"stream":false}`)
+				return newJSONRequest(t, "https://confsec.invalid/v1/chat/completions", bdy)
+			},
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				data := readTestDataResponse(t, "openai-chat-completion-no-stream-empty.txt")
+				w.Write(data)
+			},
+			modConfig: func(t *testing.T, cfg *computeworker.Config) {
+				cfg.RequestParams.NodeRequestID = "0197a2b4-node-request"
+				cfg.EchoNodeRequestID = true
+			},
+			verifyRespFunc: func(t *testing.T, resp *http.Response) {
+				require.Equal(t, http.StatusOK, resp.StatusCode)
+				require.Equal(t, "0197a2b4-node-request", resp.Header.Get(computeworker.NodeRequestIDHeader))
+				require.NoError(t, resp.Body.Close())
+			},
+			verifyFooter: func(t *testing.T, f output.Footer) {
+				require.NotNil(t, f.Refund)
+			},
+		},
+		"ok, response is padded with encrypted filler": {
+			creditAmount: 200,
+			reqFunc: func(t *testing.T) *http.Request {
+				bdy := strings.NewReader(`{"model":"llama3.2:1b","messages":[{"role":"user","content":"Ping"}],"stream":false}`)
+				return newJSONRequest(t, "https://confsec.invalid/v1/chat/completions", bdy)
+			},
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				data := readTestDataResponse(t, "openai-chat-completion-no-stream-empty.txt")
+				w.Write(data)
+			},
+			modConfig: func(t *testing.T, cfg *computeworker.Config) {
+				cfg.Padding = computeworker.PaddingConfig{Mode: computeworker.PaddingModeStep, Step: 1024, MaxPadding: 1024}
+			},
+			verifyRespFunc: func(t *testing.T, resp *http.Response) {
+				require.Equal(t, http.StatusOK, resp.StatusCode)
+				// the body is unchanged, the filler is in the trailer.
+				data := readTestDataResponse(t, "openai-chat-completion-no-stream-empty.txt")
+				test.RequireReadAll(t, data, resp.Body)
+				require.Len(t, resp.Trailer.Get(computeworker.PaddingTrailer), 1024-len(data))
+				require.NoError(t, resp.Body.Close())
+			},
+			verifyFooter: func(t *testing.T, f output.Footer) {
+				require.NotNil(t, f.Refund)
+			},
+		},
+		"ok, client authorization is not forwarded to the llm": {
+			creditAmount: 200,
+			reqFunc: func(t *testing.T) *http.Request {
+				bdy := strings.NewReader(`{"model":"llama3.2:1b","messages":[{"role":"user","content":"Ping"}],"stream":false}`)
+				req := newJSONRequest(t, "https://confsec.invalid/v1/chat/completions", bdy)
+				req.Header.Set("Authorization", "Bearer client-key")
+				return req
+			},
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				assert.Empty(t, r.Header.Values("Authorization"))
+				data := readTestDataResponse(t, "openai-chat-completion-no-stream-empty.txt")
+				w.Write(data)
+			},
+			verifyRespFunc: func(t *testing.T, resp *http.Response) {
+				require.Equal(t, http.StatusOK, resp.StatusCode)
+				require.NoError(t, resp.Body.Close())
+			},
+			verifyFooter: func(t *testing.T, f output.Footer) {
+				require.NotNil(t, f.Refund)
+			},
+		},
 		"ok, /v1/chat/completions no streaming, valid response from llm, missing eval_count, no refund": {
 			creditAmount: 100,
 			reqFunc: func(t *testing.T) *http.Request {
@@ -432,7 +549,7 @@ func TestServiceRun(t *testing.T) {
 			verifyRespFunc: func(t *testing.T, resp *http.Response) {
 				require.Equal(t, http.StatusOK, resp.StatusCode)
 				require.Equal(t, http.Header{
-					"Content-Type": []string{"application/x-ndjson"},
+					"Content-Type": []string{"text/event-stream"},
 					"Date":         []string{resp.Header.Get("Date")},
 				}, resp.Header)
 				data, err := io.ReadAll(resp.Body)
@@ -0,0 +1,358 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/debug"
+	"github.com/openpcc/openpcc/otel/otelutil"
+	"github.com/openpcc/twoway"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// A session is a long-lived compute_worker that handles sequential requests over stdin and stdout,
+// so the TPM receiver is set up once instead of per request. Every request still carries its own
+// encapsulated key, credit amount and output MAC key.
+//
+// Both directions are a sequence of frames: a type byte, a big endian uint32 payload length and
+// the payload. A request is a params frame, the ciphertext in data frames and an end frame. The
+// response is the worker output in data frames and an end frame with the exit code of the request.
+const (
+	sessionFrameParams byte = iota + 1
+	sessionFrameData
+	sessionFrameEnd
+)
+
+// maxSessionFrameLen bounds the payload of a single frame.
+const maxSessionFrameLen = 1 << 20
+
+// sessionChunkLen is the max payload of the data frames WriteSessionRequest writes.
+const sessionChunkLen = 32 * 1024
+
+// SessionRequest starts a single request in a session.
+type SessionRequest struct {
+	Params RequestParams `json:"params"`
+	// Traceparent is the trace context of the request.
+	Traceparent string `json:"traceparent,omitempty"`
+}
+
+func (r SessionRequest) validate() error {
+	if r.Params.MediaType == "" {
+		return errors.New("missing request media type")
+	}
+	// see ParseConfigFromFlags.
+	if r.Params.CreditAmount < 0 {
+		return fmt.Errorf("invalid request credit amount: %d", r.Params.CreditAmount)
+	}
+	return nil
+}
+
+func writeSessionFrame(w io.Writer, typ byte, payload []byte) error {
+	frame := make([]byte, 5+len(payload))
+	frame[0] = typ
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(payload))) // #nosec G115 -- bounded by maxSessionFrameLen.
+	copy(frame[5:], payload)
+	_, err := w.Write(frame)
+	return err
+}
+
+func readSessionFrame(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	n := binary.BigEndian.Uint32(header[1:])
+	if n > maxSessionFrameLen {
+		return 0, nil, fmt.Errorf("session frame of %d bytes exceeds max length", n)
+	}
+
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, fmt.Errorf("failed to read session frame: %w", errors.Join(err, io.ErrUnexpectedEOF))
+	}
+	return header[0], payload, nil
+}
+
+// WriteSessionRequest writes a request to a session. When reading body fails, the request is
+// still ended so the session stays usable, and the read error is returned.
+func WriteSessionRequest(w io.Writer, req SessionRequest, body io.Reader) error {
+	params, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session request: %w", err)
+	}
+	if err := writeSessionFrame(w, sessionFrameParams, params); err != nil {
+		return fmt.Errorf("failed to write session request params: %w", err)
+	}
+
+	var readErr error
+	buf := make([]byte, sessionChunkLen)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if err := writeSessionFrame(w, sessionFrameData, buf[:n]); err != nil {
+				return fmt.Errorf("failed to write session request body: %w", err)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			readErr = fmt.Errorf("failed to read request body: %w", err)
+			break
+		}
+	}
+
+	if err := writeSessionFrame(w, sessionFrameEnd, nil); err != nil {
+		return errors.Join(readErr, fmt.Errorf("failed to end session request: %w", err))
+	}
+	return readErr
+}
+
+// SessionReader reads the data frames of a request body or response, until its end frame.
+type SessionReader struct {
+	r   io.Reader
+	buf []byte
+	end []byte
+	err error
+}
+
+func NewSessionReader(r io.Reader) *SessionReader {
+	return &SessionReader{r: r}
+}
+
+func (s *SessionReader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+
+		typ, payload, err := readSessionFrame(s.r)
+		switch {
+		case errors.Is(err, io.EOF):
+			s.err = io.ErrUnexpectedEOF
+		case err != nil:
+			s.err = err
+		case typ == sessionFrameData:
+			s.buf = payload
+		case typ == sessionFrameEnd:
+			s.end = payload
+			s.err = io.EOF
+		default:
+			s.err = fmt.Errorf("unexpected session frame type %d", typ)
+		}
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// ExitCode returns the exit code of the request, once the response has been read to its end.
+func (s *SessionReader) ExitCode() (int, error) {
+	if !errors.Is(s.err, io.EOF) {
+		return 0, errors.New("session response was not read to its end")
+	}
+	if len(s.end) != 4 {
+		return 0, fmt.Errorf("invalid session exit code of %d bytes", len(s.end))
+	}
+	return int(binary.BigEndian.Uint32(s.end)), nil
+}
+
+// sessionWriter writes the worker output of a request as data frames.
+type sessionWriter struct {
+	w io.Writer
+}
+
+func (s *sessionWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), maxSessionFrameLen)
+		if err := writeSessionFrame(s.w, sessionFrameData, p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (s *sessionWriter) end(exitCode int) error {
+	code := make([]byte, 4)
+	binary.BigEndian.PutUint32(code, uint32(exitCode)) // #nosec G115 -- exit codes are small and positive.
+	return writeSessionFrame(s.w, sessionFrameEnd, code)
+}
+
+// Session handles sequential requests with a single TPM receiver until router_com closes stdin.
+type Session struct {
+	ctx         context.Context
+	config      *Config
+	httpClient  *http.Client
+	receiver    *twoway.MultiRequestReceiver
+	diagnostics map[string]string
+	reader      *bufio.Reader
+	writer      io.Writer
+	// exitCode maps the error of a request to the exit code a single request worker would exit with.
+	exitCode func(error) int
+
+	// setupLatency is the startup latency of setting up the session, it is reported with the
+	// first request only.
+	setupLatency StartupLatency
+
+	mu       sync.Mutex
+	current  *Worker
+	migrated bool
+}
+
+// NewSession sets up the dependencies shared by the requests of the session.
+func NewSession(ctx context.Context, config *Config, reader io.Reader, writer io.Writer, exitCode func(error) int) (*Session, error) {
+	spanCtx, span := otelutil.Tracer.Start(ctx, "computeworker.NewSession")
+	defer span.End()
+
+	start := time.Now()
+	httpClient, receiver, diagnostics, err := newDependencies(spanCtx, config)
+	if err != nil {
+		return nil, otelutil.RecordError(span, err)
+	}
+	setupLatency := StartupLatency{
+		FlagParse:       config.FlagParseDuration,
+		TPMReceiverInit: time.Since(start),
+	}
+
+	// requests are traced in their own trace, not as part of setting up the session.
+	return &Session{
+		ctx:          ctx,
+		config:       config,
+		httpClient:   httpClient,
+		receiver:     receiver,
+		diagnostics:  diagnostics,
+		reader:       bufio.NewReader(reader),
+		writer:       writer,
+		exitCode:     exitCode,
+		setupLatency: setupLatency,
+	}, nil
+}
+
+// Run handles requests until stdin is closed, or until a request was migrated.
+func (s *Session) Run() error {
+	for {
+		typ, payload, err := readSessionFrame(s.reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read session request: %w", err)
+		}
+		if typ != sessionFrameParams {
+			return fmt.Errorf("unexpected session frame type %d", typ)
+		}
+
+		var req SessionRequest
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return fmt.Errorf("failed to unmarshal session request: %w", err)
+		}
+
+		if err := s.handle(req); err != nil {
+			return err
+		}
+
+		if s.isMigrated() {
+			slog.InfoContext(s.ctx, "Session migrated, not accepting more requests")
+			return nil
+		}
+	}
+}
+
+// handle runs a single request. Errors of the request are reported with its exit code, only
+// errors that break the session are returned.
+func (s *Session) handle(req SessionRequest) error {
+	ctx := s.ctx
+	if req.Traceparent != "" {
+		carrier := propagation.MapCarrier{"traceparent": req.Traceparent}
+		ctx = otel.GetTextMapPropagator().Extract(ctx, carrier)
+	}
+	ctx = debug.WithRequestID(ctx, req.Params.NodeRequestID)
+
+	body := NewSessionReader(s.reader)
+	out := &sessionWriter{w: s.writer}
+
+	err := req.validate()
+	if err == nil {
+		config := *s.config
+		config.RequestParams = req.Params
+		worker := NewWithDependencies(ctx, &config, s.httpClient, s.receiver, body, out, s.diagnostics)
+		worker.startupLatency = s.setupLatency
+		s.setupLatency = StartupLatency{}
+
+		s.setCurrent(worker)
+		err = worker.Run()
+		s.setCurrent(nil)
+	}
+
+	exitCode := 0
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to run session request", "error", err)
+		exitCode = s.exitCode(err)
+	}
+
+	// the next request starts after the end of this body, however much of it the worker read.
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return fmt.Errorf("failed to drain session request body: %w", err)
+	}
+	if err := out.end(exitCode); err != nil {
+		return fmt.Errorf("failed to end session response: %w", err)
+	}
+	return nil
+}
+
+func (s *Session) setCurrent(w *Worker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = w
+	if w != nil && s.migrated {
+		w.Migrate()
+	}
+}
+
+func (s *Session) isMigrated() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.migrated
+}
+
+// Migrate migrates the current request to another node, the session ends after it.
+func (s *Session) Migrate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.migrated = true
+	if s.current != nil {
+		s.current.Migrate()
+	}
+}
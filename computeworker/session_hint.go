@@ -0,0 +1,85 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+)
+
+// SessionHintHeader is the header clients send the session hint from the footer of a previous
+// response back in, so router_com can route the next turn of the conversation to the same backend
+// instance. It is part of the outer request, the router sees it.
+const SessionHintHeader = "X-Confsec-Session-Hint"
+
+// SessionHintKeyEnv is the environment variable router_com uses to pass the session hint key.
+// It is not a flag because process arguments are world readable.
+const SessionHintKeyEnv = "COMPUTE_WORKER_SESSION_HINT_KEY"
+
+// SessionHintKeyLen is the length of the session hint key router_com generates at startup.
+const SessionHintKeyLen = 32
+
+// sessionHintLen is the length of a session hint in bytes, before hex encoding.
+const sessionHintLen = 16
+
+// sessionHintRequestHeader carries the session hint from the body validator to the footer. It is
+// only set on the decapsulated request, handle sets the backend headers from scratch.
+const sessionHintRequestHeader = "X-Confsec-Internal-Session-Hint"
+
+var sessionHintInfo = []byte("confsec session hint v1")
+
+// conversationPrefixer is implemented by request bodies that are a turn of a conversation, see
+// PromptCacheSalter.PromptCachePrefix.
+type conversationPrefixer interface {
+	PromptCachePrefix() ([]byte, error)
+}
+
+// SessionHint derives the session hint of a conversation prefix of the holder of a badge. Like
+// PromptCacheHandle, the key never leaves the node, so the router can't tell which conversation a
+// hint belongs to, and hints of the same conversation of different clients differ.
+func SessionHint(key []byte, badge []byte, prefix []byte) string {
+	badgeHash := sha256.Sum256(badge)
+	prk := promptCacheKDF.Extract(prefix, key)
+	info := slices.Concat(sessionHintInfo, []byte{0}, badgeHash[:])
+	return hex.EncodeToString(promptCacheKDF.Expand(prk, info, sessionHintLen))
+}
+
+// ValidSessionHint reports whether hint has the shape of a session hint, router_com ignores other
+// values of SessionHintHeader.
+func ValidSessionHint(hint string) bool {
+	b, err := hex.DecodeString(hint)
+	return err == nil && len(b) == sessionHintLen
+}
+
+// setSessionHint sets the session hint of r. Without a key, or for bodies that aren't a turn of a
+// conversation, r has no hint.
+func setSessionHint(r *http.Request, key []byte, badge []byte, requestBody any) error {
+	prefixer, ok := requestBody.(conversationPrefixer)
+	if len(key) == 0 || !ok {
+		return nil
+	}
+
+	prefix, err := prefixer.PromptCachePrefix()
+	if err != nil {
+		return err
+	}
+	r.Header.Set(sessionHintRequestHeader, SessionHint(key, badge, prefix))
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openpcc/openpcc/auth/credentialing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionHint(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, SessionHintKeyLen)
+	otherKey := bytes.Repeat([]byte{2}, SessionHintKeyLen)
+
+	hint := SessionHint(key, []byte("badge"), []byte("prefix"))
+	require.True(t, ValidSessionHint(hint))
+	require.Equal(t, hint, SessionHint(key, []byte("badge"), []byte("prefix")))
+	require.NotEqual(t, hint, SessionHint(otherKey, []byte("badge"), []byte("prefix")))
+	require.NotEqual(t, hint, SessionHint(key, []byte("other badge"), []byte("prefix")))
+	require.NotEqual(t, hint, SessionHint(key, []byte("badge"), []byte("other prefix")))
+
+	require.False(t, ValidSessionHint(""))
+	require.False(t, ValidSessionHint("not-hex"))
+	require.False(t, ValidSessionHint(hint[:len(hint)-2]))
+}
+
+func TestBodyValidatorSessionHint(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, SessionHintKeyLen)
+	badge := credentialing.Badge{
+		Credentials: credentialing.Credentials{Models: defaultTestModels},
+		Signature:   []byte("signature"),
+	}
+
+	validate := func(t *testing.T, key []byte, path, payload string) string {
+		validator := BodyValidator{
+			MaxSize: 1024,
+			RouteBodyTypes: map[string]func() RequestBody{
+				OllamaChatPath: func() RequestBody { return &OllamaRequestBodyChat{} },
+				OpenAIChatPath: func() RequestBody { return &OpenAIRequestBodyChat{} },
+			},
+			SupportedModels: defaultTestModels,
+			SessionHintKey:  key,
+		}
+
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(payload))
+		req.ContentLength = int64(len(payload))
+		// a client can't pick the hint of another conversation.
+		req.Header.Set(sessionHintRequestHeader, "guess")
+		require.NoError(t, validator.ValidateWithBadge(req, &badge))
+		return req.Header.Get(sessionHintRequestHeader)
+	}
+
+	t.Run("ok, turns of a conversation share the hint", func(t *testing.T) {
+		first := validate(t, key, OpenAIChatPath, `{"model":"llama3.2:1b","messages":[{"role":"user","content":"hi"}]}`)
+		second := validate(t, key, OpenAIChatPath, `{"model":"llama3.2:1b","messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"bye"}]}`)
+		other := validate(t, key, OpenAIChatPath, `{"model":"llama3.2:1b","messages":[{"role":"user","content":"bye"}]}`)
+
+		require.True(t, ValidSessionHint(first))
+		require.Equal(t, first, second)
+		require.NotEqual(t, first, other)
+	})
+
+	t.Run("ok, no hint without a key", func(t *testing.T) {
+		require.Empty(t, validate(t, nil, OpenAIChatPath, `{"model":"llama3.2:1b","messages":[{"role":"user","content":"hi"}]}`))
+	})
+
+	t.Run("ok, no hint for bodies without a conversation prefix", func(t *testing.T) {
+		require.Empty(t, validate(t, key, OllamaChatPath, `{"model":"llama3.2:1b","messages":[{"role":"user","content":"hi"}]}`))
+	})
+}
@@ -0,0 +1,139 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionFraming(t *testing.T) {
+	req := SessionRequest{
+		Params: RequestParams{
+			MediaType:       "message/bhttp",
+			EncapsulatedKey: []byte("encapsulated-key"),
+			CreditAmount:    100,
+			NodeRequestID:   "0197a2b4-node-request",
+		},
+		Traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}
+
+	// readRequest reads a request the way Session.Run does.
+	readRequest := func(t *testing.T, r io.Reader) (SessionRequest, []byte) {
+		typ, payload, err := readSessionFrame(r)
+		require.NoError(t, err)
+		require.Equal(t, sessionFrameParams, typ)
+
+		var got SessionRequest
+		require.NoError(t, json.Unmarshal(payload, &got))
+		body, err := io.ReadAll(NewSessionReader(r))
+		require.NoError(t, err)
+		return got, body
+	}
+
+	t.Run("ok, sequential requests round trip", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		large := strings.Repeat("x", 3*sessionChunkLen+1)
+		require.NoError(t, WriteSessionRequest(buf, req, strings.NewReader("ciphertext")))
+		require.NoError(t, WriteSessionRequest(buf, req, strings.NewReader(large)))
+		require.NoError(t, WriteSessionRequest(buf, req, strings.NewReader("")))
+
+		for _, want := range []string{"ciphertext", large, ""} {
+			got, body := readRequest(t, buf)
+			require.Equal(t, req, got)
+			require.Equal(t, want, string(body))
+		}
+
+		_, _, err := readSessionFrame(buf)
+		require.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("ok, body read error still ends the request", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		body := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("client went away")))
+		err := WriteSessionRequest(buf, req, body)
+		require.ErrorContains(t, err, "client went away")
+
+		_, got := readRequest(t, buf)
+		require.Equal(t, "partial", string(got))
+		require.Zero(t, buf.Len())
+	})
+
+	t.Run("ok, response carries exit code", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w := &sessionWriter{w: buf}
+		_, err := w.Write([]byte("output"))
+		require.NoError(t, err)
+		require.NoError(t, w.end(10))
+
+		r := NewSessionReader(buf)
+		_, err = r.ExitCode()
+		require.Error(t, err)
+
+		out, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, "output", string(out))
+		code, err := r.ExitCode()
+		require.NoError(t, err)
+		require.Equal(t, 10, code)
+	})
+
+	t.Run("fail, truncated response", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w := &sessionWriter{w: buf}
+		_, err := w.Write([]byte("output"))
+		require.NoError(t, err)
+
+		r := NewSessionReader(buf)
+		_, err = io.ReadAll(r)
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		_, err = r.ExitCode()
+		require.Error(t, err)
+	})
+
+	t.Run("fail, oversized frame", func(t *testing.T) {
+		frame := make([]byte, 5)
+		frame[0] = sessionFrameData
+		binary.BigEndian.PutUint32(frame[1:], maxSessionFrameLen+1)
+
+		_, err := io.ReadAll(NewSessionReader(bytes.NewReader(frame)))
+		require.ErrorContains(t, err, "exceeds max length")
+	})
+
+	t.Run("fail, unexpected frame type", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		require.NoError(t, writeSessionFrame(buf, sessionFrameParams, []byte("{}")))
+
+		_, err := io.ReadAll(NewSessionReader(buf))
+		require.ErrorContains(t, err, "unexpected session frame type")
+	})
+}
+
+func TestSessionRequestValidate(t *testing.T) {
+	require.NoError(t, SessionRequest{Params: RequestParams{MediaType: "message/bhttp", CreditAmount: 1}}.validate())
+	require.Error(t, SessionRequest{Params: RequestParams{CreditAmount: 1}}.validate())
+	require.Error(t, SessionRequest{Params: RequestParams{MediaType: "message/bhttp", CreditAmount: -1}}.validate())
+}
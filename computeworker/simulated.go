@@ -0,0 +1,98 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"crypto/rand"
+	"math/big"
+	mrand "math/rand/v2"
+	"net/http"
+	"strconv"
+)
+
+// SimulatedSeedHeader can be set on simulated requests to make the generated
+// response deterministic. Intended for load testing only.
+const SimulatedSeedHeader = "X-Confsec-Simulated-Seed"
+
+// simulationRand is the source of randomness used to generate simulated responses.
+type simulationRand interface {
+	// Int64N returns a random number in [0, n).
+	Int64N(n int64) (int64, error)
+	// Text returns a random string of n characters.
+	Text(n int) (string, error)
+}
+
+// cryptoSimulationRand uses crypto/rand, simulated responses are not reproducible.
+type cryptoSimulationRand struct{}
+
+func (cryptoSimulationRand) Int64N(n int64) (int64, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(n))
+	if err != nil {
+		return 0, err
+	}
+	return v.Int64(), nil
+}
+
+func (cryptoSimulationRand) Text(n int) (string, error) {
+	return randText(n), nil
+}
+
+// seededSimulationRand uses a seeded PRNG so that identical seeds produce identical
+// token counts, tokens and delays.
+type seededSimulationRand struct {
+	rnd *mrand.Rand
+}
+
+func newSeededSimulationRand(seed uint64) *seededSimulationRand {
+	return &seededSimulationRand{
+		rnd: mrand.New(mrand.NewPCG(seed, seed)), // #nosec G404 -- determinism is the point, not used for secrets.
+	}
+}
+
+func (r *seededSimulationRand) Int64N(n int64) (int64, error) {
+	return r.rnd.Int64N(n), nil
+}
+
+func (r *seededSimulationRand) Text(n int) (string, error) {
+	// same alphabet as crypto/rand.Text.
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[r.rnd.IntN(len(alphabet))]
+	}
+	return string(b), nil
+}
+
+// simulationRand returns the randomness source for a simulated response. A seed in the
+// request header takes precedence over the seed in the worker config.
+func (s *Worker) simulationRand(header http.Header) (simulationRand, error) {
+	if v := header.Get(SimulatedSeedHeader); v != "" {
+		seed, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			// the seed is chosen by the client, a bad one is a bad request and not a node failure.
+			return nil, newValidationError(ErrInvalidControlHeader, "invalid control header "+SimulatedSeedHeader+": "+err.Error())
+		}
+		return newSeededSimulationRand(seed), nil
+	}
+
+	if s.config.SimulatedSeed != 0 {
+		return newSeededSimulationRand(s.config.SimulatedSeed), nil
+	}
+
+	return cryptoSimulationRand{}, nil
+}
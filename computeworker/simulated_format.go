@@ -0,0 +1,236 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// simulatedModel is the model name reported by simulated responses.
+const simulatedModel = "simulated"
+
+// Response shapes of the noop and simulated responses. They only have the fields clients and the
+// refund recorders read, so the worker doesn't depend on the client libraries of the backends.
+
+// https://github.com/ollama/ollama/blob/main/docs/api.md#generate-a-completion
+type ollamaResponseChunk struct {
+	Model     string    `json:"model"`
+	CreatedAt time.Time `json:"created_at"`
+	// Response is the token of a generate response, Message the token of a chat response.
+	Response   string         `json:"response,omitempty"`
+	Message    *ollamaMessage `json:"message,omitempty"`
+	Done       bool           `json:"done"`
+	DoneReason string         `json:"done_reason,omitempty"`
+	Context    []int          `json:"context,omitempty"`
+
+	TotalDuration      time.Duration `json:"total_duration,omitempty"`
+	LoadDuration       time.Duration `json:"load_duration,omitempty"`
+	PromptEvalCount    int           `json:"prompt_eval_count,omitempty"`
+	PromptEvalDuration time.Duration `json:"prompt_eval_duration,omitempty"`
+	EvalCount          int           `json:"eval_count,omitempty"`
+	EvalDuration       time.Duration `json:"eval_duration,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// https://platform.openai.com/docs/api-reference/chat/streaming
+type openAIResponseChunk struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+	Usage   *openAIUsage   `json:"usage,omitempty"`
+}
+
+type openAIChoice struct {
+	Index int `json:"index"`
+	// Text is the token of a completions response, Message and Delta the token of a chat response.
+	Text         string         `json:"text,omitempty"`
+	Message      *openAIMessage `json:"message,omitempty"`
+	Delta        *openAIMessage `json:"delta,omitempty"`
+	FinishReason *string        `json:"finish_reason"`
+}
+
+type openAIMessage struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// finishReasonStop is the finish reason of a response that completed.
+var finishReasonStop = "stop"
+
+// simulatedEncoder writes a simulated streaming response in the format of a route.
+type simulatedEncoder interface {
+	// ContentType is the media type of the response.
+	ContentType() string
+	// Token writes a single output token.
+	Token(token string) error
+	// Done completes the response, reporting the usage the refund recorder reads.
+	Done(tokenN int64, elapsed time.Duration) error
+}
+
+// newSimulatedEncoder returns the encoder for simulated responses on path, so that masking traffic
+// looks like the responses of real requests on the same route. Routes without a streaming format
+// get Ollama generate responses.
+func newSimulatedEncoder(path string, w io.Writer, id string) simulatedEncoder {
+	switch path {
+	case OpenAICompletionsPath, OpenAIChatPath:
+		return &openAISimulatedEncoder{
+			w:       w,
+			chat:    path == OpenAIChatPath,
+			id:      id,
+			created: time.Now().Unix(),
+		}
+	default:
+		return &ollamaSimulatedEncoder{
+			enc:  json.NewEncoder(w),
+			chat: path == OllamaChatPath,
+		}
+	}
+}
+
+// ollamaSimulatedEncoder writes newline delimited JSON, like Ollama.
+type ollamaSimulatedEncoder struct {
+	enc  *json.Encoder
+	chat bool
+}
+
+func (*ollamaSimulatedEncoder) ContentType() string {
+	return "application/x-ndjson"
+}
+
+func (e *ollamaSimulatedEncoder) Token(token string) error {
+	chunk := ollamaResponseChunk{Model: simulatedModel, CreatedAt: time.Now()}
+	if e.chat {
+		chunk.Message = &ollamaMessage{Role: "assistant", Content: token}
+	} else {
+		chunk.Response = token
+	}
+	return e.enc.Encode(chunk)
+}
+
+func (e *ollamaSimulatedEncoder) Done(tokenN int64, elapsed time.Duration) error {
+	chunk := ollamaResponseChunk{
+		Model:      simulatedModel,
+		CreatedAt:  time.Now(),
+		Done:       true,
+		DoneReason: finishReasonStop,
+		// these values are simply to pad; not necessarily accurate
+		TotalDuration:      elapsed,
+		LoadDuration:       elapsed,
+		PromptEvalCount:    int(tokenN),
+		PromptEvalDuration: elapsed,
+		EvalCount:          int(tokenN),
+		EvalDuration:       elapsed,
+	}
+	if e.chat {
+		chunk.Message = &ollamaMessage{Role: "assistant"}
+	} else {
+		// context simply pads to a typical size
+		chunk.Context = make([]int, 40)
+		for i := range chunk.Context {
+			chunk.Context[i] = 12345
+		}
+	}
+	return e.enc.Encode(chunk)
+}
+
+// openAISimulatedEncoder writes server-sent events, like vLLM with stream_options.include_usage.
+type openAISimulatedEncoder struct {
+	w       io.Writer
+	chat    bool
+	id      string
+	created int64
+	// started is true once the first token was written, only the first chat delta has a role.
+	started bool
+}
+
+func (*openAISimulatedEncoder) ContentType() string {
+	return "text/event-stream"
+}
+
+func (e *openAISimulatedEncoder) Token(token string) error {
+	choice := openAIChoice{Index: 0}
+	if e.chat {
+		choice.Delta = &openAIMessage{Content: token}
+		if !e.started {
+			choice.Delta.Role = "assistant"
+		}
+	} else {
+		choice.Text = token
+	}
+	e.started = true
+	return e.writeChunk([]openAIChoice{choice}, nil)
+}
+
+func (e *openAISimulatedEncoder) Done(tokenN int64, _ time.Duration) error {
+	choice := openAIChoice{Index: 0, FinishReason: &finishReasonStop}
+	if e.chat {
+		choice.Delta = &openAIMessage{}
+	}
+	if err := e.writeChunk([]openAIChoice{choice}, nil); err != nil {
+		return err
+	}
+
+	// the usage is reported in a final chunk without choices.
+	if err := e.writeChunk([]openAIChoice{}, &openAIUsage{
+		PromptTokens:     int(tokenN),
+		CompletionTokens: int(tokenN),
+		TotalTokens:      int(2 * tokenN),
+	}); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(e.w, "data: [DONE]\n\n")
+	return err
+}
+
+func (e *openAISimulatedEncoder) writeChunk(choices []openAIChoice, usage *openAIUsage) error {
+	object := "text_completion"
+	if e.chat {
+		object = "chat.completion.chunk"
+	}
+
+	data, err := json.Marshal(openAIResponseChunk{
+		ID:      e.id,
+		Object:  object,
+		Created: e.created,
+		Model:   simulatedModel,
+		Choices: choices,
+		Usage:   usage,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(e.w, "data: %s\n\n", data)
+	return err
+}
@@ -0,0 +1,158 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordSimulatedResponseSeeded(t *testing.T) {
+	// readTokens reads the simulated response and returns the tokens and the final eval count.
+	readTokens := func(t *testing.T, w *Worker, header http.Header) ([]string, int) {
+		resp, err := w.recordSimulatedResponse(OllamaGeneratePath, header)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var (
+			tokens    []string
+			evalCount int
+		)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var line struct {
+				Response  string `json:"response"`
+				Done      bool   `json:"done"`
+				EvalCount int    `json:"eval_count"`
+			}
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+			if line.Done {
+				evalCount = line.EvalCount
+				continue
+			}
+			tokens = append(tokens, line.Response)
+		}
+		require.NoError(t, scanner.Err())
+		return tokens, evalCount
+	}
+
+	newWorker := func(seed uint64) *Worker {
+		return &Worker{
+			config: &Config{
+				RequestParams: RequestParams{CreditAmount: 1000},
+				SimulatedSeed: seed,
+			},
+		}
+	}
+
+	t.Run("ok, same header seed produces identical responses", func(t *testing.T) {
+		header := http.Header{}
+		header.Set(SimulatedSeedHeader, "42")
+
+		tokens1, count1 := readTokens(t, newWorker(0), header)
+		tokens2, count2 := readTokens(t, newWorker(0), header)
+		require.Equal(t, tokens1, tokens2)
+		require.Equal(t, count1, count2)
+		require.Len(t, tokens1, count1)
+	})
+
+	t.Run("ok, config seed produces identical responses", func(t *testing.T) {
+		tokens1, count1 := readTokens(t, newWorker(7), http.Header{})
+		tokens2, count2 := readTokens(t, newWorker(7), http.Header{})
+		require.Equal(t, tokens1, tokens2)
+		require.Equal(t, count1, count2)
+	})
+
+	t.Run("ok, header seed takes precedence over config seed", func(t *testing.T) {
+		header := http.Header{}
+		header.Set(SimulatedSeedHeader, "7")
+
+		tokens1, _ := readTokens(t, newWorker(1), header)
+		tokens2, _ := readTokens(t, newWorker(7), http.Header{})
+		require.Equal(t, tokens1, tokens2)
+	})
+
+	t.Run("fail, invalid header seed", func(t *testing.T) {
+		header := http.Header{}
+		header.Set(SimulatedSeedHeader, "not-a-number")
+
+		_, err := newWorker(0).recordSimulatedResponse(OllamaGeneratePath, header)
+		var valErr ValidationError
+		require.ErrorAs(t, err, &valErr)
+		require.Equal(t, ErrInvalidControlHeader, valErr.Code)
+		require.Equal(t, http.StatusBadRequest, classifyError(err).statusCode)
+	})
+}
+
+func TestRecordSimulatedResponseFormat(t *testing.T) {
+	header := http.Header{}
+	header.Set(SimulatedSeedHeader, "42")
+	w := &Worker{
+		config: &Config{
+			RequestParams: RequestParams{CreditAmount: 1000},
+		},
+	}
+
+	t.Run("ok, openai routes stream server-sent events with usage", func(t *testing.T) {
+		for _, path := range []string{OpenAIChatPath, OpenAICompletionsPath} {
+			resp, err := w.recordSimulatedResponse(path, header)
+			require.NoError(t, err)
+			require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+			recorder := newRefundRecorder(path, resp.Body, nil)
+			body, err := io.ReadAll(recorder)
+			require.NoError(t, err)
+			require.True(t, strings.HasSuffix(string(body), "data: [DONE]\n\n"))
+
+			var last struct {
+				Usage openAIUsage `json:"usage"`
+			}
+			events := strings.Split(strings.TrimSpace(string(body)), "\n\n")
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(events[len(events)-2], "data: ")), &last))
+
+			// every token is counted by the refund recorder, like the tokens of a real response.
+			_, tokens := recorder.Output()
+			require.Equal(t, last.Usage.CompletionTokens, tokens)
+			_, err = recordedRefund(recorder, path, 1000)
+			if tokens < MaxOutputTokens(1000) {
+				require.NoError(t, err)
+			}
+			require.NoError(t, recorder.Close())
+		}
+	})
+
+	t.Run("ok, ollama chat route streams messages", func(t *testing.T) {
+		resp, err := w.recordSimulatedResponse(OllamaChatPath, header)
+		require.NoError(t, err)
+		require.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+		recorder := newRefundRecorder(OllamaChatPath, resp.Body, nil)
+		_, err = io.ReadAll(recorder)
+		require.NoError(t, err)
+		output, tokens := recorder.Output()
+		require.Positive(t, tokens)
+		require.NotEmpty(t, output)
+		require.NoError(t, recorder.Close())
+	})
+}
@@ -0,0 +1,131 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeworker
+
+import (
+	"bufio"
+	"bytes"
+)
+
+// sseEvent is a dispatched server-sent event.
+type sseEvent struct {
+	// Type is the event field, empty for the default message event.
+	Type string
+	// Data are the data fields of the event, joined by newlines.
+	Data []byte
+	// ID is the last event ID of the stream.
+	ID string
+}
+
+// isMessage reports whether the event is a message event, the type openAI compatible backends send
+// completion chunks as.
+func (e sseEvent) isMessage() bool {
+	return e.Type == "" || e.Type == "message"
+}
+
+// sseParser parses an event stream line by line, following the event stream interpretation of the
+// HTML standard. The parser only observes the stream, the lines are passed on unchanged.
+type sseParser struct {
+	typ    string
+	data   []byte
+	lastID string
+	// cr is true when the last line ended in a CR, a LF right after it completes the same line ending.
+	cr bool
+	// started is true once the first line was parsed, only the first line can start with a BOM.
+	started bool
+}
+
+// parseLine parses a line read with readSSELine, it returns the event that a blank line dispatches.
+func (p *sseParser) parseLine(line []byte) (sseEvent, bool) {
+	if len(line) == 0 {
+		return sseEvent{}, false
+	}
+	if p.cr && line[0] == '\n' {
+		// the rest of a CRLF line ending.
+		p.cr = false
+		return sseEvent{}, false
+	}
+
+	p.cr = line[len(line)-1] == '\r'
+	line = bytes.TrimRight(line, "\r\n")
+	if !p.started {
+		p.started = true
+		line = bytes.TrimPrefix(line, []byte("\xef\xbb\xbf"))
+	}
+
+	if len(line) == 0 {
+		return p.dispatch()
+	}
+	if line[0] == ':' {
+		// comments are used as keep-alives.
+		return sseEvent{}, false
+	}
+
+	name, value, found := bytes.Cut(line, []byte{':'})
+	if found {
+		value = bytes.TrimPrefix(value, []byte{' '})
+	}
+	switch string(name) {
+	case "event":
+		p.typ = string(value)
+	case "data":
+		p.data = append(p.data, value...)
+		p.data = append(p.data, '\n')
+	case "id":
+		if !bytes.Contains(value, []byte{0}) {
+			p.lastID = string(value)
+		}
+	}
+	// retry and unknown fields are ignored.
+	return sseEvent{}, false
+}
+
+// pending reports whether an event was started but not dispatched yet.
+func (p *sseParser) pending() bool {
+	return len(p.data) > 0 || p.typ != ""
+}
+
+// dispatch ends the current event, events without data are dropped.
+func (p *sseParser) dispatch() (sseEvent, bool) {
+	typ, data := p.typ, p.data
+	p.typ, p.data = "", nil
+	if len(data) == 0 {
+		return sseEvent{}, false
+	}
+	return sseEvent{
+		Type: typ,
+		Data: data[:len(data)-1],
+		ID:   p.lastID,
+	}, true
+}
+
+// readSSELine reads a line of an event stream including its line ending, which is LF, CR or CRLF.
+// A CR ends the line right away, so the LF of a CRLF is read as a line of its own rather than
+// waiting for it, sseParser joins them again.
+func readSSELine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return line, err
+		}
+		line = append(line, b)
+		if b == '\n' || b == '\r' {
+			return line, nil
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeworker
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSEParser(t *testing.T) {
+	// parse returns the events of a stream and checks the lines add up to the stream.
+	parse := func(t *testing.T, stream string) []sseEvent {
+		r := bufio.NewReader(strings.NewReader(stream))
+		p := &sseParser{}
+		var events []sseEvent
+		var read strings.Builder
+		for {
+			line, err := readSSELine(r)
+			read.Write(line)
+			if event, ok := p.parseLine(line); ok {
+				events = append(events, event)
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+		}
+		require.Equal(t, stream, read.String())
+		return events
+	}
+
+	tests := map[string]struct {
+		stream string
+		want   []sseEvent
+	}{
+		"ok, lf": {
+			stream: "data: a\n\ndata: b\n\n",
+			want:   []sseEvent{{Data: []byte("a")}, {Data: []byte("b")}},
+		},
+		"ok, crlf": {
+			stream: "data: a\r\n\r\ndata: b\r\n\r\n",
+			want:   []sseEvent{{Data: []byte("a")}, {Data: []byte("b")}},
+		},
+		"ok, cr": {
+			stream: "data: a\r\rdata: b\r\r",
+			want:   []sseEvent{{Data: []byte("a")}, {Data: []byte("b")}},
+		},
+		"ok, multi-line data": {
+			stream: "data: {\"a\":\ndata: 1}\n\n",
+			want:   []sseEvent{{Data: []byte("{\"a\":\n1}")}},
+		},
+		"ok, event, id and comments": {
+			stream: ": keep-alive\nevent: error\nid: 7\nretry: 1000\ndata: failed\n\ndata: next\n\n",
+			want:   []sseEvent{{Type: "error", Data: []byte("failed"), ID: "7"}, {Data: []byte("next"), ID: "7"}},
+		},
+		"ok, field without space or value": {
+			stream: "data:a\ndata\n\n",
+			want:   []sseEvent{{Data: []byte("a\n")}},
+		},
+		"ok, leading bom": {
+			stream: "\xef\xbb\xbfdata: a\n\n",
+			want:   []sseEvent{{Data: []byte("a")}},
+		},
+		"ok, events without data are dropped": {
+			stream: "event: ping\n\n\n\ndata: a\n\n",
+			want:   []sseEvent{{Data: []byte("a")}},
+		},
+		"ok, unterminated event is dropped": {
+			stream: "data: a\n\ndata: b\n",
+			want:   []sseEvent{{Data: []byte("a")}},
+		},
+		"ok, json lines are not events": {
+			stream: "{\"id\":\"cmpl-1\"}\n\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.want, parse(t, tc.stream))
+		})
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"log/slog"
+	"time"
+)
+
+const (
+	// StartupLatencyMessage is the message of the log record with the startup latency of a request,
+	// router_com picks it out of the forwarded worker logs to aggregate it.
+	StartupLatencyMessage = "Startup latency"
+	// StartupLatencyKey is the key of the StartupLatency attribute of the record.
+	StartupLatencyKey = "startup_latency"
+)
+
+// StartupLatency breaks down the time from the start of compute_worker to the first byte of the
+// LLM backend response. Session workers only parse their flags and set up the TPM receiver once,
+// for the requests after the first these phases are 0.
+type StartupLatency struct {
+	FlagParse       time.Duration
+	TPMReceiverInit time.Duration
+	Decapsulation   time.Duration
+	Validation      time.Duration
+	// BackendTTFB is the time until the response headers of the LLM backend, 0 for requests that
+	// failed validation.
+	BackendTTFB time.Duration
+}
+
+// startupLatencyPhases are the attribute keys of the phases, in order.
+var startupLatencyPhases = []string{"flag_parse_ms", "tpm_receiver_init_ms", "decapsulation_ms", "validation_ms", "backend_ttfb_ms"}
+
+func (l *StartupLatency) phases() []*time.Duration {
+	return []*time.Duration{&l.FlagParse, &l.TPMReceiverInit, &l.Decapsulation, &l.Validation, &l.BackendTTFB}
+}
+
+// Total returns the sum of the phases.
+func (l StartupLatency) Total() time.Duration {
+	var total time.Duration
+	for _, phase := range l.phases() {
+		total += *phase
+	}
+	return total
+}
+
+// Cold reports whether the request started a worker, as opposed to reusing a session worker.
+func (l StartupLatency) Cold() bool {
+	return l.FlagParse > 0 || l.TPMReceiverInit > 0
+}
+
+// LogValue logs the phases in fractional milliseconds.
+func (l StartupLatency) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, len(startupLatencyPhases)+1)
+	for i, phase := range l.phases() {
+		attrs = append(attrs, slog.Float64(startupLatencyPhases[i], durationMillis(*phase)))
+	}
+	attrs = append(attrs, slog.Float64("total_ms", durationMillis(l.Total())))
+	return slog.GroupValue(attrs...)
+}
+
+// ParseStartupLatency parses the StartupLatencyKey attribute of a startup latency record, also after
+// the record went through JSON. It returns false for other attributes.
+func ParseStartupLatency(a slog.Attr) (StartupLatency, bool) {
+	v := a.Value.Resolve()
+	if a.Key != StartupLatencyKey || v.Kind() != slog.KindGroup {
+		return StartupLatency{}, false
+	}
+
+	var l StartupLatency
+	phases := l.phases()
+	found := false
+	for _, attr := range v.Group() {
+		for i, key := range startupLatencyPhases {
+			if attr.Key != key {
+				continue
+			}
+			ms, ok := attrFloat64(attr.Value.Resolve())
+			if !ok || ms < 0 {
+				return StartupLatency{}, false
+			}
+			*phases[i] = time.Duration(ms * float64(time.Millisecond))
+			found = true
+		}
+	}
+	return l, found
+}
+
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func attrFloat64(v slog.Value) (float64, bool) {
+	switch v.Kind() { //nolint:exhaustive
+	case slog.KindFloat64:
+		return v.Float64(), true
+	case slog.KindInt64:
+		return float64(v.Int64()), true
+	case slog.KindUint64:
+		return float64(v.Uint64()), true
+	case slog.KindAny:
+		// records decoded from JSON carry their numbers as float64.
+		f, ok := v.Any().(float64)
+		return f, ok
+	default:
+		return 0, false
+	}
+}
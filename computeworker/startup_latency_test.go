@@ -0,0 +1,73 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartupLatency(t *testing.T) {
+	latency := StartupLatency{
+		FlagParse:       2 * time.Millisecond,
+		TPMReceiverInit: 40 * time.Millisecond,
+		Decapsulation:   15 * time.Millisecond,
+		Validation:      500 * time.Microsecond,
+		BackendTTFB:     120 * time.Millisecond,
+	}
+	require.Equal(t, 177500*time.Microsecond, latency.Total())
+	require.True(t, latency.Cold())
+	require.False(t, StartupLatency{Decapsulation: time.Millisecond}.Cold())
+
+	t.Run("ok, round trip through a json record", func(t *testing.T) {
+		var buf bytes.Buffer
+		slog.New(slog.NewJSONHandler(&buf, nil)).Info(StartupLatencyMessage, StartupLatencyKey, latency)
+
+		var fields map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &fields))
+		require.Equal(t, 177.5, fields[StartupLatencyKey].(map[string]any)["total_ms"])
+
+		attrs := []slog.Attr{}
+		for k, v := range fields[StartupLatencyKey].(map[string]any) {
+			attrs = append(attrs, slog.Any(k, v))
+		}
+		got, ok := ParseStartupLatency(slog.Attr{Key: StartupLatencyKey, Value: slog.GroupValue(attrs...)})
+		require.True(t, ok)
+		require.Equal(t, latency, got)
+	})
+
+	t.Run("ok, round trip through a log value", func(t *testing.T) {
+		got, ok := ParseStartupLatency(slog.Any(StartupLatencyKey, latency))
+		require.True(t, ok)
+		require.Equal(t, latency, got)
+	})
+
+	t.Run("fail, other attribute", func(t *testing.T) {
+		_, ok := ParseStartupLatency(slog.Any("latency", latency))
+		require.False(t, ok)
+		_, ok = ParseStartupLatency(slog.String(StartupLatencyKey, "fast"))
+		require.False(t, ok)
+		_, ok = ParseStartupLatency(slog.Group(StartupLatencyKey, slog.Float64("validation_ms", -1)))
+		require.False(t, ok)
+	})
+}
@@ -0,0 +1,88 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testkit
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/openpcc/openpcc/auth/credentialing"
+	"github.com/stretchr/testify/require"
+)
+
+// BadgeIssuer signs badges, standing in for the auth server.
+type BadgeIssuer struct {
+	privateKey ed25519.PrivateKey
+}
+
+// NewBadgeIssuer creates a badge issuer with a fresh signing key.
+func NewBadgeIssuer(t *testing.T) *BadgeIssuer {
+	t.Helper()
+
+	_, sk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return &BadgeIssuer{privateKey: sk}
+}
+
+// PublicKey returns the key that verifies the badges of the issuer.
+func (b *BadgeIssuer) PublicKey() ed25519.PublicKey {
+	return b.privateKey.Public().(ed25519.PublicKey)
+}
+
+// EncodedPublicKey returns the public key in the base64 encoded PEM format used by the
+// badge_public_key configs and flags.
+func (b *BadgeIssuer) EncodedPublicKey(t *testing.T) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(b.PublicKey())
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// Badge returns a serialized badge that grants access to models.
+func (b *BadgeIssuer) Badge(t *testing.T, models ...string) string {
+	t.Helper()
+
+	badge := credentialing.Badge{
+		Credentials: credentialing.Credentials{Models: models},
+	}
+	credBytes, err := badge.Credentials.MarshalBinary()
+	require.NoError(t, err)
+	badge.Signature = ed25519.Sign(b.privateKey, credBytes)
+
+	serialized, err := badge.Serialize()
+	require.NoError(t, err)
+	return serialized
+}
+
+// NewJSONRequest creates a client request with a JSON body and the given badge.
+func NewJSONRequest(t *testing.T, url string, body string, badge string) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Confsec-Badge", badge)
+	return req
+}
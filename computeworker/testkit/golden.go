@@ -0,0 +1,76 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testkit
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// UpdateGoldenEnv makes RequireGolden write golden files instead of comparing against them.
+const UpdateGoldenEnv = "TESTKIT_UPDATE_GOLDEN"
+
+// Golden is the part of a worker response that is stable between runs, refund amounts and
+// dates are not.
+type Golden struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+	HasRefund  bool        `json:"has_refund"`
+}
+
+// Golden reads the response and returns its golden data. The response body is consumed.
+func (o *Output) Golden(t *testing.T) []byte {
+	t.Helper()
+
+	body, err := io.ReadAll(o.Response.Body)
+	require.NoError(t, err)
+	require.NoError(t, o.Response.Body.Close())
+
+	header := o.Response.Header.Clone()
+	header.Del("Date")
+
+	b, err := json.MarshalIndent(Golden{
+		StatusCode: o.Response.StatusCode,
+		Header:     header,
+		Body:       string(body),
+		HasRefund:  o.Footer != nil && o.Footer.HasRefund(),
+	}, "", "  ")
+	require.NoError(t, err)
+	return append(b, '\n')
+}
+
+// RequireGolden compares got with the golden file. Set UpdateGoldenEnv to (re)generate the file.
+func RequireGolden(t *testing.T, file string, got []byte) {
+	t.Helper()
+
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		require.NoError(t, os.WriteFile(file, got, 0o600))
+		return
+	}
+
+	// #nosec G304 -- golden files are provided by the test.
+	want, err := os.ReadFile(file)
+	require.NoError(t, err, "missing golden file, set %s=1 to generate it", UpdateGoldenEnv)
+	require.Equal(t, string(want), string(got))
+}
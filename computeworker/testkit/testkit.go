@@ -0,0 +1,159 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testkit provides helpers to write end-to-end tests against compute_worker. It covers
+// what router_com and clients do around a worker: signing badges, encapsulating requests for a
+// compute node and decoding and decrypting the worker output.
+//
+// The key of a test node is held in memory instead of in a TPM, so workers are run in-process
+// with RunWorker or computeworker.NewWithDependencies.
+package testkit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker"
+	"github.com/confidentsecurity/confidentcompute/computeworker/output"
+	test "github.com/openpcc/openpcc/inttest"
+	"github.com/openpcc/openpcc/messages"
+	"github.com/openpcc/twoway"
+	"github.com/stretchr/testify/require"
+)
+
+// Node is a compute node with an in-memory request encryption key.
+type Node struct {
+	// Receiver decapsulates requests encapsulated for this node.
+	Receiver    *twoway.MultiRequestReceiver
+	encapsulate func(req *http.Request) (*Request, error)
+}
+
+// NewNode creates a compute node with a fresh request encryption key.
+func NewNode(t *testing.T) *Node {
+	t.Helper()
+
+	receiver, computeData := test.NewComputeNodeReceiver(t)
+	sender := test.NewClientSender(t, computeData)
+	pubKey, err := computeData.UnmarshalPublicKey()
+	require.NoError(t, err)
+
+	return &Node{
+		Receiver: receiver,
+		encapsulate: func(req *http.Request) (*Request, error) {
+			ct, mediaType, err := messages.EncapsulateRequest(sender, req)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encapsulate request: %w", err)
+			}
+
+			encapKey, openerFunc, err := ct.EncapsulateKey(0, pubKey)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encapsulate key: %w", err)
+			}
+
+			return &Request{
+				Ciphertext:      ct,
+				MediaType:       mediaType,
+				EncapsulatedKey: encapKey,
+				decapsulate: func(ctx context.Context, mediaType string, r io.Reader) (*http.Response, error) {
+					return messages.DecapsulateResponse(ctx, openerFunc, mediaType, r)
+				},
+			}, nil
+		},
+	}
+}
+
+// EncapsulateRequest encrypts req for the node, like a client does.
+func (n *Node) EncapsulateRequest(t *testing.T, req *http.Request) *Request {
+	t.Helper()
+
+	r, err := n.encapsulate(req)
+	require.NoError(t, err)
+	return r
+}
+
+// Request is an encapsulated client request, as router_com hands it to compute_worker.
+type Request struct {
+	// Ciphertext is the encrypted request, compute_worker reads it from stdin.
+	Ciphertext io.Reader
+	// MediaType is the media type claimed by the client.
+	MediaType string
+	// EncapsulatedKey decrypts the request.
+	EncapsulatedKey []byte
+	decapsulate     func(ctx context.Context, mediaType string, r io.Reader) (*http.Response, error)
+}
+
+// Params returns the request parameters compute_worker needs to handle the request.
+func (r *Request) Params(creditAmount int64) computeworker.RequestParams {
+	return computeworker.RequestParams{
+		MediaType:       r.MediaType,
+		EncapsulatedKey: r.EncapsulatedKey,
+		CreditAmount:    creditAmount,
+	}
+}
+
+// Output is the decoded and decrypted output of a worker.
+type Output struct {
+	Header   output.Header
+	Response *http.Response
+	// Footer is nil when the worker did not write a footer.
+	Footer *output.Footer
+}
+
+// DecodeOutput decodes the output of a worker like router_com does and decrypts the response like
+// the client does. The chunk order is checked, the tags are left to clients that export the MAC key.
+func (r *Request) DecodeOutput(t *testing.T, out io.Reader) *Output {
+	t.Helper()
+
+	dec, err := output.NewForwardingDecoder(out)
+	require.NoError(t, err)
+
+	content := &bytes.Buffer{}
+	_, err = dec.WriteTo(content)
+	require.NoError(t, err)
+
+	resp, err := r.decapsulate(t.Context(), dec.Header().MediaType, content)
+	require.NoError(t, err)
+
+	o := &Output{
+		Header:   dec.Header(),
+		Response: resp,
+	}
+	if footer, ok := dec.Footer(); ok {
+		o.Footer = &footer
+	}
+	return o
+}
+
+// RunWorker runs an in-process worker for req on node and returns its decoded output. The
+// request params in cfg are replaced with the params of req, except for the credit amount.
+func RunWorker(t *testing.T, cfg *computeworker.Config, node *Node, req *Request) (*Output, error) {
+	t.Helper()
+
+	cfg.RequestParams = req.Params(cfg.RequestParams.CreditAmount)
+
+	buf := &bytes.Buffer{}
+	worker := computeworker.NewWithDependencies(t.Context(), cfg, http.DefaultClient, node.Receiver, req.Ciphertext, buf, nil)
+	if err := worker.Run(); err != nil {
+		return nil, err
+	}
+
+	return req.DecodeOutput(t, buf), nil
+}
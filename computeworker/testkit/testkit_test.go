@@ -0,0 +1,81 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testkit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker"
+	"github.com/confidentsecurity/confidentcompute/computeworker/testkit"
+	"github.com/stretchr/testify/require"
+)
+
+const llmResponse = `{"id":"chatcmpl-1","object":"chat.completion","created":1716194078,"model":"llama3.2:1b","choices":[{"index":0,"message":{"role":"assistant","content":"Pong"},"finish_reason":"stop"}],"usage":{"prompt_tokens":29,"completion_tokens":5,"total_tokens":34}}`
+
+func TestRunWorker(t *testing.T) {
+	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(llmResponse))
+	}))
+	t.Cleanup(llm.Close)
+
+	issuer := testkit.NewBadgeIssuer(t)
+	node := testkit.NewNode(t)
+
+	newConfig := func() *computeworker.Config {
+		return &computeworker.Config{
+			LLMBaseURL: llm.URL,
+			Timeout:    time.Second,
+			RequestParams: computeworker.RequestParams{
+				CreditAmount: 200,
+			},
+			BadgePublicKey: issuer.PublicKey(),
+			Models:         []string{"llama3.2:1b"},
+		}
+	}
+
+	t.Run("ok, response matches golden data", func(t *testing.T) {
+		req := testkit.NewJSONRequest(t, "https://confsec.invalid/v1/chat/completions",
+			`{"model":"llama3.2:1b","messages":[{"role":"user","content":"Ping"}],"stream":false}`,
+			issuer.Badge(t, "llama3.2:1b"))
+
+		out, err := testkit.RunWorker(t, newConfig(), node, node.EncapsulateRequest(t, req))
+		require.NoError(t, err)
+		require.NotNil(t, out.Footer)
+		testkit.RequireGolden(t, "testdata/chat-completions.golden.json", out.Golden(t))
+	})
+
+	t.Run("ok, badge from another issuer is rejected", func(t *testing.T) {
+		req := testkit.NewJSONRequest(t, "https://confsec.invalid/v1/chat/completions",
+			`{"model":"llama3.2:1b","messages":[{"role":"user","content":"Ping"}],"stream":false}`,
+			testkit.NewBadgeIssuer(t).Badge(t, "llama3.2:1b"))
+
+		out, err := testkit.RunWorker(t, newConfig(), node, node.EncapsulateRequest(t, req))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadRequest, out.Response.StatusCode)
+		require.NoError(t, out.Response.Body.Close())
+	})
+
+	t.Run("ok, encoded public key is accepted by the worker", func(t *testing.T) {
+		key, err := computeworker.DecodeBadgeKey(issuer.EncodedPublicKey(t))
+		require.NoError(t, err)
+		require.Equal(t, issuer.PublicKey(), key)
+	})
+}
@@ -0,0 +1,139 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// maxTools is the maximum number of tools and functions of a chat request, like the OpenAI API.
+	maxTools = 128
+	// maxToolSchemaSize is the maximum size in bytes of the parameters schema of a single tool.
+	maxToolSchemaSize = 16 * 1024
+	// maxToolSchemaDepth is the maximum nesting of objects and arrays in a parameters schema.
+	maxToolSchemaDepth = 32
+)
+
+// toolNamePattern is the function name pattern of the OpenAI API.
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// validateTools validates the tools and deprecated functions of a chat request. The parameter
+// schemas are parsed by the backend for every request, so the number and size of schemas are
+// bounded. Schemas may only reference their own definitions, a $ref to another document could
+// make the backend or a client library fetch it.
+func validateTools(tools []any, functions []any) error {
+	if len(tools)+len(functions) > maxTools {
+		return newValidationError(ErrInvalidTools, fmt.Sprintf("tools exceed max number of %d", maxTools))
+	}
+
+	for i, tool := range tools {
+		obj, ok := tool.(map[string]any)
+		if !ok {
+			return newValidationError(ErrInvalidTools, fmt.Sprintf("tool %d must be an object", i))
+		}
+		if typ, ok := obj["type"].(string); !ok || typ != "function" {
+			return newValidationError(ErrInvalidTools, fmt.Sprintf(`tool %d must be of type "function"`, i))
+		}
+		function, ok := obj["function"].(map[string]any)
+		if !ok {
+			return newValidationError(ErrInvalidTools, fmt.Sprintf("tool %d must have a function object", i))
+		}
+		if err := validateToolFunction(i, function); err != nil {
+			return err
+		}
+	}
+
+	for i, function := range functions {
+		obj, ok := function.(map[string]any)
+		if !ok {
+			return newValidationError(ErrInvalidTools, fmt.Sprintf("function %d must be an object", i))
+		}
+		if err := validateToolFunction(len(tools)+i, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateOllamaTools validates the tools of an Ollama chat request, they have the OpenAI format.
+func validateOllamaTools(tools []map[string]any) error {
+	anyTools := make([]any, 0, len(tools))
+	for _, tool := range tools {
+		anyTools = append(anyTools, tool)
+	}
+	return validateTools(anyTools, nil)
+}
+
+func validateToolFunction(i int, function map[string]any) error {
+	name, ok := function["name"].(string)
+	if !ok || !toolNamePattern.MatchString(name) {
+		return newValidationError(ErrInvalidTools, fmt.Sprintf("tool %d must have a name of at most 64 letters, digits, underscores or dashes", i))
+	}
+
+	parameters, ok := function["parameters"]
+	if !ok || parameters == nil {
+		return nil
+	}
+	if _, ok := parameters.(map[string]any); !ok {
+		return newValidationError(ErrInvalidTools, fmt.Sprintf("parameters of tool %d must be a JSON schema object", i))
+	}
+
+	// the parameters were decoded from the request body, so they can always be encoded again.
+	schema, err := json.Marshal(parameters)
+	if err != nil {
+		return newValidationError(ErrInvalidTools, fmt.Sprintf("invalid parameters of tool %d: %v", i, err))
+	}
+	if len(schema) > maxToolSchemaSize {
+		return newValidationError(ErrInvalidTools, fmt.Sprintf("parameters of tool %d exceed max size of %d bytes", i, maxToolSchemaSize))
+	}
+
+	return validateToolSchema(i, parameters, 0)
+}
+
+// validateToolSchema walks the schema, checking its depth and that every $ref is local.
+func validateToolSchema(i int, v any, depth int) error {
+	if depth > maxToolSchemaDepth {
+		return newValidationError(ErrInvalidTools, fmt.Sprintf("parameters of tool %d exceed max depth of %d", i, maxToolSchemaDepth))
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if key == "$ref" || key == "$dynamicRef" {
+				ref, ok := value.(string)
+				if !ok || !strings.HasPrefix(ref, "#") {
+					return newValidationError(ErrInvalidTools, fmt.Sprintf("parameters of tool %d may only reference their own definitions", i))
+				}
+			}
+			if err := validateToolSchema(i, value, depth+1); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, value := range v {
+			if err := validateToolSchema(i, value, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
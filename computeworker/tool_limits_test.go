@@ -0,0 +1,98 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTools(t *testing.T) {
+	tool := func(name, parameters string) string {
+		return fmt.Sprintf(`{"type":"function","function":{"name":%q,"parameters":%s}}`, name, parameters)
+	}
+	manyTools := func(n int) string {
+		tools := make([]string, 0, n)
+		for i := range n {
+			tools = append(tools, tool(fmt.Sprintf("tool_%d", i), "{}"))
+		}
+		return "[" + strings.Join(tools, ",") + "]"
+	}
+
+	tests := []struct {
+		name      string
+		tools     string
+		functions string
+		wantErr   bool
+	}{
+		{name: "ok, no tools", tools: `[]`},
+		{name: "ok, tool", tools: `[` + tool("get_weather", `{"type":"object","properties":{"city":{"type":"string"}}}`) + `]`},
+		{name: "ok, tool without parameters", tools: `[{"type":"function","function":{"name":"now"}}]`},
+		{name: "ok, local ref", tools: `[` + tool("f", `{"$defs":{"city":{"type":"string"}},"properties":{"city":{"$ref":"#/$defs/city"}}}`) + `]`},
+		{name: "ok, deprecated function", functions: `[{"name":"get-weather","parameters":{"type":"object"}}]`},
+		{name: "ok, max tools", tools: manyTools(maxTools)},
+		{name: "fail, too many tools", tools: manyTools(maxTools + 1), wantErr: true},
+		{name: "fail, too many tools and functions", tools: manyTools(maxTools), functions: `[{"name":"f"}]`, wantErr: true},
+		{name: "fail, tool is not an object", tools: `["get_weather"]`, wantErr: true},
+		{name: "fail, unknown tool type", tools: `[{"type":"retrieval","function":{"name":"f"}}]`, wantErr: true},
+		{name: "fail, missing function", tools: `[{"type":"function"}]`, wantErr: true},
+		{name: "fail, missing name", tools: `[{"type":"function","function":{}}]`, wantErr: true},
+		{name: "fail, invalid name", tools: `[` + tool("get weather", `{}`) + `]`, wantErr: true},
+		{name: "fail, name too long", tools: `[` + tool(strings.Repeat("a", 65), `{}`) + `]`, wantErr: true},
+		{name: "fail, parameters not an object", tools: `[` + tool("f", `"string"`) + `]`, wantErr: true},
+		{name: "fail, schema too large", tools: `[` + tool("f", `{"description":"`+strings.Repeat("a", maxToolSchemaSize)+`"}`) + `]`, wantErr: true},
+		{name: "fail, schema too deep", tools: `[` + tool("f", strings.Repeat(`{"a":`, maxToolSchemaDepth+1)+`{}`+strings.Repeat(`}`, maxToolSchemaDepth+1)) + `]`, wantErr: true},
+		{name: "fail, external ref", tools: `[` + tool("f", `{"properties":{"city":{"$ref":"http://169.254.169.254/latest/meta-data"}}}`) + `]`, wantErr: true},
+		{name: "fail, relative ref", tools: `[` + tool("f", `{"items":[{"$ref":"other.json#/city"}]}`) + `]`, wantErr: true},
+		{name: "fail, external dynamic ref", tools: `[` + tool("f", `{"$dynamicRef":"https://example.com/schema"}`) + `]`, wantErr: true},
+		{name: "fail, ref in deprecated function", functions: `[{"name":"f","parameters":{"$ref":"https://example.com/schema"}}]`, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var tools, functions []any
+			if tc.tools != "" {
+				require.NoError(t, json.Unmarshal([]byte(tc.tools), &tools))
+			}
+			if tc.functions != "" {
+				require.NoError(t, json.Unmarshal([]byte(tc.functions), &functions))
+			}
+
+			err := validateTools(tools, functions)
+			if !tc.wantErr {
+				require.NoError(t, err)
+				return
+			}
+
+			var validationErr ValidationError
+			require.True(t, errors.As(err, &validationErr))
+			require.Equal(t, ErrInvalidTools, validationErr.Code)
+		})
+	}
+}
+
+func TestValidateOllamaTools(t *testing.T) {
+	var tools []map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`[{"type":"function","function":{"name":"f","parameters":{"$ref":"file:///etc/passwd"}}}]`), &tools))
+	require.Error(t, validateOllamaTools(tools))
+}
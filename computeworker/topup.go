@@ -0,0 +1,240 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/nonceledger"
+)
+
+// ErrCreditCeiling ends a response that reached the output tokens its credits pay for, including
+// the top-ups granted so far. Like a backend failure mid-stream, the response is completed with an
+// aborted footer that refunds the unused credits.
+var ErrCreditCeiling = errors.New("output reached the credit ceiling")
+
+// maxCreditGrantSize bounds a single line on the credit grant pipe.
+const maxCreditGrantSize = 4096
+
+// CreditGrant grants additional credits to a running request, so a long generation doesn't stop at
+// the credit amount it started with. Grants are signed with the badge key by the auth server, so
+// router_com can pass them on but not mint them. A grant is bound to the encapsulated key of the
+// request, which the client picks, and is single use across the workers of a node: the worker claims
+// it with the nonce ledger of router_com before it applies it.
+type CreditGrant struct {
+	// EncapsulatedKey is the encapsulated key of the request the grant is for.
+	EncapsulatedKey []byte `json:"encapsulated_key"`
+	// Sequence orders the grants of a request, a grant is only applied once.
+	Sequence uint32 `json:"sequence"`
+	// CreditAmount is the amount of credits granted in addition to earlier grants.
+	CreditAmount int64 `json:"credit_amount"`
+	// Expiry is the unix time in seconds after which the grant is no longer accepted, at most
+	// nonceledger.MaxTTL after it is applied.
+	Expiry int64 `json:"expiry"`
+	// Signature is the ed25519 signature of SignedMessage.
+	Signature []byte `json:"signature"`
+}
+
+// SignedMessage returns the message the grant signature covers.
+func (g *CreditGrant) SignedMessage() []byte {
+	var b bytes.Buffer
+	b.WriteString("confsec credit grant v2\n")
+	b.WriteString(base64.StdEncoding.EncodeToString(g.EncapsulatedKey))
+	b.WriteByte('\n')
+	b.WriteString(strconv.FormatUint(uint64(g.Sequence), 10))
+	b.WriteByte('\n')
+	b.WriteString(strconv.FormatInt(g.CreditAmount, 10))
+	b.WriteByte('\n')
+	b.WriteString(strconv.FormatInt(g.Expiry, 10))
+	return b.Bytes()
+}
+
+// nonce returns the nonce a grant is claimed with, the digest of its signed message.
+func (g *CreditGrant) nonce() []byte {
+	sum := sha256.Sum256(g.SignedMessage())
+	return sum[:]
+}
+
+// creditLedger tracks the credits of a request, the amount it started with and the grants since.
+type creditLedger struct {
+	mu sync.Mutex
+	// base is the credit amount the request started with.
+	base int64
+	// maxTopUp bounds the sum of the grants.
+	maxTopUp int64
+	// nonceSocket is the nonce ledger grants are claimed with.
+	nonceSocket string
+	granted     int64
+	sequence    uint32
+}
+
+func newCreditLedger(base, maxTopUp int64, nonceSocket string) *creditLedger {
+	return &creditLedger{
+		base:        base,
+		maxTopUp:    maxTopUp,
+		nonceSocket: nonceSocket,
+	}
+}
+
+// grant verifies and applies a grant for the request with encapsulatedKey.
+func (l *creditLedger) grant(ctx context.Context, key ed25519.PublicKey, encapsulatedKey []byte, g CreditGrant, now time.Time) error {
+	if len(encapsulatedKey) == 0 || !bytes.Equal(g.EncapsulatedKey, encapsulatedKey) {
+		return errors.New("credit grant is for another request")
+	}
+	if !ed25519.Verify(key, g.SignedMessage(), g.Signature) {
+		return errors.New("invalid credit grant signature")
+	}
+	if g.CreditAmount <= 0 {
+		return fmt.Errorf("invalid credit grant amount: %d", g.CreditAmount)
+	}
+	expiry := time.Unix(g.Expiry, 0)
+	if !now.Before(expiry) {
+		return errors.New("credit grant expired")
+	}
+	if expiry.After(now.Add(nonceledger.MaxTTL)) {
+		return fmt.Errorf("credit grant expiry is more than %s away", nonceledger.MaxTTL)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if g.Sequence <= l.sequence {
+		return fmt.Errorf("credit grant %d was already applied", g.Sequence)
+	}
+	if l.granted+g.CreditAmount > l.maxTopUp {
+		return fmt.Errorf("credit grant exceeds the max top-up of %d credits", l.maxTopUp)
+	}
+	// the ledger rejects grants another worker of the node applied.
+	if err := nonceledger.Claim(ctx, l.nonceSocket, g.nonce(), expiry); err != nil {
+		return fmt.Errorf("failed to claim credit grant: %w", err)
+	}
+	l.sequence = g.Sequence
+	l.granted += g.CreditAmount
+	return nil
+}
+
+// total returns the credit amount of the request including the grants.
+func (l *creditLedger) total() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.base + l.granted
+}
+
+// receiveCreditGrants applies the JSON lines grants on r until it is closed or ctx is done. Invalid
+// grants are logged and skipped, they never fail the request.
+func receiveCreditGrants(ctx context.Context, r io.Reader, ledger *creditLedger, key ed25519.PublicKey, encapsulatedKey []byte) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, maxCreditGrantSize), maxCreditGrantSize)
+	for scanner.Scan() && ctx.Err() == nil {
+		var g CreditGrant
+		if err := json.Unmarshal(scanner.Bytes(), &g); err != nil {
+			slog.WarnContext(ctx, "Ignoring malformed credit grant", "error", err)
+			continue
+		}
+		if err := ledger.grant(ctx, key, encapsulatedKey, g, time.Now()); err != nil {
+			slog.WarnContext(ctx, "Ignoring credit grant", "error", err, "sequence", g.Sequence)
+			continue
+		}
+		slog.InfoContext(ctx, "Credit grant applied", "sequence", g.Sequence, "credit_amount", g.CreditAmount)
+	}
+	if err := scanner.Err(); err != nil {
+		slog.WarnContext(ctx, "Stopped receiving credit grants", "error", err)
+	}
+}
+
+// creditCeilingBody ends a streaming response once its output tokens reach what the credits of the
+// ledger pay for. The backend is allowed to generate up to the max top-up, a grant that arrives
+// before the ceiling is reached lets the response continue.
+type creditCeilingBody struct {
+	r      *bufio.Reader
+	c      io.Closer
+	ledger *creditLedger
+	openAI bool
+	tokens int
+	line   []byte
+	err    error
+}
+
+func newCreditCeilingBody(path string, rc io.ReadCloser, ledger *creditLedger) *creditCeilingBody {
+	return &creditCeilingBody{
+		r:      bufio.NewReader(rc),
+		c:      rc,
+		ledger: ledger,
+		openAI: path == OpenAIChatPath || path == OpenAICompletionsPath,
+	}
+}
+
+func (b *creditCeilingBody) Read(p []byte) (int, error) {
+	for len(b.line) == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+
+		line, err := b.r.ReadBytes('\n')
+		if err != nil {
+			b.err = err
+		}
+		if len(line) == 0 {
+			continue
+		}
+
+		tokens := b.lineTokens(line)
+		if tokens > 0 && b.tokens+tokens > MaxOutputTokens(b.ledger.total()) {
+			b.err = ErrCreditCeiling
+			return 0, b.err
+		}
+		b.tokens += tokens
+		b.line = line
+	}
+
+	n := copy(p, b.line)
+	b.line = b.line[n:]
+	return n, nil
+}
+
+// lineTokens counts the output tokens of a line like the refund recorders do.
+func (b *creditCeilingBody) lineTokens(line []byte) int {
+	if !b.openAI {
+		if ollamaLineOutput(line) != "" {
+			return 1
+		}
+		return 0
+	}
+	chunk := bytes.TrimPrefix(bytes.TrimSpace(line), []byte("data: "))
+	if !bytes.HasPrefix(chunk, []byte("{")) {
+		return 0
+	}
+	tokens, _ := openAIChunkOutput(chunk)
+	return tokens
+}
+
+func (b *creditCeilingBody) Close() error {
+	return b.c.Close()
+}
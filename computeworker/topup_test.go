@@ -0,0 +1,194 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/nonceledger"
+	"github.com/openpcc/openpcc/models"
+	"github.com/stretchr/testify/require"
+)
+
+var testEncapsulatedKey = []byte("encapsulated-key")
+
+func signCreditGrant(sk ed25519.PrivateKey, g CreditGrant) CreditGrant {
+	if g.EncapsulatedKey == nil {
+		g.EncapsulatedKey = testEncapsulatedKey
+	}
+	if g.Expiry == 0 {
+		g.Expiry = time.Now().Add(time.Minute).Unix()
+	}
+	g.Signature = ed25519.Sign(sk, g.SignedMessage())
+	return g
+}
+
+// startNonceLedger starts a nonce ledger for the test and returns its socket.
+func startNonceLedger(t *testing.T) string {
+	socket := filepath.Join(t.TempDir(), "nonce_ledger.sock")
+	ledger := nonceledger.New(&nonceledger.Config{Socket: socket})
+	require.NoError(t, ledger.Start())
+	t.Cleanup(func() {
+		require.NoError(t, ledger.Close())
+	})
+	return socket
+}
+
+func TestCreditLedger(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherSK, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	nonceSocket := startNonceLedger(t)
+
+	t.Run("ok, grants are added to the base", func(t *testing.T) {
+		ledger := newCreditLedger(100, 50, nonceSocket)
+		require.NoError(t, ledger.grant(t.Context(), pk, testEncapsulatedKey, signCreditGrant(sk, CreditGrant{Sequence: 1, CreditAmount: 20}), time.Now()))
+		require.NoError(t, ledger.grant(t.Context(), pk, testEncapsulatedKey, signCreditGrant(sk, CreditGrant{Sequence: 2, CreditAmount: 30}), time.Now()))
+		require.Equal(t, int64(150), ledger.total())
+	})
+
+	t.Run("fail, grant applied by another worker", func(t *testing.T) {
+		grant := signCreditGrant(sk, CreditGrant{EncapsulatedKey: []byte("other-worker"), Sequence: 1, CreditAmount: 20})
+		first := newCreditLedger(100, 50, nonceSocket)
+		require.NoError(t, first.grant(t.Context(), pk, grant.EncapsulatedKey, grant, time.Now()))
+
+		second := newCreditLedger(100, 50, nonceSocket)
+		err := second.grant(t.Context(), pk, grant.EncapsulatedKey, grant, time.Now())
+		require.ErrorIs(t, err, nonceledger.ErrReplayed)
+		require.Equal(t, int64(100), second.total())
+	})
+
+	tests := map[string]struct {
+		grant CreditGrant
+	}{
+		"fail, other request": {
+			grant: signCreditGrant(sk, CreditGrant{EncapsulatedKey: []byte("other-key"), Sequence: 2, CreditAmount: 10}),
+		},
+		"fail, signed with another key": {
+			grant: signCreditGrant(otherSK, CreditGrant{Sequence: 2, CreditAmount: 10}),
+		},
+		"fail, replayed sequence": {
+			grant: signCreditGrant(sk, CreditGrant{Sequence: 1, CreditAmount: 10}),
+		},
+		"fail, exceeds max top-up": {
+			grant: signCreditGrant(sk, CreditGrant{Sequence: 2, CreditAmount: 41}),
+		},
+		"fail, non-positive amount": {
+			grant: signCreditGrant(sk, CreditGrant{Sequence: 2, CreditAmount: -10}),
+		},
+		"fail, expired": {
+			grant: signCreditGrant(sk, CreditGrant{Sequence: 2, CreditAmount: 10, Expiry: time.Now().Add(-time.Second).Unix()}),
+		},
+		"fail, expiry beyond the nonce ledger ttl": {
+			grant: signCreditGrant(sk, CreditGrant{Sequence: 2, CreditAmount: 10, Expiry: time.Now().Add(2 * nonceledger.MaxTTL).Unix()}),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// every case runs with a ledger of its own, as a request with its own encapsulated key.
+			nonceSocket := startNonceLedger(t)
+			ledger := newCreditLedger(100, 50, nonceSocket)
+			require.NoError(t, ledger.grant(t.Context(), pk, testEncapsulatedKey, signCreditGrant(sk, CreditGrant{Sequence: 1, CreditAmount: 10}), time.Now()))
+			require.Error(t, ledger.grant(t.Context(), pk, testEncapsulatedKey, tc.grant, time.Now()))
+			require.Equal(t, int64(110), ledger.total())
+		})
+	}
+}
+
+func TestReceiveCreditGrants(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	var lines []string
+	for _, g := range []CreditGrant{
+		signCreditGrant(sk, CreditGrant{Sequence: 1, CreditAmount: 10}),
+		{EncapsulatedKey: testEncapsulatedKey, Sequence: 2, CreditAmount: 1000},
+		signCreditGrant(sk, CreditGrant{Sequence: 3, CreditAmount: 5}),
+	} {
+		b, err := json.Marshal(g)
+		require.NoError(t, err)
+		lines = append(lines, string(b))
+	}
+	lines = append(lines, "not json")
+
+	ledger := newCreditLedger(100, 50, startNonceLedger(t))
+	receiveCreditGrants(t.Context(), strings.NewReader(strings.Join(lines, "\n")), ledger, pk, testEncapsulatedKey)
+	require.Equal(t, int64(115), ledger.total())
+}
+
+func TestCreditCeilingBody(t *testing.T) {
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	// credits for 2 output tokens.
+	base := 2 * models.OutputTokenCreditMultiplier
+
+	ollamaBody := `{"response":"a"}` + "\n" + `{"response":"b"}` + "\n" + `{"response":"c"}` + "\n" + `{"done":true}` + "\n"
+	openAIBody := `data: {"choices":[{"delta":{"content":"a"}}]}` + "\n\n" +
+		`data: {"choices":[{"delta":{"content":"b"}}]}` + "\n\n" +
+		`data: {"choices":[{"delta":{"content":"c"}}]}` + "\n\n" +
+		"data: [DONE]\n\n"
+
+	tests := map[string]struct {
+		path string
+		body string
+		want string
+	}{
+		"ollama": {
+			path: "/api/generate",
+			body: ollamaBody,
+			want: `{"response":"a"}` + "\n" + `{"response":"b"}` + "\n",
+		},
+		"openai": {
+			path: OpenAIChatPath,
+			body: openAIBody,
+			want: `data: {"choices":[{"delta":{"content":"a"}}]}` + "\n\n" +
+				`data: {"choices":[{"delta":{"content":"b"}}]}` + "\n\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run("fail, "+name+" ends at the ceiling", func(t *testing.T) {
+			ledger := newCreditLedger(base, 10*models.OutputTokenCreditMultiplier, "")
+			body := newCreditCeilingBody(tc.path, io.NopCloser(strings.NewReader(tc.body)), ledger)
+			got, err := io.ReadAll(body)
+			require.ErrorIs(t, err, ErrCreditCeiling)
+			require.Equal(t, tc.want, string(got))
+		})
+
+		t.Run("ok, "+name+" continues after a grant", func(t *testing.T) {
+			ledger := newCreditLedger(base, 10*models.OutputTokenCreditMultiplier, startNonceLedger(t))
+			require.NoError(t, ledger.grant(t.Context(), pk, testEncapsulatedKey, signCreditGrant(sk, CreditGrant{
+				Sequence:     1,
+				CreditAmount: models.OutputTokenCreditMultiplier,
+			}), time.Now()))
+			body := newCreditCeilingBody(tc.path, io.NopCloser(strings.NewReader(tc.body)), ledger)
+			got, err := io.ReadAll(body)
+			require.NoError(t, err)
+			require.Equal(t, tc.body, string(got))
+		})
+	}
+}
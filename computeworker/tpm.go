@@ -23,10 +23,12 @@ import (
 	"fmt"
 	"log/slog"
 	"math"
-	"strings"
 
 	"github.com/cloudflare/circl/hpke"
 	"github.com/cloudflare/circl/kem"
+	"github.com/confidentsecurity/confidentcompute/faultinject"
+	"github.com/confidentsecurity/confidentcompute/tpmbroker"
+	"github.com/confidentsecurity/confidentcompute/tpmerr"
 	"github.com/google/go-tpm/tpm2"
 	"github.com/google/go-tpm/tpm2/transport"
 	"github.com/google/go-tpm/tpmutil"
@@ -53,17 +55,9 @@ func newTPMHPKEReceiver(ctx context.Context, config TPMConfig, info []byte) (*tp
 		return nil, otelutil.Errorf(span, "key handle value %d exceeds maximum value for TPM handle", config.KeyHandle)
 	}
 
-	goldenPCRValues := map[uint32][]byte{}
-	for _, pcr := range evidence.AttestPCRSelection {
-		if pcr > math.MaxUint32 {
-			return nil, fmt.Errorf("unexpected pcr value %d, does not fit in uint32", pcr)
-		}
-
-		val, ok := config.PCRValues[uint32(pcr)]
-		if !ok {
-			return nil, fmt.Errorf("config is missing pcr value %d", pcr)
-		}
-		goldenPCRValues[uint32(pcr)] = val
+	goldenPCRValues, err := goldenPCRValues(config)
+	if err != nil {
+		return nil, err
 	}
 
 	slog.Info("Creating TPM receiver with golden PCR values", "goldenPcrValues", goldenPCRValues)
@@ -74,38 +68,15 @@ func newTPMHPKEReceiver(ctx context.Context, config TPMConfig, info []byte) (*tp
 	// 2. Create a session.
 	// 3. Call the operation.
 	// 4. Cleanup.
+	//
+	// All of this happens while holding a lease from the TPM access broker, if configured, and
+	// within the TPM operation timeout.
 	ecdhZGenFunc := func(keyInfo *tpmhpke.ECDHZGenKeyInfo, pubPoint tpm2.TPM2BECCPoint) ([]byte, error) {
-		// 1. Open TPM connection.
-		tpm, err := openTPM(ctx, config)
-		if err != nil {
-			return nil, fmt.Errorf("failed to open tpm: %w", err)
-		}
-		defer func() {
-			_, span := otelutil.Tracer.Start(ctx, "computeworker.TPMHPKE.closeTPM")
-			defer span.End()
-			err = errors.Join(err, tpm.Close())
-		}()
-
-		// 2. Begin TPM session.
-		_, sessionSpan := otelutil.Tracer.Start(ctx, "computeworker.TPMHPKE.beginSession")
-		sess, cleanup, err := cstpm.PCRPolicySession(tpm, goldenPCRValues)
-		if err != nil {
-			sessionSpan.End()
-			return nil, fmt.Errorf("failed to create tpm session: %w", err)
-		}
-		sessionSpan.End()
-
-		defer func() {
-			_, span := otelutil.Tracer.Start(ctx, "computeworker.TPMHPKE.cleanupSession")
-			defer span.End()
-			err = errors.Join(err, cleanup())
-		}()
-
-		// 3. ECDHZgen
-		_, ecdhZGenSpan := otelutil.Tracer.Start(ctx, "computeworker.TPMHPKE.ecdhZGen")
-		b, err := tpmhpke.ECDHZGen(tpm, sess, keyInfo, pubPoint)
-		ecdhZGenSpan.End()
-		return b, err
+		_, leaseSpan := otelutil.Tracer.Start(ctx, "computeworker.TPMHPKE.ecdhZGenLease")
+		defer leaseSpan.End()
+		return tpmbroker.Do(ctx, config.BrokerSocket, config.OpTimeout, func() ([]byte, error) {
+			return ecdhZGen(ctx, config, goldenPCRValues, keyInfo, pubPoint)
+		})
 	}
 
 	span.SetStatus(codes.Ok, "")
@@ -123,9 +94,67 @@ func newTPMHPKEReceiver(ctx context.Context, config TPMConfig, info []byte) (*tp
 	), nil
 }
 
+// goldenPCRValues returns the values of the PCRs the REK and the refund key are bound to.
+func goldenPCRValues(config TPMConfig) (map[uint32][]byte, error) {
+	values := map[uint32][]byte{}
+	for _, pcr := range evidence.AttestPCRSelection {
+		if pcr > math.MaxUint32 {
+			return nil, fmt.Errorf("unexpected pcr value %d, does not fit in uint32", pcr)
+		}
+
+		val, ok := config.PCRValues[uint32(pcr)]
+		if !ok {
+			return nil, fmt.Errorf("config is missing pcr value %d", pcr)
+		}
+		values[uint32(pcr)] = val
+	}
+	return values, nil
+}
+
+// ecdhZGen runs a single ECDHZGen operation on a freshly opened TPM.
+func ecdhZGen(ctx context.Context, config TPMConfig, goldenPCRValues map[uint32][]byte, keyInfo *tpmhpke.ECDHZGenKeyInfo, pubPoint tpm2.TPM2BECCPoint) (b []byte, err error) {
+	// 1. Open TPM connection.
+	tpm, err := openTPM(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tpm: %w", err)
+	}
+	defer func() {
+		_, span := otelutil.Tracer.Start(ctx, "computeworker.TPMHPKE.closeTPM")
+		defer span.End()
+		err = errors.Join(err, tpm.Close())
+	}()
+
+	// 2. Begin TPM session.
+	_, sessionSpan := otelutil.Tracer.Start(ctx, "computeworker.TPMHPKE.beginSession")
+	sess, cleanup, err := cstpm.PCRPolicySession(tpm, goldenPCRValues)
+	if err != nil {
+		sessionSpan.End()
+		return nil, fmt.Errorf("failed to create tpm session: %w", tpmerr.Wrap(err))
+	}
+	sessionSpan.End()
+
+	defer func() {
+		_, span := otelutil.Tracer.Start(ctx, "computeworker.TPMHPKE.cleanupSession")
+		defer span.End()
+		err = errors.Join(err, cleanup())
+	}()
+
+	// 3. ECDHZgen
+	_, ecdhZGenSpan := otelutil.Tracer.Start(ctx, "computeworker.TPMHPKE.ecdhZGen")
+	b, err = tpmhpke.ECDHZGen(tpm, sess, keyInfo, pubPoint)
+	ecdhZGenSpan.End()
+	if err != nil {
+		return nil, tpmerr.Wrap(err)
+	}
+	return b, nil
+}
+
 func openTPM(ctx context.Context, config TPMConfig) (transport.TPMCloser, error) {
 	ctx, span := otelutil.Tracer.Start(ctx, "computeworker.TPMHPKE.openTPM")
 	defer span.End()
+	if err := faultinject.Inject(ctx, faultinject.TPMOpen); err != nil {
+		return nil, otelutil.Errorf(span, "open tpm device: %w", err)
+	}
 	if config.Simulate {
 		tpmDevice, err := mssim.Open(mssim.Config{
 			CommandAddress:  config.SimulatorCmdAddress,
@@ -136,13 +165,13 @@ func openTPM(ctx context.Context, config TPMConfig) (transport.TPMCloser, error)
 		}
 
 		slog.InfoContext(ctx, "Using simulated TPM")
-		tpm := transport.FromReadWriteCloser(tpmDevice)
+		tpm := tpmerr.NewRetryingTPM(transport.FromReadWriteCloser(tpmDevice), tpmerr.DefaultPolicy)
 
 		slog.InfoContext(ctx, "executing startup command TPM simulator")
 		if _, err := (tpm2.Startup{StartupType: tpm2.TPMSUClear}.Execute(tpm)); err != nil {
 			// This initialization error can occur under heavy load and indicates
 			// that the TPM is already initialized so we can ignore it and use the TPM.
-			if !strings.Contains(err.Error(), "TPM_RC_INITIALIZE") {
+			if !errors.Is(err, tpm2.TPMRCInitialize) {
 				return nil, otelutil.Errorf(span, "tpm startup: %w", err)
 			}
 			slog.Warn("tpm startup error", "err", err)
@@ -157,7 +186,7 @@ func openTPM(ctx context.Context, config TPMConfig) (transport.TPMCloser, error)
 		return nil, fmt.Errorf("failed to open tpm: %w", err)
 	}
 	slog.InfoContext(ctx, "Using real TPM", "err", err)
-	return transport.FromReadWriteCloser(rwc), nil
+	return tpmerr.NewRetryingTPM(transport.FromReadWriteCloser(rwc), tpmerr.DefaultPolicy), nil
 }
 
 // tpmSuiteAdapter implements twoway.HPKESuite so we can inject our TPM based HPKE receiver
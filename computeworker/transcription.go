@@ -0,0 +1,189 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"slices"
+	"strconv"
+)
+
+// transcriptionResponseFormats are the allowed response formats of a transcription. Only JSON
+// responses report the usage needed for a refund.
+var transcriptionResponseFormats = []string{"json", "verbose_json"}
+
+// formPath reports whether requests on p have a multipart/form-data body.
+func formPath(p string) bool {
+	return p == OpenAITranscriptionsPath
+}
+
+// audioFormat is an audio container recognized by sniffAudio.
+type audioFormat struct {
+	MediaType string
+	Extension string
+}
+
+// sniffAudio detects the audio container from the magic bytes of data. The media type claimed by
+// the client is never trusted.
+func sniffAudio(data []byte) (audioFormat, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		return audioFormat{MediaType: "audio/flac", Extension: ".flac"}, true
+	case bytes.HasPrefix(data, []byte("ID3")), len(data) >= 2 && data[0] == 0xFF && data[1]&0xE0 == 0xE0:
+		return audioFormat{MediaType: "audio/mpeg", Extension: ".mp3"}, true
+	case len(data) >= 12 && string(data[4:8]) == "ftyp":
+		return audioFormat{MediaType: "audio/mp4", Extension: ".m4a"}, true
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return audioFormat{MediaType: "audio/ogg", Extension: ".ogg"}, true
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return audioFormat{MediaType: "audio/wav", Extension: ".wav"}, true
+	case bytes.HasPrefix(data, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return audioFormat{MediaType: "audio/webm", Extension: ".webm"}, true
+	default:
+		return audioFormat{}, false
+	}
+}
+
+// https://platform.openai.com/docs/api-reference/audio/createTranscription
+type OpenAIRequestBodyTranscription struct {
+	Model          string
+	File           []byte
+	Language       string
+	Prompt         string
+	ResponseFormat string
+	// Temperature is kept as sent, it's only checked to be a number in [0, 1].
+	Temperature string
+	// Not included but present in the OpenAI spec:
+	// * stream, responses would not report a usage.
+	// * timestamp_granularities[], chunking_strategy and include[].
+
+	// format is the sniffed format of File, set by Validate.
+	format audioFormat
+}
+
+func (b *OpenAIRequestBodyTranscription) SetFormPart(name string, isFile bool, data []byte) error {
+	if isFile != (name == "file") {
+		return newValidationError(ErrInvalidForm, "only the file form part can be a file upload")
+	}
+
+	switch name {
+	case "file":
+		b.File = data
+	case "model":
+		b.Model = string(data)
+	case "language":
+		b.Language = string(data)
+	case "prompt":
+		b.Prompt = string(data)
+	case "response_format":
+		b.ResponseFormat = string(data)
+	case "temperature":
+		b.Temperature = string(data)
+	default:
+		return newValidationError(ErrInvalidForm, "form part not allowed: "+name)
+	}
+	return nil
+}
+
+func (b *OpenAIRequestBodyTranscription) Validate(supportedModels []string) (string, bool, error) {
+	if b.Model == "" {
+		return "", false, newValidationError(ErrMissingRequiredField, "missing required field: model")
+	}
+
+	if !slices.Contains(supportedModels, b.Model) {
+		return "", false, newValidationError(ErrUnsupportedModel, "unsupported model: "+b.Model)
+	}
+
+	if len(b.File) == 0 {
+		return "", false, newValidationError(ErrMissingRequiredField, "missing required field: file")
+	}
+
+	format, ok := sniffAudio(b.File)
+	if !ok {
+		return "", false, newValidationError(ErrContentTypeNotAllowed, "unsupported audio format")
+	}
+	b.format = format
+
+	if b.ResponseFormat != "" && !slices.Contains(transcriptionResponseFormats, b.ResponseFormat) {
+		return "", false, newValidationError(ErrInvalidForm, "unsupported response_format: "+b.ResponseFormat)
+	}
+
+	if b.Temperature != "" {
+		temperature, err := strconv.ParseFloat(b.Temperature, 64)
+		if err != nil || temperature < 0 || temperature > 1 {
+			return "", false, newValidationError(ErrInvalidForm, "temperature must be a number between 0 and 1")
+		}
+	}
+
+	if b.Language != "" && !isLanguageCode(b.Language) {
+		return "", false, newValidationError(ErrInvalidForm, "language must be an ISO-639 language code")
+	}
+
+	return b.Model, false, nil
+}
+
+// EncodeForm writes the transcription request. The file is renamed after its sniffed format, the
+// name chosen by the client is not forwarded.
+func (b *OpenAIRequestBodyTranscription) EncodeForm(w *multipart.Writer) error {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="audio%s"`, b.format.Extension))
+	header.Set("Content-Type", b.format.MediaType)
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(b.File); err != nil {
+		return err
+	}
+
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{name: "model", value: b.Model},
+		{name: "language", value: b.Language},
+		{name: "prompt", value: b.Prompt},
+		{name: "response_format", value: b.ResponseFormat},
+		{name: "temperature", value: b.Temperature},
+	}
+	for _, field := range fields {
+		if field.value == "" {
+			continue
+		}
+		if err := w.WriteField(field.name, field.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isLanguageCode reports whether s is a lowercase ISO-639-1 or ISO-639-3 code.
+func isLanguageCode(s string) bool {
+	if len(s) != 2 && len(s) != 3 {
+		return false
+	}
+	for _, c := range s {
+		if c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
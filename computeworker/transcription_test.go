@@ -0,0 +1,309 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package computeworker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	test "github.com/openpcc/openpcc/inttest"
+	"github.com/stretchr/testify/require"
+)
+
+// testWAV is the start of a RIFF WAVE file.
+var testWAV = append([]byte("RIFF\x24\x00\x00\x00WAVEfmt "), make([]byte, 64)...)
+
+type testFormPart struct {
+	name     string
+	filename string
+	header   map[string]string
+	data     []byte
+}
+
+// newTestForm encodes parts as a multipart/form-data body, returning the body and its Content-Type.
+func newTestForm(t *testing.T, parts ...testFormPart) ([]byte, string) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for _, p := range parts {
+		header := textproto.MIMEHeader{}
+		disposition := fmt.Sprintf(`form-data; name=%q`, p.name)
+		if p.filename != "" {
+			disposition += fmt.Sprintf(`; filename=%q`, p.filename)
+		}
+		header.Set("Content-Disposition", disposition)
+		for k, v := range p.header {
+			header.Set(k, v)
+		}
+		part, err := w.CreatePart(header)
+		require.NoError(t, err)
+		_, err = part.Write(p.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes(), w.FormDataContentType()
+}
+
+func TestSniffAudio(t *testing.T) {
+	testCases := []struct {
+		name          string
+		data          []byte
+		wantMediaType string
+	}{
+		{name: "wav", data: testWAV, wantMediaType: "audio/wav"},
+		{name: "flac", data: []byte("fLaC\x00\x00\x00\x22"), wantMediaType: "audio/flac"},
+		{name: "mp3 with id3 tag", data: []byte("ID3\x04\x00\x00"), wantMediaType: "audio/mpeg"},
+		{name: "mp3 frame", data: []byte{0xFF, 0xFB, 0x90, 0x64}, wantMediaType: "audio/mpeg"},
+		{name: "m4a", data: []byte("\x00\x00\x00\x20ftypM4A "), wantMediaType: "audio/mp4"},
+		{name: "ogg", data: []byte("OggS\x00\x02"), wantMediaType: "audio/ogg"},
+		{name: "webm", data: []byte{0x1A, 0x45, 0xDF, 0xA3, 0x9F}, wantMediaType: "audio/webm"},
+		{name: "riff without wave", data: []byte("RIFF\x24\x00\x00\x00AVI LIST")},
+		{name: "png", data: []byte("\x89PNG\r\n\x1a\n")},
+		{name: "text", data: []byte("hello world")},
+		{name: "empty"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			format, ok := sniffAudio(tc.data)
+			require.Equal(t, tc.wantMediaType != "", ok)
+			require.Equal(t, tc.wantMediaType, format.MediaType)
+		})
+	}
+}
+
+func TestTranscriptionBodyValidator(t *testing.T) {
+	maxFormSize := 4 * 1024
+	validator := BodyValidator{
+		MaxSize:     1024,
+		MaxFormSize: maxFormSize,
+		FormBodyTypes: map[string]func() FormRequestBody{
+			OpenAITranscriptionsPath: func() FormRequestBody { return &OpenAIRequestBodyTranscription{} },
+		},
+		SupportedModels: []string{"llama3.2:1b", "private-model1:5b"},
+	}
+
+	badge := getTestBadge(t, test.NewTestBadgeKeyProvider())
+
+	file := testFormPart{name: "file", filename: "../../secret name.wav", header: map[string]string{"Content-Type": "audio/x-wav"}, data: testWAV}
+	model := testFormPart{name: "model", data: []byte("llama3.2:1b")}
+
+	newRequest := func(body []byte, contentType string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, OpenAITranscriptionsPath, bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.ContentLength = int64(len(body))
+		return req
+	}
+
+	t.Run("ok, body is re-encoded from the validated parts", func(t *testing.T) {
+		body, contentType := newTestForm(t, file, model,
+			testFormPart{name: "language", data: []byte("en")},
+			testFormPart{name: "response_format", data: []byte("verbose_json")},
+			testFormPart{name: "temperature", data: []byte("0.2")},
+		)
+		req := newRequest(body, contentType)
+		require.NoError(t, validator.ValidateWithBadge(req, &badge))
+		require.NotEqual(t, contentType, req.Header.Get("Content-Type"))
+
+		mediaType, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		require.Equal(t, "multipart/form-data", mediaType)
+
+		reader := multipart.NewReader(req.Body, params["boundary"])
+		got := map[string]string{}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			data, err := io.ReadAll(part)
+			require.NoError(t, err)
+			got[part.FormName()] = string(data)
+			if part.FormName() == "file" {
+				// the client file name is not forwarded.
+				require.Equal(t, "audio.wav", part.FileName())
+				require.Equal(t, "audio/wav", part.Header.Get("Content-Type"))
+			}
+		}
+		require.Equal(t, map[string]string{
+			"file":            string(testWAV),
+			"model":           "llama3.2:1b",
+			"language":        "en",
+			"response_format": "verbose_json",
+			"temperature":     "0.2",
+		}, got)
+	})
+
+	testCases := []struct {
+		name     string
+		parts    []testFormPart
+		wantCode ValidationErrorCode
+	}{
+		{
+			name:     "unknown_part",
+			parts:    []testFormPart{file, model, {name: "stream", data: []byte("true")}},
+			wantCode: ErrInvalidForm,
+		},
+		{
+			name:     "duplicate_part",
+			parts:    []testFormPart{file, model, {name: "model", data: []byte("private-model1:5b")}},
+			wantCode: ErrInvalidForm,
+		},
+		{
+			name:     "part_header_not_allowed",
+			parts:    []testFormPart{file, {name: "model", header: map[string]string{"Content-Transfer-Encoding": "base64"}, data: []byte("bGxhbWEzLjI6MWI=")}},
+			wantCode: ErrHeaderNotAllowed,
+		},
+		{
+			name:     "file_upload_for_a_field",
+			parts:    []testFormPart{file, {name: "model", filename: "model.txt", data: []byte("llama3.2:1b")}},
+			wantCode: ErrInvalidForm,
+		},
+		{
+			name:     "file_sent_as_a_field",
+			parts:    []testFormPart{{name: "file", data: testWAV}, model},
+			wantCode: ErrInvalidForm,
+		},
+		{
+			name:     "field_too_large",
+			parts:    []testFormPart{file, model, {name: "prompt", data: bytes.Repeat([]byte("a"), maxFormFieldSize+1)}},
+			wantCode: ErrBodyTooLarge,
+		},
+		{
+			name:     "missing_file",
+			parts:    []testFormPart{model},
+			wantCode: ErrMissingRequiredField,
+		},
+		{
+			name:     "missing_model",
+			parts:    []testFormPart{file},
+			wantCode: ErrMissingRequiredField,
+		},
+		{
+			name:     "file_is_not_audio",
+			parts:    []testFormPart{{name: "file", filename: "audio.wav", data: []byte("<html></html>")}, model},
+			wantCode: ErrContentTypeNotAllowed,
+		},
+		{
+			name:     "unsupported_model",
+			parts:    []testFormPart{file, {name: "model", data: []byte("whisper-1")}},
+			wantCode: ErrUnsupportedModel,
+		},
+		{
+			name:     "model_not_in_badge_credentials",
+			parts:    []testFormPart{file, {name: "model", data: []byte("private-model1:5b")}},
+			wantCode: ErrUnsupportedModel,
+		},
+		{
+			name:     "response_format_without_usage",
+			parts:    []testFormPart{file, model, {name: "response_format", data: []byte("srt")}},
+			wantCode: ErrInvalidForm,
+		},
+		{
+			name:     "temperature_out_of_range",
+			parts:    []testFormPart{file, model, {name: "temperature", data: []byte("1.5")}},
+			wantCode: ErrInvalidForm,
+		},
+		{
+			name:     "invalid_language",
+			parts:    []testFormPart{file, model, {name: "language", data: []byte("English")}},
+			wantCode: ErrInvalidForm,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, contentType := newTestForm(t, tc.parts...)
+			err := validator.ValidateWithBadge(newRequest(body, contentType), &badge)
+			assertError(t, err, true, tc.wantCode)
+		})
+	}
+
+	t.Run("fail, body exceeds max form size", func(t *testing.T) {
+		audio := append(bytes.Clone(testWAV), bytes.Repeat([]byte{0}, maxFormSize)...)
+		body, contentType := newTestForm(t, testFormPart{name: "file", filename: "a.wav", data: audio}, model)
+		err := validator.ValidateWithBadge(newRequest(body, contentType), &badge)
+		assertError(t, err, true, ErrBodyTooLarge)
+	})
+
+	t.Run("fail, malformed multipart body", func(t *testing.T) {
+		body := []byte("--boundary\r\nContent-Disposition: form-data; name=\"model\"\r\n\r\nllama3.2:1b")
+		err := validator.ValidateWithBadge(newRequest(body, "multipart/form-data; boundary=boundary"), &badge)
+		assertError(t, err, true, ErrInvalidForm)
+	})
+}
+
+func TestHeaderValidatorFormPaths(t *testing.T) {
+	validator := HeaderValidator{
+		MaxHeaderSize: 1024,
+		FormPaths:     []string{OpenAITranscriptionsPath},
+	}
+
+	testCases := []struct {
+		name        string
+		path        string
+		contentType string
+		wantErr     bool
+	}{
+		{name: "form path with multipart", path: OpenAITranscriptionsPath, contentType: "multipart/form-data; boundary=abc"},
+		{name: "form path without boundary", path: OpenAITranscriptionsPath, contentType: "multipart/form-data", wantErr: true},
+		{name: "form path with json", path: OpenAITranscriptionsPath, contentType: "application/json", wantErr: true},
+		{name: "json path with multipart", path: OpenAIChatPath, contentType: "multipart/form-data; boundary=abc", wantErr: true},
+		{name: "malformed media type", path: OpenAITranscriptionsPath, contentType: "multipart/form-data; boundary=", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(""))
+			req.Header.Set("Content-Type", tc.contentType)
+			req.Header.Set("X-Confsec-Badge", "badge")
+
+			err := validator.Validate(req)
+			assertError(t, err, tc.wantErr, ErrContentTypeNotAllowed)
+		})
+	}
+}
+
+func FuzzOpenAITranscriptionBody(f *testing.F) {
+	formPart := func(name, filename, data string) string {
+		disposition := fmt.Sprintf(`form-data; name=%q`, name)
+		if filename != "" {
+			disposition += fmt.Sprintf(`; filename=%q`, filename)
+		}
+		return "--" + fuzzFormBoundary + "\r\nContent-Disposition: " + disposition + "\r\n\r\n" + data + "\r\n"
+	}
+	end := "--" + fuzzFormBoundary + "--\r\n"
+
+	fuzzRequestBodySeeds(f,
+		formPart("model", "", "llama3.2:1b")+formPart("file", "a.wav", string(testWAV))+end,
+		formPart("file", "a.flac", "fLaC\x00\x00\x00\x22")+formPart("model", "", "llama3.2:1b")+
+			formPart("language", "", "en")+formPart("temperature", "", "0.2")+formPart("response_format", "", "verbose_json")+end,
+		formPart("model", "", "llama3.2:1b")+formPart("file", "a.mp3", "ID3\x04")+formPart("prompt", "", "a\r\n--b")+end,
+	)
+	f.Fuzz(func(_ *testing.T, data []byte) {
+		FuzzOpenAITranscription(data)
+	})
+}
@@ -0,0 +1,118 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeworker
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CanonicalURLPath returns the canonical form of an absolute URL path, like the path of an
+// origin-form request target. It applies the syntax-based normalization of RFC 3986 section 6.2.2
+// to the URL path as such, the same on every platform:
+//   - percent-encoded unreserved characters are decoded, other percent-encodings get upper case
+//     hex digits.
+//   - dot segments are removed as in RFC 3986 section 5.2.4, also when their dots are percent-encoded.
+//
+// Beyond RFC 3986, empty segments are removed, so the canonical path has no repeated or trailing
+// slashes.
+//
+// Some servers read percent-encoded slashes, backslashes and control characters as path separators
+// or terminators, so they are rejected instead of kept encoded. So are characters that are not
+// allowed in a path, malformed percent-encodings and paths that don't start with a slash.
+func CanonicalURLPath(p string) (string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return "", errors.New("url path is not absolute")
+	}
+
+	segments := []string{}
+	for _, segment := range strings.Split(p[1:], "/") {
+		segment, err := canonicalPathSegment(segment)
+		if err != nil {
+			return "", err
+		}
+		switch segment {
+		case "", ".":
+		case "..":
+			// like RFC 3986, a dot segment can't go above the root.
+			if len(segments) > 0 {
+				segments = segments[:len(segments)-1]
+			}
+		default:
+			segments = append(segments, segment)
+		}
+	}
+	return "/" + strings.Join(segments, "/"), nil
+}
+
+// canonicalPathSegment normalizes the percent-encodings of a path segment.
+func canonicalPathSegment(segment string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		if c != '%' {
+			if !isPathChar(c) {
+				return "", fmt.Errorf("invalid character %q in url path", c)
+			}
+			b.WriteByte(c)
+			continue
+		}
+
+		if i+2 >= len(segment) || !isHex(segment[i+1]) || !isHex(segment[i+2]) {
+			return "", errors.New("malformed percent-encoding in url path")
+		}
+		decoded := unhex(segment[i+1])<<4 | unhex(segment[i+2])
+		i += 2
+		switch {
+		case isUnreserved(decoded):
+			b.WriteByte(decoded)
+		case decoded == '/' || decoded == '\\' || decoded < 0x20 || decoded == 0x7f:
+			return "", fmt.Errorf("percent-encoded %q in url path", decoded)
+		default:
+			fmt.Fprintf(&b, "%%%02X", decoded)
+		}
+	}
+	return b.String(), nil
+}
+
+// isUnreserved reports whether c is an unreserved character of RFC 3986.
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// isPathChar reports whether c is allowed unencoded in a path segment, a pchar of RFC 3986
+// other than a percent-encoding.
+func isPathChar(c byte) bool {
+	return isUnreserved(c) || strings.IndexByte("!$&'()*+,;=:@", c) >= 0
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package computeworker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalURLPath(t *testing.T) {
+	testCases := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "root", path: "/", want: "/"},
+		{name: "canonical", path: "/v1/chat/completions", want: "/v1/chat/completions"},
+		{name: "trailing_slash", path: "/api/generate/", want: "/api/generate"},
+		{name: "repeated_slashes", path: "//api///generate", want: "/api/generate"},
+		{name: "dot_segments", path: "/api/./generate/../chat", want: "/api/chat"},
+		{name: "dot_segments_above_root", path: "/../../api/chat", want: "/api/chat"},
+		{name: "dot_segment_at_end", path: "/api/chat/..", want: "/api"},
+		{name: "dots_in_segment", path: "/api/.../chat..", want: "/api/.../chat.."},
+		{name: "encoded_unreserved", path: "/api/%67enerate%7E", want: "/api/generate~"},
+		{name: "encoded_dot_segment", path: "/api/%2e%2E/admin", want: "/admin"},
+		{name: "encoded_reserved_upper_cased", path: "/a%3ab%20c", want: "/a%3Ab%20c"},
+		{name: "encoded_non_ascii", path: "/caf%c3%a9", want: "/caf%C3%A9"},
+		{name: "sub_delims", path: "/a:b@c!$&'()*+,;=", want: "/a:b@c!$&'()*+,;="},
+		{name: "backslash_is_not_a_separator", path: "/api/%5C..", wantErr: true},
+		{name: "relative", path: "api/generate", wantErr: true},
+		{name: "empty", path: "", wantErr: true},
+		{name: "absolute_form", path: "http://localhost/api/generate", wantErr: true},
+		{name: "query", path: "/api/generate?x=1", wantErr: true},
+		{name: "fragment", path: "/api/generate#x", wantErr: true},
+		{name: "raw_backslash", path: `/api\generate`, wantErr: true},
+		{name: "raw_space", path: "/api/gen erate", wantErr: true},
+		{name: "raw_non_ascii", path: "/café", wantErr: true},
+		{name: "raw_control", path: "/api/generate\x00", wantErr: true},
+		{name: "encoded_slash", path: "/api%2Fgenerate", wantErr: true},
+		{name: "encoded_nul", path: "/api/generate%00", wantErr: true},
+		{name: "encoded_newline", path: "/api/generate%0a", wantErr: true},
+		{name: "truncated_percent_encoding", path: "/api/generate%4", wantErr: true},
+		{name: "invalid_percent_encoding", path: "/api/%zzgenerate", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := CanonicalURLPath(tc.path)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+
+			// canonical paths are their own canonical form.
+			again, err := CanonicalURLPath(got)
+			require.NoError(t, err)
+			require.Equal(t, got, again)
+		})
+	}
+}
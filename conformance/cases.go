@@ -0,0 +1,299 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conformance
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker"
+	"github.com/openpcc/openpcc/ahttp"
+)
+
+// requestBaseURL is the base of the encapsulated requests, the worker only looks at the path.
+const requestBaseURL = "https://confsec.invalid"
+
+// maxTokens keeps the responses short, so that they leave a refund.
+const maxTokens = 16
+
+// Config is what the cases need to know about the node.
+type Config struct {
+	// Model is a chat model of the node.
+	Model string
+	// RerankModel is a rerank model of the node, the rerank case is skipped when blank.
+	RerankModel string
+	// Badge is a serialized badge that grants access to the models.
+	Badge string
+	// RefundTrailer is set when router_com returns refunds in trailers. Nodes that only report
+	// refunds with callbacks have no refunds to check.
+	RefundTrailer bool
+}
+
+// Cases returns the conformance cases for a node with cfg.
+func Cases(cfg Config) []Case {
+	refund := refundCheck(cfg.RefundTrailer)
+	generate := fmt.Sprintf(`{"model":%q,"prompt":"Say hello.","options":{"num_predict":%d}`, cfg.Model, maxTokens)
+	chat := fmt.Sprintf(`{"model":%q,"messages":[{"role":"user","content":"Say hello."}],"options":{"num_predict":%d}`, cfg.Model, maxTokens)
+	completions := fmt.Sprintf(`{"model":%q,"prompt":"Say hello.","max_tokens":%d`, cfg.Model, maxTokens)
+	chatCompletions := fmt.Sprintf(`{"model":%q,"messages":[{"role":"user","content":"Say hello."}],"max_tokens":%d`, cfg.Model, maxTokens)
+
+	cases := []Case{
+		{
+			Name:    "ollama generate",
+			Request: cfg.request(computeworker.OllamaGeneratePath, generate+`,"stream":false}`, nil),
+			Check:   all(status(http.StatusOK), contentType("application/json"), jsonField("response"), refund),
+		},
+		{
+			Name:    "ollama generate, streaming",
+			Request: cfg.request(computeworker.OllamaGeneratePath, generate+`,"stream":true}`, nil),
+			Check:   all(status(http.StatusOK), contentType("application/x-ndjson"), ndjsonDone, refund),
+		},
+		{
+			Name:    "ollama chat",
+			Request: cfg.request(computeworker.OllamaChatPath, chat+`,"stream":false}`, nil),
+			Check:   all(status(http.StatusOK), contentType("application/json"), jsonField("message"), refund),
+		},
+		{
+			Name:    "ollama chat, streaming",
+			Request: cfg.request(computeworker.OllamaChatPath, chat+`,"stream":true}`, nil),
+			Check:   all(status(http.StatusOK), contentType("application/x-ndjson"), ndjsonDone, refund),
+		},
+		{
+			Name:    "openai completions",
+			Request: cfg.request(computeworker.OpenAICompletionsPath, completions+`}`, nil),
+			Check:   all(status(http.StatusOK), contentType("application/json"), jsonField("choices"), refund),
+		},
+		{
+			Name:    "openai completions, streaming",
+			Request: cfg.request(computeworker.OpenAICompletionsPath, completions+`,"stream":true}`, nil),
+			Check:   all(status(http.StatusOK), contentType("text/event-stream"), eventStreamDone, refund),
+		},
+		{
+			Name:    "openai chat completions",
+			Request: cfg.request(computeworker.OpenAIChatPath, chatCompletions+`}`, nil),
+			Check:   all(status(http.StatusOK), contentType("application/json"), jsonField("choices"), refund),
+		},
+		{
+			Name:    "openai chat completions, streaming",
+			Request: cfg.request(computeworker.OpenAIChatPath, chatCompletions+`,"stream":true}`, nil),
+			Check:   all(status(http.StatusOK), contentType("text/event-stream"), eventStreamDone, refund),
+		},
+	}
+
+	if cfg.RerankModel != "" {
+		cases = append(cases, Case{
+			Name:    "vllm rerank",
+			Request: cfg.request(computeworker.VLLMRerankPath, fmt.Sprintf(`{"model":%q,"query":"hello","documents":["hello","goodbye"]}`, cfg.RerankModel), nil),
+			Check:   all(status(http.StatusOK), contentType("application/json"), jsonField("results")),
+		})
+	}
+
+	// the exec modes mask traffic, their responses have to be indistinguishable from real ones
+	// to router_com, so they come with refunds too.
+	cases = append(cases,
+		Case{
+			Name:    "exec noop",
+			Request: cfg.request(computeworker.OllamaGeneratePath, generate+`}`, map[string]string{"X-Confsec-Exec": "noop"}),
+			Check:   all(status(http.StatusOK), contentType("application/x-ndjson"), ndjsonDone, refund),
+		},
+		Case{
+			Name:    "exec simulated, ollama chat",
+			Request: cfg.request(computeworker.OllamaChatPath, chat+`,"stream":true}`, map[string]string{"X-Confsec-Exec": "simulated"}),
+			Check:   all(status(http.StatusOK), contentType("application/x-ndjson"), ndjsonDone, refund),
+		},
+		Case{
+			Name:    "exec simulated, openai chat completions",
+			Request: cfg.request(computeworker.OpenAIChatPath, chatCompletions+`,"stream":true}`, map[string]string{"X-Confsec-Exec": "simulated"}),
+			Check:   all(status(http.StatusOK), contentType("text/event-stream"), eventStreamDone, refund),
+		},
+		Case{
+			Name:    "exec diagnostic",
+			Request: cfg.request(computeworker.OpenAICompletionsPath, completions+`,"stream":true}`, map[string]string{"X-Confsec-Exec": "diagnostic-stream-short"}),
+			Check:   all(status(http.StatusOK), eventStreamDone, refund),
+		},
+	)
+
+	tooManyMessages := strings.Repeat(`{"role":"user","content":"hi"},`, 1024)
+	cases = append(cases,
+		Case{
+			Name:    "error, unsupported model",
+			Request: cfg.request(computeworker.OpenAIChatPath, `{"model":"unsupported-model","messages":[{"role":"user","content":"hi"}]}`, nil),
+			Check:   status(http.StatusBadRequest),
+		},
+		Case{
+			Name:    "error, unsupported path",
+			Request: cfg.request("/api/pull", fmt.Sprintf(`{"model":%q}`, cfg.Model), nil),
+			Check:   status(http.StatusNotFound),
+		},
+		Case{
+			Name:    "error, invalid json",
+			Request: cfg.request(computeworker.OpenAIChatPath, `{"model":`, nil),
+			Check:   status(http.StatusBadRequest),
+		},
+		Case{
+			Name:    "error, too many messages",
+			Request: cfg.request(computeworker.OpenAIChatPath, fmt.Sprintf(`{"model":%q,"messages":[%s{"role":"user","content":"hi"}]}`, cfg.Model, tooManyMessages), nil),
+			Check:   status(http.StatusBadRequest),
+		},
+		Case{
+			Name:    "error, unknown exec mode",
+			Request: cfg.request(computeworker.OllamaGeneratePath, generate+`}`, map[string]string{"X-Confsec-Exec": "unknown"}),
+			Check:   status(http.StatusBadRequest),
+		},
+		Case{
+			Name:    "error, missing badge",
+			Request: Config{Model: cfg.Model}.request(computeworker.OpenAIChatPath, chatCompletions+`}`, nil),
+			Check:   status(http.StatusBadRequest),
+		},
+		Case{
+			Name:         "error, no credits",
+			CreditAmount: -1,
+			Request:      cfg.request(computeworker.OpenAIChatPath, chatCompletions+`}`, nil),
+			Check:        routerStatus(http.StatusBadRequest),
+		},
+	)
+	return cases
+}
+
+// request returns a function that creates a JSON request for path with the badge of the config.
+func (c Config) request(path string, body string, header map[string]string) func() (*http.Request, error) {
+	return func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, requestBaseURL+path, strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if c.Badge != "" {
+			req.Header.Set("X-Confsec-Badge", c.Badge)
+		}
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		return req, nil
+	}
+}
+
+type check func(resp *Response) error
+
+// all runs the checks in order and returns the first error.
+func all(checks ...check) check {
+	return func(resp *Response) error {
+		for _, c := range checks {
+			if err := c(resp); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// status checks the status of the worker response.
+func status(code int) check {
+	return func(resp *Response) error {
+		if resp.Worker == nil {
+			return fmt.Errorf("router_com rejected the request with status %d, want a worker response with status %d", resp.StatusCode, code)
+		}
+		if resp.Worker.StatusCode != code {
+			return fmt.Errorf("got status %d, want %d: %.256s", resp.Worker.StatusCode, code, resp.Body)
+		}
+		return nil
+	}
+}
+
+// routerStatus checks that router_com rejected the request with code.
+func routerStatus(code int) check {
+	return func(resp *Response) error {
+		if resp.Worker != nil {
+			return fmt.Errorf("got a worker response with status %d, want router_com to reject the request with status %d", resp.Worker.StatusCode, code)
+		}
+		if resp.StatusCode != code {
+			return fmt.Errorf("router_com rejected the request with status %d, want %d", resp.StatusCode, code)
+		}
+		return nil
+	}
+}
+
+func contentType(want string) check {
+	return func(resp *Response) error {
+		got, _, err := mime.ParseMediaType(resp.Worker.Header.Get("Content-Type"))
+		if err != nil || got != want {
+			return fmt.Errorf("got content type %q, want %q", resp.Worker.Header.Get("Content-Type"), want)
+		}
+		return nil
+	}
+}
+
+// jsonField checks that the body is a JSON object with the field.
+func jsonField(field string) check {
+	return func(resp *Response) error {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(resp.Body, &obj); err != nil {
+			return fmt.Errorf("invalid json body: %w", err)
+		}
+		if _, ok := obj[field]; !ok {
+			return fmt.Errorf("json body has no %q field", field)
+		}
+		return nil
+	}
+}
+
+// ndjsonDone checks that the last line of a newline delimited JSON body is done.
+func ndjsonDone(resp *Response) error {
+	lines := bytes.Split(bytes.TrimSpace(resp.Body), []byte("\n"))
+	var last struct {
+		Done bool `json:"done"`
+	}
+	if err := json.Unmarshal(lines[len(lines)-1], &last); err != nil {
+		return fmt.Errorf("invalid last line: %w", err)
+	}
+	if !last.Done {
+		return errors.New("last line is not done")
+	}
+	return nil
+}
+
+// eventStreamDone checks that a server-sent events body ends with the [DONE] event.
+func eventStreamDone(resp *Response) error {
+	if !bytes.HasSuffix(bytes.TrimSpace(resp.Body), []byte("data: [DONE]")) {
+		return errors.New("event stream does not end with [DONE]")
+	}
+	return nil
+}
+
+// refundCheck checks that router_com returned a refund trailer, when it returns them at all.
+func refundCheck(enabled bool) check {
+	return func(resp *Response) error {
+		if !enabled {
+			return nil
+		}
+		value := resp.Trailer.Get(ahttp.NodeRefundAmountHeader)
+		if value == "" {
+			return errors.New("missing refund trailer")
+		}
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(b) == 0 {
+			return fmt.Errorf("invalid refund trailer %q", value)
+		}
+		return nil
+	}
+}
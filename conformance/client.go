@@ -0,0 +1,154 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conformance
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/cloudflare/circl/hpke"
+	"github.com/cloudflare/circl/kem"
+	"github.com/openpcc/openpcc/ahttp"
+	"github.com/openpcc/openpcc/auth/credentialing"
+	"github.com/openpcc/openpcc/messages"
+	"github.com/openpcc/openpcc/router/api"
+	tpmhpke "github.com/openpcc/openpcc/tpm/hpke"
+	"github.com/openpcc/twoway"
+)
+
+// maxRejectionSize bounds how much of the body of a rejected request is read.
+const maxRejectionSize = 64 * 1024
+
+// NodeClient sends requests to router_com the way the router forwards client requests: the
+// request is encapsulated for the request encryption key of the node and the response is
+// decapsulated. Requests carry no router request ID, so refunds are always returned in trailers
+// unless router_com has no refund trailers at all.
+type NodeClient struct {
+	url        string
+	publicKey  kem.PublicKey
+	sender     *twoway.MultiRequestSender
+	httpClient *http.Client
+}
+
+// NewNodeClient creates a client for the router_com at nodeURL. publicKey is the binary request
+// encryption public key of the node, the key router_com passes to compute_worker.
+func NewNodeClient(nodeURL string, publicKey []byte, httpClient *http.Client) (*NodeClient, error) {
+	kemID, kdfID, aeadID := tpmhpke.SuiteParams()
+	pubKey, err := kemID.Scheme().UnmarshalBinaryPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal node public key: %w", err)
+	}
+
+	return &NodeClient{
+		url:        nodeURL,
+		publicKey:  pubKey,
+		sender:     twoway.NewMultiRequestSender(hpke.NewSuite(kemID, kdfID, aeadID), rand.Reader),
+		httpClient: httpClient,
+	}, nil
+}
+
+// Do implements Client.
+func (c *NodeClient) Do(ctx context.Context, req *http.Request, creditAmount int64) (*Response, error) {
+	ct, mediaType, err := messages.EncapsulateRequest(c.sender, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encapsulate request: %w", err)
+	}
+	encapKey, openerFunc, err := ct.EncapsulateKey(0, c.publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encapsulate key: %w", err)
+	}
+
+	nodeReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, ct)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create node request: %w", err)
+	}
+	nodeReq.Header.Set("Content-Type", mediaType)
+	nodeReq.Header.Set(api.EncapsulatedKeyHeader, base64.StdEncoding.EncodeToString(encapKey))
+	nodeReq.Header.Set(ahttp.NodeCreditAmountHeader, strconv.FormatInt(creditAmount, 10))
+
+	nodeResp, err := c.httpClient.Do(nodeReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send node request: %w", err)
+	}
+	defer nodeResp.Body.Close()
+
+	resp := &Response{StatusCode: nodeResp.StatusCode}
+	if nodeResp.StatusCode != http.StatusOK {
+		// rejections of router_com are not encrypted.
+		resp.Body, err = io.ReadAll(io.LimitReader(nodeResp.Body, maxRejectionSize))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rejection: %w", err)
+		}
+		return resp, nil
+	}
+
+	resp.Worker, err = messages.DecapsulateResponse(ctx, openerFunc, nodeResp.Header.Get("Content-Type"), nodeResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decapsulate response: %w", err)
+	}
+	resp.Body, err = io.ReadAll(resp.Worker.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// the trailers are only set once the body was read to the end.
+	if _, err := io.Copy(io.Discard, nodeResp.Body); err != nil {
+		return nil, fmt.Errorf("failed to read node response: %w", err)
+	}
+	resp.Trailer = nodeResp.Trailer
+	return resp, nil
+}
+
+// ParseBadgePrivateKey parses a PEM encoded PKCS #8 ed25519 private key, the key the auth server
+// signs badges with.
+func ParseBadgePrivateKey(b []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("failed to decode PEM block")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("badge private key is not an ed25519 key")
+	}
+	return privateKey, nil
+}
+
+// NewBadge returns a serialized badge signed with privateKey that grants access to models.
+func NewBadge(privateKey ed25519.PrivateKey, models ...string) (string, error) {
+	badge := credentialing.Badge{
+		Credentials: credentialing.Credentials{Models: models},
+	}
+	credBytes, err := badge.Credentials.MarshalBinary()
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal badge credentials: %w", err)
+	}
+	badge.Signature = ed25519.Sign(privateKey, credBytes)
+	return badge.Serialize()
+}
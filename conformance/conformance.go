@@ -0,0 +1,126 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package conformance checks a running compute node end to end. It sends a battery of encrypted
+// requests to router_com, like the router does for a client, and checks the decrypted responses
+// and trailers: every route, streaming and not, error cases, refunds and the exec modes used to
+// mask traffic. Operators run it with cmd/conformance after a deploy.
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Client sends a client request to a node.
+type Client interface {
+	// Do encapsulates req for the node, sends it with creditAmount credits and returns the response.
+	Do(ctx context.Context, req *http.Request, creditAmount int64) (*Response, error)
+}
+
+// Response is the response of a node to a request.
+type Response struct {
+	// StatusCode is the status of router_com. A request router_com rejects has no worker response.
+	StatusCode int
+	// Worker is the decrypted response of compute_worker, nil when router_com rejected the request.
+	// Its body was read into Body.
+	Worker *http.Response
+	Body   []byte
+	// Trailer is set by router_com from the output footer of the worker, e.g. the refund.
+	Trailer http.Header
+}
+
+// Case is a single request and the checks on its response.
+type Case struct {
+	Name string
+	// CreditAmount of the request, zero uses the credit amount of the config.
+	CreditAmount int64
+	Request      func() (*http.Request, error)
+	// Check returns an error when the response is not the response of a conforming node.
+	Check func(resp *Response) error
+}
+
+// Result is the outcome of a case.
+type Result struct {
+	Name     string
+	Duration time.Duration
+	// Err is nil when the case passed.
+	Err error
+}
+
+// Run runs the cases one after another, each bounded by timeout, so that they don't compete for
+// the workers of the node.
+func Run(ctx context.Context, client Client, cases []Case, creditAmount int64, timeout time.Duration) []Result {
+	results := make([]Result, 0, len(cases))
+	for _, c := range cases {
+		start := time.Now()
+		err := runCase(ctx, client, c, creditAmount, timeout)
+		results = append(results, Result{
+			Name:     c.Name,
+			Duration: time.Since(start),
+			Err:      err,
+		})
+	}
+	return results
+}
+
+func runCase(ctx context.Context, client Client, c Case, creditAmount int64, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := c.Request()
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.CreditAmount != 0 {
+		creditAmount = c.CreditAmount
+	}
+	resp, err := client.Do(ctx, req, creditAmount)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	return c.Check(resp)
+}
+
+// WriteReport writes a pass or fail line per result followed by a summary. It reports whether
+// all cases passed.
+func WriteReport(w io.Writer, results []Result) (bool, error) {
+	failed := 0
+	for _, r := range results {
+		status := "PASS"
+		if r.Err != nil {
+			status = "FAIL"
+			failed++
+		}
+		if _, err := fmt.Fprintf(w, "%s  %-48s %8s\n", status, r.Name, r.Duration.Round(time.Millisecond)); err != nil {
+			return false, err
+		}
+		if r.Err != nil {
+			if _, err := fmt.Fprintf(w, "      %v\n", r.Err); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "\n%d passed, %d failed\n", len(results)-failed, failed); err != nil {
+		return false, err
+	}
+	return failed == 0, nil
+}
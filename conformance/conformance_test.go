@@ -0,0 +1,193 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openpcc/openpcc/ahttp"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNode responds like a conforming node without running inference.
+type fakeNode struct {
+	models   []string
+	noRefund bool
+}
+
+func (n *fakeNode) Do(_ context.Context, req *http.Request, creditAmount int64) (*Response, error) {
+	if creditAmount <= 0 {
+		return &Response{StatusCode: http.StatusBadRequest}, nil
+	}
+
+	var body struct {
+		Model    string `json:"model"`
+		Stream   *bool  `json:"stream"`
+		Messages []any  `json:"messages"`
+	}
+	exec := req.Header.Get("X-Confsec-Exec")
+	switch {
+	case req.Header.Get("X-Confsec-Badge") == "":
+		return n.respond(http.StatusBadRequest, "application/json", `{"error":"badge is not provided"}`), nil
+	case exec != "" && exec != "noop" && exec != "simulated" && !strings.HasPrefix(exec, "diagnostic-"):
+		return n.respond(http.StatusBadRequest, "application/json", `{"error":"unknown exec mode"}`), nil
+	case !strings.HasPrefix(req.URL.Path, "/v1/") && !strings.HasPrefix(req.URL.Path, "/api/chat") && !strings.HasPrefix(req.URL.Path, "/api/generate"):
+		return n.respond(http.StatusNotFound, "application/json", `{"error":"unsupported path"}`), nil
+	case json.NewDecoder(req.Body).Decode(&body) != nil:
+		return n.respond(http.StatusBadRequest, "application/json", `{"error":"invalid json"}`), nil
+	case !slices.Contains(n.models, body.Model):
+		return n.respond(http.StatusBadRequest, "application/json", `{"error":"unsupported model"}`), nil
+	case len(body.Messages) > 1024:
+		return n.respond(http.StatusBadRequest, "application/json", `{"error":"too many messages"}`), nil
+	}
+
+	openAI := strings.HasPrefix(req.URL.Path, "/v1/")
+	switch {
+	case exec == "noop":
+		return n.respond(http.StatusOK, "application/x-ndjson", `{"response":"noop"}`+"\n"+`{"done":true}`+"\n"), nil
+	case strings.HasPrefix(exec, "diagnostic-"), openAI && (exec == "simulated" || body.Stream != nil && *body.Stream):
+		return n.respond(http.StatusOK, "text/event-stream", "data: {}\n\ndata: [DONE]\n\n"), nil
+	case exec == "simulated", !openAI && (body.Stream == nil || *body.Stream):
+		return n.respond(http.StatusOK, "application/x-ndjson", `{"done":false}`+"\n"+`{"done":true}`+"\n"), nil
+	default:
+		return n.respond(http.StatusOK, "application/json; charset=utf-8", `{"response":"","message":{},"choices":[],"results":[]}`), nil
+	}
+}
+
+func (n *fakeNode) respond(code int, contentType string, body string) *Response {
+	trailer := http.Header{}
+	if !n.noRefund {
+		trailer.Set(ahttp.NodeRefundAmountHeader, "CIABEAE=")
+	}
+	return &Response{
+		StatusCode: http.StatusOK,
+		Worker: &http.Response{
+			StatusCode: code,
+			Header:     http.Header{"Content-Type": {contentType}},
+		},
+		Body:    []byte(body),
+		Trailer: trailer,
+	}
+}
+
+func TestCases(t *testing.T) {
+	cfg := Config{
+		Model:         "llama3.2:1b",
+		RerankModel:   "bge-reranker",
+		Badge:         "badge",
+		RefundTrailer: true,
+	}
+
+	t.Run("ok, conforming node", func(t *testing.T) {
+		cases := Cases(cfg)
+		results := Run(t.Context(), &fakeNode{models: []string{cfg.Model, cfg.RerankModel}}, cases, 1000, time.Second)
+		require.Len(t, results, len(cases))
+
+		names := map[string]bool{}
+		for _, r := range results {
+			require.NoError(t, r.Err, r.Name)
+			require.False(t, names[r.Name], "duplicate case %s", r.Name)
+			names[r.Name] = true
+		}
+		require.True(t, names["vllm rerank"])
+	})
+
+	t.Run("ok, no rerank model", func(t *testing.T) {
+		for _, c := range Cases(Config{Model: cfg.Model}) {
+			require.NotEqual(t, "vllm rerank", c.Name)
+		}
+	})
+
+	t.Run("ok, refunds are not checked without refund trailers", func(t *testing.T) {
+		cfg := cfg
+		cfg.RefundTrailer = false
+		results := Run(t.Context(), &fakeNode{models: []string{cfg.Model, cfg.RerankModel}, noRefund: true}, Cases(cfg), 1000, time.Second)
+		for _, r := range results {
+			require.NoError(t, r.Err, r.Name)
+		}
+	})
+
+	t.Run("fail, missing refunds", func(t *testing.T) {
+		results := Run(t.Context(), &fakeNode{models: []string{cfg.Model, cfg.RerankModel}, noRefund: true}, Cases(cfg), 1000, time.Second)
+		for _, r := range results {
+			if r.Name == "ollama generate" || r.Name == "exec noop" {
+				require.ErrorContains(t, r.Err, "missing refund trailer")
+			}
+		}
+	})
+
+	t.Run("fail, unsupported model", func(t *testing.T) {
+		results := Run(t.Context(), &fakeNode{models: []string{"other-model"}}, Cases(cfg), 1000, time.Second)
+		for _, r := range results {
+			if r.Name == "openai chat completions" {
+				require.ErrorContains(t, r.Err, "got status 400, want 200")
+			}
+		}
+	})
+}
+
+type errClient struct{}
+
+func (errClient) Do(context.Context, *http.Request, int64) (*Response, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestWriteReport(t *testing.T) {
+	results := Run(t.Context(), errClient{}, []Case{
+		{Name: "a", Request: Config{}.request("/api/generate", `{}`, nil), Check: status(http.StatusOK)},
+	}, 1000, time.Second)
+	results = append(results, Result{Name: "b"})
+
+	buf := &bytes.Buffer{}
+	passed, err := WriteReport(buf, results)
+	require.NoError(t, err)
+	require.False(t, passed)
+	require.Contains(t, buf.String(), "FAIL  a")
+	require.Contains(t, buf.String(), "request failed: connection refused")
+	require.Contains(t, buf.String(), "PASS  b")
+	require.Contains(t, buf.String(), "1 passed, 1 failed")
+
+	passed, err = WriteReport(&bytes.Buffer{}, results[1:])
+	require.NoError(t, err)
+	require.True(t, passed)
+}
+
+func TestParseBadgePrivateKey(t *testing.T) {
+	_, sk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(sk)
+	require.NoError(t, err)
+
+	got, err := ParseBadgePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+	require.Equal(t, sk, got)
+
+	_, err = ParseBadgePrivateKey([]byte("not a key"))
+	require.Error(t, err)
+}
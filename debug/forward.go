@@ -0,0 +1,154 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debug
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+)
+
+const (
+	// maxForwardedLine is the longest log line of a child process that is parsed, longer lines
+	// are forwarded as unstructured output.
+	maxForwardedLine = 64 * 1024
+	// maxUnstructuredOutput caps how much of a line that is not a JSON log record is forwarded.
+	maxUnstructuredOutput = 512
+)
+
+// ForwardLogs forwards the JSON log records a child process writes to r through logger, until r
+// is exhausted. Attributes are redacted like the records of this process and the trace of ctx is
+// attached by the logger. The cmd_id of the child process is kept as child_cmd_id.
+//
+// Lines that are not JSON log records, e.g. the output of a panic, only have the secrets in their
+// text redacted. They are forwarded truncated to maxUnstructuredOutput bytes as a warning.
+func ForwardLogs(ctx context.Context, r io.Reader, logger *slog.Logger) error {
+	br := bufio.NewReaderSize(r, maxForwardedLine)
+	for {
+		line, isPrefix, err := br.ReadLine()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if isPrefix {
+			forwardUnstructured(ctx, logger, line)
+			// discard the rest of the line.
+			for isPrefix {
+				_, isPrefix, err = br.ReadLine()
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if len(line) == 0 {
+			continue
+		}
+
+		record, ok := parseLogRecord(line)
+		if !ok {
+			forwardUnstructured(ctx, logger, line)
+			continue
+		}
+
+		handler := logger.Handler()
+		if !handler.Enabled(ctx, record.Level) {
+			continue
+		}
+		if err := handler.Handle(ctx, record); err != nil {
+			return err
+		}
+	}
+}
+
+func forwardUnstructured(ctx context.Context, logger *slog.Logger, line []byte) {
+	truncated := len(line) > maxUnstructuredOutput
+	if truncated {
+		line = line[:maxUnstructuredOutput]
+	}
+	logger.WarnContext(ctx, "Unstructured output from child process", "output", string(line), "truncated", truncated)
+}
+
+// parseLogRecord parses a log record written by slog.JSONHandler.
+func parseLogRecord(line []byte) (slog.Record, bool) {
+	var fields map[string]any
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return slog.Record{}, false
+	}
+
+	msg, ok := fields[slog.MessageKey].(string)
+	if !ok {
+		return slog.Record{}, false
+	}
+	levelText, ok := fields[slog.LevelKey].(string)
+	if !ok {
+		return slog.Record{}, false
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(levelText)); err != nil {
+		return slog.Record{}, false
+	}
+
+	t := time.Now()
+	if v, ok := fields[slog.TimeKey].(string); ok {
+		if parsed, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			t = parsed
+		}
+	}
+
+	record := slog.NewRecord(t, level, msg, 0)
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		switch key {
+		case slog.TimeKey, slog.LevelKey, slog.MessageKey:
+			continue
+		case "cmd_id":
+			record.AddAttrs(redactAttr(jsonAttr("child_cmd_id", fields[key])))
+		default:
+			record.AddAttrs(redactAttr(jsonAttr(key, fields[key])))
+		}
+	}
+	return record, true
+}
+
+// jsonAttr converts a decoded JSON value to an attribute, objects become groups so that the
+// redaction policy applies to their keys.
+func jsonAttr(key string, v any) slog.Attr {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return slog.Any(key, v)
+	}
+
+	attrs := make([]slog.Attr, 0, len(obj))
+	for _, k := range slices.Sorted(maps.Keys(obj)) {
+		attrs = append(attrs, jsonAttr(k, obj[k]))
+	}
+	return slog.Attr{Key: key, Value: slog.GroupValue(attrs...)}
+}
@@ -0,0 +1,103 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debug
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardLogs(t *testing.T) {
+	// forward forwards the child output and returns the forwarded records.
+	forward := func(t *testing.T, r io.Reader, level slog.Level) []map[string]any {
+		buf := &bytes.Buffer{}
+		logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: level})).With("cmd_id", "router_com")
+		require.NoError(t, ForwardLogs(context.Background(), r, logger))
+
+		var records []map[string]any
+		dec := json.NewDecoder(buf)
+		for dec.More() {
+			var record map[string]any
+			require.NoError(t, dec.Decode(&record))
+			records = append(records, record)
+		}
+		return records
+	}
+
+	t.Run("ok, json records are forwarded", func(t *testing.T) {
+		output := `{"time":"2025-06-01T10:00:00.123456789Z","level":"INFO","msg":"Compute worker started","cmd_id":"compute_worker","model":"llama3.2:1b","source":{"function":"main.main","file":"main.go","line":42}}
+{"time":"2025-06-01T10:00:01Z","level":"WARN","msg":"Slow backend","duration_ms":1500}
+`
+		records := forward(t, iotest.OneByteReader(strings.NewReader(output)), slog.LevelInfo)
+		require.Len(t, records, 2)
+
+		require.Equal(t, "2025-06-01T10:00:00.123456789Z", records[0]["time"])
+		require.Equal(t, "INFO", records[0]["level"])
+		require.Equal(t, "Compute worker started", records[0]["msg"])
+		require.Equal(t, "router_com", records[0]["cmd_id"])
+		require.Equal(t, "compute_worker", records[0]["child_cmd_id"])
+		require.Equal(t, "llama3.2:1b", records[0]["model"])
+		require.Equal(t, map[string]any{"function": "main.main", "file": "main.go", "line": float64(42)}, records[0]["source"])
+
+		require.Equal(t, "WARN", records[1]["level"])
+		require.Equal(t, float64(1500), records[1]["duration_ms"])
+	})
+
+	t.Run("ok, sensitive attributes are redacted", func(t *testing.T) {
+		output := `{"time":"2025-06-01T10:00:00Z","level":"ERROR","msg":"Failed","prompt":"secret-prompt","req":{"Body":"secret-body","path":"/api/chat"}}`
+		records := forward(t, strings.NewReader(output), slog.LevelInfo)
+		require.Len(t, records, 1)
+		require.Equal(t, redacted, records[0]["prompt"])
+		require.Equal(t, map[string]any{"Body": redacted, "path": "/api/chat"}, records[0]["req"])
+	})
+
+	t.Run("ok, records below the level are dropped", func(t *testing.T) {
+		output := `{"time":"2025-06-01T10:00:00Z","level":"DEBUG","msg":"Decapsulated request"}`
+		require.Empty(t, forward(t, strings.NewReader(output), slog.LevelInfo))
+	})
+
+	t.Run("ok, unstructured output is truncated", func(t *testing.T) {
+		output := "panic: runtime error: index out of range\n\n" +
+			`{"level":"INFO","msg":"missing time"}` + "\n" +
+			`{"time":"2025-06-01T10:00:00Z","msg":"missing level"}` + "\n" +
+			strings.Repeat("a", maxForwardedLine+10) + "\n" +
+			strings.Repeat("b", maxUnstructuredOutput+1)
+		records := forward(t, strings.NewReader(output), slog.LevelInfo)
+		require.Len(t, records, 5)
+
+		require.Equal(t, "WARN", records[0]["level"])
+		require.Equal(t, "panic: runtime error: index out of range", records[0]["output"])
+		require.Equal(t, false, records[0]["truncated"])
+
+		require.Equal(t, "missing time", records[1]["msg"])
+		require.Equal(t, `{"time":"2025-06-01T10:00:00Z","msg":"missing level"}`, records[2]["output"])
+
+		require.Equal(t, strings.Repeat("a", maxUnstructuredOutput), records[3]["output"])
+		require.Equal(t, true, records[3]["truncated"])
+		require.Equal(t, strings.Repeat("b", maxUnstructuredOutput), records[4]["output"])
+		require.Equal(t, true, records[4]["truncated"])
+	})
+}
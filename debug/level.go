@@ -0,0 +1,118 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debug
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// levelOverride is the runtime log level override shared by all loggers created by SetupLog.
+var levelOverride struct {
+	mu    sync.RWMutex
+	set   bool
+	level slog.Level
+}
+
+// SetLevel overrides the log level at runtime, taking precedence over GO_LOG.
+func SetLevel(level slog.Level) {
+	levelOverride.mu.Lock()
+	defer levelOverride.mu.Unlock()
+	levelOverride.set = true
+	levelOverride.level = level
+}
+
+// ResetLevel removes the runtime log level override, the level from GO_LOG applies again.
+func ResetLevel() {
+	levelOverride.mu.Lock()
+	defer levelOverride.mu.Unlock()
+	levelOverride.set = false
+}
+
+// Level returns the runtime log level override, if any.
+func Level() (slog.Level, bool) {
+	levelOverride.mu.RLock()
+	defer levelOverride.mu.RUnlock()
+	return levelOverride.level, levelOverride.set
+}
+
+// HandleLevelSignal toggles the runtime log level between Debug and the GO_LOG level
+// whenever the process receives SIGUSR1, until ctx is done.
+func HandleLevelSignal(ctx context.Context) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1)
+	go func() {
+		defer signal.Stop(sigs)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sigs:
+				if _, ok := Level(); ok {
+					ResetLevel()
+					slog.Info("Log level override removed")
+				} else {
+					SetLevel(slog.LevelDebug)
+					slog.Info("Log level overridden", "level", slog.LevelDebug)
+				}
+			}
+		}
+	}()
+}
+
+// levelHandler routes records to the GO_LOG filtered handler, unless the log level is
+// overridden at runtime. Then records are filtered by the override level only.
+type levelHandler struct {
+	env  slog.Handler
+	base slog.Handler
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if override, ok := Level(); ok {
+		return level >= override
+	}
+	return h.env.Enabled(ctx, level)
+}
+
+func (h *levelHandler) Handle(ctx context.Context, record slog.Record) error {
+	if override, ok := Level(); ok {
+		if record.Level < override {
+			return nil
+		}
+		return h.base.Handle(ctx, record)
+	}
+	return h.env.Handle(ctx, record)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{
+		env:  h.env.WithAttrs(attrs),
+		base: h.base.WithAttrs(attrs),
+	}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{
+		env:  h.env.WithGroup(name),
+		base: h.base.WithGroup(name),
+	}
+}
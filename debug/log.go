@@ -82,16 +82,22 @@ func setupLogHelper(cmdID string, defaultLogLevel slog.Level, defaultLogFormat s
 
 	switch format {
 	case "text":
-		handler = slogenv.NewHandler(tint.NewHandler(os.Stderr, &tint.Options{
+		handler = tint.NewHandler(os.Stderr, &tint.Options{
 			TimeFormat:  time.TimeOnly,
 			ReplaceAttr: handlerOptions.ReplaceAttr,
 			AddSource:   handlerOptions.AddSource,
 			NoColor:     !isatty.IsTerminal(os.Stderr.Fd()),
-		}), slogenvOptions...)
+		})
 	case "json":
-		handler = slogenv.NewHandler(slog.NewJSONHandler(os.Stderr, &handlerOptions), slogenvOptions...)
+		handler = slog.NewJSONHandler(os.Stderr, &handlerOptions)
 	default:
-		handler = slogenv.NewHandler(slog.NewTextHandler(os.Stderr, &handlerOptions), slogenvOptions...)
+		handler = slog.NewTextHandler(os.Stderr, &handlerOptions)
+	}
+
+	// the level can be overridden at runtime, see SetLevel.
+	handler = &levelHandler{
+		env:  slogenv.NewHandler(handler, slogenvOptions...),
+		base: handler,
 	}
 
 	var logLevel string
@@ -103,8 +109,13 @@ func setupLogHelper(cmdID string, defaultLogLevel slog.Level, defaultLogFormat s
 		logLevel = defaultLogLevel.String()
 	}
 
+	handler = &requestIDHandler{inner: handler}
+
 	handler = otelutil.NewSlogHandler(handler)
 
+	// redact last, so no handler ever sees client data or secrets.
+	handler = &redactHandler{inner: handler}
+
 	logger := slog.New(handler).With("cmd_id", cmdID).With(globalAttrs...)
 	slog.SetDefault(logger)
 	slog.Debug("setting up log", "format", format, "level", logLevel)
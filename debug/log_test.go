@@ -0,0 +1,143 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debug
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactHandler(t *testing.T) {
+	newLogger := func() (*slog.Logger, *bytes.Buffer) {
+		buf := &bytes.Buffer{}
+		handler := slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+		return slog.New(&redactHandler{inner: handler}), buf
+	}
+
+	tests := map[string]func(logger *slog.Logger){
+		"sensitive key": func(logger *slog.Logger) {
+			logger.Debug("msg", "badge", "secret-badge")
+		},
+		"sensitive key is case insensitive": func(logger *slog.Logger) {
+			logger.Debug("msg", "Encapsulated_Key", "secret-key")
+		},
+		"sensitive key in group": func(logger *slog.Logger) {
+			logger.Debug("msg", slog.Group("req", slog.String("body", "secret-body")))
+		},
+		"sensitive key in logger attrs": func(logger *slog.Logger) {
+			logger.With("prompt", "secret-prompt").Debug("msg")
+		},
+		"raw bytes": func(logger *slog.Logger) {
+			logger.Debug("msg", "data", []byte("secret-bytes"))
+		},
+		"sensitive value": func(logger *slog.Logger) {
+			logger.Debug("msg", "value", Sensitive{Value: "secret-value"})
+		},
+		"sensitive key in error": func(logger *slog.Logger) {
+			logger.Debug("msg", "error", errors.New(`upstream rejected {"prompt":"secret \"prompt\""}`))
+		},
+		"sensitive key in string value": func(logger *slog.Logger) {
+			logger.Debug("msg", "detail", "invalid badge=secret-badge, retrying")
+		},
+		"bearer token in error": func(logger *slog.Logger) {
+			logger.Debug("msg", "error", errors.New("request failed: Authorization: Bearer secret.token"))
+		},
+		"key material in message": func(logger *slog.Logger) {
+			logger.Debug("failed to open q3Xv9Lk2secretBn8Rt5Yw1Zp7Hc4Jd6Mf0Ga2Se8U=")
+		},
+	}
+
+	for name, logFunc := range tests {
+		t.Run(name, func(t *testing.T) {
+			logger, buf := newLogger()
+			logFunc(logger)
+			require.NotContains(t, buf.String(), "secret")
+			require.Contains(t, buf.String(), redacted)
+		})
+	}
+
+	t.Run("ok, other attributes are kept", func(t *testing.T) {
+		logger, buf := newLogger()
+		logger.Info("msg", "model", "llama3.2:1b")
+		require.Contains(t, buf.String(), "llama3.2:1b")
+	})
+
+	t.Run("ok, digests and paths are kept", func(t *testing.T) {
+		digest := strings.Repeat("ab", 32)
+		path := "/usr/share/ollama/models/manifests/registry"
+		logger, buf := newLogger()
+		logger.Info("pulled sha256:"+digest, "error", errors.New("digest mismatch: "+digest), "path", path)
+		require.Equal(t, 2, strings.Count(buf.String(), digest))
+		require.Contains(t, buf.String(), path)
+		require.NotContains(t, buf.String(), redacted)
+	})
+}
+
+func TestLevelOverride(t *testing.T) {
+	t.Cleanup(ResetLevel)
+
+	buf := &bytes.Buffer{}
+	base := slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	env := slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelInfo})
+	logger := slog.New(&levelHandler{env: env, base: base})
+
+	logger.Debug("before override")
+	require.NotContains(t, buf.String(), "before override")
+
+	SetLevel(slog.LevelDebug)
+	require.True(t, logger.Enabled(context.Background(), slog.LevelDebug))
+	logger.Debug("during override")
+	require.Contains(t, buf.String(), "during override")
+
+	ResetLevel()
+	logger.Debug("after override")
+	require.NotContains(t, buf.String(), "after override")
+}
+
+func TestRequestIDHandler(t *testing.T) {
+	newLogger := func() (*slog.Logger, *bytes.Buffer) {
+		buf := &bytes.Buffer{}
+		handler := slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+		return slog.New(&requestIDHandler{inner: handler}), buf
+	}
+
+	t.Run("ok, request id from context is added", func(t *testing.T) {
+		logger, buf := newLogger()
+		logger.InfoContext(WithRequestID(context.Background(), "req-1"), "msg")
+		require.Contains(t, buf.String(), `"node_request_id":"req-1"`)
+	})
+
+	t.Run("ok, no request id without context", func(t *testing.T) {
+		logger, buf := newLogger()
+		logger.Info("msg")
+		require.NotContains(t, buf.String(), RequestIDKey)
+	})
+
+	t.Run("ok, existing request id is not duplicated", func(t *testing.T) {
+		logger, buf := newLogger()
+		logger.InfoContext(WithRequestID(context.Background(), "req-1"), "msg", RequestIDKey, "req-2")
+		require.Equal(t, 1, strings.Count(buf.String(), RequestIDKey))
+		require.Contains(t, buf.String(), `"node_request_id":"req-2"`)
+	})
+}
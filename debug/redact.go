@@ -0,0 +1,162 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debug
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// redactedKeys are attribute keys that may contain client data or secrets. Their values are
+// never logged, regardless of log level.
+var redactedKeys = map[string]struct{}{
+	"body":             {},
+	"request_body":     {},
+	"response_body":    {},
+	"plaintext":        {},
+	"ciphertext":       {},
+	"prompt":           {},
+	"messages":         {},
+	"badge":            {},
+	"credentials":      {},
+	"encapsulated_key": {},
+	"encap_key":        {},
+	"authorization":    {},
+}
+
+// minSecretBlobLen is the length from which a base64 run in free text is treated as key material,
+// e.g. an encapsulated key or a badge. Runs that don't mix digits and both letter cases, such as
+// hex digests, trace ids and paths, are kept.
+const minSecretBlobLen = 32
+
+var (
+	// bearerPattern matches bearer tokens, e.g. in a logged header or an upstream error.
+	bearerPattern = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]+`)
+	// keyValuePattern matches sensitive keys embedded in free text, e.g. `badge=...` or
+	// `"prompt":"..."` in an error that echoes a request.
+	keyValuePattern = regexp.MustCompile(`(?i)("?\b(?:` + strings.Join(slices.Sorted(maps.Keys(redactedKeys)), "|") +
+		`)"?\s*[:=]\s*)("(?:[^"\\]|\\.)*"|[^\s,;]+)`)
+	blobPattern = regexp.MustCompile(`[A-Za-z0-9+/_-]{` + strconv.Itoa(minSecretBlobLen) + `,}={0,2}`)
+)
+
+// Sensitive wraps a value that must never be logged.
+type Sensitive struct {
+	Value any
+}
+
+// LogValue implements slog.LogValuer.
+func (Sensitive) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+// redactString redacts secrets in free text, such as a log message or an error string.
+func redactString(s string) string {
+	s = bearerPattern.ReplaceAllString(s, redacted)
+	s = keyValuePattern.ReplaceAllString(s, "${1}"+redacted)
+	return blobPattern.ReplaceAllStringFunc(s, func(blob string) string {
+		if !isMixedCase(blob) {
+			return blob
+		}
+		return redacted
+	})
+}
+
+func isMixedCase(s string) bool {
+	var digit, upper, lower bool
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			digit = true
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		}
+	}
+	return digit && upper && lower
+}
+
+// redactAttr redacts attributes with sensitive keys and any raw byte values, which are
+// typically request or response bodies. Secrets in string and error values are redacted
+// by redactString.
+func redactAttr(a slog.Attr) slog.Attr {
+	if _, ok := redactedKeys[strings.ToLower(a.Key)]; ok {
+		return slog.String(a.Key, redacted)
+	}
+
+	v := a.Value.Resolve()
+	switch v.Kind() { //nolint:exhaustive
+	case slog.KindGroup:
+		attrs := v.Group()
+		out := make([]slog.Attr, 0, len(attrs))
+		for _, attr := range attrs {
+			out = append(out, redactAttr(attr))
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(out...)}
+	case slog.KindString:
+		return slog.String(a.Key, redactString(v.String()))
+	case slog.KindAny:
+		switch val := v.Any().(type) {
+		case []byte:
+			return slog.String(a.Key, fmt.Sprintf("%s %d bytes", redacted, len(val)))
+		case error:
+			return slog.String(a.Key, redactString(val.Error()))
+		}
+	}
+
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// redactHandler applies the redaction policy before records reach any other handler,
+// including the otel handler that copies records to spans.
+type redactHandler struct {
+	inner slog.Handler
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, record slog.Record) error {
+	out := slog.NewRecord(record.Time, record.Level, redactString(record.Message), record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.inner.Handle(ctx, out)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make([]slog.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		out = append(out, redactAttr(attr))
+	}
+	return &redactHandler{inner: h.inner.WithAttrs(out)}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{inner: h.inner.WithGroup(name)}
+}
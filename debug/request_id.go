@@ -0,0 +1,79 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package debug
+
+import (
+	"context"
+	"log/slog"
+)
+
+// RequestIDKey is the log attribute that holds the confsec request ID minted by router_com.
+const RequestIDKey = "node_request_id"
+
+type requestIDContextKey struct{}
+
+// WithRequestID returns a context whose log records carry the confsec request ID, so node logs
+// can be correlated with a single request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+// RequestID returns the confsec request ID of the context, or an empty string if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// requestIDHandler adds the request ID of the context to records that don't carry one yet.
+// Forwarded compute_worker records already carry the ID of their request.
+type requestIDHandler struct {
+	inner slog.Handler
+}
+
+func (h *requestIDHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *requestIDHandler) Handle(ctx context.Context, record slog.Record) error {
+	id := RequestID(ctx)
+	if id == "" {
+		return h.inner.Handle(ctx, record)
+	}
+
+	found := false
+	record.Attrs(func(a slog.Attr) bool {
+		found = a.Key == RequestIDKey
+		return !found
+	})
+	if !found {
+		record = record.Clone()
+		record.AddAttrs(slog.String(RequestIDKey, id))
+	}
+	return h.inner.Handle(ctx, record)
+}
+
+func (h *requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &requestIDHandler{inner: h.inner.WithAttrs(attrs)}
+}
+
+func (h *requestIDHandler) WithGroup(name string) slog.Handler {
+	return &requestIDHandler{inner: h.inner.WithGroup(name)}
+}
@@ -0,0 +1,64 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package experimental gates the experimental surfaces of a node. Experimental routes are only
+// served by binaries built with the experimental build tag, and only when compute_boot discloses
+// them in the evidence and router_com advertises them, so verifier policy can tell nodes with
+// experimental surfaces from stable ones.
+package experimental
+
+import (
+	"fmt"
+	"slices"
+)
+
+// BuildTag is the build tag that compiles in the experimental surfaces.
+const BuildTag = "experimental"
+
+// ResponsesRoute is the OpenAI Responses API. Only stateless, non-streaming requests are served.
+const ResponsesRoute = "/v1/responses"
+
+// Routes are the experimental routes a node can enable.
+var Routes = []string{ResponsesRoute}
+
+// Built reports whether the binary was built with BuildTag.
+func Built() bool {
+	return built
+}
+
+// ValidateRoutes checks that routes are known experimental routes, listed once.
+func ValidateRoutes(routes []string) error {
+	seen := map[string]bool{}
+	for _, route := range routes {
+		if !slices.Contains(Routes, route) {
+			return fmt.Errorf("unknown experimental route %q", route)
+		}
+		if seen[route] {
+			return fmt.Errorf("duplicate experimental route %q", route)
+		}
+		seen[route] = true
+	}
+	return nil
+}
+
+// CheckBuild checks that this binary can serve routes, which requires a build with BuildTag.
+func CheckBuild(routes []string) error {
+	if len(routes) > 0 && !built {
+		return fmt.Errorf("experimental routes require a build with the %s build tag", BuildTag)
+	}
+	return ValidateRoutes(routes)
+}
@@ -0,0 +1,45 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build faultinject
+
+package faultinject
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// EnvVar holds a JSON Config that is enabled at startup in binaries built with the faultinject
+// build tag. Child processes, like compute_worker, inherit it.
+const EnvVar = "CONFSEC_FAULT_INJECTION"
+
+func init() {
+	v := os.Getenv(EnvVar)
+	if v == "" {
+		return
+	}
+
+	cfg := &Config{}
+	if err := json.Unmarshal([]byte(v), cfg); err != nil {
+		panic(fmt.Sprintf("invalid %s: %v", EnvVar, err))
+	}
+	if err := Enable(cfg); err != nil {
+		panic(fmt.Sprintf("invalid %s: %v", EnvVar, err))
+	}
+}
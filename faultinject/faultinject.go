@@ -0,0 +1,156 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package faultinject injects failures at named points of router_com and compute_worker, to
+// test the resilience of the full pipeline. Faults are never injected unless they were enabled
+// with explicit config, or with the CONFSEC_FAULT_INJECTION environment variable in binaries
+// built with the faultinject build tag.
+package faultinject
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	mrand "math/rand/v2"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// Point names a place in the pipeline where faults can be injected.
+type Point string
+
+const (
+	// EvidenceReceive fails router_com receiving the evidence from compute_boot.
+	EvidenceReceive Point = "evidence_receive"
+	// WorkerSpawn fails router_com starting a compute_worker.
+	WorkerSpawn Point = "worker_spawn"
+	// TPMOpen fails compute_worker opening the TPM.
+	TPMOpen Point = "tpm_open"
+	// BackendDial fails compute_worker sending the request to the LLM backend.
+	BackendDial Point = "backend_dial"
+	// FooterWrite fails compute_worker writing the output footer.
+	FooterWrite Point = "footer_write"
+)
+
+var points = []Point{EvidenceReceive, WorkerSpawn, TPMOpen, BackendDial, FooterWrite}
+
+// ErrInjected is the error returned for injected faults.
+var ErrInjected = errors.New("injected fault")
+
+// Config is config for fault injection. It is also passed to compute_worker as JSON.
+type Config struct {
+	Faults []Fault `yaml:"faults" json:"faults"`
+}
+
+// Fault is a fault injected at a point.
+type Fault struct {
+	Point Point `yaml:"point" json:"point"`
+	// Rate is the fraction of calls the fault is injected in, in (0, 1]. 0 injects the fault in
+	// every call.
+	Rate float64 `yaml:"rate" json:"rate,omitempty"`
+	// Delay delays the call before the fault is injected.
+	Delay time.Duration `yaml:"delay" json:"delay,omitempty"`
+	// DelayOnly only delays the call, without failing it.
+	DelayOnly bool `yaml:"delay_only" json:"delay_only,omitempty"`
+}
+
+func (c *Config) Validate() error {
+	for _, f := range c.Faults {
+		if !slices.Contains(points, f.Point) {
+			return fmt.Errorf("unknown fault injection point: %q", f.Point)
+		}
+		if f.Rate < 0 || f.Rate > 1 {
+			return fmt.Errorf("fault injection rate for %s must be in [0, 1], got %v", f.Point, f.Rate)
+		}
+		if f.Delay < 0 {
+			return fmt.Errorf("fault injection delay for %s can't be negative", f.Point)
+		}
+		if f.DelayOnly && f.Delay == 0 {
+			return fmt.Errorf("delay only fault for %s has no delay", f.Point)
+		}
+	}
+	return nil
+}
+
+// active are the enabled faults by point, nil when fault injection is disabled.
+var active atomic.Pointer[map[Point]Fault]
+
+// Enable enables the faults in cfg, replacing any faults enabled before. A nil or empty config
+// disables fault injection.
+func Enable(cfg *Config) error {
+	if cfg == nil || len(cfg.Faults) == 0 {
+		Disable()
+		return nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	faults := make(map[Point]Fault, len(cfg.Faults))
+	for _, f := range cfg.Faults {
+		faults[f.Point] = f
+	}
+	active.Store(&faults)
+
+	slog.Warn("Fault injection enabled, this node is not fit for production traffic", "faults", len(faults))
+	return nil
+}
+
+// Disable disables fault injection.
+func Disable() {
+	active.Store(nil)
+}
+
+// Enabled reports whether any faults are enabled.
+func Enabled() bool {
+	return active.Load() != nil
+}
+
+// Inject returns an error wrapping ErrInjected when a fault is injected at point, nil otherwise.
+// Injected delays are cut short when ctx is done.
+func Inject(ctx context.Context, point Point) error {
+	faults := active.Load()
+	if faults == nil {
+		return nil
+	}
+	f, ok := (*faults)[point]
+	if !ok {
+		return nil
+	}
+
+	if f.Rate > 0 && mrand.Float64() >= f.Rate { // #nosec G404 -- fault sampling, not used for secrets.
+		return nil
+	}
+
+	slog.WarnContext(ctx, "Injecting fault", "point", point, "delay", f.Delay, "delay_only", f.DelayOnly)
+	if f.Delay > 0 {
+		timer := time.NewTimer(f.Delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	if f.DelayOnly {
+		return nil
+	}
+	return fmt.Errorf("%w at %s", ErrInjected, point)
+}
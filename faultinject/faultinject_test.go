@@ -0,0 +1,102 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package faultinject
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInject(t *testing.T) {
+	t.Cleanup(Disable)
+
+	t.Run("ok, disabled by default", func(t *testing.T) {
+		require.False(t, Enabled())
+		for _, point := range points {
+			require.NoError(t, Inject(t.Context(), point))
+		}
+	})
+
+	t.Run("ok, fault is injected at its point only", func(t *testing.T) {
+		require.NoError(t, Enable(&Config{Faults: []Fault{{Point: TPMOpen}}}))
+		require.True(t, Enabled())
+
+		err := Inject(t.Context(), TPMOpen)
+		require.ErrorIs(t, err, ErrInjected)
+		require.ErrorContains(t, err, "tpm_open")
+		require.NoError(t, Inject(t.Context(), BackendDial))
+	})
+
+	t.Run("ok, delay only fault", func(t *testing.T) {
+		require.NoError(t, Enable(&Config{Faults: []Fault{{Point: FooterWrite, Delay: 10 * time.Millisecond, DelayOnly: true}}}))
+
+		start := time.Now()
+		require.NoError(t, Inject(t.Context(), FooterWrite))
+		require.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+	})
+
+	t.Run("ok, delay is cut short by the context", func(t *testing.T) {
+		require.NoError(t, Enable(&Config{Faults: []Fault{{Point: WorkerSpawn, Delay: time.Hour}}}))
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		require.ErrorIs(t, Inject(ctx, WorkerSpawn), context.Canceled)
+	})
+
+	t.Run("ok, rate samples calls", func(t *testing.T) {
+		require.NoError(t, Enable(&Config{Faults: []Fault{{Point: BackendDial, Rate: 0.5}}}))
+
+		injected := 0
+		for range 1000 {
+			if Inject(t.Context(), BackendDial) != nil {
+				injected++
+			}
+		}
+		require.Greater(t, injected, 300)
+		require.Less(t, injected, 700)
+	})
+
+	t.Run("ok, empty config disables fault injection", func(t *testing.T) {
+		require.NoError(t, Enable(&Config{Faults: []Fault{{Point: TPMOpen}}}))
+		require.NoError(t, Enable(&Config{}))
+		require.False(t, Enabled())
+		require.NoError(t, Inject(t.Context(), TPMOpen))
+	})
+}
+
+func TestConfigValidate(t *testing.T) {
+	testCases := map[string]Fault{
+		"unknown point":       {Point: "disk_full"},
+		"negative rate":       {Point: TPMOpen, Rate: -0.1},
+		"rate above one":      {Point: TPMOpen, Rate: 1.5},
+		"negative delay":      {Point: TPMOpen, Delay: -time.Second},
+		"delay only no delay": {Point: TPMOpen, DelayOnly: true},
+	}
+
+	for name, fault := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cfg := &Config{Faults: []Fault{fault}}
+			require.Error(t, cfg.Validate())
+			require.Error(t, Enable(cfg))
+			require.False(t, Enabled())
+		})
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package listen configures the addresses of the local APIs of the node, so the same config
+// selects a unix socket, a tcp address or a vsock port for each of them.
+package listen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Network is the kind of socket a Config listens on.
+type Network string
+
+const (
+	// Unix listens on a unix socket, Address is its path.
+	Unix Network = "unix"
+	// TCP listens on a tcp address, Address is host:port. An empty host, or [::], listens on IPv4
+	// and IPv6.
+	TCP Network = "tcp"
+	// VSock listens on a vsock port, Address is cid:port. Only supported on linux.
+	VSock Network = "vsock"
+)
+
+// Config is where a service listens, or where its clients dial.
+type Config struct {
+	// Network is unix, tcp or vsock.
+	Network Network `yaml:"network"`
+	// Address is the socket path for unix, host:port for tcp and cid:port for vsock.
+	Address string `yaml:"address"`
+	// Mode are the permissions of a unix socket, e.g. 0600. Leave 0 to keep the permissions of the umask.
+	Mode os.FileMode `yaml:"mode"`
+}
+
+// UnixSocket returns the config of a unix socket at path with the given permissions.
+func UnixSocket(path string, mode os.FileMode) Config {
+	return Config{Network: Unix, Address: path, Mode: mode}
+}
+
+// Parse parses a config from network:address, e.g. unix:/run/admin.sock, tcp:[::1]:6066 or
+// vsock:3:1024. Used where structured config isn't available, like environment variables.
+func Parse(s string) (Config, error) {
+	network, address, ok := strings.Cut(s, ":")
+	if !ok {
+		return Config{}, fmt.Errorf("invalid listen address %q: missing network", s)
+	}
+	c := Config{Network: Network(network), Address: address}
+	if err := c.Validate(); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+func (c Config) String() string {
+	return string(c.Network) + ":" + c.Address
+}
+
+// Validate checks the address is valid for the network.
+func (c Config) Validate() error {
+	switch c.Network {
+	case Unix:
+		if c.Address == "" {
+			return errors.New("missing unix socket path")
+		}
+	case TCP:
+		if _, _, err := net.SplitHostPort(c.Address); err != nil {
+			return fmt.Errorf("invalid tcp address: %w", err)
+		}
+	case VSock:
+		if _, _, err := parseVSockAddr(c.Address); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown network: %q", c.Network)
+	}
+	if c.Mode != 0 && c.Network != Unix {
+		return fmt.Errorf("mode is only supported for unix sockets, not %s", c.Network)
+	}
+	return nil
+}
+
+// Local reports whether only processes on this machine can connect. Unix sockets and tcp
+// loopback addresses are local, a vsock port can be reached from the host of the VM.
+func (c Config) Local() bool {
+	switch c.Network {
+	case Unix:
+		return true
+	case TCP:
+		host, _, err := net.SplitHostPort(c.Address)
+		if err != nil {
+			return false
+		}
+		if host == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	default:
+		return false
+	}
+}
+
+// CheckPrivate checks the address is fit for an unauthenticated API like the admin API or the
+// profiler: a unix socket with explicit permissions in a directory other users can't write to, or a
+// tcp loopback address. vsock ports are rejected, the host of the VM can reach them.
+func (c Config) CheckPrivate() error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	switch c.Network {
+	case Unix:
+		if c.Mode == 0 {
+			return fmt.Errorf("unix socket %s must have a mode", c.Address)
+		}
+		// in a world writable directory like /tmp, another user could put their own socket in place.
+		dir := filepath.Dir(c.Address)
+		info, err := os.Stat(dir)
+		if err != nil {
+			return fmt.Errorf("failed to stat socket directory: %w", err)
+		}
+		if info.Mode().Perm()&0o002 != 0 {
+			return fmt.Errorf("socket directory %s is world writable", dir)
+		}
+		return nil
+	case TCP:
+		if !c.Local() {
+			return fmt.Errorf("can't listen on non-loopback address %s", c.Address)
+		}
+		return nil
+	default:
+		return fmt.Errorf("can't listen on %s, only unix and loopback tcp addresses are private", c.Network)
+	}
+}
+
+// Listen listens on the address. A stale unix socket is removed first, anything else at the path of
+// a unix socket is an error.
+func (c Config) Listen() (net.Listener, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch c.Network {
+	case Unix:
+		return listenUnix(c.Address, c.Mode)
+	case TCP:
+		return net.Listen("tcp", c.Address)
+	default:
+		cid, port, err := parseVSockAddr(c.Address)
+		if err != nil {
+			return nil, err
+		}
+		return listenVSock(cid, port)
+	}
+}
+
+// Dial connects to the address.
+func (c Config) Dial(ctx context.Context) (net.Conn, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch c.Network {
+	case Unix, TCP:
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, string(c.Network), c.Address)
+	default:
+		cid, port, err := parseVSockAddr(c.Address)
+		if err != nil {
+			return nil, err
+		}
+		return dialVSock(ctx, cid, port)
+	}
+}
+
+func parseVSockAddr(address string) (uint32, uint32, error) {
+	cidStr, portStr, ok := strings.Cut(address, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid vsock address %q: want cid:port", address)
+	}
+	cid, err := strconv.ParseUint(cidStr, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid vsock cid: %w", err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid vsock port: %w", err)
+	}
+	return uint32(cid), uint32(port), nil
+}
+
+// vsockAddr is the address of a vsock socket.
+type vsockAddr struct {
+	cid  uint32
+	port uint32
+}
+
+func (a vsockAddr) Network() string {
+	return string(VSock)
+}
+
+func (a vsockAddr) String() string {
+	return strconv.FormatUint(uint64(a.cid), 10) + ":" + strconv.FormatUint(uint64(a.port), 10)
+}
@@ -0,0 +1,194 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package listen_test
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/confidentsecurity/confidentcompute/listen"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		value   string
+		want    listen.Config
+		wantErr bool
+	}{
+		"ok, unix":         {value: "unix:/run/admin.sock", want: listen.Config{Network: listen.Unix, Address: "/run/admin.sock"}},
+		"ok, tcp ipv6":     {value: "tcp:[::1]:6066", want: listen.Config{Network: listen.TCP, Address: "[::1]:6066"}},
+		"ok, tcp any":      {value: "tcp::6066", want: listen.Config{Network: listen.TCP, Address: ":6066"}},
+		"ok, vsock":        {value: "vsock:3:1024", want: listen.Config{Network: listen.VSock, Address: "3:1024"}},
+		"fail, no network": {value: "/run/admin.sock", wantErr: true},
+		"fail, unknown":    {value: "udp:127.0.0.1:53", wantErr: true},
+		"fail, empty unix": {value: "unix:", wantErr: true},
+		"fail, tcp port":   {value: "tcp:localhost", wantErr: true},
+		"fail, vsock cid":  {value: "vsock:host:1024", wantErr: true},
+		"fail, vsock port": {value: "vsock:3", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := listen.Parse(tc.value)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+			require.Equal(t, tc.value, got.String())
+		})
+	}
+
+	t.Run("fail, mode of a tcp address", func(t *testing.T) {
+		require.Error(t, listen.Config{Network: listen.TCP, Address: ":80", Mode: 0o600}.Validate())
+	})
+}
+
+func TestConfigLocal(t *testing.T) {
+	require.True(t, listen.UnixSocket("/run/admin.sock", 0).Local())
+	require.True(t, listen.Config{Network: listen.TCP, Address: "127.0.0.1:80"}.Local())
+	require.True(t, listen.Config{Network: listen.TCP, Address: "[::1]:80"}.Local())
+	require.True(t, listen.Config{Network: listen.TCP, Address: "localhost:80"}.Local())
+	require.False(t, listen.Config{Network: listen.TCP, Address: ":80"}.Local())
+	require.False(t, listen.Config{Network: listen.TCP, Address: "10.0.0.1:80"}.Local())
+	require.False(t, listen.Config{Network: listen.VSock, Address: "3:80"}.Local())
+}
+
+func TestConfigCheckPrivate(t *testing.T) {
+	t.Run("ok, unix socket with mode", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.Chmod(dir, 0o700))
+		require.NoError(t, listen.UnixSocket(filepath.Join(dir, "admin.sock"), 0o600).CheckPrivate())
+	})
+
+	t.Run("ok, tcp loopback", func(t *testing.T) {
+		require.NoError(t, listen.Config{Network: listen.TCP, Address: "localhost:6066"}.CheckPrivate())
+	})
+
+	t.Run("fail, unix socket without mode", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.Chmod(dir, 0o700))
+		require.Error(t, listen.UnixSocket(filepath.Join(dir, "admin.sock"), 0).CheckPrivate())
+	})
+
+	t.Run("fail, unix socket in a world writable directory", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.Chmod(dir, 0o777))
+		require.Error(t, listen.UnixSocket(filepath.Join(dir, "admin.sock"), 0o600).CheckPrivate())
+	})
+
+	t.Run("fail, tcp non-loopback", func(t *testing.T) {
+		require.Error(t, listen.Config{Network: listen.TCP, Address: ":6066"}.CheckPrivate())
+	})
+
+	t.Run("fail, vsock", func(t *testing.T) {
+		require.Error(t, listen.Config{Network: listen.VSock, Address: "3:6066"}.CheckPrivate())
+	})
+}
+
+func TestListenDial(t *testing.T) {
+	roundTrip := func(t *testing.T, cfg listen.Config) {
+		listener, err := cfg.Listen()
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = listener.Close()
+		})
+
+		if cfg.Network == listen.TCP {
+			// the port was picked by the listener.
+			cfg.Address = listener.Addr().String()
+		}
+
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			_, _ = io.Copy(conn, conn)
+		}()
+
+		conn, err := cfg.Dial(t.Context())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_, err = conn.Write([]byte("ping"))
+		require.NoError(t, err)
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		require.Equal(t, "ping", string(buf))
+	}
+
+	t.Run("ok, unix socket with mode", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "test.sock")
+		// a stale socket is replaced.
+		stale, err := net.Listen("unix", socket)
+		require.NoError(t, err)
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		require.NoError(t, stale.Close())
+
+		roundTrip(t, listen.UnixSocket(socket, 0o600))
+
+		info, err := os.Stat(socket)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	t.Run("fail, unix socket path is not a socket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.sock")
+		require.NoError(t, os.WriteFile(path, nil, 0o600))
+
+		_, err := listen.UnixSocket(path, 0o600).Listen()
+		require.Error(t, err)
+		_, err = os.Stat(path)
+		require.NoError(t, err)
+	})
+
+	t.Run("fail, unix socket in use", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "test.sock")
+		listener, err := listen.UnixSocket(socket, 0o600).Listen()
+		require.NoError(t, err)
+		defer listener.Close()
+
+		_, err = listen.UnixSocket(socket, 0o600).Listen()
+		require.Error(t, err)
+	})
+
+	t.Run("ok, tcp", func(t *testing.T) {
+		roundTrip(t, listen.Config{Network: listen.TCP, Address: "127.0.0.1:0"})
+	})
+
+	t.Run("ok, tcp dual-stack", func(t *testing.T) {
+		cfg := listen.Config{Network: listen.TCP, Address: ":0"}
+		listener, err := cfg.Listen()
+		require.NoError(t, err)
+		defer listener.Close()
+
+		_, port, err := net.SplitHostPort(listener.Addr().String())
+		require.NoError(t, err)
+		conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", port))
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+	})
+}
@@ -0,0 +1,140 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package listen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// vsockListener accepts vsock connections. The socket is non-blocking, so Accept waits in the
+// runtime poller and returns when the listener is closed.
+type vsockListener struct {
+	file   *os.File
+	conn   syscall.RawConn
+	addr   vsockAddr
+	closed atomic.Bool
+}
+
+func listenVSock(cid, port uint32) (net.Listener, error) {
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vsock socket: %w", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrVM{CID: cid, Port: port}); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to bind vsock socket: %w", err), unix.Close(fd))
+	}
+	if err := unix.Listen(fd, unix.SOMAXCONN); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to listen on vsock socket: %w", err), unix.Close(fd))
+	}
+
+	file := os.NewFile(uintptr(fd), "vsock")
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return nil, errors.Join(err, file.Close())
+	}
+	return &vsockListener{file: file, conn: conn, addr: vsockAddr{cid: cid, port: port}}, nil
+}
+
+func (l *vsockListener) Accept() (net.Conn, error) {
+	var (
+		nfd       int
+		sa        unix.Sockaddr
+		acceptErr error
+	)
+	err := l.conn.Read(func(fd uintptr) bool {
+		nfd, sa, acceptErr = unix.Accept4(int(fd), unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC)
+		return !errors.Is(acceptErr, unix.EAGAIN)
+	})
+	if l.closed.Load() {
+		// the raw conn reports a closed file, callers check for the error of closed net listeners.
+		return nil, net.ErrClosed
+	}
+	if err != nil {
+		return nil, err
+	}
+	if acceptErr != nil {
+		return nil, fmt.Errorf("failed to accept vsock connection: %w", acceptErr)
+	}
+
+	var remote vsockAddr
+	if vm, ok := sa.(*unix.SockaddrVM); ok {
+		remote = vsockAddr{cid: vm.CID, port: vm.Port}
+	}
+	return &vsockConn{File: os.NewFile(uintptr(nfd), "vsock"), local: l.addr, remote: remote}, nil
+}
+
+func (l *vsockListener) Close() error {
+	l.closed.Store(true)
+	return l.file.Close()
+}
+
+func (l *vsockListener) Addr() net.Addr {
+	return l.addr
+}
+
+// dialVSock connects to a vsock port. The connect itself blocks, the context only bounds it until
+// the connection is set up.
+func dialVSock(ctx context.Context, cid, port uint32) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vsock socket: %w", err)
+	}
+	if err := unix.Connect(fd, &unix.SockaddrVM{CID: cid, Port: port}); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to connect vsock socket: %w", err), unix.Close(fd))
+	}
+	// non-blocking, so the connection supports deadlines.
+	if err := unix.SetNonblock(fd, true); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to set vsock socket non-blocking: %w", err), unix.Close(fd))
+	}
+
+	var local vsockAddr
+	if sa, err := unix.Getsockname(fd); err == nil {
+		if vm, ok := sa.(*unix.SockaddrVM); ok {
+			local = vsockAddr{cid: vm.CID, port: vm.Port}
+		}
+	}
+	return &vsockConn{File: os.NewFile(uintptr(fd), "vsock"), local: local, remote: vsockAddr{cid: cid, port: port}}, nil
+}
+
+// vsockConn is a vsock connection, the file provides reads, writes and deadlines.
+type vsockConn struct {
+	*os.File
+	local  vsockAddr
+	remote vsockAddr
+}
+
+func (c *vsockConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *vsockConn) RemoteAddr() net.Addr {
+	return c.remote
+}
@@ -0,0 +1,198 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockllm
+
+import (
+	"errors"
+	"fmt"
+	mrand "math/rand/v2"
+	"strings"
+	"time"
+)
+
+// Distribution is a distribution of durations, such as the latency before the first token.
+type Distribution struct {
+	Kind DistributionKind
+	// A is the fixed duration, the minimum of a uniform distribution or the mean of a normal distribution.
+	A time.Duration
+	// B is the maximum of a uniform distribution or the standard deviation of a normal distribution.
+	B time.Duration
+}
+
+type DistributionKind string
+
+const (
+	DistributionFixed   DistributionKind = "fixed"
+	DistributionUniform DistributionKind = "uniform"
+	DistributionNormal  DistributionKind = "normal"
+)
+
+// ParseDistribution parses a distribution of durations. It accepts a fixed duration like "100ms",
+// a uniform distribution like "uniform:50ms-200ms" or a normal distribution like "normal:100ms,20ms"
+// where the second duration is the standard deviation.
+func ParseDistribution(s string) (Distribution, error) {
+	kind, params, ok := strings.Cut(s, ":")
+	if !ok {
+		d, err := parseNonNegativeDuration(s)
+		if err != nil {
+			return Distribution{}, err
+		}
+		return Distribution{Kind: DistributionFixed, A: d}, nil
+	}
+
+	var sep string
+	switch DistributionKind(kind) {
+	case DistributionUniform:
+		sep = "-"
+	case DistributionNormal:
+		sep = ","
+	default:
+		return Distribution{}, fmt.Errorf("unknown distribution %q", kind)
+	}
+
+	as, bs, ok := strings.Cut(params, sep)
+	if !ok {
+		return Distribution{}, fmt.Errorf("invalid %s distribution %q", kind, params)
+	}
+	a, err := parseNonNegativeDuration(as)
+	if err != nil {
+		return Distribution{}, err
+	}
+	b, err := parseNonNegativeDuration(bs)
+	if err != nil {
+		return Distribution{}, err
+	}
+	if DistributionKind(kind) == DistributionUniform && b < a {
+		return Distribution{}, fmt.Errorf("invalid uniform distribution, max %s is less than min %s", b, a)
+	}
+
+	return Distribution{Kind: DistributionKind(kind), A: a, B: b}, nil
+}
+
+func parseNonNegativeDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration: %w", err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %s", d)
+	}
+	return d, nil
+}
+
+func (d Distribution) String() string {
+	switch d.Kind {
+	case DistributionUniform:
+		return fmt.Sprintf("uniform:%s-%s", d.A, d.B)
+	case DistributionNormal:
+		return fmt.Sprintf("normal:%s,%s", d.A, d.B)
+	default:
+		return d.A.String()
+	}
+}
+
+// Sample draws a duration from the distribution. Samples of a normal distribution are clamped at 0.
+func (d Distribution) Sample(rnd *mrand.Rand) time.Duration {
+	switch d.Kind {
+	case DistributionUniform:
+		if d.B == d.A {
+			return d.A
+		}
+		return d.A + time.Duration(rnd.Int64N(int64(d.B-d.A)+1))
+	case DistributionNormal:
+		return max(0, d.A+time.Duration(rnd.NormFloat64()*float64(d.B)))
+	default:
+		return d.A
+	}
+}
+
+// MalformedMode is a way in which the mock backend produces malformed output.
+type MalformedMode string
+
+const (
+	// MalformedInvalidJSON truncates a JSON object in the response.
+	MalformedInvalidJSON MalformedMode = "invalid_json"
+	// MalformedContentType responds with a text/html content type.
+	MalformedContentType MalformedMode = "content_type"
+	// MalformedMissingUsage leaves out the token counts that refunds are computed from.
+	MalformedMissingUsage MalformedMode = "missing_usage"
+)
+
+// ParseMalformedMode parses the name of a malformed output mode.
+func ParseMalformedMode(s string) (MalformedMode, error) {
+	switch mode := MalformedMode(s); mode {
+	case MalformedInvalidJSON, MalformedContentType, MalformedMissingUsage:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown malformed mode: %s", s)
+	}
+}
+
+// Config configures the behavior of the mock backend. Rates are fractions of requests in [0, 1].
+type Config struct {
+	// Models are the models the backend serves. Leave empty to serve any model.
+	Models []string
+	// Latency is the delay before the first token.
+	Latency Distribution
+	// TokenRate is the number of output tokens per second. Leave 0 to stream tokens without delay.
+	TokenRate float64
+	// MinTokens and MaxTokens bound the number of output tokens, which is uniformly distributed.
+	// The max tokens of a request lowers the bound.
+	MinTokens int
+	MaxTokens int
+	// FailureRate is the rate of requests that fail with a 500 after the latency.
+	FailureRate float64
+	// AbortRate is the rate of responses that are cut off mid-stream by closing the connection.
+	AbortRate float64
+	// Malformed are the malformed output modes, one of them is picked for malformed responses.
+	Malformed []MalformedMode
+	// MalformedRate is the rate of responses with malformed output.
+	MalformedRate float64
+	// Seed makes the behavior reproducible when non-zero.
+	Seed uint64
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Latency:   Distribution{Kind: DistributionFixed},
+		MinTokens: 1,
+		MaxTokens: 64,
+	}
+}
+
+func (c Config) validate() error {
+	if c.TokenRate < 0 {
+		return fmt.Errorf("invalid token rate: %v", c.TokenRate)
+	}
+	if c.MinTokens < 0 || c.MaxTokens < c.MinTokens {
+		return fmt.Errorf("invalid token bounds: %d-%d", c.MinTokens, c.MaxTokens)
+	}
+	for name, rate := range map[string]float64{
+		"failure":   c.FailureRate,
+		"abort":     c.AbortRate,
+		"malformed": c.MalformedRate,
+	} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("invalid %s rate: %v", name, rate)
+		}
+	}
+	if c.MalformedRate > 0 && len(c.Malformed) == 0 {
+		return errors.New("malformed rate requires at least one malformed mode")
+	}
+	return nil
+}
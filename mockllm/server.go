@@ -0,0 +1,539 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mockllm is an inference backend with Ollama and OpenAI compatible endpoints that
+// generates responses without a model. Latency, token rate, failures and malformed output are
+// configurable, so integration and load tests of router_com and compute_worker can run without
+// a GPU. Not intended for production use.
+package mockllm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	mrand "math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	ollama "github.com/ollama/ollama/api"
+	"github.com/sashabaranov/go-openai"
+)
+
+// words are the output tokens, the content of the responses has no meaning.
+var words = []string{"the", " sky", " is", " blue", " because", " of", " Rayleigh", " scattering", ",", " which", " scatters", " shorter", " wavelengths", " more", "."}
+
+// maxRequestSize bounds the request bodies read by the backend.
+const maxRequestSize = 16 * 1024 * 1024
+
+// Server is the mock inference backend.
+type Server struct {
+	cfg Config
+	mux *http.ServeMux
+
+	mu  sync.Mutex
+	rnd *mrand.Rand
+}
+
+// New creates a mock backend with the given config.
+func New(cfg Config) (*Server, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = mrand.Uint64()
+	}
+
+	s := &Server{
+		cfg: cfg,
+		mux: http.NewServeMux(),
+		rnd: mrand.New(mrand.NewPCG(seed, seed)), // #nosec G404 -- reproducible test behavior, not used for secrets.
+	}
+
+	s.mux.HandleFunc("POST /api/generate", s.ollamaHandler(false))
+	s.mux.HandleFunc("POST /api/chat", s.ollamaHandler(true))
+	s.mux.HandleFunc("GET /api/tags", s.tagsHandler)
+	s.mux.HandleFunc("POST /v1/completions", s.openAIHandler(false))
+	s.mux.HandleFunc("POST /v1/chat/completions", s.openAIHandler(true))
+
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// plan is how the backend responds to a single request.
+type plan struct {
+	latency time.Duration
+	tokens  int
+	fail    bool
+	// abortAt is the number of tokens after which the response is cut off, -1 to not abort.
+	abortAt   int
+	malformed MalformedMode
+}
+
+// plan draws the behavior for a request. maxTokens is the max tokens of the request, 0 if not set.
+func (s *Server) plan(maxTokens int) plan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := plan{
+		latency: s.cfg.Latency.Sample(s.rnd),
+		tokens:  s.cfg.MinTokens + s.rnd.IntN(s.cfg.MaxTokens-s.cfg.MinTokens+1),
+		fail:    s.rnd.Float64() < s.cfg.FailureRate,
+		abortAt: -1,
+	}
+	if maxTokens > 0 {
+		p.tokens = min(p.tokens, maxTokens)
+	}
+	if s.rnd.Float64() < s.cfg.AbortRate {
+		p.abortAt = s.rnd.IntN(p.tokens + 1)
+	}
+	if s.rnd.Float64() < s.cfg.MalformedRate {
+		p.malformed = s.cfg.Malformed[s.rnd.IntN(len(s.cfg.Malformed))]
+	}
+	return p
+}
+
+// request is the part of a request the backend looks at.
+type request struct {
+	model     string
+	prompt    string
+	stream    bool
+	usage     bool
+	maxTokens int
+}
+
+func (s *Server) ollamaHandler(chat bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model    string           `json:"model"`
+			Prompt   string           `json:"prompt"`
+			Messages []ollama.Message `json:"messages"`
+			// Ollama streams unless stream is explicitly false.
+			Stream  *bool `json:"stream"`
+			Options struct {
+				NumPredict int `json:"num_predict"`
+			} `json:"options"`
+		}
+		if !decode(w, r, &body) {
+			return
+		}
+
+		req := request{
+			model:     body.Model,
+			prompt:    body.Prompt,
+			stream:    body.Stream == nil || *body.Stream,
+			usage:     true,
+			maxTokens: body.Options.NumPredict,
+		}
+		for _, m := range body.Messages {
+			req.prompt += m.Content
+		}
+
+		s.respond(w, r, req, &ollamaWriter{chat: chat, model: body.Model, start: time.Now()})
+	}
+}
+
+func (s *Server) openAIHandler(chat bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model               string                         `json:"model"`
+			Prompt              any                            `json:"prompt"`
+			Messages            []openai.ChatCompletionMessage `json:"messages"`
+			Stream              bool                           `json:"stream"`
+			StreamOptions       *openai.StreamOptions          `json:"stream_options"`
+			MaxTokens           int                            `json:"max_tokens"`
+			MaxCompletionTokens int                            `json:"max_completion_tokens"`
+		}
+		if !decode(w, r, &body) {
+			return
+		}
+
+		req := request{
+			model:     body.Model,
+			prompt:    fmt.Sprint(body.Prompt),
+			stream:    body.Stream,
+			usage:     !body.Stream || (body.StreamOptions != nil && body.StreamOptions.IncludeUsage),
+			maxTokens: body.MaxTokens,
+		}
+		if body.MaxCompletionTokens > 0 {
+			req.maxTokens = body.MaxCompletionTokens
+		}
+		for _, m := range body.Messages {
+			req.prompt += m.Content
+		}
+
+		s.respond(w, r, req, &openAIWriter{chat: chat, model: body.Model, created: time.Now().Unix()})
+	}
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func (s *Server) tagsHandler(w http.ResponseWriter, _ *http.Request) {
+	resp := ollama.ListResponse{Models: []ollama.ListModelResponse{}}
+	for _, model := range s.cfg.Models {
+		resp.Models = append(resp.Models, ollama.ListModelResponse{Name: model, Model: model})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("failed to write tags response", "error", err)
+	}
+}
+
+// responseWriter writes the responses of an API flavor.
+type responseWriter interface {
+	contentType(stream bool) string
+	// token returns the streamed chunk for a single token.
+	token(tok string) any
+	// done returns the final streamed chunk.
+	done(tokens, promptTokens int, usage bool) any
+	// complete returns the non-streamed response.
+	complete(output string, tokens, promptTokens int) any
+	// frame frames an encoded streamed chunk, the end marker is framed when chunk is nil.
+	frame(chunk []byte) []byte
+}
+
+func (s *Server) respond(w http.ResponseWriter, r *http.Request, req request, rw responseWriter) {
+	if req.model == "" {
+		writeError(w, http.StatusBadRequest, "model is required")
+		return
+	}
+	if len(s.cfg.Models) > 0 && !slices.Contains(s.cfg.Models, req.model) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("model '%s' not found", req.model))
+		return
+	}
+
+	p := s.plan(req.maxTokens)
+	if !sleep(r.Context(), p.latency) {
+		return
+	}
+	if p.fail {
+		writeError(w, http.StatusInternalServerError, "mock failure")
+		return
+	}
+
+	contentType := rw.contentType(req.stream)
+	if p.malformed == MalformedContentType {
+		contentType = "text/html"
+	}
+	w.Header().Set("Content-Type", contentType)
+
+	// roughly 4 characters per token.
+	promptTokens := len(req.prompt)/4 + 1
+	usage := req.usage && p.malformed != MalformedMissingUsage
+	// the malformed chunk is the chunk halfway through the output.
+	malformedAt := -1
+	if p.malformed == MalformedInvalidJSON {
+		malformedAt = p.tokens / 2
+	}
+
+	if !req.stream {
+		var output strings.Builder
+		for i := range p.tokens {
+			output.WriteString(words[i%len(words)])
+		}
+		if !sleep(r.Context(), s.tokenDelay()*time.Duration(p.tokens)) {
+			return
+		}
+		b := encode(rw.complete(output.String(), p.tokens, promptTokens), usage)
+		if p.abortAt >= 0 || malformedAt >= 0 {
+			b = b[:len(b)/2]
+		}
+		_, _ = w.Write(b)
+		if p.abortAt >= 0 {
+			panic(http.ErrAbortHandler)
+		}
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	write := func(chunk []byte) bool {
+		if _, err := w.Write(rw.frame(chunk)); err != nil {
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+
+	for i := range p.tokens {
+		if i == p.abortAt {
+			// closes the connection without ending the response.
+			panic(http.ErrAbortHandler)
+		}
+		if !sleep(r.Context(), s.tokenDelay()) {
+			return
+		}
+		chunk := encode(rw.token(words[i%len(words)]), true)
+		if i == malformedAt {
+			chunk = chunk[:len(chunk)/2]
+		}
+		if !write(chunk) {
+			return
+		}
+	}
+	if p.abortAt == p.tokens {
+		panic(http.ErrAbortHandler)
+	}
+
+	if !write(encode(rw.done(p.tokens, promptTokens, usage), usage)) {
+		return
+	}
+	if end := rw.frame(nil); end != nil {
+		_, _ = w.Write(end)
+	}
+}
+
+func (s *Server) tokenDelay() time.Duration {
+	if s.cfg.TokenRate == 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / s.cfg.TokenRate)
+}
+
+// sleep waits for d, returning false if the request was cancelled in the meantime.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// usageFields are the token counts refunds are computed from, left out in MalformedMissingUsage mode.
+var usageFields = []string{"usage", "prompt_eval_count", "eval_count"}
+
+// encode encodes v as JSON, without the usage fields when usage is false.
+func encode(v any, usage bool) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		// the responses are plain structs, this can't happen.
+		panic(fmt.Sprintf("failed to encode mock response: %v", err))
+	}
+	if usage {
+		return b
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		panic(fmt.Sprintf("failed to decode mock response: %v", err))
+	}
+	for _, field := range usageFields {
+		delete(fields, field)
+	}
+	b, err = json.Marshal(fields)
+	if err != nil {
+		panic(fmt.Sprintf("failed to encode mock response: %v", err))
+	}
+	return b
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(map[string]string{"error": msg}); err != nil {
+		slog.Error("failed to write error response", "error", err)
+	}
+}
+
+// ollamaWriter writes Ollama responses, streamed as newline delimited JSON.
+type ollamaWriter struct {
+	chat  bool
+	model string
+	start time.Time
+}
+
+func (*ollamaWriter) contentType(stream bool) string {
+	if stream {
+		return "application/x-ndjson"
+	}
+	return "application/json"
+}
+
+func (o *ollamaWriter) token(tok string) any {
+	if o.chat {
+		return ollama.ChatResponse{
+			Model:     o.model,
+			CreatedAt: time.Now(),
+			Message:   ollama.Message{Role: "assistant", Content: tok},
+		}
+	}
+	return ollama.GenerateResponse{
+		Model:     o.model,
+		CreatedAt: time.Now(),
+		Response:  tok,
+	}
+}
+
+func (o *ollamaWriter) done(tokens, promptTokens int, _ bool) any {
+	return o.complete("", tokens, promptTokens)
+}
+
+func (o *ollamaWriter) complete(output string, tokens, promptTokens int) any {
+	metrics := ollama.Metrics{
+		TotalDuration:   time.Since(o.start),
+		PromptEvalCount: promptTokens,
+		EvalCount:       tokens,
+	}
+	if o.chat {
+		return ollama.ChatResponse{
+			Model:      o.model,
+			CreatedAt:  time.Now(),
+			Message:    ollama.Message{Role: "assistant", Content: output},
+			Done:       true,
+			DoneReason: "stop",
+			Metrics:    metrics,
+		}
+	}
+	return ollama.GenerateResponse{
+		Model:      o.model,
+		CreatedAt:  time.Now(),
+		Response:   output,
+		Done:       true,
+		DoneReason: "stop",
+		Metrics:    metrics,
+	}
+}
+
+func (*ollamaWriter) frame(chunk []byte) []byte {
+	if chunk == nil {
+		return nil
+	}
+	return append(chunk, '\n')
+}
+
+// openAIWriter writes OpenAI responses, streamed as server-sent events.
+type openAIWriter struct {
+	chat    bool
+	model   string
+	created int64
+}
+
+func (*openAIWriter) contentType(stream bool) string {
+	if stream {
+		return "text/event-stream"
+	}
+	return "application/json"
+}
+
+func (o *openAIWriter) id() string {
+	if o.chat {
+		return "chatcmpl-mock"
+	}
+	return "cmpl-mock"
+}
+
+func (o *openAIWriter) token(tok string) any {
+	if o.chat {
+		return openai.ChatCompletionStreamResponse{
+			ID:      o.id(),
+			Object:  "chat.completion.chunk",
+			Created: o.created,
+			Model:   o.model,
+			Choices: []openai.ChatCompletionStreamChoice{
+				{Delta: openai.ChatCompletionStreamChoiceDelta{Role: openai.ChatMessageRoleAssistant, Content: tok}},
+			},
+		}
+	}
+	return openai.CompletionResponse{
+		ID:      o.id(),
+		Object:  "text_completion",
+		Created: o.created,
+		Model:   o.model,
+		Choices: []openai.CompletionChoice{{Text: tok}},
+	}
+}
+
+func (o *openAIWriter) done(tokens, promptTokens int, usage bool) any {
+	var u *openai.Usage
+	if usage {
+		u = &openai.Usage{PromptTokens: promptTokens, CompletionTokens: tokens, TotalTokens: promptTokens + tokens}
+	}
+	if o.chat {
+		return openai.ChatCompletionStreamResponse{
+			ID:      o.id(),
+			Object:  "chat.completion.chunk",
+			Created: o.created,
+			Model:   o.model,
+			Choices: []openai.ChatCompletionStreamChoice{{FinishReason: openai.FinishReasonStop}},
+			Usage:   u,
+		}
+	}
+	return openai.CompletionResponse{
+		ID:      o.id(),
+		Object:  "text_completion",
+		Created: o.created,
+		Model:   o.model,
+		Choices: []openai.CompletionChoice{{FinishReason: string(openai.FinishReasonStop)}},
+		Usage:   u,
+	}
+}
+
+func (o *openAIWriter) complete(output string, tokens, promptTokens int) any {
+	usage := openai.Usage{PromptTokens: promptTokens, CompletionTokens: tokens, TotalTokens: promptTokens + tokens}
+	if o.chat {
+		return openai.ChatCompletionResponse{
+			ID:      o.id(),
+			Object:  "chat.completion",
+			Created: o.created,
+			Model:   o.model,
+			Choices: []openai.ChatCompletionChoice{
+				{
+					Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: output},
+					FinishReason: openai.FinishReasonStop,
+				},
+			},
+			Usage: usage,
+		}
+	}
+	return openai.CompletionResponse{
+		ID:      o.id(),
+		Object:  "text_completion",
+		Created: o.created,
+		Model:   o.model,
+		Choices: []openai.CompletionChoice{{Text: output, FinishReason: string(openai.FinishReasonStop)}},
+		Usage:   &usage,
+	}
+}
+
+func (*openAIWriter) frame(chunk []byte) []byte {
+	if chunk == nil {
+		return []byte("data: [DONE]\n\n")
+	}
+	return bytes.Join([][]byte{[]byte("data: "), chunk, []byte("\n\n")}, nil)
+}
@@ -0,0 +1,305 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockllm_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	mrand "math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/mockllm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDistribution(t *testing.T) {
+	tests := map[string]struct {
+		in      string
+		want    mockllm.Distribution
+		wantErr bool
+	}{
+		"ok, fixed": {
+			in:   "100ms",
+			want: mockllm.Distribution{Kind: mockllm.DistributionFixed, A: 100 * time.Millisecond},
+		},
+		"ok, uniform": {
+			in:   "uniform:50ms-200ms",
+			want: mockllm.Distribution{Kind: mockllm.DistributionUniform, A: 50 * time.Millisecond, B: 200 * time.Millisecond},
+		},
+		"ok, normal": {
+			in:   "normal:100ms,20ms",
+			want: mockllm.Distribution{Kind: mockllm.DistributionNormal, A: 100 * time.Millisecond, B: 20 * time.Millisecond},
+		},
+		"fail, unknown kind":          {in: "poisson:1s", wantErr: true},
+		"fail, uniform max below min": {in: "uniform:200ms-50ms", wantErr: true},
+		"fail, negative":              {in: "-1s", wantErr: true},
+		"fail, missing parameter":     {in: "normal:100ms", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := mockllm.ParseDistribution(tc.in)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDistributionSample(t *testing.T) {
+	rnd := mrand.New(mrand.NewPCG(1, 1))
+
+	uniform := mockllm.Distribution{Kind: mockllm.DistributionUniform, A: 10 * time.Millisecond, B: 20 * time.Millisecond}
+	normal := mockllm.Distribution{Kind: mockllm.DistributionNormal, A: time.Millisecond, B: 10 * time.Millisecond}
+	for range 1000 {
+		d := uniform.Sample(rnd)
+		require.GreaterOrEqual(t, d, uniform.A)
+		require.LessOrEqual(t, d, uniform.B)
+		require.GreaterOrEqual(t, normal.Sample(rnd), time.Duration(0))
+	}
+}
+
+func TestServer(t *testing.T) {
+	newServer := func(t *testing.T, modify func(cfg *mockllm.Config)) *httptest.Server {
+		cfg := mockllm.DefaultConfig()
+		cfg.Models = []string{"llama3.2:1b"}
+		cfg.MinTokens = 5
+		cfg.MaxTokens = 5
+		cfg.Seed = 1
+		if modify != nil {
+			modify(&cfg)
+		}
+		srv, err := mockllm.New(cfg)
+		require.NoError(t, err)
+
+		ts := httptest.NewServer(srv)
+		t.Cleanup(ts.Close)
+		return ts
+	}
+
+	post := func(t *testing.T, ts *httptest.Server, path, body string) *http.Response {
+		resp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	// readLines reads newline delimited JSON objects.
+	readLines := func(t *testing.T, r io.Reader) []map[string]any {
+		var lines []map[string]any
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := strings.TrimPrefix(scanner.Text(), "data: ")
+			if line == "" || line == "[DONE]" {
+				continue
+			}
+			var v map[string]any
+			require.NoError(t, json.Unmarshal([]byte(line), &v))
+			lines = append(lines, v)
+		}
+		require.NoError(t, scanner.Err())
+		return lines
+	}
+
+	t.Run("ok, ollama generate streams tokens and counts", func(t *testing.T) {
+		ts := newServer(t, nil)
+		resp := post(t, ts, "/api/generate", `{"model":"llama3.2:1b","prompt":"why is the sky blue?"}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+		lines := readLines(t, resp.Body)
+		require.Len(t, lines, 6)
+		last := lines[len(lines)-1]
+		require.Equal(t, true, last["done"])
+		require.InDelta(t, 5, last["eval_count"], 0)
+		require.InDelta(t, 6, last["prompt_eval_count"], 0)
+	})
+
+	t.Run("ok, ollama chat without streaming", func(t *testing.T) {
+		ts := newServer(t, nil)
+		resp := post(t, ts, "/api/chat", `{"model":"llama3.2:1b","messages":[{"role":"user","content":"ping"}],"stream":false,"options":{"num_predict":3}}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+		var body struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			Done      bool `json:"done"`
+			EvalCount int  `json:"eval_count"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		require.True(t, body.Done)
+		require.Equal(t, 3, body.EvalCount)
+		require.Equal(t, "the sky is", body.Message.Content)
+	})
+
+	t.Run("ok, openai chat streams events with usage", func(t *testing.T) {
+		ts := newServer(t, nil)
+		resp := post(t, ts, "/v1/chat/completions", `{"model":"llama3.2:1b","messages":[{"role":"user","content":"ping"}],"stream":true,"stream_options":{"include_usage":true}}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.True(t, strings.HasSuffix(string(b), "data: [DONE]\n\n"))
+
+		lines := readLines(t, strings.NewReader(string(b)))
+		require.Len(t, lines, 6)
+		usage, ok := lines[len(lines)-1]["usage"].(map[string]any)
+		require.True(t, ok)
+		require.InDelta(t, 5, usage["completion_tokens"], 0)
+	})
+
+	t.Run("ok, openai completions without streaming", func(t *testing.T) {
+		ts := newServer(t, nil)
+		resp := post(t, ts, "/v1/completions", `{"model":"llama3.2:1b","prompt":"ping","max_tokens":2}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var body struct {
+			Usage struct {
+				CompletionTokens int `json:"completion_tokens"`
+			} `json:"usage"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		require.Equal(t, 2, body.Usage.CompletionTokens)
+	})
+
+	t.Run("ok, tags lists models", func(t *testing.T) {
+		ts := newServer(t, nil)
+		resp, err := http.Get(ts.URL + "/api/tags")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var body struct {
+			Models []struct {
+				Name string `json:"name"`
+			} `json:"models"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		require.Len(t, body.Models, 1)
+		require.Equal(t, "llama3.2:1b", body.Models[0].Name)
+	})
+
+	t.Run("ok, token rate paces the stream", func(t *testing.T) {
+		ts := newServer(t, func(cfg *mockllm.Config) {
+			cfg.TokenRate = 100
+		})
+		start := time.Now()
+		resp := post(t, ts, "/api/generate", `{"model":"llama3.2:1b","prompt":"ping"}`)
+		_, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("fail, unknown model", func(t *testing.T) {
+		ts := newServer(t, nil)
+		resp := post(t, ts, "/api/generate", `{"model":"gemma3:1b","prompt":"ping"}`)
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("fail, injected failure", func(t *testing.T) {
+		ts := newServer(t, func(cfg *mockllm.Config) {
+			cfg.FailureRate = 1
+		})
+		resp := post(t, ts, "/api/generate", `{"model":"llama3.2:1b","prompt":"ping"}`)
+		require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	})
+
+	t.Run("fail, aborted stream", func(t *testing.T) {
+		ts := newServer(t, func(cfg *mockllm.Config) {
+			cfg.AbortRate = 1
+		})
+		resp, err := http.Post(ts.URL+"/api/generate", "application/json", strings.NewReader(`{"model":"llama3.2:1b","prompt":"ping"}`))
+		if err != nil {
+			// aborted before the headers were written.
+			return
+		}
+		defer resp.Body.Close()
+		_, err = io.ReadAll(resp.Body)
+		require.Error(t, err)
+	})
+
+	t.Run("fail, malformed content type", func(t *testing.T) {
+		ts := newServer(t, func(cfg *mockllm.Config) {
+			cfg.MalformedRate = 1
+			cfg.Malformed = []mockllm.MalformedMode{mockllm.MalformedContentType}
+		})
+		resp := post(t, ts, "/api/generate", `{"model":"llama3.2:1b","prompt":"ping"}`)
+		require.Equal(t, "text/html", resp.Header.Get("Content-Type"))
+	})
+
+	t.Run("fail, malformed missing usage", func(t *testing.T) {
+		ts := newServer(t, func(cfg *mockllm.Config) {
+			cfg.MalformedRate = 1
+			cfg.Malformed = []mockllm.MalformedMode{mockllm.MalformedMissingUsage}
+		})
+		resp := post(t, ts, "/api/generate", `{"model":"llama3.2:1b","prompt":"ping"}`)
+		lines := readLines(t, resp.Body)
+		last := lines[len(lines)-1]
+		require.Equal(t, true, last["done"])
+		require.NotContains(t, last, "eval_count")
+		require.NotContains(t, last, "prompt_eval_count")
+	})
+
+	t.Run("fail, malformed json", func(t *testing.T) {
+		ts := newServer(t, func(cfg *mockllm.Config) {
+			cfg.MalformedRate = 1
+			cfg.Malformed = []mockllm.MalformedMode{mockllm.MalformedInvalidJSON}
+		})
+		resp := post(t, ts, "/api/generate", `{"model":"llama3.2:1b","prompt":"ping"}`)
+
+		invalid := 0
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if !json.Valid(scanner.Bytes()) {
+				invalid++
+			}
+		}
+		require.NoError(t, scanner.Err())
+		require.Equal(t, 1, invalid)
+	})
+}
+
+func TestNew(t *testing.T) {
+	tests := map[string]func(cfg *mockllm.Config){
+		"fail, negative token rate": func(cfg *mockllm.Config) { cfg.TokenRate = -1 },
+		"fail, max below min":       func(cfg *mockllm.Config) { cfg.MinTokens, cfg.MaxTokens = 5, 4 },
+		"fail, rate above 1":        func(cfg *mockllm.Config) { cfg.AbortRate = 1.5 },
+		"fail, malformed without modes": func(cfg *mockllm.Config) {
+			cfg.MalformedRate = 0.5
+		},
+	}
+
+	for name, modify := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := mockllm.DefaultConfig()
+			modify(&cfg)
+			_, err := mockllm.New(cfg)
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package modelwake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Wake asks the waker listening on socket to wake model up, it returns once the model serves
+// requests. Models the waker doesn't manage are awake.
+func Wake(ctx context.Context, socket string, model string) error {
+	if !validModel(model) {
+		return errors.New("invalid model name")
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return fmt.Errorf("failed to connect to model waker: %w", err)
+	}
+	defer conn.Close()
+
+	// unblock the write and read below when ctx is done.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	if _, err := io.WriteString(conn, model+"\n"); err != nil {
+		return fmt.Errorf("failed to send wake request: %w", err)
+	}
+
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(conn, status); err != nil {
+		return fmt.Errorf("failed to read wake status: %w", err)
+	}
+
+	switch status[0] {
+	case statusAwake:
+		return nil
+	case statusFailed:
+		return ErrWakeFailed
+	default:
+		return fmt.Errorf("unexpected wake status %d", status[0])
+	}
+}
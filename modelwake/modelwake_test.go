@@ -0,0 +1,160 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package modelwake
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/routercom/modelstate"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVLLM is a vLLM instance with the sleep mode endpoints.
+type fakeVLLM struct {
+	sleeping atomic.Bool
+	wakeUps  atomic.Int32
+	// release blocks wake ups until it is closed, nil doesn't block.
+	release chan struct{}
+	fail    bool
+}
+
+func (f *fakeVLLM) start(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /sleep", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("level") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.sleeping.Store(true)
+	})
+	mux.HandleFunc("POST /wake_up", func(w http.ResponseWriter, r *http.Request) {
+		f.wakeUps.Add(1)
+		if f.release != nil {
+			<-f.release
+		}
+		if f.fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.sleeping.Store(false)
+	})
+	mux.HandleFunc("GET /is_sleeping", func(w http.ResponseWriter, r *http.Request) {
+		if f.sleeping.Load() {
+			_, _ = w.Write([]byte(`{"is_sleeping":true}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"is_sleeping":false}`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func startWaker(t *testing.T, states []modelstate.State) *Waker {
+	t.Helper()
+	w := New(&Config{Socket: filepath.Join(t.TempDir(), "model_wake.sock")}, states, http.DefaultClient)
+	require.NoError(t, w.Start())
+	t.Cleanup(func() {
+		require.NoError(t, w.Close())
+	})
+	return w
+}
+
+func TestSleepMode(t *testing.T) {
+	vllm := &fakeVLLM{}
+	srv := vllm.start(t)
+
+	require.NoError(t, SleepModel(t.Context(), http.DefaultClient, srv.URL, SleepLevelOffload))
+	sleeping, err := ModelSleeping(t.Context(), http.DefaultClient, srv.URL)
+	require.NoError(t, err)
+	require.True(t, sleeping)
+
+	require.NoError(t, WakeModel(t.Context(), http.DefaultClient, srv.URL))
+	sleeping, err = ModelSleeping(t.Context(), http.DefaultClient, srv.URL)
+	require.NoError(t, err)
+	require.False(t, sleeping)
+}
+
+func TestWaker(t *testing.T) {
+	t.Run("ok, concurrent requests share a wake up", func(t *testing.T) {
+		vllm := &fakeVLLM{release: make(chan struct{})}
+		vllm.sleeping.Store(true)
+		srv := vllm.start(t)
+		w := startWaker(t, []modelstate.State{
+			{Model: "llama3.2:1b", Warm: true, Sleeping: true, EngineURL: srv.URL},
+		})
+
+		var wg sync.WaitGroup
+		errs := make([]error, 3)
+		for i := range errs {
+			wg.Go(func() {
+				errs[i] = Wake(context.Background(), w.cfg.Socket, "llama3.2:1b")
+			})
+		}
+		require.Eventually(t, func() bool {
+			return vllm.wakeUps.Load() == 1
+		}, time.Second, 5*time.Millisecond)
+		close(vllm.release)
+		wg.Wait()
+
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+		require.Equal(t, int32(1), vllm.wakeUps.Load())
+		require.False(t, vllm.sleeping.Load())
+		require.Equal(t, Stats{Sleeping: []string{}, Woken: 1}, w.Stats())
+
+		// the model is awake, the next request doesn't wake it up again.
+		require.NoError(t, Wake(context.Background(), w.cfg.Socket, "llama3.2:1b"))
+		require.Equal(t, int32(1), vllm.wakeUps.Load())
+	})
+
+	t.Run("ok, models that don't sleep are awake", func(t *testing.T) {
+		w := startWaker(t, []modelstate.State{{Model: "llama3.2:1b", Warm: true}})
+		require.NoError(t, Wake(context.Background(), w.cfg.Socket, "llama3.2:1b"))
+		require.NoError(t, Wake(context.Background(), w.cfg.Socket, "gemma3:1b"))
+	})
+
+	t.Run("fail, the model stays asleep after a failed wake up", func(t *testing.T) {
+		vllm := &fakeVLLM{fail: true}
+		vllm.sleeping.Store(true)
+		srv := vllm.start(t)
+		w := startWaker(t, []modelstate.State{
+			{Model: "llama3.2:1b", Warm: true, Sleeping: true, EngineURL: srv.URL},
+		})
+
+		require.ErrorIs(t, Wake(context.Background(), w.cfg.Socket, "llama3.2:1b"), ErrWakeFailed)
+		require.Equal(t, Stats{Sleeping: []string{"llama3.2:1b"}, Failed: 1}, w.Stats())
+
+		// the next request tries again.
+		require.ErrorIs(t, Wake(context.Background(), w.cfg.Socket, "llama3.2:1b"), ErrWakeFailed)
+		require.Equal(t, int32(2), vllm.wakeUps.Load())
+	})
+
+	t.Run("fail, invalid model name", func(t *testing.T) {
+		w := startWaker(t, nil)
+		require.Error(t, Wake(context.Background(), w.cfg.Socket, "llama3.2:1b\nother"))
+		require.Error(t, Wake(context.Background(), w.cfg.Socket, ""))
+	})
+}
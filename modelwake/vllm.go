@@ -0,0 +1,93 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package modelwake
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// vLLM exposes the sleep mode endpoints when it runs with --enable-sleep-mode and VLLM_SERVER_DEV_MODE=1.
+const (
+	sleepPath      = "/sleep"
+	wakeUpPath     = "/wake_up"
+	isSleepingPath = "/is_sleeping"
+)
+
+// Sleep levels of vLLM, see SleepModel.
+const (
+	// SleepLevelOffload offloads the weights to CPU memory and discards the KV cache, waking up is fast.
+	SleepLevelOffload = 1
+	// SleepLevelDiscard discards the weights and the KV cache, waking up reloads the weights.
+	SleepLevelDiscard = 2
+)
+
+// SleepModel puts the vLLM instance at baseURL to sleep, freeing the GPU memory of its model.
+func SleepModel(ctx context.Context, client *http.Client, baseURL string, level int) error {
+	return post(ctx, client, baseURL+sleepPath+"?level="+strconv.Itoa(level))
+}
+
+// WakeModel wakes the vLLM instance at baseURL up, it serves requests again once it returns.
+func WakeModel(ctx context.Context, client *http.Client, baseURL string) error {
+	return post(ctx, client, baseURL+wakeUpPath)
+}
+
+// ModelSleeping reports whether the vLLM instance at baseURL is sleeping.
+func ModelSleeping(ctx context.Context, client *http.Client, baseURL string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+isSleepingPath, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	var body struct {
+		IsSleeping bool `json:"is_sleeping"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1024)).Decode(&body); err != nil {
+		return false, fmt.Errorf("failed to decode sleep state: %w", err)
+	}
+	return body.IsSleeping, nil
+}
+
+func post(ctx context.Context, client *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
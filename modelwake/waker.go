@@ -0,0 +1,307 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package modelwake wakes up models that compute_boot put to sleep to free their GPU memory, when
+// the first request for them arrives. Only compute_worker sees the model of a request, so router_com
+// runs a Waker on a unix socket and workers ask it to wake the model of a request up before they
+// send the request to the backend.
+//
+// Like badgelimit the protocol is minimal: a worker connects and sends a single line with the model,
+// the waker answers with a single status byte once the model is awake. Concurrent requests for a
+// sleeping model wait for the same wake up.
+package modelwake
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/confidentsecurity/confidentcompute/routercom/modelstate"
+)
+
+// status bytes sent by the waker.
+const (
+	statusAwake  byte = 1
+	statusFailed byte = 2
+)
+
+const (
+	// maxModelLen bounds the model name a worker sends.
+	maxModelLen = 256
+	// requestTimeout bounds how long a worker may take to send its line.
+	requestTimeout = 5 * time.Second
+	// DefaultTimeout bounds a wake up when the config doesn't.
+	DefaultTimeout = 2 * time.Minute
+)
+
+// ErrWakeFailed is returned when the model didn't wake up. The model stays asleep, the next request
+// for it tries again.
+var ErrWakeFailed = errors.New("model failed to wake up")
+
+// Config is config for the model waker.
+type Config struct {
+	// Socket is the unix socket the waker listens on. Leave blank to disable the waker, sleeping
+	// models then stay asleep.
+	Socket string `yaml:"socket"`
+	// Timeout bounds how long waking a model up may take, the requests waiting for it fail after.
+	// Defaults to DefaultTimeout.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c *Config) Validate() error {
+	if c.Timeout < 0 {
+		return errors.New("wake timeout can't be negative")
+	}
+	return nil
+}
+
+func (c *Config) timeout() time.Duration {
+	if c.Timeout == 0 {
+		return DefaultTimeout
+	}
+	return c.Timeout
+}
+
+// Stats describes the work of the waker.
+type Stats struct {
+	// Sleeping are the models that are still asleep.
+	Sleeping []string `json:"sleeping"`
+	// Woken is the number of models woken up since the waker started.
+	Woken uint64 `json:"woken"`
+	// Failed is the number of wake ups that failed.
+	Failed uint64 `json:"failed"`
+}
+
+// Waker wakes up the sleeping models of the model states on request of workers.
+type Waker struct {
+	cfg      *Config
+	client   *http.Client
+	listener net.Listener
+	wg       sync.WaitGroup
+	// ctx is cancelled when the waker closes, it ends the wake ups in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu sync.Mutex
+	// sleeping are the engine urls of the sleeping models by model.
+	sleeping map[string]string
+	// waking are the wake ups in flight by model.
+	waking map[string]*wakeUp
+	// conns are the connections of the workers, closed when the waker closes.
+	conns map[net.Conn]struct{}
+	stats Stats
+}
+
+// wakeUp is a wake up in flight, done is closed once err is set.
+type wakeUp struct {
+	done chan struct{}
+	err  error
+}
+
+// New creates a waker for the sleeping models in states.
+func New(cfg *Config, states []modelstate.State, client *http.Client) *Waker {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Waker{
+		cfg:      cfg,
+		client:   client,
+		ctx:      ctx,
+		cancel:   cancel,
+		sleeping: map[string]string{},
+		waking:   map[string]*wakeUp{},
+		conns:    map[net.Conn]struct{}{},
+	}
+	for model, url := range modelstate.Sleeping(states) {
+		w.sleeping[model] = url
+	}
+	return w
+}
+
+// Start starts listening on the configured socket and wakes models up in the background.
+func (w *Waker) Start() error {
+	if w.cfg.Socket == "" {
+		return errors.New("missing model wake socket")
+	}
+
+	if err := os.RemoveAll(w.cfg.Socket); err != nil {
+		return fmt.Errorf("failed to remove existing model wake socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", w.cfg.Socket)
+	if err != nil {
+		return fmt.Errorf("failed to listen on model wake socket: %w", err)
+	}
+
+	// compute_worker runs as the same user as router_com.
+	if err := os.Chmod(w.cfg.Socket, 0o600); err != nil {
+		return errors.Join(fmt.Errorf("failed to set model wake socket permissions: %w", err), listener.Close())
+	}
+
+	w.listener = listener
+	slog.Info("Serving model waker", "socket", w.cfg.Socket, "sleeping", w.Stats().Sleeping)
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		w.serve(listener)
+	}()
+
+	return nil
+}
+
+func (w *Waker) serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("model waker stopped unexpectedly", "error", err)
+			}
+			return
+		}
+
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			w.handle(conn)
+		}()
+	}
+}
+
+// handle wakes the model conn asks for up and reports the outcome.
+func (w *Waker) handle(conn net.Conn) {
+	w.mu.Lock()
+	w.conns[conn] = struct{}{}
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.conns, conn)
+		w.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	_ = conn.SetReadDeadline(time.Now().Add(requestTimeout))
+	r := bufio.NewReaderSize(io.LimitReader(conn, maxModelLen+1), maxModelLen+1)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		slog.Warn("failed to read wake request", "error", err)
+		return
+	}
+	model := strings.TrimSuffix(line, "\n")
+	if !validModel(model) {
+		slog.Warn("invalid wake request")
+		return
+	}
+
+	status := statusAwake
+	if err := w.Wake(model); err != nil {
+		status = statusFailed
+	}
+	_, _ = conn.Write([]byte{status})
+}
+
+// Wake wakes model up if it is sleeping. Concurrent calls for the same model wait for the same
+// wake up.
+func (w *Waker) Wake(model string) error {
+	w.mu.Lock()
+	url, ok := w.sleeping[model]
+	if !ok {
+		w.mu.Unlock()
+		return nil
+	}
+	wake, ok := w.waking[model]
+	if !ok {
+		wake = &wakeUp{done: make(chan struct{})}
+		w.waking[model] = wake
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			w.wakeUp(model, url, wake)
+		}()
+	}
+	w.mu.Unlock()
+
+	<-wake.done
+	return wake.err
+}
+
+func (w *Waker) wakeUp(model, url string, wake *wakeUp) {
+	slog.Info("Waking up model", "model", model)
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(w.ctx, w.cfg.timeout())
+	defer cancel()
+	err := WakeModel(ctx, w.client, url)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.waking, model)
+	if err != nil {
+		slog.Error("Failed to wake up model", "model", model, "error", err)
+		w.stats.Failed++
+		wake.err = errors.Join(ErrWakeFailed, err)
+	} else {
+		slog.Info("Woke up model", "model", model, "duration", time.Since(start))
+		delete(w.sleeping, model)
+		w.stats.Woken++
+	}
+	close(wake.done)
+}
+
+// Stats returns a snapshot of the waker stats.
+func (w *Waker) Stats() Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stats := w.stats
+	stats.Sleeping = make([]string, 0, len(w.sleeping))
+	for model := range w.sleeping {
+		stats.Sleeping = append(stats.Sleeping, model)
+	}
+	slices.Sort(stats.Sleeping)
+	return stats
+}
+
+// Close stops accepting workers and ends the wake ups in flight.
+func (w *Waker) Close() error {
+	w.cancel()
+	if w.listener == nil {
+		return nil
+	}
+	err := w.listener.Close()
+	w.mu.Lock()
+	for conn := range w.conns {
+		_ = conn.Close()
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+	return err
+}
+
+// validModel reports whether model can be sent in a wake request line.
+func validModel(model string) bool {
+	return model != "" && len(model) <= maxModelLen && !strings.ContainsFunc(model, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	})
+}
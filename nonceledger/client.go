@@ -0,0 +1,67 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nonceledger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Claim records nonce with the ledger listening on socket, until expiry. It returns ErrReplayed when
+// the nonce was claimed before and ErrFull when the ledger can't record it, the token must be
+// refused in both cases.
+func Claim(ctx context.Context, socket string, nonce []byte, expiry time.Time) error {
+	if len(nonce) == 0 || len(nonce) > MaxNonceLen {
+		return fmt.Errorf("nonce must be 1 to %d bytes", MaxNonceLen)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return fmt.Errorf("failed to connect to nonce ledger: %w", err)
+	}
+	defer conn.Close()
+
+	// unblock the write and read below when ctx is done.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	if _, err := io.WriteString(conn, formatRequest(nonce, expiry)); err != nil {
+		return fmt.Errorf("failed to send nonce claim: %w", err)
+	}
+
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(conn, status); err != nil {
+		return fmt.Errorf("failed to read nonce claim status: %w", err)
+	}
+
+	switch status[0] {
+	case statusFresh:
+		return nil
+	case statusReplayed:
+		return ErrReplayed
+	case statusFull:
+		return ErrFull
+	default:
+		return fmt.Errorf("unexpected nonce claim status %d", status[0])
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package nonceledger makes tokens that compute_worker verifies single use across workers. Every
+// request runs in its own compute_worker, so router_com runs a Ledger on a unix socket that records
+// the nonces of the tokens workers accepted until the tokens expire.
+//
+// Like the badge limiter the protocol is minimal: a worker connects and sends a single line with the
+// hex encoded nonce and the unix expiry of its token, the ledger records the nonce and answers with
+// a single status byte.
+package nonceledger
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/listen"
+)
+
+// status bytes sent by the ledger.
+const (
+	statusFresh    byte = 1
+	statusReplayed byte = 2
+	statusFull     byte = 3
+)
+
+const (
+	// MaxNonceLen bounds the length of a nonce.
+	MaxNonceLen = 32
+	// MaxTTL bounds how long a nonce is recorded, tokens that are valid for longer are refused.
+	MaxTTL = time.Hour
+	// DefaultMaxNonces is the default bound on the recorded nonces.
+	DefaultMaxNonces = 1 << 20
+	// maxRequestLine bounds the line a worker sends.
+	maxRequestLine = 128
+	// requestTimeout bounds how long a worker may take to send its line.
+	requestTimeout = 5 * time.Second
+)
+
+var (
+	// ErrReplayed is returned when the nonce was claimed before, the token was already used.
+	ErrReplayed = errors.New("nonce was already used")
+	// ErrFull is returned when the ledger can't record more nonces until some of them expire.
+	ErrFull = errors.New("nonce ledger is full")
+)
+
+// Config is config for the nonce ledger.
+type Config struct {
+	// Socket is the unix socket the ledger listens on.
+	Socket string `yaml:"socket"`
+	// MaxNonces bounds the recorded nonces, claims are refused while the ledger is full. Leave 0 for
+	// DefaultMaxNonces.
+	MaxNonces int `yaml:"max_nonces"`
+}
+
+func (c *Config) Validate() error {
+	if c.Socket == "" {
+		return errors.New("missing nonce ledger socket")
+	}
+	if c.MaxNonces < 0 {
+		return errors.New("max nonces can't be negative")
+	}
+	return nil
+}
+
+// Stats describes the nonces of the ledger.
+type Stats struct {
+	// Nonces is the number of recorded nonces that didn't expire yet.
+	Nonces int `json:"nonces"`
+	// Claimed is the number of nonces claimed since the ledger started.
+	Claimed uint64 `json:"claimed"`
+	// Replayed is the number of claims refused because the nonce was used before.
+	Replayed uint64 `json:"replayed"`
+}
+
+// Ledger records the nonces workers claim until they expire.
+type Ledger struct {
+	cfg      *Config
+	listener net.Listener
+	wg       sync.WaitGroup
+	now      func() time.Time
+
+	mu sync.Mutex
+	// nonces are the expiries of the recorded nonces, by hex encoded nonce.
+	nonces map[string]time.Time
+	stats  Stats
+}
+
+func New(cfg *Config) *Ledger {
+	return &Ledger{
+		cfg:    cfg,
+		now:    time.Now,
+		nonces: map[string]time.Time{},
+	}
+}
+
+// Start starts listening on the configured socket and records nonces in the background.
+func (l *Ledger) Start() error {
+	if err := l.cfg.Validate(); err != nil {
+		return err
+	}
+
+	// compute_worker runs as the same user as router_com.
+	listener, err := listen.UnixSocket(l.cfg.Socket, 0o600).Listen()
+	if err != nil {
+		return fmt.Errorf("failed to listen on nonce ledger socket: %w", err)
+	}
+
+	l.listener = listener
+	slog.Info("Serving nonce ledger", "socket", l.cfg.Socket)
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		l.serve(listener)
+	}()
+
+	return nil
+}
+
+func (l *Ledger) serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("nonce ledger stopped unexpectedly", "error", err)
+			}
+			return
+		}
+
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			l.handle(conn)
+		}()
+	}
+}
+
+// handle records the nonce conn claims and answers whether it was fresh.
+func (l *Ledger) handle(conn net.Conn) {
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(requestTimeout))
+	r := bufio.NewReaderSize(io.LimitReader(conn, maxRequestLine), maxRequestLine)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		slog.Warn("failed to read nonce claim", "error", err)
+		return
+	}
+	nonce, expiry, err := parseRequest(line)
+	if err != nil {
+		slog.Warn("invalid nonce claim", "error", err)
+		return
+	}
+
+	_, _ = conn.Write([]byte{l.claim(nonce, expiry)})
+}
+
+// claim records nonce until expiry and returns the status of the claim.
+func (l *Ledger) claim(nonce string, expiry time.Time) byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if recorded, ok := l.nonces[nonce]; ok && now.Before(recorded) {
+		l.stats.Replayed++
+		return statusReplayed
+	}
+	// an expired token is refused by the worker, recording its nonce is pointless.
+	if !now.Before(expiry) {
+		return statusFresh
+	}
+	if expiry.After(now.Add(MaxTTL)) {
+		expiry = now.Add(MaxTTL)
+	}
+
+	maxNonces := l.cfg.MaxNonces
+	if maxNonces == 0 {
+		maxNonces = DefaultMaxNonces
+	}
+	if len(l.nonces) >= maxNonces {
+		l.prune(now)
+		if len(l.nonces) >= maxNonces {
+			return statusFull
+		}
+	}
+
+	l.nonces[nonce] = expiry
+	l.stats.Claimed++
+	return statusFresh
+}
+
+// prune forgets the nonces that expired.
+func (l *Ledger) prune(now time.Time) {
+	for nonce, expiry := range l.nonces {
+		if !now.Before(expiry) {
+			delete(l.nonces, nonce)
+		}
+	}
+}
+
+// Stats returns a snapshot of the ledger stats.
+func (l *Ledger) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(l.now())
+	stats := l.stats
+	stats.Nonces = len(l.nonces)
+	return stats
+}
+
+// Close stops accepting claims.
+func (l *Ledger) Close() error {
+	if l.listener == nil {
+		return nil
+	}
+	err := l.listener.Close()
+	l.wg.Wait()
+	return err
+}
+
+func formatRequest(nonce []byte, expiry time.Time) string {
+	return hex.EncodeToString(nonce) + " " + strconv.FormatInt(expiry.Unix(), 10) + "\n"
+}
+
+func parseRequest(line string) (string, time.Time, error) {
+	nonceText, expiryText, ok := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+	if !ok {
+		return "", time.Time{}, errors.New("malformed claim line")
+	}
+	b, err := hex.DecodeString(nonceText)
+	if err != nil || len(b) == 0 || len(b) > MaxNonceLen {
+		return "", time.Time{}, errors.New("invalid nonce")
+	}
+	expiry, err := strconv.ParseInt(expiryText, 10, 64)
+	if err != nil {
+		return "", time.Time{}, errors.New("invalid expiry")
+	}
+	return nonceText, time.Unix(expiry, 0), nil
+}
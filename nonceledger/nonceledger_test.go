@@ -0,0 +1,101 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package nonceledger
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func startLedger(t *testing.T, cfg *Config) *Ledger {
+	t.Helper()
+	cfg.Socket = filepath.Join(t.TempDir(), "nonce_ledger.sock")
+	l := New(cfg)
+	require.NoError(t, l.Start())
+	t.Cleanup(func() {
+		require.NoError(t, l.Close())
+	})
+	return l
+}
+
+func nonce(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 16)
+}
+
+func TestLedger(t *testing.T) {
+	t.Run("ok, nonce can only be claimed once", func(t *testing.T) {
+		l := startLedger(t, &Config{})
+		expiry := time.Now().Add(time.Minute)
+
+		require.NoError(t, Claim(context.Background(), l.cfg.Socket, nonce(1), expiry))
+		err := Claim(context.Background(), l.cfg.Socket, nonce(1), expiry)
+		require.ErrorIs(t, err, ErrReplayed)
+
+		// other nonces are claimed independently.
+		require.NoError(t, Claim(context.Background(), l.cfg.Socket, nonce(2), expiry))
+
+		stats := l.Stats()
+		require.Equal(t, 2, stats.Nonces)
+		require.Equal(t, uint64(2), stats.Claimed)
+		require.Equal(t, uint64(1), stats.Replayed)
+	})
+
+	t.Run("ok, expired nonces are forgotten", func(t *testing.T) {
+		l := startLedger(t, &Config{})
+		now := time.Now()
+		l.now = func() time.Time { return now }
+
+		require.NoError(t, Claim(context.Background(), l.cfg.Socket, nonce(1), now.Add(time.Minute)))
+		now = now.Add(2 * time.Minute)
+		require.Equal(t, 0, l.Stats().Nonces)
+	})
+
+	t.Run("ok, nonces are recorded for at most the max ttl", func(t *testing.T) {
+		l := startLedger(t, &Config{})
+		now := time.Now()
+		l.now = func() time.Time { return now }
+
+		require.NoError(t, Claim(context.Background(), l.cfg.Socket, nonce(1), now.Add(24*time.Hour)))
+		now = now.Add(MaxTTL)
+		require.Equal(t, 0, l.Stats().Nonces)
+	})
+
+	t.Run("fail, ledger is full", func(t *testing.T) {
+		l := startLedger(t, &Config{MaxNonces: 1})
+		expiry := time.Now().Add(time.Minute)
+
+		require.NoError(t, Claim(context.Background(), l.cfg.Socket, nonce(1), expiry))
+		err := Claim(context.Background(), l.cfg.Socket, nonce(2), expiry)
+		require.ErrorIs(t, err, ErrFull)
+	})
+
+	t.Run("fail, invalid nonce", func(t *testing.T) {
+		l := startLedger(t, &Config{})
+		err := Claim(context.Background(), l.cfg.Socket, bytes.Repeat([]byte{1}, MaxNonceLen+1), time.Now().Add(time.Minute))
+		require.Error(t, err)
+	})
+
+	t.Run("fail, ledger is not running", func(t *testing.T) {
+		err := Claim(context.Background(), filepath.Join(t.TempDir(), "missing.sock"), nonce(1), time.Now().Add(time.Minute))
+		require.Error(t, err)
+	})
+}
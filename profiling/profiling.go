@@ -20,11 +20,13 @@ package profiling
 import (
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	_ "net/http/pprof" // #nosec G108 -- Profiling endpoints intentionally exposed for debugging
 	"os"
 	"time"
 
+	"github.com/confidentsecurity/confidentcompute/listen"
 	"github.com/felixge/fgprof"
 )
 
@@ -81,6 +83,27 @@ type ProfilerConfig struct {
 	Port string
 }
 
+// Address returns where the profiler listens. The environment variable EnvVar with a _LISTEN suffix
+// overrides the default of localhost:Port, e.g. PROFILE_ROUTER_COM_LISTEN=unix:/run/router_com/profile.sock,
+// see listen.Parse. Unix sockets are owner only, vsock and non-loopback tcp addresses are rejected.
+func (c ProfilerConfig) Address() (listen.Config, error) {
+	value := os.Getenv(c.EnvVar + "_LISTEN")
+	if value == "" {
+		return listen.Config{Network: listen.TCP, Address: net.JoinHostPort("localhost", c.Port)}, nil
+	}
+	addr, err := listen.Parse(value)
+	if err != nil {
+		return listen.Config{}, err
+	}
+	if addr.Network == listen.Unix {
+		addr.Mode = 0o600
+	}
+	if err := addr.CheckPrivate(); err != nil {
+		return listen.Config{}, err
+	}
+	return addr, nil
+}
+
 // GetProfilerConfig returns the profiler configuration for the given service.
 func (s Service) GetProfilerConfig() ProfilerConfig {
 	switch s {
@@ -143,14 +166,23 @@ func (s Service) InitProfilerIfEnabled() {
 	if !enabled {
 		return
 	}
+	addr, err := config.Address()
+	if err != nil {
+		log.Println("invalid profiler address:", err)
+		return
+	}
+	listener, err := addr.Listen()
+	if err != nil {
+		log.Println("failed to listen for the profiler:", err)
+		return
+	}
 	http.DefaultServeMux.Handle("/debug/fgprof", fgprof.Handler())
 	go func() {
 		server := &http.Server{
-			Addr:         "localhost:" + config.Port,
 			ReadTimeout:  30 * time.Second,
 			WriteTimeout: 30 * time.Second,
 			IdleTimeout:  60 * time.Second,
 		}
-		log.Println(server.ListenAndServe())
+		log.Println(server.Serve(listener))
 	}()
 }
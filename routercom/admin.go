@@ -0,0 +1,376 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/cloudflare/circl/kem"
+	"github.com/confidentsecurity/confidentcompute/badgelimit"
+	"github.com/confidentsecurity/confidentcompute/debug"
+	"github.com/confidentsecurity/confidentcompute/listen"
+	"github.com/confidentsecurity/confidentcompute/modelwake"
+	"github.com/confidentsecurity/confidentcompute/nonceledger"
+	"github.com/confidentsecurity/confidentcompute/routercom/capabilities"
+	"github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/confidentsecurity/confidentcompute/routercom/modelstate"
+	"github.com/confidentsecurity/confidentcompute/tpmbroker"
+	"github.com/openpcc/openpcc/httpfmt"
+)
+
+// AdminConfig is config for the router_com admin API. The admin API is disabled by default, it is
+// only served on a local socket and never exposes client data.
+type AdminConfig struct {
+	// Socket is the unix socket the admin API listens on, e.g. /run/router_com/admin.sock. It must be
+	// in a directory only router_com can write to. Leave blank to disable the admin API.
+	Socket string `yaml:"socket"`
+	// Address is where the admin API listens instead of Socket, e.g. a tcp loopback address. vsock
+	// and non-loopback tcp addresses are rejected. Leave blank to use Socket.
+	Address *listen.Config `yaml:"address"`
+	// SupportPublicKey is the base64 encoded X25519 public key of Confident Security support, support
+	// bundles are encrypted to it. Leave blank to disable support bundles.
+	SupportPublicKey string `yaml:"support_public_key"`
+}
+
+// Enabled reports whether the admin API has an address to listen on.
+func (c *AdminConfig) Enabled() bool {
+	return c.Address != nil || c.Socket != ""
+}
+
+// address returns where the admin API listens. Unix sockets default to owner only permissions, so
+// only the owner of router_com can use the admin API.
+func (c *AdminConfig) address() listen.Config {
+	addr := listen.UnixSocket(c.Socket, 0o600)
+	if c.Address != nil {
+		addr = *c.Address
+	}
+	if addr.Network == listen.Unix && addr.Mode == 0 {
+		addr.Mode = 0o600
+	}
+	return addr
+}
+
+// AdminStatus is the operational state of router_com as reported by the admin API.
+type AdminStatus struct {
+	Draining         bool                   `json:"draining"`
+	QueueDepth       int                    `json:"queue_depth"`
+	Workers          []AdminWorker          `json:"workers"`
+	ValidationErrors map[string]uint64      `json:"validation_errors"`
+	WorkerExitCodes  map[string]uint64      `json:"worker_exit_codes"`
+	Evidence         []AdminEvidenceSummary `json:"evidence"`
+	Models           []modelstate.State     `json:"models"`
+	// PolicyVersion is the version of the applied policy bundle, 0 if none was applied.
+	PolicyVersion uint64 `json:"policy_version"`
+	// Capabilities is what was advertised to the router, nil before the advertisement.
+	Capabilities *capabilities.Advertisement `json:"capabilities,omitempty"`
+	// Migrating is true once in-flight requests are being migrated to other nodes.
+	Migrating bool `json:"migrating"`
+	// TPMBroker is the load on the TPM access broker, nil when the broker is disabled.
+	TPMBroker *tpmbroker.Stats `json:"tpm_broker,omitempty"`
+	// BadgeLimit is the load on the badge limiter, nil when the limiter is disabled.
+	BadgeLimit *badgelimit.Stats `json:"badge_limit,omitempty"`
+	// Nonces are the claimed and replayed continuation tokens and credit grants, nil when both are
+	// disabled.
+	Nonces *nonceledger.Stats `json:"nonces,omitempty"`
+	// ModelWake are the sleeping models and wake ups of the model waker, nil when the waker is disabled.
+	ModelWake *modelwake.Stats `json:"model_wake,omitempty"`
+	// REKUsage counts the requests decapsulated with the current REK, nil when counting is disabled.
+	REKUsage *REKUsage `json:"rek_usage,omitempty"`
+	// Maintenance is the maintenance claim from the evidence, nil when the node is not in maintenance mode.
+	Maintenance *evidence.Maintenance `json:"maintenance,omitempty"`
+	// GPUDegraded is the GPU degraded claim from the evidence, nil when the GPUs were attested or the
+	// node has none.
+	GPUDegraded *evidence.GPUDegraded `json:"gpu_degraded,omitempty"`
+	// SlowClientAborts counts the responses that were ended early because the client read too slowly.
+	SlowClientAborts uint64 `json:"slow_client_aborts"`
+	// ErrorDetails counts the worker failures that were reported to the client in the encrypted response.
+	ErrorDetails uint64 `json:"error_details"`
+	// StartupLatency aggregates the startup latency of the workers, nil when the aggregation is disabled.
+	StartupLatency *StartupLatencyStats `json:"startup_latency,omitempty"`
+	// ModelSpend is the spend per model of the latest hours, oldest first. Empty when the aggregation
+	// is disabled.
+	ModelSpend []HourlyModelSpend `json:"model_spend,omitempty"`
+	// PromptSize are histograms of the prompt sizes of the workers, nil when the aggregation is disabled.
+	PromptSize *PromptSizeStats `json:"prompt_size,omitempty"`
+	// EvidenceExpiry is when the evidence expires and when the node drains and shuts down for it.
+	EvidenceExpiry *EvidenceExpiry `json:"evidence_expiry,omitempty"`
+}
+
+// AdminWorker describes an in-flight compute_worker process.
+type AdminWorker struct {
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// AdminEvidenceSummary describes a single evidence piece without exposing its contents.
+type AdminEvidenceSummary struct {
+	Type         string `json:"type"`
+	DataLen      int    `json:"data_len"`
+	SignatureLen int    `json:"signature_len"`
+}
+
+// AdminLogLevel is the runtime log level override. Overridden is false when the level
+// from GO_LOG applies.
+type AdminLogLevel struct {
+	Level      string `json:"level"`
+	Overridden bool   `json:"overridden"`
+}
+
+// AdminServer serves the admin API on a unix socket, separate from the router facing handler.
+type AdminServer struct {
+	cfg        *AdminConfig
+	service    *Service
+	server     *http.Server
+	supportKey kem.PublicKey
+}
+
+func NewAdminServer(cfg *AdminConfig, service *Service) *AdminServer {
+	a := &AdminServer{
+		cfg:     cfg,
+		service: service,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", a.statusHandler)
+	mux.HandleFunc("POST /drain", a.drainHandler(true))
+	mux.HandleFunc("POST /undrain", a.drainHandler(false))
+	mux.HandleFunc("POST /migrate", a.migrateHandler)
+	mux.HandleFunc("GET /log_level", a.logLevelHandler)
+	mux.HandleFunc("POST /log_level", a.setLogLevelHandler)
+	mux.HandleFunc("POST /support_bundle", a.supportBundleHandler)
+
+	a.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	return a
+}
+
+// Start starts listening on the configured socket and serves the admin API in the background.
+func (a *AdminServer) Start() error {
+	addr := a.cfg.address()
+	if err := addr.CheckPrivate(); err != nil {
+		return fmt.Errorf("invalid admin address: %w", err)
+	}
+
+	if a.cfg.SupportPublicKey != "" {
+		key, err := ParseSupportPublicKey(a.cfg.SupportPublicKey)
+		if err != nil {
+			return err
+		}
+		a.supportKey = key
+	}
+
+	listener, err := addr.Listen()
+	if err != nil {
+		return fmt.Errorf("failed to listen on admin socket: %w", err)
+	}
+
+	slog.Info("Serving admin API", "address", addr)
+	go func() {
+		err := a.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("admin API stopped unexpectedly", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+func (a *AdminServer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return a.server.Shutdown(ctx)
+}
+
+func (a *AdminServer) statusHandler(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, r, a.service.AdminStatus())
+}
+
+func (a *AdminServer) drainHandler(draining bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !draining && a.service.Migrating() {
+			writeJSONError(w, r, "node is migrating its requests", http.StatusConflict)
+			return
+		}
+		a.service.SetDraining(draining)
+		slog.Info("Drain mode changed via admin API", "draining", draining)
+		writeAdminJSON(w, r, a.service.AdminStatus())
+	}
+}
+
+// migrateHandler drains the node and migrates the in-flight requests to other nodes. The node
+// can't be undrained afterwards, any request it would accept would be migrated right away.
+func (a *AdminServer) migrateHandler(w http.ResponseWriter, r *http.Request) {
+	a.service.MigrateRequests()
+	slog.Info("In-flight requests migrated via admin API")
+	writeAdminJSON(w, r, a.service.AdminStatus())
+}
+
+func (*AdminServer) logLevelHandler(w http.ResponseWriter, r *http.Request) {
+	writeAdminJSON(w, r, currentLogLevel())
+}
+
+// setLogLevelHandler overrides the log level of router_com and any compute_worker it starts.
+// An empty level removes the override.
+func (*AdminServer) setLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	var req AdminLogLevel
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil {
+		writeJSONError(w, r, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Level == "" {
+		debug.ResetLevel()
+		slog.Info("Log level override removed via admin API")
+		writeAdminJSON(w, r, currentLogLevel())
+		return
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+		writeJSONError(w, r, "invalid log level", http.StatusBadRequest)
+		return
+	}
+
+	debug.SetLevel(level)
+	slog.Info("Log level overridden via admin API", "level", level)
+	writeAdminJSON(w, r, currentLogLevel())
+}
+
+// supportBundleHandler responds with a support bundle encrypted to the support public key, so it
+// can be attached to an incident escalation without exposing the node config.
+func (a *AdminServer) supportBundleHandler(w http.ResponseWriter, r *http.Request) {
+	if a.supportKey == nil {
+		writeJSONError(w, r, "support bundles are disabled", http.StatusNotFound)
+		return
+	}
+
+	bundle, err := a.service.SupportBundle()
+	if err != nil {
+		slog.Error("failed to create support bundle", "error", err)
+		writeJSONError(w, r, "failed to create support bundle", http.StatusInternalServerError)
+		return
+	}
+
+	encrypted, err := SealSupportBundle(a.supportKey, bundle)
+	if err != nil {
+		slog.Error("failed to encrypt support bundle", "error", err)
+		writeJSONError(w, r, "failed to encrypt support bundle", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Support bundle created via admin API")
+	writeAdminJSON(w, r, encrypted)
+}
+
+func currentLogLevel() AdminLogLevel {
+	level, ok := debug.Level()
+	if !ok {
+		return AdminLogLevel{}
+	}
+	return AdminLogLevel{
+		Level:      level.String(),
+		Overridden: true,
+	}
+}
+
+func writeAdminJSON(w http.ResponseWriter, r *http.Request, v any) {
+	httpfmt.JSON(w, r, v, http.StatusOK)
+}
+
+// jsonError is the body of failed requests to the JSON APIs of router_com.
+type jsonError struct {
+	Error string `json:"error"`
+}
+
+func writeJSONError(w http.ResponseWriter, r *http.Request, msg string, status int) {
+	httpfmt.JSON(w, r, jsonError{Error: msg}, status)
+}
+
+// AdminStatus returns a snapshot of the operational state of the service.
+func (s *Service) AdminStatus() AdminStatus {
+	status := s.state.snapshot()
+	status.Migrating = s.Migrating()
+	status.Maintenance = s.maintenance
+	status.GPUDegraded = s.gpuDegraded
+	if s.tpmBroker != nil {
+		stats := s.tpmBroker.Stats()
+		status.TPMBroker = &stats
+	}
+	if s.badgeLimiter != nil {
+		stats := s.badgeLimiter.Stats()
+		status.BadgeLimit = &stats
+	}
+	if s.nonces != nil {
+		stats := s.nonces.Stats()
+		status.Nonces = &stats
+	}
+	if s.modelWaker != nil {
+		stats := s.modelWaker.Stats()
+		status.ModelWake = &stats
+	}
+	if s.rekUsage != nil {
+		usage := s.rekUsage.usage()
+		status.REKUsage = &usage
+	}
+	if s.startupLatency != nil {
+		stats := s.startupLatency.stats()
+		status.StartupLatency = &stats
+	}
+	if s.modelSpend != nil {
+		status.ModelSpend = s.modelSpend.stats()
+	}
+	if s.promptSize != nil {
+		stats := s.promptSize.stats()
+		status.PromptSize = &stats
+	}
+	if s.expiry != nil {
+		expiry := s.expiry.status()
+		status.EvidenceExpiry = &expiry
+	}
+
+	status.Evidence = make([]AdminEvidenceSummary, 0, len(s.evidence))
+	for _, item := range s.evidence {
+		status.Evidence = append(status.Evidence, AdminEvidenceSummary{
+			Type:         fmt.Sprint(item.Type),
+			DataLen:      len(item.Data),
+			SignatureLen: len(item.Signature),
+		})
+	}
+
+	return status
+}
+
+// SetDraining toggles drain mode. While draining, new requests are rejected and the
+// health check reports the node as unhealthy.
+func (s *Service) SetDraining(draining bool) {
+	s.state.setDraining(draining)
+}
+
+// Draining reports whether the service is in drain mode.
+func (s *Service) Draining() bool {
+	return s.state.isDraining()
+}
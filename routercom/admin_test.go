@@ -0,0 +1,346 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/debug"
+	"github.com/confidentsecurity/confidentcompute/listen"
+	"github.com/confidentsecurity/confidentcompute/modelwake"
+	"github.com/confidentsecurity/confidentcompute/routercom/capabilities"
+	"github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/confidentsecurity/confidentcompute/routercom/modelstate"
+	"github.com/confidentsecurity/confidentcompute/tpmbroker"
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminServer(t *testing.T) {
+	newService := func() *Service {
+		return &Service{
+			evidence: ev.SignedEvidenceList{
+				&ev.SignedEvidencePiece{
+					Type:      ev.SevSnpReport,
+					Data:      []byte("secret-data"),
+					Signature: []byte("sig"),
+				},
+			},
+			state: newServiceState(),
+		}
+	}
+
+	doRequest := func(t *testing.T, admin *AdminServer, method, path string) AdminStatus {
+		req := httptest.NewRequest(method, path, nil)
+		rec := httptest.NewRecorder()
+		admin.server.Handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var status AdminStatus
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&status))
+		return status
+	}
+
+	t.Run("ok, status reports state without evidence contents", func(t *testing.T) {
+		svc := newService()
+		svc.state.requestQueued()
+		svc.state.workerStarted(123)
+		svc.state.workerStarted(456)
+		svc.state.workerExited(456, 10)
+		svc.state.validationError("invalid media type")
+		svc.state.validationError("invalid media type")
+
+		admin := NewAdminServer(&AdminConfig{}, svc)
+		status := doRequest(t, admin, http.MethodGet, "/status")
+
+		require.False(t, status.Draining)
+		require.Equal(t, 1, status.QueueDepth)
+		require.Len(t, status.Workers, 1)
+		require.Equal(t, 123, status.Workers[0].PID)
+		require.Equal(t, map[string]uint64{"invalid media type": 2}, status.ValidationErrors)
+		require.Equal(t, map[string]uint64{"10": 1}, status.WorkerExitCodes)
+		require.Len(t, status.Evidence, 1)
+		require.Equal(t, len("secret-data"), status.Evidence[0].DataLen)
+		require.Equal(t, len("sig"), status.Evidence[0].SignatureLen)
+	})
+
+	t.Run("ok, status reports model states and cold models are not warm", func(t *testing.T) {
+		svc := newService()
+		svc.state.setModelStates([]modelstate.State{
+			{Model: "llama3.2:1b", Warm: true},
+			{Model: "gemma3:1b", Reason: "does not fit in gpu memory budget"},
+		})
+
+		admin := NewAdminServer(&AdminConfig{}, svc)
+		status := doRequest(t, admin, http.MethodGet, "/status")
+
+		require.Len(t, status.Models, 2)
+		require.Equal(t, []string{"llama3.2:1b", "qwen2:1.5b-instruct"}, svc.WarmModels([]string{"llama3.2:1b", "gemma3:1b", "qwen2:1.5b-instruct"}))
+	})
+
+	t.Run("ok, status reports advertised capabilities", func(t *testing.T) {
+		svc := newService()
+		svc.config = &Config{
+			Capabilities: &capabilities.Config{
+				Models:        []capabilities.Model{{Name: "llama3.2:1b", ContextSize: 131072}},
+				ProtectedPCIe: true,
+			},
+		}
+
+		admin := NewAdminServer(&AdminConfig{}, svc)
+		require.Nil(t, doRequest(t, admin, http.MethodGet, "/status").Capabilities)
+
+		adv := svc.AdvertiseCapabilities([]string{"llama3.2:1b"})
+		status := doRequest(t, admin, http.MethodGet, "/status")
+		require.Equal(t, adv, status.Capabilities)
+		require.Equal(t, 131072, status.Capabilities.Models[0].ContextSize)
+		require.True(t, status.Capabilities.ProtectedPCIe)
+		require.False(t, status.Capabilities.CPUOnly)
+	})
+
+	t.Run("ok, benchmarked models advertise their performance", func(t *testing.T) {
+		svc := newService()
+		svc.config = &Config{}
+		svc.state.setModelStates([]modelstate.State{
+			{Model: "llama3.2:1b", Warm: true, Benchmark: &modelstate.Benchmark{TokensPerSecond: 95.5, TTFT: 250 * time.Millisecond, Tier: "high"}},
+			{Model: "gemma3:1b", Warm: true},
+		})
+
+		adv := svc.AdvertiseCapabilities([]string{"llama3.2:1b", "gemma3:1b"})
+		require.Equal(t, &capabilities.Performance{TokensPerSecond: 95.5, TTFTMillis: 250, Tier: "high"}, adv.Models[0].Performance)
+		require.Nil(t, adv.Models[1].Performance)
+	})
+
+	t.Run("ok, sleeping models are only advertised with a model waker", func(t *testing.T) {
+		svc := newService()
+		svc.config = &Config{}
+		svc.state.setModelStates([]modelstate.State{
+			{Model: "llama3.2:1b", Warm: true},
+			{Model: "gemma3:1b", Warm: true, Sleeping: true, EngineURL: "http://localhost:8001"},
+		})
+
+		require.Equal(t, []string{"llama3.2:1b"}, svc.WarmModels([]string{"llama3.2:1b", "gemma3:1b"}))
+
+		svc.modelWaker = modelwake.New(&modelwake.Config{}, svc.state.modelStates(), http.DefaultClient)
+		models := svc.WarmModels([]string{"llama3.2:1b", "gemma3:1b"})
+		require.Equal(t, []string{"llama3.2:1b", "gemma3:1b"}, models)
+
+		adv := svc.AdvertiseCapabilities(models)
+		require.False(t, adv.Models[0].Sleeping)
+		require.True(t, adv.Models[1].Sleeping)
+	})
+
+	t.Run("ok, cpu-only node is tagged in advertised capabilities", func(t *testing.T) {
+		svc := newService()
+		svc.config = &Config{}
+		svc.cpuOnly = true
+
+		adv := svc.AdvertiseCapabilities([]string{"llama3.2:1b"})
+		require.True(t, adv.CPUOnly)
+
+		tag, err := adv.Tag()
+		require.NoError(t, err)
+		parsed, err := capabilities.ParseTag(tag)
+		require.NoError(t, err)
+		require.True(t, parsed.CPUOnly)
+	})
+
+	t.Run("ok, experimental routes are advertised", func(t *testing.T) {
+		svc := newService()
+		svc.config = &Config{}
+		require.Nil(t, svc.AdvertiseCapabilities([]string{"llama3.2:1b"}).ExperimentalRoutes)
+
+		svc.experimentalRoutes = []string{"/v1/responses"}
+		adv := svc.AdvertiseCapabilities([]string{"llama3.2:1b"})
+		tag, err := adv.Tag()
+		require.NoError(t, err)
+		parsed, err := capabilities.ParseTag(tag)
+		require.NoError(t, err)
+		require.Equal(t, []string{"/v1/responses"}, parsed.ExperimentalRoutes)
+	})
+
+	t.Run("ok, gpu degraded node only advertises cpu models", func(t *testing.T) {
+		svc := newService()
+		svc.config = &Config{
+			Capabilities: &capabilities.Config{
+				Models: []capabilities.Model{{Name: "llama3.2:1b", CPU: true}, {Name: "llama3.3:70b"}},
+			},
+		}
+		svc.gpuDegraded = &evidence.GPUDegraded{Reason: "nras unavailable", RetryAfterSeconds: 1800}
+
+		models := svc.WarmModels([]string{"llama3.2:1b", "llama3.3:70b", "gemma3:1b"})
+		require.Equal(t, []string{"llama3.2:1b"}, models)
+
+		adv := svc.AdvertiseCapabilities(models)
+		require.True(t, adv.CPUOnly)
+		require.True(t, adv.GPUDegraded)
+
+		admin := NewAdminServer(&AdminConfig{}, svc)
+		status := doRequest(t, admin, http.MethodGet, "/status")
+		require.Equal(t, svc.gpuDegraded, status.GPUDegraded)
+	})
+
+	t.Run("ok, status reports tpm broker stats when enabled", func(t *testing.T) {
+		svc := newService()
+		admin := NewAdminServer(&AdminConfig{}, svc)
+		require.Nil(t, doRequest(t, admin, http.MethodGet, "/status").TPMBroker)
+
+		svc.tpmBroker = tpmbroker.New(&tpmbroker.Config{MaxConcurrent: 1})
+		status := doRequest(t, admin, http.MethodGet, "/status")
+		require.Equal(t, &tpmbroker.Stats{}, status.TPMBroker)
+	})
+
+	t.Run("ok, toggle drain mode", func(t *testing.T) {
+		svc := newService()
+		admin := NewAdminServer(&AdminConfig{}, svc)
+
+		status := doRequest(t, admin, http.MethodPost, "/drain")
+		require.True(t, status.Draining)
+		require.True(t, svc.Draining())
+
+		status = doRequest(t, admin, http.MethodPost, "/undrain")
+		require.False(t, status.Draining)
+		require.False(t, svc.Draining())
+	})
+
+	t.Run("ok, migrate drains and can't be undone", func(t *testing.T) {
+		svc := newService()
+		svc.migrating = make(chan struct{})
+		admin := NewAdminServer(&AdminConfig{}, svc)
+
+		status := doRequest(t, admin, http.MethodPost, "/migrate")
+		require.True(t, status.Draining)
+		require.True(t, status.Migrating)
+
+		// migrating again is a no-op.
+		status = doRequest(t, admin, http.MethodPost, "/migrate")
+		require.True(t, status.Migrating)
+
+		rec := httptest.NewRecorder()
+		admin.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/undrain", nil))
+		require.Equal(t, http.StatusConflict, rec.Code)
+		require.True(t, svc.Draining())
+	})
+
+	t.Run("ok, override and reset log level", func(t *testing.T) {
+		t.Cleanup(debug.ResetLevel)
+		admin := NewAdminServer(&AdminConfig{}, newService())
+
+		setLevel := func(t *testing.T, body string) (int, AdminLogLevel) {
+			req := httptest.NewRequest(http.MethodPost, "/log_level", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			admin.server.Handler.ServeHTTP(rec, req)
+
+			var level AdminLogLevel
+			if rec.Code == http.StatusOK {
+				require.NoError(t, json.NewDecoder(rec.Body).Decode(&level))
+			}
+			return rec.Code, level
+		}
+
+		code, level := setLevel(t, `{"level":"debug"}`)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, AdminLogLevel{Level: "DEBUG", Overridden: true}, level)
+		got, ok := debug.Level()
+		require.True(t, ok)
+		require.Equal(t, slog.LevelDebug, got)
+
+		code, _ = setLevel(t, `{"level":"verbose"}`)
+		require.Equal(t, http.StatusBadRequest, code)
+
+		code, level = setLevel(t, `{"level":""}`)
+		require.Equal(t, http.StatusOK, code)
+		require.False(t, level.Overridden)
+		_, ok = debug.Level()
+		require.False(t, ok)
+	})
+
+	t.Run("ok, draining node rejects requests and reports unhealthy", func(t *testing.T) {
+		svc := newService()
+		setupHandlers(svc)
+		svc.SetDraining(true)
+
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+		rec = httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_health", nil))
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+
+	t.Run("ok, maintenance node rejects requests, reports unhealthy and discloses the claim", func(t *testing.T) {
+		svc := newService()
+		setupHandlers(svc)
+		svc.maintenance = &evidence.Maintenance{Reason: "INC-1234"}
+
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+		rec = httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_health", nil))
+		require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+		admin := NewAdminServer(&AdminConfig{}, svc)
+		status := doRequest(t, admin, http.MethodGet, "/status")
+		require.Equal(t, &evidence.Maintenance{Reason: "INC-1234"}, status.Maintenance)
+	})
+}
+
+func TestAdminServerStart(t *testing.T) {
+	t.Run("ok, disabled by default", func(t *testing.T) {
+		require.False(t, DefaultConfig().Admin.Enabled())
+	})
+
+	t.Run("ok, socket in a private directory", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.Chmod(dir, 0o700))
+
+		admin := NewAdminServer(&AdminConfig{Socket: filepath.Join(dir, "admin.sock")}, &Service{state: newServiceState()})
+		require.NoError(t, admin.Start())
+		t.Cleanup(func() {
+			require.NoError(t, admin.Close())
+		})
+
+		info, err := os.Stat(filepath.Join(dir, "admin.sock"))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	t.Run("fail, socket in a world writable directory", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.Chmod(dir, 0o777))
+
+		admin := NewAdminServer(&AdminConfig{Socket: filepath.Join(dir, "admin.sock")}, &Service{state: newServiceState()})
+		require.Error(t, admin.Start())
+	})
+	t.Run("fail, vsock address", func(t *testing.T) {
+		cfg := &AdminConfig{Address: &listen.Config{Network: listen.VSock, Address: "3:6070"}}
+		admin := NewAdminServer(cfg, &Service{state: newServiceState()})
+		require.Error(t, admin.Start())
+	})
+}
@@ -0,0 +1,53 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker"
+)
+
+// pickBackend picks the LLM backend for a request, empty when no backends are configured and the
+// worker uses llm_base_url. Requests with the same session hint stick to the same backend using
+// rendezvous hashing, so adding or removing a backend only moves the sessions of that backend.
+// Requests without a valid hint are spread round-robin.
+func (s *Service) pickBackend(hint string) string {
+	if s.config == nil || s.config.Worker == nil || len(s.config.Worker.LLMBackends) == 0 {
+		return ""
+	}
+	backends := s.config.Worker.LLMBackends
+
+	if !computeworker.ValidSessionHint(hint) {
+		i := s.backendSeq.Add(1) - 1
+		return backends[i%uint64(len(backends))]
+	}
+
+	var (
+		best      string
+		bestScore []byte
+	)
+	for _, backend := range backends {
+		score := sha256.Sum256([]byte(backend + "\x00" + hint))
+		if bestScore == nil || bytes.Compare(score[:], bestScore) > 0 {
+			best, bestScore = backend, score[:]
+		}
+	}
+	return best
+}
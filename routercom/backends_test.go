@@ -0,0 +1,69 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickBackend(t *testing.T) {
+	backends := []string{"http://10.0.0.1:8000", "http://10.0.0.2:8000", "http://10.0.0.3:8000"}
+	newService := func(backends []string) *Service {
+		return &Service{config: &Config{Worker: &WorkerConfig{LLMBackends: backends}}}
+	}
+
+	t.Run("ok, no backends", func(t *testing.T) {
+		require.Empty(t, newService(nil).pickBackend(""))
+	})
+
+	t.Run("ok, requests with the same hint stick to a backend", func(t *testing.T) {
+		svc := newService(backends)
+		hint := computeworker.SessionHint([]byte("key"), []byte("badge"), []byte("prefix"))
+		backend := svc.pickBackend(hint)
+		require.Contains(t, backends, backend)
+		for range 10 {
+			require.Equal(t, backend, svc.pickBackend(hint))
+		}
+	})
+
+	t.Run("ok, removing a backend only moves its sessions", func(t *testing.T) {
+		all := newService(backends)
+		fewer := newService(backends[:2])
+		for i := range 50 {
+			hint := computeworker.SessionHint([]byte("key"), []byte("badge"), fmt.Appendf(nil, "prefix %d", i))
+			if backend := all.pickBackend(hint); backend != backends[2] {
+				require.Equal(t, backend, fewer.pickBackend(hint))
+			}
+		}
+	})
+
+	t.Run("ok, requests without a valid hint are spread round-robin", func(t *testing.T) {
+		svc := newService(backends)
+		for _, hint := range []string{"", "not-a-hint"} {
+			picked := map[string]int{}
+			for range 3 * len(backends) {
+				picked[svc.pickBackend(hint)]++
+			}
+			require.Equal(t, map[string]int{backends[0]: 3, backends[1]: 3, backends[2]: 3}, picked)
+		}
+	})
+}
@@ -0,0 +1,207 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package capabilities is the structured capability advertisement of a compute node. router_com
+// serializes it into a router agent tag so the router can route on more than the model name.
+package capabilities
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// TagPrefix prefixes the router agent tag that carries the advertisement.
+	TagPrefix = "capabilities="
+	// Version is the version of the advertisement schema.
+	Version = 1
+)
+
+// Modality is a kind of input a model accepts.
+type Modality string
+
+const (
+	ModalityText  Modality = "text"
+	ModalityImage Modality = "image"
+	ModalityAudio Modality = "audio"
+)
+
+// Model describes the capabilities of a single model.
+type Model struct {
+	// Name is the name of the model as used in requests.
+	Name string `json:"name" yaml:"name"`
+	// ContextSize is the context window of the model in tokens, 0 if unknown.
+	ContextSize int `json:"context_size,omitempty" yaml:"context_size"`
+	// Quantization is the quantization of the model weights, e.g. "q4_K_M". Empty if unknown.
+	Quantization string `json:"quantization,omitempty" yaml:"quantization"`
+	// Modalities are the kinds of input the model accepts. Defaults to text only.
+	Modalities []Modality `json:"modalities" yaml:"modalities"`
+	// CPU is true when the model can be served without GPUs. Only CPU models are advertised while
+	// the GPUs of the node are not attested.
+	CPU bool `json:"cpu,omitempty" yaml:"cpu"`
+	// Performance is measured by compute_boot at startup, nil when the model was not benchmarked.
+	Performance *Performance `json:"performance,omitempty" yaml:"-"`
+	// Sleeping is true when compute_boot put the model to sleep at startup, the first request for it
+	// waits for it to wake up. The advertisement is not updated once it is awake.
+	Sleeping bool `json:"sleeping,omitempty" yaml:"-"`
+}
+
+// Performance is the measured performance of a model on this node.
+type Performance struct {
+	// TokensPerSecond is the output throughput of a single request.
+	TokensPerSecond float64 `json:"tokens_per_second"`
+	// TTFTMillis is the time to the first output token in milliseconds.
+	TTFTMillis int64 `json:"ttft_ms"`
+	// Tier is the performance tier of the model, empty if it reaches no tier.
+	Tier string `json:"tier,omitempty"`
+}
+
+// Config is the operator provided description of the node.
+type Config struct {
+	// Models describes the installed models. Installed models that are not listed are
+	// advertised as text only models without further details.
+	Models []Model `yaml:"models"`
+	// MaxConcurrency is the number of requests the node serves concurrently, 0 if unbounded.
+	MaxConcurrency int `yaml:"max_concurrency"`
+	// ProtectedPCIe is true when the GPUs run in protected PCIe mode.
+	ProtectedPCIe bool `yaml:"protected_pcie"`
+}
+
+// Advertisement is what a node advertises to the router.
+type Advertisement struct {
+	Version        int     `json:"version"`
+	Models         []Model `json:"models"`
+	MaxConcurrency int     `json:"max_concurrency,omitempty"`
+	ProtectedPCIe  bool    `json:"protected_pcie"`
+	// CPUOnly is true when the node serves inference without GPUs, its evidence then
+	// contains a CPU-only marker instead of GPU evidence.
+	CPUOnly bool `json:"cpu_only"`
+	// GPUDegraded is true when the node has GPUs that couldn't be attested, e.g. during an NRAS
+	// outage. Its evidence then contains a GPU degraded marker instead of GPU evidence, and only
+	// CPU models are advertised.
+	GPUDegraded bool `json:"gpu_degraded,omitempty"`
+	// ExperimentalRoutes are the experimental routes the node serves, they are disclosed in its
+	// evidence. Stable nodes have none.
+	ExperimentalRoutes []string `json:"experimental_routes,omitempty"`
+}
+
+// New creates the advertisement for the given models, using the details in cfg where available.
+func New(cfg *Config, models []string) *Advertisement {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	adv := &Advertisement{
+		Version:        Version,
+		Models:         make([]Model, 0, len(models)),
+		MaxConcurrency: cfg.MaxConcurrency,
+		ProtectedPCIe:  cfg.ProtectedPCIe,
+	}
+
+	for _, name := range models {
+		model := Model{Name: name}
+		i := slices.IndexFunc(cfg.Models, func(m Model) bool {
+			return m.Name == name
+		})
+		if i >= 0 {
+			model = cfg.Models[i]
+			model.Modalities = slices.Clone(model.Modalities)
+		}
+		if len(model.Modalities) == 0 {
+			model.Modalities = []Modality{ModalityText}
+		}
+		adv.Models = append(adv.Models, model)
+	}
+
+	return adv
+}
+
+// Validate checks the config for mistakes an operator could make.
+func (c *Config) Validate() error {
+	if c.MaxConcurrency < 0 {
+		return errors.New("max concurrency can't be negative")
+	}
+
+	seen := map[string]bool{}
+	for _, model := range c.Models {
+		if model.Name == "" {
+			return errors.New("model without name")
+		}
+		if seen[model.Name] {
+			return fmt.Errorf("duplicate model %s", model.Name)
+		}
+		seen[model.Name] = true
+
+		if model.ContextSize < 0 {
+			return fmt.Errorf("model %s: context size can't be negative", model.Name)
+		}
+		for _, modality := range model.Modalities {
+			if !modality.valid() {
+				return fmt.Errorf("model %s: unknown modality %q", model.Name, modality)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (m Modality) valid() bool {
+	switch m {
+	case ModalityText, ModalityImage, ModalityAudio:
+		return true
+	default:
+		return false
+	}
+}
+
+// Tag serializes the advertisement into a router agent tag. The JSON is base64url encoded
+// so the tag can't contain separators the router uses for tags.
+func (a *Advertisement) Tag() (string, error) {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal capabilities: %w", err)
+	}
+	return TagPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ParseTag parses an advertisement from a router agent tag created with Tag.
+func ParseTag(tag string) (*Advertisement, error) {
+	encoded, ok := strings.CutPrefix(tag, TagPrefix)
+	if !ok {
+		return nil, errors.New("not a capabilities tag")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode capabilities: %w", err)
+	}
+
+	var adv Advertisement
+	if err := json.Unmarshal(b, &adv); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal capabilities: %w", err)
+	}
+
+	if adv.Version != Version {
+		return nil, fmt.Errorf("unsupported capabilities version %d", adv.Version)
+	}
+
+	return &adv, nil
+}
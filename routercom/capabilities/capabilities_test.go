@@ -0,0 +1,140 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package capabilities
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	cfg := &Config{
+		Models: []Model{
+			{
+				Name:         "gemma3:4b",
+				ContextSize:  131072,
+				Quantization: "q4_K_M",
+				Modalities:   []Modality{ModalityText, ModalityImage},
+			},
+			{
+				Name: "not-installed",
+			},
+		},
+		MaxConcurrency: 4,
+		ProtectedPCIe:  true,
+	}
+
+	adv := New(cfg, []string{"gemma3:4b", "llama3.2:1b"})
+	require.Equal(t, &Advertisement{
+		Version: Version,
+		Models: []Model{
+			{
+				Name:         "gemma3:4b",
+				ContextSize:  131072,
+				Quantization: "q4_K_M",
+				Modalities:   []Modality{ModalityText, ModalityImage},
+			},
+			{
+				Name:       "llama3.2:1b",
+				Modalities: []Modality{ModalityText},
+			},
+		},
+		MaxConcurrency: 4,
+		ProtectedPCIe:  true,
+	}, adv)
+}
+
+func TestTag(t *testing.T) {
+	t.Run("ok, round trip", func(t *testing.T) {
+		adv := New(&Config{MaxConcurrency: 2}, []string{"llama3.2:1b"})
+
+		tag, err := adv.Tag()
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(tag, TagPrefix))
+		require.NotContains(t, tag[len(TagPrefix):], "=")
+
+		got, err := ParseTag(tag)
+		require.NoError(t, err)
+		require.Equal(t, adv, got)
+	})
+
+	tests := map[string]string{
+		"fail, other tag":           "model=llama3.2:1b",
+		"fail, invalid encoding":    TagPrefix + "not base64!",
+		"fail, invalid json":        TagPrefix + "bm90IGpzb24",
+		"fail, unsupported version": TagPrefix + "eyJ2ZXJzaW9uIjoyfQ",
+	}
+	for name, tag := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseTag(tag)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		cfg     Config
+		wantErr bool
+	}{
+		"ok, empty": {
+			cfg: Config{},
+		},
+		"ok, models": {
+			cfg: Config{
+				Models: []Model{
+					{Name: "a", ContextSize: 8192, Modalities: []Modality{ModalityText, ModalityAudio}},
+					{Name: "b"},
+				},
+			},
+		},
+		"fail, negative max concurrency": {
+			cfg:     Config{MaxConcurrency: -1},
+			wantErr: true,
+		},
+		"fail, model without name": {
+			cfg:     Config{Models: []Model{{ContextSize: 1}}},
+			wantErr: true,
+		},
+		"fail, duplicate model": {
+			cfg:     Config{Models: []Model{{Name: "a"}, {Name: "a"}}},
+			wantErr: true,
+		},
+		"fail, negative context size": {
+			cfg:     Config{Models: []Model{{Name: "a", ContextSize: -1}}},
+			wantErr: true,
+		},
+		"fail, unknown modality": {
+			cfg:     Config{Models: []Model{{Name: "a", Modalities: []Modality{"video"}}}},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.cfg.Validate()
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CgroupConfig is config for scoping each compute_worker process to its own cgroup v2, so a
+// single pathological request can't exhaust the resources of router_com or the inference backend.
+type CgroupConfig struct {
+	// Parent is the cgroup v2 directory under which a cgroup is created for every worker,
+	// for example /sys/fs/cgroup/compute_worker. It must not contain processes itself.
+	Parent string `yaml:"parent"`
+	// MemoryMax is the memory.max of a worker in bytes. Leave 0 for no limit.
+	MemoryMax int64 `yaml:"memory_max"`
+	// PidsMax is the pids.max of a worker. Leave 0 for no limit.
+	PidsMax int64 `yaml:"pids_max"`
+	// CPUWeight is the cpu.weight of a worker in [1, 10000]. Leave 0 for the kernel default of 100.
+	CPUWeight uint64 `yaml:"cpu_weight"`
+}
+
+// controllers returns the cgroup controllers required by the configured limits.
+func (c *CgroupConfig) controllers() []string {
+	var controllers []string
+	if c.CPUWeight > 0 {
+		controllers = append(controllers, "cpu")
+	}
+	if c.MemoryMax > 0 {
+		controllers = append(controllers, "memory")
+	}
+	if c.PidsMax > 0 {
+		controllers = append(controllers, "pids")
+	}
+	return controllers
+}
+
+// setupCgroupParent creates the parent cgroup and enables the controllers required by the
+// configured limits for its children.
+func setupCgroupParent(cfg *CgroupConfig) error {
+	if cfg.Parent == "" {
+		return errors.New("missing cgroup parent")
+	}
+
+	if cfg.MemoryMax < 0 || cfg.PidsMax < 0 {
+		return errors.New("cgroup limits must not be negative")
+	}
+
+	if cfg.CPUWeight > 10000 {
+		return fmt.Errorf("invalid cpu weight %d, must be in [1, 10000]", cfg.CPUWeight)
+	}
+
+	if err := os.MkdirAll(cfg.Parent, 0o755); err != nil {
+		return fmt.Errorf("failed to create cgroup parent: %w", err)
+	}
+
+	controllers := cfg.controllers()
+	if len(controllers) == 0 {
+		return nil
+	}
+
+	available, err := os.ReadFile(filepath.Join(cfg.Parent, "cgroup.controllers"))
+	if err != nil {
+		return fmt.Errorf("failed to read available cgroup controllers, is %s on a cgroup v2 hierarchy?: %w", cfg.Parent, err)
+	}
+
+	enable := make([]string, 0, len(controllers))
+	for _, controller := range controllers {
+		if !slices.Contains(strings.Fields(string(available)), controller) {
+			return fmt.Errorf("cgroup controller %s is not available in %s", controller, cfg.Parent)
+		}
+		enable = append(enable, "+"+controller)
+	}
+
+	err = os.WriteFile(filepath.Join(cfg.Parent, "cgroup.subtree_control"), []byte(strings.Join(enable, " ")), 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to enable cgroup controllers: %w", err)
+	}
+
+	return nil
+}
+
+// workerCgroup is the cgroup of a single compute_worker process.
+type workerCgroup struct {
+	path string
+	dir  *os.File
+}
+
+// newWorkerCgroup creates a cgroup with the configured limits. The process is placed in the cgroup
+// when it is started, via the file descriptor returned by fd.
+func newWorkerCgroup(cfg *CgroupConfig, name string) (*workerCgroup, error) {
+	path := filepath.Join(cfg.Parent, name)
+	if err := os.Mkdir(path, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+
+	cg := &workerCgroup{path: path}
+
+	limits := map[string]string{}
+	if cfg.MemoryMax > 0 {
+		limits["memory.max"] = strconv.FormatInt(cfg.MemoryMax, 10)
+		// don't let the worker escape its memory limit by swapping.
+		limits["memory.swap.max"] = "0"
+	}
+	if cfg.PidsMax > 0 {
+		limits["pids.max"] = strconv.FormatInt(cfg.PidsMax, 10)
+	}
+	if cfg.CPUWeight > 0 {
+		limits["cpu.weight"] = strconv.FormatUint(cfg.CPUWeight, 10)
+	}
+
+	for file, value := range limits {
+		err := os.WriteFile(filepath.Join(path, file), []byte(value), 0o644)
+		// memory.swap.max doesn't exist when swap accounting is disabled, in which case there is nothing to escape to.
+		if file == "memory.swap.max" && errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to set %s: %w", file, err), cg.Close())
+		}
+	}
+
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to open cgroup: %w", err), cg.Close())
+	}
+	cg.dir = dir
+
+	return cg, nil
+}
+
+// fd is the file descriptor to pass as SysProcAttr.CgroupFD.
+func (c *workerCgroup) fd() int {
+	return int(c.dir.Fd())
+}
+
+// oomKilled reports whether a process in the cgroup was killed for exceeding memory.max.
+func (c *workerCgroup) oomKilled() (bool, error) {
+	events, err := os.ReadFile(filepath.Join(c.path, "memory.events"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// memory controller is not enabled.
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read memory events: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(events))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok || key != "oom_kill" {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid oom_kill count %q: %w", value, err)
+		}
+		return n > 0, nil
+	}
+
+	return false, scanner.Err()
+}
+
+// Close removes the cgroup. All processes in the cgroup must have exited.
+func (c *workerCgroup) Close() error {
+	var err error
+	if c.dir != nil {
+		err = c.dir.Close()
+	}
+	return errors.Join(err, os.Remove(c.path))
+}
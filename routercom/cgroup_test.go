@@ -0,0 +1,105 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerCgroup(t *testing.T) {
+	// newParent fakes a cgroup v2 parent directory with the given available controllers.
+	newParent := func(t *testing.T, controllers string) string {
+		parent := filepath.Join(t.TempDir(), "compute_worker")
+		require.NoError(t, os.Mkdir(parent, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(parent, "cgroup.controllers"), []byte(controllers), 0o644))
+		return parent
+	}
+
+	readFile := func(t *testing.T, path string) string {
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	t.Run("ok, limits are written to the worker cgroup", func(t *testing.T) {
+		cfg := &CgroupConfig{
+			Parent:    newParent(t, "cpuset cpu io memory pids\n"),
+			MemoryMax: 512 * 1024 * 1024,
+			PidsMax:   64,
+			CPUWeight: 50,
+		}
+		require.NoError(t, setupCgroupParent(cfg))
+		require.Equal(t, "+cpu +memory +pids", readFile(t, filepath.Join(cfg.Parent, "cgroup.subtree_control")))
+
+		cg, err := newWorkerCgroup(cfg, "worker-1")
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = cg.dir.Close() })
+
+		require.Equal(t, "536870912", readFile(t, filepath.Join(cg.path, "memory.max")))
+		require.Equal(t, "0", readFile(t, filepath.Join(cg.path, "memory.swap.max")))
+		require.Equal(t, "64", readFile(t, filepath.Join(cg.path, "pids.max")))
+		require.Equal(t, "50", readFile(t, filepath.Join(cg.path, "cpu.weight")))
+	})
+
+	t.Run("ok, no limits does not enable controllers", func(t *testing.T) {
+		cfg := &CgroupConfig{Parent: newParent(t, "")}
+		require.NoError(t, setupCgroupParent(cfg))
+		require.NoFileExists(t, filepath.Join(cfg.Parent, "cgroup.subtree_control"))
+	})
+
+	t.Run("ok, oom kills are reported", func(t *testing.T) {
+		cg := &workerCgroup{path: t.TempDir()}
+		oomKilled, err := cg.oomKilled()
+		require.NoError(t, err)
+		require.False(t, oomKilled)
+
+		events := "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\noom_group_kill 0\n"
+		require.NoError(t, os.WriteFile(filepath.Join(cg.path, "memory.events"), []byte(events), 0o644))
+		oomKilled, err = cg.oomKilled()
+		require.NoError(t, err)
+		require.True(t, oomKilled)
+	})
+
+	t.Run("fail, controller not available", func(t *testing.T) {
+		cfg := &CgroupConfig{
+			Parent:    newParent(t, "cpu memory"),
+			MemoryMax: 1024,
+			PidsMax:   64,
+		}
+		require.ErrorContains(t, setupCgroupParent(cfg), "pids is not available")
+	})
+
+	t.Run("fail, invalid cpu weight", func(t *testing.T) {
+		cfg := &CgroupConfig{
+			Parent:    newParent(t, "cpu"),
+			CPUWeight: 10001,
+		}
+		require.Error(t, setupCgroupParent(cfg))
+	})
+
+	t.Run("fail, worker cgroup already exists", func(t *testing.T) {
+		cfg := &CgroupConfig{Parent: newParent(t, "")}
+		require.NoError(t, os.Mkdir(filepath.Join(cfg.Parent, "worker-1"), 0o755))
+		_, err := newWorkerCgroup(cfg, "worker-1")
+		require.Error(t, err)
+	})
+}
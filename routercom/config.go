@@ -19,6 +19,15 @@ package routercom
 
 import (
 	"time"
+
+	"github.com/confidentsecurity/confidentcompute/backendpool"
+	"github.com/confidentsecurity/confidentcompute/badgelimit"
+	"github.com/confidentsecurity/confidentcompute/computeworker"
+	"github.com/confidentsecurity/confidentcompute/faultinject"
+	"github.com/confidentsecurity/confidentcompute/modelwake"
+	"github.com/confidentsecurity/confidentcompute/routercom/capabilities"
+	"github.com/confidentsecurity/confidentcompute/routercom/modelstate"
+	"github.com/confidentsecurity/confidentcompute/tpmbroker"
 )
 
 const (
@@ -33,6 +42,50 @@ type Config struct {
 	// CheckComputeBootExit controls whether to verify compute_boot service has exited before serving requests.
 	// Set to false for local dev environments without systemd.
 	CheckComputeBootExit bool `yaml:"check_compute_boot_exit"`
+	// Admin is config for the local admin API
+	Admin *AdminConfig `yaml:"admin"`
+	// ModelStateFile is where compute_boot writes the warm/cold state of each model. Cold models
+	// are not advertised to the router. Leave blank to treat all models as warm.
+	ModelStateFile string `yaml:"model_state_file"`
+	// Policy is config for signed policy bundles distributed by the router.
+	Policy *PolicyConfig `yaml:"policy"`
+	// Capabilities describes the models and hardware of the node, advertised to the router.
+	Capabilities *capabilities.Config `yaml:"capabilities"`
+	// TPMBroker is config for the broker that serializes TPM access of the compute_worker processes.
+	TPMBroker *tpmbroker.Config `yaml:"tpm_broker"`
+	// BadgeLimit is config for bounding the parallel requests of a badge, so one tenant can't saturate
+	// the node. Badges can carry their own bound in a claim. Leave blank to not bound badges.
+	BadgeLimit *badgelimit.Config `yaml:"badge_limit"`
+	// ModelWake is config for waking up the models compute_boot put to sleep, when the first request for
+	// them arrives. Leave blank to leave sleeping models asleep.
+	ModelWake *modelwake.Config `yaml:"model_wake"`
+	// RefundCallback is config for delivering refunds to the router with a callback instead of a trailer.
+	RefundCallback *RefundCallbackConfig `yaml:"refund_callback"`
+	// REKUsage is config for counting the requests decapsulated with the REK. Leave blank to disable counting.
+	REKUsage *REKUsageConfig `yaml:"rek_usage"`
+	// FaultInjection injects failures in router_com and compute_worker for resilience testing.
+	// Leave blank on nodes that serve production traffic.
+	FaultInjection *faultinject.Config `yaml:"fault_injection"`
+	// SlowClient ends the responses of clients that read too slowly, so they don't hold a worker and a
+	// GPU slot. Leave blank to wait for clients however slow they are.
+	SlowClient *SlowClientConfig `yaml:"slow_client"`
+	// Shutdown is config for the deregistration sent to the router before router_com exits.
+	Shutdown *ShutdownConfig `yaml:"shutdown"`
+	// StartupLatency is config for aggregating the startup latency the compute_workers report, e.g.
+	// to track cold starts against an SLO. Leave blank to disable the aggregation.
+	StartupLatency *StartupLatencyConfig `yaml:"startup_latency"`
+	// ModelSpend is config for aggregating the credits consumed and refunded per model per hour, for
+	// capacity planning. Leave blank to disable the aggregation.
+	ModelSpend *ModelSpendConfig `yaml:"model_spend"`
+	// PromptSize is config for aggregating histograms of the request body sizes and message counts the
+	// compute_workers report, without any prompt content. Leave blank to disable the aggregation.
+	PromptSize *PromptSizeConfig `yaml:"prompt_size"`
+	// EvidenceRoots is a PEM file with the pinned roots the GPU intermediate certificates of the evidence
+	// must chain to, e.g. the NVIDIA device identity root. Required on nodes with GPU evidence.
+	EvidenceRoots string `yaml:"evidence_roots"`
+	// EvidenceExpiry is config for draining and shutting down the node before its evidence expires.
+	// Leave blank for the defaults.
+	EvidenceExpiry *EvidenceExpiryConfig `yaml:"evidence_expiry"`
 }
 
 type TPM struct {
@@ -42,6 +95,10 @@ type TPM struct {
 	Device string `yaml:"device"`
 	// REKHandle is the TPM handle for the Request Encryption Key
 	REKHandle uint32 `yaml:"rek_handle"`
+	// RefundKeyHandle is the TPM handle of the refund key compute_boot creates, see evidence.RefundKey.
+	// compute_worker signs the refund in the footer with it, so the router can check the refund wasn't
+	// altered on the way. The evidence must disclose the key. Leave 0 to not sign refunds.
+	RefundKeyHandle uint32 `yaml:"refund_key_handle"`
 	// SimulatorCmdAddress is the address to reach out to the simulator's command. Leave blank for default
 	SimulatorCmdAddress string `yaml:"simulator_cmd_address"`
 	// SimulatorPlatformAddress is the address to reach out to the simulator's command. Leave blank for default
@@ -54,12 +111,97 @@ type WorkerConfig struct {
 	BinaryPath string `yaml:"binary_path"`
 	// LLMBaseURL is the local url for talking to an LLM on the system
 	LLMBaseURL string `yaml:"llm_base_url"`
+	// LLMAuthFile contains the Authorization header compute_worker sends to the LLM, e.g. "Bearer <api key>".
+	// The file can be sealed with seal_config. Leave blank to send no Authorization header.
+	LLMAuthFile string `yaml:"llm_auth_file"`
 	// Timeout is how long to wait for the compute_worker to work
 	Timeout time.Duration `yaml:"timeout"`
 	// BadgePublicKey is the public key counterpart to the ed25519 private key that the auth server uses to sign badges
 	BadgePublicKey string `yaml:"badge_public_key"`
 	// Models is the list of LLMs installed on the system
 	Models []string `yaml:"models"`
+	// SimulatedSeed makes simulated responses deterministic when non-zero. Only intended for load testing.
+	SimulatedSeed uint64 `yaml:"simulated_seed"`
+	// EchoNodeRequestID includes the confsec request ID in the encrypted response, so clients can
+	// quote it when reporting an issue.
+	EchoNodeRequestID bool `yaml:"echo_node_request_id"`
+	// HardenedJSON makes compute_worker check request bodies against string, number and nesting
+	// limits while tokenizing them, before they are decoded.
+	HardenedJSON bool `yaml:"hardened_json"`
+	// OutputFilter is the path of a Go plugin compute_worker passes the plaintext output through
+	// before it is encrypted. The module must match the output filter digest in the evidence. Leave
+	// blank to disable output filtering.
+	OutputFilter string `yaml:"output_filter"`
+	// PromptCache lets repeated conversations reuse the vLLM prefix cache. compute_worker salts the
+	// cache of every request with a handle derived from the conversation prefix, a secret the client
+	// sends in the encrypted request and a key generated at startup, so clients can't probe each
+	// others cache. See computeworker.PromptCacheSecretHeader.
+	PromptCache bool `yaml:"prompt_cache"`
+	// SessionHints makes compute_worker return an opaque hint in the footer of every response, derived
+	// from the conversation prefix and the badge with a key generated at startup. Clients send the hint
+	// back with the next turn, so it is routed to the same LLM backend and reuses its prefix cache.
+	SessionHints bool `yaml:"session_hints"`
+	// LLMBackends are the base urls of LLM instances that serve the same models. Requests with a session
+	// hint stick to one backend, other requests are spread round-robin. Leave empty to only use llm_base_url.
+	LLMBackends []string `yaml:"llm_backends"`
+	// ModelBackends are pools of backend replicas of models, e.g. two vLLM instances pinned to different
+	// GPUs. router_com spreads the requests of a model over its backends by weight, probes their health
+	// and skips backends that fail, compute_worker asks it for the backend of every request. Models in a
+	// pool don't use llm_base_url or llm_backends. Leave blank to disable the pools.
+	ModelBackends *backendpool.Config `yaml:"model_backends"`
+	// Cgroup bounds the resources of each compute_worker process. Leave blank to run workers unbounded.
+	Cgroup *CgroupConfig `yaml:"cgroup"`
+	// AuditBodyRules are compute_worker body validation rules in audit mode, violations are logged
+	// but the request is allowed. See computeworker.BodyRule for the available rules.
+	AuditBodyRules []string `yaml:"audit_body_rules"`
+	// BodyMutators are optional compute_worker mutations of request bodies, run in the order given. See
+	// computeworker.ParseBodyMutator for the available mutators.
+	BodyMutators []string `yaml:"body_mutators"`
+	// AllowedHostnames are the hostnames clients may address requests to besides the unroutable
+	// hostname, e.g. vanity hostnames of this deployment. Hostnames are compared case-insensitively.
+	AllowedHostnames []string `yaml:"allowed_hostnames"`
+	// ResponseContentTypes are the media types the LLM may respond with, responses with other content
+	// types are replaced by a 502. Leave empty for json, ndjson and event streams.
+	ResponseContentTypes []string `yaml:"response_content_types"`
+	// EgressDeny are prefixes or addresses compute_worker may not connect to, e.g. internal services of
+	// the host network. Cloud metadata addresses are always denied, see computeworker.DefaultEgressDeny.
+	EgressDeny []string `yaml:"egress_deny"`
+	// EgressPrivateOnly only lets compute_worker connect to loopback, RFC 1918 and unique local addresses,
+	// so a misconfigured backend url can't send plaintext to the internet.
+	EgressPrivateOnly bool `yaml:"egress_private_only"`
+	// BackendResolve pins the hosts of backend urls to addresses as host=address, compute_worker then
+	// dials them without name resolution. Leave empty to resolve hosts with the system resolver.
+	BackendResolve []string `yaml:"backend_resolve"`
+	// Pacing re-times the response chunks to a constant or randomized cadence, so token timing doesn't
+	// leak prompt or response characteristics. Leave blank to disable pacing.
+	Pacing *computeworker.PacingConfig `yaml:"pacing"`
+	// Padding pads responses to size buckets with filler that is encrypted along with the response, so
+	// their length reveals less about their content. Leave blank to disable padding.
+	Padding *computeworker.PaddingConfig `yaml:"padding"`
+	// Continuation makes compute_worker issue a continuation token per tool call in the footer of
+	// responses that end in tool calls. Clients send the tokens back with the follow-up request, its
+	// input is then discounted on the conversation the node already priced. The tokens are signed with
+	// a key generated at startup, so they are only accepted by this node, and are single use, router_com
+	// records their nonces in the ledger at NonceSocket. Leave blank to disable.
+	Continuation *computeworker.ContinuationConfig `yaml:"continuation"`
+	// Pricing overrides the credit pricing of routes, e.g. to price rerank or transcriptions by
+	// request instead of by token. Leave blank to price every route by its tokens.
+	Pricing *computeworker.PricingConfig `yaml:"pricing"`
+	// Mirror duplicates validated requests to a shadow LLM backend on the node, e.g. to validate a
+	// new vLLM version against production traffic. Responses are discarded and not billed. The base url
+	// must be a loopback url and match the one disclosed in the evidence. Leave blank to disable mirroring.
+	Mirror *computeworker.MirrorConfig `yaml:"mirror"`
+	// MaxTopUpCredits bounds the credits the router can grant to a running request, so long generations
+	// don't stop at the credit amount they started with. Grants are signed with the badge key, bound to
+	// the encapsulated key of the request and only reach workers that don't run in a session. Workers
+	// claim them in the ledger at NonceSocket, so a grant is applied once. Leave 0 to disable top-ups.
+	MaxTopUpCredits int64 `yaml:"max_top_up_credits"`
+	// NonceSocket is the unix socket of the nonce ledger that makes continuation tokens and credit grants
+	// single use across the workers of the node, required when either is enabled.
+	NonceSocket string `yaml:"nonce_socket"`
+	// Session reuses compute_worker processes across requests, so the TPM receiver isn't set up for
+	// every request. Leave blank to start a compute_worker per request.
+	Session *WorkerSessionConfig `yaml:"session"`
 }
 
 func DefaultConfig() *Config {
@@ -80,5 +222,17 @@ func DefaultConfig() *Config {
 			Models:         []string{},
 		},
 		CheckComputeBootExit: true,
+		// the admin API is opt-in, see AdminConfig.
+		Admin:          &AdminConfig{},
+		ModelStateFile: modelstate.DefaultFile,
+		Policy:         &PolicyConfig{StateFile: DefaultPolicyStateFile},
+		Capabilities:   &capabilities.Config{},
+		TPMBroker:      tpmbroker.DefaultConfig(),
+		RefundCallback: DefaultRefundCallbackConfig(),
+		REKUsage:       DefaultREKUsageConfig(),
+		StartupLatency: DefaultStartupLatencyConfig(),
+		ModelSpend:     DefaultModelSpendConfig(),
+		PromptSize:     DefaultPromptSizeConfig(),
+		EvidenceExpiry: DefaultEvidenceExpiryConfig(),
 	}
 }
@@ -0,0 +1,85 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// ErrUnauthenticated is returned when the sender of the evidence can't be authenticated.
+var ErrUnauthenticated = errors.New("unauthenticated evidence sender")
+
+// macSize is the size of the HMAC that follows the payload when a secret is configured.
+const macSize = sha256.Size
+
+// minSecretSize is the minimum size of the shared secret in bytes.
+const minSecretSize = 32
+
+// readSecret reads the shared secret the payload is authenticated with. Surrounding whitespace
+// is ignored, so the file can be written with a trailing newline.
+func readSecret(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret file: %w", err)
+	}
+	secret := bytes.TrimSpace(b)
+	if len(secret) < minSecretSize {
+		return nil, fmt.Errorf("secret in %s is %d bytes, need at least %d", path, len(secret), minSecretSize)
+	}
+	return secret, nil
+}
+
+// payloadMAC authenticates the length prefix and the payload with the shared secret.
+func payloadMAC(secret, prefix, data []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(prefix)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// checkPeer checks the credentials of the process on the other end of conn against the
+// expected UID and GID. Without expectations any peer is accepted.
+func (c ReceiveConfig) checkPeer(conn net.Conn) error {
+	if c.PeerUID == nil && c.PeerGID == nil {
+		return nil
+	}
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("%w: not a unix connection", ErrUnauthenticated)
+	}
+	uid, gid, err := peerCredentials(uc)
+	if err != nil {
+		return fmt.Errorf("failed to get peer credentials: %w", err)
+	}
+	if c.PeerUID != nil && uid != *c.PeerUID {
+		return fmt.Errorf("%w: peer uid %d, expected %d", ErrUnauthenticated, uid, *c.PeerUID)
+	}
+	if c.PeerGID != nil && gid != *c.PeerGID {
+		return fmt.Errorf("%w: peer gid %d, expected %d", ErrUnauthenticated, gid, *c.PeerGID)
+	}
+	return nil
+}
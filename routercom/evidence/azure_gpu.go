@@ -0,0 +1,57 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// azureGPULabel prefixes the data of the Azure GPU attestation piece, see labelPrefix.
+var azureGPULabel = []byte("confsec-azure-gpu-v1:")
+
+// AzureGPUAttestation are the artifacts verifiers of Azure confidential GPU VMs require next to
+// the NRAS results of the GPUs.
+type AzureGPUAttestation struct {
+	// MAAToken is the Microsoft Azure Attestation token of the confidential VM. Its nonce claim
+	// is the NRASNonce of the GPU and NVSwitch tokens in the evidence, which binds the two.
+	MAAToken string `json:"maa_token"`
+	// NRASNonce is the nonce the MAA token was requested with, see NRASNonce.
+	NRASNonce string `json:"nras_nonce"`
+}
+
+// NRASNonce returns the hex encoded SHA-256 digest of the NRAS tokens, in the order they
+// appear in the evidence.
+func NRASNonce(tokens []string) string {
+	digest := sha256.Sum256([]byte(strings.Join(tokens, "\n")))
+	return hex.EncodeToString(digest[:])
+}
+
+// AzureGPUPiece returns the evidence piece with the Azure GPU attestation artifacts.
+func AzureGPUPiece(attestation AzureGPUAttestation) (*ev.SignedEvidencePiece, error) {
+	return labelledPiece(azureGPULabel, "azure gpu attestation", attestation)
+}
+
+// FindAzureGPUAttestation returns the Azure GPU attestation from the evidence list, false when
+// the list contains no Azure GPU attestation piece.
+func FindAzureGPUAttestation(list ev.SignedEvidenceList) (AzureGPUAttestation, bool, error) {
+	return findLabelled[AzureGPUAttestation](list, azureGPULabel, "azure gpu attestation")
+}
@@ -0,0 +1,45 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// binaryDigestsLabel prefixes the data of the binary digests piece, see labelPrefix.
+var binaryDigestsLabel = []byte("confsec-binary-digests-v1:")
+
+// BinaryDigest is the digest of a binary that handles plaintext requests.
+type BinaryDigest struct {
+	// Path is where the binary was measured.
+	Path string `json:"path"`
+	// SHA256 is the hex encoded SHA-256 digest of the binary.
+	SHA256 string `json:"sha256"`
+}
+
+// BinaryDigestsPiece returns the evidence piece listing the digests of the binaries measured
+// by compute_boot, in the order they were measured.
+func BinaryDigestsPiece(digests []BinaryDigest) (*ev.SignedEvidencePiece, error) {
+	return labelledPiece(binaryDigestsLabel, "binary digests", digests)
+}
+
+// BinaryDigests returns the binary digests from the evidence list, false when the list
+// contains no binary digests piece.
+func BinaryDigests(list ev.SignedEvidenceList) ([]BinaryDigest, bool, error) {
+	return findLabelled[[]BinaryDigest](list, binaryDigestsLabel, "binary digests")
+}
@@ -0,0 +1,45 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"bytes"
+	"slices"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// cpuOnlyMarker is the data of the CPU-only marker piece, a labelled piece with this fixed data and
+// no claim, see labelPrefix.
+var cpuOnlyMarker = []byte("confsec-cpu-only-v1")
+
+// CPUOnlyPiece returns the evidence piece a node without GPUs includes in its evidence. It lets
+// routers tell CPU-only nodes apart from GPU nodes that are missing their GPU evidence.
+func CPUOnlyPiece() *ev.SignedEvidencePiece {
+	return newLabelledPiece(slices.Clone(cpuOnlyMarker))
+}
+
+// IsCPUOnlyPiece reports whether piece is the CPU-only marker.
+func IsCPUOnlyPiece(piece *ev.SignedEvidencePiece) bool {
+	return IsLabelledPiece(piece) && bytes.Equal(piece.Data, cpuOnlyMarker)
+}
+
+// IsCPUOnly reports whether the evidence list contains the CPU-only marker.
+func IsCPUOnly(list ev.SignedEvidenceList) bool {
+	return slices.ContainsFunc(list, IsCPUOnlyPiece)
+}
@@ -0,0 +1,71 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"testing"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsCPUOnly(t *testing.T) {
+	tests := map[string]struct {
+		evidence ev.SignedEvidenceList
+		want     bool
+	}{
+		"ok, marker among other pieces": {
+			evidence: ev.SignedEvidenceList{
+				&ev.SignedEvidencePiece{Type: ev.SevSnpReport, Data: []byte("report")},
+				CPUOnlyPiece(),
+			},
+			want: true,
+		},
+		"ok, no marker": {
+			evidence: ev.SignedEvidenceList{
+				&ev.SignedEvidencePiece{Type: ev.SevSnpReport, Data: []byte("report")},
+			},
+		},
+		"ok, unspecified piece with other data is not a marker": {
+			evidence: ev.SignedEvidenceList{
+				&ev.SignedEvidencePiece{Type: ev.EvidenceTypeUnspecified, Data: []byte("fake")},
+			},
+		},
+		"ok, marker data with another type is not a marker": {
+			evidence: ev.SignedEvidenceList{
+				&ev.SignedEvidencePiece{Type: ev.SevSnpReport, Data: CPUOnlyPiece().Data},
+			},
+		},
+		"ok, empty evidence": {},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.want, IsCPUOnly(tc.evidence))
+		})
+	}
+}
+
+func TestCPUOnlyPieceSurvivesTransfer(t *testing.T) {
+	payload, flags, err := encodePayload(ev.SignedEvidenceList{CPUOnlyPiece()}, DefaultCompressThreshold)
+	require.NoError(t, err)
+
+	got, err := decodePayload(payload, flags, DefaultLimits())
+	require.NoError(t, err)
+	require.True(t, IsCPUOnly(got))
+}
@@ -0,0 +1,93 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// engineConfigLabel prefixes the data of the inference engine config piece, see labelPrefix.
+var engineConfigLabel = []byte("confsec-engine-config-v1:")
+
+// RedactedValue replaces the values of arguments and environment variables that are secret, like
+// the API key of the inference engine.
+const RedactedValue = "<redacted>"
+
+// EngineConfig is the effective configuration of the inference engine as read by compute_boot from
+// its systemd unit, so verifiers can pin how the engine runs and not just its binary.
+type EngineConfig struct {
+	// Engine is the type of the inference engine, e.g. ollama or vllm.
+	Engine string `json:"engine"`
+	// Unit is the systemd unit the engine runs in.
+	Unit string `json:"unit"`
+	// Args are the arguments of the engine process, including the executable.
+	Args []string `json:"args"`
+	// Environment are the attested environment variables of the engine process, variables that are
+	// not set are omitted.
+	Environment map[string]string `json:"environment"`
+}
+
+// Digest returns the SHA-256 digest of the JSON encoded config, the value compute_boot extends into
+// the engine config PCR.
+func (c EngineConfig) Digest() ([]byte, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal engine config: %w", err)
+	}
+	digest := sha256.Sum256(b)
+	return digest[:], nil
+}
+
+// Validate checks the engine and its arguments are set.
+func (c EngineConfig) Validate() error {
+	if c.Engine == "" || len(c.Args) == 0 {
+		return errors.New("invalid engine config: missing engine or args")
+	}
+	return nil
+}
+
+// Arg returns the value of the flag name, e.g. "--max-model-len", in both the "--flag value" and
+// "--flag=value" forms. False when the flag is not set.
+func (c EngineConfig) Arg(name string) (string, bool) {
+	for i, arg := range c.Args {
+		if value, ok := strings.CutPrefix(arg, name+"="); ok {
+			return value, true
+		}
+		if arg == name && i+1 < len(c.Args) {
+			return c.Args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// EngineConfigPiece returns the evidence piece describing the inference engine config.
+func EngineConfigPiece(c EngineConfig) (*ev.SignedEvidencePiece, error) {
+	return labelledPiece(engineConfigLabel, "engine config", c)
+}
+
+// FindEngineConfig returns the inference engine config from the evidence list, false when the list
+// contains no engine config piece.
+func FindEngineConfig(list ev.SignedEvidenceList) (EngineConfig, bool, error) {
+	return findLabelled[EngineConfig](list, engineConfigLabel, "engine config")
+}
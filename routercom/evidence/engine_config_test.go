@@ -0,0 +1,66 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"testing"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineConfig(t *testing.T) {
+	c := EngineConfig{
+		Engine:      "vllm",
+		Unit:        "vllm.service",
+		Args:        []string{"vllm", "serve", "llama", "--max-model-len=8192", "--tensor-parallel-size", "8"},
+		Environment: map[string]string{"VLLM_USE_V1": "1"},
+	}
+
+	t.Run("ok, args", func(t *testing.T) {
+		v, ok := c.Arg("--max-model-len")
+		require.True(t, ok)
+		require.Equal(t, "8192", v)
+
+		v, ok = c.Arg("--tensor-parallel-size")
+		require.True(t, ok)
+		require.Equal(t, "8", v)
+
+		_, ok = c.Arg("--max-num-seqs")
+		require.False(t, ok)
+	})
+
+	t.Run("ok, digest is stable", func(t *testing.T) {
+		a, err := c.Digest()
+		require.NoError(t, err)
+		b, err := c.Digest()
+		require.NoError(t, err)
+		require.Equal(t, a, b)
+		require.Len(t, a, 32)
+	})
+
+	t.Run("fail, missing args", func(t *testing.T) {
+		piece := &ev.SignedEvidencePiece{
+			Type: ev.EvidenceTypeUnspecified,
+			Data: append([]byte("confsec-engine-config-v1:"), `{"engine":"vllm"}`...),
+		}
+		_, _, err := FindEngineConfig(ev.SignedEvidenceList{piece})
+		require.Error(t, err)
+		require.Error(t, verifyLabelledPieces(ev.SignedEvidenceList{piece}))
+	})
+}
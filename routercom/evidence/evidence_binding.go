@@ -0,0 +1,231 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package evidence
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker/output/wire"
+	"github.com/google/go-tpm/tpm2"
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// evidenceBindingLabel prefixes the data of the evidence binding piece.
+var evidenceBindingLabel = []byte("confsec-evidence-binding-v1:")
+
+// EvidenceBinding binds the labelled pieces of the evidence to the TPM of the node. compute_boot
+// extends the PCR with BindingMarker and then with the digest of every labelled piece, in evidence
+// order, and quotes the PCR together with the PCRs the REK is bound to with the attestation key. The
+// quote vouches for the PCR values of the TPM quote piece, its extra data commits to the REK and the
+// TPM quote piece, see BindingExtraData.
+type EvidenceBinding struct {
+	// PCR is the PCR the digests of the labelled pieces are extended into.
+	PCR uint32 `json:"pcr"`
+	// Initial is the value of the PCR before compute_boot extended it for this attestation, PCRs
+	// aren't reset when a node attests again within the same boot. The marker every attestation
+	// starts with keeps the first pieces of an attestation from being dropped.
+	Initial []byte `json:"initial"`
+	// AKPublic is the marshalled TPMT_PUBLIC of the attestation key.
+	AKPublic []byte `json:"ak_public"`
+	// Quote is the marshalled TPMS_ATTEST of the quote of the PCR.
+	Quote []byte `json:"quote"`
+	// Signature is the marshalled TPMT_SIGNATURE of the quote by the attestation key.
+	Signature []byte `json:"signature"`
+}
+
+// BindingMarker returns the digest compute_boot extends the PCR with before the labelled pieces.
+func BindingMarker() []byte {
+	digest := sha256.Sum256(evidenceBindingLabel)
+	return digest[:]
+}
+
+// BindingExtraData returns the extra data of the binding quote, it commits to the REK public area
+// and the TPM quote piece, so the labelled pieces can't be moved to evidence with another REK.
+func BindingExtraData(rekPublic, tpmQuote []byte) []byte {
+	quoteDigest := sha256.Sum256(tpmQuote)
+	h := sha256.New()
+	h.Write(evidenceBindingLabel)
+	h.Write(rekPublic)
+	h.Write(quoteDigest[:])
+	return h.Sum(nil)
+}
+
+// BindingPCRs returns the PCRs the binding quote selects, the PCRs the REK is bound to and pcr, in
+// ascending order.
+func BindingPCRs(pcr uint32) ([]uint32, error) {
+	pcrs, err := attestSelection()
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(pcrs, pcr) {
+		return nil, fmt.Errorf("binding pcr %d is bound to the rek", pcr)
+	}
+	pcrs = append(pcrs, pcr)
+	slices.Sort(pcrs)
+	return pcrs, nil
+}
+
+// ExtendPCRValue returns the value of a SHA-256 PCR with value after it was extended with digest.
+func ExtendPCRValue(value, digest []byte) []byte {
+	h := sha256.New()
+	h.Write(value)
+	h.Write(digest)
+	return h.Sum(nil)
+}
+
+// EvidenceBindingPiece returns the evidence piece carrying the binding. The binding is a labelled
+// piece itself, but it is not extended into the PCR.
+func EvidenceBindingPiece(b EvidenceBinding) (*ev.SignedEvidencePiece, error) {
+	return labelledPiece(evidenceBindingLabel, "evidence binding", b)
+}
+
+// FindEvidenceBinding returns the evidence binding from the evidence list, false when the list
+// contains no binding piece.
+func FindEvidenceBinding(list ev.SignedEvidenceList) (EvidenceBinding, bool, error) {
+	return findLabelled[EvidenceBinding](list, evidenceBindingLabel, "evidence binding")
+}
+
+// isEvidenceBindingPiece reports whether piece is the evidence binding.
+func isEvidenceBindingPiece(piece *ev.SignedEvidencePiece) bool {
+	return IsLabelledPiece(piece) && bytes.HasPrefix(piece.Data, evidenceBindingLabel)
+}
+
+// VerifyEvidenceBinding checks the labelled pieces of the list are the ones compute_boot extended into
+// the PCR of the binding, and the quote of the binding is signed by the attestation key of the
+// evidence, covers pcrValues, the PCR values of the TPM quote piece, and commits to rek and the TPM
+// quote piece.
+func VerifyEvidenceBinding(list ev.SignedEvidenceList, rek, tpmQuote *ev.SignedEvidencePiece, pcrValues map[uint32][]byte) error {
+	binding, ok, err := FindEvidenceBinding(list)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("evidence has no binding of the labelled pieces")
+	}
+
+	if err := verifyAKInEvidence(list, binding.AKPublic); err != nil {
+		return err
+	}
+
+	if err := wire.VerifyAKSignature(binding.AKPublic, binding.Quote, binding.Signature); err != nil {
+		return fmt.Errorf("invalid binding quote signature: %w", err)
+	}
+
+	attest, err := tpm2.Unmarshal[tpm2.TPMSAttest](binding.Quote)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal binding quote: %w", err)
+	}
+	if attest.Magic != tpm2.TPMGeneratedValue || attest.Type != tpm2.TPMSTAttestQuote {
+		return errors.New("binding quote is not a quote generated by the tpm")
+	}
+	if !bytes.Equal(attest.ExtraData.Buffer, BindingExtraData(rek.Data, tpmQuote.Data)) {
+		return errors.New("binding quote is not bound to the rek and the tpm quote of the evidence")
+	}
+	info, err := attest.Attested.Quote()
+	if err != nil {
+		return fmt.Errorf("failed to read binding quote info: %w", err)
+	}
+	pcrs, err := BindingPCRs(binding.PCR)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(tpm2.Marshal(info.PCRSelect), tpm2.Marshal(PCRSelection(pcrs))) {
+		return fmt.Errorf("binding quote must select pcr %d and the pcrs of the rek only", binding.PCR)
+	}
+
+	if len(binding.Initial) != sha256.Size {
+		return fmt.Errorf("invalid initial pcr value of %d bytes", len(binding.Initial))
+	}
+
+	// replay the labelled pieces in evidence order, every label may appear once.
+	value := ExtendPCRValue(binding.Initial, BindingMarker())
+	labels := map[string]bool{}
+	for i, piece := range list {
+		if !IsLabelledPiece(piece) || isEvidenceBindingPiece(piece) {
+			continue
+		}
+		label := pieceLabel(piece)
+		if labels[label] {
+			return fmt.Errorf("labelled piece %d: duplicate %s piece", i, label)
+		}
+		labels[label] = true
+
+		digest := LabelledPieceDigest(piece)
+		if !bytes.Equal(piece.Signature, digest) {
+			return fmt.Errorf("labelled piece %d: signature is not the digest of the data", i)
+		}
+		value = ExtendPCRValue(value, digest)
+	}
+
+	// the pcr of the binding isn't in the tpm quote, its value is the replayed one.
+	quoted := make(map[uint32][]byte, len(pcrValues)+1)
+	maps.Copy(quoted, pcrValues)
+	quoted[binding.PCR] = value
+	pcrDigest, err := pcrSelectionDigest(pcrs, quoted)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(info.PCRDigest.Buffer, pcrDigest) {
+		return errors.New("labelled pieces or pcr values of the tpm quote don't match the values quoted by the attestation key")
+	}
+
+	return nil
+}
+
+// verifyAKInEvidence checks akPublic is the attestation key the evidence vouches for: the AK public
+// area of QEMU and fake evidence, or the key of an AK certificate on GCE and Azure.
+func verifyAKInEvidence(list ev.SignedEvidenceList, akPublic []byte) error {
+	public, err := tpm2.Unmarshal[tpm2.TPMTPublic](akPublic)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal attestation key: %w", err)
+	}
+	key, err := tpm2.Pub(*public)
+	if err != nil {
+		return fmt.Errorf("failed to parse attestation key: %w", err)
+	}
+	equaler, ok := key.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return fmt.Errorf("unsupported attestation key type %T", key)
+	}
+
+	for _, piece := range list {
+		if piece == nil {
+			continue
+		}
+		switch piece.Type { //nolint:exhaustive
+		case ev.AkTPMTPublic, ev.EvidenceTypeUnspecified:
+			// fake evidence carries the AK public area in a piece of unspecified type.
+			if bytes.Equal(piece.Data, akPublic) {
+				return nil
+			}
+		default:
+			cert, err := x509.ParseCertificate(piece.Data)
+			if err == nil && equaler.Equal(cert.PublicKey) {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("binding quote is signed by an attestation key the evidence doesn't vouch for")
+}
@@ -0,0 +1,263 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package evidence
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+// testAK is an attestation key that signs the way the TPM does.
+type testAK struct {
+	priv   *ecdsa.PrivateKey
+	public []byte
+}
+
+func newTestAK(t *testing.T) testAK {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return testAK{
+		priv: priv,
+		public: tpm2.Marshal(tpm2.TPMTPublic{
+			Type:             tpm2.TPMAlgECC,
+			NameAlg:          tpm2.TPMAlgSHA256,
+			ObjectAttributes: tpm2.TPMAObject{SignEncrypt: true, Restricted: true},
+			Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &tpm2.TPMSECCParms{
+				CurveID: tpm2.TPMECCNistP256,
+				Scheme: tpm2.TPMTECCScheme{
+					Scheme:  tpm2.TPMAlgECDSA,
+					Details: tpm2.NewTPMUAsymScheme(tpm2.TPMAlgECDSA, &tpm2.TPMSSigSchemeECDSA{HashAlg: tpm2.TPMAlgSHA256}),
+				},
+			}),
+			Unique: tpm2.NewTPMUPublicID(tpm2.TPMAlgECC, &tpm2.TPMSECCPoint{
+				X: tpm2.TPM2BECCParameter{Buffer: priv.X.FillBytes(make([]byte, 32))},
+				Y: tpm2.TPM2BECCParameter{Buffer: priv.Y.FillBytes(make([]byte, 32))},
+			}),
+		}),
+	}
+}
+
+// sign returns the marshalled TPMT_SIGNATURE of msg.
+func (ak testAK) sign(t *testing.T, msg []byte) []byte {
+	t.Helper()
+	digest := sha256.Sum256(msg)
+	r, s, err := ecdsa.Sign(rand.Reader, ak.priv, digest[:])
+	require.NoError(t, err)
+	return tpm2.Marshal(tpm2.TPMTSignature{
+		SigAlg: tpm2.TPMAlgECDSA,
+		Signature: tpm2.NewTPMUSignature(tpm2.TPMAlgECDSA, &tpm2.TPMSSignatureECC{
+			Hash:       tpm2.TPMAlgSHA256,
+			SignatureR: tpm2.TPM2BECCParameter{Buffer: r.Bytes()},
+			SignatureS: tpm2.TPM2BECCParameter{Buffer: s.Bytes()},
+		}),
+	})
+}
+
+func TestVerifyEvidenceBinding(t *testing.T) {
+	const pcr = 15
+	ak := newTestAK(t)
+	rek := &ev.SignedEvidencePiece{Type: ev.TpmtPublic, Data: []byte("rek"), Signature: []byte("name")}
+	quote := &ev.SignedEvidencePiece{Type: ev.TpmQuote, Data: []byte("quote")}
+
+	maintenance, err := MaintenancePiece(Maintenance{Reason: "INC-1234"})
+	require.NoError(t, err)
+	engineConfig, err := EngineConfigPiece(EngineConfig{Engine: "vllm", Args: []string{"vllm", "serve"}})
+	require.NoError(t, err)
+
+	// bind extends the labelled pieces into the pcr and quotes it the way compute_boot does.
+	bind := func(t *testing.T, list ev.SignedEvidenceList, modify func(*tpm2.TPMSQuoteInfo)) ev.SignedEvidenceList {
+		t.Helper()
+		initial := make([]byte, sha256.Size)
+		value := ExtendPCRValue(initial, BindingMarker())
+		for _, piece := range list {
+			if IsLabelledPiece(piece) {
+				value = ExtendPCRValue(value, LabelledPieceDigest(piece))
+			}
+		}
+		pcrs, err := BindingPCRs(pcr)
+		require.NoError(t, err)
+		quoted := testPCRValues()
+		quoted[pcr] = value
+		pcrDigest, err := pcrSelectionDigest(pcrs, quoted)
+		require.NoError(t, err)
+		info := &tpm2.TPMSQuoteInfo{
+			PCRSelect: PCRSelection(pcrs),
+			PCRDigest: tpm2.TPM2BDigest{Buffer: pcrDigest},
+		}
+		if modify != nil {
+			modify(info)
+		}
+		attest := tpm2.Marshal(tpm2.TPMSAttest{
+			Magic:     tpm2.TPMGeneratedValue,
+			Type:      tpm2.TPMSTAttestQuote,
+			ExtraData: tpm2.TPM2BData{Buffer: BindingExtraData(rek.Data, quote.Data)},
+			Attested:  tpm2.NewTPMUAttest(tpm2.TPMSTAttestQuote, info),
+		})
+		piece, err := EvidenceBindingPiece(EvidenceBinding{
+			PCR:       pcr,
+			Initial:   initial,
+			AKPublic:  ak.public,
+			Quote:     attest,
+			Signature: ak.sign(t, attest),
+		})
+		require.NoError(t, err)
+		return append(list, piece)
+	}
+
+	evidence := func() ev.SignedEvidenceList {
+		return ev.SignedEvidenceList{
+			{Type: ev.AkTPMTPublic, Data: ak.public},
+			rek,
+			quote,
+			CPUOnlyPiece(),
+			maintenance,
+			engineConfig,
+		}
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		require.NoError(t, VerifyEvidenceBinding(bind(t, evidence(), nil), rek, quote, testPCRValues()))
+	})
+
+	t.Run("ok, no labelled pieces", func(t *testing.T) {
+		list := bind(t, evidence()[:3], nil)
+		require.NoError(t, VerifyEvidenceBinding(list, rek, quote, testPCRValues()))
+	})
+
+	tests := map[string]struct {
+		list      func(t *testing.T) ev.SignedEvidenceList
+		rek       *ev.SignedEvidencePiece
+		pcrValues map[uint32][]byte
+		wantErr   string
+	}{
+		"fail, no binding": {
+			list:    func(*testing.T) ev.SignedEvidenceList { return evidence() },
+			wantErr: "no binding",
+		},
+		"fail, labelled piece added": {
+			list: func(t *testing.T) ev.SignedEvidenceList {
+				added, err := OutputFilterPiece(OutputFilter{Digest: strings.Repeat("ab", 32)})
+				require.NoError(t, err)
+				return append(bind(t, evidence(), nil), added)
+			},
+			wantErr: "don't match",
+		},
+		"fail, labelled piece removed": {
+			list: func(t *testing.T) ev.SignedEvidenceList {
+				list := bind(t, evidence(), nil)
+				return append(list[:4], list[5:]...)
+			},
+			wantErr: "don't match",
+		},
+		"fail, labelled piece replaced": {
+			list: func(t *testing.T) ev.SignedEvidenceList {
+				list := bind(t, evidence(), nil)
+				other, err := MaintenancePiece(Maintenance{Reason: "INC-9999"})
+				require.NoError(t, err)
+				list[4] = other
+				return list
+			},
+			wantErr: "don't match",
+		},
+		"fail, labelled pieces reordered": {
+			list: func(t *testing.T) ev.SignedEvidenceList {
+				list := bind(t, evidence(), nil)
+				list[4], list[5] = list[5], list[4]
+				return list
+			},
+			wantErr: "don't match",
+		},
+		"fail, duplicate label": {
+			list: func(t *testing.T) ev.SignedEvidenceList {
+				return bind(t, append(evidence(), maintenance), nil)
+			},
+			wantErr: "duplicate",
+		},
+		"fail, signature is not the digest": {
+			list: func(t *testing.T) ev.SignedEvidenceList {
+				list := bind(t, evidence(), nil)
+				list[4] = &ev.SignedEvidencePiece{Type: maintenance.Type, Data: maintenance.Data, Signature: []byte("sig")}
+				return list
+			},
+			wantErr: "signature is not the digest",
+		},
+		"fail, other rek": {
+			list:    func(t *testing.T) ev.SignedEvidenceList { return bind(t, evidence(), nil) },
+			rek:     &ev.SignedEvidencePiece{Type: ev.TpmtPublic, Data: []byte("other rek")},
+			wantErr: "not bound to the rek",
+		},
+		"fail, attestation key not in evidence": {
+			list: func(t *testing.T) ev.SignedEvidenceList {
+				return bind(t, evidence(), nil)[1:]
+			},
+			wantErr: "doesn't vouch for",
+		},
+		"fail, other pcr selected": {
+			list: func(t *testing.T) ev.SignedEvidenceList {
+				return bind(t, evidence(), func(info *tpm2.TPMSQuoteInfo) {
+					info.PCRSelect = PCRSelection([]uint32{pcr})
+				})
+			},
+			wantErr: "must select pcr 15 and the pcrs of the rek only",
+		},
+		"fail, pcr values of the tpm quote differ": {
+			list: func(t *testing.T) ev.SignedEvidenceList { return bind(t, evidence(), nil) },
+			pcrValues: func() map[uint32][]byte {
+				values := testPCRValues()
+				values[uint32(ev.AttestPCRSelection[0])] = bytes.Repeat([]byte{0xff}, sha256.Size)
+				return values
+			}(),
+			wantErr: "don't match",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rekPiece := rek
+			if tc.rek != nil {
+				rekPiece = tc.rek
+			}
+			pcrValues := testPCRValues()
+			if tc.pcrValues != nil {
+				pcrValues = tc.pcrValues
+			}
+			require.ErrorContains(t, VerifyEvidenceBinding(tc.list(t), rekPiece, quote, pcrValues), tc.wantErr)
+		})
+	}
+
+	t.Run("fail, binding signed by another key", func(t *testing.T) {
+		list := bind(t, evidence(), nil)
+		binding, ok, err := FindEvidenceBinding(list)
+		require.NoError(t, err)
+		require.True(t, ok)
+		binding.Signature = newTestAK(t).sign(t, binding.Quote)
+		piece, err := EvidenceBindingPiece(binding)
+		require.NoError(t, err)
+		list[len(list)-1] = piece
+		require.ErrorContains(t, VerifyEvidenceBinding(list, rek, quote, testPCRValues()), "invalid binding quote signature")
+	})
+}
@@ -0,0 +1,66 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package evidence
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/confidentsecurity/confidentcompute/experimental"
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// experimentalRoutesLabel prefixes the data of the experimental routes piece, see labelPrefix.
+var experimentalRoutesLabel = []byte("confsec-experimental-routes-v1:")
+
+// ExperimentalRoutes discloses the experimental routes compute_worker serves, so verifier policy can
+// tell nodes with experimental surfaces from stable ones. Stable nodes have no such piece.
+type ExperimentalRoutes struct {
+	Routes []string `json:"routes"`
+}
+
+// Validate checks the routes are known experimental routes.
+func (r ExperimentalRoutes) Validate() error {
+	if len(r.Routes) == 0 {
+		return errors.New("no experimental routes")
+	}
+	return experimental.ValidateRoutes(r.Routes)
+}
+
+// Digest returns the digest compute_boot extends a PCR with, so the disclosure is covered by the
+// TPM quote.
+func (r ExperimentalRoutes) Digest() ([]byte, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal experimental routes: %w", err)
+	}
+	digest := sha256.Sum256(b)
+	return digest[:], nil
+}
+
+// ExperimentalRoutesPiece returns the evidence piece disclosing the experimental routes.
+func ExperimentalRoutesPiece(r ExperimentalRoutes) (*ev.SignedEvidencePiece, error) {
+	return labelledPiece(experimentalRoutesLabel, "experimental routes", r)
+}
+
+// FindExperimentalRoutes returns the experimental routes from the evidence list, false when the node
+// has no experimental routes enabled.
+func FindExperimentalRoutes(list ev.SignedEvidenceList) (ExperimentalRoutes, bool, error) {
+	return findLabelled[ExperimentalRoutes](list, experimentalRoutesLabel, "experimental routes")
+}
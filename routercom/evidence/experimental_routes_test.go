@@ -0,0 +1,46 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package evidence
+
+import (
+	"testing"
+
+	"github.com/confidentsecurity/confidentcompute/experimental"
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExperimentalRoutes(t *testing.T) {
+	t.Run("ok, valid routes", func(t *testing.T) {
+		require.NoError(t, ExperimentalRoutes{Routes: []string{experimental.ResponsesRoute}}.Validate())
+	})
+
+	t.Run("fail, invalid routes", func(t *testing.T) {
+		_, err := ExperimentalRoutesPiece(ExperimentalRoutes{})
+		require.Error(t, err)
+		_, err = ExperimentalRoutesPiece(ExperimentalRoutes{Routes: []string{"/v1/chat/completions"}})
+		require.Error(t, err)
+
+		piece := &ev.SignedEvidencePiece{
+			Type: ev.EvidenceTypeUnspecified,
+			Data: append([]byte("confsec-experimental-routes-v1:"), `{"routes":["/api/pull"]}`...),
+		}
+		_, _, err = FindExperimentalRoutes(ev.SignedEvidenceList{piece})
+		require.Error(t, err)
+		require.Error(t, verifyLabelledPieces(ev.SignedEvidenceList{piece}))
+	})
+}
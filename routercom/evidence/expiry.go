@@ -0,0 +1,140 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package evidence
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"time"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// DeadlineKind is the kind of time-bound evidence a deadline comes from.
+type DeadlineKind string
+
+const (
+	// DeadlineCertificate is the NotAfter of a certificate, e.g. the AK certificate or an NVIDIA
+	// intermediate certificate.
+	DeadlineCertificate DeadlineKind = "certificate"
+	// DeadlineJWT is the exp claim of a token, e.g. the NVIDIA attestation token of the GPUs.
+	DeadlineJWT DeadlineKind = "jwt"
+	// DeadlineTCBNextUpdate is the nextUpdate of the TCB info or enclave identity in the TEE
+	// collateral, clients consider the collateral outdated after it.
+	DeadlineTCBNextUpdate DeadlineKind = "tcb_next_update"
+)
+
+// Deadline is the time after which a piece of the evidence no longer verifies.
+type Deadline struct {
+	// Piece is the index of the piece in the evidence list.
+	Piece int `json:"piece"`
+	// Type is the evidence type of the piece.
+	Type     string       `json:"type"`
+	Kind     DeadlineKind `json:"kind"`
+	NotAfter time.Time    `json:"not_after"`
+}
+
+func (d Deadline) String() string {
+	return fmt.Sprintf("%s %s of piece %d", d.Type, d.Kind, d.Piece)
+}
+
+var (
+	// jwtPattern matches compact JWTs, their header and payload are JSON objects so both start with eyJ.
+	jwtPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*`)
+	// nextUpdatePattern matches the nextUpdate of the TCB info and enclave identity JSON of the collateral.
+	nextUpdatePattern = regexp.MustCompile(`"nextUpdate"\s*:\s*"([^"]+)"`)
+)
+
+// Deadlines returns the deadlines of the time-bound evidence in the list, earliest first. Pieces
+// are recognized by their content, certificates, tokens and collateral embedded in other encodings
+// are found as well. A piece has at most one deadline of each kind, the earliest.
+func Deadlines(list ev.SignedEvidenceList) []Deadline {
+	var deadlines []Deadline
+	for i, piece := range list {
+		if piece == nil {
+			continue
+		}
+		add := func(kind DeadlineKind, notAfter time.Time) {
+			deadlines = append(deadlines, Deadline{Piece: i, Type: fmt.Sprint(piece.Type), Kind: kind, NotAfter: notAfter})
+		}
+
+		if cert, err := x509.ParseCertificate(piece.Data); err == nil {
+			add(DeadlineCertificate, cert.NotAfter)
+			continue
+		}
+		if exp, ok := earliestJWTExpiry(piece.Data); ok {
+			add(DeadlineJWT, exp)
+		}
+		if next, ok := earliestNextUpdate(piece.Data); ok {
+			add(DeadlineTCBNextUpdate, next)
+		}
+	}
+
+	slices.SortStableFunc(deadlines, func(a, b Deadline) int {
+		return a.NotAfter.Compare(b.NotAfter)
+	})
+	return deadlines
+}
+
+// earliestJWTExpiry returns the earliest exp claim of the JWTs in data. The tokens are not
+// verified, clients do that, a token without exp claim doesn't expire.
+func earliestJWTExpiry(data []byte) (time.Time, bool) {
+	var (
+		earliest time.Time
+		found    bool
+	)
+	for _, token := range jwtPattern.FindAll(data, -1) {
+		parts := bytes.Split(token, []byte("."))
+		payload, err := base64.RawURLEncoding.DecodeString(string(parts[1]))
+		if err != nil {
+			continue
+		}
+		var claims struct {
+			Exp float64 `json:"exp"`
+		}
+		if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp <= 0 || claims.Exp > math.MaxInt64 {
+			continue
+		}
+		exp := time.Unix(int64(claims.Exp), 0).UTC()
+		if !found || exp.Before(earliest) {
+			earliest, found = exp, true
+		}
+	}
+	return earliest, found
+}
+
+// earliestNextUpdate returns the earliest nextUpdate of the collateral in data.
+func earliestNextUpdate(data []byte) (time.Time, bool) {
+	var updates []time.Time
+	for _, match := range nextUpdatePattern.FindAllSubmatch(data, -1) {
+		next, err := time.Parse(time.RFC3339, string(match[1]))
+		if err != nil {
+			continue
+		}
+		updates = append(updates, next.UTC())
+	}
+	if len(updates) == 0 {
+		return time.Time{}, false
+	}
+	return slices.MinFunc(updates, time.Time.Compare), true
+}
@@ -0,0 +1,75 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package evidence
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadlines(t *testing.T) {
+	certNotAfter := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ak"},
+		NotBefore:    certNotAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     certNotAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	jwt := func(claims string) string {
+		enc := base64.RawURLEncoding
+		return enc.EncodeToString([]byte(`{"alg":"ES384"}`)) + "." + enc.EncodeToString([]byte(claims)) + ".c2ln"
+	}
+	// the attestation service returns the tokens of the GPUs in a JSON list.
+	tokens := `[["JWT","` + jwt(`{"exp":1751328000}`) + `"],{"GPU-0":"` + jwt(`{"exp":1751324400}`) + `","GPU-1":"` + jwt(`{"sub":"gpu"}`) + `"}]`
+
+	collateral := `{"tcbInfo":{"issueDate":"2025-06-01T00:00:00Z","nextUpdate":"2025-07-15T00:00:00Z"}}` +
+		`{"enclaveIdentity":{"nextUpdate":"2025-07-10T00:00:00Z"}}`
+
+	list := ev.SignedEvidenceList{
+		&ev.SignedEvidencePiece{Type: ev.TpmtPublic, Data: []byte("rek")},
+		&ev.SignedEvidencePiece{Type: ev.NvidiaCCIntermediateCertificate, Data: der},
+		&ev.SignedEvidencePiece{Type: ev.NvidiaETA, Data: []byte(tokens)},
+		&ev.SignedEvidencePiece{Type: ev.EvidenceTypeUnspecified, Data: []byte(collateral)},
+		nil,
+	}
+
+	require.Equal(t, []Deadline{
+		{Piece: 2, Type: fmt.Sprint(ev.NvidiaETA), Kind: DeadlineJWT, NotAfter: time.Date(2025, 6, 30, 23, 0, 0, 0, time.UTC)},
+		{Piece: 3, Type: fmt.Sprint(ev.EvidenceTypeUnspecified), Kind: DeadlineTCBNextUpdate, NotAfter: time.Date(2025, 7, 10, 0, 0, 0, 0, time.UTC)},
+		{Piece: 1, Type: fmt.Sprint(ev.NvidiaCCIntermediateCertificate), Kind: DeadlineCertificate, NotAfter: certNotAfter},
+	}, Deadlines(list))
+
+	require.Empty(t, Deadlines(ev.SignedEvidenceList{
+		&ev.SignedEvidencePiece{Type: ev.NvidiaETA, Data: []byte(jwt(`{"exp":"tomorrow"}`))},
+	}))
+}
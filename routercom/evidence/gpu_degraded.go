@@ -0,0 +1,63 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"fmt"
+	"time"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// gpuDegradedLabel prefixes the data of the GPU degraded piece, see labelPrefix.
+var gpuDegradedLabel = []byte("confsec-gpu-degraded-v1:")
+
+// GPUDegraded discloses that compute_boot couldn't attest the GPUs of the node because the NVIDIA
+// remote attestation service was unavailable. The evidence then has no GPU evidence and the node
+// only serves the models that run without GPUs.
+type GPUDegraded struct {
+	// Reason is why the GPUs couldn't be attested.
+	Reason string `json:"reason"`
+	// RetryAfterSeconds is how long the node serves degraded before it restarts to attest its
+	// GPUs again, 0 to not retry.
+	RetryAfterSeconds int64 `json:"retry_after_seconds"`
+}
+
+// RetryAfter returns how long the node serves degraded before it retries the GPU attestation.
+func (d GPUDegraded) RetryAfter() time.Duration {
+	return time.Duration(d.RetryAfterSeconds) * time.Second
+}
+
+// Validate checks the retry delay is not negative.
+func (d GPUDegraded) Validate() error {
+	if d.RetryAfterSeconds < 0 {
+		return fmt.Errorf("invalid gpu degraded retry after: %ds", d.RetryAfterSeconds)
+	}
+	return nil
+}
+
+// GPUDegradedPiece returns the evidence piece disclosing that the GPUs couldn't be attested.
+func GPUDegradedPiece(d GPUDegraded) (*ev.SignedEvidencePiece, error) {
+	return labelledPiece(gpuDegradedLabel, "gpu degraded", d)
+}
+
+// FindGPUDegraded returns the GPU degraded claim from the evidence list, false when the GPUs of
+// the node were attested or the node has none.
+func FindGPUDegraded(list ev.SignedEvidenceList) (GPUDegraded, bool, error) {
+	return findLabelled[GPUDegraded](list, gpuDegradedLabel, "gpu degraded")
+}
@@ -0,0 +1,45 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"testing"
+	"time"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGPUDegraded(t *testing.T) {
+	t.Run("ok, retry after", func(t *testing.T) {
+		d := GPUDegraded{Reason: "nras unavailable: 503 Service Unavailable", RetryAfterSeconds: 1800}
+		require.Equal(t, 30*time.Minute, d.RetryAfter())
+	})
+
+	t.Run("fail, negative retry after", func(t *testing.T) {
+		_, err := GPUDegradedPiece(GPUDegraded{Reason: "x", RetryAfterSeconds: -1})
+		require.Error(t, err)
+
+		piece := &ev.SignedEvidencePiece{
+			Type: ev.EvidenceTypeUnspecified,
+			Data: append([]byte("confsec-gpu-degraded-v1:"), `{"reason":"x","retry_after_seconds":-1}`...),
+		}
+		_, _, err = FindGPUDegraded(ev.SignedEvidenceList{piece})
+		require.Error(t, err)
+	})
+}
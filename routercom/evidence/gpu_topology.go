@@ -0,0 +1,175 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package evidence
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// gpuTopologyLabel prefixes the data of the GPU topology piece, see labelPrefix.
+var gpuTopologyLabel = []byte("confsec-gpu-topology-v1:")
+
+// MultiGPUMode is the confidential computing mode of a multi-GPU system.
+type MultiGPUMode string
+
+const (
+	MultiGPUModeNone MultiGPUMode = "none"
+	// MultiGPUModeProtectedPCIe isolates the NVLink fabric, links between GPUs and switches are not encrypted.
+	MultiGPUModeProtectedPCIe MultiGPUMode = "protected_pcie"
+	// MultiGPUModeNVLE encrypts the NVLink traffic between GPUs.
+	MultiGPUModeNVLE MultiGPUMode = "nvle"
+)
+
+// NVLinkRemoteType is the type of device on the other end of an NVLink.
+type NVLinkRemoteType string
+
+const (
+	NVLinkRemoteGPU     NVLinkRemoteType = "gpu"
+	NVLinkRemoteSwitch  NVLinkRemoteType = "switch"
+	NVLinkRemoteUnknown NVLinkRemoteType = "unknown"
+)
+
+// GPUTopology describes the NVLink/NVSwitch fabric of the system: which GPUs connect to which
+// switches and whether the links are encrypted.
+type GPUTopology struct {
+	MultiGPUMode MultiGPUMode `json:"multi_gpu_mode"`
+	// LinkEncryption is true when NVLink traffic is encrypted.
+	LinkEncryption bool          `json:"link_encryption"`
+	GPUs           []TopologyGPU `json:"gpus"`
+}
+
+type TopologyGPU struct {
+	// UUID identifies the individual GPU, it is not part of the topology digest.
+	UUID     string         `json:"uuid,omitempty"`
+	PCIBusID string         `json:"pci_bus_id"`
+	Links    []TopologyLink `json:"links"`
+	// ClusterUUID and CliqueID place the GPU in a multi-node NVLink domain, they are empty for GPUs
+	// outside of one. Like the UUID, they are not part of the topology digest.
+	ClusterUUID string `json:"cluster_uuid,omitempty"`
+	CliqueID    uint32 `json:"clique_id,omitempty"`
+}
+
+type TopologyLink struct {
+	Link           int              `json:"link"`
+	Active         bool             `json:"active"`
+	RemoteType     NVLinkRemoteType `json:"remote_type,omitempty"`
+	RemotePCIBusID string           `json:"remote_pci_bus_id,omitempty"`
+}
+
+// Verify checks that the fabric is protected. A multi-GPU system must be in a multi-GPU
+// confidential computing mode and every active link must end at a GPU or an NVSwitch. The
+// switches themselves are attested separately.
+func (t *GPUTopology) Verify() error {
+	if len(t.GPUs) <= 1 {
+		return nil
+	}
+
+	if t.MultiGPUMode != MultiGPUModeProtectedPCIe && t.MultiGPUMode != MultiGPUModeNVLE {
+		return fmt.Errorf("system has %d gpus but multi-gpu mode is %s", len(t.GPUs), t.MultiGPUMode)
+	}
+
+	if t.MultiGPUMode == MultiGPUModeNVLE && !t.LinkEncryption {
+		return errors.New("nvlink encryption is disabled in nvle mode")
+	}
+
+	for _, gpu := range t.GPUs {
+		for _, link := range gpu.Links {
+			if !link.Active {
+				continue
+			}
+			if link.RemoteType != NVLinkRemoteGPU && link.RemoteType != NVLinkRemoteSwitch {
+				return fmt.Errorf("gpu %s link %d connects to an unknown device %s", gpu.PCIBusID, link.Link, link.RemotePCIBusID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// NVLinkDomain returns the cluster UUID and clique ID the GPUs share, it fails when the GPUs are
+// not all in the same multi-node NVLink domain and clique.
+func (t *GPUTopology) NVLinkDomain() (string, uint32, error) {
+	if len(t.GPUs) == 0 {
+		return "", 0, errors.New("system has no gpus")
+	}
+
+	clusterUUID, cliqueID := t.GPUs[0].ClusterUUID, t.GPUs[0].CliqueID
+	for _, gpu := range t.GPUs {
+		if gpu.ClusterUUID == "" {
+			return "", 0, fmt.Errorf("gpu %s is not part of an nvlink domain", gpu.PCIBusID)
+		}
+		if gpu.ClusterUUID != clusterUUID || gpu.CliqueID != cliqueID {
+			return "", 0, fmt.Errorf("gpu %s is in nvlink domain %s clique %d, not %s clique %d",
+				gpu.PCIBusID, gpu.ClusterUUID, gpu.CliqueID, clusterUUID, cliqueID)
+		}
+	}
+	return clusterUUID, cliqueID, nil
+}
+
+// Digest returns the SHA-256 digest of the topology. GPUs are ordered by PCI bus ID and their
+// UUIDs are left out, so identical systems have identical digests that can be used as reference values.
+func (t *GPUTopology) Digest() ([]byte, error) {
+	canonical := GPUTopology{
+		MultiGPUMode:   t.MultiGPUMode,
+		LinkEncryption: t.LinkEncryption,
+		GPUs:           make([]TopologyGPU, 0, len(t.GPUs)),
+	}
+	for _, gpu := range t.GPUs {
+		links := slices.Clone(gpu.Links)
+		slices.SortFunc(links, func(a, b TopologyLink) int {
+			return cmp.Compare(a.Link, b.Link)
+		})
+		canonical.GPUs = append(canonical.GPUs, TopologyGPU{
+			PCIBusID: gpu.PCIBusID,
+			Links:    links,
+		})
+	}
+	slices.SortFunc(canonical.GPUs, func(a, b TopologyGPU) int {
+		return cmp.Compare(a.PCIBusID, b.PCIBusID)
+	})
+
+	b, err := json.Marshal(canonical)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal topology: %w", err)
+	}
+
+	sum := sha256.Sum256(b)
+	return sum[:], nil
+}
+
+// Validate checks the topology is protected, router_com doesn't advertise a node whose evidence
+// discloses an unprotected fabric.
+func (t *GPUTopology) Validate() error {
+	return t.Verify()
+}
+
+// GPUTopologyPiece returns the evidence piece with the NVLink/NVSwitch topology of the GPUs.
+func GPUTopologyPiece(topology *GPUTopology) (*ev.SignedEvidencePiece, error) {
+	return labelledPiece(gpuTopologyLabel, "gpu topology", topology)
+}
+
+// FindGPUTopology returns the GPU topology from the evidence list, false when the node has no GPUs.
+func FindGPUTopology(list ev.SignedEvidenceList) (*GPUTopology, bool, error) {
+	return findLabelled[*GPUTopology](list, gpuTopologyLabel, "gpu topology")
+}
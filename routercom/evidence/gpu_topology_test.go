@@ -0,0 +1,109 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGPUTopology(t *testing.T) {
+	switchLink := func(link int, remote string) TopologyLink {
+		return TopologyLink{Link: link, Active: true, RemoteType: NVLinkRemoteSwitch, RemotePCIBusID: remote}
+	}
+
+	newTopology := func() *GPUTopology {
+		return &GPUTopology{
+			MultiGPUMode: MultiGPUModeProtectedPCIe,
+			GPUs: []TopologyGPU{
+				{
+					UUID:     "GPU-aaaa",
+					PCIBusID: "00000000:18:00.0",
+					Links:    []TopologyLink{switchLink(0, "00000000:05:00.0"), switchLink(1, "00000000:06:00.0"), {Link: 2}},
+				},
+				{
+					UUID:     "GPU-bbbb",
+					PCIBusID: "00000000:2a:00.0",
+					Links:    []TopologyLink{switchLink(0, "00000000:05:00.0"), switchLink(1, "00000000:06:00.0")},
+				},
+			},
+		}
+	}
+
+	t.Run("ok, protected pcie fabric", func(t *testing.T) {
+		require.NoError(t, newTopology().Verify())
+	})
+
+	t.Run("ok, single gpu does not need a multi-gpu mode", func(t *testing.T) {
+		topology := &GPUTopology{
+			MultiGPUMode: MultiGPUModeNone,
+			GPUs:         []TopologyGPU{{PCIBusID: "00000000:18:00.0"}},
+		}
+		require.NoError(t, topology.Verify())
+	})
+
+	t.Run("ok, digest ignores uuids and ordering", func(t *testing.T) {
+		topology := newTopology()
+		want, err := topology.Digest()
+		require.NoError(t, err)
+
+		other := newTopology()
+		other.GPUs[0].UUID = "GPU-cccc"
+		other.GPUs[0], other.GPUs[1] = other.GPUs[1], other.GPUs[0]
+		other.GPUs[1].Links[0], other.GPUs[1].Links[2] = other.GPUs[1].Links[2], other.GPUs[1].Links[0]
+		got, err := other.Digest()
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+
+		// the digest must not depend on the caller's ordering of the links.
+		require.Equal(t, 2, other.GPUs[1].Links[0].Link)
+	})
+
+	t.Run("ok, digest changes with the fabric", func(t *testing.T) {
+		want, err := newTopology().Digest()
+		require.NoError(t, err)
+
+		other := newTopology()
+		other.GPUs[1].Links[1].RemotePCIBusID = "00000000:07:00.0"
+		got, err := other.Digest()
+		require.NoError(t, err)
+		require.NotEqual(t, want, got)
+	})
+
+	t.Run("fail, multiple gpus without multi-gpu mode", func(t *testing.T) {
+		topology := newTopology()
+		topology.MultiGPUMode = MultiGPUModeNone
+		require.Error(t, topology.Verify())
+	})
+
+	t.Run("fail, nvle without link encryption", func(t *testing.T) {
+		topology := newTopology()
+		topology.MultiGPUMode = MultiGPUModeNVLE
+		require.Error(t, topology.Verify())
+
+		topology.LinkEncryption = true
+		require.NoError(t, topology.Verify())
+	})
+
+	t.Run("fail, active link to unknown device", func(t *testing.T) {
+		topology := newTopology()
+		topology.GPUs[1].Links[1].RemoteType = NVLinkRemoteUnknown
+		require.Error(t, topology.Verify())
+	})
+}
@@ -0,0 +1,104 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// gpuVersionsLabel prefixes the data of the GPU versions piece, see labelPrefix.
+var gpuVersionsLabel = []byte("confsec-gpu-versions-v1:")
+
+// GPUVersions are the driver and firmware versions of the GPUs of a node, as reported by NVML.
+type GPUVersions struct {
+	DriverVersion string            `json:"driver_version"`
+	GPUs          []GPUFirmwareInfo `json:"gpus"`
+}
+
+// GPUFirmwareInfo are the firmware versions of a single GPU.
+type GPUFirmwareInfo struct {
+	UUID         string `json:"uuid"`
+	VBIOSVersion string `json:"vbios_version"`
+	// CCFirmwareVersion is the version of the GSP firmware, which enforces confidential computing.
+	CCFirmwareVersion string `json:"cc_firmware_version"`
+}
+
+// GPUVersionsPiece returns the evidence piece with the GPU driver and firmware versions.
+func GPUVersionsPiece(versions *GPUVersions) (*ev.SignedEvidencePiece, error) {
+	return labelledPiece(gpuVersionsLabel, "gpu versions", versions)
+}
+
+// FindGPUVersions returns the GPU versions from the evidence list, false when the list
+// contains no GPU versions piece.
+func FindGPUVersions(list ev.SignedEvidenceList) (*GPUVersions, bool, error) {
+	return findLabelled[*GPUVersions](list, gpuVersionsLabel, "gpu versions")
+}
+
+// CompareVersions compares two dotted NVIDIA versions, e.g. driver version 550.90.07 or VBIOS
+// version 96.00.74.00.1C. Components are compared as hexadecimal numbers, which orders decimal
+// components correctly too. Missing trailing components count as 0. The result is -1 when
+// a < b, 0 when a == b and +1 when a > b.
+func CompareVersions(a, b string) (int, error) {
+	aParts, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	bParts, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range max(len(aParts), len(bParts)) {
+		var x, y uint64
+		if i < len(aParts) {
+			x = aParts[i]
+		}
+		if i < len(bParts) {
+			y = bParts[i]
+		}
+		switch {
+		case x < y:
+			return -1, nil
+		case x > y:
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func parseVersion(v string) ([]uint64, error) {
+	if v == "" {
+		return nil, errors.New("empty version")
+	}
+
+	parts := strings.Split(v, ".")
+	out := make([]uint64, 0, len(parts))
+	for _, part := range parts {
+		n, err := strconv.ParseUint(part, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q: %w", v, err)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
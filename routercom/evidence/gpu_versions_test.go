@@ -0,0 +1,98 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"testing"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGPUVersions(t *testing.T) {
+	versions := &GPUVersions{
+		DriverVersion: "550.90.07",
+		GPUs: []GPUFirmwareInfo{
+			{UUID: "GPU-1", VBIOSVersion: "96.00.74.00.1C", CCFirmwareVersion: "550.90.07"},
+		},
+	}
+
+	t.Run("ok, round trip", func(t *testing.T) {
+		piece, err := GPUVersionsPiece(versions)
+		require.NoError(t, err)
+
+		digests, err := BinaryDigestsPiece([]BinaryDigest{{Path: "/bin/a", SHA256: "aa"}})
+		require.NoError(t, err)
+
+		list := ev.SignedEvidenceList{
+			&ev.SignedEvidencePiece{Type: ev.SevSnpReport, Data: []byte("report")},
+			digests,
+			piece,
+		}
+		got, ok, err := FindGPUVersions(list)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, versions, got)
+	})
+
+	t.Run("ok, no gpu versions", func(t *testing.T) {
+		_, ok, err := FindGPUVersions(ev.SignedEvidenceList{CPUOnlyPiece()})
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+
+	t.Run("fail, invalid gpu versions", func(t *testing.T) {
+		piece, err := GPUVersionsPiece(versions)
+		require.NoError(t, err)
+		piece.Data = piece.Data[:len(piece.Data)-1]
+
+		_, _, err = FindGPUVersions(ev.SignedEvidenceList{piece})
+		require.Error(t, err)
+	})
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "550.90.07", b: "550.90.07", want: 0},
+		{a: "550.90.07", b: "550.90.12", want: -1},
+		{a: "570.86.15", b: "550.90.07", want: 1},
+		{a: "99.10", b: "100.1", want: -1},
+		{a: "550.90", b: "550.90.00", want: 0},
+		{a: "550.90", b: "550.90.01", want: -1},
+		{a: "96.00.74.00.1C", b: "96.00.74.00.0A", want: 1},
+		{a: "96.00.74.00.1c", b: "96.00.74.00.1C", want: 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.a+" vs "+tc.b, func(t *testing.T) {
+			got, err := CompareVersions(tc.a, tc.b)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+
+	for _, invalid := range []string{"", "550..07", "550.90.x7", "r550"} {
+		t.Run("fail, invalid version "+invalid, func(t *testing.T) {
+			_, err := CompareVersions(invalid, "550.90.07")
+			require.Error(t, err)
+		})
+	}
+}
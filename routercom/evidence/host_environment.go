@@ -0,0 +1,81 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// hostEnvironmentLabel prefixes the data of the host environment piece, see labelPrefix.
+var hostEnvironmentLabel = []byte("confsec-host-environment-v1:")
+
+// iommuDisablingParams are kernel command line parameters that turn off DMA protection.
+var iommuDisablingParams = []string{"iommu=off", "amd_iommu=off", "intel_iommu=off", "iommu=pt", "iommu.passthrough=1"}
+
+// HostEnvironment is the kernel and platform state that protects the node against DMA and
+// kernel tampering, as read by compute_boot.
+type HostEnvironment struct {
+	// Lockdown is the active kernel lockdown mode: none, integrity or confidentiality. Empty when
+	// the kernel has no lockdown support.
+	Lockdown string `json:"lockdown"`
+	// IOMMUs are the IOMMU devices registered with the kernel, empty when no IOMMU is active.
+	IOMMUs []string `json:"iommus"`
+	// CPUFlags are the memory encryption flags reported by the CPU, e.g. sme, sev, sev_es and sev_snp.
+	CPUFlags []string `json:"cpu_flags"`
+	// KernelCmdline is the command line the kernel was booted with.
+	KernelCmdline string `json:"kernel_cmdline"`
+}
+
+// Digest returns the SHA-256 digest of the JSON encoded environment, the value compute_boot
+// extends into the host environment PCR.
+func (e HostEnvironment) Digest() ([]byte, error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal host environment: %w", err)
+	}
+	digest := sha256.Sum256(b)
+	return digest[:], nil
+}
+
+// DMAProtected reports whether an IOMMU is active and not turned off or bypassed on the kernel
+// command line.
+func (e HostEnvironment) DMAProtected() bool {
+	if len(e.IOMMUs) == 0 {
+		return false
+	}
+	return !slices.ContainsFunc(strings.Fields(e.KernelCmdline), func(param string) bool {
+		return slices.Contains(iommuDisablingParams, param)
+	})
+}
+
+// HostEnvironmentPiece returns the evidence piece describing the host environment.
+func HostEnvironmentPiece(env HostEnvironment) (*ev.SignedEvidencePiece, error) {
+	return labelledPiece(hostEnvironmentLabel, "host environment", env)
+}
+
+// FindHostEnvironment returns the host environment from the evidence list, false when the list
+// contains no host environment piece.
+func FindHostEnvironment(list ev.SignedEvidenceList) (HostEnvironment, bool, error) {
+	return findLabelled[HostEnvironment](list, hostEnvironmentLabel, "host environment")
+}
@@ -0,0 +1,54 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostEnvironmentDMAProtected(t *testing.T) {
+	tests := map[string]struct {
+		env  HostEnvironment
+		want bool
+	}{
+		"iommu active": {
+			env:  HostEnvironment{IOMMUs: []string{"ivhd0"}, KernelCmdline: "console=ttyS0"},
+			want: true,
+		},
+		"no iommu": {
+			env:  HostEnvironment{KernelCmdline: "console=ttyS0"},
+			want: false,
+		},
+		"iommu turned off": {
+			env:  HostEnvironment{IOMMUs: []string{"ivhd0"}, KernelCmdline: "console=ttyS0 amd_iommu=off"},
+			want: false,
+		},
+		"iommu passthrough": {
+			env:  HostEnvironment{IOMMUs: []string{"dmar0"}, KernelCmdline: "iommu=pt"},
+			want: false,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.want, tc.env.DMAProtected())
+		})
+	}
+}
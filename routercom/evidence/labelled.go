@@ -0,0 +1,111 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package evidence
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// labelPrefix starts the label of every piece compute_boot adds. openpcc has no evidence types for
+// these pieces, they have the unspecified type and are told apart by the label their data starts with.
+var labelPrefix = []byte("confsec-")
+
+// validator is implemented by claims that check their own values.
+type validator interface {
+	Validate() error
+}
+
+// newLabelledPiece returns a labelled piece with data. Its signature is the digest of the data,
+// which compute_boot extends into the evidence PCR, see EvidenceBinding.
+func newLabelledPiece(data []byte) *ev.SignedEvidencePiece {
+	digest := sha256.Sum256(data)
+	return &ev.SignedEvidencePiece{
+		Type:      ev.EvidenceTypeUnspecified,
+		Data:      data,
+		Signature: digest[:],
+	}
+}
+
+// labelledPiece returns the piece with the JSON encoded claim after label. name describes the claim
+// in errors.
+func labelledPiece(label []byte, name string, claim any) (*ev.SignedEvidencePiece, error) {
+	if v, ok := claim.(validator); ok {
+		if err := v.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := json.Marshal(claim)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %w", name, err)
+	}
+
+	return newLabelledPiece(append(bytes.Clone(label), b...)), nil
+}
+
+// findLabelled returns the claim of the first piece with label, false when the list has no such piece.
+func findLabelled[T any](list ev.SignedEvidenceList, label []byte, name string) (T, bool, error) {
+	var zero T
+	for _, piece := range list {
+		if !IsLabelledPiece(piece) {
+			continue
+		}
+		data, ok := bytes.CutPrefix(piece.Data, label)
+		if !ok {
+			continue
+		}
+
+		var claim T
+		if err := json.Unmarshal(data, &claim); err != nil {
+			return zero, false, fmt.Errorf("failed to unmarshal %s: %w", name, err)
+		}
+		if v, ok := any(claim).(validator); ok {
+			if err := v.Validate(); err != nil {
+				return zero, false, err
+			}
+		}
+		return claim, true, nil
+	}
+
+	return zero, false, nil
+}
+
+// IsLabelledPiece reports whether piece was added by compute_boot with a label.
+func IsLabelledPiece(piece *ev.SignedEvidencePiece) bool {
+	return piece != nil && piece.Type == ev.EvidenceTypeUnspecified && bytes.HasPrefix(piece.Data, labelPrefix)
+}
+
+// LabelledPieceDigest returns the digest of a labelled piece that compute_boot extends into the
+// evidence PCR.
+func LabelledPieceDigest(piece *ev.SignedEvidencePiece) []byte {
+	digest := sha256.Sum256(piece.Data)
+	return digest[:]
+}
+
+// pieceLabel returns the label of a labelled piece, the data up to and including the first colon.
+// Markers without a claim are their own label.
+func pieceLabel(piece *ev.SignedEvidencePiece) string {
+	if i := bytes.IndexByte(piece.Data, ':'); i >= 0 {
+		return string(piece.Data[:i+1])
+	}
+	return string(piece.Data)
+}
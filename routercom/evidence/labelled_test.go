@@ -0,0 +1,187 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package evidence
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+// finder adapts a typed find function for the table of labelled pieces.
+func finder[T any](find func(ev.SignedEvidenceList) (T, bool, error)) func(ev.SignedEvidenceList) (any, bool, error) {
+	return func(list ev.SignedEvidenceList) (any, bool, error) {
+		return find(list)
+	}
+}
+
+func TestLabelledPieces(t *testing.T) {
+	tests := map[string]struct {
+		claim any
+		piece func() (*ev.SignedEvidencePiece, error)
+		find  func(ev.SignedEvidenceList) (any, bool, error)
+	}{
+		"azure gpu attestation": {
+			claim: AzureGPUAttestation{MAAToken: "header.claims.signature", NRASNonce: NRASNonce([]string{"gpu-token"})},
+			piece: func() (*ev.SignedEvidencePiece, error) {
+				return AzureGPUPiece(AzureGPUAttestation{MAAToken: "header.claims.signature", NRASNonce: NRASNonce([]string{"gpu-token"})})
+			},
+			find: finder(FindAzureGPUAttestation),
+		},
+		"binary digests": {
+			claim: []BinaryDigest{{Path: "/opt/confidentsec/bin/compute_worker", SHA256: "aa"}},
+			piece: func() (*ev.SignedEvidencePiece, error) {
+				return BinaryDigestsPiece([]BinaryDigest{{Path: "/opt/confidentsec/bin/compute_worker", SHA256: "aa"}})
+			},
+			find: finder(BinaryDigests),
+		},
+		"engine config": {
+			claim: EngineConfig{Engine: "vllm", Unit: "vllm.service", Args: []string{"vllm", "serve", "llama"}},
+			piece: func() (*ev.SignedEvidencePiece, error) {
+				return EngineConfigPiece(EngineConfig{Engine: "vllm", Unit: "vllm.service", Args: []string{"vllm", "serve", "llama"}})
+			},
+			find: finder(FindEngineConfig),
+		},
+		"experimental routes": {
+			claim: ExperimentalRoutes{Routes: []string{"/v1/responses"}},
+			piece: func() (*ev.SignedEvidencePiece, error) {
+				return ExperimentalRoutesPiece(ExperimentalRoutes{Routes: []string{"/v1/responses"}})
+			},
+			find: finder(FindExperimentalRoutes),
+		},
+		"gpu degraded": {
+			claim: GPUDegraded{Reason: "nras unavailable", RetryAfterSeconds: 1800},
+			piece: func() (*ev.SignedEvidencePiece, error) {
+				return GPUDegradedPiece(GPUDegraded{Reason: "nras unavailable", RetryAfterSeconds: 1800})
+			},
+			find: finder(FindGPUDegraded),
+		},
+		"gpu topology": {
+			claim: &GPUTopology{MultiGPUMode: MultiGPUModeNone, GPUs: []TopologyGPU{{UUID: "GPU-1", PCIBusID: "0000:01:00.0"}}},
+			piece: func() (*ev.SignedEvidencePiece, error) {
+				return GPUTopologyPiece(&GPUTopology{MultiGPUMode: MultiGPUModeNone, GPUs: []TopologyGPU{{UUID: "GPU-1", PCIBusID: "0000:01:00.0"}}})
+			},
+			find: finder(FindGPUTopology),
+		},
+		"gpu versions": {
+			claim: &GPUVersions{DriverVersion: "550.90.07", GPUs: []GPUFirmwareInfo{{UUID: "GPU-1", VBIOSVersion: "96.00.74.00.1C"}}},
+			piece: func() (*ev.SignedEvidencePiece, error) {
+				return GPUVersionsPiece(&GPUVersions{DriverVersion: "550.90.07", GPUs: []GPUFirmwareInfo{{UUID: "GPU-1", VBIOSVersion: "96.00.74.00.1C"}}})
+			},
+			find: finder(FindGPUVersions),
+		},
+		"host environment": {
+			claim: HostEnvironment{Lockdown: "integrity", IOMMUs: []string{"ivhd0"}, KernelCmdline: "console=ttyS0"},
+			piece: func() (*ev.SignedEvidencePiece, error) {
+				return HostEnvironmentPiece(HostEnvironment{Lockdown: "integrity", IOMMUs: []string{"ivhd0"}, KernelCmdline: "console=ttyS0"})
+			},
+			find: finder(FindHostEnvironment),
+		},
+		"maintenance": {
+			claim: Maintenance{Reason: "INC-1234 gpu diagnostics"},
+			piece: func() (*ev.SignedEvidencePiece, error) {
+				return MaintenancePiece(Maintenance{Reason: "INC-1234 gpu diagnostics"})
+			},
+			find: finder(FindMaintenance),
+		},
+		"nvlink domain": {
+			claim: NVLinkDomain{DomainID: "8c1f5e2a", CliqueID: 7, Trays: []NVLinkDomainTray{{ID: "tray-1", SwitchUUIDs: []string{"SWX-1"}}}},
+			piece: func() (*ev.SignedEvidencePiece, error) {
+				return NVLinkDomainPiece(NVLinkDomain{DomainID: "8c1f5e2a", CliqueID: 7, Trays: []NVLinkDomainTray{{ID: "tray-1", SwitchUUIDs: []string{"SWX-1"}}}})
+			},
+			find: finder(FindNVLinkDomain),
+		},
+		"output filter": {
+			claim: OutputFilter{Digest: strings.Repeat("ab", 32)},
+			piece: func() (*ev.SignedEvidencePiece, error) {
+				return OutputFilterPiece(OutputFilter{Digest: strings.Repeat("ab", 32)})
+			},
+			find: finder(FindOutputFilter),
+		},
+		"quote chain": {
+			claim: QuoteChain{Links: []QuoteChainLink{{Quote: []byte("quote"), Signature: []byte("signature")}}},
+			piece: func() (*ev.SignedEvidencePiece, error) {
+				return QuoteChainPiece(QuoteChain{Links: []QuoteChainLink{{Quote: []byte("quote"), Signature: []byte("signature")}}})
+			},
+			find: finder(FindQuoteChain),
+		},
+		"secure boot": {
+			claim: SecureBoot{Enabled: true, DBXEntries: 217},
+			piece: func() (*ev.SignedEvidencePiece, error) {
+				return SecureBootPiece(SecureBoot{Enabled: true, DBXEntries: 217})
+			},
+			find: finder(FindSecureBoot),
+		},
+		"time sync": {
+			claim: TimeSync{Synchronized: true, MaxErrorNanos: 12_000_000, Time: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)},
+			piece: func() (*ev.SignedEvidencePiece, error) {
+				return TimeSyncPiece(TimeSync{Synchronized: true, MaxErrorNanos: 12_000_000, Time: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)})
+			},
+			find: finder(FindTimeSync),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run("ok, round trip "+name, func(t *testing.T) {
+			piece, err := tc.piece()
+			require.NoError(t, err)
+			require.True(t, IsLabelledPiece(piece))
+			require.False(t, IsCPUOnlyPiece(piece))
+			require.Equal(t, LabelledPieceDigest(piece), piece.Signature)
+
+			list := ev.SignedEvidenceList{
+				&ev.SignedEvidencePiece{Type: ev.SevSnpReport, Data: []byte("report")},
+				CPUOnlyPiece(),
+				piece,
+			}
+			got, ok, err := tc.find(list)
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Equal(t, tc.claim, got)
+			require.NoError(t, verifyLabelledPieces(list))
+		})
+
+		t.Run("ok, no piece "+name, func(t *testing.T) {
+			_, ok, err := tc.find(ev.SignedEvidenceList{CPUOnlyPiece()})
+			require.NoError(t, err)
+			require.False(t, ok)
+		})
+
+		t.Run("ok, label with another type is ignored "+name, func(t *testing.T) {
+			piece, err := tc.piece()
+			require.NoError(t, err)
+			piece.Type = ev.SevSnpReport
+
+			_, ok, err := tc.find(ev.SignedEvidenceList{piece})
+			require.NoError(t, err)
+			require.False(t, ok)
+		})
+
+		t.Run("fail, truncated "+name, func(t *testing.T) {
+			piece, err := tc.piece()
+			require.NoError(t, err)
+			piece.Data = piece.Data[:len(piece.Data)-1]
+
+			_, _, err = tc.find(ev.SignedEvidenceList{piece})
+			require.Error(t, err)
+			require.Error(t, verifyLabelledPieces(ev.SignedEvidenceList{piece}))
+		})
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+const (
+	// DefaultMaxPieceSize is the default maximum size of a single evidence piece
+	// after decompression. Event logs and certificate chains are the largest pieces.
+	DefaultMaxPieceSize = 4 * 1024 * 1024 // 4MB
+	// DefaultMaxTotalSize is the default maximum size of the evidence payload on the wire.
+	DefaultMaxTotalSize = 1024 * 1024 // 1MB
+	// DefaultCompressThreshold is the default size from which the data of a piece is compressed.
+	DefaultCompressThreshold = 16 * 1024 // 16KB
+
+	// compressedFlag is set on the length prefix when the payload may contain compressed pieces.
+	// Payloads without the flag are a plain marshalled evidence list.
+	compressedFlag = 1 << 31
+)
+
+var (
+	// ErrPieceTooLarge is returned when a single evidence piece exceeds the piece budget.
+	ErrPieceTooLarge = errors.New("evidence piece too large")
+	// ErrEvidenceTooLarge is returned when the evidence payload exceeds the total budget.
+	ErrEvidenceTooLarge = errors.New("evidence too large")
+)
+
+// Limits are the size budgets for evidence exchanged between compute_boot and router_com.
+// Sender and receiver should use the same limits.
+type Limits struct {
+	// MaxPieceSize is the maximum size in bytes of the data and signature of a single
+	// evidence piece, after decompression.
+	MaxPieceSize int `yaml:"max_piece_size"`
+	// MaxTotalSize is the maximum size in bytes of the evidence payload on the wire,
+	// after compression.
+	MaxTotalSize int `yaml:"max_total_size"`
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		MaxPieceSize: DefaultMaxPieceSize,
+		MaxTotalSize: DefaultMaxTotalSize,
+	}
+}
+
+func (l Limits) validate() error {
+	if l.MaxPieceSize <= 0 {
+		return fmt.Errorf("invalid max piece size: %d", l.MaxPieceSize)
+	}
+	// the length prefix reserves the highest bit for the compressed flag.
+	if l.MaxTotalSize <= 0 || l.MaxTotalSize >= compressedFlag {
+		return fmt.Errorf("invalid max total size: %d", l.MaxTotalSize)
+	}
+	return nil
+}
+
+// checkPieces checks the uncompressed pieces against the piece budget.
+func (l Limits) checkPieces(evidence ev.SignedEvidenceList) error {
+	for i, piece := range evidence {
+		size := len(piece.Data) + len(piece.Signature)
+		if size > l.MaxPieceSize {
+			return fmt.Errorf("%w: piece %d of type %v is %d bytes, maximum is %d", ErrPieceTooLarge, i, piece.Type, size, l.MaxPieceSize)
+		}
+	}
+	return nil
+}
+
+// checkPayload checks the payload length on the wire against the total budget.
+func (l Limits) checkPayload(n int) error {
+	if n > l.MaxTotalSize {
+		return fmt.Errorf("%w: payload is %d bytes, maximum is %d", ErrEvidenceTooLarge, n, l.MaxTotalSize)
+	}
+	return nil
+}
+
+// encodePayload marshals the evidence, compressing the data of pieces that are at least
+// threshold bytes. A threshold of 0 disables compression. It returns the payload and the
+// flags for the length prefix.
+//
+// A compressed payload starts with the number of compressed pieces and their indices as
+// uvarints, followed by the marshalled evidence list.
+func encodePayload(evidence ev.SignedEvidenceList, threshold int) ([]byte, uint32, error) {
+	var (
+		list       ev.SignedEvidenceList
+		compressed []int
+	)
+	if threshold > 0 {
+		for i, piece := range evidence {
+			if len(piece.Data) < threshold {
+				continue
+			}
+
+			data, err := compress(piece.Data)
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed to compress evidence piece %d: %w", i, err)
+			}
+			if len(data) >= len(piece.Data) {
+				continue
+			}
+
+			if list == nil {
+				list = slices.Clone(evidence)
+			}
+			// copy the piece, the evidence of the caller is left untouched.
+			cp := *piece
+			cp.Data = data
+			list[i] = &cp
+			compressed = append(compressed, i)
+		}
+	}
+
+	if len(compressed) == 0 {
+		data, err := evidence.MarshalBinary()
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to marshal evidence to binary: %w", err)
+		}
+		return data, 0, nil
+	}
+
+	data, err := list.MarshalBinary()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to marshal evidence to binary: %w", err)
+	}
+
+	payload := binary.AppendUvarint(nil, uint64(len(compressed)))
+	for _, i := range compressed {
+		payload = binary.AppendUvarint(payload, uint64(i))
+	}
+	return append(payload, data...), compressedFlag, nil
+}
+
+// decodePayload is the inverse of encodePayload. Decompressed pieces are limited to the
+// piece budget so that a small payload can't expand without bounds.
+func decodePayload(data []byte, flags uint32, limits Limits) (ev.SignedEvidenceList, error) {
+	var compressed []uint64
+	if flags&compressedFlag != 0 {
+		r := bytes.NewReader(data)
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read compressed piece count: %w", err)
+		}
+		// every index takes at least one byte.
+		if n > uint64(r.Len()) {
+			return nil, fmt.Errorf("invalid compressed piece count %d", n)
+		}
+		compressed = make([]uint64, 0, n)
+		for range n {
+			i, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read compressed piece index: %w", err)
+			}
+			if len(compressed) > 0 && i <= compressed[len(compressed)-1] {
+				return nil, fmt.Errorf("compressed piece index %d out of order", i)
+			}
+			compressed = append(compressed, i)
+		}
+		data = data[len(data)-r.Len():]
+	}
+
+	var evidence ev.SignedEvidenceList
+	if err := evidence.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal signed evidence list: %w", err)
+	}
+
+	for _, i := range compressed {
+		if i >= uint64(len(evidence)) {
+			return nil, fmt.Errorf("compressed piece index %d out of range", i)
+		}
+		piece := evidence[i]
+		decompressed, err := decompress(piece.Data, limits.MaxPieceSize-len(piece.Signature))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress evidence piece %d: %w", i, err)
+		}
+		piece.Data = decompressed
+	}
+
+	if err := limits.checkPieces(evidence); err != nil {
+		return nil, err
+	}
+
+	return evidence, nil
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress decompresses data, failing with ErrPieceTooLarge when the result exceeds limit bytes.
+func decompress(data []byte, limit int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > limit {
+		return nil, fmt.Errorf("%w: decompressed data exceeds %d bytes", ErrPieceTooLarge, limit)
+	}
+	return out, nil
+}
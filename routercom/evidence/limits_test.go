@@ -0,0 +1,128 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecodePayload(t *testing.T) {
+	eventLog := bytes.Repeat([]byte("event-log-entry;"), 4096)
+
+	tests := map[string]struct {
+		evidence       ev.SignedEvidenceList
+		threshold      int
+		wantCompressed bool
+	}{
+		"ok, small pieces are not compressed": {
+			evidence: ev.SignedEvidenceList{
+				&ev.SignedEvidencePiece{Type: ev.SevSnpReport, Data: []byte("test-data"), Signature: []byte("test-signature")},
+			},
+			threshold: DefaultCompressThreshold,
+		},
+		"ok, large piece is compressed": {
+			evidence: ev.SignedEvidenceList{
+				&ev.SignedEvidencePiece{Type: ev.SevSnpReport, Data: []byte("test-data"), Signature: []byte("test-signature")},
+				&ev.SignedEvidencePiece{Type: ev.SevSnpReport, Data: eventLog, Signature: []byte("test-signature")},
+			},
+			threshold:      DefaultCompressThreshold,
+			wantCompressed: true,
+		},
+		"ok, compression disabled": {
+			evidence: ev.SignedEvidenceList{
+				&ev.SignedEvidencePiece{Type: ev.SevSnpReport, Data: eventLog, Signature: []byte("test-signature")},
+			},
+			threshold: 0,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			data, flags, err := encodePayload(tc.evidence, tc.threshold)
+			require.NoError(t, err)
+			require.Equal(t, tc.wantCompressed, flags&compressedFlag != 0)
+			// the evidence of the caller is untouched.
+			if tc.wantCompressed {
+				require.Equal(t, eventLog, tc.evidence[1].Data)
+				require.Less(t, len(data), len(eventLog))
+			}
+
+			got, err := decodePayload(data, flags, DefaultLimits())
+			require.NoError(t, err)
+			require.Equal(t, tc.evidence, got)
+		})
+	}
+}
+
+func TestDecodePayload(t *testing.T) {
+	compressedPayload := func(t *testing.T, data []byte, indices ...uint64) []byte {
+		list := ev.SignedEvidenceList{
+			&ev.SignedEvidencePiece{Type: ev.SevSnpReport, Data: data},
+		}
+		b, err := list.MarshalBinary()
+		require.NoError(t, err)
+
+		payload := binary.AppendUvarint(nil, uint64(len(indices)))
+		for _, i := range indices {
+			payload = binary.AppendUvarint(payload, i)
+		}
+		return append(payload, b...)
+	}
+
+	t.Run("fail, decompressed piece over budget", func(t *testing.T) {
+		data, err := compress(make([]byte, 1024))
+		require.NoError(t, err)
+
+		_, err = decodePayload(compressedPayload(t, data, 0), compressedFlag, Limits{MaxPieceSize: 1023, MaxTotalSize: DefaultMaxTotalSize})
+		require.ErrorIs(t, err, ErrPieceTooLarge)
+	})
+
+	t.Run("fail, uncompressed piece over budget", func(t *testing.T) {
+		list := ev.SignedEvidenceList{
+			&ev.SignedEvidencePiece{Type: ev.SevSnpReport, Data: make([]byte, 1024)},
+		}
+		b, err := list.MarshalBinary()
+		require.NoError(t, err)
+
+		_, err = decodePayload(b, 0, Limits{MaxPieceSize: 1023, MaxTotalSize: DefaultMaxTotalSize})
+		require.ErrorIs(t, err, ErrPieceTooLarge)
+	})
+
+	t.Run("fail, compressed index out of range", func(t *testing.T) {
+		data, err := compress([]byte("test-data"))
+		require.NoError(t, err)
+
+		_, err = decodePayload(compressedPayload(t, data, 1), compressedFlag, DefaultLimits())
+		require.Error(t, err)
+	})
+
+	t.Run("fail, piece is not compressed", func(t *testing.T) {
+		_, err := decodePayload(compressedPayload(t, []byte("test-data"), 0), compressedFlag, DefaultLimits())
+		require.Error(t, err)
+	})
+
+	t.Run("fail, compressed index count exceeds payload", func(t *testing.T) {
+		_, err := decodePayload(binary.AppendUvarint(nil, 1<<40), compressedFlag, DefaultLimits())
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,59 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// maintenanceLabel prefixes the data of the maintenance piece, see labelPrefix.
+var maintenanceLabel = []byte("confsec-maintenance-v1:")
+
+// Maintenance discloses that a node was booted in maintenance mode. A node in maintenance mode
+// refuses all confidential requests, so operators can run diagnostics on it without clients
+// trusting it with their prompts.
+type Maintenance struct {
+	// Reason is the operator provided reason, e.g. an incident ID. It must not contain client data.
+	Reason string `json:"reason"`
+}
+
+// Digest returns the SHA-256 digest of the JSON encoded maintenance claim, the value compute_boot
+// extends into the maintenance PCR.
+func (m Maintenance) Digest() ([]byte, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal maintenance: %w", err)
+	}
+	digest := sha256.Sum256(b)
+	return digest[:], nil
+}
+
+// MaintenancePiece returns the evidence piece disclosing maintenance mode.
+func MaintenancePiece(m Maintenance) (*ev.SignedEvidencePiece, error) {
+	return labelledPiece(maintenanceLabel, "maintenance", m)
+}
+
+// FindMaintenance returns the maintenance claim from the evidence list, false when the node is not
+// in maintenance mode.
+func FindMaintenance(list ev.SignedEvidenceList) (Maintenance, bool, error) {
+	return findLabelled[Maintenance](list, maintenanceLabel, "maintenance")
+}
@@ -0,0 +1,80 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package evidence
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// mirrorLabel prefixes the data of the mirror piece, see labelPrefix.
+var mirrorLabel = []byte("confsec-mirror-v1:")
+
+// Mirror discloses the shadow backend compute_worker duplicates validated requests to. The shadow
+// backend receives plaintext requests, so it must run on the node itself.
+type Mirror struct {
+	// BaseURL is the url of the shadow backend.
+	BaseURL string `json:"base_url"`
+}
+
+// Validate checks the base url is an http url of a loopback host, mirrored requests never leave the
+// node.
+func (m Mirror) Validate() error {
+	u, err := url.Parse(m.BaseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid mirror base url %q", m.BaseURL)
+	}
+	if !isLoopbackHost(u.Hostname()) {
+		return fmt.Errorf("mirror base url %q is not a loopback url", m.BaseURL)
+	}
+	return nil
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback address.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Digest returns the SHA-256 digest of the JSON encoded mirror claim, the value compute_boot extends
+// into the mirror PCR.
+func (m Mirror) Digest() ([]byte, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal mirror: %w", err)
+	}
+	digest := sha256.Sum256(b)
+	return digest[:], nil
+}
+
+// MirrorPiece returns the evidence piece disclosing the mirror.
+func MirrorPiece(m Mirror) (*ev.SignedEvidencePiece, error) {
+	return labelledPiece(mirrorLabel, "mirror", m)
+}
+
+// FindMirror returns the mirror from the evidence list, false when the node doesn't mirror requests.
+func FindMirror(list ev.SignedEvidenceList) (Mirror, bool, error) {
+	return findLabelled[Mirror](list, mirrorLabel, "mirror")
+}
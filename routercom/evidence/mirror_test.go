@@ -0,0 +1,57 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package evidence
+
+import (
+	"testing"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirror(t *testing.T) {
+	tests := map[string]struct {
+		baseURL string
+		wantErr bool
+	}{
+		"ok, localhost":          {baseURL: "http://localhost:8001"},
+		"ok, loopback ipv4":      {baseURL: "http://127.0.0.1:8001"},
+		"ok, loopback ipv6":      {baseURL: "https://[::1]:8001"},
+		"fail, remote host":      {baseURL: "https://shadow.example.com", wantErr: true},
+		"fail, private address":  {baseURL: "http://10.0.0.5:8001", wantErr: true},
+		"fail, unix scheme":      {baseURL: "unix:///run/shadow.sock", wantErr: true},
+		"fail, relative url":     {baseURL: "localhost:8001/v1", wantErr: true},
+		"fail, localhost suffix": {baseURL: "http://localhost.example.com", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			piece, err := MirrorPiece(Mirror{BaseURL: tc.baseURL})
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			m, ok, err := FindMirror(ev.SignedEvidenceList{piece})
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Equal(t, tc.baseURL, m.BaseURL)
+			require.NoError(t, verifyLabelledPieces(ev.SignedEvidenceList{piece}))
+		})
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"errors"
+	"fmt"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// nvlinkDomainLabel prefixes the data of the NVLink domain piece, a piece of unspecified type like
+// the Azure GPU attestation.
+var nvlinkDomainLabel = []byte("confsec-nvlink-domain-v1:")
+
+// NVLinkDomain describes the multi-node NVLink domain of a node, e.g. a GB200 NVL72 rack, whose
+// NVSwitches live in separate switch trays. The NVSwitch evidence of the node covers the switches
+// of the attested trays.
+type NVLinkDomain struct {
+	// DomainID is the cluster UUID the fabric manager assigned to the NVLink domain.
+	DomainID string `json:"domain_id"`
+	// CliqueID is the clique of the GPUs of the node within the domain.
+	CliqueID uint32 `json:"clique_id"`
+	// Trays are the switch trays whose switches were attested.
+	Trays []NVLinkDomainTray `json:"trays"`
+	// MissingTrays are the configured switch trays that could not be attested. A non-empty list
+	// means the domain is partial, verifiers decide whether they accept that.
+	MissingTrays []string `json:"missing_trays,omitempty"`
+}
+
+// NVLinkDomainTray is an attested switch tray of an NVLink domain.
+type NVLinkDomainTray struct {
+	ID          string   `json:"id"`
+	SwitchUUIDs []string `json:"switch_uuids"`
+}
+
+// Partial reports whether switch trays of the domain are missing from the evidence.
+func (d NVLinkDomain) Partial() bool {
+	return len(d.MissingTrays) > 0
+}
+
+// Validate checks the domain has an ID and every tray is either attested or missing.
+func (d NVLinkDomain) Validate() error {
+	if d.DomainID == "" {
+		return errors.New("invalid nvlink domain: missing domain id")
+	}
+	attested := map[string]bool{}
+	for _, tray := range d.Trays {
+		if tray.ID == "" {
+			return errors.New("invalid nvlink domain: tray without id")
+		}
+		attested[tray.ID] = true
+	}
+	for _, id := range d.MissingTrays {
+		if attested[id] {
+			return fmt.Errorf("invalid nvlink domain: tray %s is both attested and missing", id)
+		}
+	}
+	return nil
+}
+
+// NVLinkDomainPiece returns the evidence piece with the NVLink domain of the node.
+func NVLinkDomainPiece(domain NVLinkDomain) (*ev.SignedEvidencePiece, error) {
+	return labelledPiece(nvlinkDomainLabel, "nvlink domain", domain)
+}
+
+// FindNVLinkDomain returns the NVLink domain from the evidence list, false when the node is not
+// part of a multi-node NVLink domain.
+func FindNVLinkDomain(list ev.SignedEvidenceList) (NVLinkDomain, bool, error) {
+	return findLabelled[NVLinkDomain](list, nvlinkDomainLabel, "nvlink domain")
+}
@@ -0,0 +1,81 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNVLinkDomainPartial(t *testing.T) {
+	domain := NVLinkDomain{
+		DomainID: "8c1f5e2a-3b4d-4e6f-9a1b-2c3d4e5f6a7b",
+		CliqueID: 7,
+		Trays: []NVLinkDomainTray{
+			{ID: "tray-1", SwitchUUIDs: []string{"SWX-1", "SWX-2"}},
+		},
+		MissingTrays: []string{"tray-2"},
+	}
+	require.True(t, domain.Partial())
+
+	domain.MissingTrays = nil
+	require.False(t, domain.Partial())
+}
+
+func TestNVLinkDomainValidate(t *testing.T) {
+	tests := map[string]struct {
+		domain  NVLinkDomain
+		wantErr bool
+	}{
+		"ok, partial domain": {
+			domain: NVLinkDomain{DomainID: "8c1f5e2a", Trays: []NVLinkDomainTray{{ID: "tray-1"}}, MissingTrays: []string{"tray-2"}},
+		},
+		"fail, missing domain id": {
+			domain:  NVLinkDomain{Trays: []NVLinkDomainTray{{ID: "tray-1"}}},
+			wantErr: true,
+		},
+		"fail, tray without id": {
+			domain:  NVLinkDomain{DomainID: "8c1f5e2a", Trays: []NVLinkDomainTray{{SwitchUUIDs: []string{"SWX-1"}}}},
+			wantErr: true,
+		},
+		"fail, tray attested and missing": {
+			domain:  NVLinkDomain{DomainID: "8c1f5e2a", Trays: []NVLinkDomainTray{{ID: "tray-1"}}, MissingTrays: []string{"tray-1"}},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.domain.Validate()
+			if tc.wantErr {
+				require.Error(t, err)
+				// router_com rejects the invalid domain as part of the evidence.
+				b, err := json.Marshal(tc.domain)
+				require.NoError(t, err)
+				piece := newLabelledPiece(append(bytes.Clone(nvlinkDomainLabel), b...))
+				require.Error(t, verifyLabelledPieces(ev.SignedEvidenceList{piece}))
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// outputFilterLabel prefixes the data of the output filter piece, see labelPrefix.
+var outputFilterLabel = []byte("confsec-output-filter-v1:")
+
+// OutputFilter discloses the output filter module compute_worker passes the plaintext output through,
+// so clients can tell which operator policy applies to their responses.
+type OutputFilter struct {
+	// Digest is the hex encoded SHA-256 digest of the filter module.
+	Digest string `json:"digest"`
+}
+
+// Validate checks the digest is a hex encoded SHA-256 digest.
+func (f OutputFilter) Validate() error {
+	b, err := hex.DecodeString(f.Digest)
+	if err != nil || len(b) != 32 {
+		return fmt.Errorf("invalid output filter digest: %q", f.Digest)
+	}
+	return nil
+}
+
+// OutputFilterPiece returns the evidence piece disclosing the output filter.
+func OutputFilterPiece(f OutputFilter) (*ev.SignedEvidencePiece, error) {
+	return labelledPiece(outputFilterLabel, "output filter", f)
+}
+
+// FindOutputFilter returns the output filter from the evidence list, false when the node doesn't
+// filter its output.
+func FindOutputFilter(list ev.SignedEvidenceList) (OutputFilter, bool, error) {
+	return findLabelled[OutputFilter](list, outputFilterLabel, "output filter")
+}
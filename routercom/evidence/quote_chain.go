@@ -0,0 +1,115 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker/output/wire"
+	"github.com/google/go-tpm/tpm2"
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// quoteChainLabel prefixes the data of the quote chain piece, see labelPrefix.
+var quoteChainLabel = []byte("confsec-quote-chain-v1:")
+
+// QuoteChain is the audit trail of the successive TPM quotes of a node. Every quote carries the
+// digest of the previous link in its extra data, so the chain can't be reordered or spliced, and
+// verifiers get continuity evidence that the same TPM attested the node over time.
+type QuoteChain struct {
+	// Links are the quotes, oldest first. Old links are dropped as the chain grows, the first link
+	// is not necessarily the first quote of the node.
+	Links []QuoteChainLink `json:"links"`
+}
+
+// QuoteChainLink is a quote of the chain.
+type QuoteChainLink struct {
+	// Quote is the marshalled TPMS_ATTEST of the quote.
+	Quote []byte `json:"quote"`
+	// Signature is the marshalled TPMT_SIGNATURE of the quote by the attestation key.
+	Signature []byte `json:"signature"`
+}
+
+// Digest returns the digest of the link, the extra data of the next quote of the chain.
+func (l QuoteChainLink) Digest() []byte {
+	h := sha256.New()
+	h.Write(quoteChainLabel)
+	h.Write(l.Quote)
+	h.Write(l.Signature)
+	return h.Sum(nil)
+}
+
+// NextExtraData returns the extra data of the next quote of the chain. The first quote of a chain
+// carries the digest of the label, so it can't be a quote made for another purpose.
+func (c QuoteChain) NextExtraData() []byte {
+	if len(c.Links) == 0 {
+		digest := sha256.Sum256(quoteChainLabel)
+		return digest[:]
+	}
+	return c.Links[len(c.Links)-1].Digest()
+}
+
+// Verify checks the links are quotes signed by the attestation key, a marshalled TPMT_PUBLIC, that
+// every quote carries the digest of the previous link and that the TPM clock and reset count never
+// went backwards.
+func (c QuoteChain) Verify(akPublic []byte) error {
+	if len(c.Links) == 0 {
+		return errors.New("empty quote chain")
+	}
+
+	var prev *tpm2.TPMSAttest
+	for i, link := range c.Links {
+		if err := wire.VerifyAKSignature(akPublic, link.Quote, link.Signature); err != nil {
+			return fmt.Errorf("link %d: %w", i, err)
+		}
+		attest, err := tpm2.Unmarshal[tpm2.TPMSAttest](link.Quote)
+		if err != nil {
+			return fmt.Errorf("link %d: failed to unmarshal quote: %w", i, err)
+		}
+		if attest.Type != tpm2.TPMSTAttestQuote {
+			return fmt.Errorf("link %d: not a quote", i)
+		}
+		if i > 0 && !bytes.Equal(attest.ExtraData.Buffer, c.Links[i-1].Digest()) {
+			return fmt.Errorf("link %d: extra data is not the digest of the previous link", i)
+		}
+		if prev != nil {
+			if attest.ClockInfo.ResetCount < prev.ClockInfo.ResetCount {
+				return fmt.Errorf("link %d: tpm reset count went backwards", i)
+			}
+			if attest.ClockInfo.Clock < prev.ClockInfo.Clock {
+				return fmt.Errorf("link %d: tpm clock went backwards", i)
+			}
+		}
+		prev = attest
+	}
+	return nil
+}
+
+// QuoteChainPiece returns the evidence piece carrying the quote chain.
+func QuoteChainPiece(c QuoteChain) (*ev.SignedEvidencePiece, error) {
+	return labelledPiece(quoteChainLabel, "quote chain", c)
+}
+
+// FindQuoteChain returns the quote chain from the evidence list, false when the list contains no
+// quote chain piece.
+func FindQuoteChain(list ev.SignedEvidenceList) (QuoteChain, bool, error) {
+	return findLabelled[QuoteChain](list, quoteChainLabel, "quote chain")
+}
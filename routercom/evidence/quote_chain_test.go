@@ -0,0 +1,79 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuoteChain(t *testing.T) {
+	ak := newTestAK(t)
+	akPublic := ak.public
+
+	// quote signs a quote with extra data and clock the way the TPM does.
+	quote := func(t *testing.T, extraData []byte, clock uint64) QuoteChainLink {
+		t.Helper()
+		b := tpm2.Marshal(tpm2.TPMSAttest{
+			Magic:     tpm2.TPMGeneratedValue,
+			Type:      tpm2.TPMSTAttestQuote,
+			ExtraData: tpm2.TPM2BData{Buffer: extraData},
+			ClockInfo: tpm2.TPMSClockInfo{Clock: clock, ResetCount: 1},
+			Attested:  tpm2.NewTPMUAttest(tpm2.TPMSTAttestQuote, &tpm2.TPMSQuoteInfo{}),
+		})
+		return QuoteChainLink{Quote: b, Signature: ak.sign(t, b)}
+	}
+	// extend adds a quote to the chain.
+	extend := func(t *testing.T, chain QuoteChain, clock uint64) QuoteChain {
+		t.Helper()
+		chain.Links = append(chain.Links, quote(t, chain.NextExtraData(), clock))
+		return chain
+	}
+
+	chain := extend(t, extend(t, extend(t, QuoteChain{}, 100), 200), 300)
+
+	t.Run("ok", func(t *testing.T) {
+		require.NoError(t, chain.Verify(akPublic))
+		// dropping old links keeps the chain valid.
+		require.NoError(t, QuoteChain{Links: chain.Links[1:]}.Verify(akPublic))
+	})
+
+	t.Run("fail, empty chain", func(t *testing.T) {
+		require.Error(t, QuoteChain{}.Verify(akPublic))
+	})
+
+	t.Run("fail, link removed", func(t *testing.T) {
+		spliced := QuoteChain{Links: []QuoteChainLink{chain.Links[0], chain.Links[2]}}
+		require.ErrorContains(t, spliced.Verify(akPublic), "extra data")
+	})
+
+	t.Run("fail, quote not chained", func(t *testing.T) {
+		broken := QuoteChain{Links: []QuoteChainLink{chain.Links[0], quote(t, []byte("nonce"), 400)}}
+		require.ErrorContains(t, broken.Verify(akPublic), "extra data")
+	})
+
+	t.Run("fail, clock went backwards", func(t *testing.T) {
+		require.ErrorContains(t, extend(t, chain, 50).Verify(akPublic), "clock")
+	})
+
+	t.Run("fail, other key", func(t *testing.T) {
+		require.Error(t, chain.Verify(newTestAK(t).public))
+	})
+}
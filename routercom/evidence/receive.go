@@ -19,53 +19,102 @@ package evidence
 
 import (
 	"context"
+	"crypto/hmac"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
-	"os"
 	"time"
 
+	"github.com/confidentsecurity/confidentcompute/faultinject"
+	"github.com/confidentsecurity/confidentcompute/listen"
 	ev "github.com/openpcc/openpcc/attestation/evidence"
 )
 
-const (
-	DefaultSocket = "/tmp/router.sock"
-	maxPayloadLen = 1024 * 1024 // 1MB
-)
+const DefaultSocket = "/tmp/router.sock"
 
 // ReceiveConfig is config for how router com gets evidence from compute_boot
 type ReceiveConfig struct {
 	// Socket is the socket to receive evidence on
 	Socket string `yaml:"socket"`
+	// Address is where to receive evidence on instead of Socket, e.g. a vsock port. Evidence received
+	// on tcp or vsock must be authenticated with SecretFile. Leave blank to use Socket.
+	Address *listen.Config `yaml:"address"`
 	// Timeout is how long to wait for evidence
 	Timeout time.Duration `yaml:"timeout"`
+	// Limits are the size budgets for the evidence, evidence over budget is rejected.
+	Limits Limits `yaml:"limits"`
+	// PeerUID is the uid compute_boot runs as, connections from other users are rejected.
+	// Leave blank to accept any user.
+	PeerUID *uint32 `yaml:"peer_uid"`
+	// PeerGID is the gid compute_boot runs as, connections from other groups are rejected.
+	// Leave blank to accept any group.
+	PeerGID *uint32 `yaml:"peer_gid"`
+	// SecretFile holds the boot-time secret shared with compute_boot, evidence without a valid
+	// HMAC of the secret is rejected. Leave blank to not authenticate the evidence.
+	SecretFile string `yaml:"secret_file"`
 }
 
 func DefaultReceiverConfig() ReceiveConfig {
 	return ReceiveConfig{
 		Socket:  DefaultSocket,
 		Timeout: 60 * time.Second,
+		Limits:  DefaultLimits(),
+	}
+}
+
+// address returns where to receive the evidence.
+func (c ReceiveConfig) address() listen.Config {
+	if c.Address != nil {
+		return *c.Address
 	}
+	return listen.UnixSocket(c.Socket, 0)
+}
+
+func (c ReceiveConfig) validateAddress() error {
+	addr := c.address()
+	if addr.Network == listen.Unix && addr.Address == "" {
+		return errors.New("missing socket")
+	}
+	if err := addr.Validate(); err != nil {
+		return err
+	}
+	if addr.Network == listen.Unix {
+		return nil
+	}
+	// only unix sockets carry the credentials of the peer.
+	if c.PeerUID != nil || c.PeerGID != nil {
+		return fmt.Errorf("peer credentials can't be checked on %s", addr.Network)
+	}
+	if c.SecretFile == "" {
+		return fmt.Errorf("evidence received on %s must be authenticated with a secret file", addr.Network)
+	}
+	return nil
 }
 
 func Receive(ctx context.Context, cfg ReceiveConfig) (ev.SignedEvidenceList, error) {
-	if cfg.Socket == "" {
-		return nil, errors.New("missing socket")
+	if err := cfg.validateAddress(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Limits.validate(); err != nil {
+		return nil, err
+	}
+	secret, err := readSecret(cfg.SecretFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := faultinject.Inject(ctx, faultinject.EvidenceReceive); err != nil {
+		return nil, err
 	}
 
 	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
 	defer cancel()
 
-	// Create and listen on Unix socket
-	if err := os.RemoveAll(cfg.Socket); err != nil {
-		return nil, fmt.Errorf("failed to remove existing socket: %w", err)
-	}
-
-	slog.InfoContext(ctx, "Listening for evidence", "socket", cfg.Socket, "timeout", cfg.Timeout)
-	listener, err := net.Listen("unix", cfg.Socket)
+	addr := cfg.address()
+	slog.InfoContext(ctx, "Listening for evidence", "address", addr, "timeout", cfg.Timeout)
+	listener, err := addr.Listen()
 	if err != nil {
 		return nil, fmt.Errorf("failed to listen on socket: %w", err)
 	}
@@ -79,13 +128,9 @@ func Receive(ctx context.Context, cfg ReceiveConfig) (ev.SignedEvidenceList, err
 		}
 	}()
 
-	conn, err := listener.Accept()
+	conn, err := accept(ctx, listener, cfg)
 	if err != nil {
-		if errors.Is(err, net.ErrClosed) && ctx.Err() != nil {
-			return nil, ctx.Err()
-		}
-
-		return ev.SignedEvidenceList{}, fmt.Errorf("failed to accept connection: %w", err)
+		return ev.SignedEvidenceList{}, err
 	}
 	defer conn.Close()
 
@@ -95,10 +140,12 @@ func Receive(ctx context.Context, cfg ReceiveConfig) (ev.SignedEvidenceList, err
 		return ev.SignedEvidenceList{}, fmt.Errorf("failed to read message length: %w", err)
 	}
 
-	payloadLen := binary.BigEndian.Uint32(lenBuf)
+	prefix := binary.BigEndian.Uint32(lenBuf)
+	flags := prefix & compressedFlag
+	payloadLen := prefix &^ compressedFlag
 
-	if payloadLen > maxPayloadLen {
-		return ev.SignedEvidenceList{}, fmt.Errorf("payload length %d over maximum %d", payloadLen, maxPayloadLen)
+	if err := cfg.Limits.checkPayload(int(payloadLen)); err != nil {
+		return ev.SignedEvidenceList{}, err
 	}
 
 	data := make([]byte, payloadLen)
@@ -106,12 +153,45 @@ func Receive(ctx context.Context, cfg ReceiveConfig) (ev.SignedEvidenceList, err
 		return ev.SignedEvidenceList{}, fmt.Errorf("failed to read message: %w", err)
 	}
 
-	// Unmarshal protobuf message
-	var evidence ev.SignedEvidenceList
-	err = evidence.UnmarshalBinary(data)
+	if secret != nil {
+		mac := make([]byte, macSize)
+		if _, err := io.ReadFull(conn, mac); err != nil {
+			return ev.SignedEvidenceList{}, fmt.Errorf("failed to read message mac: %w", err)
+		}
+		if !hmac.Equal(mac, payloadMAC(secret, lenBuf, data)) {
+			return ev.SignedEvidenceList{}, fmt.Errorf("%w: invalid message mac", ErrUnauthenticated)
+		}
+	}
+
+	// Unmarshal protobuf message and decompress compressed pieces
+	evidence, err := decodePayload(data, flags, cfg.Limits)
 	if err != nil {
-		return ev.SignedEvidenceList{}, fmt.Errorf("failed to unmarshal signed evidence list: %w", err)
+		return ev.SignedEvidenceList{}, err
 	}
 
 	return evidence, nil
 }
+
+// accept accepts the first connection of a peer with the expected credentials. Connections of
+// other peers are closed, so they can't keep compute_boot from delivering its evidence.
+func accept(ctx context.Context, listener net.Listener, cfg ReceiveConfig) (net.Conn, error) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) && ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			return nil, fmt.Errorf("failed to accept connection: %w", err)
+		}
+
+		err = cfg.checkPeer(conn)
+		if err == nil {
+			return conn, nil
+		}
+		slog.WarnContext(ctx, "Rejected evidence connection", "error", err)
+		if err := conn.Close(); err != nil {
+			slog.ErrorContext(ctx, "failed to close rejected connection", "error", err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package evidence
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-tpm/tpm2"
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// refundKeyLabel prefixes the data of the refund key piece, see labelPrefix.
+var refundKeyLabel = []byte("confsec-refund-key-v1:")
+
+// RefundKey discloses the key compute_worker signs the refund in the footer with. compute_boot
+// creates it in the TPM with the PCR policy of the REK, so only a process of the attested node can
+// sign with it, and not even that once the PCRs moved on.
+type RefundKey struct {
+	// Public is the marshalled TPMT_PUBLIC of the refund key.
+	Public []byte `json:"public"`
+}
+
+// RefundKeyTemplate returns the public area compute_boot creates the refund key with, an ECDSA P-256
+// signing key that is only usable with policy.
+func RefundKeyTemplate(policy []byte) tpm2.TPMTPublic {
+	return tpm2.TPMTPublic{
+		Type:    tpm2.TPMAlgECC,
+		NameAlg: tpm2.TPMAlgSHA256,
+		ObjectAttributes: tpm2.TPMAObject{
+			SignEncrypt:         true,
+			FixedTPM:            true,
+			FixedParent:         true,
+			SensitiveDataOrigin: true,
+			AdminWithPolicy:     true,
+			NoDA:                true,
+		},
+		AuthPolicy: tpm2.TPM2BDigest{Buffer: policy},
+		Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &tpm2.TPMSECCParms{
+			Scheme: tpm2.TPMTECCScheme{
+				Scheme:  tpm2.TPMAlgECDSA,
+				Details: tpm2.NewTPMUAsymScheme(tpm2.TPMAlgECDSA, &tpm2.TPMSSigSchemeECDSA{HashAlg: tpm2.TPMAlgSHA256}),
+			},
+			CurveID: tpm2.TPMECCNistP256,
+		}),
+	}
+}
+
+// Validate checks the public area is a refund key template, a key that can be used without the
+// policy or that can decrypt is not a refund key.
+func (k RefundKey) Validate() error {
+	pub, err := tpm2.Unmarshal[tpm2.TPMTPublic](k.Public)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal refund key: %w", err)
+	}
+	want := RefundKeyTemplate(pub.AuthPolicy.Buffer)
+	if pub.Type != want.Type || pub.NameAlg != want.NameAlg || pub.ObjectAttributes != want.ObjectAttributes {
+		return errors.New("refund key is not a policy bound signing key")
+	}
+	if len(pub.AuthPolicy.Buffer) == 0 {
+		return errors.New("refund key has no policy")
+	}
+	return nil
+}
+
+// RefundKeyPiece returns the evidence piece disclosing the refund key.
+func RefundKeyPiece(k RefundKey) (*ev.SignedEvidencePiece, error) {
+	return labelledPiece(refundKeyLabel, "refund key", k)
+}
+
+// FindRefundKey returns the refund key from the evidence list, false when the node doesn't sign refunds.
+func FindRefundKey(list ev.SignedEvidenceList) (RefundKey, bool, error) {
+	return findLabelled[RefundKey](list, refundKeyLabel, "refund key")
+}
+
+// verifyRefundKeyPolicy checks the refund key of the evidence, if any, is bound to the PCR values
+// of the quote, like the REK.
+func verifyRefundKeyPolicy(list ev.SignedEvidenceList, pcrValues map[uint32][]byte) error {
+	k, ok, err := FindRefundKey(list)
+	if err != nil || !ok {
+		return err
+	}
+	pub, err := tpm2.Unmarshal[tpm2.TPMTPublic](k.Public)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal refund key: %w", err)
+	}
+	want, err := PCRPolicyDigest(pcrValues)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(pub.AuthPolicy.Buffer, want) {
+		return errors.New("refund key policy is not bound to the pcr values of the quote")
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package evidence
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefundKey(t *testing.T) {
+	pcrValues := map[uint32][]byte{}
+	for _, pcr := range ev.AttestPCRSelection {
+		pcrValues[uint32(pcr)] = bytes.Repeat([]byte{byte(pcr)}, 32)
+	}
+	policy, err := PCRPolicyDigest(pcrValues)
+	require.NoError(t, err)
+
+	withAttributes := func(f func(*tpm2.TPMAObject)) []byte {
+		pub := RefundKeyTemplate(policy)
+		f(&pub.ObjectAttributes)
+		return tpm2.Marshal(pub)
+	}
+
+	t.Run("ok, bound to the pcr values of the quote", func(t *testing.T) {
+		piece, err := RefundKeyPiece(RefundKey{Public: tpm2.Marshal(RefundKeyTemplate(policy))})
+		require.NoError(t, err)
+
+		list := ev.SignedEvidenceList{piece}
+		_, ok, err := FindRefundKey(list)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.NoError(t, verifyLabelledPieces(list))
+		require.NoError(t, verifyRefundKeyPolicy(list, pcrValues))
+	})
+
+	t.Run("ok, no refund key", func(t *testing.T) {
+		require.NoError(t, verifyRefundKeyPolicy(ev.SignedEvidenceList{}, pcrValues))
+	})
+
+	t.Run("fail, bound to other pcr values", func(t *testing.T) {
+		otherPolicy := bytes.Repeat([]byte{1}, 32)
+		piece, err := RefundKeyPiece(RefundKey{Public: tpm2.Marshal(RefundKeyTemplate(otherPolicy))})
+		require.NoError(t, err)
+		require.Error(t, verifyRefundKeyPolicy(ev.SignedEvidenceList{piece}, pcrValues))
+	})
+
+	failures := map[string][]byte{
+		"usable with a password": withAttributes(func(a *tpm2.TPMAObject) { a.UserWithAuth = true }),
+		"decryption key":         withAttributes(func(a *tpm2.TPMAObject) { a.Decrypt = true }),
+		"not fixed to the tpm":   withAttributes(func(a *tpm2.TPMAObject) { a.FixedTPM = false }),
+		"no policy":              tpm2.Marshal(RefundKeyTemplate(nil)),
+		"not a public area":      []byte("not a public area"),
+	}
+	for name, public := range failures {
+		t.Run("fail, "+name, func(t *testing.T) {
+			_, err := RefundKeyPiece(RefundKey{Public: public})
+			require.Error(t, err)
+		})
+	}
+}
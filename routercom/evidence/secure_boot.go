@@ -0,0 +1,94 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// secureBootLabel prefixes the data of the secure boot piece, see labelPrefix.
+var secureBootLabel = []byte("confsec-secure-boot-v1:")
+
+// SecureBoot is the UEFI Secure Boot state of the node, as read from efivarfs by compute_boot.
+type SecureBoot struct {
+	// Enabled is true when the firmware enforces Secure Boot.
+	Enabled bool `json:"enabled"`
+	// SetupMode is true when no platform key is enrolled, any key can then be enrolled without authorization.
+	SetupMode bool `json:"setup_mode"`
+	// PK are the enrolled platform keys.
+	PK []SecureBootKey `json:"pk"`
+	// KEK are the enrolled key exchange keys.
+	KEK []SecureBootKey `json:"kek"`
+	// DBXEntries is the number of revoked signatures and hashes in dbx, it grows with every dbx
+	// update, so it serves as the dbx revision.
+	DBXEntries int `json:"dbx_entries"`
+	// Variables are the digests the firmware measured the Secure Boot variables with into PCR 7.
+	Variables []SecureBootVariable `json:"variables"`
+}
+
+// SecureBootKey is an entry of a UEFI signature list.
+type SecureBootKey struct {
+	// Type is the signature type, "x509" for certificates, otherwise the signature type GUID.
+	Type string `json:"type"`
+	// Owner is the signature owner GUID.
+	Owner string `json:"owner"`
+	// Subject is the subject of x509 certificates, empty for other types.
+	Subject string `json:"subject,omitempty"`
+	// Digest is the hex encoded SHA-256 digest of the signature data.
+	Digest string `json:"digest"`
+}
+
+// SecureBootVariable correlates a Secure Boot variable with the event log.
+type SecureBootVariable struct {
+	// Name is the name of the variable, e.g. "SecureBoot" or "dbx".
+	Name string `json:"name"`
+	// EventDigest is the hex encoded SHA-256 digest of the UEFI_VARIABLE_DATA of the variable, the
+	// digest of its EV_EFI_VARIABLE_DRIVER_CONFIG event in PCR 7. Verifiers replay the event log to
+	// check the variables weren't changed after they were measured.
+	EventDigest string `json:"event_digest"`
+}
+
+// Enforcing reports whether Secure Boot is enabled with an enrolled platform key.
+func (s SecureBoot) Enforcing() bool {
+	return s.Enabled && !s.SetupMode && len(s.PK) > 0
+}
+
+// Validate checks the event digests are hex encoded SHA-256 digests.
+func (s SecureBoot) Validate() error {
+	for _, v := range s.Variables {
+		b, err := hex.DecodeString(v.EventDigest)
+		if err != nil || len(b) != 32 {
+			return fmt.Errorf("invalid event digest of secure boot variable %s: %q", v.Name, v.EventDigest)
+		}
+	}
+	return nil
+}
+
+// SecureBootPiece returns the evidence piece describing the Secure Boot state.
+func SecureBootPiece(s SecureBoot) (*ev.SignedEvidencePiece, error) {
+	return labelledPiece(secureBootLabel, "secure boot state", s)
+}
+
+// FindSecureBoot returns the Secure Boot state from the evidence list, false when the list contains
+// no secure boot piece.
+func FindSecureBoot(list ev.SignedEvidenceList) (SecureBoot, bool, error) {
+	return findLabelled[SecureBoot](list, secureBootLabel, "secure boot state")
+}
@@ -0,0 +1,54 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecureBoot(t *testing.T) {
+	state := SecureBoot{
+		Enabled: true,
+		PK:      []SecureBootKey{{Type: "x509", Owner: "77fa9abd-0359-4d32-bd60-28f4e78f784b", Subject: "CN=Platform Key", Digest: strings.Repeat("ab", 32)}},
+		KEK:     []SecureBootKey{},
+		Variables: []SecureBootVariable{
+			{Name: "SecureBoot", EventDigest: "ccfc4bb32888a345bc8aeadaba552b627d99348c767681ab3141f5b01e40a40e"},
+		},
+		DBXEntries: 217,
+	}
+
+	t.Run("ok, enforcing", func(t *testing.T) {
+		require.True(t, state.Enforcing())
+	})
+
+	t.Run("ok, not enforcing", func(t *testing.T) {
+		require.False(t, SecureBoot{PK: state.PK}.Enforcing())
+		require.False(t, SecureBoot{Enabled: true, SetupMode: true, PK: state.PK}.Enforcing())
+		require.False(t, SecureBoot{Enabled: true}.Enforcing())
+	})
+
+	t.Run("fail, invalid event digest", func(t *testing.T) {
+		invalid := state
+		invalid.Variables = []SecureBootVariable{{Name: "dbx", EventDigest: "abc"}}
+		_, err := SecureBootPiece(invalid)
+		require.Error(t, err)
+	})
+}
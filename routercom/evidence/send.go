@@ -20,37 +20,107 @@ package evidence
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"math"
 	"net"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
+	"github.com/confidentsecurity/confidentcompute/listen"
 	ev "github.com/openpcc/openpcc/attestation/evidence"
 )
 
 type SenderConfig struct {
 	// Socket is the socket to send the attestation data over on
 	Socket string `yaml:"socket"`
+	// Address is where to send the evidence to instead of Socket, it must match the address of the
+	// receiver. Leave blank to use Socket.
+	Address *listen.Config `yaml:"address"`
 	// MaxRetries are how many times to try and send the data over to router_com
 	MaxRetries int `yaml:"max_retries"`
-	// RetryInterval is how long to wait between retries
+	// RetryInterval is how long to wait before the first retry, the interval doubles with every retry.
 	RetryInterval time.Duration `yaml:"retry_interval"`
+	// MaxRetryInterval caps the interval between retries. Leave blank to retry at a constant interval.
+	MaxRetryInterval time.Duration `yaml:"max_retry_interval"`
+	// Deadline bounds the time spent connecting to router_com across all retries.
+	Deadline time.Duration `yaml:"deadline"`
+	// Limits are the size budgets for the evidence, evidence over budget is not sent.
+	Limits Limits `yaml:"limits"`
+	// CompressThreshold is the size in bytes from which the data of a piece is compressed.
+	// Set to 0 to disable compression.
+	CompressThreshold int `yaml:"compress_threshold"`
+	// SecretFile holds the boot-time secret shared with router_com, the evidence is sent with an
+	// HMAC of the secret. Leave blank to send the evidence unauthenticated.
+	SecretFile string `yaml:"secret_file"`
 }
 
 func DefaultSenderConfig() SenderConfig {
 	return SenderConfig{
-		Socket:        DefaultSocket,
-		MaxRetries:    60,
-		RetryInterval: time.Second * 1,
+		Socket:            DefaultSocket,
+		MaxRetries:        60,
+		RetryInterval:     time.Millisecond * 100,
+		MaxRetryInterval:  time.Second * 5,
+		Deadline:          time.Minute * 2,
+		Limits:            DefaultLimits(),
+		CompressThreshold: DefaultCompressThreshold,
 	}
 }
 
+// retryJitter randomizes the retry intervals by up to this factor, so senders that start
+// together don't retry in lockstep.
+const retryJitter = 0.5
+
+// address returns where to send the evidence to.
+func (c SenderConfig) address() listen.Config {
+	if c.Address != nil {
+		return *c.Address
+	}
+	return listen.UnixSocket(c.Socket, 0)
+}
+
+func (c SenderConfig) validate() error {
+	if err := c.address().Validate(); err != nil {
+		return err
+	}
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("invalid max retries: %d", c.MaxRetries)
+	}
+	if c.RetryInterval <= 0 {
+		return fmt.Errorf("invalid retry interval: %s", c.RetryInterval)
+	}
+	if c.MaxRetryInterval != 0 && c.MaxRetryInterval < c.RetryInterval {
+		return fmt.Errorf("max retry interval %s is less than retry interval %s", c.MaxRetryInterval, c.RetryInterval)
+	}
+	if c.Deadline <= 0 {
+		return fmt.Errorf("invalid deadline: %s", c.Deadline)
+	}
+	return c.Limits.validate()
+}
+
 func Send(ctx context.Context, cfg SenderConfig, evidence ev.SignedEvidenceList) error {
-	data, err := evidence.MarshalBinary()
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	if cfg.CompressThreshold < 0 {
+		return fmt.Errorf("invalid compress threshold: %d", cfg.CompressThreshold)
+	}
+	if err := cfg.Limits.checkPieces(evidence); err != nil {
+		return err
+	}
+
+	data, flags, err := encodePayload(evidence, cfg.CompressThreshold)
 	if err != nil {
-		return fmt.Errorf("failed to marshal evidence to binary: %w", err)
+		return err
+	}
+	if err := cfg.Limits.checkPayload(len(data)); err != nil {
+		return err
+	}
+	secret, err := readSecret(cfg.SecretFile)
+	if err != nil {
+		return err
 	}
 
 	conn, err := connect(ctx, cfg)
@@ -69,7 +139,8 @@ func Send(ctx context.Context, cfg SenderConfig, evidence ev.SignedEvidenceList)
 
 	lenBuf := make([]byte, 4)
 
-	binary.BigEndian.PutUint32(lenBuf, uint32(dataLen))
+	// the total budget is below the compressed flag, so the flag doesn't collide with the length.
+	binary.BigEndian.PutUint32(lenBuf, uint32(dataLen)|flags)
 
 	if _, err := conn.Write(lenBuf); err != nil {
 		return fmt.Errorf("failed to send message length: %w", err)
@@ -77,28 +148,89 @@ func Send(ctx context.Context, cfg SenderConfig, evidence ev.SignedEvidenceList)
 	if _, err := conn.Write(data); err != nil {
 		return fmt.Errorf("failed to send evidence data: %w", err)
 	}
+	if secret != nil {
+		if _, err := conn.Write(payloadMAC(secret, lenBuf, data)); err != nil {
+			return fmt.Errorf("failed to send evidence mac: %w", err)
+		}
+	}
 
 	return nil
 }
 
+// connect dials the receiver with exponential backoff and jitter. When the socket doesn't exist yet,
+// the sender waits for the receiver to create it rather than sleeping out the retry interval.
 func connect(ctx context.Context, cfg SenderConfig) (net.Conn, error) {
-	var conn net.Conn
-	if cfg.MaxRetries < 0 {
-		return nil, fmt.Errorf("invalid max retries: %d", cfg.MaxRetries)
-	}
-	slog.InfoContext(ctx, "Connecting to receiver", "socket", cfg.Socket, "max_retries", cfg.MaxRetries, "retry_interval", cfg.RetryInterval)
-	backoffCfg := backoff.WithContext(backoff.WithMaxRetries(backoff.NewConstantBackOff(cfg.RetryInterval), uint64(cfg.MaxRetries)), ctx)
-	err := backoff.Retry(func() error {
-		c, dialErr := net.Dial("unix", cfg.Socket)
-		if dialErr != nil {
-			return dialErr
+	ctx, cancel := context.WithTimeout(ctx, cfg.Deadline)
+	defer cancel()
+
+	addr := cfg.address()
+	slog.InfoContext(ctx, "Connecting to receiver", "address", addr, "max_retries", cfg.MaxRetries,
+		"retry_interval", cfg.RetryInterval, "max_retry_interval", cfg.MaxRetryInterval, "deadline", cfg.Deadline)
+
+	// only unix sockets show up in the filesystem, other addresses are polled.
+	var watcher *socketWatcher
+	if addr.Network == listen.Unix {
+		w, err := newSocketWatcher(addr.Address)
+		if err != nil {
+			slog.DebugContext(ctx, "Polling for receiver socket", "error", err)
+		} else {
+			watcher = w
+			defer w.Close()
 		}
-		conn = c
-		return nil
-	}, backoffCfg)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to receiver after %d attempts: %w", cfg.MaxRetries, err)
 	}
 
-	return conn, nil
+	var err error
+	b := backoff.WithContext(newBackOff(cfg), ctx)
+	for attempt := 1; ; attempt++ {
+		conn, dialErr := addr.Dial(ctx)
+		if dialErr == nil {
+			return conn, nil
+		}
+
+		next := b.NextBackOff()
+		if next == backoff.Stop {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, fmt.Errorf("failed to connect to receiver: %w", errors.Join(ctxErr, dialErr))
+			}
+			return nil, fmt.Errorf("failed to connect to receiver after %d attempts: %w", attempt, dialErr)
+		}
+
+		if watcher != nil && errors.Is(dialErr, fs.ErrNotExist) {
+			err = watcher.wait(ctx, next)
+		} else {
+			err = sleep(ctx, next)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to receiver: %w", errors.Join(err, dialErr))
+		}
+	}
+}
+
+func newBackOff(cfg SenderConfig) backoff.BackOff {
+	maxInterval := cfg.MaxRetryInterval
+	if maxInterval == 0 {
+		maxInterval = cfg.RetryInterval
+	}
+
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = cfg.RetryInterval
+	b.MaxInterval = maxInterval
+	b.RandomizationFactor = retryJitter
+	// the deadline is enforced with the context.
+	b.MaxElapsedTime = 0
+	b.Reset()
+
+	return backoff.WithMaxRetries(b, uint64(cfg.MaxRetries)) // #nosec G115 -- validated to be non-negative.
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
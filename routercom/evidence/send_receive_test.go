@@ -20,13 +20,16 @@ package evidence_test
 import (
 	"context"
 	"encoding/binary"
+	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/confidentsecurity/confidentcompute/listen"
 	"github.com/confidentsecurity/confidentcompute/routercom/evidence"
 	ev "github.com/openpcc/openpcc/attestation/evidence"
 	"github.com/stretchr/testify/require"
@@ -151,11 +154,91 @@ func TestSend(t *testing.T) {
 		cfg.Socket = socket
 		cfg.MaxRetries = 10
 		cfg.RetryInterval = time.Millisecond * 10
+		cfg.MaxRetryInterval = time.Millisecond * 20
 
 		err := evidence.Send(t.Context(), cfg, ev.SignedEvidenceList{})
 		require.Error(t, err)
 	})
 
+	t.Run("fail, deadline exceeded", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := evidence.DefaultSenderConfig()
+		cfg.Socket = newSocketPath(t)
+		cfg.MaxRetries = 1000
+		cfg.RetryInterval = time.Millisecond * 10
+		cfg.Deadline = time.Millisecond * 100
+
+		err := evidence.Send(t.Context(), cfg, ev.SignedEvidenceList{})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("ok, connects once the socket is created without waiting out the retry interval", func(t *testing.T) {
+		t.Parallel()
+
+		socket := newSocketPath(t)
+		received := make(chan []byte, 1)
+		go func() {
+			time.Sleep(time.Millisecond * 50)
+			listener, err := net.Listen("unix", socket)
+			if err != nil {
+				received <- nil
+				return
+			}
+			defer listener.Close()
+			conn, err := listener.Accept()
+			if err != nil {
+				received <- nil
+				return
+			}
+			defer conn.Close()
+			b, _ := io.ReadAll(conn)
+			received <- b
+		}()
+
+		cfg := evidence.DefaultSenderConfig()
+		cfg.Socket = socket
+		cfg.MaxRetries = 1
+		cfg.RetryInterval = time.Second * 30
+		cfg.MaxRetryInterval = time.Second * 30
+		cfg.Deadline = time.Minute
+
+		start := time.Now()
+		err := evidence.Send(t.Context(), cfg, ev.SignedEvidenceList{})
+		require.NoError(t, err)
+		require.Less(t, time.Since(start), time.Second*10)
+		require.NotEmpty(t, <-received)
+	})
+
+	invalidConfigTests := map[string]func(*evidence.SenderConfig){
+		"fail, negative max retries": func(cfg *evidence.SenderConfig) {
+			cfg.MaxRetries = -1
+		},
+		"fail, zero retry interval": func(cfg *evidence.SenderConfig) {
+			cfg.RetryInterval = 0
+		},
+		"fail, max retry interval below retry interval": func(cfg *evidence.SenderConfig) {
+			cfg.RetryInterval = time.Second
+			cfg.MaxRetryInterval = time.Millisecond
+		},
+		"fail, zero deadline": func(cfg *evidence.SenderConfig) {
+			cfg.Deadline = 0
+		},
+	}
+
+	for name, modify := range invalidConfigTests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := evidence.DefaultSenderConfig()
+			cfg.Socket = newSocketPath(t)
+			modify(&cfg)
+
+			err := evidence.Send(t.Context(), cfg, ev.SignedEvidenceList{})
+			require.Error(t, err)
+		})
+	}
+
 	t.Run("fail, context cancelled", func(t *testing.T) {
 		t.Parallel()
 
@@ -172,6 +255,40 @@ func TestSend(t *testing.T) {
 		err := evidence.Send(ctx, cfg, ev.SignedEvidenceList{})
 		require.ErrorIs(t, err, context.Canceled)
 	})
+
+	t.Run("fail, piece over budget", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := evidence.DefaultSenderConfig()
+		cfg.Socket = newSocketPath(t)
+		cfg.Limits.MaxPieceSize = 16
+
+		err := evidence.Send(t.Context(), cfg, ev.SignedEvidenceList{
+			&ev.SignedEvidencePiece{
+				Type:      ev.SevSnpReport,
+				Data:      []byte("test-data"),
+				Signature: []byte("test-signature"),
+			},
+		})
+		require.ErrorIs(t, err, evidence.ErrPieceTooLarge)
+	})
+
+	t.Run("fail, evidence over total budget", func(t *testing.T) {
+		t.Parallel()
+
+		cfg := evidence.DefaultSenderConfig()
+		cfg.Socket = newSocketPath(t)
+		cfg.Limits.MaxTotalSize = 16
+
+		err := evidence.Send(t.Context(), cfg, ev.SignedEvidenceList{
+			&ev.SignedEvidencePiece{
+				Type:      ev.SevSnpReport,
+				Data:      []byte("test-data"),
+				Signature: []byte("test-signature"),
+			},
+		})
+		require.ErrorIs(t, err, evidence.ErrEvidenceTooLarge)
+	})
 }
 
 func TestReceive(t *testing.T) {
@@ -290,3 +407,170 @@ func newSocketPath(t *testing.T) string {
 
 	return filepath.Join(tmpDir, "test.sock")
 }
+
+func TestSendReceiveAuthenticated(t *testing.T) {
+	evidenceList := ev.SignedEvidenceList{
+		&ev.SignedEvidencePiece{
+			Type:      ev.SevSnpReport,
+			Data:      []byte("test-data"),
+			Signature: []byte("test-signature"),
+		},
+	}
+
+	sendReceive := func(t *testing.T, senderCfg evidence.SenderConfig, receiverCfg evidence.ReceiveConfig) (ev.SignedEvidenceList, error) {
+		socket := newSocketPath(t)
+		senderCfg.Socket = socket
+		senderCfg.RetryInterval = time.Millisecond * 10
+		receiverCfg.Socket = socket
+		receiverCfg.Timeout = time.Second
+
+		go func() {
+			_ = evidence.Send(t.Context(), senderCfg, evidenceList)
+		}()
+
+		return evidence.Receive(t.Context(), receiverCfg)
+	}
+
+	t.Run("ok, shared secret", func(t *testing.T) {
+		t.Parallel()
+
+		secretFile := writeSecret(t, "0123456789abcdef0123456789abcdef")
+
+		senderCfg := evidence.DefaultSenderConfig()
+		senderCfg.SecretFile = secretFile
+		receiverCfg := evidence.DefaultReceiverConfig()
+		receiverCfg.SecretFile = secretFile
+
+		got, err := sendReceive(t, senderCfg, receiverCfg)
+		require.NoError(t, err)
+		require.Equal(t, evidenceList, got)
+	})
+
+	t.Run("fail, different secret", func(t *testing.T) {
+		t.Parallel()
+
+		senderCfg := evidence.DefaultSenderConfig()
+		senderCfg.SecretFile = writeSecret(t, "0123456789abcdef0123456789abcdef")
+		receiverCfg := evidence.DefaultReceiverConfig()
+		receiverCfg.SecretFile = writeSecret(t, "fedcba9876543210fedcba9876543210")
+
+		_, err := sendReceive(t, senderCfg, receiverCfg)
+		require.ErrorIs(t, err, evidence.ErrUnauthenticated)
+	})
+
+	t.Run("fail, sender without secret", func(t *testing.T) {
+		t.Parallel()
+
+		receiverCfg := evidence.DefaultReceiverConfig()
+		receiverCfg.SecretFile = writeSecret(t, "0123456789abcdef0123456789abcdef")
+
+		_, err := sendReceive(t, evidence.DefaultSenderConfig(), receiverCfg)
+		require.Error(t, err)
+	})
+
+	t.Run("fail, short secret", func(t *testing.T) {
+		t.Parallel()
+
+		receiverCfg := evidence.DefaultReceiverConfig()
+		receiverCfg.Socket = newSocketPath(t)
+		receiverCfg.SecretFile = writeSecret(t, "short")
+
+		_, err := evidence.Receive(t.Context(), receiverCfg)
+		require.Error(t, err)
+	})
+
+	t.Run("ok, expected peer", func(t *testing.T) {
+		t.Parallel()
+		if runtime.GOOS != "linux" {
+			t.Skip("peer credentials are only supported on linux")
+		}
+
+		uid := uint32(os.Getuid()) // #nosec G115 -- uids are non-negative.
+		gid := uint32(os.Getgid()) // #nosec G115 -- gids are non-negative.
+		receiverCfg := evidence.DefaultReceiverConfig()
+		receiverCfg.PeerUID = &uid
+		receiverCfg.PeerGID = &gid
+
+		got, err := sendReceive(t, evidence.DefaultSenderConfig(), receiverCfg)
+		require.NoError(t, err)
+		require.Equal(t, evidenceList, got)
+	})
+
+	t.Run("fail, unexpected peer is rejected", func(t *testing.T) {
+		t.Parallel()
+
+		uid := uint32(os.Getuid()) + 1 // #nosec G115 -- uids are non-negative.
+		receiverCfg := evidence.DefaultReceiverConfig()
+		receiverCfg.PeerUID = &uid
+
+		// the connection is rejected and the receiver keeps waiting until it times out.
+		_, err := sendReceive(t, evidence.DefaultSenderConfig(), receiverCfg)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestSendReceiveTCP(t *testing.T) {
+	evidenceList := ev.SignedEvidenceList{
+		&ev.SignedEvidencePiece{
+			Type:      ev.SevSnpReport,
+			Data:      []byte("test-data"),
+			Signature: []byte("test-signature"),
+		},
+	}
+
+	newAddress := func(t *testing.T) *listen.Config {
+		// reserve a free port, the receiver listens on it again.
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := ln.Addr().String()
+		require.NoError(t, ln.Close())
+		return &listen.Config{Network: listen.TCP, Address: addr}
+	}
+
+	t.Run("ok, authenticated", func(t *testing.T) {
+		addr := newAddress(t)
+		secretFile := writeSecret(t, "0123456789abcdef0123456789abcdef")
+
+		senderCfg := evidence.DefaultSenderConfig()
+		senderCfg.Address = addr
+		senderCfg.RetryInterval = time.Millisecond * 10
+		senderCfg.SecretFile = secretFile
+		receiverCfg := evidence.DefaultReceiverConfig()
+		receiverCfg.Address = addr
+		receiverCfg.Timeout = time.Second
+		receiverCfg.SecretFile = secretFile
+
+		go func() {
+			_ = evidence.Send(t.Context(), senderCfg, evidenceList)
+		}()
+
+		got, err := evidence.Receive(t.Context(), receiverCfg)
+		require.NoError(t, err)
+		require.Equal(t, evidenceList, got)
+	})
+
+	t.Run("fail, unauthenticated", func(t *testing.T) {
+		receiverCfg := evidence.DefaultReceiverConfig()
+		receiverCfg.Address = newAddress(t)
+
+		_, err := evidence.Receive(t.Context(), receiverCfg)
+		require.Error(t, err)
+	})
+
+	t.Run("fail, peer credentials", func(t *testing.T) {
+		uid := uint32(0)
+		receiverCfg := evidence.DefaultReceiverConfig()
+		receiverCfg.Address = newAddress(t)
+		receiverCfg.SecretFile = writeSecret(t, "0123456789abcdef0123456789abcdef")
+		receiverCfg.PeerUID = &uid
+
+		_, err := evidence.Receive(t.Context(), receiverCfg)
+		require.Error(t, err)
+	})
+}
+
+func writeSecret(t *testing.T, secret string) string {
+	path := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(path, []byte(secret+"\n"), 0o600))
+	return path
+}
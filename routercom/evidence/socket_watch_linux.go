@@ -0,0 +1,106 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+
+package evidence
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// socketWatcher watches the socket directory with inotify, so the sender retries as soon as the
+// receiver creates its socket instead of polling for it.
+type socketWatcher struct {
+	name string
+	file *os.File
+}
+
+func newSocketWatcher(socket string) (*socketWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init inotify: %w", err)
+	}
+	// the fd is non-blocking, so the file supports read deadlines.
+	file := os.NewFile(uintptr(fd), "inotify")
+
+	_, err = syscall.InotifyAddWatch(fd, filepath.Dir(socket), syscall.IN_CREATE|syscall.IN_MOVED_TO)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to watch socket directory: %w", err), file.Close())
+	}
+
+	return &socketWatcher{
+		name: filepath.Base(socket),
+		file: file,
+	}, nil
+}
+
+// wait blocks until the socket is created or the timeout passes. It only returns an error
+// when the context is done.
+func (w *socketWatcher) wait(ctx context.Context, timeout time.Duration) error {
+	if err := w.file.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return sleep(ctx, timeout)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = w.file.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			// the timeout passed, or reading failed and the caller falls back to retrying.
+			return nil
+		}
+		if w.created(buf[:n]) {
+			return nil
+		}
+	}
+}
+
+// created reports whether the inotify events in b include the socket.
+func (w *socketWatcher) created(b []byte) bool {
+	for len(b) >= syscall.SizeofInotifyEvent {
+		nameLen := int(binary.NativeEndian.Uint32(b[12:16]))
+		end := syscall.SizeofInotifyEvent + nameLen
+		if end > len(b) {
+			return false
+		}
+		name := bytes.TrimRight(b[syscall.SizeofInotifyEvent:end], "\x00")
+		if string(name) == w.name {
+			return true
+		}
+		b = b[end:]
+	}
+	return false
+}
+
+func (w *socketWatcher) Close() error {
+	return w.file.Close()
+}
@@ -0,0 +1,82 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package evidence
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// timeSyncLabel prefixes the data of the time sync piece, see labelPrefix.
+var timeSyncLabel = []byte("confsec-time-sync-v1:")
+
+// TimeSync is the clock synchronization state of the node at attestation time, as reported by the
+// kernel to compute_boot. Certificate validity and evidence freshness checks rely on the clock of
+// the node, so verifiers can reject nodes whose clock is off.
+type TimeSync struct {
+	// Synchronized is true when a time daemon, e.g. chrony or ntpd, keeps the clock synchronized.
+	Synchronized bool `json:"synchronized"`
+	// OffsetNanos is the clock offset the daemon is still correcting, in nanoseconds.
+	OffsetNanos int64 `json:"offset_ns"`
+	// MaxErrorNanos is the maximum error of the clock, in nanoseconds. It grows while the clock
+	// isn't synchronized.
+	MaxErrorNanos int64 `json:"max_error_ns"`
+	// EstimatedErrorNanos is the estimated error of the clock, in nanoseconds.
+	EstimatedErrorNanos int64 `json:"estimated_error_ns"`
+	// Time is the time of the clock when the state was read.
+	Time time.Time `json:"time"`
+}
+
+// Offset returns the clock offset.
+func (s TimeSync) Offset() time.Duration {
+	return time.Duration(s.OffsetNanos)
+}
+
+// MaxError returns the maximum error of the clock.
+func (s TimeSync) MaxError() time.Duration {
+	return time.Duration(s.MaxErrorNanos)
+}
+
+// Within reports whether the clock is synchronized with an offset and maximum error of at most limit.
+func (s TimeSync) Within(limit time.Duration) bool {
+	return s.Synchronized && s.Offset().Abs() <= limit && s.MaxError() <= limit
+}
+
+// Validate checks the errors are not negative and the time is set.
+func (s TimeSync) Validate() error {
+	if s.MaxErrorNanos < 0 || s.EstimatedErrorNanos < 0 {
+		return fmt.Errorf("invalid clock error: max %d ns, estimated %d ns", s.MaxErrorNanos, s.EstimatedErrorNanos)
+	}
+	if s.Time.IsZero() {
+		return errors.New("time sync state has no time")
+	}
+	return nil
+}
+
+// TimeSyncPiece returns the evidence piece describing the clock synchronization state.
+func TimeSyncPiece(s TimeSync) (*ev.SignedEvidencePiece, error) {
+	return labelledPiece(timeSyncLabel, "time sync state", s)
+}
+
+// FindTimeSync returns the clock synchronization state from the evidence list, false when the list
+// contains no time sync piece.
+func FindTimeSync(list ev.SignedEvidenceList) (TimeSync, bool, error) {
+	return findLabelled[TimeSync](list, timeSyncLabel, "time sync state")
+}
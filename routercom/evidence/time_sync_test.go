@@ -0,0 +1,62 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package evidence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeSync(t *testing.T) {
+	state := TimeSync{
+		Synchronized:        true,
+		OffsetNanos:         -250_000,
+		MaxErrorNanos:       12_000_000,
+		EstimatedErrorNanos: 1_000_000,
+		Time:                time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	t.Run("ok, within", func(t *testing.T) {
+		require.True(t, state.Within(100*time.Millisecond))
+		require.False(t, state.Within(10*time.Millisecond))
+
+		offset := state
+		offset.OffsetNanos = -int64(200 * time.Millisecond)
+		require.False(t, offset.Within(100*time.Millisecond))
+
+		unsynchronized := state
+		unsynchronized.Synchronized = false
+		require.False(t, unsynchronized.Within(time.Hour))
+	})
+
+	t.Run("fail, negative error", func(t *testing.T) {
+		invalid := state
+		invalid.MaxErrorNanos = -1
+		_, err := TimeSyncPiece(invalid)
+		require.Error(t, err)
+	})
+
+	t.Run("fail, no time", func(t *testing.T) {
+		invalid := state
+		invalid.Time = time.Time{}
+		_, err := TimeSyncPiece(invalid)
+		require.Error(t, err)
+	})
+
+}
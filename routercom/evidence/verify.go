@@ -0,0 +1,344 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package evidence
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+// VerifyOptions are the time and trust anchors Verify checks the evidence against.
+type VerifyOptions struct {
+	// Now is the time the certificates of the evidence must be valid at.
+	Now time.Time
+	// Roots are the pinned roots the intermediate certificates of the evidence must chain to.
+	// Evidence with intermediate certificates is rejected when there are no roots.
+	Roots *x509.CertPool
+}
+
+// Verify checks the evidence before router_com registers it with the router, so a local process
+// that got hold of the evidence socket can't make router_com advertise evidence that is malformed,
+// contradicts itself or wasn't produced by the TPM of the node. The PCR values of the TPM quote
+// and the labelled pieces are checked against a quote by the attestation key, the REK and the refund
+// key against the PCR values they are bound to and the intermediate certificates against the pinned
+// roots. It doesn't replace verification by clients, which also check the attestation key and the
+// TEE evidence against the hardware roots of trust.
+func Verify(list ev.SignedEvidenceList, opts VerifyOptions) error {
+	var reks, quotes, intermediates []*ev.SignedEvidencePiece
+	for i, piece := range list {
+		if piece == nil {
+			return fmt.Errorf("evidence piece %d is missing", i)
+		}
+		if len(piece.Data) == 0 {
+			return fmt.Errorf("evidence piece %d of type %v has no data", i, piece.Type)
+		}
+
+		switch piece.Type { //nolint:exhaustive
+		case ev.TpmtPublic:
+			reks = append(reks, piece)
+		case ev.TpmQuote:
+			quotes = append(quotes, piece)
+		case ev.NvidiaCCIntermediateCertificate, ev.NvidiaSwitchIntermediateCertificate:
+			intermediates = append(intermediates, piece)
+		default:
+		}
+	}
+
+	if err := verifyIntermediateCertificates(intermediates, opts); err != nil {
+		return err
+	}
+
+	// router_com passes the rek and the pcr values of the quote to every compute_worker, more than
+	// one of either would make the evidence ambiguous.
+	if len(reks) != 1 {
+		return fmt.Errorf("expected a single rek public area, got %d", len(reks))
+	}
+	if err := verifyREKPublic(reks[0]); err != nil {
+		return fmt.Errorf("invalid rek public area: %w", err)
+	}
+
+	if len(quotes) != 1 {
+		return fmt.Errorf("expected a single tpm quote, got %d", len(quotes))
+	}
+	pcrValues, err := QuotePCRValues(quotes[0])
+	if err != nil {
+		return fmt.Errorf("invalid tpm quote: %w", err)
+	}
+
+	// the rek is only usable with the pcr values of the quote, a rek from another boot isn't.
+	if err := verifyREKPolicy(reks[0], pcrValues); err != nil {
+		return fmt.Errorf("invalid rek public area: %w", err)
+	}
+
+	if err := verifyLabelledPieces(list); err != nil {
+		return err
+	}
+
+	// the refund key signs refunds on behalf of the node, it must be as bound to the boot as the rek.
+	if err := verifyRefundKeyPolicy(list, pcrValues); err != nil {
+		return fmt.Errorf("invalid refund key: %w", err)
+	}
+
+	// the labelled pieces and the pcr values are unsigned, the quote of the attestation key in the
+	// binding is what makes them evidence.
+	if err := VerifyEvidenceBinding(list, reks[0], quotes[0], pcrValues); err != nil {
+		return fmt.Errorf("invalid evidence binding: %w", err)
+	}
+
+	return nil
+}
+
+// LoadRoots reads the pinned root certificates from a PEM file.
+func LoadRoots(path string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read root certificates: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no root certificates in %s", path)
+	}
+	return roots, nil
+}
+
+// REKName returns the name of the REK, computed from its public area rather than taken from the
+// piece signature.
+func REKName(piece *ev.SignedEvidencePiece) ([]byte, error) {
+	pub, err := tpm2.Unmarshal[tpm2.TPMTPublic](piece.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal public area: %w", err)
+	}
+	name, err := tpm2.ObjectName(pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute name: %w", err)
+	}
+	return name.Buffer, nil
+}
+
+// verifyREKPublic checks the REK public area parses and is usable for the ECDH the compute_worker
+// decapsulates requests with.
+func verifyREKPublic(piece *ev.SignedEvidencePiece) error {
+	pub, err := tpm2.Unmarshal[tpm2.TPMTPublic](piece.Data)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal public area: %w", err)
+	}
+
+	if pub.Type != tpm2.TPMAlgECC {
+		return fmt.Errorf("expected an ecc key, got algorithm %#x", pub.Type)
+	}
+	// ECDH_ZGen requires an unrestricted decryption key.
+	if !pub.ObjectAttributes.Decrypt || pub.ObjectAttributes.Restricted {
+		return errors.New("key is not an unrestricted decryption key")
+	}
+	return nil
+}
+
+// verifyREKPolicy checks the REK policy is the PCR policy compute_boot creates the REK with, over
+// the PCR values of the quote.
+func verifyREKPolicy(piece *ev.SignedEvidencePiece, pcrValues map[uint32][]byte) error {
+	pub, err := tpm2.Unmarshal[tpm2.TPMTPublic](piece.Data)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal public area: %w", err)
+	}
+	want, err := PCRPolicyDigest(pcrValues)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(pub.AuthPolicy.Buffer, want) {
+		return errors.New("key policy is not bound to the pcr values of the quote")
+	}
+	return nil
+}
+
+// PCRPolicyDigest returns the digest of a TPM2_PolicyPCR policy over the SHA-256 values of the
+// PCRs the REK is bound to.
+func PCRPolicyDigest(pcrValues map[uint32][]byte) ([]byte, error) {
+	selection, err := attestSelection()
+	if err != nil {
+		return nil, err
+	}
+	pcrDigest, err := pcrSelectionDigest(selection, pcrValues)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	h.Write(make([]byte, sha256.Size))
+	h.Write(binary.BigEndian.AppendUint32(nil, uint32(tpm2.TPMCCPolicyPCR)))
+	h.Write(tpm2.Marshal(PCRSelection(selection)))
+	h.Write(pcrDigest)
+	return h.Sum(nil), nil
+}
+
+// attestSelection returns the PCRs the REK is bound to, in ascending order.
+func attestSelection() ([]uint32, error) {
+	pcrs := make([]uint32, 0, len(ev.AttestPCRSelection))
+	for _, pcr := range ev.AttestPCRSelection {
+		if uint64(pcr) > 23 {
+			return nil, fmt.Errorf("unexpected attested pcr %d", pcr)
+		}
+		pcrs = append(pcrs, uint32(pcr))
+	}
+	slices.Sort(pcrs)
+	return pcrs, nil
+}
+
+// PCRSelection returns the selection of pcrs of the SHA-256 bank.
+func PCRSelection(pcrs []uint32) tpm2.TPMLPCRSelection {
+	indexes := make([]uint, 0, len(pcrs))
+	for _, pcr := range pcrs {
+		indexes = append(indexes, uint(pcr))
+	}
+	return tpm2.TPMLPCRSelection{
+		PCRSelections: []tpm2.TPMSPCRSelection{
+			{Hash: tpm2.TPMAlgSHA256, PCRSelect: tpm2.PCClientCompatible.PCRs(indexes...)},
+		},
+	}
+}
+
+// pcrSelectionDigest returns the digest of the values of the pcrs the way the TPM computes it for
+// policies and quotes, the values concatenated in ascending PCR order.
+func pcrSelectionDigest(pcrs []uint32, pcrValues map[uint32][]byte) ([]byte, error) {
+	h := sha256.New()
+	for _, pcr := range pcrs {
+		value, ok := pcrValues[pcr]
+		if !ok || len(value) != sha256.Size {
+			return nil, fmt.Errorf("missing sha256 value of pcr %d", pcr)
+		}
+		h.Write(value)
+	}
+	return h.Sum(nil), nil
+}
+
+// QuotePCRValues returns the PCR values of the TPM quote piece.
+func QuotePCRValues(piece *ev.SignedEvidencePiece) (map[uint32][]byte, error) {
+	quote := ev.TPMQuoteAttestation{}
+	if err := quote.UnmarshalBinary(piece.Data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal quote: %w", err)
+	}
+
+	b, err := quote.PCRValues.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal pcr values: %w", err)
+	}
+	pcrValues := &ev.PCRValues{}
+	if err := pcrValues.UnmarshalBinary(b); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pcr values: %w", err)
+	}
+	if len(pcrValues.Values) == 0 {
+		return nil, errors.New("quote has no pcr values")
+	}
+
+	return pcrValues.Values, nil
+}
+
+// verifyIntermediateCertificates checks the intermediate certificates are CAs that chain to the
+// pinned roots and are valid now.
+func verifyIntermediateCertificates(pieces []*ev.SignedEvidencePiece, opts VerifyOptions) error {
+	if len(pieces) == 0 {
+		return nil
+	}
+
+	certs := make([]*x509.Certificate, 0, len(pieces))
+	intermediates := x509.NewCertPool()
+	for _, piece := range pieces {
+		cert, err := x509.ParseCertificate(piece.Data)
+		if err != nil {
+			return fmt.Errorf("failed to parse intermediate certificate: %w", err)
+		}
+		if !cert.IsCA {
+			return errors.New("intermediate certificate is not a ca")
+		}
+		certs = append(certs, cert)
+		intermediates.AddCert(cert)
+	}
+
+	if opts.Roots == nil {
+		return errors.New("no pinned roots to verify the intermediate certificates against")
+	}
+	for _, cert := range certs {
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:         opts.Roots,
+			Intermediates: intermediates,
+			CurrentTime:   opts.Now,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return fmt.Errorf("intermediate certificate %s is not valid at %s: %w", cert.Subject, opts.Now.Format(time.RFC3339), err)
+		}
+	}
+	return nil
+}
+
+// labelledPieceChecks decode the labelled pieces by label. A labelled piece without a check is
+// rejected, router_com only advertises claims it understands.
+var labelledPieceChecks = map[string]func(ev.SignedEvidenceList) error{
+	string(cpuOnlyMarker):           func(ev.SignedEvidenceList) error { return nil },
+	string(evidenceBindingLabel):    check(FindEvidenceBinding),
+	string(azureGPULabel):           check(FindAzureGPUAttestation),
+	string(binaryDigestsLabel):      check(BinaryDigests),
+	string(engineConfigLabel):       check(FindEngineConfig),
+	string(experimentalRoutesLabel): check(FindExperimentalRoutes),
+	string(gpuDegradedLabel):        check(FindGPUDegraded),
+	string(gpuTopologyLabel):        check(FindGPUTopology),
+	string(gpuVersionsLabel):        check(FindGPUVersions),
+	string(hostEnvironmentLabel):    check(FindHostEnvironment),
+	string(maintenanceLabel):        check(FindMaintenance),
+	string(mirrorLabel):             check(FindMirror),
+	string(nvlinkDomainLabel):       check(FindNVLinkDomain),
+	string(outputFilterLabel):       check(FindOutputFilter),
+	string(quoteChainLabel):         check(FindQuoteChain),
+	string(refundKeyLabel):          check(FindRefundKey),
+	string(secureBootLabel):         check(FindSecureBoot),
+	string(timeSyncLabel):           check(FindTimeSync),
+}
+
+// check adapts a find function to labelledPieceChecks.
+func check[T any](find func(ev.SignedEvidenceList) (T, bool, error)) func(ev.SignedEvidenceList) error {
+	return func(list ev.SignedEvidenceList) error {
+		_, _, err := find(list)
+		return err
+	}
+}
+
+// verifyLabelledPieces checks every piece compute_boot adds with the unspecified type has a known
+// label and decodes.
+func verifyLabelledPieces(list ev.SignedEvidenceList) error {
+	for i, piece := range list {
+		if !IsLabelledPiece(piece) {
+			continue
+		}
+		check, ok := labelledPieceChecks[pieceLabel(piece)]
+		if !ok {
+			return fmt.Errorf("labelled piece %d has unknown label %.64q", i, pieceLabel(piece))
+		}
+		if err := check(ev.SignedEvidenceList{piece}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package evidence
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	rekPublic := func(modify func(pub *tpm2.TPMTPublic)) *ev.SignedEvidencePiece {
+		pub := tpm2.TPMTPublic{
+			Type:    tpm2.TPMAlgECC,
+			NameAlg: tpm2.TPMAlgSHA256,
+			ObjectAttributes: tpm2.TPMAObject{
+				FixedTPM:            true,
+				FixedParent:         true,
+				SensitiveDataOrigin: true,
+				UserWithAuth:        true,
+				Decrypt:             true,
+			},
+			Parameters: tpm2.NewTPMUPublicParms(tpm2.TPMAlgECC, &tpm2.TPMSECCParms{
+				CurveID: tpm2.TPMECCNistP256,
+			}),
+			Unique: tpm2.NewTPMUPublicID(tpm2.TPMAlgECC, &tpm2.TPMSECCPoint{
+				X: tpm2.TPM2BECCParameter{Buffer: make([]byte, 32)},
+				Y: tpm2.TPM2BECCParameter{Buffer: make([]byte, 32)},
+			}),
+		}
+		name, err := tpm2.ObjectName(&pub)
+		require.NoError(t, err)
+		if modify != nil {
+			modify(&pub)
+		}
+		return &ev.SignedEvidencePiece{
+			Type:      ev.TpmtPublic,
+			Data:      tpm2.Marshal(pub),
+			Signature: name.Buffer,
+		}
+	}
+
+	// newCA returns a ca certificate signed by parent, self-signed when parent is nil.
+	newCA := func(name string, isCA bool, notAfter time.Time, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: name},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              notAfter,
+			IsCA:                  isCA,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+		if parent == nil {
+			parent, parentKey = tmpl, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+		require.NoError(t, err)
+		cert, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		return cert, key
+	}
+
+	root, rootKey := newCA("root", true, now.Add(24*time.Hour), nil, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	certificate := func(isCA bool, notAfter time.Time) *ev.SignedEvidencePiece {
+		cert, _ := newCA("intermediate", isCA, notAfter, root, rootKey)
+		return &ev.SignedEvidencePiece{Type: ev.NvidiaCCIntermediateCertificate, Data: cert.Raw}
+	}
+	unpinned, _ := newCA("unpinned", true, now.Add(time.Hour), nil, nil)
+
+	invalidQuote := &ev.SignedEvidencePiece{Type: ev.TpmQuote, Data: []byte("not a quote")}
+
+	tests := map[string]struct {
+		evidence ev.SignedEvidenceList
+		wantErr  string
+	}{
+		"fail, missing piece": {
+			evidence: ev.SignedEvidenceList{rekPublic(nil), nil},
+			wantErr:  "evidence piece 1 is missing",
+		},
+		"fail, piece without data": {
+			evidence: ev.SignedEvidenceList{{Type: ev.SevSnpReport}},
+			wantErr:  "has no data",
+		},
+		"fail, missing rek": {
+			evidence: ev.SignedEvidenceList{invalidQuote},
+			wantErr:  "expected a single rek public area, got 0",
+		},
+		"fail, multiple reks": {
+			evidence: ev.SignedEvidenceList{rekPublic(nil), rekPublic(nil), invalidQuote},
+			wantErr:  "expected a single rek public area, got 2",
+		},
+		"fail, rek is restricted": {
+			evidence: ev.SignedEvidenceList{
+				rekPublic(func(pub *tpm2.TPMTPublic) { pub.ObjectAttributes.Restricted = true }),
+				invalidQuote,
+			},
+			wantErr: "not an unrestricted decryption key",
+		},
+		"fail, rek is not a public area": {
+			evidence: ev.SignedEvidenceList{
+				{Type: ev.TpmtPublic, Data: []byte{0x00}},
+				invalidQuote,
+			},
+			wantErr: "failed to unmarshal public area",
+		},
+		"fail, missing quote": {
+			evidence: ev.SignedEvidenceList{rekPublic(nil)},
+			wantErr:  "expected a single tpm quote, got 0",
+		},
+		"fail, invalid quote": {
+			evidence: ev.SignedEvidenceList{rekPublic(nil), invalidQuote},
+			wantErr:  "invalid tpm quote",
+		},
+		"fail, intermediate certificate does not parse": {
+			evidence: ev.SignedEvidenceList{
+				{Type: ev.NvidiaSwitchIntermediateCertificate, Data: []byte("not a certificate")},
+			},
+			wantErr: "failed to parse intermediate certificate",
+		},
+		"fail, intermediate certificate is not a ca": {
+			evidence: ev.SignedEvidenceList{certificate(false, now.Add(time.Hour))},
+			wantErr:  "intermediate certificate is not a ca",
+		},
+		"fail, intermediate certificate expired": {
+			evidence: ev.SignedEvidenceList{certificate(true, now.Add(-time.Minute))},
+			wantErr:  "is not valid",
+		},
+		"fail, intermediate certificate does not chain to the pinned roots": {
+			evidence: ev.SignedEvidenceList{{Type: ev.NvidiaSwitchIntermediateCertificate, Data: unpinned.Raw}},
+			wantErr:  "is not valid",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := Verify(tc.evidence, VerifyOptions{Now: now, Roots: roots})
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+
+	t.Run("ok, valid rek and intermediate certificate", func(t *testing.T) {
+		require.NoError(t, verifyREKPublic(rekPublic(nil)))
+		opts := VerifyOptions{Now: now, Roots: roots}
+		require.NoError(t, verifyIntermediateCertificates([]*ev.SignedEvidencePiece{certificate(true, now.Add(time.Hour))}, opts))
+	})
+
+	t.Run("fail, no pinned roots", func(t *testing.T) {
+		err := Verify(ev.SignedEvidenceList{certificate(true, now.Add(time.Hour))}, VerifyOptions{Now: now})
+		require.ErrorContains(t, err, "no pinned roots")
+	})
+
+	t.Run("ok, rek name is computed", func(t *testing.T) {
+		piece := rekPublic(nil)
+		name, err := REKName(&ev.SignedEvidencePiece{Type: piece.Type, Data: piece.Data, Signature: []byte("other")})
+		require.NoError(t, err)
+		require.Equal(t, piece.Signature, name)
+	})
+
+	t.Run("ok, rek policy is bound to the quote", func(t *testing.T) {
+		pcrValues := testPCRValues()
+		policy, err := PCRPolicyDigest(pcrValues)
+		require.NoError(t, err)
+		rek := rekPublic(func(pub *tpm2.TPMTPublic) { pub.AuthPolicy = tpm2.TPM2BDigest{Buffer: policy} })
+		require.NoError(t, verifyREKPolicy(rek, pcrValues))
+
+		// a rek created in another boot has a policy over other pcr values.
+		for pcr := range pcrValues {
+			pcrValues[pcr] = bytes.Repeat([]byte{0xff}, sha256.Size)
+			break
+		}
+		require.ErrorContains(t, verifyREKPolicy(rek, pcrValues), "not bound to the pcr values")
+		require.Error(t, verifyREKPolicy(rekPublic(nil), testPCRValues()))
+	})
+
+	t.Run("fail, quote misses a pcr of the rek", func(t *testing.T) {
+		_, err := PCRPolicyDigest(map[uint32][]byte{})
+		require.ErrorContains(t, err, "missing sha256 value")
+	})
+
+	t.Run("fail, unknown labelled piece", func(t *testing.T) {
+		list := ev.SignedEvidenceList{newLabelledPiece([]byte("confsec-unknown-v1:{}"))}
+		require.ErrorContains(t, verifyLabelledPieces(list), "unknown label")
+	})
+
+	t.Run("fail, labelled piece does not decode", func(t *testing.T) {
+		list := ev.SignedEvidenceList{
+			{Type: ev.EvidenceTypeUnspecified, Data: []byte(string(hostEnvironmentLabel) + "{")},
+		}
+		require.ErrorContains(t, verifyLabelledPieces(list), "failed to unmarshal host environment")
+	})
+}
+
+// testPCRValues returns distinct values of the PCRs the REK is bound to.
+func testPCRValues() map[uint32][]byte {
+	values := map[uint32][]byte{}
+	for _, pcr := range ev.AttestPCRSelection {
+		values[uint32(pcr)] = bytes.Repeat([]byte{byte(pcr)}, sha256.Size)
+	}
+	return values
+}
@@ -0,0 +1,156 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package routercom
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+)
+
+const (
+	// defaultExpiryDrainBefore gives the router time to stop sending the node requests.
+	defaultExpiryDrainBefore = 5 * time.Minute
+	// defaultExpiryShutdownBefore gives the node time to notify the router that it is shutting down,
+	// and finish serving any in-flight requests.
+	defaultExpiryShutdownBefore = time.Minute
+)
+
+// EvidenceExpiryConfig is config for draining and shutting down the node before its evidence
+// expires, the node has to be recreated to attest again.
+type EvidenceExpiryConfig struct {
+	// DrainBefore is how long before the evidence expires the node starts draining.
+	DrainBefore time.Duration `yaml:"drain_before"`
+	// ShutdownBefore is how long before the evidence expires router_com shuts down.
+	ShutdownBefore time.Duration `yaml:"shutdown_before"`
+	// Ignore are the deadline kinds that don't drain and shut down the node, e.g. "jwt" while the
+	// lifetime of the GPU attestation tokens is unknown. Their deadlines are still reported.
+	Ignore []evidence.DeadlineKind `yaml:"ignore"`
+}
+
+func DefaultEvidenceExpiryConfig() *EvidenceExpiryConfig {
+	return &EvidenceExpiryConfig{
+		DrainBefore:    defaultExpiryDrainBefore,
+		ShutdownBefore: defaultExpiryShutdownBefore,
+	}
+}
+
+func (c *EvidenceExpiryConfig) validate() error {
+	if c.ShutdownBefore < 0 {
+		return errors.New("shutdown_before can't be negative")
+	}
+	if c.DrainBefore < c.ShutdownBefore {
+		return errors.New("drain_before can't be shorter than shutdown_before")
+	}
+	for _, kind := range c.Ignore {
+		switch kind {
+		case evidence.DeadlineCertificate, evidence.DeadlineJWT, evidence.DeadlineTCBNextUpdate:
+		default:
+			return fmt.Errorf("unknown deadline kind %q", kind)
+		}
+	}
+	return nil
+}
+
+// EvidenceExpiry reports when the evidence of the node expires.
+type EvidenceExpiry struct {
+	// Deadlines are the deadlines of the time-bound evidence, earliest first.
+	Deadlines []evidence.Deadline `json:"deadlines"`
+	// Effective is the earliest deadline that drains and shuts down the node, nil if there is none.
+	Effective *evidence.Deadline `json:"effective,omitempty"`
+	// DrainAt and ShutdownAt are when the node drains and shuts down, zero without an effective deadline.
+	DrainAt    time.Time `json:"drain_at,omitzero"`
+	ShutdownAt time.Time `json:"shutdown_at,omitzero"`
+}
+
+// expiryManager drains and shuts down the node before the earliest effective deadline of its
+// evidence, with timers instead of a sleeping goroutine per piece.
+type expiryManager struct {
+	expiry EvidenceExpiry
+
+	mu     sync.Mutex
+	timers []*time.Timer
+}
+
+func newExpiryManager(cfg *EvidenceExpiryConfig, list ev.SignedEvidenceList) (*expiryManager, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	m := &expiryManager{
+		expiry: EvidenceExpiry{Deadlines: evidence.Deadlines(list)},
+	}
+	for _, deadline := range m.expiry.Deadlines {
+		if slices.Contains(cfg.Ignore, deadline.Kind) {
+			continue
+		}
+		m.expiry.Effective = &deadline
+		m.expiry.DrainAt = deadline.NotAfter.Add(-cfg.DrainBefore)
+		m.expiry.ShutdownAt = deadline.NotAfter.Add(-cfg.ShutdownBefore)
+		break
+	}
+	return m, nil
+}
+
+// start schedules drain and shutdown for the effective deadline. Both run right away when their
+// time has passed.
+func (m *expiryManager) start(drain func(), shutdown func(evidence.Deadline)) {
+	for _, deadline := range m.expiry.Deadlines {
+		slog.Info("Evidence expires", "deadline", deadline.String(), "not_after", deadline.NotAfter)
+	}
+	effective := m.expiry.Effective
+	if effective == nil {
+		return
+	}
+	slog.Info("Scheduling drain and shutdown before the evidence expires",
+		"deadline", effective.String(),
+		"drain_at", m.expiry.DrainAt,
+		"shutdown_at", m.expiry.ShutdownAt)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.timers = append(m.timers,
+		time.AfterFunc(time.Until(m.expiry.DrainAt), func() {
+			slog.Warn("Draining, the evidence is about to expire", "deadline", effective.String(), "not_after", effective.NotAfter)
+			drain()
+		}),
+		time.AfterFunc(time.Until(m.expiry.ShutdownAt), func() {
+			slog.Warn("Shutting down, the evidence is about to expire", "deadline", effective.String(), "not_after", effective.NotAfter)
+			shutdown(*effective)
+		}),
+	)
+}
+
+// stop cancels the scheduled drain and shutdown.
+func (m *expiryManager) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, timer := range m.timers {
+		timer.Stop()
+	}
+	m.timers = nil
+}
+
+func (m *expiryManager) status() EvidenceExpiry {
+	return m.expiry
+}
@@ -0,0 +1,116 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package routercom
+
+import (
+	"encoding/base64"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiryManager(t *testing.T) {
+	// tokenPiece returns a piece with a GPU attestation token that expires at exp.
+	tokenPiece := func(exp time.Time) *ev.SignedEvidencePiece {
+		enc := base64.RawURLEncoding
+		claims := `{"exp":` + strconv.FormatInt(exp.Unix(), 10) + `}`
+		token := enc.EncodeToString([]byte(`{"alg":"ES384"}`)) + "." + enc.EncodeToString([]byte(claims)) + ".c2ln"
+		return &ev.SignedEvidencePiece{Type: ev.NvidiaETA, Data: []byte(token)}
+	}
+	collateralPiece := func(next time.Time) *ev.SignedEvidencePiece {
+		return &ev.SignedEvidencePiece{
+			Type: ev.EvidenceTypeUnspecified,
+			Data: []byte(`{"tcbInfo":{"nextUpdate":"` + next.Format(time.RFC3339) + `"}}`),
+		}
+	}
+
+	tokenExp := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+	nextUpdate := tokenExp.Add(time.Hour)
+	list := ev.SignedEvidenceList{collateralPiece(nextUpdate), tokenPiece(tokenExp)}
+
+	t.Run("ok, earliest deadline is effective", func(t *testing.T) {
+		m, err := newExpiryManager(DefaultEvidenceExpiryConfig(), list)
+		require.NoError(t, err)
+
+		status := m.status()
+		require.Len(t, status.Deadlines, 2)
+		require.Equal(t, evidence.DeadlineJWT, status.Effective.Kind)
+		require.Equal(t, tokenExp.Add(-5*time.Minute), status.DrainAt)
+		require.Equal(t, tokenExp.Add(-time.Minute), status.ShutdownAt)
+	})
+
+	t.Run("ok, ignored deadlines are only reported", func(t *testing.T) {
+		cfg := DefaultEvidenceExpiryConfig()
+		cfg.Ignore = []evidence.DeadlineKind{evidence.DeadlineJWT}
+		m, err := newExpiryManager(cfg, list)
+		require.NoError(t, err)
+
+		status := m.status()
+		require.Len(t, status.Deadlines, 2)
+		require.Equal(t, evidence.DeadlineTCBNextUpdate, status.Effective.Kind)
+		require.Equal(t, nextUpdate.Add(-time.Minute), status.ShutdownAt)
+	})
+
+	t.Run("ok, drains and shuts down before the evidence expires", func(t *testing.T) {
+		m, err := newExpiryManager(&EvidenceExpiryConfig{
+			DrainBefore:    time.Hour,
+			ShutdownBefore: time.Hour - 50*time.Millisecond,
+		}, ev.SignedEvidenceList{tokenPiece(time.Now().Add(time.Hour))})
+		require.NoError(t, err)
+
+		drained := make(chan struct{})
+		shutdown := make(chan evidence.Deadline, 1)
+		m.start(func() { close(drained) }, func(d evidence.Deadline) { shutdown <- d })
+		t.Cleanup(m.stop)
+
+		select {
+		case <-drained:
+		case <-shutdown:
+			t.Fatal("shut down before draining")
+		}
+		require.Equal(t, evidence.DeadlineJWT, (<-shutdown).Kind)
+	})
+
+	t.Run("ok, stopped before the drain", func(t *testing.T) {
+		m, err := newExpiryManager(DefaultEvidenceExpiryConfig(), list)
+		require.NoError(t, err)
+		m.start(func() { t.Error("drained") }, func(evidence.Deadline) { t.Error("shut down") })
+		m.stop()
+	})
+
+	t.Run("ok, evidence that doesn't expire", func(t *testing.T) {
+		m, err := newExpiryManager(DefaultEvidenceExpiryConfig(), ev.SignedEvidenceList{
+			&ev.SignedEvidencePiece{Type: ev.TpmtPublic, Data: []byte("rek")},
+		})
+		require.NoError(t, err)
+		require.Nil(t, m.status().Effective)
+		m.start(func() { t.Error("drained") }, func(evidence.Deadline) { t.Error("shut down") })
+	})
+
+	t.Run("fail, invalid config", func(t *testing.T) {
+		_, err := newExpiryManager(&EvidenceExpiryConfig{DrainBefore: time.Minute, ShutdownBefore: time.Hour}, list)
+		require.Error(t, err)
+		_, err = newExpiryManager(&EvidenceExpiryConfig{ShutdownBefore: -time.Minute}, list)
+		require.Error(t, err)
+		_, err = newExpiryManager(&EvidenceExpiryConfig{Ignore: []evidence.DeadlineKind{"ocsp"}}, list)
+		require.Error(t, err)
+	})
+}
@@ -18,20 +18,203 @@
 package routercom
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/openpcc/openpcc/httpfmt"
 )
 
+// defaultLLMBaseURL is the LLM compute_worker talks to when no llm_base_url is configured.
+const defaultLLMBaseURL = "http://localhost:11434"
+
+// backendCheckTimeout bounds the readiness check of the LLM backend, so a hanging backend reports
+// the node as not ready instead of hanging the router's scheduler.
+const backendCheckTimeout = 2 * time.Second
+
+// HealthState is the state of router_com as reported by the readiness endpoint.
+type HealthState string
+
+const (
+	// HealthStateReady means the node can serve confidential requests.
+	HealthStateReady HealthState = "ready"
+	// HealthStateNotReady means one of the readiness checks failed.
+	HealthStateNotReady HealthState = "not_ready"
+	// HealthStateDraining means the node is draining and rejects new requests.
+	HealthStateDraining HealthState = "draining"
+	// HealthStateMaintenance means the node booted in maintenance mode and refuses all confidential requests.
+	HealthStateMaintenance HealthState = "maintenance"
+)
+
+// HealthCheck is the result of a single readiness check. Detail never contains client data.
+type HealthCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Readiness is the readiness of router_com, for the router's scheduler.
+type Readiness struct {
+	State  HealthState   `json:"state"`
+	Checks []HealthCheck `json:"checks"`
+}
+
 // healthHandler returns a health check response compatible with Azure Application Health Extension v2.
 // Azure expects: {"ApplicationHealthState": "Healthy"}
 // GCP health checks only look at HTTP status code, so this is compatible with both.
 // xref https://learn.microsoft.com/en-us/azure/virtual-machine-scale-sets/virtual-machine-scale-sets-health-extension?tabs=rest-api#rich-health-states
 // TODO (CS-1277): We may want to adjust our router_com health check to start sooner and return unhealthy if attestation fails.
-func (*Service) healthHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Service) healthHandler(w http.ResponseWriter, r *http.Request) {
 	type body struct {
 		ApplicationHealthState string `json:"ApplicationHealthState"`
 	}
 
+	// A draining node or a node in maintenance mode should not receive new requests.
+	if s.state.isDraining() || s.maintenance != nil {
+		httpfmt.JSON(w, r, body{ApplicationHealthState: "Unhealthy"}, http.StatusServiceUnavailable)
+		return
+	}
+
 	httpfmt.JSON(w, r, body{ApplicationHealthState: "Healthy"}, http.StatusOK)
 }
+
+// livezHandler reports router_com is alive. It only fails when router_com can't serve HTTP at all,
+// so a node that is merely not ready is not restarted.
+func (*Service) livezHandler(w http.ResponseWriter, r *http.Request) {
+	httpfmt.JSON(w, r, struct {
+		Live bool `json:"live"`
+	}{Live: true}, http.StatusOK)
+}
+
+// readyzHandler reports whether the node can serve confidential requests, with the result of every
+// readiness check so the router's scheduler can tell why a node is not ready.
+func (s *Service) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	readiness := s.Readiness(r.Context())
+	status := http.StatusOK
+	if readiness.State != HealthStateReady {
+		status = http.StatusServiceUnavailable
+	}
+	httpfmt.JSON(w, r, readiness, status)
+}
+
+// Readiness runs the readiness checks. The node is ready when the evidence is loaded and not about
+// to expire, the router has reached the node, the LLM backend is reachable and the compute_worker
+// binary is executable.
+// A draining node or a node in maintenance mode is never ready.
+func (s *Service) Readiness(ctx context.Context) Readiness {
+	checks := []HealthCheck{
+		s.checkEvidence(),
+		s.checkRouterRegistered(),
+		s.checkBackend(ctx),
+		s.checkWorkerBinary(),
+		s.checkEvidenceExpiry(time.Now()),
+	}
+
+	state := HealthStateReady
+	for _, check := range checks {
+		if !check.OK {
+			state = HealthStateNotReady
+		}
+	}
+	switch {
+	case s.maintenance != nil:
+		state = HealthStateMaintenance
+	case s.state.isDraining():
+		state = HealthStateDraining
+	}
+
+	return Readiness{State: state, Checks: checks}
+}
+
+func (s *Service) checkEvidence() HealthCheck {
+	check := HealthCheck{Name: "evidence"}
+	switch {
+	case len(s.evidence) == 0:
+		check.Detail = "no evidence loaded"
+	case s.base64PubKey == "":
+		check.Detail = "evidence has no request encryption key"
+	default:
+		check.OK = true
+	}
+	return check
+}
+
+// checkEvidenceExpiry checks the node hasn't reached the drain time of its evidence expiry.
+func (s *Service) checkEvidenceExpiry(now time.Time) HealthCheck {
+	check := HealthCheck{Name: "evidence_expiry"}
+	if s.expiry == nil || s.expiry.status().Effective == nil {
+		check.OK = true
+		return check
+	}
+
+	expiry := s.expiry.status()
+	check.Detail = fmt.Sprintf("%s expires at %s", expiry.Effective, expiry.Effective.NotAfter.Format(time.RFC3339))
+	check.OK = now.Before(expiry.DrainAt)
+	return check
+}
+
+// checkRouterRegistered checks the router reached the node. The router pings nodes once they are
+// registered, before it schedules requests on them.
+func (s *Service) checkRouterRegistered() HealthCheck {
+	check := HealthCheck{Name: "router_registered"}
+	if !s.state.isRegistered() {
+		check.Detail = "router has not reached the node yet"
+		return check
+	}
+	check.OK = true
+	return check
+}
+
+// checkBackend checks the LLM backend responds to HTTP requests. Any response counts, the backends
+// don't agree on a health endpoint.
+func (s *Service) checkBackend(ctx context.Context) HealthCheck {
+	check := HealthCheck{Name: "backend"}
+
+	baseURL := defaultLLMBaseURL
+	if s.config != nil && s.config.Worker != nil && s.config.Worker.LLMBaseURL != "" {
+		baseURL = s.config.Worker.LLMBaseURL
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, backendCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL, nil)
+	if err != nil {
+		// the url may contain credentials, don't include the error.
+		check.Detail = "invalid llm base url"
+		return check
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		check.Detail = "llm backend is unreachable"
+		return check
+	}
+	_ = resp.Body.Close()
+
+	check.OK = true
+	return check
+}
+
+func (s *Service) checkWorkerBinary() HealthCheck {
+	check := HealthCheck{Name: "worker_binary"}
+	if s.config == nil || s.config.Worker == nil || s.config.Worker.BinaryPath == "" {
+		check.Detail = "no compute_worker binary configured"
+		return check
+	}
+
+	info, err := os.Stat(s.config.Worker.BinaryPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		check.Detail = "compute_worker binary is missing"
+	case err != nil:
+		check.Detail = "failed to stat compute_worker binary"
+	case !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0:
+		check.Detail = "compute_worker binary is not executable"
+	default:
+		check.OK = true
+	}
+	return check
+}
@@ -0,0 +1,180 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	ev "github.com/openpcc/openpcc/attestation/evidence"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadiness(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(backend.Close)
+
+	binaryPath := filepath.Join(t.TempDir(), "compute_worker")
+	require.NoError(t, os.WriteFile(binaryPath, []byte("#!/bin/sh\n"), 0o700))
+
+	newService := func() *Service {
+		cfg := DefaultConfig()
+		cfg.Worker.BinaryPath = binaryPath
+		cfg.Worker.LLMBaseURL = backend.URL
+		svc := &Service{
+			config: cfg,
+			evidence: ev.SignedEvidenceList{
+				&ev.SignedEvidencePiece{Type: ev.TpmtPublic, Data: []byte("rek")},
+			},
+			base64PubKey: "cmVr",
+			state:        newServiceState(),
+		}
+		setupHandlers(svc)
+		return svc
+	}
+
+	ping := func(svc *Service) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Confsec-Ping", "routercom")
+		svc.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	readyz := func(t *testing.T, svc *Service) (int, Readiness) {
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		var readiness Readiness
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&readiness))
+		return rec.Code, readiness
+	}
+
+	failedChecks := func(readiness Readiness) []string {
+		failed := []string{}
+		for _, check := range readiness.Checks {
+			if !check.OK {
+				failed = append(failed, check.Name)
+			}
+		}
+		return failed
+	}
+
+	t.Run("ok, ready once the router reached the node", func(t *testing.T) {
+		svc := newService()
+		code, readiness := readyz(t, svc)
+		require.Equal(t, http.StatusServiceUnavailable, code)
+		require.Equal(t, HealthStateNotReady, readiness.State)
+		require.Equal(t, []string{"router_registered"}, failedChecks(readiness))
+
+		ping(svc)
+		code, readiness = readyz(t, svc)
+		require.Equal(t, http.StatusOK, code)
+		require.Equal(t, HealthStateReady, readiness.State)
+		require.Empty(t, failedChecks(readiness))
+	})
+
+	t.Run("ok, live while not ready", func(t *testing.T) {
+		svc := newService()
+		svc.config.Worker.BinaryPath = ""
+
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		require.JSONEq(t, `{"live":true}`, rec.Body.String())
+	})
+
+	t.Run("fail, draining and maintenance nodes are not ready", func(t *testing.T) {
+		svc := newService()
+		ping(svc)
+		svc.SetDraining(true)
+		code, readiness := readyz(t, svc)
+		require.Equal(t, http.StatusServiceUnavailable, code)
+		require.Equal(t, HealthStateDraining, readiness.State)
+
+		svc.maintenance = &evidence.Maintenance{Reason: "INC-1234"}
+		_, readiness = readyz(t, svc)
+		require.Equal(t, HealthStateMaintenance, readiness.State)
+	})
+
+	tests := map[string]struct {
+		modify func(svc *Service)
+		failed string
+		detail string
+	}{
+		"fail, no evidence": {
+			modify: func(svc *Service) { svc.evidence = nil },
+			failed: "evidence",
+			detail: "no evidence loaded",
+		},
+		"fail, unreachable backend": {
+			modify: func(svc *Service) { svc.config.Worker.LLMBaseURL = "http://127.0.0.1:1" },
+			failed: "backend",
+			detail: "llm backend is unreachable",
+		},
+		"fail, missing worker binary": {
+			modify: func(svc *Service) { svc.config.Worker.BinaryPath = filepath.Join(t.TempDir(), "missing") },
+			failed: "worker_binary",
+			detail: "compute_worker binary is missing",
+		},
+		"fail, worker binary not executable": {
+			modify: func(svc *Service) {
+				path := filepath.Join(t.TempDir(), "compute_worker")
+				require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"), 0o600))
+				svc.config.Worker.BinaryPath = path
+			},
+			failed: "worker_binary",
+			detail: "compute_worker binary is not executable",
+		},
+		"fail, evidence about to expire": {
+			modify: func(svc *Service) {
+				notAfter := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+				svc.expiry = &expiryManager{expiry: EvidenceExpiry{
+					Effective: &evidence.Deadline{Piece: 3, Type: "NvidiaETA", Kind: evidence.DeadlineJWT, NotAfter: notAfter},
+					DrainAt:   notAfter.Add(-5 * time.Minute),
+				}}
+			},
+			failed: "evidence_expiry",
+			detail: "NvidiaETA jwt of piece 3 expires at 2025-06-01T00:00:00Z",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := newService()
+			ping(svc)
+			tc.modify(svc)
+
+			code, readiness := readyz(t, svc)
+			require.Equal(t, http.StatusServiceUnavailable, code)
+			require.Equal(t, HealthStateNotReady, readiness.State)
+			require.Equal(t, []string{tc.failed}, failedChecks(readiness))
+			for _, check := range readiness.Checks {
+				if check.Name == tc.failed {
+					require.Equal(t, tc.detail, check.Detail)
+				}
+			}
+		})
+	}
+}
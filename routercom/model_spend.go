@@ -0,0 +1,169 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/openpcc/openpcc/anonpay/currency"
+)
+
+const (
+	// defaultModelSpendHours is how many hours of spend the admin API reports.
+	defaultModelSpendHours = 24
+	// otherModel aggregates the spend of responses that don't name one of the installed models.
+	otherModel = "other"
+	// ModelSpendMessage is the message of the log record with the spend of an hour, logged when the
+	// hour has passed.
+	ModelSpendMessage = "Hourly model spend"
+)
+
+// ModelSpendConfig is config for aggregating the credits consumed and refunded per model, so
+// operators can size the fleet per model.
+type ModelSpendConfig struct {
+	// Hours is how many of the latest hours are kept for the admin API.
+	Hours int `yaml:"hours"`
+}
+
+func DefaultModelSpendConfig() *ModelSpendConfig {
+	return &ModelSpendConfig{
+		Hours: defaultModelSpendHours,
+	}
+}
+
+func (c *ModelSpendConfig) validate() error {
+	if c.Hours <= 0 {
+		return errors.New("hours must be positive")
+	}
+	return nil
+}
+
+// ModelSpend counts the requests and credits of a model. It only holds counts, never request content.
+type ModelSpend struct {
+	Requests uint64 `json:"requests"`
+	// Credits is the credit amount the requests were granted.
+	Credits int64 `json:"credits"`
+	// Refunded is the part of Credits that was refunded, Credits-Refunded was consumed.
+	Refunded int64 `json:"refunded"`
+}
+
+// HourlyModelSpend is the spend per model in the hour starting at Hour.
+type HourlyModelSpend struct {
+	Hour   time.Time             `json:"hour"`
+	Models map[string]ModelSpend `json:"models"`
+}
+
+// modelSpendTracker aggregates the spend per model per hour.
+type modelSpendTracker struct {
+	cfg    *ModelSpendConfig
+	models []string
+	now    func() time.Time
+
+	mu sync.Mutex
+	// hours are the latest hours with requests, oldest first.
+	hours []HourlyModelSpend
+}
+
+func newModelSpendTracker(cfg *ModelSpendConfig, models []string) (*modelSpendTracker, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &modelSpendTracker{
+		cfg:    cfg,
+		models: models,
+		now:    time.Now,
+	}, nil
+}
+
+// record adds a request for model that was granted credits and refunded refund. The model comes from
+// the worker output, models that aren't installed are counted as other so the backend can't grow the
+// aggregation.
+func (t *modelSpendTracker) record(model string, credits, refund int64) {
+	if !slices.Contains(t.models, model) {
+		model = otherModel
+	}
+	hour := t.now().UTC().Truncate(time.Hour)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.hours) == 0 || !t.hours[len(t.hours)-1].Hour.Equal(hour) {
+		if len(t.hours) > 0 {
+			logModelSpend(t.hours[len(t.hours)-1])
+		}
+		t.hours = append(t.hours, HourlyModelSpend{Hour: hour, Models: map[string]ModelSpend{}})
+		if len(t.hours) > t.cfg.Hours {
+			t.hours = slices.Delete(t.hours, 0, len(t.hours)-t.cfg.Hours)
+		}
+	}
+
+	spend := t.hours[len(t.hours)-1].Models[model]
+	spend.Requests++
+	spend.Credits += credits
+	spend.Refunded += refund
+	t.hours[len(t.hours)-1].Models[model] = spend
+}
+
+func (t *modelSpendTracker) stats() []HourlyModelSpend {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := make([]HourlyModelSpend, 0, len(t.hours))
+	for _, hour := range t.hours {
+		stats = append(stats, HourlyModelSpend{Hour: hour.Hour, Models: maps.Clone(hour.Models)})
+	}
+	return stats
+}
+
+// recordModelSpend adds a request for model that was granted credits to the model spend, refund
+// is nil when the worker didn't refund the request.
+func (s *Service) recordModelSpend(ctx context.Context, model string, credits int64, refund *currency.Value) {
+	if s.modelSpend == nil {
+		return
+	}
+	var amount int64
+	if refund != nil {
+		var err error
+		amount, err = refund.Amount()
+		if err != nil {
+			slog.WarnContext(ctx, "failed to record model spend", "error", err)
+			return
+		}
+	}
+	s.modelSpend.record(model, credits, amount)
+}
+
+// logModelSpend logs the spend of an hour that has passed, so it can be turned into metrics.
+func logModelSpend(hour HourlyModelSpend) {
+	for _, model := range slices.Sorted(maps.Keys(hour.Models)) {
+		spend := hour.Models[model]
+		slog.Info(ModelSpendMessage,
+			"hour", hour.Hour,
+			"model", model,
+			"requests", spend.Requests,
+			"credits", spend.Credits,
+			"refunded", spend.Refunded,
+		)
+	}
+}
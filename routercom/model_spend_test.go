@@ -0,0 +1,68 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelSpendTracker(t *testing.T) {
+	tracker, err := newModelSpendTracker(&ModelSpendConfig{Hours: 2}, []string{"llama3.2:1b", "qwen3:8b"})
+	require.NoError(t, err)
+
+	start := time.Date(2025, 6, 1, 10, 30, 0, 0, time.UTC)
+	now := start
+	tracker.now = func() time.Time { return now }
+
+	tracker.record("llama3.2:1b", 100, 40)
+	tracker.record("llama3.2:1b", 100, 0)
+	now = start.Add(time.Hour)
+	tracker.record("qwen3:8b", 50, 50)
+	// the backend named a model that isn't installed.
+	tracker.record("unknown:1b", 10, 0)
+	tracker.record("", 10, 10)
+	now = start.Add(2 * time.Hour)
+	tracker.record("llama3.2:1b", 20, 5)
+
+	stats := tracker.stats()
+	require.Equal(t, []HourlyModelSpend{
+		{
+			Hour: time.Date(2025, 6, 1, 11, 0, 0, 0, time.UTC),
+			Models: map[string]ModelSpend{
+				"qwen3:8b": {Requests: 1, Credits: 50, Refunded: 50},
+				otherModel: {Requests: 2, Credits: 20, Refunded: 10},
+			},
+		},
+		{
+			Hour: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
+			Models: map[string]ModelSpend{
+				"llama3.2:1b": {Requests: 1, Credits: 20, Refunded: 5},
+			},
+		},
+	}, stats)
+
+	// the stats are a snapshot.
+	stats[1].Models["llama3.2:1b"] = ModelSpend{}
+	require.Equal(t, uint64(1), tracker.stats()[1].Models["llama3.2:1b"].Requests)
+
+	_, err = newModelSpendTracker(&ModelSpendConfig{}, nil)
+	require.Error(t, err)
+}
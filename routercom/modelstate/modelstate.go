@@ -0,0 +1,126 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package modelstate shares the warm/cold state of the models on a node between
+// compute_boot, which prewarms the models, and router_com, which advertises them.
+package modelstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultFile is the default location of the model state file.
+const DefaultFile = "/run/confsec/model_state.json"
+
+// State is the warm/cold state of a single model.
+type State struct {
+	// Model is the name of the model.
+	Model string `json:"model"`
+	// Warm is true when the model was successfully prewarmed and is loaded by the inference engine.
+	Warm bool `json:"warm"`
+	// PrewarmedAt is when the model finished prewarming, zero for cold models.
+	PrewarmedAt time.Time `json:"prewarmed_at,omitzero"`
+	// Reason explains why a model is cold.
+	Reason string `json:"reason,omitempty"`
+	// Benchmark is the result of the startup benchmark, nil when the model was not benchmarked.
+	Benchmark *Benchmark `json:"benchmark,omitempty"`
+	// Sleeping is true when the model was prewarmed and then put to sleep to free its GPU memory.
+	// Sleeping models are warm, they are woken up by the first request for them.
+	Sleeping bool `json:"sleeping,omitempty"`
+	// EngineURL is the base url of the vLLM instance of a sleeping model, where it is woken up.
+	EngineURL string `json:"engine_url,omitempty"`
+}
+
+// Benchmark is the measured performance of a warm model.
+type Benchmark struct {
+	// TokensPerSecond is the median output throughput of a single request.
+	TokensPerSecond float64 `json:"tokens_per_second"`
+	// TTFT is the median time to the first output token.
+	TTFT time.Duration `json:"ttft"`
+	// Tier is the performance tier the results reach, empty if the model reaches no tier.
+	Tier string `json:"tier,omitempty"`
+}
+
+// Write atomically writes the model states to path.
+func Write(path string, states []State) error {
+	data, err := json.Marshal(states)
+	if err != nil {
+		return fmt.Errorf("failed to marshal model states: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create model state directory: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil { // #nosec G306 -- model states are not sensitive.
+		return fmt.Errorf("failed to write model states: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to rename model state file: %w", err)
+	}
+
+	return nil
+}
+
+// Read reads the model states from path. A missing file is not an error and returns no states,
+// callers should then treat all models as warm.
+func Read(path string) ([]State, error) {
+	// #nosec G304 -- path is provided by config.
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model states: %w", err)
+	}
+
+	var states []State
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal model states: %w", err)
+	}
+
+	return states, nil
+}
+
+// Cold returns the names of the cold models in states.
+func Cold(states []State) map[string]bool {
+	cold := map[string]bool{}
+	for _, state := range states {
+		if !state.Warm {
+			cold[state.Model] = true
+		}
+	}
+	return cold
+}
+
+// Sleeping returns the engine urls of the sleeping models in states by model.
+func Sleeping(states []State) map[string]string {
+	sleeping := map[string]string{}
+	for _, state := range states {
+		if state.Warm && state.Sleeping {
+			sleeping[state.Model] = state.EngineURL
+		}
+	}
+	return sleeping
+}
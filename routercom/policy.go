@@ -0,0 +1,272 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// maxPolicyBundleSize bounds the size of a signed policy bundle accepted from the router.
+const maxPolicyBundleSize = 1 * 1024 * 1024
+
+// maxPolicyClockSkew is how far in the future the issue time of a policy bundle may be.
+const maxPolicyClockSkew = 5 * time.Minute
+
+// DefaultPolicyStateFile is the default location of the applied policy bundle.
+const DefaultPolicyStateFile = "/var/lib/router_com/policy.json"
+
+var (
+	// ErrPolicySignature is returned when a policy bundle is not signed by the policy root key.
+	ErrPolicySignature = errors.New("invalid policy bundle signature")
+	// ErrPolicyStale is returned when a policy bundle is not newer than the applied policy.
+	ErrPolicyStale = errors.New("policy bundle version is not newer than the applied policy")
+	// ErrPolicyIssuedAt is returned when the issue time of a policy bundle is missing or in the future.
+	ErrPolicyIssuedAt = errors.New("invalid policy bundle issue time")
+)
+
+// PolicyConfig is config for policy bundles distributed by the router.
+type PolicyConfig struct {
+	// RootKey is the base64 encoded PEM ed25519 public key that policy bundles must be signed with.
+	// Leave blank to reject all policy bundles.
+	RootKey string `yaml:"root_key"`
+	// StateFile is where the applied signed bundle is persisted, so the rollback protection and the
+	// policy survive a restart of router_com. Leave blank to keep the policy in memory only.
+	StateFile string `yaml:"state_file"`
+}
+
+// PolicyBundle is fleet-wide policy applied to every compute_worker invocation. Zero values
+// leave the node's own config in place.
+type PolicyBundle struct {
+	// Version must increase with every bundle, older bundles are rejected to prevent rollbacks.
+	Version uint64 `json:"version"`
+	// IssuedAt is when the bundle was signed, it must be set and must not be before the issue time
+	// of the applied bundle.
+	IssuedAt time.Time `json:"issued_at"`
+	// AllowedModels restricts the configured models, models not in this list are not served.
+	AllowedModels []string `json:"allowed_models,omitempty"`
+	// MaxHeaderSize is the max size of a single request header.
+	MaxHeaderSize int `json:"max_header_size,omitempty"`
+	// MaxBodySize is the max size of a request body.
+	MaxBodySize int `json:"max_body_size,omitempty"`
+	// BannedBadgeKeyIDs are badge key IDs that are no longer accepted, see computeworker.BadgeKeyID.
+	BannedBadgeKeyIDs []string `json:"banned_badge_key_ids,omitempty"`
+}
+
+// SignedPolicyBundle is a JSON encoded PolicyBundle and its ed25519 signature. The bundle is
+// kept as bytes so the signature is verified over exactly what the router signed.
+type SignedPolicyBundle struct {
+	Bundle    []byte `json:"bundle"`
+	Signature []byte `json:"signature"`
+}
+
+// VerifyPolicyBundle verifies the signature of the bundle against the root key and decodes it.
+func VerifyPolicyBundle(rootKey ed25519.PublicKey, signed SignedPolicyBundle) (*PolicyBundle, error) {
+	if !ed25519.Verify(rootKey, signed.Bundle, signed.Signature) {
+		return nil, ErrPolicySignature
+	}
+
+	var bundle PolicyBundle
+	if err := json.Unmarshal(signed.Bundle, &bundle); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal policy bundle: %w", err)
+	}
+
+	if bundle.MaxHeaderSize < 0 || bundle.MaxBodySize < 0 {
+		return nil, errors.New("policy bundle limits must not be negative")
+	}
+
+	if bundle.IssuedAt.IsZero() {
+		return nil, fmt.Errorf("%w: issue time is missing", ErrPolicyIssuedAt)
+	}
+
+	return &bundle, nil
+}
+
+// applyPolicy verifies and applies a signed policy bundle to subsequent worker invocations. The
+// bundle is persisted before it is applied, so a restart can't roll back to an older policy.
+func (s *Service) applyPolicy(signed SignedPolicyBundle) (*PolicyBundle, error) {
+	s.policyMu.Lock()
+	defer s.policyMu.Unlock()
+
+	bundle, err := VerifyPolicyBundle(s.policyRootKey, signed)
+	if err != nil {
+		return nil, err
+	}
+
+	if bundle.IssuedAt.After(time.Now().Add(maxPolicyClockSkew)) {
+		return nil, fmt.Errorf("%w: issued in the future at %s", ErrPolicyIssuedAt, bundle.IssuedAt)
+	}
+
+	if err := checkPolicyNewer(s.state.currentPolicy(), bundle); err != nil {
+		return nil, err
+	}
+
+	if s.config.Policy != nil && s.config.Policy.StateFile != "" {
+		if err := writePolicyState(s.config.Policy.StateFile, signed); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.state.setPolicy(bundle); err != nil {
+		return nil, err
+	}
+
+	return bundle, nil
+}
+
+// checkPolicyNewer returns ErrPolicyStale when bundle does not replace current.
+func checkPolicyNewer(current, bundle *PolicyBundle) error {
+	if current == nil {
+		return nil
+	}
+
+	if bundle.Version <= current.Version {
+		return fmt.Errorf("%w: got version %d, have %d", ErrPolicyStale, bundle.Version, current.Version)
+	}
+
+	if bundle.IssuedAt.Before(current.IssuedAt) {
+		return fmt.Errorf("%w: issued at %s, before the applied policy issued at %s", ErrPolicyStale, bundle.IssuedAt, current.IssuedAt)
+	}
+
+	return nil
+}
+
+// loadPolicyState restores the persisted policy bundle, if any. The bundle is verified again, a bundle
+// that no longer verifies against the root key is an error rather than silently dropping the policy.
+func (s *Service) loadPolicyState(path string) error {
+	// #nosec G304 -- path is provided by config.
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read policy state: %w", err)
+	}
+
+	var signed SignedPolicyBundle
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return fmt.Errorf("failed to unmarshal policy state: %w", err)
+	}
+
+	bundle, err := VerifyPolicyBundle(s.policyRootKey, signed)
+	if err != nil {
+		return fmt.Errorf("failed to verify persisted policy bundle: %w", err)
+	}
+
+	return s.state.setPolicy(bundle)
+}
+
+// writePolicyState atomically writes the signed bundle to path.
+func writePolicyState(path string, signed SignedPolicyBundle) error {
+	data, err := json.Marshal(signed)
+	if err != nil {
+		return fmt.Errorf("failed to marshal policy state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create policy state directory: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write policy state: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to rename policy state file: %w", err)
+	}
+
+	return nil
+}
+
+// policyHandler receives signed policy bundles from the router.
+func (s *Service) policyHandler(w http.ResponseWriter, r *http.Request) {
+	if s.policyRootKey == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var signed SignedPolicyBundle
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPolicyBundleSize)).Decode(&signed); err != nil {
+		writeJSONError(w, r, "invalid policy bundle", http.StatusBadRequest)
+		return
+	}
+
+	bundle, err := s.applyPolicy(signed)
+	switch {
+	case errors.Is(err, ErrPolicySignature):
+		slog.Warn("Rejected policy bundle with invalid signature")
+		writeJSONError(w, r, ErrPolicySignature.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, ErrPolicyStale):
+		writeJSONError(w, r, ErrPolicyStale.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		slog.Warn("Rejected invalid policy bundle", "error", err)
+		writeJSONError(w, r, "invalid policy bundle", http.StatusBadRequest)
+		return
+	}
+
+	slog.Info("Applied policy bundle",
+		"version", bundle.Version,
+		"issued_at", bundle.IssuedAt,
+		"allowed_models", bundle.AllowedModels,
+		"banned_badge_key_ids", len(bundle.BannedBadgeKeyIDs))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// policyWorkerArgs returns the compute_worker arguments for the models, limits and banned
+// badge keys after applying the current policy to the node config.
+func (s *Service) policyWorkerArgs() []string {
+	policy := s.state.currentPolicy()
+
+	args := []string{}
+	for _, model := range s.config.Worker.Models {
+		if policy != nil && len(policy.AllowedModels) > 0 && !slices.Contains(policy.AllowedModels, model) {
+			continue
+		}
+		args = append(args, "-model", model)
+	}
+
+	if policy == nil {
+		return args
+	}
+
+	if policy.MaxHeaderSize > 0 {
+		args = append(args, "-max_header_size", strconv.Itoa(policy.MaxHeaderSize))
+	}
+
+	if policy.MaxBodySize > 0 {
+		args = append(args, "-max_body_size", strconv.Itoa(policy.MaxBodySize))
+	}
+
+	for _, id := range policy.BannedBadgeKeyIDs {
+		args = append(args, "-banned_badge_key_id", id)
+	}
+
+	return args
+}
@@ -0,0 +1,165 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyBundle(t *testing.T) {
+	rootPK, rootSK, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherSK, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	newService := func() *Service {
+		svc := &Service{
+			config: &Config{
+				Worker: &WorkerConfig{
+					Models: []string{"llama3.2:1b", "gemma3:1b"},
+				},
+				Policy: &PolicyConfig{},
+			},
+			state:         newServiceState(),
+			policyRootKey: rootPK,
+		}
+		setupHandlers(svc)
+		return svc
+	}
+
+	sign := func(t *testing.T, sk ed25519.PrivateKey, bundle PolicyBundle) []byte {
+		b, err := json.Marshal(bundle)
+		require.NoError(t, err)
+		body, err := json.Marshal(SignedPolicyBundle{
+			Bundle:    b,
+			Signature: ed25519.Sign(sk, b),
+		})
+		require.NoError(t, err)
+		return body
+	}
+
+	put := func(t *testing.T, svc *Service, body []byte) int {
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/_policy", bytes.NewReader(body)))
+		return rec.Code
+	}
+
+	t.Run("ok, policy is applied to worker args", func(t *testing.T) {
+		svc := newService()
+		require.Equal(t, []string{"-model", "llama3.2:1b", "-model", "gemma3:1b"}, svc.policyWorkerArgs())
+
+		code := put(t, svc, sign(t, rootSK, PolicyBundle{
+			Version:           1,
+			IssuedAt:          time.Now(),
+			AllowedModels:     []string{"gemma3:1b", "qwen2:1.5b-instruct"},
+			MaxBodySize:       4096,
+			BannedBadgeKeyIDs: []string{"abcd"},
+		}))
+		require.Equal(t, http.StatusNoContent, code)
+		require.Equal(t, []string{
+			"-model", "gemma3:1b",
+			"-max_body_size", "4096",
+			"-banned_badge_key_id", "abcd",
+		}, svc.policyWorkerArgs())
+		require.Equal(t, uint64(1), svc.AdminStatus().PolicyVersion)
+	})
+
+	t.Run("fail, stale version is rejected", func(t *testing.T) {
+		svc := newService()
+		now := time.Now()
+		require.Equal(t, http.StatusNoContent, put(t, svc, sign(t, rootSK, PolicyBundle{Version: 2, IssuedAt: now})))
+		require.Equal(t, http.StatusConflict, put(t, svc, sign(t, rootSK, PolicyBundle{Version: 2, IssuedAt: now})))
+		require.Equal(t, http.StatusConflict, put(t, svc, sign(t, rootSK, PolicyBundle{Version: 1, IssuedAt: now})))
+		require.Equal(t, http.StatusConflict, put(t, svc, sign(t, rootSK, PolicyBundle{Version: 3, IssuedAt: now.Add(-time.Hour)})))
+		require.Equal(t, uint64(2), svc.AdminStatus().PolicyVersion)
+	})
+
+	t.Run("fail, missing issue time", func(t *testing.T) {
+		svc := newService()
+		require.Equal(t, http.StatusBadRequest, put(t, svc, sign(t, rootSK, PolicyBundle{Version: 1})))
+		require.Nil(t, svc.state.currentPolicy())
+	})
+
+	t.Run("fail, issued in the future", func(t *testing.T) {
+		svc := newService()
+		code := put(t, svc, sign(t, rootSK, PolicyBundle{Version: 1, IssuedAt: time.Now().Add(time.Hour)}))
+		require.Equal(t, http.StatusBadRequest, code)
+		require.Nil(t, svc.state.currentPolicy())
+	})
+
+	t.Run("ok, applied policy survives a restart", func(t *testing.T) {
+		stateFile := filepath.Join(t.TempDir(), "policy.json")
+		svc := newService()
+		svc.config.Policy.StateFile = stateFile
+		code := put(t, svc, sign(t, rootSK, PolicyBundle{Version: 5, IssuedAt: time.Now(), AllowedModels: []string{"gemma3:1b"}}))
+		require.Equal(t, http.StatusNoContent, code)
+
+		restarted := newService()
+		restarted.config.Policy.StateFile = stateFile
+		require.NoError(t, restarted.loadPolicyState(stateFile))
+		require.Equal(t, uint64(5), restarted.AdminStatus().PolicyVersion)
+		require.Equal(t, []string{"-model", "gemma3:1b"}, restarted.policyWorkerArgs())
+
+		code = put(t, restarted, sign(t, rootSK, PolicyBundle{Version: 4, IssuedAt: time.Now()}))
+		require.Equal(t, http.StatusConflict, code)
+	})
+
+	t.Run("fail, persisted policy signed by another key", func(t *testing.T) {
+		stateFile := filepath.Join(t.TempDir(), "policy.json")
+		b, err := json.Marshal(PolicyBundle{Version: 1, IssuedAt: time.Now()})
+		require.NoError(t, err)
+		require.NoError(t, writePolicyState(stateFile, SignedPolicyBundle{Bundle: b, Signature: ed25519.Sign(otherSK, b)}))
+
+		svc := newService()
+		require.ErrorIs(t, svc.loadPolicyState(stateFile), ErrPolicySignature)
+	})
+
+	t.Run("ok, missing state file", func(t *testing.T) {
+		svc := newService()
+		require.NoError(t, svc.loadPolicyState(filepath.Join(t.TempDir(), "policy.json")))
+		require.Nil(t, svc.state.currentPolicy())
+	})
+
+	t.Run("fail, bundle signed by another key", func(t *testing.T) {
+		svc := newService()
+		code := put(t, svc, sign(t, otherSK, PolicyBundle{Version: 1, IssuedAt: time.Now(), AllowedModels: []string{"gemma3:1b"}}))
+		require.Equal(t, http.StatusForbidden, code)
+		require.Nil(t, svc.state.currentPolicy())
+	})
+
+	t.Run("fail, invalid body", func(t *testing.T) {
+		svc := newService()
+		require.Equal(t, http.StatusBadRequest, put(t, svc, []byte("not-json")))
+	})
+
+	t.Run("fail, policy bundles disabled without root key", func(t *testing.T) {
+		svc := newService()
+		svc.policyRootKey = nil
+		require.Equal(t, http.StatusNotFound, put(t, svc, sign(t, rootSK, PolicyBundle{Version: 1, IssuedAt: time.Now()})))
+	})
+}
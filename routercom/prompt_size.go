@@ -0,0 +1,145 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package routercom
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"sync"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker"
+)
+
+// defaultPromptSizeMinRequests is how many requests the prompt size histograms need before they are reported.
+const defaultPromptSizeMinRequests = 100
+
+// PromptSizeConfig is config for aggregating the prompt sizes the compute_workers report, see
+// computeworker.PromptSize.
+type PromptSizeConfig struct {
+	// MinRequests is how many requests the histograms need before the admin API reports them, so the
+	// histograms of a node that served few requests don't reveal the size of a single prompt.
+	MinRequests uint64 `yaml:"min_requests"`
+}
+
+func DefaultPromptSizeConfig() *PromptSizeConfig {
+	return &PromptSizeConfig{
+		MinRequests: defaultPromptSizeMinRequests,
+	}
+}
+
+func (c *PromptSizeConfig) validate() error {
+	if c.MinRequests == 0 {
+		return errors.New("min_requests must be positive")
+	}
+	return nil
+}
+
+// PromptSizeStats are histograms of the prompt sizes of the requests since router_com started. The
+// histograms count the requests by power-of-two bucket, the upper bound of the bucket.
+type PromptSizeStats struct {
+	// Requests counts the requests that reported their prompt size.
+	Requests uint64 `json:"requests"`
+	// BodyBytes counts the requests by validated body size, empty until MinRequests were reported.
+	BodyBytes map[int64]uint64 `json:"body_bytes"`
+	// Messages counts the requests by number of messages, empty until MinRequests were reported.
+	// Bodies that aren't a list of messages are counted in bucket 0.
+	Messages map[int64]uint64 `json:"messages"`
+}
+
+// promptSizeTracker aggregates the prompt size records of the workers.
+type promptSizeTracker struct {
+	cfg *PromptSizeConfig
+
+	mu        sync.Mutex
+	requests  uint64
+	bodyBytes map[int64]uint64
+	messages  map[int64]uint64
+}
+
+func newPromptSizeTracker(cfg *PromptSizeConfig) (*promptSizeTracker, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &promptSizeTracker{
+		cfg:       cfg,
+		bodyBytes: map[int64]uint64{},
+		messages:  map[int64]uint64{},
+	}, nil
+}
+
+func (t *promptSizeTracker) record(size computeworker.PromptSize) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.requests++
+	t.bodyBytes[size.BodyBytes]++
+	t.messages[size.Messages]++
+}
+
+func (t *promptSizeTracker) stats() PromptSizeStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := PromptSizeStats{
+		Requests:  t.requests,
+		BodyBytes: map[int64]uint64{},
+		Messages:  map[int64]uint64{},
+	}
+	if t.requests < t.cfg.MinRequests {
+		return stats
+	}
+	maps.Copy(stats.BodyBytes, t.bodyBytes)
+	maps.Copy(stats.Messages, t.messages)
+	return stats
+}
+
+// promptSizeHandler picks the prompt size records out of the forwarded worker logs. Like
+// startupLatencyHandler, the records are aggregated even when the log level hides them.
+type promptSizeHandler struct {
+	inner   slog.Handler
+	tracker *promptSizeTracker
+}
+
+func (h *promptSizeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level == slog.LevelInfo || h.inner.Enabled(ctx, level)
+}
+
+func (h *promptSizeHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Message == computeworker.PromptSizeMessage {
+		record.Attrs(func(a slog.Attr) bool {
+			size, ok := computeworker.ParsePromptSize(a)
+			if ok {
+				h.tracker.record(size)
+			}
+			return !ok
+		})
+	}
+	if !h.inner.Enabled(ctx, record.Level) {
+		return nil
+	}
+	return h.inner.Handle(ctx, record)
+}
+
+func (h *promptSizeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &promptSizeHandler{inner: h.inner.WithAttrs(attrs), tracker: h.tracker}
+}
+
+func (h *promptSizeHandler) WithGroup(name string) slog.Handler {
+	return &promptSizeHandler{inner: h.inner.WithGroup(name), tracker: h.tracker}
+}
@@ -0,0 +1,74 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package routercom
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker"
+	"github.com/confidentsecurity/confidentcompute/debug"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromptSizeTracker(t *testing.T) {
+	tracker, err := newPromptSizeTracker(&PromptSizeConfig{MinRequests: 3})
+	require.NoError(t, err)
+
+	tracker.record(computeworker.NewPromptSize(1000, 2))
+	tracker.record(computeworker.NewPromptSize(900, 0))
+
+	// too few requests to report the histograms.
+	stats := tracker.stats()
+	require.Equal(t, uint64(2), stats.Requests)
+	require.Empty(t, stats.BodyBytes)
+	require.Empty(t, stats.Messages)
+
+	tracker.record(computeworker.NewPromptSize(5000, 7))
+
+	stats = tracker.stats()
+	require.Equal(t, uint64(3), stats.Requests)
+	require.Equal(t, map[int64]uint64{1024: 2, 8192: 1}, stats.BodyBytes)
+	require.Equal(t, map[int64]uint64{0: 1, 2: 1, 8: 1}, stats.Messages)
+
+	_, err = newPromptSizeTracker(&PromptSizeConfig{})
+	require.Error(t, err)
+}
+
+func TestPromptSizeHandler(t *testing.T) {
+	tracker, err := newPromptSizeTracker(&PromptSizeConfig{MinRequests: 1})
+	require.NoError(t, err)
+
+	var workerLogs bytes.Buffer
+	worker := slog.New(slog.NewJSONHandler(&workerLogs, nil))
+	worker.Info("Handling request")
+	worker.Info(computeworker.PromptSizeMessage, computeworker.PromptSizeKey, computeworker.NewPromptSize(300, 4))
+
+	// the router_com log level hides info records, they are aggregated anyway.
+	var out bytes.Buffer
+	inner := slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: slog.LevelWarn})
+	logger := slog.New(&promptSizeHandler{inner: inner, tracker: tracker})
+	require.NoError(t, debug.ForwardLogs(t.Context(), strings.NewReader(workerLogs.String()), logger))
+
+	stats := tracker.stats()
+	require.Equal(t, uint64(1), stats.Requests)
+	require.Equal(t, map[int64]uint64{512: 1}, stats.BodyBytes)
+	require.Equal(t, map[int64]uint64{4: 1}, stats.Messages)
+	require.Empty(t, out.String())
+}
@@ -0,0 +1,128 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// recentMetricsInterval is how often the load of the service is sampled.
+	recentMetricsInterval = time.Minute
+	// recentMetricsSamples is how many samples are kept, an hour at the default interval.
+	recentMetricsSamples = 60
+)
+
+// MetricsSample is the load of the service at Time. Counters are totals since router_com started,
+// the difference between two samples is the count in between.
+type MetricsSample struct {
+	Time       time.Time `json:"time"`
+	Draining   bool      `json:"draining"`
+	QueueDepth int       `json:"queue_depth"`
+	Workers    int       `json:"workers"`
+	// WorkerExits counts the requests that ended, by any exit code.
+	WorkerExits      uint64 `json:"worker_exits"`
+	ValidationErrors uint64 `json:"validation_errors"`
+	SlowClientAborts uint64 `json:"slow_client_aborts"`
+	ErrorDetails     uint64 `json:"error_details"`
+	// TPMBrokerQueueDepth and TPMBrokerActive are zero when the broker is disabled.
+	TPMBrokerQueueDepth int `json:"tpm_broker_queue_depth"`
+	TPMBrokerActive     int `json:"tpm_broker_active"`
+}
+
+// newMetricsSample samples the counters of status.
+func newMetricsSample(now time.Time, status AdminStatus) MetricsSample {
+	sample := MetricsSample{
+		Time:             now.UTC(),
+		Draining:         status.Draining,
+		QueueDepth:       status.QueueDepth,
+		Workers:          len(status.Workers),
+		SlowClientAborts: status.SlowClientAborts,
+		ErrorDetails:     status.ErrorDetails,
+	}
+	for _, n := range status.WorkerExitCodes {
+		sample.WorkerExits += n
+	}
+	for _, n := range status.ValidationErrors {
+		sample.ValidationErrors += n
+	}
+	if status.TPMBroker != nil {
+		sample.TPMBrokerQueueDepth = status.TPMBroker.QueueDepth
+		sample.TPMBrokerActive = status.TPMBroker.Active
+	}
+	return sample
+}
+
+// recentMetrics keeps the latest samples of the load of the service for support bundles.
+type recentMetrics struct {
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	done     chan struct{}
+
+	mu sync.Mutex
+	// history are the latest samples, oldest first.
+	history []MetricsSample
+}
+
+func newRecentMetrics() *recentMetrics {
+	return &recentMetrics{
+		stopCh: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// start records a sample every interval until stop is called.
+func (m *recentMetrics) start(interval time.Duration, sample func() MetricsSample) {
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.record(sample())
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (m *recentMetrics) stop() {
+	m.stopOnce.Do(func() {
+		close(m.stopCh)
+	})
+	<-m.done
+}
+
+func (m *recentMetrics) record(sample MetricsSample) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.history = append(m.history, sample)
+	if len(m.history) > recentMetricsSamples {
+		m.history = slices.Delete(m.history, 0, len(m.history)-recentMetricsSamples)
+	}
+}
+
+func (m *recentMetrics) samples() []MetricsSample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.history)
+}
@@ -0,0 +1,250 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/confidentsecurity/confidentcompute/sealedconfig"
+	"github.com/openpcc/openpcc/otel/otelutil"
+)
+
+// RequestIDHeader is set by the router to identify a request. Refunds delivered with a callback
+// are keyed by this ID.
+const RequestIDHeader = "X-Confsec-Request-Id"
+
+// maxRequestIDLen bounds the request ID echoed back to the router.
+const maxRequestIDLen = 128
+
+// ErrRefundSignature is returned when a refund report is not signed by the node.
+var ErrRefundSignature = errors.New("invalid refund report signature")
+
+// RefundCallbackConfig is config for delivering refunds to the router with a callback, for
+// deployments where HTTP intermediaries strip the refund trailer.
+type RefundCallbackConfig struct {
+	// URL is the router endpoint signed refunds are posted to. Leave blank to only deliver refunds
+	// in the response trailer.
+	URL string `yaml:"url"`
+	// SigningKeyFile contains the PEM encoded PKCS #8 ed25519 private key refund reports are signed
+	// with. The file can be sealed with seal_config.
+	SigningKeyFile string `yaml:"signing_key_file"`
+	// DisableTrailer stops delivering refunds in the response trailer. Requests without a request ID
+	// still get the trailer, as the callback can't identify them.
+	DisableTrailer bool `yaml:"disable_trailer"`
+	// MaxRetries is how many times a failed callback is retried.
+	MaxRetries int `yaml:"max_retries"`
+	// RetryInterval is how long to wait between retries.
+	RetryInterval time.Duration `yaml:"retry_interval"`
+	// Timeout is how long to wait for a single callback.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func DefaultRefundCallbackConfig() *RefundCallbackConfig {
+	return &RefundCallbackConfig{
+		MaxRetries:    5,
+		RetryInterval: 2 * time.Second,
+		Timeout:       10 * time.Second,
+	}
+}
+
+// RefundReport is a refund for a single request, delivered to the router with a callback.
+type RefundReport struct {
+	RequestID string `json:"request_id"`
+	// NodeRequestID is the confsec request ID minted by router_com, it matches the node logs.
+	NodeRequestID string `json:"node_request_id,omitempty"`
+	// Refund is the binary protobuf encoded currency, the same value as the refund trailer.
+	Refund []byte `json:"refund"`
+	// RefundSignature is the signature of the refund by the attestation key of the node, the same
+	// value as the refund signature trailer. Empty when refunds are not signed.
+	RefundSignature []byte `json:"refund_signature,omitempty"`
+	// RefundUnsigned is true when the node signs refunds but failed to sign this one.
+	RefundUnsigned bool `json:"refund_unsigned,omitempty"`
+	// Aborted is true when the response failed mid-stream.
+	Aborted  bool      `json:"aborted,omitempty"`
+	IssuedAt time.Time `json:"issued_at"`
+}
+
+// SignedRefundReport is a JSON encoded RefundReport and its ed25519 signature. The report is
+// kept as bytes so the router verifies the signature over exactly what the node signed.
+type SignedRefundReport struct {
+	Report    []byte `json:"report"`
+	Signature []byte `json:"signature"`
+}
+
+// VerifyRefundReport verifies the signature of the report against the public key of the node and decodes it.
+func VerifyRefundReport(pubKey ed25519.PublicKey, signed SignedRefundReport) (*RefundReport, error) {
+	if !ed25519.Verify(pubKey, signed.Report, signed.Signature) {
+		return nil, ErrRefundSignature
+	}
+
+	var report RefundReport
+	if err := json.Unmarshal(signed.Report, &report); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal refund report: %w", err)
+	}
+
+	return &report, nil
+}
+
+// refundReporter posts signed refund reports to the router in the background, retrying failed callbacks.
+type refundReporter struct {
+	cfg     *RefundCallbackConfig
+	key     ed25519.PrivateKey
+	client  *http.Client
+	pending *sync.WaitGroup
+}
+
+func newRefundReporter(cfg *RefundCallbackConfig, key ed25519.PrivateKey, pending *sync.WaitGroup) (*refundReporter, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid refund callback url: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, fmt.Errorf("invalid refund callback url scheme: %q", u.Scheme)
+	}
+	if cfg.MaxRetries < 0 {
+		return nil, fmt.Errorf("invalid refund callback max retries: %d", cfg.MaxRetries)
+	}
+	if cfg.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid refund callback timeout: %s", cfg.Timeout)
+	}
+
+	return &refundReporter{
+		cfg:     cfg,
+		key:     key,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		pending: pending,
+	}, nil
+}
+
+// readRefundSigningKey reads the PEM encoded PKCS #8 ed25519 private key from a plain or sealed file.
+func readRefundSigningKey(path string) (ed25519.PrivateKey, error) {
+	b, err := sealedconfig.ReadFile(path, sealedconfig.DefaultTPMDevice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read refund signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("failed to decode refund signing key PEM block")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse refund signing key: %w", err)
+	}
+
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("refund signing key is not an ed25519 private key")
+	}
+	return edKey, nil
+}
+
+// requestID returns the request ID set by the router, or an empty string when it's missing or invalid.
+func requestID(r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if len(id) > maxRequestIDLen {
+		return ""
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return ""
+		}
+	}
+	return id
+}
+
+// Report signs the report and delivers it in the background. The delivery outlives the request,
+// Service.Close waits for pending deliveries.
+func (r *refundReporter) Report(ctx context.Context, report RefundReport) error {
+	b, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal refund report: %w", err)
+	}
+	body, err := json.Marshal(SignedRefundReport{
+		Report:    b,
+		Signature: ed25519.Sign(r.key, b),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal signed refund report: %w", err)
+	}
+
+	// the request context is cancelled once the response is written.
+	ctx = context.WithoutCancel(ctx)
+	r.pending.Add(1)
+	go func() {
+		defer r.pending.Done()
+		if err := r.deliver(ctx, body); err != nil {
+			slog.ErrorContext(ctx, "failed to deliver refund to router", "request_id", report.RequestID, "error", err)
+		}
+	}()
+	return nil
+}
+
+func (r *refundReporter) deliver(ctx context.Context, body []byte) error {
+	ctx, span := otelutil.Tracer.Start(ctx, "routercom.refundReporter.deliver")
+	defer span.End()
+
+	retry := backoff.WithContext(backoff.WithMaxRetries(backoff.NewConstantBackOff(r.cfg.RetryInterval), uint64(r.cfg.MaxRetries)), ctx)
+	err := backoff.Retry(func() error {
+		return r.post(ctx, body)
+	}, retry)
+	if err != nil {
+		return otelutil.RecordError(span, err)
+	}
+	return nil
+}
+
+func (r *refundReporter) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return backoff.Permanent(fmt.Errorf("failed to create refund callback request: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post refund: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+		// the router rejected the refund, retrying won't change that.
+		return backoff.Permanent(fmt.Errorf("router rejected refund with status %d", resp.StatusCode))
+	default:
+		return fmt.Errorf("router responded to refund with status %d", resp.StatusCode)
+	}
+}
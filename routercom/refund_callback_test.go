@@ -0,0 +1,167 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefundReporter(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	newReporter := func(t *testing.T, url string) (*refundReporter, *sync.WaitGroup) {
+		cfg := DefaultRefundCallbackConfig()
+		cfg.URL = url
+		cfg.RetryInterval = time.Millisecond
+		wg := &sync.WaitGroup{}
+		r, err := newRefundReporter(cfg, key, wg)
+		require.NoError(t, err)
+		return r, wg
+	}
+
+	t.Run("ok, signed refund is delivered after retries", func(t *testing.T) {
+		var (
+			attempts atomic.Int32
+			received SignedRefundReport
+		)
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if attempts.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer srv.Close()
+
+		r, wg := newReporter(t, srv.URL)
+		require.NoError(t, r.Report(t.Context(), RefundReport{
+			RequestID:     "req-1",
+			NodeRequestID: "node-req-1",
+			Refund:        []byte{0x08, 0x01},
+			IssuedAt:      time.Now(),
+		}))
+		wg.Wait()
+
+		require.Equal(t, int32(3), attempts.Load())
+		report, err := VerifyRefundReport(pub, received)
+		require.NoError(t, err)
+		require.Equal(t, "req-1", report.RequestID)
+		require.Equal(t, "node-req-1", report.NodeRequestID)
+		require.Equal(t, []byte{0x08, 0x01}, report.Refund)
+	})
+
+	t.Run("ok, rejected refund is not retried", func(t *testing.T) {
+		var attempts atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			attempts.Add(1)
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer srv.Close()
+
+		r, wg := newReporter(t, srv.URL)
+		require.NoError(t, r.Report(t.Context(), RefundReport{RequestID: "req-1"}))
+		wg.Wait()
+
+		require.Equal(t, int32(1), attempts.Load())
+	})
+
+	t.Run("fail, report signed by another key", func(t *testing.T) {
+		_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		b, err := json.Marshal(RefundReport{RequestID: "req-1"})
+		require.NoError(t, err)
+		_, err = VerifyRefundReport(pub, SignedRefundReport{Report: b, Signature: ed25519.Sign(otherKey, b)})
+		require.ErrorIs(t, err, ErrRefundSignature)
+	})
+
+	t.Run("fail, invalid url", func(t *testing.T) {
+		cfg := DefaultRefundCallbackConfig()
+		cfg.URL = "router.local/refunds"
+		_, err := newRefundReporter(cfg, key, &sync.WaitGroup{})
+		require.Error(t, err)
+	})
+}
+
+func TestReadRefundSigningKey(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "refund.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	got, err := readRefundSigningKey(path)
+	require.NoError(t, err)
+	require.Equal(t, key, got)
+
+	require.NoError(t, os.WriteFile(path, []byte("not a key"), 0o600))
+	_, err = readRefundSigningKey(path)
+	require.Error(t, err)
+}
+
+func TestRequestID(t *testing.T) {
+	tests := map[string]struct {
+		header string
+		want   string
+	}{
+		"ok, id":             {header: "0190a4b2-7c1e-7d3f-9a2b-3c4d5e6f7a8b", want: "0190a4b2-7c1e-7d3f-9a2b-3c4d5e6f7a8b"},
+		"ok, missing":        {header: "", want: ""},
+		"fail, too long":     {header: strings.Repeat("a", maxRequestIDLen+1), want: ""},
+		"fail, control char": {header: "req\t1", want: ""},
+		"fail, non ascii":    {header: "req-ü", want: ""},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.Header.Set(RequestIDHeader, tc.header)
+			require.Equal(t, tc.want, requestID(r))
+		})
+	}
+}
+
+func TestRefundTrailerEnabled(t *testing.T) {
+	require.True(t, (&Service{}).refundTrailerEnabled("req-1"))
+
+	svc := &Service{refunds: &refundReporter{cfg: &RefundCallbackConfig{DisableTrailer: false}}}
+	require.True(t, svc.refundTrailerEnabled("req-1"))
+
+	svc = &Service{refunds: &refundReporter{cfg: &RefundCallbackConfig{DisableTrailer: true}}}
+	require.False(t, svc.refundTrailerEnabled("req-1"))
+	// without a request ID the callback can't identify the request, the trailer is the only option.
+	require.True(t, svc.refundTrailerEnabled(""))
+}
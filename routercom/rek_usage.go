@@ -0,0 +1,291 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// maxREKGenerations is how many REK generations are kept in the usage file.
+	maxREKGenerations = 16
+	// rekUsagePersistInterval is how often changed counters are written to the usage file.
+	rekUsagePersistInterval = 30 * time.Second
+)
+
+// REKUsageConfig is config for counting the requests decapsulated with the REK and alerting on
+// abnormal rates, such as an entity replaying encapsulated keys.
+type REKUsageConfig struct {
+	// File persists the counters across router_com restarts. Leave blank to keep them in memory only.
+	File string `yaml:"file"`
+	// Window is the period the alert thresholds apply to.
+	Window time.Duration `yaml:"window"`
+	// MaxDecapsulations alerts when more requests are decapsulated within a window. 0 disables the alert.
+	MaxDecapsulations uint64 `yaml:"max_decapsulations"`
+	// MaxFailures alerts when more decapsulations fail within a window. 0 disables the alert.
+	MaxFailures uint64 `yaml:"max_failures"`
+	// MaxKeyReuse alerts when a single encapsulated key is decapsulated more often within a window.
+	// Clients encapsulate a fresh key per request, so reuse points at replays. 0 disables the alert.
+	MaxKeyReuse uint64 `yaml:"max_key_reuse"`
+}
+
+func DefaultREKUsageConfig() *REKUsageConfig {
+	return &REKUsageConfig{
+		Window:      time.Minute,
+		MaxKeyReuse: 1,
+	}
+}
+
+func (c *REKUsageConfig) validate() error {
+	if c.Window <= 0 {
+		return errors.New("window must be positive")
+	}
+	return nil
+}
+
+// REKUsage counts the requests decapsulated with a single REK generation.
+type REKUsage struct {
+	// KeyName is the base64 encoded TPM name of the REK, it identifies the generation.
+	KeyName string `json:"key_name"`
+	// FirstUsed is when the generation first decapsulated a request.
+	FirstUsed time.Time `json:"first_used,omitzero"`
+	// LastUsed is when the generation last decapsulated a request.
+	LastUsed time.Time `json:"last_used,omitzero"`
+	// Decapsulations is the number of successfully decapsulated requests.
+	Decapsulations uint64 `json:"decapsulations"`
+	// Failures is the number of requests that failed to decapsulate.
+	Failures uint64 `json:"failures"`
+	// Alerts is the number of alerts raised for the generation.
+	Alerts uint64 `json:"alerts"`
+}
+
+// rekUsageWindow holds the counters the alert thresholds apply to.
+type rekUsageWindow struct {
+	start          time.Time
+	decapsulations uint64
+	failures       uint64
+	// keys counts decapsulations by the digest of the encapsulated key.
+	keys    map[[sha256.Size]byte]uint64
+	alerted map[string]bool
+}
+
+// rekUsageCounter counts decapsulations of the current REK generation and raises alerts
+// when the counts within a window exceed the configured thresholds.
+type rekUsageCounter struct {
+	cfg *REKUsageConfig
+	now func() time.Time
+
+	mu sync.Mutex
+	// generations are the known generations, the last one is the current generation.
+	generations []REKUsage
+	window      rekUsageWindow
+	dirty       bool
+	persistedAt time.Time
+
+	// persistMu serializes writes to the usage file.
+	persistMu sync.Mutex
+}
+
+// newREKUsageCounter creates a counter for the REK generation identified by keyName, resuming the
+// counts from the usage file when it knows the generation.
+func newREKUsageCounter(cfg *REKUsageConfig, keyName string) (*rekUsageCounter, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	generations, err := readREKUsage(cfg.File)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(generations) == 0 || generations[len(generations)-1].KeyName != keyName {
+		generations = append(generations, REKUsage{KeyName: keyName})
+	}
+	if len(generations) > maxREKGenerations {
+		generations = generations[len(generations)-maxREKGenerations:]
+	}
+
+	c := &rekUsageCounter{
+		cfg:         cfg,
+		now:         time.Now,
+		generations: generations,
+	}
+	c.window = c.newWindow(c.now())
+	return c, nil
+}
+
+func (*rekUsageCounter) newWindow(start time.Time) rekUsageWindow {
+	return rekUsageWindow{
+		start:   start,
+		keys:    map[[sha256.Size]byte]uint64{},
+		alerted: map[string]bool{},
+	}
+}
+
+// decapsulated counts a request that was decapsulated with the REK.
+func (c *rekUsageCounter) decapsulated(encapsulatedKey []byte) {
+	c.mu.Lock()
+	now := c.record(func(current *REKUsage, now time.Time) {
+		current.Decapsulations++
+		if current.FirstUsed.IsZero() {
+			current.FirstUsed = now
+		}
+		current.LastUsed = now
+
+		c.window.decapsulations++
+		c.checkThreshold(current, "decapsulations", c.window.decapsulations, c.cfg.MaxDecapsulations)
+
+		digest := sha256.Sum256(encapsulatedKey)
+		c.window.keys[digest]++
+		c.checkThreshold(current, "key_reuse", c.window.keys[digest], c.cfg.MaxKeyReuse)
+	})
+	c.mu.Unlock()
+
+	c.maybePersist(now)
+}
+
+// failed counts a request that failed to decapsulate.
+func (c *rekUsageCounter) failed() {
+	c.mu.Lock()
+	now := c.record(func(current *REKUsage, _ time.Time) {
+		current.Failures++
+
+		c.window.failures++
+		c.checkThreshold(current, "failures", c.window.failures, c.cfg.MaxFailures)
+	})
+	c.mu.Unlock()
+
+	c.maybePersist(now)
+}
+
+// record applies update to the current generation, starting a new window when the current
+// one has passed. Must be called with mu held.
+func (c *rekUsageCounter) record(update func(current *REKUsage, now time.Time)) time.Time {
+	now := c.now()
+	if now.Sub(c.window.start) >= c.cfg.Window {
+		c.window = c.newWindow(now)
+	}
+	update(&c.generations[len(c.generations)-1], now)
+	c.dirty = true
+	return now
+}
+
+// checkThreshold raises an alert when count exceeds threshold, at most once per kind and window.
+// Must be called with mu held.
+func (c *rekUsageCounter) checkThreshold(current *REKUsage, kind string, count, threshold uint64) {
+	if threshold == 0 || count <= threshold || c.window.alerted[kind] {
+		return
+	}
+	c.window.alerted[kind] = true
+	current.Alerts++
+	slog.Warn("REK usage exceeds alert threshold",
+		"alert", kind,
+		"count", count,
+		"threshold", threshold,
+		"window", c.cfg.Window,
+		"rek_name", current.KeyName)
+}
+
+// usage returns the counts of the current generation.
+func (c *rekUsageCounter) usage() REKUsage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generations[len(c.generations)-1]
+}
+
+func (c *rekUsageCounter) maybePersist(now time.Time) {
+	c.mu.Lock()
+	due := now.Sub(c.persistedAt) >= rekUsagePersistInterval
+	c.mu.Unlock()
+	if !due {
+		return
+	}
+
+	if err := c.persist(); err != nil {
+		slog.Error("failed to persist rek usage", "error", err)
+	}
+}
+
+// persist writes changed counters to the usage file.
+func (c *rekUsageCounter) persist() error {
+	if c.cfg.File == "" {
+		return nil
+	}
+
+	c.persistMu.Lock()
+	defer c.persistMu.Unlock()
+
+	c.mu.Lock()
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(c.generations)
+	c.dirty = false
+	c.persistedAt = c.now()
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal rek usage: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.cfg.File), 0o700); err != nil {
+		return fmt.Errorf("failed to create rek usage directory: %w", err)
+	}
+
+	tmp := c.cfg.File + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write rek usage: %w", err)
+	}
+
+	if err := os.Rename(tmp, c.cfg.File); err != nil {
+		return fmt.Errorf("failed to rename rek usage file: %w", err)
+	}
+
+	return nil
+}
+
+// readREKUsage reads the generations from the usage file. A missing file is not an error.
+func readREKUsage(path string) ([]REKUsage, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	// #nosec G304 -- path is provided by config.
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rek usage: %w", err)
+	}
+
+	var generations []REKUsage
+	if err := json.Unmarshal(data, &generations); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal rek usage: %w", err)
+	}
+
+	return generations, nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestREKUsageCounter(t *testing.T) {
+	newCounter := func(t *testing.T, cfg *REKUsageConfig, keyName string) (*rekUsageCounter, *time.Time) {
+		c, err := newREKUsageCounter(cfg, keyName)
+		require.NoError(t, err)
+		now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		c.now = func() time.Time { return now }
+		c.window = c.newWindow(now)
+		return c, &now
+	}
+
+	t.Run("ok, counts decapsulations and failures", func(t *testing.T) {
+		c, now := newCounter(t, DefaultREKUsageConfig(), "rek-1")
+		c.decapsulated([]byte("key-1"))
+		c.decapsulated([]byte("key-2"))
+		c.failed()
+
+		usage := c.usage()
+		require.Equal(t, "rek-1", usage.KeyName)
+		require.Equal(t, uint64(2), usage.Decapsulations)
+		require.Equal(t, uint64(1), usage.Failures)
+		require.Equal(t, uint64(0), usage.Alerts)
+		require.Equal(t, *now, usage.FirstUsed)
+	})
+
+	t.Run("ok, reused encapsulated key raises a single alert per window", func(t *testing.T) {
+		c, now := newCounter(t, DefaultREKUsageConfig(), "rek-1")
+		c.decapsulated([]byte("key-1"))
+		require.Equal(t, uint64(0), c.usage().Alerts)
+
+		c.decapsulated([]byte("key-1"))
+		c.decapsulated([]byte("key-1"))
+		require.Equal(t, uint64(1), c.usage().Alerts)
+
+		// the next window starts counting from scratch.
+		*now = now.Add(time.Minute)
+		c.decapsulated([]byte("key-1"))
+		require.Equal(t, uint64(1), c.usage().Alerts)
+		c.decapsulated([]byte("key-1"))
+		require.Equal(t, uint64(2), c.usage().Alerts)
+	})
+
+	t.Run("ok, decapsulation and failure rate alerts", func(t *testing.T) {
+		c, _ := newCounter(t, &REKUsageConfig{Window: time.Minute, MaxDecapsulations: 2, MaxFailures: 1}, "rek-1")
+		c.decapsulated([]byte("key-1"))
+		c.decapsulated([]byte("key-2"))
+		c.failed()
+		require.Equal(t, uint64(0), c.usage().Alerts)
+
+		c.decapsulated([]byte("key-3"))
+		c.failed()
+		require.Equal(t, uint64(2), c.usage().Alerts)
+	})
+
+	t.Run("ok, counts survive a restart and a new rek starts a new generation", func(t *testing.T) {
+		cfg := DefaultREKUsageConfig()
+		cfg.File = filepath.Join(t.TempDir(), "rek_usage.json")
+
+		c, _ := newCounter(t, cfg, "rek-1")
+		c.decapsulated([]byte("key-1"))
+		require.NoError(t, c.persist())
+
+		c, _ = newCounter(t, cfg, "rek-1")
+		require.Equal(t, uint64(1), c.usage().Decapsulations)
+		c.failed()
+		require.NoError(t, c.persist())
+
+		c, _ = newCounter(t, cfg, "rek-2")
+		require.Equal(t, REKUsage{KeyName: "rek-2"}, c.usage())
+		require.Len(t, c.generations, 2)
+		require.Equal(t, uint64(1), c.generations[0].Failures)
+	})
+
+	t.Run("ok, old generations are dropped", func(t *testing.T) {
+		cfg := DefaultREKUsageConfig()
+		cfg.File = filepath.Join(t.TempDir(), "rek_usage.json")
+
+		for i := range maxREKGenerations + 2 {
+			c, _ := newCounter(t, cfg, "rek-"+string(rune('a'+i)))
+			c.decapsulated([]byte("key"))
+			require.NoError(t, c.persist())
+		}
+
+		generations, err := readREKUsage(cfg.File)
+		require.NoError(t, err)
+		require.Len(t, generations, maxREKGenerations)
+		require.Equal(t, "rek-c", generations[0].KeyName)
+	})
+
+	t.Run("fail, corrupt usage file", func(t *testing.T) {
+		cfg := DefaultREKUsageConfig()
+		cfg.File = filepath.Join(t.TempDir(), "rek_usage.json")
+		require.NoError(t, os.WriteFile(cfg.File, []byte("not json"), 0o600))
+
+		_, err := newREKUsageCounter(cfg, "rek-1")
+		require.Error(t, err)
+	})
+
+	t.Run("fail, invalid window", func(t *testing.T) {
+		_, err := newREKUsageCounter(&REKUsageConfig{}, "rek-1")
+		require.Error(t, err)
+	})
+}
@@ -20,6 +20,7 @@ package routercom
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -35,31 +36,103 @@ import (
 	"github.com/confidentsecurity/confidentcompute/cmd/compute_worker/exitcodes"
 	"github.com/confidentsecurity/confidentcompute/computeworker"
 	"github.com/confidentsecurity/confidentcompute/computeworker/output"
+	"github.com/confidentsecurity/confidentcompute/debug"
+	"github.com/confidentsecurity/confidentcompute/faultinject"
 	"github.com/openpcc/openpcc/ahttp"
 	"github.com/openpcc/openpcc/httpfmt"
 	"github.com/openpcc/openpcc/messages"
 	"github.com/openpcc/openpcc/otel/otelutil"
 	"github.com/openpcc/openpcc/router/api"
+	"github.com/openpcc/openpcc/uuidv7"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/propagation"
 	"google.golang.org/protobuf/proto"
 )
 
+// ResponseAbortedTrailer is set to "true" when the LLM failed mid-stream and the response is incomplete.
+// The refund trailer then covers everything but the delivered output tokens.
+const ResponseAbortedTrailer = "X-Confsec-Node-Response-Aborted"
+
+// ResponseResumableAtTrailer is set to the number of delivered output tokens when the response was
+// ended early to migrate the request to another node. The encrypted response carries a continuation
+// the client can replay against another node, see computeworker.Continuation.
+const ResponseResumableAtTrailer = "X-Confsec-Node-Response-Resumable-At"
+
+// ResponseErrorDetailTrailer is set to "true" when the worker failed to handle the request and the
+// encrypted response describes the failure instead, see computeworker.ErrorDetailHeader. The detail
+// itself is only readable by the client.
+const ResponseErrorDetailTrailer = "X-Confsec-Node-Response-Error-Detail"
+
+// ResponseRefundSignatureTrailer is set to the base64 encoded signature of the refund by the
+// refund key of the node, when refunds are signed. See computeworker.VerifyRefundSignature.
+const ResponseRefundSignatureTrailer = "X-Confsec-Node-Refund-Signature"
+
+// ResponseRefundUnsignedTrailer is set to true when the node signs refunds but failed to sign the
+// refund of the response, so the router can tell a failed signature from a node that doesn't sign
+// refunds.
+const ResponseRefundUnsignedTrailer = "X-Confsec-Node-Refund-Unsigned"
+
+// ResponseOutputHeaderTrailer, ResponseOutputFooterTrailer and ResponseOutputTagTrailer are set to
+// the base64 encoded header and footer chunks of the worker output and the tag of the footer. The MAC
+// key of the output is exported from the HPKE context of the request, so only the client can verify
+// the response body with them, see wire.VerifyTranscript. The tag covers the body as a byte stream,
+// the chunks of the worker output are not forwarded.
+const (
+	ResponseOutputHeaderTrailer = "X-Confsec-Node-Output-Header"
+	ResponseOutputFooterTrailer = "X-Confsec-Node-Output-Footer"
+	ResponseOutputTagTrailer    = "X-Confsec-Node-Output-Tag"
+)
+
 func (s *Service) generateHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, span := otelutil.Tracer.Start(r.Context(), "routercom.generateHandler")
 	defer span.End()
 
 	r = r.WithContext(ctx)
 
+	if s.maintenance != nil {
+		slog.InfoContext(ctx, "rejecting request, node is in maintenance mode")
+		httpfmt.BinaryServiceUnavailable(w, r, "node is in maintenance mode")
+		return
+	}
+
+	if s.state.isDraining() {
+		slog.InfoContext(ctx, "rejecting request, node is draining")
+		httpfmt.BinaryServiceUnavailable(w, r, "node is draining")
+		return
+	}
+
+	// the confsec request ID correlates the logs, traces and refund of a request on this node.
+	nodeRequestID, err := uuidv7.New()
+	if err != nil {
+		otelutil.RecordError2(span, fmt.Errorf("failed to generate node request id: %w", err))
+		httpfmt.BinaryServerError(w, r)
+		return
+	}
+	ctx = debug.WithRequestID(ctx, nodeRequestID.String())
+	span.SetAttributes(attribute.String("confsec.node_request_id", nodeRequestID.String()))
+	r = r.WithContext(ctx)
+
 	requestParams, err := s.requestParams(r)
 	if err != nil {
+		// requestParams errors contain no client data, so they are safe to count by message.
+		s.state.validationError(err.Error())
 		otelutil.RecordError2(span, fmt.Errorf("failed to parse request params: %w", err))
 		httpfmt.BinaryBadRequest(w, r, err.Error())
 		return
 	}
 
-	stdout, closeFunc, err := s.runWorker(ctx, r.Body, requestParams)
+	span.SetAttributes(attribute.Int64(computeworker.BudgetCreditsGrantedAttr, computeworker.BudgetBucket(requestParams.CreditAmount)))
+
+	requestParams.NodeRequestID = nodeRequestID.String()
+	requestParams.RouterRequestID = requestID(r)
+	requestParams.LLMBaseURL = s.pickBackend(r.Header.Get(computeworker.SessionHintHeader))
+
+	ctx, endResponse := withResponseEnd(ctx)
+	s.state.requestQueued()
+	stdout, closeFunc, err := s.runRequest(ctx, r.Body, requestParams)
+	s.state.requestDequeued()
 	if err != nil {
 		slog.ErrorContext(ctx, "failed to run worker", "error", err)
 		otelutil.RecordError2(span, fmt.Errorf("failed to run worker: %w", err))
@@ -73,7 +146,9 @@ func (s *Service) generateHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	_, decoderSpan := otelutil.Tracer.Start(ctx, "routercom.generateHandler.newDecoder")
-	decoder, err := output.NewDecoder(stdout)
+	// the decoder detects reordered, duplicated or dropped chunks between the worker stdout and the
+	// response, the client verifies the tags, see ResponseOutputTagTrailer.
+	decoder, err := output.NewForwardingDecoder(stdout)
 	if err != nil {
 		slog.ErrorContext(ctx, "failed to create output decoder", "error", err)
 		otelutil.RecordError2(span, fmt.Errorf("failed to create output decoder: %w", err))
@@ -84,6 +159,11 @@ func (s *Service) generateHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	decoderSpan.End()
 
+	// the worker only writes its output after the request was decapsulated.
+	if s.rekUsage != nil {
+		s.rekUsage.decapsulated(requestParams.EncapsulatedKey)
+	}
+
 	defer func(ctx context.Context) {
 		// We'll do clean up in a separate goroutine so the handler can return
 		// once it has read everything it needs from stdout.
@@ -95,9 +175,21 @@ func (s *Service) generateHandler(w http.ResponseWriter, r *http.Request) {
 	}(ctx)
 
 	header := decoder.Header()
-
-	// We're writing an encrypted response. Always attempt to add the refund trailer.
-	w.Header().Add("Trailer", ahttp.NodeRefundAmountHeader)
+	id := requestID(r)
+
+	// We're writing an encrypted response. Always attempt to add the refund trailer,
+	// unless the refund is delivered with a callback instead.
+	if s.refundTrailerEnabled(id) {
+		w.Header().Add("Trailer", ahttp.NodeRefundAmountHeader)
+		w.Header().Add("Trailer", ResponseRefundSignatureTrailer)
+		w.Header().Add("Trailer", ResponseRefundUnsignedTrailer)
+	}
+	w.Header().Add("Trailer", ResponseAbortedTrailer)
+	w.Header().Add("Trailer", ResponseResumableAtTrailer)
+	w.Header().Add("Trailer", ResponseErrorDetailTrailer)
+	w.Header().Add("Trailer", ResponseOutputHeaderTrailer)
+	w.Header().Add("Trailer", ResponseOutputFooterTrailer)
+	w.Header().Add("Trailer", ResponseOutputTagTrailer)
 	w.Header().Set("Content-Type", header.MediaType)
 
 	ctx, copyBodySpan := otelutil.Tracer.Start(ctx, "routercom.generateHandler.copyBody")
@@ -105,7 +197,29 @@ func (s *Service) generateHandler(w http.ResponseWriter, r *http.Request) {
 		// should already be implied since we're setting a trailer header, but just to be sure.
 		w.Header().Set("Transfer-Encoding", "chunked")
 	}
-	_, err = decoder.WriteTo(w)
+	var dst io.Writer = w
+	if s.config.SlowClient != nil {
+		dst = newSlowClientWriter(w, s.config.SlowClient)
+	}
+	decoder.SetProgress(func(chunks int, _ int64) {
+		if chunks == 1 {
+			copyBodySpan.AddEvent("response.first_chunk")
+		}
+	})
+	written, err := decoder.WriteToContext(ctx, dst)
+	decoder.SetProgress(nil)
+	if errors.Is(err, context.Canceled) {
+		// the client disconnected, cancelling ctx also terminates the worker.
+		copyBodySpan.End()
+		slog.InfoContext(ctx, "Client disconnected, stopped writing response body", "written", written)
+		span.AddEvent("client.disconnected")
+		return
+	}
+	if errors.Is(err, errSlowClient) || errors.Is(err, os.ErrDeadlineExceeded) {
+		copyBodySpan.End()
+		s.abortSlowClient(ctx, w, decoder, id, &requestParams, endResponse, err)
+		return
+	}
 	if err != nil {
 		copyBodySpan.End()
 		slog.ErrorContext(ctx, "failed to write response body", "error", err)
@@ -114,11 +228,33 @@ func (s *Service) generateHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	copyBodySpan.End()
 
-	s.handleRefundTrailer(ctx, w, decoder)
+	s.handleRefundTrailer(ctx, w, decoder, id, &requestParams)
 
 	span.SetStatus(codes.Ok, "")
 }
 
+// abortSlowClient ends the response of a client that reads too slowly. The worker ends its response
+// at the next token and refunds the output it didn't generate. The worker can't tell what reached the
+// client, so the output it generated but that is discarded here is still charged.
+func (s *Service) abortSlowClient(ctx context.Context, w http.ResponseWriter, decoder *output.Decoder, id string, p *computeworker.RequestParams, endResponse func(), cause error) {
+	ctx, span := otelutil.Tracer.Start(ctx, "routercom.abortSlowClient")
+	defer span.End()
+
+	slog.WarnContext(ctx, "Ending response of slow client", "error", cause)
+	span.AddEvent("client.slow")
+	s.state.slowClientAborted()
+	endResponse()
+
+	if _, err := decoder.WriteTo(io.Discard); err != nil {
+		otelutil.RecordError2(span, fmt.Errorf("failed to discard response body: %w", err))
+		return
+	}
+
+	// the trailer likely can't reach the client anymore, a refund callback still reaches the router.
+	s.handleRefundTrailer(ctx, w, decoder, id, p)
+	span.SetStatus(codes.Ok, "")
+}
+
 // requestParams extracts the compute worker request parameters from the request and returns
 // an error if these are invalid. The error is safe to return to the user and contains no technical
 // information.
@@ -159,7 +295,9 @@ func (*Service) requestParams(r *http.Request) (computeworker.RequestParams, err
 
 type closeFunc func(ctx context.Context) int
 
-func (s *Service) runWorker(ctx context.Context, ciphertext io.ReadCloser, p computeworker.RequestParams) (io.Reader, closeFunc, error) {
+// runWorker starts a compute_worker for the request with params p. A nil p starts a session
+// worker instead, that reads its requests from ciphertext, see runSessionRequest.
+func (s *Service) runWorker(ctx context.Context, ciphertext io.ReadCloser, p *computeworker.RequestParams) (io.Reader, closeFunc, error) {
 	ctx, span := otelutil.Tracer.Start(ctx, "routercom.runWorker")
 	defer span.End()
 
@@ -175,9 +313,20 @@ func (s *Service) runWorker(ctx context.Context, ciphertext io.ReadCloser, p com
 		"-tpm_base64_pcr_values", s.base64PCRValues,
 		"-tpm_simulator_cmd_addr", s.config.TPM.SimulatorCmdAddress,
 		"-tpm_simulator_platform_addr", s.config.TPM.SimulatorPlatformAddress,
-		"-request_media_type", p.MediaType,
-		"-request_credit_amount", strconv.FormatInt(p.CreditAmount, 10),
-		"-request_encapsulated_key", base64.StdEncoding.EncodeToString(p.EncapsulatedKey),
+	}
+	if p != nil {
+		args = append(args,
+			"-request_media_type", p.MediaType,
+			"-request_credit_amount", strconv.FormatInt(p.CreditAmount, 10),
+			"-request_encapsulated_key", base64.StdEncoding.EncodeToString(p.EncapsulatedKey),
+			"-node_request_id", p.NodeRequestID,
+		)
+		// refund signatures and credit grants are bound to the router request id.
+		if p.RouterRequestID != "" {
+			args = append(args, "-router_request_id", p.RouterRequestID)
+		}
+	} else {
+		args = append(args, "-session")
 	}
 	if s.config.TPM.Device != "" {
 		args = append(args, "-tpm_device", s.config.TPM.Device)
@@ -187,7 +336,29 @@ func (s *Service) runWorker(ctx context.Context, ciphertext io.ReadCloser, p com
 		args = append(args, "-tpm_simulate")
 	}
 
-	if s.config.Worker.LLMBaseURL != "" {
+	if s.config.TPM.RefundKeyHandle != 0 {
+		args = append(args, "-tpm_refund_key_handle", strconv.FormatUint(uint64(s.config.TPM.RefundKeyHandle), 10))
+	}
+
+	if s.tpmBroker != nil {
+		args = append(args, "-tpm_broker_socket", s.config.TPMBroker.Socket)
+	}
+
+	if s.badgeLimiter != nil {
+		args = append(args, "-badge_limit_socket", s.config.BadgeLimit.Socket)
+	}
+
+	if s.modelWaker != nil {
+		args = append(args, "-model_wake_socket", s.config.ModelWake.Socket)
+	}
+
+	if s.config.TPMBroker != nil && s.config.TPMBroker.OpTimeout != 0 {
+		args = append(args, "-tpm_op_timeout", s.config.TPMBroker.OpTimeout.String())
+	}
+
+	if p != nil && p.LLMBaseURL != "" {
+		args = append(args, "-llm_base_url", p.LLMBaseURL)
+	} else if s.config.Worker.LLMBaseURL != "" {
 		args = append(args, "-llm_base_url", s.config.Worker.LLMBaseURL)
 	}
 
@@ -199,8 +370,146 @@ func (s *Service) runWorker(ctx context.Context, ciphertext io.ReadCloser, p com
 		args = append(args, "-badge_public_key", s.config.Worker.BadgePublicKey)
 	}
 
-	for _, model := range s.config.Worker.Models {
-		args = append(args, "-model", model)
+	args = append(args, s.policyWorkerArgs()...)
+
+	for _, rule := range s.config.Worker.AuditBodyRules {
+		args = append(args, "-audit_body_rule", rule)
+	}
+
+	for _, name := range s.config.Worker.BodyMutators {
+		args = append(args, "-body_mutator", name)
+	}
+
+	for _, hostname := range s.config.Worker.AllowedHostnames {
+		args = append(args, "-allowed_hostname", hostname)
+	}
+
+	for _, contentType := range s.config.Worker.ResponseContentTypes {
+		args = append(args, "-response_content_type", contentType)
+	}
+
+	for _, prefix := range s.config.Worker.EgressDeny {
+		args = append(args, "-egress_deny", prefix)
+	}
+
+	if s.config.Worker.EgressPrivateOnly {
+		args = append(args, "-egress_private_only")
+	}
+
+	for _, pin := range s.config.Worker.BackendResolve {
+		args = append(args, "-backend_resolve", pin)
+	}
+
+	if s.config.Worker.Pacing != nil && s.config.Worker.Pacing.Interval > 0 {
+		args = append(args,
+			"-pacing_interval", s.config.Worker.Pacing.Interval.String(),
+			"-pacing_jitter", s.config.Worker.Pacing.Jitter.String(),
+			"-pacing_max_delay", s.config.Worker.Pacing.MaxDelay.String(),
+		)
+	}
+
+	if s.paddingEnabled() {
+		args = append(args,
+			"-padding_mode", s.config.Worker.Padding.Mode,
+			"-padding_step", strconv.FormatInt(s.config.Worker.Padding.Step, 10),
+			"-padding_max", strconv.FormatInt(s.config.Worker.Padding.MaxPadding, 10),
+		)
+	}
+
+	if s.continuationKey != "" {
+		args = append(args,
+			"-continuation_ttl", s.config.Worker.Continuation.TTL.String(),
+			"-continuation_input_discount", strconv.FormatFloat(s.config.Worker.Continuation.InputDiscount, 'g', -1, 64),
+		)
+	}
+
+	if s.nonces != nil {
+		args = append(args, "-nonce_socket", s.config.Worker.NonceSocket)
+	}
+
+	if s.config.Worker.HardenedJSON {
+		args = append(args, "-hardened_json")
+	}
+
+	if s.outputFilterDigest != "" {
+		args = append(args, "-output_filter", s.config.Worker.OutputFilter, "-output_filter_digest", s.outputFilterDigest)
+	}
+
+	for _, route := range s.experimentalRoutes {
+		args = append(args, "-experimental_route", route)
+	}
+
+	if s.config.Worker.EchoNodeRequestID {
+		args = append(args, "-echo_node_request_id")
+	}
+
+	if s.config.Worker.SimulatedSeed != 0 {
+		args = append(args, "-simulated_seed", strconv.FormatUint(s.config.Worker.SimulatedSeed, 10))
+	}
+
+	if s.config.Worker.Pricing != nil && len(s.config.Worker.Pricing.Routes) > 0 {
+		pricing, err := json.Marshal(s.config.Worker.Pricing)
+		if err != nil {
+			return nil, nil, otelutil.Errorf(span, "failed to marshal pricing config: %w", err)
+		}
+		args = append(args, "-pricing", string(pricing))
+	}
+
+	if s.backendPool != nil {
+		args = append(args, "-backend_pool_socket", s.config.Worker.ModelBackends.Socket)
+	}
+
+	if s.mirrorBaseURL != "" {
+		args = append(args, "-mirror_llm_base_url", s.mirrorBaseURL)
+		if s.config.Worker.Mirror.Timeout != 0 {
+			args = append(args, "-mirror_timeout", s.config.Worker.Mirror.Timeout.String())
+		}
+	}
+
+	if s.config.FaultInjection != nil && len(s.config.FaultInjection.Faults) > 0 {
+		faults, err := json.Marshal(s.config.FaultInjection)
+		if err != nil {
+			return nil, nil, otelutil.Errorf(span, "failed to marshal fault injection config: %w", err)
+		}
+		args = append(args, "-fault_injection", string(faults))
+	}
+
+	// only workers that serve a single request can receive credit grants, the router addresses them by
+	// the encapsulated key of the request.
+	var grantReader, grantWriter *os.File
+	if p != nil && s.creditGrants != nil && len(p.EncapsulatedKey) > 0 {
+		grantReader, grantWriter, err = os.Pipe()
+		if err != nil {
+			return nil, nil, otelutil.Errorf(span, "failed to create credit grant pipe: %w", err)
+		}
+		if s.creditGrants.register(p.EncapsulatedKey, grantWriter) {
+			// the read end is the first extra file, fd 3 in the worker.
+			args = append(args,
+				"-max_top_up_credits", strconv.FormatInt(s.config.Worker.MaxTopUpCredits, 10),
+				"-credit_grant_fd", "3",
+			)
+		} else {
+			slog.WarnContext(ctx, "Encapsulated key is already running, request can't receive credit grants")
+			if err := errors.Join(grantReader.Close(), grantWriter.Close()); err != nil {
+				slog.WarnContext(ctx, "failed to close credit grant pipe", "error", err)
+			}
+			grantReader, grantWriter = nil, nil
+		}
+	}
+	closeGrantReader := func(ctx context.Context) {
+		if grantReader == nil {
+			return
+		}
+		if err := grantReader.Close(); err != nil {
+			slog.WarnContext(ctx, "failed to close credit grant pipe", "error", err)
+		}
+		grantReader = nil
+	}
+	closeGrantPipe := func(ctx context.Context) {
+		closeGrantReader(ctx)
+		if grantWriter != nil {
+			s.creditGrants.unregister(p.EncapsulatedKey, grantWriter)
+		}
 	}
 
 	// Pass trace context to worker.
@@ -226,21 +535,118 @@ func (s *Service) runWorker(ctx context.Context, ciphertext io.ReadCloser, p com
 		}
 		return nil
 	}
+	var cgroup *workerCgroup
+	if s.config.Worker.Cgroup != nil {
+		name := fmt.Sprintf("worker-%d-%d", os.Getpid(), s.workerSeq.Add(1))
+		cgroup, err = newWorkerCgroup(s.config.Worker.Cgroup, name)
+		if err != nil {
+			closeGrantPipe(ctx)
+			return nil, nil, otelutil.Errorf(span, "failed to create worker cgroup: %w", err)
+		}
+		cmd.SysProcAttr, err = cgroup.sysProcAttr()
+		if err != nil {
+			closeGrantPipe(ctx)
+			return nil, nil, errors.Join(otelutil.Errorf(span, "failed to place worker in cgroup: %w", err), cgroup.Close())
+		}
+	}
+	closeCgroup := func(ctx context.Context) {
+		if cgroup == nil {
+			return
+		}
+		if err := cgroup.Close(); err != nil {
+			slog.ErrorContext(ctx, "failed to remove worker cgroup", "error", err)
+		}
+	}
+
+	cmd.Env = os.Environ()
+	// propagate a runtime log level override, GO_LOG is read by the compute_worker at startup.
+	if level, ok := debug.Level(); ok {
+		cmd.Env = append(cmd.Env, "GO_LOG="+level.String())
+	}
+	if s.llmAuthorization != "" {
+		cmd.Env = append(cmd.Env, computeworker.LLMAuthorizationEnv+"="+s.llmAuthorization)
+	}
+	if s.promptCacheKey != "" {
+		cmd.Env = append(cmd.Env, computeworker.PromptCacheKeyEnv+"="+s.promptCacheKey)
+	}
+	if s.sessionHintKey != "" {
+		cmd.Env = append(cmd.Env, computeworker.SessionHintKeyEnv+"="+s.sessionHintKey)
+	}
+	if s.continuationKey != "" {
+		cmd.Env = append(cmd.Env, computeworker.ContinuationKeyEnv+"="+s.continuationKey)
+	}
 	cmd.Stdin = ciphertext
-	cmd.Stderr = os.Stderr
+	if grantReader != nil {
+		cmd.ExtraFiles = []*os.File{grantReader}
+	}
 	// Explicitly set wait delay to 0 (no timeout), so the above I/O pipes are not closed during Wait calls.
 	// This should be the default value, but it never hurts to be explicit.
 	cmd.WaitDelay = 0 * time.Second
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
+		closeCgroup(ctx)
+		closeGrantPipe(ctx)
 		return nil, nil, otelutil.Errorf(span, "failed to get stdout pipe: %w", err)
 	}
 
+	// the worker logs are forwarded through our own logger, so they are redacted and carry the
+	// trace of the request, instead of being mixed into our stderr as is.
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		closeCgroup(ctx)
+		closeGrantPipe(ctx)
+		return nil, nil, otelutil.Errorf(span, "failed to get stderr pipe: %w", err)
+	}
+
 	slog.DebugContext(ctx, "Starting the compute worker process")
+	if err := faultinject.Inject(ctx, faultinject.WorkerSpawn); err != nil {
+		closeCgroup(ctx)
+		closeGrantPipe(ctx)
+		return nil, nil, otelutil.Errorf(span, "failed to start command: %w", err)
+	}
 	if err := cmd.Start(); err != nil {
+		closeCgroup(ctx)
+		closeGrantPipe(ctx)
 		return nil, nil, otelutil.Errorf(span, "failed to start command: %w", err)
 	}
+	s.state.workerStarted(cmd.Process.Pid)
+	// the worker holds its own copy of the read end.
+	closeGrantReader(ctx)
+
+	logsForwarded := make(chan struct{})
+	go func() {
+		defer close(logsForwarded)
+		logger := slog.Default()
+		if s.startupLatency != nil {
+			logger = slog.New(&startupLatencyHandler{inner: logger.Handler(), tracker: s.startupLatency})
+		}
+		if s.promptSize != nil {
+			logger = slog.New(&promptSizeHandler{inner: logger.Handler(), tracker: s.promptSize})
+		}
+		logger = logger.With("worker_pid", cmd.Process.Pid)
+		if err := debug.ForwardLogs(ctx, stderr, logger); err != nil {
+			slog.WarnContext(ctx, "failed to forward compute worker logs", "error", err)
+			// keep draining, the worker blocks on a full stderr pipe.
+			_, _ = io.Copy(io.Discard, stderr)
+		}
+	}()
+
+	// ask the worker to migrate its request once the node starts shutting down, or to end its response
+	// early for a slow client. Signal is safe to call after the process was waited for, it then fails
+	// without signaling another process.
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-s.migrating:
+		case <-responseEnd(ctx):
+		case <-exited:
+			return
+		}
+		if err := cmd.Process.Signal(computeworker.MigrationSignal); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			slog.WarnContext(ctx, "failed to signal compute worker to migrate", "error", err)
+		}
+	}()
 
 	// Return a closer function so the caller can control the duration of the process.
 	closeFunc := func(ctx context.Context) int {
@@ -248,7 +654,11 @@ func (s *Service) runWorker(ctx context.Context, ciphertext io.ReadCloser, p com
 		defer span.End()
 
 		slog.InfoContext(ctx, "Waiting for compute worker to exit", "pid", cmd.Process.Pid)
+		// all reads from stderr must be done before waiting, Wait closes the pipe.
+		<-logsForwarded
 		err = cmd.Wait()
+		close(exited)
+		closeGrantPipe(ctx)
 		if err != nil {
 			// If err is due to context cancel, then we don't need to log an error.
 			if !errors.Is(err, context.Canceled) {
@@ -257,7 +667,20 @@ func (s *Service) runWorker(ctx context.Context, ciphertext io.ReadCloser, p com
 		}
 		// If cmd.Wait has returned, we know the process has exited, so we don't need to kill it.
 
+		if cgroup != nil {
+			if oomKilled, err := cgroup.oomKilled(); err != nil {
+				slog.WarnContext(ctx, "failed to check worker cgroup for oom kills", "error", err)
+			} else if oomKilled {
+				slog.WarnContext(ctx, "Compute worker exceeded its memory limit and was killed", "pid", cmd.Process.Pid)
+			}
+			closeCgroup(ctx)
+		}
+
 		slog.InfoContext(ctx, "Compute worker exited", "pid", cmd.Process.Pid, "exit_code", cmd.ProcessState.ExitCode())
+		s.state.workerExited(cmd.Process.Pid, cmd.ProcessState.ExitCode())
+		if s.rekUsage != nil && cmd.ProcessState.ExitCode() == exitcodes.RequestDecapsulationCode {
+			s.rekUsage.failed()
+		}
 
 		span.SetStatus(codes.Ok, "")
 		return cmd.ProcessState.ExitCode()
@@ -271,12 +694,27 @@ func writeResponseForExitCode(w http.ResponseWriter, r *http.Request, exitCode i
 	switch exitCode {
 	case exitcodes.RequestDecapsulationCode:
 		httpfmt.BinaryBadRequest(w, r, "failed to decapsulate encrypted request")
+	case exitcodes.TPMUnavailableCode:
+		httpfmt.BinaryServiceUnavailable(w, r, "tpm unavailable")
 	default:
 		httpfmt.BinaryServerError(w, r)
 	}
 }
 
-func (*Service) handleRefundTrailer(ctx context.Context, w http.ResponseWriter, decoder *output.Decoder) {
+// refundTrailerEnabled reports whether the refund of the request with the given ID is delivered
+// in the response trailer.
+func (s *Service) refundTrailerEnabled(id string) bool {
+	return s.refunds == nil || !s.refunds.cfg.DisableTrailer || id == ""
+}
+
+// paddingEnabled reports whether responses are padded to size buckets.
+func (s *Service) paddingEnabled() bool {
+	return s.config.Worker.Padding != nil && s.config.Worker.Padding.Mode != ""
+}
+
+// handleRefundTrailer sets the trailers from the worker output footer. When refund callbacks are
+// enabled, the refund is also reported to the router keyed by the request ID.
+func (s *Service) handleRefundTrailer(ctx context.Context, w http.ResponseWriter, decoder *output.Decoder, id string, p *computeworker.RequestParams) {
 	ctx, span := otelutil.Tracer.Start(ctx, "routercom.handleRefundTrailer")
 	defer span.End()
 
@@ -286,9 +724,40 @@ func (*Service) handleRefundTrailer(ctx context.Context, w http.ResponseWriter,
 		return
 	}
 
+	if rawHeader, rawFooter, tag, ok := decoder.Transcript(); ok {
+		w.Header().Set(ResponseOutputHeaderTrailer, base64.StdEncoding.EncodeToString(rawHeader))
+		w.Header().Set(ResponseOutputFooterTrailer, base64.StdEncoding.EncodeToString(rawFooter))
+		w.Header().Set(ResponseOutputTagTrailer, base64.StdEncoding.EncodeToString(tag))
+	}
+
+	if footer.Aborted {
+		slog.WarnContext(ctx, "compute worker response was aborted mid-stream")
+		w.Header().Set(ResponseAbortedTrailer, "true")
+	}
+
+	if footer.ErrorDetail {
+		slog.WarnContext(ctx, "compute worker failed and reported the failure to the client")
+		s.state.errorDetailReported()
+		w.Header().Set(ResponseErrorDetailTrailer, "true")
+	}
+
+	if footer.Migrated {
+		slog.InfoContext(ctx, "compute worker response was migrated", "resumable_at", footer.ResumableAt)
+		w.Header().Set(ResponseResumableAtTrailer, strconv.FormatUint(footer.ResumableAt, 10))
+	}
+
 	if !footer.HasRefund() {
+		s.recordModelSpend(ctx, footer.Model, p.CreditAmount, nil)
 		return
 	}
+	s.recordModelSpend(ctx, footer.Model, p.CreditAmount, footer.Refund)
+
+	attrs, err := computeworker.RefundAttributes(p.CreditAmount, *footer.Refund)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to record refund in trace", "error", err)
+	} else {
+		span.SetAttributes(attrs...)
+	}
 
 	currencyProto, err := footer.Refund.MarshalProto()
 	if err != nil {
@@ -301,5 +770,28 @@ func (*Service) handleRefundTrailer(ctx context.Context, w http.ResponseWriter,
 		return
 	}
 
-	w.Header().Set(ahttp.NodeRefundAmountHeader, base64.StdEncoding.EncodeToString(b))
+	if s.refunds != nil && id != "" {
+		err := s.refunds.Report(ctx, RefundReport{
+			RequestID:       id,
+			NodeRequestID:   p.NodeRequestID,
+			Refund:          b,
+			RefundSignature: footer.RefundSignature,
+			RefundUnsigned:  footer.RefundUnsigned,
+			Aborted:         footer.Aborted,
+			IssuedAt:        time.Now(),
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to report refund to router", "error", err)
+		}
+	}
+
+	if s.refundTrailerEnabled(id) {
+		w.Header().Set(ahttp.NodeRefundAmountHeader, base64.StdEncoding.EncodeToString(b))
+		if len(footer.RefundSignature) > 0 {
+			w.Header().Set(ResponseRefundSignatureTrailer, base64.StdEncoding.EncodeToString(footer.RefundSignature))
+		}
+		if footer.RefundUnsigned {
+			w.Header().Set(ResponseRefundUnsignedTrailer, "true")
+		}
+	}
 }
@@ -18,17 +18,31 @@
 package routercom
 
 import (
-	"crypto/x509"
+	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"os"
+	"net/url"
+	"slices"
+	"strings"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
 
+	"github.com/confidentsecurity/confidentcompute/backendpool"
+	"github.com/confidentsecurity/confidentcompute/badgelimit"
+	"github.com/confidentsecurity/confidentcompute/computeworker"
+	"github.com/confidentsecurity/confidentcompute/experimental"
+	"github.com/confidentsecurity/confidentcompute/modelwake"
+	"github.com/confidentsecurity/confidentcompute/nonceledger"
+	"github.com/confidentsecurity/confidentcompute/routercom/capabilities"
+	"github.com/confidentsecurity/confidentcompute/routercom/evidence"
+	"github.com/confidentsecurity/confidentcompute/routercom/modelstate"
+	"github.com/confidentsecurity/confidentcompute/sealedconfig"
+	"github.com/confidentsecurity/confidentcompute/tpmbroker"
 	"github.com/google/go-tpm/tpm2"
 	ev "github.com/openpcc/openpcc/attestation/evidence"
 	"github.com/openpcc/openpcc/otel/otelutil"
@@ -39,6 +53,70 @@ type Service struct {
 	config   *Config
 	handler  http.Handler
 	evidence ev.SignedEvidenceList
+	state    *serviceState
+	// policyRootKey verifies policy bundles, nil when policy bundles are disabled.
+	policyRootKey ed25519.PublicKey
+	// policyMu serializes applying and persisting policy bundles.
+	policyMu sync.Mutex
+	// llmAuthorization is the Authorization header compute_worker sends to the LLM, empty when not configured.
+	llmAuthorization string
+	// workerSeq numbers the compute_worker processes, used to name their cgroups.
+	workerSeq atomic.Uint64
+	// tpmBroker serializes TPM access of the compute_worker processes, nil when disabled.
+	tpmBroker *tpmbroker.Broker
+	// badgeLimiter bounds the parallel requests of badges, nil when disabled.
+	badgeLimiter *badgelimit.Limiter
+	// nonces makes continuation tokens and credit grants single use, nil when both are disabled.
+	nonces *nonceledger.Ledger
+	// modelWaker wakes sleeping models up for requests, nil when disabled.
+	modelWaker *modelwake.Waker
+	// backendPool picks the backend replicas of models for requests, nil when disabled.
+	backendPool *backendpool.Pool
+	// migrating is closed when in-flight requests should be migrated to other nodes, see MigrateRequests.
+	migrating     chan struct{}
+	migratingOnce sync.Once
+	// shutdownRequested is closed when router_com should shut down gracefully, see ShutdownRequested.
+	shutdownRequested chan struct{}
+	shutdownOnce      sync.Once
+	// expiry drains and shuts down the node before its evidence expires.
+	expiry *expiryManager
+	// refunds delivers refunds to the router with a callback, nil when refund callbacks are disabled.
+	refunds *refundReporter
+	// rekUsage counts the requests decapsulated with the REK, nil when counting is disabled.
+	rekUsage *rekUsageCounter
+	// sessions holds the idle session workers, nil when worker sessions are disabled.
+	sessions *sessionPool
+	// promptCacheKey derives the prefix cache salts of requests, empty when prompt caching is disabled.
+	promptCacheKey string
+	// sessionHintKey derives the session hints of responses, empty when session hints are disabled.
+	sessionHintKey string
+	// continuationKey signs the continuation tokens of responses, empty when continuations are disabled.
+	continuationKey string
+	// backendSeq spreads requests without a session hint over the LLM backends.
+	backendSeq atomic.Uint64
+	// cpuOnly is true when the evidence marks the node as serving inference without GPUs.
+	cpuOnly bool
+	// gpuDegraded is the GPU degraded claim from the evidence, nil when the GPUs were attested or the
+	// node has none. A degraded node only advertises the models that run without GPUs.
+	gpuDegraded *evidence.GPUDegraded
+	// maintenance is the maintenance claim from the evidence, nil when the node is not in maintenance mode.
+	maintenance *evidence.Maintenance
+	// outputFilterDigest is the output filter digest from the evidence, empty when the output is not filtered.
+	outputFilterDigest string
+	// experimentalRoutes are the experimental routes the evidence discloses, nil on stable nodes.
+	experimentalRoutes []string
+	// mirrorBaseURL is the shadow backend url from the evidence, empty when requests are not mirrored.
+	mirrorBaseURL string
+	// creditGrants passes credit grants on to running workers, nil when top-ups are disabled.
+	creditGrants *creditGrantPipes
+	// startupLatency aggregates the startup latency of the workers, nil when disabled.
+	startupLatency *startupLatencyTracker
+	// modelSpend aggregates the credits of the requests per model, nil when disabled.
+	modelSpend *modelSpendTracker
+	// promptSize aggregates the prompt sizes of the workers, nil when disabled.
+	promptSize *promptSizeTracker
+	// recentMetrics samples the load of the service for support bundles.
+	recentMetrics *recentMetrics
 
 	commandsWG       *sync.WaitGroup
 	base64PubKey     string
@@ -46,24 +124,50 @@ type Service struct {
 	base64PCRValues  string
 }
 
-func New(cfg *Config, evidence ev.SignedEvidenceList) (*Service, error) {
+func New(cfg *Config, evidenceList ev.SignedEvidenceList) (*Service, error) {
+	// the evidence comes in over a local socket, don't take it at face value.
+	verifyOpts := evidence.VerifyOptions{Now: time.Now()}
+	if cfg.EvidenceRoots != "" {
+		roots, err := evidence.LoadRoots(cfg.EvidenceRoots)
+		if err != nil {
+			return nil, err
+		}
+		verifyOpts.Roots = roots
+	}
+	if err := evidence.Verify(evidenceList, verifyOpts); err != nil {
+		return nil, fmt.Errorf("invalid evidence: %w", err)
+	}
+
 	s := &Service{
-		config:     cfg,
-		evidence:   evidence,
-		commandsWG: &sync.WaitGroup{},
+		config:            cfg,
+		evidence:          evidenceList,
+		state:             newServiceState(),
+		commandsWG:        &sync.WaitGroup{},
+		migrating:         make(chan struct{}),
+		shutdownRequested: make(chan struct{}),
 	}
 
 	// extract data required by the compute worker from the evidence.
+	gpuEvidence := false
 	for _, item := range s.evidence {
 		switch item.Type { //nolint:exhaustive
+		case ev.NvidiaETA, ev.NvidiaSwitchETA:
+			gpuEvidence = true
+			continue
 		case ev.TpmtPublic:
 			b, err := tpmptToPubKeyBytes(item)
 			if err != nil {
 				return nil, fmt.Errorf("failed to extract rek public key from evidence: %w", err)
 			}
 
+			// the name is computed, the piece signature is whatever the producer put there.
+			name, err := evidence.REKName(item)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compute rek name: %w", err)
+			}
+
 			s.base64PubKey = base64.StdEncoding.EncodeToString(b)
-			s.base64PubKeyName = base64.StdEncoding.EncodeToString(item.Signature)
+			s.base64PubKeyName = base64.StdEncoding.EncodeToString(name)
 			continue
 		case ev.TpmQuote:
 			quotePB := ev.TPMQuoteAttestation{}
@@ -80,39 +184,9 @@ func New(cfg *Config, evidence ev.SignedEvidenceList) (*Service, error) {
 			s.base64PCRValues = base64.StdEncoding.EncodeToString(b)
 			continue
 		case ev.NvidiaCCIntermediateCertificate, ev.NvidiaSwitchIntermediateCertificate:
-			// Extract the intermediate certificate to identify its expiry date.
-			cert, err := x509.ParseCertificate(item.Data)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse nvidia intermediate certificate: %w", err)
-			}
-
-			slog.Info("Nvidia intermediate certificate provided in evidence",
-				"subject", cert.Subject.String(),
-				"not_before", cert.NotBefore,
-				"not_after", cert.NotAfter)
-
-			// Schedule router_com to shutdown when the certificate expires.
-			// Until we have more data around JWT expirations, we will force compute
-			// nodes to be recreated when the intermediate certificate expires
-			// (since that breaks the attestation package provided to the client).
-			go func() {
-				// Shut down 1 minute before the certificate expires.
-				// This gives the node time to notify the router that it is shutting down,
-				// and finish serving any in-flight requests.
-				expirationTime := cert.NotAfter.Add(-1 * time.Minute)
-				slog.Info("Waiting until certificate expiry to force a shutdown",
-					"not_after", cert.NotAfter,
-					"expiration_time", expirationTime)
-
-				time.Sleep(time.Until(expirationTime))
-				pid := os.Getpid()
-				// Send SIGTERM to ourselves to trigger a graceful shutdown.
-				err := syscall.Kill(pid, syscall.SIGTERM)
-				if err != nil {
-					// This really shouldnt happen...
-					panic("failed to kill router_com: " + err.Error())
-				}
-			}()
+			// the expiry manager shuts the node down before the certificate expires, since that
+			// breaks the attestation package provided to the client.
+			gpuEvidence = true
 		default:
 		}
 	}
@@ -129,8 +203,399 @@ func New(cfg *Config, evidence ev.SignedEvidenceList) (*Service, error) {
 		return nil, errors.New("failed to find pcr values in evidence")
 	}
 
+	// a cpu-only node with gpu evidence, or gpu settings, is misconfigured.
+	s.cpuOnly = evidence.IsCPUOnly(s.evidence)
+	if s.cpuOnly {
+		if gpuEvidence {
+			return nil, errors.New("evidence contains both the cpu-only marker and gpu evidence")
+		}
+		if cfg.Capabilities != nil && cfg.Capabilities.ProtectedPCIe {
+			return nil, errors.New("cpu-only node can't advertise protected pcie")
+		}
+		slog.Info("Node serves inference without GPUs")
+	}
+
+	// a node whose GPUs couldn't be attested serves the cpu models until it retries the attestation.
+	gpuDegraded, isGPUDegraded, err := evidence.FindGPUDegraded(s.evidence)
+	if err != nil {
+		return nil, err
+	}
+	if isGPUDegraded {
+		if gpuEvidence || s.cpuOnly {
+			return nil, errors.New("evidence contains the gpu degraded marker and gpu evidence or the cpu-only marker")
+		}
+		s.gpuDegraded = &gpuDegraded
+		slog.Warn("GPUs are not attested, only serving cpu models", "reason", gpuDegraded.Reason, "retry_after", gpuDegraded.RetryAfter())
+		if retryAfter := gpuDegraded.RetryAfter(); retryAfter > 0 {
+			go func() {
+				time.Sleep(retryAfter)
+				s.shutdown(ShutdownReasonGPUAttestationRetry)
+			}()
+		}
+	}
+
+	// the evidence already discloses maintenance mode, refuse traffic to match it.
+	maintenance, inMaintenance, err := evidence.FindMaintenance(s.evidence)
+	if err != nil {
+		return nil, err
+	}
+	if inMaintenance {
+		s.maintenance = &maintenance
+		slog.Warn("Node is in maintenance mode, refusing all confidential requests", "reason", maintenance.Reason)
+	}
+
+	// the output filter compute_worker loads must be the one the evidence discloses.
+	outputFilter, hasOutputFilter, err := evidence.FindOutputFilter(s.evidence)
+	if err != nil {
+		return nil, err
+	}
+	outputFilterPath := ""
+	if cfg.Worker != nil {
+		outputFilterPath = cfg.Worker.OutputFilter
+	}
+	switch {
+	case hasOutputFilter && outputFilterPath == "":
+		return nil, errors.New("evidence discloses an output filter but none is configured")
+	case !hasOutputFilter && outputFilterPath != "":
+		return nil, errors.New("output filter is configured but not disclosed in the evidence")
+	case hasOutputFilter:
+		s.outputFilterDigest = outputFilter.Digest
+		slog.Info("Filtering output", "digest", outputFilter.Digest)
+	}
+
+	// workers only serve the experimental routes the evidence discloses, so verifiers see them.
+	experimentalRoutes, hasExperimentalRoutes, err := evidence.FindExperimentalRoutes(s.evidence)
+	if err != nil {
+		return nil, err
+	}
+	if hasExperimentalRoutes {
+		if err := experimental.CheckBuild(experimentalRoutes.Routes); err != nil {
+			return nil, fmt.Errorf("evidence discloses experimental routes: %w", err)
+		}
+		s.experimentalRoutes = experimentalRoutes.Routes
+		slog.Warn("Serving experimental routes", "routes", experimentalRoutes.Routes)
+	}
+
+	// workers only sign refunds with a refund key the router can find in the evidence.
+	_, hasRefundKey, err := evidence.FindRefundKey(s.evidence)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TPM != nil && cfg.TPM.RefundKeyHandle != 0 && !hasRefundKey {
+		return nil, errors.New("refund key handle is configured but the evidence discloses no refund key")
+	}
+
+	// workers only mirror requests to the shadow backend the evidence discloses.
+	mirror, hasMirror, err := evidence.FindMirror(s.evidence)
+	if err != nil {
+		return nil, err
+	}
+	mirrorBaseURL := ""
+	if cfg.Worker != nil && cfg.Worker.Mirror != nil {
+		mirrorBaseURL = cfg.Worker.Mirror.BaseURL
+	}
+	switch {
+	case hasMirror && mirror.BaseURL != mirrorBaseURL:
+		return nil, fmt.Errorf("evidence discloses mirror %q but %q is configured", mirror.BaseURL, mirrorBaseURL)
+	case !hasMirror && mirrorBaseURL != "":
+		return nil, errors.New("mirror is configured but not disclosed in the evidence")
+	case hasMirror:
+		s.mirrorBaseURL = mirror.BaseURL
+		slog.Warn("Mirroring requests to a shadow backend", "base_url", mirror.BaseURL)
+	}
+
+	if cfg.ModelStateFile != "" {
+		states, err := modelstate.Read(cfg.ModelStateFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read model states: %w", err)
+		}
+		for model := range modelstate.Cold(states) {
+			slog.Warn("Model is cold and will not be advertised to the router", "model", model)
+		}
+		if cfg.ModelWake == nil || cfg.ModelWake.Socket == "" {
+			for model := range modelstate.Sleeping(states) {
+				slog.Warn("Model is sleeping without a model waker and will not be advertised to the router", "model", model)
+			}
+		}
+		s.state.setModelStates(states)
+	}
+
+	if cfg.Policy != nil && cfg.Policy.RootKey != "" {
+		rootKey, err := computeworker.DecodeBadgeKey(cfg.Policy.RootKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse policy root key: %w", err)
+		}
+		s.policyRootKey = rootKey
+
+		if cfg.Policy.StateFile != "" {
+			if err := s.loadPolicyState(cfg.Policy.StateFile); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if cfg.Worker != nil {
+		for _, rule := range cfg.Worker.AuditBodyRules {
+			if _, err := computeworker.ParseBodyRule(rule); err != nil {
+				return nil, fmt.Errorf("invalid worker config: %w", err)
+			}
+		}
+		for _, name := range cfg.Worker.BodyMutators {
+			if _, err := computeworker.ParseBodyMutator(name); err != nil {
+				return nil, fmt.Errorf("invalid worker config: %w", err)
+			}
+		}
+		for _, hostname := range cfg.Worker.AllowedHostnames {
+			if hostname == "" || strings.ContainsAny(hostname, "/ ") {
+				return nil, fmt.Errorf("invalid worker config: invalid allowed hostname %q", hostname)
+			}
+		}
+		if _, err := computeworker.ParseResponseContentTypes(cfg.Worker.ResponseContentTypes); err != nil {
+			return nil, fmt.Errorf("invalid worker config: %w", err)
+		}
+		if _, err := computeworker.ParseEgressDeny(cfg.Worker.EgressDeny); err != nil {
+			return nil, fmt.Errorf("invalid worker config: %w", err)
+		}
+		if _, err := computeworker.ParseBackendResolve(cfg.Worker.BackendResolve); err != nil {
+			return nil, fmt.Errorf("invalid worker config: %w", err)
+		}
+		if cfg.Worker.Pacing != nil {
+			if err := cfg.Worker.Pacing.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid worker config: invalid pacing: %w", err)
+			}
+		}
+		if cfg.Worker.Padding != nil {
+			if err := cfg.Worker.Padding.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid worker config: invalid padding: %w", err)
+			}
+		}
+		if cfg.Worker.Continuation != nil {
+			if err := cfg.Worker.Continuation.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid worker config: invalid continuation: %w", err)
+			}
+		}
+		if cfg.Worker.Pricing != nil {
+			if err := cfg.Worker.Pricing.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid worker config: invalid pricing: %w", err)
+			}
+		}
+		if cfg.Worker.Mirror != nil {
+			if err := cfg.Worker.Mirror.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid worker config: invalid mirror: %w", err)
+			}
+		}
+		if cfg.Worker.ModelBackends != nil {
+			if err := cfg.Worker.ModelBackends.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid worker config: invalid model backends: %w", err)
+			}
+		}
+		if cfg.Worker.MaxTopUpCredits < 0 {
+			return nil, fmt.Errorf("invalid worker config: invalid max top-up credits: %d", cfg.Worker.MaxTopUpCredits)
+		}
+		if cfg.Worker.MaxTopUpCredits > 0 {
+			s.creditGrants = newCreditGrantPipes()
+		}
+		for _, backend := range cfg.Worker.LLMBackends {
+			u, err := url.Parse(backend)
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				return nil, fmt.Errorf("invalid worker config: invalid llm backend %q", backend)
+			}
+		}
+		if cfg.Worker.Session != nil {
+			if err := cfg.Worker.Session.validate(); err != nil {
+				return nil, fmt.Errorf("invalid worker config: invalid session: %w", err)
+			}
+			s.sessions = newSessionPool(cfg.Worker.Session)
+		}
+	}
+
+	if cfg.Shutdown != nil {
+		if err := cfg.Shutdown.validate(); err != nil {
+			return nil, fmt.Errorf("invalid shutdown config: %w", err)
+		}
+	}
+
+	if cfg.Capabilities != nil {
+		if err := cfg.Capabilities.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid capabilities config: %w", err)
+		}
+	}
+
+	if cfg.BadgeLimit != nil {
+		if err := cfg.BadgeLimit.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid badge limit config: %w", err)
+		}
+	}
+
+	if cfg.ModelWake != nil {
+		if err := cfg.ModelWake.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid model wake config: %w", err)
+		}
+	}
+
+	if cfg.Worker != nil && cfg.Worker.PromptCache {
+		key := make([]byte, computeworker.PromptCacheKeyLen)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate prompt cache key: %w", err)
+		}
+		s.promptCacheKey = base64.StdEncoding.EncodeToString(key)
+	}
+
+	if cfg.Worker != nil && cfg.Worker.SessionHints {
+		key := make([]byte, computeworker.SessionHintKeyLen)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate session hint key: %w", err)
+		}
+		s.sessionHintKey = base64.StdEncoding.EncodeToString(key)
+	}
+
+	if cfg.Worker != nil && cfg.Worker.Continuation != nil && cfg.Worker.Continuation.TTL > 0 {
+		key := make([]byte, computeworker.ContinuationKeyLen)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate continuation key: %w", err)
+		}
+		s.continuationKey = base64.StdEncoding.EncodeToString(key)
+	}
+
+	if cfg.Worker != nil && cfg.Worker.LLMAuthFile != "" {
+		auth, err := sealedconfig.ReadFile(cfg.Worker.LLMAuthFile, sealedconfig.DefaultTPMDevice)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read llm auth file: %w", err)
+		}
+		s.llmAuthorization = strings.TrimSpace(string(auth))
+		if s.llmAuthorization == "" {
+			return nil, errors.New("llm auth file is empty")
+		}
+	}
+
+	if cfg.Worker != nil && cfg.Worker.Cgroup != nil {
+		if err := setupCgroupParent(cfg.Worker.Cgroup); err != nil {
+			return nil, fmt.Errorf("failed to setup worker cgroups: %w", err)
+		}
+	}
+
+	if cfg.RefundCallback != nil && cfg.RefundCallback.URL != "" {
+		if cfg.RefundCallback.SigningKeyFile == "" {
+			return nil, errors.New("refund callback requires a signing key file")
+		}
+		key, err := readRefundSigningKey(cfg.RefundCallback.SigningKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		s.refunds, err = newRefundReporter(cfg.RefundCallback, key, s.commandsWG)
+		if err != nil {
+			return nil, err
+		}
+	} else if cfg.RefundCallback != nil && cfg.RefundCallback.DisableTrailer {
+		return nil, errors.New("refund trailer can't be disabled without a refund callback url")
+	}
+
+	if cfg.SlowClient != nil {
+		if err := cfg.SlowClient.validate(); err != nil {
+			return nil, fmt.Errorf("invalid slow client config: %w", err)
+		}
+	}
+
+	if cfg.REKUsage != nil {
+		var err error
+		s.rekUsage, err = newREKUsageCounter(cfg.REKUsage, s.base64PubKeyName)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rek usage config: %w", err)
+		}
+	}
+
+	if cfg.StartupLatency != nil {
+		var err error
+		s.startupLatency, err = newStartupLatencyTracker(cfg.StartupLatency)
+		if err != nil {
+			return nil, fmt.Errorf("invalid startup latency config: %w", err)
+		}
+	}
+
+	if cfg.ModelSpend != nil {
+		var models []string
+		if cfg.Worker != nil {
+			models = cfg.Worker.Models
+		}
+		var err error
+		s.modelSpend, err = newModelSpendTracker(cfg.ModelSpend, models)
+		if err != nil {
+			return nil, fmt.Errorf("invalid model spend config: %w", err)
+		}
+	}
+
+	if cfg.PromptSize != nil {
+		var err error
+		s.promptSize, err = newPromptSizeTracker(cfg.PromptSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prompt size config: %w", err)
+		}
+	}
+
+	expiryCfg := cfg.EvidenceExpiry
+	if expiryCfg == nil {
+		expiryCfg = DefaultEvidenceExpiryConfig()
+	}
+	s.expiry, err = newExpiryManager(expiryCfg, s.evidence)
+	if err != nil {
+		return nil, fmt.Errorf("invalid evidence expiry config: %w", err)
+	}
+
+	if cfg.TPMBroker != nil && cfg.TPMBroker.Socket != "" {
+		s.tpmBroker = tpmbroker.New(cfg.TPMBroker)
+		if err := s.tpmBroker.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start tpm broker: %w", err)
+		}
+	}
+
+	if cfg.BadgeLimit != nil && cfg.BadgeLimit.Socket != "" {
+		s.badgeLimiter = badgelimit.New(cfg.BadgeLimit)
+		if err := s.badgeLimiter.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start badge limiter: %w", err)
+		}
+	}
+
+	if s.continuationKey != "" || s.creditGrants != nil {
+		if cfg.Worker.NonceSocket == "" {
+			return nil, errors.New("invalid worker config: continuations and top-ups require a nonce socket")
+		}
+		s.nonces = nonceledger.New(&nonceledger.Config{Socket: cfg.Worker.NonceSocket})
+		if err := s.nonces.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start nonce ledger: %w", err)
+		}
+	}
+
+	if cfg.ModelWake != nil && cfg.ModelWake.Socket != "" {
+		client := &http.Client{Transport: otelutil.NewTransport(http.DefaultTransport)}
+		s.modelWaker = modelwake.New(cfg.ModelWake, s.state.modelStates(), client)
+		if err := s.modelWaker.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start model waker: %w", err)
+		}
+	}
+
+	if cfg.Worker.ModelBackends != nil && len(cfg.Worker.ModelBackends.Models) > 0 {
+		client := &http.Client{Transport: otelutil.NewTransport(http.DefaultTransport)}
+		s.backendPool = backendpool.New(cfg.Worker.ModelBackends, client)
+		if err := s.backendPool.Start(); err != nil {
+			return nil, fmt.Errorf("failed to start backend pool: %w", err)
+		}
+	}
+
 	setupHandlers(s)
 
+	s.expiry.start(func() { s.SetDraining(true) }, func(deadline evidence.Deadline) {
+		reason := ShutdownReasonEvidenceExpiry
+		if deadline.Kind == evidence.DeadlineCertificate {
+			reason = ShutdownReasonCertificateExpiry
+		}
+		s.shutdown(reason)
+	})
+
+	s.recentMetrics = newRecentMetrics()
+	s.recentMetrics.start(recentMetricsInterval, func() MetricsSample {
+		return newMetricsSample(time.Now(), s.AdminStatus())
+	})
+
 	return s, nil
 }
 
@@ -138,6 +603,10 @@ func setupHandlers(s *Service) {
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("GET /_health", s.healthHandler)
+	mux.HandleFunc("GET /livez", s.livezHandler)
+	mux.HandleFunc("GET /readyz", s.readyzHandler)
+	mux.HandleFunc("PUT /_policy", s.policyHandler)
+	mux.HandleFunc("POST /_credit_grant", s.creditGrantHandler)
 	otelutil.ServeMuxHandleFunc(mux, "POST /", s.generateHandler)
 
 	s.handler = mux
@@ -147,8 +616,72 @@ func (s *Service) Evidence() ev.SignedEvidenceList {
 	return s.evidence
 }
 
+// WarmModels filters out the models that compute_boot reported as cold. Models without
+// a reported state are considered warm. Sleeping models are kept when the model waker can wake
+// them up. While the GPUs are not attested, only the CPU models of the capabilities config are kept.
+func (s *Service) WarmModels(models []string) []string {
+	cold := modelstate.Cold(s.state.modelStates())
+	sleeping := modelstate.Sleeping(s.state.modelStates())
+	warm := make([]string, 0, len(models))
+	for _, model := range models {
+		if cold[model] {
+			continue
+		}
+		if _, ok := sleeping[model]; ok && s.modelWaker == nil {
+			continue
+		}
+		if s.gpuDegraded != nil && !s.cpuModel(model) {
+			continue
+		}
+		warm = append(warm, model)
+	}
+	return warm
+}
+
+// cpuModel reports whether the capabilities config marks model as servable without GPUs.
+func (s *Service) cpuModel(model string) bool {
+	if s.config == nil || s.config.Capabilities == nil {
+		return false
+	}
+	return slices.ContainsFunc(s.config.Capabilities.Models, func(m capabilities.Model) bool {
+		return m.Name == model && m.CPU
+	})
+}
+
+// AdvertiseCapabilities creates the capability advertisement for models and records it, so
+// the admin API reports what was advertised to the router.
+func (s *Service) AdvertiseCapabilities(models []string) *capabilities.Advertisement {
+	adv := capabilities.New(s.config.Capabilities, models)
+	adv.CPUOnly = s.cpuOnly || s.gpuDegraded != nil
+	adv.GPUDegraded = s.gpuDegraded != nil
+	adv.ExperimentalRoutes = slices.Clone(s.experimentalRoutes)
+	// the router can prefer faster nodes, nodes with the model awake and skip nodes with misconfigured GPUs.
+	for _, state := range s.state.modelStates() {
+		if state.Benchmark == nil && !state.Sleeping {
+			continue
+		}
+		i := slices.IndexFunc(adv.Models, func(m capabilities.Model) bool {
+			return m.Name == state.Model
+		})
+		if i < 0 {
+			continue
+		}
+		adv.Models[i].Sleeping = state.Sleeping
+		if state.Benchmark != nil {
+			adv.Models[i].Performance = &capabilities.Performance{
+				TokensPerSecond: state.Benchmark.TokensPerSecond,
+				TTFTMillis:      state.Benchmark.TTFT.Milliseconds(),
+				Tier:            state.Benchmark.Tier,
+			}
+		}
+	}
+	s.state.setCapabilities(adv)
+	return adv
+}
+
 func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Header.Get("X-Confsec-Ping") == "routercom" {
+		s.state.setRegistered()
 		_, err := w.Write([]byte("routercom"))
 		if err != nil {
 			slog.Error("failed to write ping response", "err", err)
@@ -159,9 +692,55 @@ func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.handler.ServeHTTP(w, r)
 }
 
+// MigrateRequests drains the node and asks every running compute_worker to end its response at the
+// next token boundary, with a continuation the client can replay against another node.
+func (s *Service) MigrateRequests() {
+	s.SetDraining(true)
+	s.migratingOnce.Do(func() {
+		slog.Info("Migrating in-flight requests")
+		close(s.migrating)
+	})
+}
+
+// Migrating reports whether in-flight requests are being migrated to other nodes.
+func (s *Service) Migrating() bool {
+	select {
+	case <-s.migrating:
+		return true
+	default:
+		return false
+	}
+}
+
 func (s *Service) Close() error {
+	if s.expiry != nil {
+		s.expiry.stop()
+	}
+	if s.recentMetrics != nil {
+		s.recentMetrics.stop()
+	}
+	s.closeSessions()
 	s.commandsWG.Wait()
-	return nil
+	var err error
+	if s.rekUsage != nil {
+		err = s.rekUsage.persist()
+	}
+	if s.tpmBroker != nil {
+		err = errors.Join(err, s.tpmBroker.Close())
+	}
+	if s.badgeLimiter != nil {
+		err = errors.Join(err, s.badgeLimiter.Close())
+	}
+	if s.nonces != nil {
+		err = errors.Join(err, s.nonces.Close())
+	}
+	if s.modelWaker != nil {
+		err = errors.Join(err, s.modelWaker.Close())
+	}
+	if s.backendPool != nil {
+		err = errors.Join(err, s.backendPool.Close())
+	}
+	return err
 }
 
 func tpmptToPubKeyBytes(evidence *ev.SignedEvidencePiece) ([]byte, error) {
@@ -0,0 +1,285 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/confidentsecurity/confidentcompute/cmd/compute_worker/exitcodes"
+	"github.com/confidentsecurity/confidentcompute/computeworker"
+	"github.com/openpcc/openpcc/otel/otelutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// WorkerSessionConfig is config for reusing compute_worker processes across requests. A session
+// worker sets up its TPM receiver once, every request still brings its own encapsulated key,
+// credit amount and output MAC key. See computeworker.Session.
+type WorkerSessionConfig struct {
+	// MaxRequests is the number of requests a session worker handles before it's replaced. 0 means no limit.
+	MaxRequests int `yaml:"max_requests"`
+	// MaxIdle is the number of idle session workers kept for the next requests.
+	MaxIdle int `yaml:"max_idle"`
+}
+
+func (c *WorkerSessionConfig) validate() error {
+	if c.MaxRequests < 0 {
+		return errors.New("max requests can't be negative")
+	}
+	if c.MaxIdle <= 0 {
+		return errors.New("max idle must be positive")
+	}
+	return nil
+}
+
+var errSessionRetired = errors.New("worker session retired")
+
+// workerSession is a compute_worker process in session mode.
+type workerSession struct {
+	stdinW *io.PipeWriter
+	stdinR *io.PipeReader
+	stdout *bufio.Reader
+	// close waits for the worker to exit, cancel terminates it.
+	close  closeFunc
+	cancel context.CancelFunc
+	// endResponse asks the worker to end the response of its current request, the session ends after it.
+	endResponse func()
+	// policy is the policy the worker was started with, its arguments don't change with the policy.
+	policy   *PolicyBundle
+	requests int
+}
+
+// sessionPool holds the idle session workers.
+type sessionPool struct {
+	cfg *WorkerSessionConfig
+
+	mu     sync.Mutex
+	idle   []*workerSession
+	closed bool
+}
+
+func newSessionPool(cfg *WorkerSessionConfig) *sessionPool {
+	return &sessionPool{cfg: cfg}
+}
+
+func (p *sessionPool) get() *workerSession {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.idle) == 0 {
+		return nil
+	}
+	session := p.idle[len(p.idle)-1]
+	p.idle = p.idle[:len(p.idle)-1]
+	return session
+}
+
+// put returns session to the pool, false if the pool is full or closed.
+func (p *sessionPool) put(session *workerSession) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || len(p.idle) >= p.cfg.MaxIdle {
+		return false
+	}
+	p.idle = append(p.idle, session)
+	return true
+}
+
+// close closes the pool and returns the idle sessions.
+func (p *sessionPool) close() []*workerSession {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	return idle
+}
+
+// startSession starts a compute_worker in session mode. The worker is not tied to a request, it
+// exits when its stdin is closed.
+func (s *Service) startSession(ctx context.Context) (*workerSession, error) {
+	ctx, span := otelutil.Tracer.Start(ctx, "routercom.startSession")
+	defer span.End()
+
+	policy := s.state.currentPolicy()
+	stdinR, stdinW := io.Pipe()
+	workerCtx, cancel := context.WithCancel(context.Background())
+	workerCtx, endResponse := withResponseEnd(workerCtx)
+	stdout, closeWorker, err := s.runWorker(workerCtx, stdinR, nil)
+	if err != nil {
+		cancel()
+		return nil, otelutil.Errorf(span, "failed to run session worker: %w", err)
+	}
+
+	slog.DebugContext(ctx, "Started compute worker session")
+	span.SetStatus(codes.Ok, "")
+	return &workerSession{
+		stdinW:      stdinW,
+		stdinR:      stdinR,
+		stdout:      bufio.NewReader(stdout),
+		close:       closeWorker,
+		cancel:      cancel,
+		endResponse: endResponse,
+		policy:      policy,
+	}, nil
+}
+
+// checkoutSession returns an idle session started under the current policy, or starts a new one.
+func (s *Service) checkoutSession(ctx context.Context) (*workerSession, error) {
+	policy := s.state.currentPolicy()
+	for session := s.sessions.get(); session != nil; session = s.sessions.get() {
+		if session.policy == policy {
+			return session, nil
+		}
+		// don't hold up the request while the outdated worker exits.
+		s.commandsWG.Add(1)
+		go func() {
+			defer s.commandsWG.Done()
+			s.retireSession(context.WithoutCancel(ctx), session, false)
+		}()
+	}
+	return s.startSession(ctx)
+}
+
+// releaseSession returns session to the pool, unless it is worn out or the node is migrating.
+func (s *Service) releaseSession(ctx context.Context, session *workerSession) {
+	session.requests++
+	maxRequests := s.config.Worker.Session.MaxRequests
+	if (maxRequests > 0 && session.requests >= maxRequests) || s.Migrating() || !s.sessions.put(session) {
+		s.retireSession(ctx, session, false)
+	}
+}
+
+// retireSession ends the session and waits for the worker to exit. A broken session is
+// terminated, its worker can't be trusted to see the end of its stdin.
+func (*Service) retireSession(ctx context.Context, session *workerSession, broken bool) {
+	if broken {
+		session.cancel()
+		// unblocks a request that is still being written to the worker.
+		_ = session.stdinR.CloseWithError(errSessionRetired)
+	}
+	_ = session.stdinW.Close()
+	session.close(ctx)
+	session.cancel()
+}
+
+// runSessionRequest runs a request on a session worker. Like runWorker, the returned reader is the
+// worker output and closeFunc returns its exit code.
+func (s *Service) runSessionRequest(ctx context.Context, ciphertext io.ReadCloser, p computeworker.RequestParams) (io.Reader, closeFunc, error) {
+	ctx, span := otelutil.Tracer.Start(ctx, "routercom.runSessionRequest")
+	defer span.End()
+
+	session, err := s.checkoutSession(ctx)
+	if err != nil {
+		return nil, nil, otelutil.Errorf(span, "failed to checkout worker session: %w", err)
+	}
+
+	// Pass trace context to the request.
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	req := computeworker.SessionRequest{
+		Params:      p,
+		Traceparent: carrier["traceparent"],
+	}
+
+	// a body read error still ends the request, so only failing to write to the worker breaks the session.
+	pumped := make(chan error, 1)
+	go func() {
+		pumped <- computeworker.WriteSessionRequest(session.stdinW, req, ciphertext)
+	}()
+
+	// forward a request to end the response to the session worker, it only applies to this request.
+	ended := responseEnd(ctx)
+	done := make(chan struct{})
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		select {
+		case <-ended:
+			session.endResponse()
+		case <-done:
+		}
+	}()
+
+	out := computeworker.NewSessionReader(session.stdout)
+	closeFunc := func(ctx context.Context) int {
+		ctx, span := otelutil.Tracer.Start(ctx, "routercom.runSessionRequest.close")
+		defer span.End()
+
+		_, err := io.Copy(io.Discard, out)
+		close(done)
+		<-watched
+		exitCode := 1
+		if err == nil {
+			exitCode, err = out.ExitCode()
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to read session response, retiring session", "error", err)
+			s.retireSession(ctx, session, true)
+			<-pumped
+			return 1
+		}
+
+		if err := <-pumped; err != nil {
+			slog.WarnContext(ctx, "failed to pump request to session worker", "error", err)
+		}
+
+		slog.InfoContext(ctx, "Session request ended", "exit_code", exitCode)
+		s.state.requestEnded(exitCode)
+		if s.rekUsage != nil && exitCode == exitcodes.RequestDecapsulationCode {
+			s.rekUsage.failed()
+		}
+		select {
+		case <-ended:
+			// the worker ends the session after a response that was ended early.
+			s.retireSession(ctx, session, false)
+		default:
+			s.releaseSession(ctx, session)
+		}
+
+		span.SetStatus(codes.Ok, "")
+		return exitCode
+	}
+
+	span.SetStatus(codes.Ok, "")
+	return out, closeFunc, nil
+}
+
+// closeSessions retires the idle sessions, sessions that are in use are retired when released.
+func (s *Service) closeSessions() {
+	if s.sessions == nil {
+		return
+	}
+	for _, session := range s.sessions.close() {
+		s.retireSession(context.Background(), session, false)
+	}
+}
+
+// runRequest runs the request on a session worker when sessions are enabled, or starts a
+// compute_worker for it otherwise.
+func (s *Service) runRequest(ctx context.Context, ciphertext io.ReadCloser, p computeworker.RequestParams) (io.Reader, closeFunc, error) {
+	if s.sessions != nil {
+		return s.runSessionRequest(ctx, ciphertext, p)
+	}
+	return s.runWorker(ctx, ciphertext, &p)
+}
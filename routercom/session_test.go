@@ -0,0 +1,61 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerSessionConfigValidate(t *testing.T) {
+	require.NoError(t, (&WorkerSessionConfig{MaxIdle: 1}).validate())
+	require.NoError(t, (&WorkerSessionConfig{MaxRequests: 100, MaxIdle: 4}).validate())
+	require.Error(t, (&WorkerSessionConfig{}).validate())
+	require.Error(t, (&WorkerSessionConfig{MaxRequests: -1, MaxIdle: 1}).validate())
+}
+
+func TestSessionPool(t *testing.T) {
+	t.Run("ok, idle sessions are reused most recent first", func(t *testing.T) {
+		pool := newSessionPool(&WorkerSessionConfig{MaxIdle: 2})
+		require.Nil(t, pool.get())
+
+		first, second := &workerSession{}, &workerSession{}
+		require.True(t, pool.put(first))
+		require.True(t, pool.put(second))
+		require.Same(t, second, pool.get())
+		require.Same(t, first, pool.get())
+		require.Nil(t, pool.get())
+	})
+
+	t.Run("ok, full pool rejects sessions", func(t *testing.T) {
+		pool := newSessionPool(&WorkerSessionConfig{MaxIdle: 1})
+		require.True(t, pool.put(&workerSession{}))
+		require.False(t, pool.put(&workerSession{}))
+	})
+
+	t.Run("ok, closed pool returns idle sessions and rejects new ones", func(t *testing.T) {
+		pool := newSessionPool(&WorkerSessionConfig{MaxIdle: 2})
+		idle := &workerSession{}
+		require.True(t, pool.put(idle))
+
+		require.Equal(t, []*workerSession{idle}, pool.close())
+		require.False(t, pool.put(&workerSession{}))
+		require.Nil(t, pool.get())
+	})
+}
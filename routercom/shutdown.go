@@ -0,0 +1,157 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DeregistrationTagPrefix prefixes the router agent tag that carries the deregistration.
+const DeregistrationTagPrefix = "deregistration="
+
+// ShutdownReason is the machine-readable reason router_com shuts down.
+type ShutdownReason string
+
+const (
+	// ShutdownReasonTerminated means router_com was signalled by the host, e.g. the VM is stopped.
+	ShutdownReasonTerminated ShutdownReason = "terminated"
+	// ShutdownReasonDrained means the node was drained by an operator before it was stopped.
+	ShutdownReasonDrained ShutdownReason = "drained"
+	// ShutdownReasonCertificateExpiry means a certificate in the evidence expires, e.g. the nvidia
+	// intermediate certificate, the node has to be recreated to attest again.
+	ShutdownReasonCertificateExpiry ShutdownReason = "certificate_expiry"
+	// ShutdownReasonGPUAttestationRetry means the node registered without GPUs because they
+	// couldn't be attested, it restarts to attest them again.
+	ShutdownReasonGPUAttestationRetry ShutdownReason = "gpu_attestation_retry"
+	// ShutdownReasonEvidenceExpiry means other time-bound evidence expires, e.g. a GPU attestation
+	// token or the TEE collateral, the node has to be recreated to attest again.
+	ShutdownReasonEvidenceExpiry ShutdownReason = "evidence_expiry"
+)
+
+func (r ShutdownReason) valid() bool {
+	switch r {
+	case ShutdownReasonTerminated, ShutdownReasonDrained, ShutdownReasonCertificateExpiry,
+		ShutdownReasonGPUAttestationRetry, ShutdownReasonEvidenceExpiry:
+		return true
+	default:
+		return false
+	}
+}
+
+// ShutdownConfig is config for the deregistration router_com sends to the router before it exits.
+type ShutdownConfig struct {
+	// ExpectedDowntime is how long the node is expected to be gone per shutdown reason, e.g. the time
+	// to recreate a node after certificate expiry. Reasons without a downtime report it as unknown.
+	ExpectedDowntime map[ShutdownReason]time.Duration `yaml:"expected_downtime"`
+}
+
+func (c *ShutdownConfig) validate() error {
+	for reason, downtime := range c.ExpectedDowntime {
+		if !reason.valid() {
+			return fmt.Errorf("unknown shutdown reason %q", reason)
+		}
+		if downtime < 0 {
+			return fmt.Errorf("expected downtime of %s can't be negative", reason)
+		}
+	}
+	return nil
+}
+
+// Deregistration tells the router why the node is going away, so it can tell a planned shutdown
+// from a failure.
+type Deregistration struct {
+	Reason ShutdownReason `json:"reason"`
+	// ExpectedDowntimeSeconds is how long the node is expected to be gone, 0 if unknown.
+	ExpectedDowntimeSeconds int64 `json:"expected_downtime_seconds,omitempty"`
+}
+
+// Tag serializes the deregistration into a router agent tag, encoded like the capabilities tag.
+func (d Deregistration) Tag() (string, error) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal deregistration: %w", err)
+	}
+	return DeregistrationTagPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ParseDeregistrationTag parses a deregistration from a router agent tag created with Tag.
+func ParseDeregistrationTag(tag string) (Deregistration, error) {
+	encoded, ok := strings.CutPrefix(tag, DeregistrationTagPrefix)
+	if !ok {
+		return Deregistration{}, errors.New("not a deregistration tag")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Deregistration{}, fmt.Errorf("failed to decode deregistration: %w", err)
+	}
+
+	var d Deregistration
+	if err := json.Unmarshal(b, &d); err != nil {
+		return Deregistration{}, fmt.Errorf("failed to unmarshal deregistration: %w", err)
+	}
+	if !d.Reason.valid() {
+		return Deregistration{}, fmt.Errorf("unknown shutdown reason %q", d.Reason)
+	}
+	return d, nil
+}
+
+// SetShutdownReason records why router_com is about to shut down. The first reason wins, a
+// shutdown started for certificate expiry stays one when a SIGTERM arrives during the shutdown.
+func (s *Service) SetShutdownReason(reason ShutdownReason) {
+	s.state.setShutdownReason(reason)
+}
+
+// shutdown shuts router_com down gracefully for reason, e.g. when the node has to attest again.
+func (s *Service) shutdown(reason ShutdownReason) {
+	s.SetShutdownReason(reason)
+	// streaming responses would be cut by the shutdown, migrate them instead.
+	s.MigrateRequests()
+	s.shutdownOnce.Do(func() {
+		close(s.shutdownRequested)
+	})
+}
+
+// ShutdownRequested is closed when router_com decided to shut down gracefully, e.g. before its
+// evidence expires. The app then shuts down like it does on SIGTERM.
+func (s *Service) ShutdownRequested() <-chan struct{} {
+	return s.shutdownRequested
+}
+
+// Deregistration returns the deregistration to send to the router when router_com exits. Without
+// a recorded reason the node was terminated by the host, or drained first when it is draining.
+func (s *Service) Deregistration() Deregistration {
+	reason, ok := s.state.currentShutdownReason()
+	if !ok {
+		reason = ShutdownReasonTerminated
+		if s.state.isDraining() {
+			reason = ShutdownReasonDrained
+		}
+	}
+
+	d := Deregistration{Reason: reason}
+	if s.config != nil && s.config.Shutdown != nil {
+		d.ExpectedDowntimeSeconds = int64(s.config.Shutdown.ExpectedDowntime[reason] / time.Second)
+	}
+	return d
+}
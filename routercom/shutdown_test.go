@@ -0,0 +1,103 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeregistration(t *testing.T) {
+	newService := func(shutdown *ShutdownConfig) *Service {
+		return &Service{
+			config: &Config{Shutdown: shutdown},
+			state:  newServiceState(),
+		}
+	}
+
+	t.Run("ok, terminated by default", func(t *testing.T) {
+		svc := newService(nil)
+		require.Equal(t, Deregistration{Reason: ShutdownReasonTerminated}, svc.Deregistration())
+	})
+
+	t.Run("ok, draining node was drained", func(t *testing.T) {
+		svc := newService(nil)
+		svc.SetDraining(true)
+		require.Equal(t, ShutdownReasonDrained, svc.Deregistration().Reason)
+	})
+
+	t.Run("ok, first reason wins", func(t *testing.T) {
+		svc := newService(nil)
+		svc.SetShutdownReason(ShutdownReasonCertificateExpiry)
+		svc.SetShutdownReason(ShutdownReasonTerminated)
+		svc.SetDraining(true)
+		require.Equal(t, ShutdownReasonCertificateExpiry, svc.Deregistration().Reason)
+	})
+
+	t.Run("ok, expected downtime of the reason", func(t *testing.T) {
+		svc := newService(&ShutdownConfig{
+			ExpectedDowntime: map[ShutdownReason]time.Duration{
+				ShutdownReasonCertificateExpiry: 10 * time.Minute,
+			},
+		})
+		svc.SetShutdownReason(ShutdownReasonCertificateExpiry)
+		require.Equal(t, Deregistration{Reason: ShutdownReasonCertificateExpiry, ExpectedDowntimeSeconds: 600}, svc.Deregistration())
+	})
+
+	t.Run("ok, unknown expected downtime", func(t *testing.T) {
+		svc := newService(&ShutdownConfig{
+			ExpectedDowntime: map[ShutdownReason]time.Duration{
+				ShutdownReasonCertificateExpiry: 10 * time.Minute,
+			},
+		})
+		require.Zero(t, svc.Deregistration().ExpectedDowntimeSeconds)
+	})
+}
+
+func TestDeregistrationTag(t *testing.T) {
+	t.Run("ok, round trip", func(t *testing.T) {
+		want := Deregistration{Reason: ShutdownReasonDrained, ExpectedDowntimeSeconds: 30}
+		tag, err := want.Tag()
+		require.NoError(t, err)
+		require.NotContains(t, tag[len(DeregistrationTagPrefix):], "=")
+
+		got, err := ParseDeregistrationTag(tag)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	})
+
+	t.Run("fail, not a deregistration tag", func(t *testing.T) {
+		_, err := ParseDeregistrationTag("model=llama3.2:1b")
+		require.Error(t, err)
+	})
+
+	t.Run("fail, unknown reason", func(t *testing.T) {
+		tag, err := Deregistration{Reason: "bored"}.Tag()
+		require.NoError(t, err)
+		_, err = ParseDeregistrationTag(tag)
+		require.Error(t, err)
+	})
+}
+
+func TestShutdownConfigValidate(t *testing.T) {
+	require.NoError(t, (&ShutdownConfig{}).validate())
+	require.Error(t, (&ShutdownConfig{ExpectedDowntime: map[ShutdownReason]time.Duration{"bored": time.Minute}}).validate())
+	require.Error(t, (&ShutdownConfig{ExpectedDowntime: map[ShutdownReason]time.Duration{ShutdownReasonDrained: -time.Minute}}).validate())
+}
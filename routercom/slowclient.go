@@ -0,0 +1,161 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// errSlowClient is returned when the client reads the response slower than the minimum throughput.
+var errSlowClient = errors.New("client reads the response too slowly")
+
+// SlowClientConfig protects workers and GPU slots from clients that read their response slowly.
+// Responses to slow clients are ended early and the output that wasn't generated yet is refunded.
+// Output that was generated but not delivered to the client is charged.
+type SlowClientConfig struct {
+	// WriteTimeout is the longest a single write or flush to the client may block. 0 disables the timeout.
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// MinBytesPerSecond is the minimum throughput of the client while it blocks writes. 0 disables the check.
+	MinBytesPerSecond int64 `yaml:"min_bytes_per_second"`
+	// Window is how long writes must block in total before the throughput is checked.
+	Window time.Duration `yaml:"window"`
+}
+
+func (c *SlowClientConfig) validate() error {
+	if c.WriteTimeout < 0 {
+		return errors.New("write timeout can't be negative")
+	}
+	if c.MinBytesPerSecond < 0 {
+		return errors.New("min bytes per second can't be negative")
+	}
+	if c.MinBytesPerSecond > 0 && c.Window <= 0 {
+		return errors.New("window must be positive")
+	}
+	return nil
+}
+
+// slowClientWriter writes the response to the client with a deadline per write and ends it with
+// errSlowClient when the client is too slow. Only the time writes block is measured, a slow LLM
+// doesn't make a slow client.
+type slowClientWriter struct {
+	w   http.ResponseWriter
+	rc  *http.ResponseController
+	cfg *SlowClientConfig
+	now func() time.Time
+
+	// blocked is the time writes blocked in the current window, written the bytes written in it.
+	blocked time.Duration
+	written int64
+	err     error
+}
+
+func newSlowClientWriter(w http.ResponseWriter, cfg *SlowClientConfig) *slowClientWriter {
+	return &slowClientWriter{
+		w:   w,
+		rc:  http.NewResponseController(w),
+		cfg: cfg,
+		now: time.Now,
+	}
+}
+
+func (c *slowClientWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	start, err := c.setDeadline()
+	if err != nil {
+		return 0, err
+	}
+	n, err := c.w.Write(p)
+	if err != nil {
+		c.err = err
+		return n, err
+	}
+	c.err = c.observe(start, int64(n))
+	return n, c.err
+}
+
+// Flush flushes the response, most of the blocking happens here. A failed flush fails the next write.
+func (c *slowClientWriter) Flush() {
+	if c.err != nil {
+		return
+	}
+
+	start, err := c.setDeadline()
+	if err != nil {
+		c.err = err
+		return
+	}
+	if err := c.rc.Flush(); err != nil {
+		c.err = err
+		return
+	}
+	c.err = c.observe(start, 0)
+}
+
+func (c *slowClientWriter) setDeadline() (time.Time, error) {
+	now := c.now()
+	if c.cfg.WriteTimeout == 0 {
+		return now, nil
+	}
+	err := c.rc.SetWriteDeadline(now.Add(c.cfg.WriteTimeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return now, err
+	}
+	return now, nil
+}
+
+// observe records a write of n bytes that started at start and checks the throughput once the
+// writes blocked for a window.
+func (c *slowClientWriter) observe(start time.Time, n int64) error {
+	c.blocked += c.now().Sub(start)
+	c.written += n
+	if c.cfg.MinBytesPerSecond == 0 || c.blocked < c.cfg.Window {
+		return nil
+	}
+
+	bytesPerSecond := float64(c.written) / c.blocked.Seconds()
+	c.blocked, c.written = 0, 0
+	if bytesPerSecond < float64(c.cfg.MinBytesPerSecond) {
+		return errSlowClient
+	}
+	return nil
+}
+
+type responseEndKey struct{}
+
+// withResponseEnd returns a context that lets the returned func ask the worker that runs the request
+// to end its response at the next token, like a migration.
+func withResponseEnd(ctx context.Context) (context.Context, func()) {
+	end := make(chan struct{})
+	var once sync.Once
+	return context.WithValue(ctx, responseEndKey{}, end), func() {
+		once.Do(func() { close(end) })
+	}
+}
+
+// responseEnd is closed once the response of the request of ctx should end, nil if it can't end early.
+func responseEnd(ctx context.Context) <-chan struct{} {
+	end, _ := ctx.Value(responseEndKey{}).(chan struct{})
+	return end
+}
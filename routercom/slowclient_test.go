@@ -0,0 +1,139 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// clockedRecorder is a response recorder whose writes and flushes take delay on a fake clock.
+type clockedRecorder struct {
+	*httptest.ResponseRecorder
+	now   time.Time
+	delay time.Duration
+}
+
+func (r *clockedRecorder) Write(p []byte) (int, error) {
+	r.now = r.now.Add(r.delay)
+	return r.ResponseRecorder.Write(p)
+}
+
+func (r *clockedRecorder) Flush() {
+	r.now = r.now.Add(r.delay)
+	r.ResponseRecorder.Flush()
+}
+
+func TestSlowClientWriter(t *testing.T) {
+	cfg := &SlowClientConfig{
+		WriteTimeout:      time.Second,
+		MinBytesPerSecond: 100,
+		Window:            time.Second,
+	}
+
+	newWriter := func(cfg *SlowClientConfig, delay time.Duration) (*slowClientWriter, *clockedRecorder) {
+		rec := &clockedRecorder{ResponseRecorder: httptest.NewRecorder(), delay: delay}
+		w := newSlowClientWriter(rec, cfg)
+		w.now = func() time.Time { return rec.now }
+		return w, rec
+	}
+
+	// writeChunks writes 10 byte chunks like decoder.WriteTo and returns the number of chunks written.
+	writeChunks := func(w *slowClientWriter, n int) (int, error) {
+		chunk := bytes.Repeat([]byte("a"), 10)
+		for i := range n {
+			if _, err := w.Write(chunk); err != nil {
+				return i, err
+			}
+			w.Flush()
+		}
+		return n, nil
+	}
+
+	t.Run("ok, fast client", func(t *testing.T) {
+		w, rec := newWriter(cfg, time.Millisecond)
+		written, err := writeChunks(w, 1000)
+		require.NoError(t, err)
+		require.Equal(t, 1000, written)
+		require.Equal(t, 10000, rec.Body.Len())
+	})
+
+	t.Run("fail, slow client", func(t *testing.T) {
+		// 10 bytes per 200ms of blocking is 50 bytes per second.
+		w, _ := newWriter(cfg, 100*time.Millisecond)
+		written, err := writeChunks(w, 1000)
+		require.ErrorIs(t, err, errSlowClient)
+		require.Less(t, written, 10)
+
+		// the writer stays failed.
+		_, err = w.Write([]byte("a"))
+		require.ErrorIs(t, err, errSlowClient)
+	})
+
+	t.Run("ok, throughput check disabled", func(t *testing.T) {
+		w, _ := newWriter(&SlowClientConfig{WriteTimeout: time.Minute}, time.Second)
+		written, err := writeChunks(w, 100)
+		require.NoError(t, err)
+		require.Equal(t, 100, written)
+	})
+}
+
+func TestSlowClientConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		cfg     SlowClientConfig
+		wantErr bool
+	}{
+		"ok, write timeout only":     {cfg: SlowClientConfig{WriteTimeout: time.Second}},
+		"ok, min throughput":         {cfg: SlowClientConfig{MinBytesPerSecond: 100, Window: time.Second}},
+		"fail, negative timeout":     {cfg: SlowClientConfig{WriteTimeout: -time.Second}, wantErr: true},
+		"fail, negative throughput":  {cfg: SlowClientConfig{MinBytesPerSecond: -1}, wantErr: true},
+		"fail, throughput no window": {cfg: SlowClientConfig{MinBytesPerSecond: 100}, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.cfg.validate()
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestResponseEnd(t *testing.T) {
+	require.Nil(t, responseEnd(t.Context()))
+
+	ctx, end := withResponseEnd(t.Context())
+	ended := responseEnd(ctx)
+	require.NotNil(t, ended)
+	select {
+	case <-ended:
+		t.Fatal("response ended before end was called")
+	default:
+	}
+
+	end()
+	end()
+	<-ended
+}
@@ -0,0 +1,197 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker"
+)
+
+// defaultStartupLatencySamples is how many cold starts the percentiles are computed over.
+const defaultStartupLatencySamples = 1024
+
+// StartupLatencyConfig is config for aggregating the startup latency the compute_workers report,
+// see computeworker.StartupLatency.
+type StartupLatencyConfig struct {
+	// SLO is the total latency of a cold start, from the start of the worker to the first byte of the
+	// LLM backend. Slower cold starts are logged and counted. 0 disables the SLO.
+	SLO time.Duration `yaml:"slo"`
+	// Samples is how many of the latest cold starts the percentiles are computed over.
+	Samples int `yaml:"samples"`
+}
+
+func DefaultStartupLatencyConfig() *StartupLatencyConfig {
+	return &StartupLatencyConfig{
+		Samples: defaultStartupLatencySamples,
+	}
+}
+
+func (c *StartupLatencyConfig) validate() error {
+	if c.SLO < 0 {
+		return errors.New("slo can't be negative")
+	}
+	if c.Samples <= 0 {
+		return errors.New("samples must be positive")
+	}
+	return nil
+}
+
+// StartupLatencyStats aggregates the startup latency of the requests since router_com started.
+type StartupLatencyStats struct {
+	// Requests counts the requests that reported their startup latency.
+	Requests uint64 `json:"requests"`
+	// ColdStarts counts the requests that started a worker, the other requests reused a session worker.
+	ColdStarts uint64 `json:"cold_starts"`
+	// SLOViolations counts the cold starts slower than the SLO.
+	SLOViolations uint64 `json:"slo_violations"`
+	// Phases are the percentiles of each phase and the total over the latest cold starts, by the
+	// phase keys of the startup latency record.
+	Phases map[string]LatencyPercentiles `json:"phases"`
+}
+
+// LatencyPercentiles are latency percentiles in milliseconds.
+type LatencyPercentiles struct {
+	P50 float64 `json:"p50_ms"`
+	P90 float64 `json:"p90_ms"`
+	P99 float64 `json:"p99_ms"`
+}
+
+// startupLatencyTracker aggregates the startup latency records of the workers.
+type startupLatencyTracker struct {
+	cfg *StartupLatencyConfig
+
+	mu            sync.Mutex
+	requests      uint64
+	coldStarts    uint64
+	sloViolations uint64
+	// samples is a ring of the latest cold starts, next is where the next one goes.
+	samples []computeworker.StartupLatency
+	next    int
+}
+
+func newStartupLatencyTracker(cfg *StartupLatencyConfig) (*startupLatencyTracker, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &startupLatencyTracker{
+		cfg:     cfg,
+		samples: make([]computeworker.StartupLatency, 0, cfg.Samples),
+	}, nil
+}
+
+func (t *startupLatencyTracker) record(ctx context.Context, latency computeworker.StartupLatency) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.requests++
+	if !latency.Cold() {
+		return
+	}
+
+	t.coldStarts++
+	if len(t.samples) < t.cfg.Samples {
+		t.samples = append(t.samples, latency)
+	} else {
+		t.samples[t.next] = latency
+	}
+	t.next = (t.next + 1) % t.cfg.Samples
+
+	if t.cfg.SLO > 0 && latency.Total() > t.cfg.SLO {
+		t.sloViolations++
+		slog.WarnContext(ctx, "Cold start exceeded the latency SLO", "slo", t.cfg.SLO, computeworker.StartupLatencyKey, latency)
+	}
+}
+
+func (t *startupLatencyTracker) stats() StartupLatencyStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := StartupLatencyStats{
+		Requests:      t.requests,
+		ColdStarts:    t.coldStarts,
+		SLOViolations: t.sloViolations,
+		Phases:        map[string]LatencyPercentiles{},
+	}
+	if len(t.samples) == 0 {
+		return stats
+	}
+
+	// the phases are read from the log value, so the admin API uses the keys of the record.
+	values := map[string][]float64{}
+	for _, sample := range t.samples {
+		for _, attr := range sample.LogValue().Group() {
+			values[attr.Key] = append(values[attr.Key], attr.Value.Float64())
+		}
+	}
+	for key, v := range values {
+		slices.Sort(v)
+		stats.Phases[key] = LatencyPercentiles{
+			P50: percentile(v, 50),
+			P90: percentile(v, 90),
+			P99: percentile(v, 99),
+		}
+	}
+	return stats
+}
+
+// percentile returns the nearest-rank percentile p of the sorted values.
+func percentile(sorted []float64, p int) float64 {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank-1, 0)]
+}
+
+// startupLatencyHandler picks the startup latency records out of the forwarded worker logs. The
+// records are aggregated even when the log level hides them.
+type startupLatencyHandler struct {
+	inner   slog.Handler
+	tracker *startupLatencyTracker
+}
+
+func (h *startupLatencyHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level == slog.LevelInfo || h.inner.Enabled(ctx, level)
+}
+
+func (h *startupLatencyHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Message == computeworker.StartupLatencyMessage {
+		record.Attrs(func(a slog.Attr) bool {
+			latency, ok := computeworker.ParseStartupLatency(a)
+			if ok {
+				h.tracker.record(ctx, latency)
+			}
+			return !ok
+		})
+	}
+	if !h.inner.Enabled(ctx, record.Level) {
+		return nil
+	}
+	return h.inner.Handle(ctx, record)
+}
+
+func (h *startupLatencyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &startupLatencyHandler{inner: h.inner.WithAttrs(attrs), tracker: h.tracker}
+}
+
+func (h *startupLatencyHandler) WithGroup(name string) slog.Handler {
+	return &startupLatencyHandler{inner: h.inner.WithGroup(name), tracker: h.tracker}
+}
@@ -0,0 +1,80 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker"
+	"github.com/confidentsecurity/confidentcompute/debug"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartupLatencyTracker(t *testing.T) {
+	tracker, err := newStartupLatencyTracker(&StartupLatencyConfig{SLO: 100 * time.Millisecond, Samples: 4})
+	require.NoError(t, err)
+
+	for i := range 6 {
+		tracker.record(t.Context(), computeworker.StartupLatency{
+			TPMReceiverInit: time.Duration(i+1) * 10 * time.Millisecond,
+			BackendTTFB:     50 * time.Millisecond,
+		})
+	}
+	// a request served by a session worker.
+	tracker.record(t.Context(), computeworker.StartupLatency{BackendTTFB: time.Second})
+
+	stats := tracker.stats()
+	require.Equal(t, uint64(7), stats.Requests)
+	require.Equal(t, uint64(6), stats.ColdStarts)
+	require.Equal(t, uint64(1), stats.SLOViolations)
+	// only the latest 4 cold starts are sampled, 30 to 60ms.
+	require.Equal(t, LatencyPercentiles{P50: 40, P90: 60, P99: 60}, stats.Phases["tpm_receiver_init_ms"])
+	require.Equal(t, LatencyPercentiles{P50: 90, P90: 110, P99: 110}, stats.Phases["total_ms"])
+
+	_, err = newStartupLatencyTracker(&StartupLatencyConfig{})
+	require.Error(t, err)
+}
+
+func TestStartupLatencyHandler(t *testing.T) {
+	tracker, err := newStartupLatencyTracker(DefaultStartupLatencyConfig())
+	require.NoError(t, err)
+
+	var workerLogs bytes.Buffer
+	worker := slog.New(slog.NewJSONHandler(&workerLogs, nil))
+	worker.Info("Handling request")
+	worker.Info(computeworker.StartupLatencyMessage, computeworker.StartupLatencyKey, computeworker.StartupLatency{
+		FlagParse:   time.Millisecond,
+		BackendTTFB: 20 * time.Millisecond,
+	})
+
+	// the router_com log level hides info records, they are aggregated anyway.
+	var out bytes.Buffer
+	inner := slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: slog.LevelWarn})
+	logger := slog.New(&startupLatencyHandler{inner: inner, tracker: tracker})
+	require.NoError(t, debug.ForwardLogs(t.Context(), strings.NewReader(workerLogs.String()), logger))
+
+	stats := tracker.stats()
+	require.Equal(t, uint64(1), stats.Requests)
+	require.Equal(t, uint64(1), stats.ColdStarts)
+	require.InDelta(t, 21, stats.Phases["total_ms"].P50, 0.001)
+	require.Empty(t, out.String())
+}
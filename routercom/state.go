@@ -0,0 +1,218 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/routercom/capabilities"
+	"github.com/confidentsecurity/confidentcompute/routercom/modelstate"
+)
+
+// serviceState tracks the operational state of routercom. It never holds client data.
+type serviceState struct {
+	mu               sync.Mutex
+	draining         bool
+	registered       bool
+	queued           int
+	workers          map[int]time.Time
+	validationErrors map[string]uint64
+	exitCodes        map[int]uint64
+	slowClientAborts uint64
+	errorDetails     uint64
+	models           []modelstate.State
+	policy           *PolicyBundle
+	capabilities     *capabilities.Advertisement
+	shutdownReason   ShutdownReason
+}
+
+func newServiceState() *serviceState {
+	return &serviceState{
+		workers:          map[int]time.Time{},
+		validationErrors: map[string]uint64{},
+		exitCodes:        map[int]uint64{},
+	}
+}
+
+func (s *serviceState) setDraining(draining bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.draining = draining
+}
+
+// setRegistered records the router reached the node.
+func (s *serviceState) setRegistered() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.registered = true
+}
+
+func (s *serviceState) isRegistered() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.registered
+}
+
+func (s *serviceState) setModelStates(states []modelstate.State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.models = slices.Clone(states)
+}
+
+func (s *serviceState) modelStates() []modelstate.State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.models)
+}
+
+// setPolicy replaces the current policy, policies that are not newer than the current one are rejected.
+func (s *serviceState) setPolicy(policy *PolicyBundle) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := checkPolicyNewer(s.policy, policy); err != nil {
+		return err
+	}
+	s.policy = policy
+	return nil
+}
+
+func (s *serviceState) setCapabilities(adv *capabilities.Advertisement) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.capabilities = adv
+}
+
+func (s *serviceState) currentPolicy() *PolicyBundle {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.policy
+}
+
+// setShutdownReason records why router_com shuts down, the first reason wins.
+func (s *serviceState) setShutdownReason(reason ShutdownReason) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shutdownReason == "" {
+		s.shutdownReason = reason
+	}
+}
+
+func (s *serviceState) currentShutdownReason() (ShutdownReason, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shutdownReason, s.shutdownReason != ""
+}
+
+func (s *serviceState) isDraining() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.draining
+}
+
+// requestQueued records a request that is waiting for a worker to start.
+func (s *serviceState) requestQueued() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queued++
+}
+
+// requestDequeued records a request is no longer waiting for a worker to start.
+func (s *serviceState) requestDequeued() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queued--
+}
+
+func (s *serviceState) workerStarted(pid int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workers[pid] = time.Now()
+}
+
+func (s *serviceState) workerExited(pid int, exitCode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.workers, pid)
+	s.exitCodes[exitCode]++
+}
+
+// requestEnded records the exit code of a request that ran on a session worker.
+func (s *serviceState) requestEnded(exitCode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exitCodes[exitCode]++
+}
+
+// slowClientAborted counts a response that was ended early because the client read too slowly.
+func (s *serviceState) slowClientAborted() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.slowClientAborts++
+}
+
+// errorDetailReported counts a failure a worker reported to the client in the encrypted response.
+func (s *serviceState) errorDetailReported() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errorDetails++
+}
+
+// validationError counts a validation error. The reason must not contain client data.
+func (s *serviceState) validationError(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.validationErrors[reason]++
+}
+
+func (s *serviceState) snapshot() AdminStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := AdminStatus{
+		Draining:         s.draining,
+		QueueDepth:       s.queued,
+		Workers:          make([]AdminWorker, 0, len(s.workers)),
+		ValidationErrors: maps.Clone(s.validationErrors),
+		WorkerExitCodes:  make(map[string]uint64, len(s.exitCodes)),
+		Models:           slices.Clone(s.models),
+		Capabilities:     s.capabilities,
+		SlowClientAborts: s.slowClientAborts,
+		ErrorDetails:     s.errorDetails,
+	}
+
+	if s.policy != nil {
+		status.PolicyVersion = s.policy.Version
+	}
+
+	for _, pid := range slices.Sorted(maps.Keys(s.workers)) {
+		status.Workers = append(status.Workers, AdminWorker{
+			PID:       pid,
+			StartedAt: s.workers[pid],
+		})
+	}
+
+	for code, n := range s.exitCodes {
+		status.WorkerExitCodes[strconv.Itoa(code)] = n
+	}
+
+	return status
+}
@@ -0,0 +1,232 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/circl/hpke"
+	"github.com/cloudflare/circl/kem"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces config values that may hold secrets in a support bundle.
+const redacted = "[redacted]"
+
+// supportBundleInfo binds the HPKE context to support bundles, so a bundle can't be confused
+// with other messages sealed to the support key.
+var supportBundleInfo = []byte("confsec support bundle v1")
+
+const supportBundleKEM = hpke.KEM_X25519_HKDF_SHA256
+
+var supportBundleSuite = hpke.NewSuite(supportBundleKEM, hpke.KDF_HKDF_SHA256, hpke.AEAD_ChaCha20Poly1305)
+
+// secretConfigKeys are substrings of config keys whose values are redacted from support bundles.
+var secretConfigKeys = []string{"key", "secret", "token", "password", "auth"}
+
+// SupportBundle is the diagnostics collected for an incident escalation. It never contains client data.
+type SupportBundle struct {
+	CreatedAt time.Time `json:"created_at"`
+	// Config is the router_com config with values that may hold secrets redacted.
+	Config map[string]any `json:"config"`
+	// Status includes the evidence summary, the worker exit code histogram and the request counters.
+	Status AdminStatus `json:"status"`
+	// RecentMetrics are the samples of the load of the latest hour, oldest first. The last sample is
+	// taken when the bundle is created.
+	RecentMetrics []MetricsSample `json:"recent_metrics"`
+	// Goroutines is a dump of the stacks of all goroutines.
+	Goroutines string `json:"goroutines"`
+}
+
+// EncryptedSupportBundle is a JSON encoded SupportBundle sealed with HPKE to the support public key.
+type EncryptedSupportBundle struct {
+	EncapsulatedKey []byte `json:"encapsulated_key"`
+	Ciphertext      []byte `json:"ciphertext"`
+}
+
+// ParseSupportPublicKey parses a base64 encoded X25519 public key.
+func ParseSupportPublicKey(s string) (kem.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode support public key: %w", err)
+	}
+	pubKey, err := supportBundleKEM.Scheme().UnmarshalBinaryPublicKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal support public key: %w", err)
+	}
+	return pubKey, nil
+}
+
+// SupportBundle collects the diagnostics of the service.
+func (s *Service) SupportBundle() (*SupportBundle, error) {
+	config, err := redactConfig(s.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to redact config: %w", err)
+	}
+
+	var goroutines bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&goroutines, 2); err != nil {
+		return nil, fmt.Errorf("failed to dump goroutines: %w", err)
+	}
+
+	now := time.Now()
+	status := s.AdminStatus()
+	var recent []MetricsSample
+	if s.recentMetrics != nil {
+		recent = s.recentMetrics.samples()
+	}
+	recent = append(recent, newMetricsSample(now, status))
+
+	return &SupportBundle{
+		CreatedAt:     now.UTC(),
+		Config:        config,
+		Status:        status,
+		RecentMetrics: recent,
+		Goroutines:    goroutines.String(),
+	}, nil
+}
+
+// SealSupportBundle encrypts the bundle to the support public key.
+func SealSupportBundle(pubKey kem.PublicKey, bundle *SupportBundle) (*EncryptedSupportBundle, error) {
+	plaintext, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal support bundle: %w", err)
+	}
+
+	sender, err := supportBundleSuite.NewSender(pubKey, supportBundleInfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create hpke sender: %w", err)
+	}
+	encapKey, sealer, err := sender.Setup(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup hpke sender: %w", err)
+	}
+	ciphertext, err := sealer.Seal(plaintext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to seal support bundle: %w", err)
+	}
+
+	return &EncryptedSupportBundle{
+		EncapsulatedKey: encapKey,
+		Ciphertext:      ciphertext,
+	}, nil
+}
+
+// OpenSupportBundle decrypts a bundle with the support private key.
+func OpenSupportBundle(privKey kem.PrivateKey, encrypted *EncryptedSupportBundle) (*SupportBundle, error) {
+	receiver, err := supportBundleSuite.NewReceiver(privKey, supportBundleInfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create hpke receiver: %w", err)
+	}
+	opener, err := receiver.Setup(encrypted.EncapsulatedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup hpke receiver: %w", err)
+	}
+	plaintext, err := opener.Open(encrypted.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open support bundle: %w", err)
+	}
+
+	var bundle SupportBundle
+	if err := json.Unmarshal(plaintext, &bundle); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal support bundle: %w", err)
+	}
+	return &bundle, nil
+}
+
+// redactConfig converts the config to a generic map and redacts the values that may hold
+// secrets: values of secret looking keys, and credentials and query strings in URLs.
+func redactConfig(cfg *Config) (map[string]any, error) {
+	if cfg == nil {
+		return nil, errors.New("missing config")
+	}
+
+	b, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]any
+	if err := yaml.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+
+	redactValue("", out)
+	return out, nil
+}
+
+func redactValue(key string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = redactValue(k, item)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = redactValue(key, item)
+		}
+		return v
+	case string:
+		if v == "" {
+			return v
+		}
+		if isSecretConfigKey(key) {
+			return redacted
+		}
+		return redactURL(v)
+	default:
+		return v
+	}
+}
+
+func isSecretConfigKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range secretConfigKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURL strips the credentials and query of absolute URLs, other values are returned as is.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return s
+	}
+	if u.User == nil && u.RawQuery == "" {
+		return s
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = redacted
+	}
+	return u.String()
+}
@@ -0,0 +1,127 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker"
+	"github.com/openpcc/openpcc/httpfmt"
+)
+
+const (
+	// maxCreditGrantSize bounds the size of a credit grant accepted from the router.
+	maxCreditGrantSize = 4096
+	// creditGrantWriteTimeout bounds writing a grant to a worker that doesn't read its grant pipe.
+	creditGrantWriteTimeout = time.Second
+)
+
+// errNoCreditGrantPipe is returned for grants of requests that are not running on this node.
+var errNoCreditGrantPipe = errors.New("no running request with this encapsulated key")
+
+// creditGrantPipes are the write ends of the credit grant pipes of running compute_workers, keyed by
+// the encapsulated key of their request. router_com only passes grants on, the worker verifies their
+// signature and claims them with the nonce ledger.
+type creditGrantPipes struct {
+	mu    sync.Mutex
+	pipes map[string]*os.File
+}
+
+func newCreditGrantPipes() *creditGrantPipes {
+	return &creditGrantPipes{pipes: map[string]*os.File{}}
+}
+
+// register adds the pipe of a request, it fails when another running request has the same
+// encapsulated key.
+func (p *creditGrantPipes) register(encapsulatedKey []byte, w *os.File) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.pipes[string(encapsulatedKey)]; ok {
+		return false
+	}
+	p.pipes[string(encapsulatedKey)] = w
+	return true
+}
+
+// unregister removes the pipe of a request and closes it.
+func (p *creditGrantPipes) unregister(encapsulatedKey []byte, w *os.File) {
+	p.mu.Lock()
+	if p.pipes[string(encapsulatedKey)] == w {
+		delete(p.pipes, string(encapsulatedKey))
+	}
+	p.mu.Unlock()
+
+	if err := w.Close(); err != nil {
+		slog.Warn("failed to close credit grant pipe", "error", err)
+	}
+}
+
+// send writes a grant as a JSON line to the pipe of its request.
+func (p *creditGrantPipes) send(grant computeworker.CreditGrant) error {
+	line, err := json.Marshal(grant)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	// the lock also keeps grants of a request from interleaving.
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	w, ok := p.pipes[string(grant.EncapsulatedKey)]
+	if !ok {
+		return errNoCreditGrantPipe
+	}
+	if err := w.SetWriteDeadline(time.Now().Add(creditGrantWriteTimeout)); err != nil {
+		return err
+	}
+	_, err = w.Write(line)
+	return err
+}
+
+// creditGrantHandler passes credit grants from the router on to the running compute_worker of
+// their request.
+func (s *Service) creditGrantHandler(w http.ResponseWriter, r *http.Request) {
+	if s.creditGrants == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var grant computeworker.CreditGrant
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCreditGrantSize)).Decode(&grant); err != nil || len(grant.EncapsulatedKey) == 0 {
+		httpfmt.BinaryBadRequest(w, r, "invalid credit grant")
+		return
+	}
+
+	err := s.creditGrants.send(grant)
+	switch {
+	case errors.Is(err, errNoCreditGrantPipe):
+		httpfmt.BinaryBadRequest(w, r, "request is not running")
+	case err != nil:
+		// the worker exited or stopped reading, the response is about to end anyway.
+		slog.WarnContext(r.Context(), "Failed to pass on credit grant", "error", err)
+		httpfmt.BinaryBadRequest(w, r, "request is not running")
+	default:
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
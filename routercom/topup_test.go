@@ -0,0 +1,94 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreditGrantHandler(t *testing.T) {
+	newService := func() *Service {
+		svc := &Service{
+			config:       &Config{Worker: &WorkerConfig{MaxTopUpCredits: 100}},
+			state:        newServiceState(),
+			creditGrants: newCreditGrantPipes(),
+		}
+		setupHandlers(svc)
+		return svc
+	}
+
+	post := func(t *testing.T, svc *Service, body []byte) int {
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/_credit_grant", bytes.NewReader(body)))
+		return rec.Code
+	}
+
+	grant := computeworker.CreditGrant{EncapsulatedKey: []byte("encapsulated-key"), Sequence: 1, CreditAmount: 10, Signature: []byte("sig")}
+	body, err := json.Marshal(grant)
+	require.NoError(t, err)
+
+	t.Run("ok, grant is passed on to the worker", func(t *testing.T) {
+		svc := newService()
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		defer r.Close()
+		require.True(t, svc.creditGrants.register(grant.EncapsulatedKey, w))
+		defer svc.creditGrants.unregister(grant.EncapsulatedKey, w)
+
+		require.Equal(t, http.StatusAccepted, post(t, svc, body))
+
+		line, err := bufio.NewReader(r).ReadBytes('\n')
+		require.NoError(t, err)
+		var got computeworker.CreditGrant
+		require.NoError(t, json.Unmarshal(line, &got))
+		require.Equal(t, grant, got)
+	})
+
+	t.Run("fail, request is not running", func(t *testing.T) {
+		require.Equal(t, http.StatusBadRequest, post(t, newService(), body))
+	})
+
+	t.Run("fail, encapsulated key is already registered", func(t *testing.T) {
+		svc := newService()
+		_, w, err := os.Pipe()
+		require.NoError(t, err)
+		require.True(t, svc.creditGrants.register(grant.EncapsulatedKey, w))
+		require.False(t, svc.creditGrants.register(grant.EncapsulatedKey, w))
+		svc.creditGrants.unregister(grant.EncapsulatedKey, w)
+		require.Equal(t, http.StatusBadRequest, post(t, svc, body))
+	})
+
+	t.Run("fail, malformed grant", func(t *testing.T) {
+		require.Equal(t, http.StatusBadRequest, post(t, newService(), []byte("{")))
+	})
+
+	t.Run("fail, top-ups disabled", func(t *testing.T) {
+		svc := newService()
+		svc.creditGrants = nil
+		require.Equal(t, http.StatusNotFound, post(t, svc, body))
+	})
+}
@@ -0,0 +1,126 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routercom
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/confidentsecurity/confidentcompute/computeworker/output"
+	"github.com/confidentsecurity/confidentcompute/computeworker/output/wire"
+	"github.com/confidentsecurity/confidentcompute/computeworker/testkit"
+	"github.com/openpcc/openpcc/ahttp"
+	"github.com/openpcc/openpcc/router/api"
+	"github.com/stretchr/testify/require"
+)
+
+// testWorkerKeyEnv makes the test binary act as a compute_worker that writes testWorkerChunks,
+// authenticated with the hex encoded MAC key in the variable. See TestMain.
+const testWorkerKeyEnv = "ROUTERCOM_TEST_WORKER_KEY"
+
+// testWorkerChunks are the writes of the test worker, the encoder splits the large one further.
+var testWorkerChunks = []string{"hello ", strings.Repeat("a", 3*wire.MaxChunkLen/2), " world"}
+
+func TestMain(m *testing.M) {
+	if key, ok := os.LookupEnv(testWorkerKeyEnv); ok {
+		os.Exit(runTestWorker(key))
+	}
+	os.Exit(m.Run())
+}
+
+// runTestWorker writes the output of a compute_worker to stdout and returns the exit code.
+func runTestWorker(hexKey string) int {
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return 1
+	}
+	// the request is never decapsulated, but it is read like the worker does.
+	if _, err := io.Copy(io.Discard, os.Stdin); err != nil {
+		return 1
+	}
+
+	enc, err := output.NewEncoderWithKey(output.Header{MediaType: "application/octet-stream", MaxChunkLen: 1024}, os.Stdout, key)
+	if err != nil {
+		return 1
+	}
+	for _, chunk := range testWorkerChunks {
+		if _, err := enc.Write([]byte(chunk)); err != nil {
+			return 1
+		}
+	}
+	if err := enc.Close(output.Footer{Model: "llama3.2:1b"}); err != nil {
+		return 1
+	}
+	return 0
+}
+
+func TestGenerateHandlerTranscript(t *testing.T) {
+	key := bytes.Repeat([]byte{0x01}, wire.MACKeyLen)
+	t.Setenv(testWorkerKeyEnv, hex.EncodeToString(key))
+
+	svc := &Service{
+		config: &Config{
+			TPM:    &TPM{},
+			Worker: &WorkerConfig{BinaryPath: os.Args[0]},
+		},
+		state:      newServiceState(),
+		commandsWG: &sync.WaitGroup{},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(svc.generateHandler))
+	defer srv.Close()
+	defer svc.commandsWG.Wait()
+
+	clientReq := testkit.NewJSONRequest(t, "http://confsec.invalid/v1/chat/completions", `{}`, "")
+	encapsulated := testkit.NewNode(t).EncapsulateRequest(t, clientReq)
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, srv.URL, encapsulated.Ciphertext)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", encapsulated.MediaType)
+	req.Header.Set(api.EncapsulatedKeyHeader, base64.StdEncoding.EncodeToString(encapsulated.EncapsulatedKey))
+	req.Header.Set(ahttp.NodeCreditAmountHeader, strconv.Itoa(100))
+
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// the client reads the body however the connection delivers it, not in the chunks of the worker.
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, strings.Join(testWorkerChunks, ""), string(body))
+
+	trailer := func(name string) []byte {
+		b, err := base64.StdEncoding.DecodeString(resp.Trailer.Get(name))
+		require.NoError(t, err)
+		require.NotEmpty(t, b)
+		return b
+	}
+	header, footer, tag := trailer(ResponseOutputHeaderTrailer), trailer(ResponseOutputFooterTrailer), trailer(ResponseOutputTagTrailer)
+
+	require.NoError(t, wire.VerifyTranscript(key, header, body, footer, tag))
+	require.ErrorIs(t, wire.VerifyTranscript(key, header, body[:len(body)-1], footer, tag), wire.ErrChunkTagMismatch)
+}
@@ -0,0 +1,394 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sealedconfig loads YAML configs that are encrypted at rest with a key that is sealed
+// to the TPM of the machine that created them.
+//
+// A sealed config is a magic prefix followed by a JSON envelope. The envelope contains the
+// AES-256-GCM encrypted config and the TPM sealed data key. The data key is a keyedhash object
+// created under the (deterministic) ECC storage root key, so it can only be unsealed by the TPM
+// that sealed it. The data key has no auth value, its policy requires the boot PCRs to hold the
+// values they had when the config was sealed, so a machine booted into a different firmware,
+// bootloader or kernel can't unseal it.
+//
+// Configs that don't start with the magic prefix are treated as plaintext, this keeps local
+// development without a TPM working.
+package sealedconfig
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/confidentsecurity/confidentcompute/tpmerr"
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+	"github.com/google/go-tpm/tpmutil"
+)
+
+const (
+	// Magic is the prefix that identifies a sealed config.
+	Magic = "CONFSEC-SEALED-CONFIG-V1\n"
+	// DefaultTPMDevice is the TPM device used to unseal configs.
+	DefaultTPMDevice = "/dev/tpmrm0"
+
+	dataKeySize = 32
+	// runtimeDir is where unsealed configs are written, it must be a tmpfs.
+	runtimeDir = "/run"
+)
+
+// BootPCRs are the PCRs data keys are sealed to. They hold the measurements of the firmware,
+// bootloader and secure boot state, and are not extended by compute_boot.
+var BootPCRs = []uint{0, 1, 2, 3, 4, 5, 6, 7}
+
+type envelope struct {
+	// PCRs are the PCRs the data key is sealed to.
+	PCRs          []uint `json:"pcrs"`
+	SealedPublic  []byte `json:"sealed_public"`
+	SealedPrivate []byte `json:"sealed_private"`
+	Nonce         []byte `json:"nonce"`
+	Ciphertext    []byte `json:"ciphertext"`
+}
+
+// IsSealed reports whether data is a sealed config.
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// Seal encrypts plaintext with a fresh data key and seals the data key to the TPM and the current
+// values of BootPCRs.
+func Seal(thetpm transport.TPM, plaintext []byte) ([]byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	pcrs := slices.Clone(BootPCRs)
+	policy, err := pcrPolicyDigest(thetpm, pcrs)
+	if err != nil {
+		return nil, err
+	}
+
+	srk, err := createSRK(thetpm)
+	if err != nil {
+		return nil, err
+	}
+	defer flush(thetpm, srk.ObjectHandle)
+
+	createRsp, err := tpm2.Create{
+		ParentHandle: tpm2.NamedHandle{
+			Handle: srk.ObjectHandle,
+			Name:   srk.Name,
+		},
+		InSensitive: tpm2.TPM2BSensitiveCreate{
+			Sensitive: &tpm2.TPMSSensitiveCreate{
+				Data: tpm2.NewTPMUSensitiveCreate(&tpm2.TPM2BSensitiveData{
+					Buffer: dataKey,
+				}),
+			},
+		},
+		InPublic: tpm2.New2B(tpm2.TPMTPublic{
+			Type:    tpm2.TPMAlgKeyedHash,
+			NameAlg: tpm2.TPMAlgSHA256,
+			ObjectAttributes: tpm2.TPMAObject{
+				FixedTPM:    true,
+				FixedParent: true,
+				NoDA:        true,
+			},
+			AuthPolicy: tpm2.TPM2BDigest{Buffer: policy},
+		}),
+	}.Execute(thetpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to seal data key: %w", err)
+	}
+
+	env := envelope{
+		PCRs:          pcrs,
+		SealedPublic:  tpm2.Marshal(createRsp.OutPublic),
+		SealedPrivate: tpm2.Marshal(createRsp.OutPrivate),
+		Nonce:         nonce,
+		Ciphertext:    aead.Seal(nil, nonce, plaintext, []byte(Magic)),
+	}
+
+	data, err := json.Marshal(env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal sealed config: %w", err)
+	}
+
+	return append([]byte(Magic), data...), nil
+}
+
+// Unseal unseals the data key with the TPM and decrypts the sealed config.
+func Unseal(thetpm transport.TPM, data []byte) ([]byte, error) {
+	if !IsSealed(data) {
+		return nil, errors.New("not a sealed config")
+	}
+
+	var env envelope
+	if err := json.Unmarshal(data[len(Magic):], &env); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal sealed config: %w", err)
+	}
+
+	if len(env.PCRs) == 0 {
+		return nil, errors.New("sealed config is not bound to any pcrs, seal it again")
+	}
+
+	sealedPublic, err := tpm2.Unmarshal[tpm2.TPM2BPublic](env.SealedPublic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal sealed public area: %w", err)
+	}
+
+	sealedPrivate, err := tpm2.Unmarshal[tpm2.TPM2BPrivate](env.SealedPrivate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal sealed private area: %w", err)
+	}
+
+	srk, err := createSRK(thetpm)
+	if err != nil {
+		return nil, err
+	}
+	defer flush(thetpm, srk.ObjectHandle)
+
+	loadRsp, err := tpm2.Load{
+		ParentHandle: tpm2.NamedHandle{
+			Handle: srk.ObjectHandle,
+			Name:   srk.Name,
+		},
+		InPrivate: *sealedPrivate,
+		InPublic:  *sealedPublic,
+	}.Execute(thetpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sealed data key, was the config sealed on this machine?: %w", err)
+	}
+	defer flush(thetpm, loadRsp.ObjectHandle)
+
+	sess, closeSess, err := tpm2.PolicySession(thetpm, tpm2.TPMAlgSHA256, 16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start policy session: %w", err)
+	}
+	defer func() {
+		if err := closeSess(); err != nil {
+			slog.Error("Failed to close policy session", "err", err)
+		}
+	}()
+
+	_, err = tpm2.PolicyPCR{
+		PolicySession: sess.Handle(),
+		Pcrs:          pcrSelection(env.PCRs),
+	}.Execute(thetpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply pcr policy: %w", err)
+	}
+
+	unsealRsp, err := tpm2.Unseal{
+		ItemHandle: tpm2.AuthHandle{
+			Handle: loadRsp.ObjectHandle,
+			Name:   loadRsp.Name,
+			Auth:   sess,
+		},
+	}.Execute(thetpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unseal data key, have the boot pcrs changed since the config was sealed?: %w", err)
+	}
+
+	aead, err := newAEAD(unsealRsp.OutData.Buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := aead.Open(nil, env.Nonce, env.Ciphertext, []byte(Magic))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt sealed config: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// Resolve returns the path of a plaintext config for configFile. Plaintext configs are returned as-is.
+// Sealed configs are unsealed with the TPM at tpmDevice and written to a temporary file in /run that is
+// only readable by the current user. Resolve fails when /run is not a tmpfs, so unsealed configs never
+// hit the disk. The returned cleanup function removes the temporary file and should be called as soon
+// as the config has been loaded.
+func Resolve(configFile string, tpmDevice string) (string, func() error, error) {
+	noop := func() error { return nil }
+	if configFile == "" {
+		return configFile, noop, nil
+	}
+
+	// #nosec G304 -- config file is provided by the operator.
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if !IsSealed(data) {
+		slog.Info("Using plaintext config", "file", configFile)
+		return configFile, noop, nil
+	}
+
+	plaintext, err := unsealWithDevice(tpmDevice, data)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// config.Load determines the format from the file extension, so the plaintext has to go to a file.
+	tmpfs, err := isTmpfs(runtimeDir)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to check file system of %s: %w", runtimeDir, err)
+	}
+	if !tmpfs {
+		return "", nil, fmt.Errorf("refusing to write unsealed config to %s, it is not a tmpfs", runtimeDir)
+	}
+
+	f, err := os.CreateTemp(runtimeDir, "config-*"+filepath.Ext(configFile))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create unsealed config file: %w", err)
+	}
+
+	cleanup := func() error {
+		return os.Remove(f.Name())
+	}
+
+	_, err = f.Write(plaintext)
+	err = errors.Join(err, f.Close())
+	if err != nil {
+		return "", nil, errors.Join(fmt.Errorf("failed to write unsealed config file: %w", err), cleanup())
+	}
+
+	slog.Info("Unsealed config with TPM", "file", configFile)
+	return f.Name(), cleanup, nil
+}
+
+// ReadFile reads a file that may have been sealed with Seal, such as a secret. Sealed files are
+// unsealed in memory with the TPM at tpmDevice, plaintext files are returned as-is.
+func ReadFile(file string, tpmDevice string) ([]byte, error) {
+	// #nosec G304 -- file is provided by the operator.
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	if !IsSealed(data) {
+		return data, nil
+	}
+
+	return unsealWithDevice(tpmDevice, data)
+}
+
+func unsealWithDevice(tpmDevice string, data []byte) ([]byte, error) {
+	if tpmDevice == "" {
+		tpmDevice = DefaultTPMDevice
+	}
+
+	rwc, err := tpmutil.OpenTPM(tpmDevice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tpm to unseal config: %w", err)
+	}
+	thetpm := tpmerr.NewRetryingTPM(transport.FromReadWriteCloser(rwc), tpmerr.DefaultPolicy)
+	defer func() {
+		if err := thetpm.Close(); err != nil {
+			slog.Error("Failed to close tpm", "err", err)
+		}
+	}()
+
+	return Unseal(thetpm, data)
+}
+
+// pcrPolicyDigest returns the digest of a policy that requires pcrs to hold their current values.
+func pcrPolicyDigest(thetpm transport.TPM, pcrs []uint) ([]byte, error) {
+	sess, closeSess, err := tpm2.PolicySession(thetpm, tpm2.TPMAlgSHA256, 16, tpm2.Trial())
+	if err != nil {
+		return nil, fmt.Errorf("failed to start trial policy session: %w", err)
+	}
+	defer func() {
+		if err := closeSess(); err != nil {
+			slog.Error("Failed to close trial policy session", "err", err)
+		}
+	}()
+
+	_, err = tpm2.PolicyPCR{
+		PolicySession: sess.Handle(),
+		Pcrs:          pcrSelection(pcrs),
+	}.Execute(thetpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute pcr policy: %w", err)
+	}
+
+	rsp, err := tpm2.PolicyGetDigest{PolicySession: sess.Handle()}.Execute(thetpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pcr policy digest: %w", err)
+	}
+	return rsp.PolicyDigest.Buffer, nil
+}
+
+func pcrSelection(pcrs []uint) tpm2.TPMLPCRSelection {
+	return tpm2.TPMLPCRSelection{
+		PCRSelections: []tpm2.TPMSPCRSelection{
+			{Hash: tpm2.TPMAlgSHA256, PCRSelect: tpm2.PCClientCompatible.PCRs(pcrs...)},
+		},
+	}
+}
+
+// createSRK creates the ECC storage root key. The SRK is derived from the owner seed,
+// so the same key is created every time on the same TPM.
+func createSRK(thetpm transport.TPM) (*tpm2.CreatePrimaryResponse, error) {
+	rsp, err := tpm2.CreatePrimary{
+		PrimaryHandle: tpm2.TPMRHOwner,
+		InPublic:      tpm2.New2B(tpm2.ECCSRKTemplate),
+	}.Execute(thetpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage root key: %w", err)
+	}
+	return rsp, nil
+}
+
+func flush(thetpm transport.TPM, handle tpm2.TPMHandle) {
+	if _, err := (tpm2.FlushContext{FlushHandle: handle}).Execute(thetpm); err != nil {
+		slog.Error("Failed to flush context", "err", err)
+	}
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcm: %w", err)
+	}
+	return aead, nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sealedconfig_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/confidentsecurity/confidentcompute/sealedconfig"
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport/simulator"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealUnseal(t *testing.T) {
+	plaintext := []byte("router_com:\n  badge_public_key: secret\n")
+
+	t.Run("ok, roundtrip", func(t *testing.T) {
+		thetpm, err := simulator.OpenSimulator()
+		require.NoError(t, err)
+		defer thetpm.Close()
+
+		sealed, err := sealedconfig.Seal(thetpm, plaintext)
+		require.NoError(t, err)
+		require.True(t, sealedconfig.IsSealed(sealed))
+		require.NotContains(t, string(sealed), "secret")
+
+		got, err := sealedconfig.Unseal(thetpm, sealed)
+		require.NoError(t, err)
+		require.Equal(t, plaintext, got)
+	})
+
+	t.Run("fail, unseal on a different tpm", func(t *testing.T) {
+		tpm1, err := simulator.OpenSimulator()
+		require.NoError(t, err)
+		sealed, err := sealedconfig.Seal(tpm1, plaintext)
+		require.NoError(t, err)
+		require.NoError(t, tpm1.Close())
+
+		tpm2, err := simulator.OpenSimulator()
+		require.NoError(t, err)
+		defer tpm2.Close()
+
+		_, err = sealedconfig.Unseal(tpm2, sealed)
+		require.Error(t, err)
+	})
+
+	t.Run("fail, boot pcr changed", func(t *testing.T) {
+		thetpm, err := simulator.OpenSimulator()
+		require.NoError(t, err)
+		defer thetpm.Close()
+
+		sealed, err := sealedconfig.Seal(thetpm, plaintext)
+		require.NoError(t, err)
+
+		_, err = tpm2.PCRExtend{
+			PCRHandle: tpm2.AuthHandle{
+				Handle: tpm2.TPMHandle(sealedconfig.BootPCRs[len(sealedconfig.BootPCRs)-1]),
+				Auth:   tpm2.PasswordAuth(nil),
+			},
+			Digests: tpm2.TPMLDigestValues{
+				Digests: []tpm2.TPMTHA{{HashAlg: tpm2.TPMAlgSHA256, Digest: make([]byte, 32)}},
+			},
+		}.Execute(thetpm)
+		require.NoError(t, err)
+
+		_, err = sealedconfig.Unseal(thetpm, sealed)
+		require.Error(t, err)
+	})
+
+	t.Run("ok, pcr outside of the boot pcrs changed", func(t *testing.T) {
+		thetpm, err := simulator.OpenSimulator()
+		require.NoError(t, err)
+		defer thetpm.Close()
+
+		sealed, err := sealedconfig.Seal(thetpm, plaintext)
+		require.NoError(t, err)
+
+		_, err = tpm2.PCRExtend{
+			PCRHandle: tpm2.AuthHandle{
+				Handle: tpm2.TPMHandle(14),
+				Auth:   tpm2.PasswordAuth(nil),
+			},
+			Digests: tpm2.TPMLDigestValues{
+				Digests: []tpm2.TPMTHA{{HashAlg: tpm2.TPMAlgSHA256, Digest: make([]byte, 32)}},
+			},
+		}.Execute(thetpm)
+		require.NoError(t, err)
+
+		got, err := sealedconfig.Unseal(thetpm, sealed)
+		require.NoError(t, err)
+		require.Equal(t, plaintext, got)
+	})
+
+	t.Run("fail, tampered ciphertext", func(t *testing.T) {
+		thetpm, err := simulator.OpenSimulator()
+		require.NoError(t, err)
+		defer thetpm.Close()
+
+		sealed, err := sealedconfig.Seal(thetpm, plaintext)
+		require.NoError(t, err)
+		sealed[len(sealed)-5] ^= 0x01
+
+		_, err = sealedconfig.Unseal(thetpm, sealed)
+		require.Error(t, err)
+	})
+
+	t.Run("fail, plaintext config", func(t *testing.T) {
+		thetpm, err := simulator.OpenSimulator()
+		require.NoError(t, err)
+		defer thetpm.Close()
+
+		_, err = sealedconfig.Unseal(thetpm, plaintext)
+		require.Error(t, err)
+	})
+}
+
+func TestResolvePlaintext(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("models: []\n"), 0o600))
+
+	got, cleanup, err := sealedconfig.Resolve(configFile, "/dev/does-not-exist")
+	require.NoError(t, err)
+	require.Equal(t, configFile, got)
+	require.NoError(t, cleanup())
+
+	// cleanup must not remove plaintext configs.
+	_, err = os.Stat(configFile)
+	require.NoError(t, err)
+}
+
+func TestReadFilePlaintext(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(file, []byte("Bearer secret\n"), 0o600))
+
+	got, err := sealedconfig.ReadFile(file, "/dev/does-not-exist")
+	require.NoError(t, err)
+	require.Equal(t, []byte("Bearer secret\n"), got)
+
+	_, err = sealedconfig.ReadFile(filepath.Join(t.TempDir(), "missing"), "/dev/does-not-exist")
+	require.Error(t, err)
+}
@@ -0,0 +1,317 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tpmbroker serializes TPM access between compute_worker processes. Under load many
+// workers contend for the TPM resource manager and latency spikes, so router_com runs a Broker
+// on a unix socket and workers hold a lease from it while they use the TPM.
+//
+// The protocol is minimal: a worker connects, the broker answers with a single status byte
+// once the lease is granted or the queue timeout expired, and the lease is released when the
+// worker closes the connection.
+package tpmbroker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/listen"
+	"github.com/confidentsecurity/confidentcompute/tpmerr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	DefaultQueueTimeout = 5 * time.Second
+	DefaultOpTimeout    = 5 * time.Second
+	DefaultCloseTimeout = 10 * time.Second
+)
+
+// meterName is the instrumentation scope of the broker metrics.
+const meterName = "github.com/confidentsecurity/confidentcompute/tpmbroker"
+
+// queueDepthGauge reports Stats.QueueDepth of the running broker.
+var queueDepthGauge, _ = otel.Meter(meterName).Int64ObservableGauge("tpmbroker.queue_depth",
+	metric.WithDescription("Workers waiting for a TPM lease"),
+)
+
+// status bytes sent by the broker.
+const (
+	statusGranted      byte = 1
+	statusQueueTimeout byte = 2
+)
+
+var (
+	// ErrQueueTimeout is returned when no lease was granted within the queue timeout.
+	ErrQueueTimeout = fmt.Errorf("%w: timed out waiting for tpm access", tpmerr.ErrBusy)
+	// ErrOpTimeout is returned when a TPM operation did not finish within the operation timeout.
+	ErrOpTimeout = fmt.Errorf("%w: tpm operation timed out", tpmerr.ErrBusy)
+)
+
+// Config is config for the TPM access broker.
+type Config struct {
+	// Socket is the unix socket the broker listens on. Leave blank to disable the broker.
+	Socket string `yaml:"socket"`
+	// MaxConcurrent is the number of leases that are held at the same time. Defaults to 1.
+	MaxConcurrent int `yaml:"max_concurrent"`
+	// QueueTimeout is how long a worker waits for a lease.
+	QueueTimeout time.Duration `yaml:"queue_timeout"`
+	// OpTimeout is how long a worker may use the TPM. The worker gives up on operations that take
+	// longer. TPM commands can't be interrupted, so the broker reports leases that are held longer
+	// but only hands them out again once the worker released them.
+	OpTimeout time.Duration `yaml:"op_timeout"`
+	// CloseTimeout is how long Close waits for held leases to be released before it revokes them
+	// by closing the connections of their workers. Leave 0 to revoke them right away.
+	CloseTimeout time.Duration `yaml:"close_timeout"`
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Socket:        "",
+		MaxConcurrent: 1,
+		QueueTimeout:  DefaultQueueTimeout,
+		OpTimeout:     DefaultOpTimeout,
+		CloseTimeout:  DefaultCloseTimeout,
+	}
+}
+
+// Stats describes the load on the broker.
+type Stats struct {
+	// QueueDepth is the number of workers waiting for a lease.
+	QueueDepth int `json:"queue_depth"`
+	// Active is the number of leases currently held.
+	Active int `json:"active"`
+	// Granted is the number of leases granted since the broker started.
+	Granted uint64 `json:"granted"`
+	// QueueTimeouts is the number of workers that gave up waiting for a lease.
+	QueueTimeouts uint64 `json:"queue_timeouts"`
+	// OpTimeouts is the number of leases that were held longer than the operation timeout.
+	OpTimeouts uint64 `json:"op_timeouts"`
+	// WaitMillis is the total time workers waited for a lease.
+	WaitMillis int64 `json:"wait_ms"`
+	// HoldMillis is the total time workers held a lease.
+	HoldMillis int64 `json:"hold_ms"`
+}
+
+// Broker grants TPM leases to workers.
+type Broker struct {
+	cfg      *Config
+	slots    chan struct{}
+	listener net.Listener
+	metrics  metric.Registration
+	wg       sync.WaitGroup
+	// closing is closed by Close, queued workers stop waiting for a lease.
+	closing chan struct{}
+
+	mu    sync.Mutex
+	stats Stats
+	// conns are the connections of the queued workers and the lease holders.
+	conns map[net.Conn]struct{}
+}
+
+func New(cfg *Config) *Broker {
+	return &Broker{
+		cfg:     cfg,
+		slots:   make(chan struct{}, max(cfg.MaxConcurrent, 1)),
+		closing: make(chan struct{}),
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Start starts listening on the configured socket and grants leases in the background.
+func (b *Broker) Start() error {
+	if b.cfg.Socket == "" {
+		return errors.New("missing tpm broker socket")
+	}
+
+	// compute_worker runs as the same user as router_com.
+	listener, err := listen.UnixSocket(b.cfg.Socket, 0o600).Listen()
+	if err != nil {
+		return fmt.Errorf("failed to listen on tpm broker socket: %w", err)
+	}
+
+	metrics, err := otel.Meter(meterName).RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(queueDepthGauge, int64(b.Stats().QueueDepth))
+		return nil
+	}, queueDepthGauge)
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to register tpm broker metrics: %w", err), listener.Close())
+	}
+
+	b.listener = listener
+	b.metrics = metrics
+	slog.Info("Serving TPM broker", "socket", b.cfg.Socket, "max_concurrent", cap(b.slots))
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		b.serve(listener)
+	}()
+
+	return nil
+}
+
+func (b *Broker) serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("tpm broker stopped unexpectedly", "error", err)
+			}
+			return
+		}
+
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			b.handle(conn)
+		}()
+	}
+}
+
+// handle queues conn for a lease and holds the lease until the worker closes conn. The TPM
+// command of a worker that exceeds the operation timeout may still be running, so its lease is
+// only reported and not handed out again.
+func (b *Broker) handle(conn net.Conn) {
+	defer conn.Close()
+
+	b.mu.Lock()
+	select {
+	case <-b.closing:
+		b.mu.Unlock()
+		return
+	default:
+	}
+	b.conns[conn] = struct{}{}
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.conns, conn)
+		b.mu.Unlock()
+	}()
+
+	b.update(func(s *Stats) { s.QueueDepth++ })
+	queuedAt := time.Now()
+
+	var timeout <-chan time.Time
+	if b.cfg.QueueTimeout > 0 {
+		timer := time.NewTimer(b.cfg.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case b.slots <- struct{}{}:
+	case <-timeout:
+		b.update(func(s *Stats) {
+			s.QueueDepth--
+			s.QueueTimeouts++
+			s.WaitMillis += time.Since(queuedAt).Milliseconds()
+		})
+		_, _ = conn.Write([]byte{statusQueueTimeout})
+		return
+	case <-b.closing:
+		// the worker sees the connection close without a lease.
+		b.update(func(s *Stats) { s.QueueDepth-- })
+		return
+	}
+
+	grantedAt := time.Now()
+	b.update(func(s *Stats) {
+		s.QueueDepth--
+		s.Active++
+		s.Granted++
+		s.WaitMillis += grantedAt.Sub(queuedAt).Milliseconds()
+	})
+	defer func() {
+		<-b.slots
+		b.update(func(s *Stats) {
+			s.Active--
+			s.HoldMillis += time.Since(grantedAt).Milliseconds()
+		})
+	}()
+
+	if _, err := conn.Write([]byte{statusGranted}); err != nil {
+		// the worker is gone, release the lease right away.
+		return
+	}
+
+	if b.cfg.OpTimeout > 0 {
+		_ = conn.SetReadDeadline(grantedAt.Add(b.cfg.OpTimeout))
+	}
+
+	// workers don't send anything, the read returns when the worker releases the lease.
+	_, err := io.Copy(io.Discard, conn)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		slog.Warn("TPM lease held longer than the operation timeout, waiting for the worker to release it", "op_timeout", b.cfg.OpTimeout)
+		b.update(func(s *Stats) { s.OpTimeouts++ })
+		_ = conn.SetReadDeadline(time.Time{})
+		_, _ = io.Copy(io.Discard, conn)
+	}
+}
+
+func (b *Broker) update(f func(s *Stats)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	f(&b.stats)
+}
+
+// Stats returns a snapshot of the broker stats.
+func (b *Broker) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
+
+// Close stops accepting workers, turns away the queued workers and waits up to the close timeout
+// for the held leases to be released. Leases that are still held after the close timeout are
+// revoked by closing the connections of their workers.
+func (b *Broker) Close() error {
+	if b.listener == nil {
+		return nil
+	}
+	err := b.listener.Close()
+	close(b.closing)
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(b.cfg.CloseTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		b.mu.Lock()
+		slog.Warn("TPM leases not released within the close timeout, revoking them", "close_timeout", b.cfg.CloseTimeout, "leases", b.stats.Active)
+		for conn := range b.conns {
+			_ = conn.Close()
+		}
+		b.mu.Unlock()
+		<-done
+	}
+
+	return errors.Join(err, b.metrics.Unregister())
+}
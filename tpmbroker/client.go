@@ -0,0 +1,107 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpmbroker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// Acquire waits for a lease from the broker listening on socket. The returned release func
+// must be called once the TPM is no longer used, the lease is also released when the process exits.
+func Acquire(ctx context.Context, socket string) (func() error, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to tpm broker: %w", err)
+	}
+
+	// unblock the read below when ctx is done.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	status := make([]byte, 1)
+	if _, err := io.ReadFull(conn, status); err != nil {
+		closeErr := conn.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, errors.Join(fmt.Errorf("%w: %w", ErrQueueTimeout, ctxErr), closeErr)
+		}
+		return nil, errors.Join(fmt.Errorf("failed to read tpm broker status: %w", err), closeErr)
+	}
+
+	switch status[0] {
+	case statusGranted:
+		return conn.Close, nil
+	case statusQueueTimeout:
+		return nil, errors.Join(ErrQueueTimeout, conn.Close())
+	default:
+		return nil, errors.Join(fmt.Errorf("unexpected tpm broker status %d", status[0]), conn.Close())
+	}
+}
+
+// Do runs op while holding a lease from the broker on socket and gives up after opTimeout.
+// A blank socket runs op without a lease, a zero opTimeout never gives up.
+//
+// TPM commands can't be interrupted, so an op that times out keeps running in the background
+// and keeps its lease until it finishes. Callers are expected to fail the request and exit.
+func Do[T any](ctx context.Context, socket string, opTimeout time.Duration, op func() (T, error)) (T, error) {
+	var zero T
+
+	release := func() error { return nil }
+	if socket != "" {
+		var err error
+		release, err = Acquire(ctx, socket)
+		if err != nil {
+			return zero, err
+		}
+	}
+
+	type result struct {
+		v   T
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := op()
+		if releaseErr := release(); releaseErr != nil {
+			slog.Warn("failed to release tpm lease", "error", releaseErr)
+		}
+		done <- result{v: v, err: err}
+	}()
+
+	var timeout <-chan time.Time
+	if opTimeout > 0 {
+		timer := time.NewTimer(opTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case res := <-done:
+		return res.v, res.err
+	case <-timeout:
+		return zero, ErrOpTimeout
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpmbroker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/confidentsecurity/confidentcompute/tpmerr"
+	"github.com/stretchr/testify/require"
+)
+
+func startBroker(t *testing.T, cfg *Config) *Broker {
+	t.Helper()
+	cfg.Socket = filepath.Join(t.TempDir(), "tpm_broker.sock")
+	b := New(cfg)
+	require.NoError(t, b.Start())
+	t.Cleanup(func() {
+		require.NoError(t, b.Close())
+	})
+	return b
+}
+
+func TestBroker(t *testing.T) {
+	t.Run("ok, leases are serialized", func(t *testing.T) {
+		b := startBroker(t, &Config{MaxConcurrent: 1, QueueTimeout: 5 * time.Second, OpTimeout: 5 * time.Second})
+
+		var (
+			active    atomic.Int32
+			maxActive atomic.Int32
+			wg        sync.WaitGroup
+		)
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := Do(context.Background(), b.cfg.Socket, time.Second, func() (int, error) {
+					n := active.Add(1)
+					defer active.Add(-1)
+					if n > maxActive.Load() {
+						maxActive.Store(n)
+					}
+					time.Sleep(5 * time.Millisecond)
+					return 0, nil
+				})
+				require.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		require.Equal(t, int32(1), maxActive.Load())
+		require.Eventually(t, func() bool {
+			stats := b.Stats()
+			return stats.Granted == 8 && stats.Active == 0 && stats.QueueDepth == 0
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("fail, queue timeout", func(t *testing.T) {
+		b := startBroker(t, &Config{MaxConcurrent: 1, QueueTimeout: 20 * time.Millisecond})
+
+		release, err := Acquire(context.Background(), b.cfg.Socket)
+		require.NoError(t, err)
+		defer release()
+
+		_, err = Acquire(context.Background(), b.cfg.Socket)
+		require.ErrorIs(t, err, ErrQueueTimeout)
+		require.ErrorIs(t, err, tpmerr.ErrBusy)
+		require.Equal(t, uint64(1), b.Stats().QueueTimeouts)
+	})
+
+	t.Run("fail, context done while queued", func(t *testing.T) {
+		b := startBroker(t, &Config{MaxConcurrent: 1})
+
+		release, err := Acquire(context.Background(), b.cfg.Socket)
+		require.NoError(t, err)
+		defer release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err = Acquire(ctx, b.cfg.Socket)
+		require.ErrorIs(t, err, ErrQueueTimeout)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("ok, lease held too long is kept until it is released", func(t *testing.T) {
+		b := startBroker(t, &Config{MaxConcurrent: 1, OpTimeout: 20 * time.Millisecond})
+
+		release, err := Acquire(context.Background(), b.cfg.Socket)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			return b.Stats().OpTimeouts == 1
+		}, time.Second, 5*time.Millisecond)
+
+		// the worker may still be using the tpm, the next worker has to wait.
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = Acquire(ctx, b.cfg.Socket)
+		require.ErrorIs(t, err, ErrQueueTimeout)
+
+		require.NoError(t, release())
+		release2, err := Acquire(context.Background(), b.cfg.Socket)
+		require.NoError(t, err)
+		require.NoError(t, release2())
+	})
+
+	t.Run("ok, close revokes leases after the close timeout", func(t *testing.T) {
+		b := New(&Config{Socket: filepath.Join(t.TempDir(), "tpm_broker.sock"), MaxConcurrent: 1, CloseTimeout: 20 * time.Millisecond})
+		require.NoError(t, b.Start())
+
+		release, err := Acquire(context.Background(), b.cfg.Socket)
+		require.NoError(t, err)
+		defer release()
+
+		queued := make(chan error, 1)
+		go func() {
+			_, err := Acquire(context.Background(), b.cfg.Socket)
+			queued <- err
+		}()
+		require.Eventually(t, func() bool {
+			return b.Stats().QueueDepth == 1
+		}, time.Second, 5*time.Millisecond)
+
+		closed := make(chan error, 1)
+		go func() {
+			closed <- b.Close()
+		}()
+
+		// the queued worker is turned away right away, the lease is revoked after the close timeout.
+		require.Error(t, <-queued)
+		select {
+		case err := <-closed:
+			require.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("close did not revoke the held lease")
+		}
+		stats := b.Stats()
+		require.Zero(t, stats.Active)
+		require.Zero(t, stats.QueueDepth)
+	})
+
+	t.Run("ok, stale socket is replaced", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "tpm_broker.sock")
+		listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: socket, Net: "unix"})
+		require.NoError(t, err)
+		listener.SetUnlinkOnClose(false)
+		require.NoError(t, listener.Close())
+
+		b := New(&Config{Socket: socket, MaxConcurrent: 1})
+		require.NoError(t, b.Start())
+		t.Cleanup(func() {
+			require.NoError(t, b.Close())
+		})
+
+		release, err := Acquire(context.Background(), socket)
+		require.NoError(t, err)
+		require.NoError(t, release())
+	})
+
+	t.Run("fail, socket path is not a socket", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "tpm_broker.sock")
+		require.NoError(t, os.WriteFile(socket, []byte("data"), 0o600))
+
+		b := New(&Config{Socket: socket})
+		require.Error(t, b.Start())
+		data, err := os.ReadFile(socket)
+		require.NoError(t, err)
+		require.Equal(t, []byte("data"), data)
+	})
+}
+
+func TestDo(t *testing.T) {
+	t.Run("ok, without broker", func(t *testing.T) {
+		v, err := Do(context.Background(), "", 0, func() (string, error) {
+			return "ok", nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, "ok", v)
+	})
+
+	t.Run("fail, op error is returned", func(t *testing.T) {
+		opErr := errors.New("op failed")
+		_, err := Do(context.Background(), "", 0, func() (string, error) {
+			return "", opErr
+		})
+		require.ErrorIs(t, err, opErr)
+	})
+
+	t.Run("fail, op timeout", func(t *testing.T) {
+		unblock := make(chan struct{})
+		defer close(unblock)
+
+		_, err := Do(context.Background(), "", 10*time.Millisecond, func() (string, error) {
+			<-unblock
+			return "late", nil
+		})
+		require.ErrorIs(t, err, ErrOpTimeout)
+		require.ErrorIs(t, err, tpmerr.ErrBusy)
+	})
+
+	t.Run("fail, broker unreachable", func(t *testing.T) {
+		_, err := Do(context.Background(), filepath.Join(t.TempDir(), "missing.sock"), 0, func() (string, error) {
+			return "ok", nil
+		})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,179 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tpmerr classifies TPM response codes so callers can decide whether to retry a
+// command instead of matching on error strings.
+package tpmerr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpm2/transport"
+)
+
+// Class is how an error returned by the TPM should be handled.
+type Class int
+
+const (
+	// Fatal errors fail again when the command is resubmitted. Errors that did not come from
+	// the TPM are fatal too.
+	Fatal Class = iota
+	// Retryable errors are transient, the command should be resubmitted as-is.
+	Retryable
+	// Busy errors indicate the TPM ran out of resources shared with other users of the TPM, the
+	// command should be resubmitted after a backoff.
+	Busy
+)
+
+func (c Class) String() string {
+	switch c {
+	case Fatal:
+		return "fatal"
+	case Retryable:
+		return "retryable"
+	case Busy:
+		return "busy"
+	default:
+		return fmt.Sprintf("Class(%d)", int(c))
+	}
+}
+
+var (
+	ErrFatal     = errors.New("fatal tpm error")
+	ErrRetryable = errors.New("retryable tpm error")
+	ErrBusy      = errors.New("tpm busy")
+)
+
+// Classify returns the class of the TPM response code in err.
+func Classify(err error) Class {
+	var rc tpm2.TPMRC
+	if !errors.As(err, &rc) {
+		return Fatal
+	}
+	return classifyRC(rc)
+}
+
+// Wrap annotates err with the sentinel error of its class, so callers further up can use
+// errors.Is(err, ErrBusy) without knowing about TPM response codes. Errors that did not come
+// from the TPM are returned as-is.
+func Wrap(err error) error {
+	var rc tpm2.TPMRC
+	if err == nil || !errors.As(err, &rc) {
+		return err
+	}
+
+	switch classifyRC(rc) {
+	case Retryable:
+		return fmt.Errorf("%w: %w", ErrRetryable, err)
+	case Busy:
+		return fmt.Errorf("%w: %w", ErrBusy, err)
+	default:
+		return fmt.Errorf("%w: %w", ErrFatal, err)
+	}
+}
+
+func classifyRC(rc tpm2.TPMRC) Class {
+	switch rc { //nolint:exhaustive
+	case tpm2.TPMRCRetry, tpm2.TPMRCTesting, tpm2.TPMRCYielded, tpm2.TPMRCCanceled:
+		return Retryable
+	case tpm2.TPMRCMemory, tpm2.TPMRCObjectMemory, tpm2.TPMRCSessionMemory,
+		tpm2.TPMRCObjectHandles, tpm2.TPMRCSessionHandles, tpm2.TPMRCNVRate, tpm2.TPMRCNVUnavailable:
+		return Busy
+	default:
+		return Fatal
+	}
+}
+
+// Policy controls how often and how fast commands are resubmitted.
+type Policy struct {
+	// MaxAttempts is the maximum number of times a command is sent, including the first attempt.
+	MaxAttempts int
+	// RetryDelay is the delay before resubmitting a command that failed with a retryable error.
+	RetryDelay time.Duration
+	// BusyDelay is the delay before resubmitting a command that failed with a busy error, it
+	// doubles with every attempt.
+	BusyDelay time.Duration
+}
+
+// DefaultPolicy gives up after roughly a second of a busy TPM.
+var DefaultPolicy = Policy{
+	MaxAttempts: 5,
+	RetryDelay:  10 * time.Millisecond,
+	BusyDelay:   50 * time.Millisecond,
+}
+
+func (p Policy) delay(class Class, attempt int) time.Duration {
+	if class == Busy {
+		return p.BusyDelay << (attempt - 1)
+	}
+	return p.RetryDelay
+}
+
+// retryingTPM resubmits commands that fail with a retryable or busy response code.
+type retryingTPM struct {
+	transport.TPMCloser
+	policy Policy
+	sleep  func(time.Duration)
+}
+
+// NewRetryingTPM wraps tpm so that every command that fails with a retryable or busy response
+// code is resubmitted according to the policy. Once the attempts are exhausted, the last
+// response is returned to the caller as-is.
+func NewRetryingTPM(tpm transport.TPMCloser, policy Policy) transport.TPMCloser {
+	return &retryingTPM{
+		TPMCloser: tpm,
+		policy:    policy,
+		sleep:     time.Sleep,
+	}
+}
+
+func (t *retryingTPM) Send(cmd []byte) ([]byte, error) {
+	for attempt := 1; ; attempt++ {
+		rsp, err := t.TPMCloser.Send(cmd)
+		if err != nil {
+			return nil, err
+		}
+
+		rc, ok := responseCode(rsp)
+		if !ok || rc == tpm2.TPMRCSuccess || attempt >= t.policy.MaxAttempts {
+			return rsp, nil
+		}
+
+		class := classifyRC(rc)
+		if class == Fatal {
+			return rsp, nil
+		}
+
+		delay := t.policy.delay(class, attempt)
+		slog.Debug("Resubmitting tpm command", "class", class, "rc", rc, "attempt", attempt, "delay", delay)
+		t.sleep(delay)
+	}
+}
+
+// responseCode returns the response code from the header of a TPM response.
+func responseCode(rsp []byte) (tpm2.TPMRC, bool) {
+	// tag (2 bytes) | size (4 bytes) | response code (4 bytes)
+	if len(rsp) < 10 {
+		return 0, false
+	}
+	return tpm2.TPMRC(binary.BigEndian.Uint32(rsp[6:10])), true
+}
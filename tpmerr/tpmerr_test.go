@@ -0,0 +1,158 @@
+// Copyright 2025 Nonvolatile Inc. d/b/a Confident Security
+//
+// Licensed under the Functional Source License, Version 1.1,
+// ALv2 Future License, the terms and conditions of which are
+// set forth in the "LICENSE" file included in the root directory
+// of this code repository (the "License"); you may not use this
+// file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+// https://fsl.software/FSL-1.1-ALv2.template.md
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tpmerr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTPM responds to every command with the next response code in rcs, the last
+// response code is repeated once rcs is exhausted.
+type fakeTPM struct {
+	rcs   []tpm2.TPMRC
+	sends int
+}
+
+func (f *fakeTPM) Send([]byte) ([]byte, error) {
+	rc := f.rcs[min(f.sends, len(f.rcs)-1)]
+	f.sends++
+
+	rsp := make([]byte, 10)
+	binary.BigEndian.PutUint16(rsp[0:2], uint16(tpm2.TPMSTNoSessions))
+	binary.BigEndian.PutUint32(rsp[2:6], uint32(len(rsp)))
+	binary.BigEndian.PutUint32(rsp[6:10], uint32(rc))
+	return rsp, nil
+}
+
+func (*fakeTPM) Close() error {
+	return nil
+}
+
+func TestClassify(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want Class
+	}{
+		"retry":           {err: tpm2.TPMRCRetry, want: Retryable},
+		"testing":         {err: tpm2.TPMRCTesting, want: Retryable},
+		"object memory":   {err: tpm2.TPMRCObjectMemory, want: Busy},
+		"nv rate":         {err: tpm2.TPMRCNVRate, want: Busy},
+		"policy fail":     {err: tpm2.TPMRCPolicyFail, want: Fatal},
+		"initialize":      {err: tpm2.TPMRCInitialize, want: Fatal},
+		"wrapped":         {err: fmt.Errorf("ecdh: %w", tpm2.TPMRCSessionMemory), want: Busy},
+		"not a tpm error": {err: errors.New("boom"), want: Fatal},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, tc.want, Classify(tc.err))
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	t.Run("ok, busy error keeps response code", func(t *testing.T) {
+		err := Wrap(fmt.Errorf("ecdh: %w", tpm2.TPMRCObjectMemory))
+		require.ErrorIs(t, err, ErrBusy)
+		require.ErrorIs(t, err, tpm2.TPMRCObjectMemory)
+		require.NotErrorIs(t, err, ErrFatal)
+	})
+
+	t.Run("ok, fatal error", func(t *testing.T) {
+		err := Wrap(tpm2.TPMRCPolicyFail)
+		require.ErrorIs(t, err, ErrFatal)
+		require.ErrorIs(t, err, tpm2.TPMRCPolicyFail)
+	})
+
+	t.Run("ok, non tpm errors are unchanged", func(t *testing.T) {
+		err := errors.New("boom")
+		require.Equal(t, err, Wrap(err))
+		require.NoError(t, Wrap(nil))
+	})
+}
+
+func TestRetryingTPM(t *testing.T) {
+	policy := Policy{
+		MaxAttempts: 4,
+		RetryDelay:  time.Millisecond,
+		BusyDelay:   10 * time.Millisecond,
+	}
+
+	tests := map[string]struct {
+		rcs        []tpm2.TPMRC
+		wantRC     tpm2.TPMRC
+		wantSends  int
+		wantDelays []time.Duration
+	}{
+		"ok, success": {
+			rcs:       []tpm2.TPMRC{tpm2.TPMRCSuccess},
+			wantRC:    tpm2.TPMRCSuccess,
+			wantSends: 1,
+		},
+		"ok, retry then success": {
+			rcs:        []tpm2.TPMRC{tpm2.TPMRCRetry, tpm2.TPMRCTesting, tpm2.TPMRCSuccess},
+			wantRC:     tpm2.TPMRCSuccess,
+			wantSends:  3,
+			wantDelays: []time.Duration{time.Millisecond, time.Millisecond},
+		},
+		"ok, busy backs off exponentially": {
+			rcs:        []tpm2.TPMRC{tpm2.TPMRCObjectMemory, tpm2.TPMRCSessionHandles, tpm2.TPMRCSuccess},
+			wantRC:     tpm2.TPMRCSuccess,
+			wantSends:  3,
+			wantDelays: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond},
+		},
+		"fail, fatal is not retried": {
+			rcs:       []tpm2.TPMRC{tpm2.TPMRCPolicyFail},
+			wantRC:    tpm2.TPMRCPolicyFail,
+			wantSends: 1,
+		},
+		"fail, attempts exhausted": {
+			rcs:        []tpm2.TPMRC{tpm2.TPMRCRetry},
+			wantRC:     tpm2.TPMRCRetry,
+			wantSends:  4,
+			wantDelays: []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fake := &fakeTPM{rcs: tc.rcs}
+			tpm := NewRetryingTPM(fake, policy).(*retryingTPM)
+			var delays []time.Duration
+			tpm.sleep = func(d time.Duration) {
+				delays = append(delays, d)
+			}
+
+			rsp, err := tpm.Send([]byte{})
+			require.NoError(t, err)
+
+			rc, ok := responseCode(rsp)
+			require.True(t, ok)
+			require.Equal(t, tc.wantRC, rc)
+			require.Equal(t, tc.wantSends, fake.sends)
+			require.Equal(t, tc.wantDelays, delays)
+		})
+	}
+}